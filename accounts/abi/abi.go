@@ -116,15 +116,31 @@ func (abi *ABI) UnmarshalJSON(data []byte) error {
 			}
 		// empty defaults to function according to the abi spec
 		case "function", "":
-			abi.Methods[field.Name] = Method{
-				Name:    field.Name,
+			name := field.Name
+			for idx := 0; ; idx++ {
+				if _, ok := abi.Methods[name]; !ok {
+					break
+				}
+				name = fmt.Sprintf("%s%d", field.Name, idx)
+			}
+			abi.Methods[name] = Method{
+				Name:    name,
+				RawName: field.Name,
 				Const:   field.Constant,
 				Inputs:  field.Inputs,
 				Outputs: field.Outputs,
 			}
 		case "event":
-			abi.Events[field.Name] = Event{
-				Name:      field.Name,
+			name := field.Name
+			for idx := 0; ; idx++ {
+				if _, ok := abi.Events[name]; !ok {
+					break
+				}
+				name = fmt.Sprintf("%s%d", field.Name, idx)
+			}
+			abi.Events[name] = Event{
+				Name:      name,
+				RawName:   field.Name,
 				Anonymous: field.Anonymous,
 				Inputs:    field.Inputs,
 			}
@@ -56,14 +56,14 @@ const jsondata2 = `
 ]`
 
 func TestReader(t *testing.T) {
-	Uint256, _ := NewType("uint256")
+	Uint256, _ := NewType("uint256", "", nil)
 	exp := ABI{
 		Methods: map[string]Method{
 			"balance": {
-				"balance", true, nil, nil,
+				"balance", "balance", true, nil, nil,
 			},
 			"send": {
-				"send", false, []Argument{
+				"send", "send", false, []Argument{
 					{"amount", Uint256, false},
 				}, nil,
 			},
@@ -177,8 +177,8 @@ func TestTestSlice(t *testing.T) {
 }
 
 func TestMethodSignature(t *testing.T) {
-	String, _ := NewType("string")
-	m := Method{"foo", false, []Argument{{"bar", String, false}, {"baz", String, false}}, nil}
+	String, _ := NewType("string", "", nil)
+	m := Method{"foo", "foo", false, []Argument{{"bar", String, false}, {"baz", String, false}}, nil}
 	exp := "foo(string,string)"
 	if m.Sig() != exp {
 		t.Error("signature mismatch", exp, "!=", m.Sig())
@@ -189,8 +189,8 @@ func TestMethodSignature(t *testing.T) {
 		t.Errorf("expected ids to match %x != %x", m.Id(), idexp)
 	}
 
-	uintt, _ := NewType("uint256")
-	m = Method{"foo", false, []Argument{{"bar", uintt, false}}, nil}
+	uintt, _ := NewType("uint256", "", nil)
+	m = Method{"foo", "foo", false, []Argument{{"bar", uintt, false}}, nil}
 	exp = "foo(uint256)"
 	if m.Sig() != exp {
 		t.Error("signature mismatch", exp, "!=", m.Sig())
@@ -567,8 +567,8 @@ func TestBareEvents(t *testing.T) {
 	{ "type" : "event", "name" : "args", "inputs" : [{ "indexed":false, "name":"arg0", "type":"uint256" }, { "indexed":true, "name":"arg1", "type":"address" }] }
 	]`
 
-	arg0, _ := NewType("uint256")
-	arg1, _ := NewType("address")
+	arg0, _ := NewType("uint256", "", nil)
+	arg1, _ := NewType("address", "", nil)
 
 	expectedEvents := map[string]struct {
 		Anonymous bool
@@ -713,3 +713,110 @@ func TestABI_MethodById(t *testing.T) {
 	}
 
 }
+
+// Tests that overloaded methods and events get unique names, while keeping the
+// original name in their signatures.
+func TestOverloadedMethodSignature(t *testing.T) {
+	const abiJSON = `[
+		{"type":"function","name":"foo","constant":false,"inputs":[{"name":"i","type":"uint256"}]},
+		{"type":"function","name":"foo","constant":false,"inputs":[{"name":"i","type":"uint256"},{"name":"j","type":"uint256"}]},
+		{"type":"event","name":"bar","inputs":[{"name":"i","type":"uint256","indexed":true}]},
+		{"type":"event","name":"bar","inputs":[{"name":"i","type":"uint256","indexed":true},{"name":"j","type":"uint256","indexed":true}]}
+	]`
+	abi, err := JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(have, want string) {
+		if have != want {
+			t.Errorf("signature mismatch: have %q, want %q", have, want)
+		}
+	}
+	check(abi.Methods["foo"].Sig(), "foo(uint256)")
+	check(abi.Methods["foo0"].Sig(), "foo(uint256,uint256)")
+
+	check(abi.Events["bar"].String(), "e bar(i indexed uint256)")
+	check(abi.Events["bar0"].String(), "e bar(i indexed uint256, j indexed uint256)")
+
+	if have, want := abi.Events["bar0"].Id(), crypto.Keccak256Hash([]byte("bar(uint256,uint256)")); have != want {
+		t.Errorf("event id mismatch: have %x, want %x", have, want)
+	}
+	// Packing must use the selector of the original name
+	packed, err := abi.Pack("foo0", big.NewInt(1), big.NewInt(2))
+	if err != nil {
+		t.Fatalf("failed to pack overloaded method: %v", err)
+	}
+	if !bytes.Equal(packed[:4], crypto.Keccak256([]byte("foo(uint256,uint256)"))[:4]) {
+		t.Errorf("selector mismatch: have %x", packed[:4])
+	}
+}
+
+// Tests that tuples, including nested and dynamic ones, use their canonical
+// form in signatures and survive a pack/unpack round trip.
+func TestTuplePackUnpack(t *testing.T) {
+	const abiJSON = `[
+		{"type":"function","name":"echo","constant":true,
+		 "inputs":[{"name":"s","type":"tuple","internalType":"struct Echo.S","components":[
+			{"name":"a","type":"uint256"},
+			{"name":"b","type":"string"},
+			{"name":"c","type":"tuple[]","components":[{"name":"x","type":"bool"},{"name":"y","type":"bytes"}]}
+		 ]},{"name":"n","type":"uint8"}],
+		 "outputs":[{"name":"s","type":"tuple","components":[
+			{"name":"a","type":"uint256"},
+			{"name":"b","type":"string"},
+			{"name":"c","type":"tuple[]","components":[{"name":"x","type":"bool"},{"name":"y","type":"bytes"}]}
+		 ]},{"name":"n","type":"uint8"}]}
+	]`
+	abi, err := JSON(strings.NewReader(abiJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	method := abi.Methods["echo"]
+	if have, want := method.Sig(), "echo((uint256,string,(bool,bytes)[]),uint8)"; have != want {
+		t.Errorf("signature mismatch: have %q, want %q", have, want)
+	}
+	if have, want := method.Inputs[0].Type.TupleRawName, "EchoS"; have != want {
+		t.Errorf("struct name mismatch: have %q, want %q", have, want)
+	}
+	type inner struct {
+		X bool
+		Y []byte
+	}
+	type outer struct {
+		A *big.Int
+		B string
+		C []inner
+	}
+	in := outer{A: big.NewInt(42), B: "hello", C: []inner{{true, []byte{1, 2}}, {false, nil}}}
+
+	packed, err := abi.Pack("echo", in, uint8(7))
+	if err != nil {
+		t.Fatalf("failed to pack tuple: %v", err)
+	}
+	var out struct {
+		S outer
+		N uint8
+	}
+	if err := abi.Unpack(&out, "echo", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack tuple: %v", err)
+	}
+	in.C[1].Y = []byte{} // Unpacking creates empty slices
+	if !reflect.DeepEqual(out.S, in) || out.N != 7 {
+		t.Errorf("round trip mismatch: have %+v, want %+v", out, in)
+	}
+	// A simple tuple must match the reference encoding
+	packed, err = abi.Methods["echo"].Inputs[:1].Pack(outer{A: big.NewInt(1), B: "hi"})
+	if err != nil {
+		t.Fatalf("failed to pack tuple: %v", err)
+	}
+	want := common.Hex2Bytes("0000000000000000000000000000000000000000000000000000000000000020" +
+		"0000000000000000000000000000000000000000000000000000000000000001" +
+		"0000000000000000000000000000000000000000000000000000000000000060" +
+		"00000000000000000000000000000000000000000000000000000000000000a0" +
+		"0000000000000000000000000000000000000000000000000000000000000002" +
+		"6869000000000000000000000000000000000000000000000000000000000000" +
+		"0000000000000000000000000000000000000000000000000000000000000000")
+	if !bytes.Equal(packed, want) {
+		t.Errorf("encoding mismatch:\nhave %x\nwant %x", packed, want)
+	}
+}
@@ -42,11 +42,20 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
-// This nil assignment ensures compile time that SimulatedBackend implements bind.ContractBackend.
-var _ bind.ContractBackend = (*SimulatedBackend)(nil)
+// These nil assignments ensure compile time that SimulatedBackend implements
+// bind.ContractBackend and the chain access interfaces of ethclient.
+var (
+	_ bind.ContractBackend         = (*SimulatedBackend)(nil)
+	_ ethereum.ChainReader         = (*SimulatedBackend)(nil)
+	_ ethereum.TransactionReader   = (*SimulatedBackend)(nil)
+	_ ethereum.ChainStateReader    = (*SimulatedBackend)(nil)
+	_ ethereum.PendingStateReader  = (*SimulatedBackend)(nil)
+	_ ethereum.PendingStateEventer = (*SimulatedBackend)(nil)
+	_ ethereum.LogFilterer         = (*SimulatedBackend)(nil)
+)
 
-var errBlockNumberUnsupported = errors.New("SimulatedBackend cannot access blocks other than the latest block")
 var errGasEstimationFailed = errors.New("gas required exceeds allowance or always failing transaction")
+var errPendingBlockDirty = errors.New("pending block contains transactions")
 
 // SimulatedBackend implements bind.ContractBackend, simulating a blockchain in
 // the background. Its main purpose is to allow easily testing contract bindings.
@@ -54,10 +63,14 @@ type SimulatedBackend struct {
 	database   ethdb.Database   // In memory database to store our testing data
 	blockchain *core.BlockChain // Ethereum blockchain to handle the consensus
 
-	mu           sync.Mutex
-	pendingBlock *types.Block   // Currently pending block that will be imported on request
-	pendingState *state.StateDB // Currently pending state that will be the active on on request
+	mu              sync.Mutex
+	pendingBlock    *types.Block   // Currently pending block that will be imported on request
+	pendingState    *state.StateDB // Currently pending state that will be the active on on request
+	pendingReceipts types.Receipts // Receipts of the transactions in the pending block
+	timeOffset      int64          // Seconds the pending block's timestamp is shifted by
 
+	mux    *event.TypeMux       // Event mux to post pending logs on
+	txFeed event.Feed           // Event feed to notify pending transaction arrivals
 	events *filters.EventSystem // Event system for filtering log events live
 
 	config *params.ChainConfig
@@ -75,14 +88,18 @@ func NewSimulatedBackend(alloc core.GenesisAlloc, gasLimit uint64) *SimulatedBac
 		database:   database,
 		blockchain: blockchain,
 		config:     genesis.Config,
-		events:     filters.NewEventSystem(new(event.TypeMux), &filterBackend{database, blockchain}, false),
+		mux:        new(event.TypeMux),
 	}
-	backend.rollback()
+	backend.events = filters.NewEventSystem(backend.mux, &filterBackend{database, blockchain, backend}, false)
+	backend.rollback(blockchain.CurrentBlock())
 	return backend
 }
 
 // Commit imports all the pending transactions as a single block and starts a
-// fresh new state.
+// fresh new state on top of it.
+//
+// If the pending block extends a fork, it only becomes the canonical head when
+// the fork grows heavier than the current chain.
 func (b *SimulatedBackend) Commit() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
@@ -90,7 +107,8 @@ func (b *SimulatedBackend) Commit() {
 	if _, err := b.blockchain.InsertChain([]*types.Block{b.pendingBlock}); err != nil {
 		panic(err) // This cannot happen unless the simulator is wrong, fail in that case
 	}
-	b.rollback()
+	// Build on the inserted block even if it's not canonical to keep forks growing
+	b.rollback(b.pendingBlock)
 }
 
 // Rollback aborts all pending transactions, reverting to the last committed state.
@@ -98,26 +116,200 @@ func (b *SimulatedBackend) Rollback() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	b.rollback()
+	b.rollback(b.pendingParent())
+}
+
+// Fork discards the (empty) pending block and starts building a side chain on
+// top of the given ancestor, which can be used to simulate reorganisations.
+//
+// Transactions sent afterwards are included in the side chain as usual. It only
+// becomes canonical, firing the head and removed log events, once it grows
+// heavier than the current chain; at equal weight it might win or lose at random,
+// similarly to the live network. Until then, calls and state retrievals keep on
+// operating on the current canonical chain.
+func (b *SimulatedBackend) Fork(ctx context.Context, parent common.Hash) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.pendingBlock.Transactions()) != 0 {
+		return errPendingBlockDirty
+	}
+	block := b.blockchain.GetBlockByHash(parent)
+	if block == nil {
+		return ethereum.NotFound
+	}
+	b.rollback(block)
+	return nil
 }
 
-func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
+// rollback resets the pending block to an empty one on top of parent, dropping
+// any time adjustment.
+func (b *SimulatedBackend) rollback(parent *types.Block) {
+	b.timeOffset = 0
+	b.setPendingBlock(parent, nil)
+}
+
+// pendingParent retrieves the block the pending block is built on.
+func (b *SimulatedBackend) pendingParent() *types.Block {
+	return b.blockchain.GetBlock(b.pendingBlock.ParentHash(), b.pendingBlock.NumberU64()-1)
+}
+
+// setPendingBlock regenerates the pending block and state on top of parent,
+// including the given transactions and applying the current time adjustment.
+func (b *SimulatedBackend) setPendingBlock(parent *types.Block, txs types.Transactions) {
+	blocks, receipts := core.GenerateChain(b.config, parent, ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+		if b.timeOffset != 0 {
+			block.OffsetTime(b.timeOffset)
+		}
+		for _, tx := range txs {
+			block.AddTxWithChain(b.blockchain, tx)
+		}
+	})
 	statedb, _ := b.blockchain.State()
 
 	b.pendingBlock = blocks[0]
+	b.pendingReceipts = receipts[0]
 	b.pendingState, _ = state.New(b.pendingBlock.Root(), statedb.Database())
 }
 
+// pending retrieves the currently pending block and the receipts of its
+// transactions.
+func (b *SimulatedBackend) pending() (*types.Block, types.Receipts) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.pendingBlock, b.pendingReceipts
+}
+
+// blockByNumber retrieves a canonical block, or the head if number is nil.
+func (b *SimulatedBackend) blockByNumber(number *big.Int) (*types.Block, error) {
+	if number == nil {
+		return b.blockchain.CurrentBlock(), nil
+	}
+	if number.Sign() < 0 || !number.IsUint64() {
+		return nil, ethereum.NotFound
+	}
+	block := b.blockchain.GetBlockByNumber(number.Uint64())
+	if block == nil {
+		return nil, ethereum.NotFound
+	}
+	return block, nil
+}
+
+// stateByBlockNumber retrieves the state of a canonical block, or of the head
+// if number is nil.
+func (b *SimulatedBackend) stateByBlockNumber(number *big.Int) (*state.StateDB, error) {
+	block, err := b.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return b.blockchain.StateAt(block.Root())
+}
+
+// BlockByHash retrieves a block by hash, canonical or not.
+func (b *SimulatedBackend) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if block := b.blockchain.GetBlockByHash(hash); block != nil {
+		return block, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+// BlockByNumber retrieves a canonical block by number, or the head if number is
+// nil.
+func (b *SimulatedBackend) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.blockByNumber(number)
+}
+
+// HeaderByHash retrieves a header by hash, canonical or not.
+func (b *SimulatedBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if header := b.blockchain.GetHeaderByHash(hash); header != nil {
+		return header, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+// HeaderByNumber retrieves a canonical header by number, or the head if number
+// is nil.
+func (b *SimulatedBackend) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	block, err := b.blockByNumber(number)
+	if err != nil {
+		return nil, err
+	}
+	return block.Header(), nil
+}
+
+// TransactionCount returns the number of transactions in the given block.
+func (b *SimulatedBackend) TransactionCount(ctx context.Context, blockHash common.Hash) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	block := b.blockchain.GetBlockByHash(blockHash)
+	if block == nil {
+		return 0, ethereum.NotFound
+	}
+	return uint(len(block.Transactions())), nil
+}
+
+// TransactionInBlock returns the transaction at the given index of a block.
+func (b *SimulatedBackend) TransactionInBlock(ctx context.Context, blockHash common.Hash, index uint) (*types.Transaction, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	block := b.blockchain.GetBlockByHash(blockHash)
+	if block == nil || index >= uint(len(block.Transactions())) {
+		return nil, ethereum.NotFound
+	}
+	return block.Transactions()[index], nil
+}
+
+// SubscribeNewHead subscribes to notifications about new canonical chain heads,
+// including the ones of reorganisations.
+func (b *SimulatedBackend) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	sink := make(chan *types.Header)
+	sub := b.events.SubscribeNewHeads(sink)
+
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case head := <-sink:
+				select {
+				case ch <- head:
+				case err := <-sub.Err():
+					return err
+				case <-quit:
+					return nil
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
 // CodeAt returns the code associated with a certain account in the blockchain.
 func (b *SimulatedBackend) CodeAt(ctx context.Context, contract common.Address, blockNumber *big.Int) ([]byte, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetCode(contract), nil
 }
 
@@ -126,10 +318,10 @@ func (b *SimulatedBackend) BalanceAt(ctx context.Context, contract common.Addres
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetBalance(contract), nil
 }
 
@@ -138,10 +330,10 @@ func (b *SimulatedBackend) NonceAt(ctx context.Context, contract common.Address,
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return 0, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return 0, err
 	}
-	statedb, _ := b.blockchain.State()
 	return statedb.GetNonce(contract), nil
 }
 
@@ -150,20 +342,56 @@ func (b *SimulatedBackend) StorageAt(ctx context.Context, contract common.Addres
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	statedb, err := b.stateByBlockNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	statedb, _ := b.blockchain.State()
 	val := statedb.GetState(contract, key)
 	return val[:], nil
 }
 
+// TransactionByHash returns the transaction with the given hash, either from
+// the pending block or from the canonical chain.
+func (b *SimulatedBackend) TransactionByHash(ctx context.Context, txHash common.Hash) (*types.Transaction, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if tx := b.pendingBlock.Transaction(txHash); tx != nil {
+		return tx, true, nil
+	}
+	if tx, _, _, _ := rawdb.ReadTransaction(b.database, txHash); tx != nil {
+		return tx, false, nil
+	}
+	return nil, false, ethereum.NotFound
+}
+
 // TransactionReceipt returns the receipt of a transaction.
 func (b *SimulatedBackend) TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error) {
 	receipt, _, _, _ := rawdb.ReadReceipt(b.database, txHash)
+	if receipt == nil {
+		return nil, ethereum.NotFound
+	}
 	return receipt, nil
 }
 
+// PendingBalanceAt returns the wei balance of an account in the pending state.
+func (b *SimulatedBackend) PendingBalanceAt(ctx context.Context, account common.Address) (*big.Int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.pendingState.GetBalance(account), nil
+}
+
+// PendingStorageAt returns the value of key in the storage of an account in the
+// pending state.
+func (b *SimulatedBackend) PendingStorageAt(ctx context.Context, account common.Address, key common.Hash) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	val := b.pendingState.GetState(account, key)
+	return val[:], nil
+}
+
 // PendingCodeAt returns the code associated with an account in the pending state.
 func (b *SimulatedBackend) PendingCodeAt(ctx context.Context, contract common.Address) ([]byte, error) {
 	b.mu.Lock()
@@ -172,19 +400,58 @@ func (b *SimulatedBackend) PendingCodeAt(ctx context.Context, contract common.Ad
 	return b.pendingState.GetCode(contract), nil
 }
 
+// PendingTransactionCount returns the number of transactions in the pending block.
+func (b *SimulatedBackend) PendingTransactionCount(ctx context.Context) (uint, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return uint(len(b.pendingBlock.Transactions())), nil
+}
+
+// SubscribePendingTransactions subscribes to notifications about transactions
+// added to the pending block.
+func (b *SimulatedBackend) SubscribePendingTransactions(ctx context.Context, ch chan<- *types.Transaction) (ethereum.Subscription, error) {
+	sink := make(chan core.NewTxsEvent)
+	sub := b.txFeed.Subscribe(sink)
+
+	// Since we're getting transactions in batches, we need to flatten them into a plain stream
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case ev := <-sink:
+				for _, tx := range ev.Txs {
+					select {
+					case ch <- tx:
+					case err := <-sub.Err():
+						return err
+					case <-quit:
+						return nil
+					}
+				}
+			case err := <-sub.Err():
+				return err
+			case <-quit:
+				return nil
+			}
+		}
+	}), nil
+}
+
 // CallContract executes a contract call.
 func (b *SimulatedBackend) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if blockNumber != nil && blockNumber.Cmp(b.blockchain.CurrentBlock().Number()) != 0 {
-		return nil, errBlockNumberUnsupported
+	block, err := b.blockByNumber(blockNumber)
+	if err != nil {
+		return nil, err
 	}
-	state, err := b.blockchain.State()
+	state, err := b.blockchain.StateAt(block.Root())
 	if err != nil {
 		return nil, err
 	}
-	rval, _, _, err := b.callContract(ctx, call, b.blockchain.CurrentBlock(), state)
+	rval, _, _, err := b.callContract(ctx, call, block, state)
 	return rval, err
 }
 
@@ -294,10 +561,23 @@ func (b *SimulatedBackend) callContract(ctx context.Context, call ethereum.CallM
 // SendTransaction updates the pending block to include the given transaction.
 // It panics if the transaction is invalid.
 func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transaction) error {
+	logs := b.addTransaction(tx)
+
+	// Notify the pending transaction and log subscribers outside of the lock
+	b.txFeed.Send(core.NewTxsEvent{Txs: []*types.Transaction{tx}})
+	if len(logs) > 0 {
+		b.mux.Post(core.PendingLogsEvent{Logs: logs})
+	}
+	return nil
+}
+
+// addTransaction regenerates the pending block with the given transaction
+// appended, returning the logs it emitted. It panics if the transaction is invalid.
+func (b *SimulatedBackend) addTransaction(tx *types.Transaction) []*types.Log {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	sender, err := types.Sender(types.HomesteadSigner{}, tx)
+	sender, err := types.Sender(types.NewEIP155Signer(b.config.ChainID), tx)
 	if err != nil {
 		panic(fmt.Errorf("invalid transaction: %v", err))
 	}
@@ -305,29 +585,27 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 	if tx.Nonce() != nonce {
 		panic(fmt.Errorf("invalid transaction nonce: got %d, want %d", tx.Nonce(), nonce))
 	}
+	txs := make(types.Transactions, 0, len(b.pendingBlock.Transactions())+1)
+	txs = append(append(txs, b.pendingBlock.Transactions()...), tx)
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
-			block.AddTxWithChain(b.blockchain, tx)
-		}
-		block.AddTxWithChain(b.blockchain, tx)
-	})
-	statedb, _ := b.blockchain.State()
-
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), statedb.Database())
-	return nil
+	b.setPendingBlock(b.pendingParent(), txs)
+	return b.pendingReceipts[len(b.pendingReceipts)-1].Logs
 }
 
 // FilterLogs executes a log filter operation, blocking during execution and
-// returning all the results in one batch.
+// returning all the results in one batch. A pending upper boundary includes the
+// logs of the pending block too.
 //
 // TODO(karalabe): Deprecate when the subscription one can return past data too.
 func (b *SimulatedBackend) FilterLogs(ctx context.Context, query ethereum.FilterQuery) ([]types.Log, error) {
-	var filter *filters.Filter
+	var (
+		backend = &filterBackend{b.database, b.blockchain, b}
+		logs    []*types.Log
+		err     error
+	)
 	if query.BlockHash != nil {
 		// Block filter requested, construct a single-shot filter
-		filter = filters.NewBlockFilter(&filterBackend{b.database, b.blockchain}, *query.BlockHash, query.Addresses, query.Topics)
+		logs, err = filters.NewBlockFilter(backend, *query.BlockHash, query.Addresses, query.Topics).Logs(ctx)
 	} else {
 		// Initialize unset filter boundaried to run from genesis to chain head
 		from := int64(0)
@@ -338,11 +616,24 @@ func (b *SimulatedBackend) FilterLogs(ctx context.Context, query ethereum.Filter
 		if query.ToBlock != nil {
 			to = query.ToBlock.Int64()
 		}
-		// Construct the range filter
-		filter = filters.NewRangeFilter(&filterBackend{b.database, b.blockchain}, from, to, query.Addresses, query.Topics)
+		pending := rpc.PendingBlockNumber.Int64()
+
+		// Filter the chain range, and the pending block if requested
+		if from != pending {
+			end := to
+			if end == pending {
+				end = rpc.LatestBlockNumber.Int64()
+			}
+			logs, err = filters.NewRangeFilter(backend, from, end, query.Addresses, query.Topics).Logs(ctx)
+		}
+		if err == nil && to == pending {
+			block, _ := b.pending()
+
+			var found []*types.Log
+			found, err = filters.NewBlockFilter(backend, block.Hash(), query.Addresses, query.Topics).Logs(ctx)
+			logs = append(logs, found...)
+		}
 	}
-	// Run the filter and return all the logs
-	logs, err := filter.Logs(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -354,7 +645,8 @@ func (b *SimulatedBackend) FilterLogs(ctx context.Context, query ethereum.Filter
 }
 
 // SubscribeFilterLogs creates a background log filtering operation, returning a
-// subscription immediately, which can be used to stream the found events.
+// subscription immediately, which can be used to stream the found events. Logs
+// reverted by a reorganisation are delivered again with Removed set.
 func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, query ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error) {
 	// Subscribe to contract events
 	sink := make(chan []*types.Log)
@@ -387,20 +679,14 @@ func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, query ethere
 	}), nil
 }
 
-// AdjustTime adds a time shift to the simulated clock.
+// AdjustTime adds a time shift to the simulated clock. The shift moves the
+// timestamp of the pending block, and thus of all blocks built on top of it.
 func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
-		for _, tx := range b.pendingBlock.Transactions() {
-			block.AddTx(tx)
-		}
-		block.OffsetTime(int64(adjustment.Seconds()))
-	})
-	statedb, _ := b.blockchain.State()
 
-	b.pendingBlock = blocks[0]
-	b.pendingState, _ = state.New(b.pendingBlock.Root(), statedb.Database())
+	b.timeOffset += int64(adjustment.Seconds())
+	b.setPendingBlock(b.pendingParent(), b.pendingBlock.Transactions())
 
 	return nil
 }
@@ -422,8 +708,9 @@ func (m callmsg) Data() []byte         { return m.CallMsg.Data }
 // filterBackend implements filters.Backend to support filtering for logs without
 // taking bloom-bits acceleration structures into account.
 type filterBackend struct {
-	db ethdb.Database
-	bc *core.BlockChain
+	db      ethdb.Database
+	bc      *core.BlockChain
+	backend *SimulatedBackend
 }
 
 func (fb *filterBackend) ChainDb() ethdb.Database  { return fb.db }
@@ -437,10 +724,16 @@ func (fb *filterBackend) HeaderByNumber(ctx context.Context, block rpc.BlockNumb
 }
 
 func (fb *filterBackend) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	if block, _ := fb.backend.pending(); block.Hash() == hash {
+		return block.Header(), nil
+	}
 	return fb.bc.GetHeaderByHash(hash), nil
 }
 
 func (fb *filterBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	if block, receipts := fb.backend.pending(); block.Hash() == hash {
+		return receipts, nil
+	}
 	number := rawdb.ReadHeaderNumber(fb.db, hash)
 	if number == nil {
 		return nil, nil
@@ -449,11 +742,7 @@ func (fb *filterBackend) GetReceipts(ctx context.Context, hash common.Hash) (typ
 }
 
 func (fb *filterBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*types.Log, error) {
-	number := rawdb.ReadHeaderNumber(fb.db, hash)
-	if number == nil {
-		return nil, nil
-	}
-	receipts := rawdb.ReadReceipts(fb.db, hash, *number)
+	receipts, _ := fb.GetReceipts(ctx, hash)
 	if receipts == nil {
 		return nil, nil
 	}
@@ -465,10 +754,7 @@ func (fb *filterBackend) GetLogs(ctx context.Context, hash common.Hash) ([][]*ty
 }
 
 func (fb *filterBackend) SubscribeNewTxsEvent(ch chan<- core.NewTxsEvent) event.Subscription {
-	return event.NewSubscription(func(quit <-chan struct{}) error {
-		<-quit
-		return nil
-	})
+	return fb.backend.txFeed.Subscribe(ch)
 }
 func (fb *filterBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return fb.bc.SubscribeChainEvent(ch)
@@ -0,0 +1,254 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends_test
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	testKey, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	testAddr    = crypto.PubkeyToAddress(testKey.PublicKey)
+	testEmitter = crypto.CreateAddress(testAddr, 0)
+	testTopic   = common.BigToHash(big.NewInt(1))
+)
+
+// emitterCode deploys a contract emitting an anonymous log with a single topic
+// of 0x01 on every call.
+const emitterCode = "6009600c60003960096000f3600160006000a100"
+
+// newEmitterBackend creates a simulated backend with the log emitter deployed
+// in block 1.
+func newEmitterBackend(t *testing.T) *backends.SimulatedBackend {
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{testAddr: {Balance: big.NewInt(1000000000)}}, 10000000)
+
+	tx, _ := types.SignTx(types.NewContractCreation(0, new(big.Int), 100000, big.NewInt(1), common.FromHex(emitterCode)), types.HomesteadSigner{}, testKey)
+	sim.SendTransaction(context.Background(), tx)
+	sim.Commit()
+
+	if code, err := sim.CodeAt(context.Background(), testEmitter, nil); err != nil || len(code) == 0 {
+		t.Fatalf("emitter not deployed: %x (%v)", code, err)
+	}
+	return sim
+}
+
+// emit sends a transaction calling the log emitter.
+func emit(sim *backends.SimulatedBackend, nonce uint64) *types.Transaction {
+	tx, _ := types.SignTx(types.NewTransaction(nonce, testEmitter, new(big.Int), 100000, big.NewInt(1), nil), types.HomesteadSigner{}, testKey)
+	sim.SendTransaction(context.Background(), tx)
+	return tx
+}
+
+// Tests that the state of past blocks can be retrieved.
+func TestSimulatedHistoricState(t *testing.T) {
+	sim := newEmitterBackend(t)
+	ctx := context.Background()
+
+	balance, _ := sim.BalanceAt(ctx, testAddr, nil)
+	for _, number := range []int64{0, 1} {
+		nonce, err := sim.NonceAt(ctx, testAddr, big.NewInt(number))
+		if err != nil || nonce != uint64(number) {
+			t.Errorf("block %d: nonce mismatch: have %d (%v), want %d", number, nonce, err, number)
+		}
+	}
+	if old, _ := sim.BalanceAt(ctx, testAddr, common.Big0); old.Cmp(balance) <= 0 {
+		t.Errorf("genesis balance %v not above current %v", old, balance)
+	}
+	if code, _ := sim.CodeAt(ctx, testEmitter, common.Big0); len(code) != 0 {
+		t.Errorf("emitter code present at genesis: %x", code)
+	}
+	if _, err := sim.NonceAt(ctx, testAddr, big.NewInt(2)); err != ethereum.NotFound {
+		t.Errorf("future block error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	header, err := sim.HeaderByNumber(ctx, nil)
+	if err != nil || header.Number.Uint64() != 1 {
+		t.Fatalf("head header mismatch: %v (%v)", header, err)
+	}
+	block, err := sim.BlockByHash(ctx, header.Hash())
+	if err != nil || len(block.Transactions()) != 1 {
+		t.Fatalf("head block mismatch: %v (%v)", block, err)
+	}
+	if count, _ := sim.TransactionCount(ctx, header.Hash()); count != 1 {
+		t.Errorf("transaction count mismatch: have %d, want 1", count)
+	}
+	if _, pending, err := sim.TransactionByHash(ctx, block.Transactions()[0].Hash()); err != nil || pending {
+		t.Errorf("mined transaction mismatch: pending %v (%v)", pending, err)
+	}
+}
+
+// Tests that the pending state, transactions and logs are accessible.
+func TestSimulatedPendingState(t *testing.T) {
+	sim := newEmitterBackend(t)
+	ctx := context.Background()
+
+	txs := make(chan *types.Transaction, 1)
+	txSub, _ := sim.SubscribePendingTransactions(ctx, txs)
+	defer txSub.Unsubscribe()
+
+	logs := make(chan types.Log, 1)
+	pending := big.NewInt(rpc.PendingBlockNumber.Int64())
+	logSub, err := sim.SubscribeFilterLogs(ctx, ethereum.FilterQuery{FromBlock: pending, ToBlock: pending}, logs)
+	if err != nil {
+		t.Fatalf("failed to subscribe to pending logs: %v", err)
+	}
+	defer logSub.Unsubscribe()
+
+	tx := emit(sim, 1)
+	select {
+	case have := <-txs:
+		if have.Hash() != tx.Hash() {
+			t.Errorf("pending transaction mismatch: have %x, want %x", have.Hash(), tx.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pending transaction not announced")
+	}
+	select {
+	case log := <-logs:
+		if log.TxHash != tx.Hash() {
+			t.Errorf("pending log transaction mismatch: have %x, want %x", log.TxHash, tx.Hash())
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pending log not announced")
+	}
+	if count, _ := sim.PendingTransactionCount(ctx); count != 1 {
+		t.Errorf("pending transaction count mismatch: have %d, want 1", count)
+	}
+	if _, isPending, err := sim.TransactionByHash(ctx, tx.Hash()); err != nil || !isPending {
+		t.Errorf("pending transaction mismatch: pending %v (%v)", isPending, err)
+	}
+	if _, err := sim.TransactionReceipt(ctx, tx.Hash()); err != ethereum.NotFound {
+		t.Errorf("pending receipt error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	query := ethereum.FilterQuery{Addresses: []common.Address{testEmitter}, Topics: [][]common.Hash{{testTopic}}}
+	if found, _ := sim.FilterLogs(ctx, query); len(found) != 0 {
+		t.Errorf("mined logs mismatch: have %d, want 0", len(found))
+	}
+	query.ToBlock = pending
+	if found, _ := sim.FilterLogs(ctx, query); len(found) != 1 {
+		t.Errorf("pending logs mismatch: have %d, want 1", len(found))
+	}
+	sim.Commit()
+
+	query.ToBlock = nil
+	if found, _ := sim.FilterLogs(ctx, query); len(found) != 1 || found[0].BlockNumber != 2 {
+		t.Errorf("mined logs mismatch: have %v, want 1 in block 2", found)
+	}
+}
+
+// Tests that time adjustments are retained by the pending block.
+func TestSimulatedAdjustTime(t *testing.T) {
+	sim := newEmitterBackend(t)
+	ctx := context.Background()
+
+	parent, _ := sim.HeaderByNumber(ctx, nil)
+	if err := sim.AdjustTime(time.Hour); err != nil {
+		t.Fatalf("failed to adjust time: %v", err)
+	}
+	emit(sim, 1)
+	sim.Commit()
+
+	head, _ := sim.HeaderByNumber(ctx, nil)
+	if delta := head.Time.Uint64() - parent.Time.Uint64(); delta < 3600 {
+		t.Errorf("block time delta mismatch: have %d, want at least 3600", delta)
+	}
+}
+
+// Tests that forks can be simulated, reorganising the chain and reverting logs
+// once the side chain becomes heavier.
+func TestSimulatedFork(t *testing.T) {
+	sim := newEmitterBackend(t)
+	ctx := context.Background()
+
+	logs := make(chan types.Log, 2)
+	sub, err := sim.SubscribeFilterLogs(ctx, ethereum.FilterQuery{Addresses: []common.Address{testEmitter}}, logs)
+	if err != nil {
+		t.Fatalf("failed to subscribe to logs: %v", err)
+	}
+	defer sub.Unsubscribe()
+
+	heads := make(chan *types.Header, 4)
+	headSub, _ := sim.SubscribeNewHead(ctx, heads)
+	defer headSub.Unsubscribe()
+
+	// Mine a log into block 2, and fork off block 1
+	ancestor, _ := sim.HeaderByNumber(ctx, nil)
+	tx := emit(sim, 1)
+	if err := sim.Fork(ctx, ancestor.Hash()); err == nil {
+		t.Fatalf("fork allowed with pending transactions")
+	}
+	sim.Commit()
+
+	select {
+	case log := <-logs:
+		if log.Removed || log.TxHash != tx.Hash() {
+			t.Fatalf("mined log mismatch: %+v", log)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("mined log not delivered")
+	}
+	if err := sim.Fork(ctx, ancestor.Hash()); err != nil {
+		t.Fatalf("failed to fork: %v", err)
+	}
+	// Grow the side chain past the canonical one and check the reorg
+	sim.Commit()
+	sim.Commit()
+
+	select {
+	case log := <-logs:
+		if !log.Removed || log.TxHash != tx.Hash() {
+			t.Fatalf("removed log mismatch: %+v", log)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("removed log not delivered")
+	}
+	head, _ := sim.HeaderByNumber(ctx, nil)
+	if head.Number.Uint64() != 3 {
+		t.Fatalf("head number mismatch: have %d, want 3", head.Number)
+	}
+	block, _ := sim.BlockByNumber(ctx, big.NewInt(2))
+	if block.ParentHash() != ancestor.Hash() || len(block.Transactions()) != 0 {
+		t.Errorf("side block not canonical: %x", block.Hash())
+	}
+	if _, err := sim.TransactionReceipt(ctx, tx.Hash()); err != ethereum.NotFound {
+		t.Errorf("reverted receipt error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	if nonce, _ := sim.PendingNonceAt(ctx, testAddr); nonce != 1 {
+		t.Errorf("pending nonce mismatch: have %d, want 1", nonce)
+	}
+	// The head of the side chain must be announced
+	for {
+		select {
+		case announced := <-heads:
+			if announced.Hash() == head.Hash() {
+				return
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("side chain head not announced")
+		}
+	}
+}
@@ -24,6 +24,7 @@ import (
 	"bytes"
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"text/template"
 	"unicode"
@@ -45,10 +46,20 @@ const (
 // to be used as is in client code, but rather as an intermediate struct which
 // enforces compile time type safety and naming convention opposed to having to
 // manually maintain hard coded strings that break on runtime.
-func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang) (string, error) {
+//
+// The libs map holds the library placeholders that may be found in the bytecode,
+// mapped to the type of the library. If that is bound too, the deploy method of
+// the contract deploys the library first and links it into the bytecode.
+func Bind(types []string, abis []string, bytecodes []string, pkg string, lang Lang, libs map[string]string) (string, error) {
 	// Process each individual contract requested binding
-	contracts := make(map[string]*tmplContract)
-
+	var (
+		contracts = make(map[string]*tmplContract)
+		structs   = make(map[string]*tmplStruct)
+		bound     = make(map[string]bool)
+	)
+	for i := 0; i < len(types); i++ {
+		bound[capitalise(types[i])] = true
+	}
 	for i := 0; i < len(types); i++ {
 		// Parse the actual ABI to generate the binding for
 		evmABI, err := abi.JSON(strings.NewReader(abis[i]))
@@ -68,11 +79,22 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			calls     = make(map[string]*tmplMethod)
 			transacts = make(map[string]*tmplMethod)
 			events    = make(map[string]*tmplEvent)
+
+			// identifiers are used to detect duplicated identifiers of functions.
+			// Overloaded names are already made unique by the abi package, but
+			// different names may still normalize to the same one.
+			identifiers = make(map[string]bool)
 		)
-		for _, original := range evmABI.Methods {
+		for _, name := range sortedMethods(evmABI.Methods) {
+			original := evmABI.Methods[name]
+
 			// Normalize the method for capital cases and non-anonymous inputs/outputs
 			normalized := original
 			normalized.Name = methodNormalizer[lang](original.Name)
+			if identifiers[normalized.Name] {
+				return "", fmt.Errorf("duplicated identifier \"%s\" (normalized \"%s\")", original.Name, normalized.Name)
+			}
+			identifiers[normalized.Name] = true
 
 			normalized.Inputs = make([]abi.Argument, len(original.Inputs))
 			copy(normalized.Inputs, original.Inputs)
@@ -80,6 +102,7 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 				if input.Name == "" {
 					normalized.Inputs[j].Name = fmt.Sprintf("arg%d", j)
 				}
+				bindStructType(input.Type, structs)
 			}
 			normalized.Outputs = make([]abi.Argument, len(original.Outputs))
 			copy(normalized.Outputs, original.Outputs)
@@ -87,6 +110,7 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 				if output.Name != "" {
 					normalized.Outputs[j].Name = capitalise(output.Name)
 				}
+				bindStructType(output.Type, structs)
 			}
 			// Append the methods to the call or transact lists
 			if original.Const {
@@ -95,7 +119,10 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 				transacts[original.Name] = &tmplMethod{Original: original, Normalized: normalized, Structured: structured(original.Outputs)}
 			}
 		}
-		for _, original := range evmABI.Events {
+		eventIdentifiers := make(map[string]bool)
+		for _, name := range sortedEvents(evmABI.Events) {
+			original := evmABI.Events[name]
+
 			// Skip anonymous events as they don't support explicit filtering
 			if original.Anonymous {
 				continue
@@ -103,6 +130,10 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			// Normalize the event for capital cases and non-anonymous outputs
 			normalized := original
 			normalized.Name = methodNormalizer[lang](original.Name)
+			if eventIdentifiers[normalized.Name] {
+				return "", fmt.Errorf("duplicated identifier \"%s\" (normalized \"%s\")", original.Name, normalized.Name)
+			}
+			eventIdentifiers[normalized.Name] = true
 
 			normalized.Inputs = make([]abi.Argument, len(original.Inputs))
 			copy(normalized.Inputs, original.Inputs)
@@ -113,10 +144,21 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 						normalized.Inputs[j].Name = fmt.Sprintf("arg%d", j)
 					}
 				}
+				bindStructType(input.Type, structs)
 			}
 			// Append the event to the accumulator list
 			events[original.Name] = &tmplEvent{Original: original, Normalized: normalized}
 		}
+		for _, input := range evmABI.Constructor.Inputs {
+			bindStructType(input.Type, structs)
+		}
+		// Find the libraries the contract needs to be linked against
+		linked := make(map[string]string)
+		for pattern, name := range libs {
+			if name = capitalise(name); name != capitalise(types[i]) && bound[name] && strings.Contains(bytecodes[i], pattern) {
+				linked[pattern] = name
+			}
+		}
 		contracts[types[i]] = &tmplContract{
 			Type:        capitalise(types[i]),
 			InputABI:    strings.Replace(strippedABI, "\"", "\\\"", -1),
@@ -125,19 +167,31 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 			Calls:       calls,
 			Transacts:   transacts,
 			Events:      events,
+			Libraries:   linked,
+		}
+	}
+	// Tuples can only cross the mobile wrappers alone or in one dimensional arrays
+	if lang == LangJava {
+		for _, contract := range contracts {
+			if err := checkJavaTuples(contract); err != nil {
+				return "", err
+			}
 		}
 	}
 	// Generate the contract template data content and render it
 	data := &tmplData{
 		Package:   pkg,
 		Contracts: contracts,
+		Structs:   structs,
 	}
 	buffer := new(bytes.Buffer)
 
 	funcs := map[string]interface{}{
-		"bindtype":      bindType[lang],
-		"bindtopictype": bindTopicType[lang],
+		"bindtype":      func(kind abi.Type) string { return bindType[lang](kind, structs) },
+		"bindtopictype": func(kind abi.Type) string { return bindTopicType[lang](kind, structs) },
 		"namedtype":     namedType[lang],
+		"setter":        func(kind abi.Type, iface, value string) string { return setterJava(kind, structs, iface, value) },
+		"getter":        func(kind abi.Type, iface string) string { return getterJava(kind, structs, iface) },
 		"capitalise":    capitalise,
 		"decapitalise":  decapitalise,
 	}
@@ -157,9 +211,62 @@ func Bind(types []string, abis []string, bytecodes []string, pkg string, lang La
 	return buffer.String(), nil
 }
 
+// sortedMethods returns the names of the methods in alphabetical order, so that
+// generated struct names are deterministic.
+func sortedMethods(methods map[string]abi.Method) []string {
+	names := make([]string, 0, len(methods))
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedEvents returns the names of the events in alphabetical order, so that
+// generated struct names are deterministic.
+func sortedEvents(events map[string]abi.Event) []string {
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// bindStructType collects the tuple types used by kind, nested ones included,
+// naming each struct to be generated after its Solidity name if known, or by
+// its index otherwise.
+func bindStructType(kind abi.Type, structs map[string]*tmplStruct) {
+	switch kind.T {
+	case abi.ArrayTy, abi.SliceTy:
+		bindStructType(*kind.Elem, structs)
+
+	case abi.TupleTy:
+		id := structID(kind)
+		if _, exist := structs[id]; exist {
+			return
+		}
+		fields := make([]*tmplField, len(kind.TupleElems))
+		for i, elem := range kind.TupleElems {
+			bindStructType(*elem, structs)
+			fields[i] = &tmplField{Name: abi.ToCamelCase(kind.TupleRawNames[i]), Type: *elem}
+		}
+		name := kind.TupleRawName
+		if name == "" {
+			name = fmt.Sprintf("Struct%d", len(structs))
+		}
+		structs[id] = &tmplStruct{Name: name, Fields: fields}
+	}
+}
+
+// structID returns the key identifying a tuple type among the generated structs.
+func structID(kind abi.Type) string {
+	return kind.TupleRawName + kind.String()
+}
+
 // bindType is a set of type binders that convert Solidity types to some supported
 // programming language types.
-var bindType = map[Lang]func(kind abi.Type) string{
+var bindType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTypeGo,
 	LangJava: bindTypeJava,
 }
@@ -184,29 +291,25 @@ func wrapArray(stringKind string, innerLen int, innerMapping string) (string, []
 	return innerMapping, parts
 }
 
-// Translates the array sizes to a Go-lang declaration of a (nested) array of the inner type.
-// Simply returns the inner type if arraySizes is empty.
-func arrayBindingGo(inner string, arraySizes []string) string {
-	out := ""
-	//prepend all array sizes, from outer (end arraySizes) to inner (start arraySizes)
-	for i := len(arraySizes) - 1; i >= 0; i-- {
-		out += "[" + arraySizes[i] + "]"
-	}
-	out += inner
-	return out
-}
-
 // bindTypeGo converts a Solidity type to a Go one. Since there is no clear mapping
 // from all Solidity types to Go ones (e.g. uint17), those that cannot be exactly
-// mapped will use an upscaled type (e.g. *big.Int).
-func bindTypeGo(kind abi.Type) string {
-	stringKind := kind.String()
-	innerLen, innerMapping := bindUnnestedTypeGo(stringKind)
-	return arrayBindingGo(wrapArray(stringKind, innerLen, innerMapping))
+// mapped will use an upscaled type (e.g. *big.Int). Tuples are mapped to their
+// generated structs.
+func bindTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	switch kind.T {
+	case abi.TupleTy:
+		return structs[structID(kind)].Name
+	case abi.ArrayTy:
+		return fmt.Sprintf("[%d]", kind.Size) + bindTypeGo(*kind.Elem, structs)
+	case abi.SliceTy:
+		return "[]" + bindTypeGo(*kind.Elem, structs)
+	}
+	_, mapped := bindUnnestedTypeGo(kind.String())
+	return mapped
 }
 
 // The inner function of bindTypeGo, this finds the inner type of stringKind.
-// (Or just the type itself if it is not an array or slice)
+// (Arrays and slices are unwrapped by bindTypeGo itself)
 // The length of the matched part is returned, with the translated type.
 func bindUnnestedTypeGo(stringKind string) (int, string) {
 
@@ -247,7 +350,13 @@ func arrayBindingJava(inner string, arraySizes []string) string {
 // bindTypeJava converts a Solidity type to a Java one. Since there is no clear mapping
 // from all Solidity types to Java ones (e.g. uint17), those that cannot be exactly
 // mapped will use an upscaled type (e.g. BigDecimal).
-func bindTypeJava(kind abi.Type) string {
+func bindTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
+	switch {
+	case kind.T == abi.TupleTy:
+		return structs[structID(kind)].Name
+	case (kind.T == abi.ArrayTy || kind.T == abi.SliceTy) && kind.Elem.T == abi.TupleTy:
+		return structs[structID(*kind.Elem)].Name + "[]"
+	}
 	stringKind := kind.String()
 	innerLen, innerMapping := bindUnnestedTypeJava(stringKind)
 	return arrayBindingJava(wrapArray(stringKind, innerLen, innerMapping))
@@ -310,16 +419,16 @@ func bindUnnestedTypeJava(stringKind string) (int, string) {
 
 // bindTopicType is a set of type binders that convert Solidity types to some
 // supported programming language topic types.
-var bindTopicType = map[Lang]func(kind abi.Type) string{
+var bindTopicType = map[Lang]func(kind abi.Type, structs map[string]*tmplStruct) string{
 	LangGo:   bindTopicTypeGo,
 	LangJava: bindTopicTypeJava,
 }
 
 // bindTypeGo converts a Solidity topic type to a Go one. It is almost the same
 // funcionality as for simple types, but dynamic types get converted to hashes.
-func bindTopicTypeGo(kind abi.Type) string {
-	bound := bindTypeGo(kind)
-	if bound == "string" || bound == "[]byte" {
+func bindTopicTypeGo(kind abi.Type, structs map[string]*tmplStruct) string {
+	bound := bindTypeGo(kind, structs)
+	if bound == "string" || bound == "[]byte" || kind.T == abi.TupleTy {
 		bound = "common.Hash"
 	}
 	return bound
@@ -327,8 +436,8 @@ func bindTopicTypeGo(kind abi.Type) string {
 
 // bindTypeGo converts a Solidity topic type to a Java one. It is almost the same
 // funcionality as for simple types, but dynamic types get converted to hashes.
-func bindTopicTypeJava(kind abi.Type) string {
-	bound := bindTypeJava(kind)
+func bindTopicTypeJava(kind abi.Type, structs map[string]*tmplStruct) string {
+	bound := bindTypeJava(kind, structs)
 	if bound == "String" || bound == "Bytes" {
 		bound = "Hash"
 	}
@@ -345,6 +454,12 @@ var namedType = map[Lang]func(string, abi.Type) string{
 // namedTypeJava converts some primitive data types to named variants that can
 // be used as parts of method names.
 func namedTypeJava(javaKind string, solKind abi.Type) string {
+	switch {
+	case solKind.T == abi.TupleTy:
+		return "Tuple"
+	case (solKind.T == abi.ArrayTy || solKind.T == abi.SliceTy) && solKind.Elem.T == abi.TupleTy:
+		return "Tuples"
+	}
 	switch javaKind {
 	case "byte[]":
 		return "Binary"
@@ -378,6 +493,70 @@ func namedTypeJava(javaKind string, solKind abi.Type) string {
 	}
 }
 
+// setterJava returns the Java statement storing value in the iface wrapper,
+// converting the generated struct classes to their wrapped tuples.
+func setterJava(kind abi.Type, structs map[string]*tmplStruct, iface, value string) string {
+	named := namedTypeJava(bindTypeJava(kind, structs), kind)
+	switch named {
+	case "Tuple":
+		value = value + ".toTuple()"
+	case "Tuples":
+		value = fmt.Sprintf("%s.toTuples(%s)", structs[structID(*kind.Elem)].Name, value)
+	}
+	return fmt.Sprintf("%s.set%s(%s)", iface, named, value)
+}
+
+// getterJava returns the Java expression retrieving the value from the iface
+// wrapper, converting wrapped tuples to the generated struct classes.
+func getterJava(kind abi.Type, structs map[string]*tmplStruct, iface string) string {
+	named := namedTypeJava(bindTypeJava(kind, structs), kind)
+	switch named {
+	case "Tuple":
+		return fmt.Sprintf("%s.fromTuple(%s.getTuple())", structs[structID(kind)].Name, iface)
+	case "Tuples":
+		return fmt.Sprintf("%s.fromTuples(%s.getTuples())", structs[structID(*kind.Elem)].Name, iface)
+	}
+	return fmt.Sprintf("%s.get%s()", iface, named)
+}
+
+// checkJavaTuples checks that the tuples used by the methods of a contract can
+// be passed through the mobile wrappers, which only support tuples on their
+// own or in one dimensional arrays.
+func checkJavaTuples(contract *tmplContract) error {
+	args := append(abi.Arguments{}, contract.Constructor.Inputs...)
+	for _, methods := range []map[string]*tmplMethod{contract.Calls, contract.Transacts} {
+		for _, method := range methods {
+			args = append(args, method.Original.Inputs...)
+			args = append(args, method.Original.Outputs...)
+		}
+	}
+	for _, arg := range args {
+		if nestedTupleArray(arg.Type, 0) {
+			return fmt.Errorf("multi dimensional tuple arrays are not supported by Java bindings: %s %s", arg.Type, arg.Name)
+		}
+	}
+	return nil
+}
+
+// nestedTupleArray reports whether kind contains a tuple nested in more than one
+// array dimension, having already been nested in depth of them.
+func nestedTupleArray(kind abi.Type, depth int) bool {
+	switch kind.T {
+	case abi.ArrayTy, abi.SliceTy:
+		return nestedTupleArray(*kind.Elem, depth+1)
+	case abi.TupleTy:
+		if depth > 1 {
+			return true
+		}
+		for _, elem := range kind.TupleElems {
+			if nestedTupleArray(*elem, 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // methodNormalizer is a name transformer that modifies Solidity method names to
 // conform to target language naming concentions.
 var methodNormalizer = map[Lang]func(string) string{
@@ -22,6 +22,7 @@ import "github.com/ethereum/go-ethereum/accounts/abi"
 type tmplData struct {
 	Package   string                   // Name of the package to place the generated file in
 	Contracts map[string]*tmplContract // List of contracts to generate into this file
+	Structs   map[string]*tmplStruct   // Structs of the tuple types used by the contracts
 }
 
 // tmplContract contains the data needed to generate an individual contract binding.
@@ -33,6 +34,7 @@ type tmplContract struct {
 	Calls       map[string]*tmplMethod // Contract calls that only read state data
 	Transacts   map[string]*tmplMethod // Contract calls that write state data
 	Events      map[string]*tmplEvent  // Contract events accessors
+	Libraries   map[string]string      // Bytecode placeholders of the libraries to link, mapped to their types
 }
 
 // tmplMethod is a wrapper around an abi.Method that contains a few preprocessed
@@ -49,6 +51,19 @@ type tmplEvent struct {
 	Normalized abi.Event // Normalized version of the parsed fields
 }
 
+// tmplField is a wrapper around a struct field with the binding language type
+// and the original Solidity type.
+type tmplField struct {
+	Name string   // Field name of the struct
+	Type abi.Type // Solidity type of the field, converted by the templates
+}
+
+// tmplStruct is a wrapper around a tuple type, generated as a struct.
+type tmplStruct struct {
+	Name   string       // Name of the generated struct
+	Fields []*tmplField // Struct fields definition, depends on the binding language
+}
+
 // tmplSource is language to template mapping containing all the supported
 // programming languages the package can generate to.
 var tmplSource = map[Lang]string{
@@ -64,6 +79,14 @@ const tmplSourceGo = `
 
 package {{.Package}}
 
+{{range .Structs}}
+	// {{.Name}} is an auto generated Go binding around a Solidity struct.
+	type {{.Name}} struct {
+	{{range .Fields}}{{.Name}} {{bindtype .Type}}
+	{{end}}
+	}
+{{end}}
+
 {{range $contract := .Contracts}}
 	// {{.Type}}ABI is the input ABI used to generate the binding from.
 	const {{.Type}}ABI = "{{.InputABI}}"
@@ -78,7 +101,18 @@ package {{.Package}}
 		  if err != nil {
 		    return common.Address{}, nil, nil, err
 		  }
-		  address, tx, contract, err := bind.DeployContract(auth, parsed, common.FromHex({{.Type}}Bin), backend {{range .Constructor.Inputs}}, {{.Name}}{{end}})
+		  {{if .Libraries}}
+		  // Link the contract to its libraries by deploying them first
+		  bin := {{.Type}}Bin
+		  {{range $pattern, $name := .Libraries}}
+		  {{decapitalise $name}}Addr, _, _, err := Deploy{{$name}}(auth, backend)
+		  if err != nil {
+		    return common.Address{}, nil, nil, err
+		  }
+		  bin = strings.Replace(bin, "{{$pattern}}", {{decapitalise $name}}Addr.Hex()[2:], -1)
+		  {{end}}
+		  {{end}}
+		  address, tx, contract, err := bind.DeployContract(auth, parsed, common.FromHex({{if .Libraries}}bin{{else}}{{.Type}}Bin{{end}}), backend {{range .Constructor.Inputs}}, {{.Name}}{{end}})
 		  if err != nil {
 		    return common.Address{}, nil, nil, err
 		  }
@@ -437,15 +471,19 @@ import org.ethereum.geth.internal.*;
 
 		{{if .InputBin}}
 			// BYTECODE is the compiled bytecode used for deploying new contracts.
-			public final static byte[] BYTECODE = "{{.InputBin}}".getBytes();
+			public final static String BYTECODE = "{{.InputBin}}";
 
 			// deploy deploys a new Ethereum contract, binding an instance of {{.Type}} to it.
 			public static {{.Type}} deploy(TransactOpts auth, EthereumClient client{{range .Constructor.Inputs}}, {{bindtype .Type}} {{.Name}}{{end}}) throws Exception {
 				Interfaces args = Geth.newInterfaces({{(len .Constructor.Inputs)}});
 				{{range $index, $element := .Constructor.Inputs}}
-				  args.set({{$index}}, Geth.newInterface()); args.get({{$index}}).set{{namedtype (bindtype .Type) .Type}}({{.Name}});
+				  args.set({{$index}}, Geth.newInterface()); {{setter .Type (printf "args.get(%d)" $index) .Name}};
 				{{end}}
-				return new {{.Type}}(Geth.deployContract(auth, ABI, BYTECODE, client, args));
+				String bytecode = BYTECODE;
+				{{range $pattern, $name := .Libraries}}
+				  bytecode = bytecode.replace("{{$pattern}}", {{$name}}.deploy(auth, client).Address.getHex().substring(2));
+				{{end}}
+				return new {{.Type}}(Geth.deployContract(auth, ABI, Geth.decodeFromHex(bytecode), client, args));
 			}
 
 			// Internal constructor used by contract deployment.
@@ -470,6 +508,48 @@ import org.ethereum.geth.internal.*;
 			this(Geth.bindContract(address, ABI, client));
 		}
 
+		{{range $.Structs}}
+			// {{.Name}} is an auto generated Java binding of a Solidity tuple.
+			public static class {{.Name}} {
+				{{range .Fields}}public {{bindtype .Type}} {{.Name}};
+				{{end}}
+
+				// toTuple wraps the struct to be passed to the contract.
+				public Tuple toTuple() throws Exception {
+					Tuple tuple = Geth.newTuple();
+					{{range $index, $field := .Fields}}Interface field{{$index}} = Geth.newInterface(); {{setter .Type (printf "field%d" $index) (printf "this.%s" .Name)}}; tuple.add("{{.Name}}", field{{$index}});
+					{{end}}
+					return tuple;
+				}
+
+				// toTuples wraps an array of structs to be passed to the contract.
+				public static Tuples toTuples({{.Name}}[] values) throws Exception {
+					Tuples tuples = Geth.newTuples(values.length);
+					for (int i = 0; i < values.length; i++) {
+						tuples.set(i, values[i].toTuple());
+					}
+					return tuples;
+				}
+
+				// fromTuple unwraps a tuple returned by the contract.
+				public static {{.Name}} fromTuple(Tuple tuple) throws Exception {
+					{{.Name}} value = new {{.Name}}();
+					{{range $index, $field := .Fields}}value.{{.Name}} = {{getter .Type (printf "tuple.get(%d)" $index)}};
+					{{end}}
+					return value;
+				}
+
+				// fromTuples unwraps an array of tuples returned by the contract.
+				public static {{.Name}}[] fromTuples(Tuples tuples) throws Exception {
+					{{.Name}}[] values = new {{.Name}}[(int)tuples.size()];
+					for (int i = 0; i < values.length; i++) {
+						values[i] = fromTuple(tuples.get(i));
+					}
+					return values;
+				}
+			}
+		{{end}}
+
 		{{range .Calls}}
 			{{if gt (len .Normalized.Outputs) 1}}
 			// {{capitalise .Normalized.Name}}Results is the output of a call to {{.Normalized.Name}}.
@@ -484,7 +564,7 @@ import org.ethereum.geth.internal.*;
 			// Solidity: {{.Original.String}}
 			public {{if gt (len .Normalized.Outputs) 1}}{{capitalise .Normalized.Name}}Results{{else}}{{range .Normalized.Outputs}}{{bindtype .Type}}{{end}}{{end}} {{.Normalized.Name}}(CallOpts opts{{range .Normalized.Inputs}}, {{bindtype .Type}} {{.Name}}{{end}}) throws Exception {
 				Interfaces args = Geth.newInterfaces({{(len .Normalized.Inputs)}});
-				{{range $index, $item := .Normalized.Inputs}}args.set({{$index}}, Geth.newInterface()); args.get({{$index}}).set{{namedtype (bindtype .Type) .Type}}({{.Name}});
+				{{range $index, $item := .Normalized.Inputs}}args.set({{$index}}, Geth.newInterface()); {{setter .Type (printf "args.get(%d)" $index) .Name}};
 				{{end}}
 
 				Interfaces results = Geth.newInterfaces({{(len .Normalized.Outputs)}});
@@ -497,10 +577,10 @@ import org.ethereum.geth.internal.*;
 				this.Contract.call(opts, results, "{{.Original.Name}}", args);
 				{{if gt (len .Normalized.Outputs) 1}}
 					{{capitalise .Normalized.Name}}Results result = new {{capitalise .Normalized.Name}}Results();
-					{{range $index, $item := .Normalized.Outputs}}result.{{if ne .Name ""}}{{.Name}}{{else}}Return{{$index}}{{end}} = results.get({{$index}}).get{{namedtype (bindtype .Type) .Type}}();
+					{{range $index, $item := .Normalized.Outputs}}result.{{if ne .Name ""}}{{.Name}}{{else}}Return{{$index}}{{end}} = {{getter .Type (printf "results.get(%d)" $index)}};
 					{{end}}
 					return result;
-				{{else}}{{range .Normalized.Outputs}}return results.get(0).get{{namedtype (bindtype .Type) .Type}}();{{end}}
+				{{else}}{{range .Normalized.Outputs}}return {{getter .Type "results.get(0)"}};{{end}}
 				{{end}}
 			}
 		{{end}}
@@ -511,7 +591,7 @@ import org.ethereum.geth.internal.*;
 			// Solidity: {{.Original.String}}
 			public Transaction {{.Normalized.Name}}(TransactOpts opts{{range .Normalized.Inputs}}, {{bindtype .Type}} {{.Name}}{{end}}) throws Exception {
 				Interfaces args = Geth.newInterfaces({{(len .Normalized.Inputs)}});
-				{{range $index, $item := .Normalized.Inputs}}args.set({{$index}}, Geth.newInterface()); args.get({{$index}}).set{{namedtype (bindtype .Type) .Type}}({{.Name}});
+				{{range $index, $item := .Normalized.Inputs}}args.set({{$index}}, Geth.newInterface()); {{setter .Type (printf "args.get(%d)" $index) .Name}};
 				{{end}}
 
 				return this.Contract.transact(opts, "{{.Original.Name}}"	, args);
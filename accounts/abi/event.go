@@ -27,8 +27,11 @@ import (
 // Event is an event potentially triggered by the EVM's LOG mechanism. The Event
 // holds type information (inputs) about the yielded output. Anonymous events
 // don't get the signature canonical representation as the first LOG topic.
+//
+// Like methods, overloaded events get unique Names sharing the same RawName.
 type Event struct {
 	Name      string
+	RawName   string // Raw event name as defined in the contract, used in the signature
 	Anonymous bool
 	Inputs    Arguments
 }
@@ -41,7 +44,7 @@ func (e Event) String() string {
 			inputs[i] = fmt.Sprintf("%v indexed %v", input.Name, input.Type)
 		}
 	}
-	return fmt.Sprintf("e %v(%v)", e.Name, strings.Join(inputs, ", "))
+	return fmt.Sprintf("e %v(%v)", e.RawName, strings.Join(inputs, ", "))
 }
 
 // Id returns the canonical representation of the event's signature used by the
@@ -53,5 +56,5 @@ func (e Event) Id() common.Hash {
 		types[i] = input.Type.String()
 		i++
 	}
-	return common.BytesToHash(crypto.Keccak256([]byte(fmt.Sprintf("%v(%v)", e.Name, strings.Join(types, ",")))))
+	return common.BytesToHash(crypto.Keccak256([]byte(fmt.Sprintf("%v(%v)", e.RawName, strings.Join(types, ",")))))
 }
@@ -31,8 +31,12 @@ import (
 // network. A method such as `Transact` does require a Tx and thus will
 // be flagged `true`.
 // Input specifies the required input parameters for this gives method.
+//
+// Overloaded methods share the RawName from the contract source but get unique
+// Names, the later ones suffixed with an index (e.g. foo, foo0, foo1).
 type Method struct {
 	Name    string
+	RawName string // Raw method name as defined in the contract, used in the signature
 	Const   bool
 	Inputs  Arguments
 	Outputs Arguments
@@ -50,7 +54,7 @@ func (method Method) Sig() string {
 	for i, input := range method.Inputs {
 		types[i] = input.Type.String()
 	}
-	return fmt.Sprintf("%v(%v)", method.Name, strings.Join(types, ","))
+	return fmt.Sprintf("%v(%v)", method.RawName, strings.Join(types, ","))
 }
 
 func (method Method) String() string {
@@ -69,7 +73,7 @@ func (method Method) String() string {
 	if method.Const {
 		constant = "constant "
 	}
-	return fmt.Sprintf("function %v(%v) %sreturns(%v)", method.Name, strings.Join(inputs, ", "), constant, strings.Join(outputs, ", "))
+	return fmt.Sprintf("function %v(%v) %sreturns(%v)", method.RawName, strings.Join(inputs, ", "), constant, strings.Join(outputs, ", "))
 }
 
 func (method Method) Id() []byte {
@@ -115,17 +115,6 @@ func readFixedBytes(t Type, word []byte) (interface{}, error) {
 
 }
 
-func getFullElemSize(elem *Type) int {
-	//all other should be counted as 32 (slices have pointers to respective elements)
-	size := 32
-	//arrays wrap it, each element being the same size
-	for elem.T == ArrayTy {
-		size *= elem.Size
-		elem = elem.Elem
-	}
-	return size
-}
-
 // iteratively unpack elements
 func forEachUnpack(t Type, output []byte, start, size int) (interface{}, error) {
 	if size < 0 {
@@ -148,12 +137,9 @@ func forEachUnpack(t Type, output []byte, start, size int) (interface{}, error)
 		return nil, fmt.Errorf("abi: invalid type in array/slice unpacking stage")
 	}
 
-	// Arrays have packed elements, resulting in longer unpack steps.
-	// Slices have just 32 bytes per element (pointing to the contents).
-	elemSize := 32
-	if t.T == ArrayTy {
-		elemSize = getFullElemSize(t.Elem)
-	}
+	// Static arrays and tuples are packed in place, resulting in longer unpack
+	// steps. Everything else has just 32 bytes per element.
+	elemSize := getTypeSize(*t.Elem)
 
 	for i, j := start, 0; j < size; i, j = i+elemSize, j+1 {
 
@@ -192,12 +178,29 @@ func toGoType(index int, t Type, output []byte) (interface{}, error) {
 	} else {
 		returnOutput = output[index : index+32]
 	}
-
+	// Offsets within dynamic composites are relative to their own start, so
+	// unpack them from a sub-slice beginning there.
 	switch t.T {
 	case SliceTy:
-		return forEachUnpack(t, output, begin, end)
+		return forEachUnpack(t, output[begin:], 0, end)
 	case ArrayTy:
+		if isDynamicType(*t.Elem) {
+			offset, err := tuplePointsTo(index, output)
+			if err != nil {
+				return nil, err
+			}
+			return forEachUnpack(t, output[offset:], 0, t.Size)
+		}
 		return forEachUnpack(t, output, index, t.Size)
+	case TupleTy:
+		if isDynamicType(t) {
+			offset, err := tuplePointsTo(index, output)
+			if err != nil {
+				return nil, err
+			}
+			return forTupleUnpack(t, output[offset:])
+		}
+		return forTupleUnpack(t, output[index:])
 	case StringTy: // variable arrays are written at the end of the return bytes
 		return string(output[begin : begin+end]), nil
 	case IntTy, UintTy:
@@ -219,6 +222,32 @@ func toGoType(index int, t Type, output []byte) (interface{}, error) {
 	}
 }
 
+// forTupleUnpack unpacks the fields of a tuple encoded at the start of output
+// into a value of its dynamically created struct type.
+func forTupleUnpack(t Type, output []byte) (interface{}, error) {
+	retval := reflect.New(t.Type).Elem()
+	offset := 0
+	for i, elem := range t.TupleElems {
+		marshalledValue, err := toGoType(offset, *elem, output)
+		if err != nil {
+			return nil, err
+		}
+		retval.Field(i).Set(reflect.ValueOf(marshalledValue))
+		offset += getTypeSize(*elem)
+	}
+	return retval.Interface(), nil
+}
+
+// tuplePointsTo interprets a 32 byte slice as the offset of a dynamic composite
+// (tuple or array), which unlike slices have no length prefix.
+func tuplePointsTo(index int, output []byte) (int, error) {
+	offset := new(big.Int).SetBytes(output[index : index+32])
+	if offset.Cmp(big.NewInt(int64(len(output)))) > 0 {
+		return 0, fmt.Errorf("abi: cannot marshal in to go composite: offset %v would go over slice boundary (len=%v)", offset, len(output))
+	}
+	return int(offset.Uint64()), nil
+}
+
 // interprets a 32 byte slice as an offset and then determines which indice to look to decode the type.
 func lengthPrefixPointsTo(index int, output []byte) (start int, length int, err error) {
 	bigOffsetEnd := big.NewInt(0).SetBytes(output[index : index+32])
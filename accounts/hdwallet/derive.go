@@ -0,0 +1,112 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// errSeedLength is returned if a seed is shorter or longer than BIP-32
+	// allows.
+	errSeedLength = errors.New("seed must be 128-512 bits")
+
+	// errInvalidKey is returned in the astronomically unlikely case that a
+	// derived key is not a valid secp256k1 private key. BIP-32 requires such
+	// keys to be skipped.
+	errInvalidKey = errors.New("derived key invalid, use the next index")
+)
+
+// hardenedOffset is the first index of hardened child keys.
+const hardenedOffset = 0x80000000
+
+// extendedKey is a BIP-32 extended private key.
+type extendedKey struct {
+	key   []byte // 32 byte private key
+	chain []byte // 32 byte chain code
+}
+
+// newMasterKey derives the BIP-32 master key of the seed.
+func newMasterKey(seed []byte) (*extendedKey, error) {
+	if len(seed) < 16 || len(seed) > 64 {
+		return nil, errSeedLength
+	}
+	mac := hmac.New(sha512.New, []byte("Bitcoin seed"))
+	mac.Write(seed)
+	sum := mac.Sum(nil)
+
+	if k := new(big.Int).SetBytes(sum[:32]); k.Sign() == 0 || k.Cmp(crypto.S256().Params().N) >= 0 {
+		return nil, errInvalidKey
+	}
+	return &extendedKey{key: sum[:32], chain: sum[32:]}, nil
+}
+
+// child derives the child private key at the given index.
+func (k *extendedKey) child(index uint32) (*extendedKey, error) {
+	mac := hmac.New(sha512.New, k.chain)
+	if index >= hardenedOffset {
+		mac.Write([]byte{0x00})
+		mac.Write(k.key)
+	} else {
+		priv, err := crypto.ToECDSA(k.key)
+		if err != nil {
+			return nil, err
+		}
+		mac.Write(crypto.CompressPubkey(&priv.PublicKey))
+	}
+	var enc [4]byte
+	binary.BigEndian.PutUint32(enc[:], index)
+	mac.Write(enc[:])
+	sum := mac.Sum(nil)
+
+	// The child key is the parent key tweaked by the left half of the hash
+	n := crypto.S256().Params().N
+
+	tweak := new(big.Int).SetBytes(sum[:32])
+	if tweak.Cmp(n) >= 0 {
+		return nil, errInvalidKey
+	}
+	key := tweak.Add(tweak, new(big.Int).SetBytes(k.key))
+	key.Mod(key, n)
+	if key.Sign() == 0 {
+		return nil, errInvalidKey
+	}
+	return &extendedKey{key: math.PaddedBigBytes(key, 32), chain: sum[32:]}, nil
+}
+
+// DeriveKey derives the private key at the BIP-32 derivation path from the seed.
+func DeriveKey(seed []byte, path accounts.DerivationPath) (*ecdsa.PrivateKey, error) {
+	key, err := newMasterKey(seed)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range path {
+		if key, err = key.child(index); err != nil {
+			return nil, err
+		}
+	}
+	return crypto.ToECDSA(key.key)
+}
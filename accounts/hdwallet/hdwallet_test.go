@@ -0,0 +1,282 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+// Tests mnemonic encoding and seed generation against the BIP-39 test vectors.
+func TestMnemonicVectors(t *testing.T) {
+	tests := []struct {
+		entropy  string
+		mnemonic string
+		seed     string
+	}{
+		{
+			"00000000000000000000000000000000",
+			testMnemonic,
+			"c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04",
+		},
+		{
+			"7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f7f",
+			"legal winner thank year wave sausage worth useful legal winner thank yellow",
+			"2e8905819b8723fe2c1d161860e5ee1830318dbf49a83bd451cfb8440c28bd6fa457fe1296106559a3c80937a1c1069be3a3a5bd381ee6260e8d9739fce1f607",
+		},
+		{
+			"ffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff",
+			"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo vote",
+			"dd48c104698c30cfe2b6142103248622fb7bb0ff692eebb00089b32d22484e1613912f0a5b694407be899ffd31ed3992c456cdf60f5d4564b8ba3f05a69890ad",
+		},
+	}
+	for i, tt := range tests {
+		entropy, _ := hex.DecodeString(tt.entropy)
+		mnemonic, err := EntropyToMnemonic(entropy)
+		if err != nil {
+			t.Fatalf("test %d: failed to encode mnemonic: %v", i, err)
+		}
+		if mnemonic != tt.mnemonic {
+			t.Errorf("test %d: mnemonic mismatch: have %q, want %q", i, mnemonic, tt.mnemonic)
+		}
+		if decoded, err := mnemonicToEntropy(mnemonic); err != nil || hex.EncodeToString(decoded) != tt.entropy {
+			t.Errorf("test %d: entropy mismatch: have %x (%v), want %s", i, decoded, err, tt.entropy)
+		}
+		seed, err := NewSeed(mnemonic, "TREZOR")
+		if err != nil {
+			t.Fatalf("test %d: failed to create seed: %v", i, err)
+		}
+		if hex.EncodeToString(seed) != tt.seed {
+			t.Errorf("test %d: seed mismatch: have %x, want %s", i, seed, tt.seed)
+		}
+	}
+}
+
+// Tests that malformed mnemonics are rejected.
+func TestInvalidMnemonics(t *testing.T) {
+	tests := []string{
+		"legal winner thank year wave sausage worth useful legal winner thank yellow yellow",
+		"letter advice cage absurd amount doctor acoustic avoid letter advice caged above",
+		"zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo voted",
+		"abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+		"dignity pass list indicate nasty",
+	}
+	for i, mnemonic := range tests {
+		if err := ValidateMnemonic(mnemonic); err == nil {
+			t.Errorf("test %d: invalid mnemonic accepted", i)
+		}
+	}
+	for _, bits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := NewMnemonic(bits)
+		if err != nil {
+			t.Fatalf("failed to generate %d bit mnemonic: %v", bits, err)
+		}
+		if err := ValidateMnemonic(mnemonic); err != nil {
+			t.Errorf("generated %d bit mnemonic invalid: %v", bits, err)
+		}
+	}
+	if _, err := NewMnemonic(100); err != errEntropyLength {
+		t.Errorf("invalid entropy size error mismatch: have %v, want %v", err, errEntropyLength)
+	}
+}
+
+// Tests key derivation against the BIP-32 test vectors and the well known
+// Ethereum account of the test mnemonic.
+func TestDeriveVectors(t *testing.T) {
+	seed, _ := hex.DecodeString("000102030405060708090a0b0c0d0e0f")
+	tests := []struct {
+		path string
+		key  string
+	}{
+		{"m/0'", "edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0'/1/2'", "cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+	}
+	for _, tt := range tests {
+		path, _ := accounts.ParseDerivationPath(tt.path)
+		key, err := DeriveKey(seed, path)
+		if err != nil {
+			t.Fatalf("%s: failed to derive key: %v", tt.path, err)
+		}
+		if have := hex.EncodeToString(crypto.FromECDSA(key)); have != tt.key {
+			t.Errorf("%s: key mismatch: have %s, want %s", tt.path, have, tt.key)
+		}
+	}
+	seed, _ = NewSeed(testMnemonic, "")
+	address, err := deriveAddress(seed, accounts.DefaultBaseDerivationPath)
+	if err != nil {
+		t.Fatalf("failed to derive address: %v", err)
+	}
+	if want := common.HexToAddress("0x9858EfFD232B4033E47d90003D41EC34EcaEda94"); address != want {
+		t.Errorf("address mismatch: have %x, want %x", address, want)
+	}
+}
+
+// Tests importing a seed, unlocking its wallet and pinning accounts.
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdwallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := store.Import(testMnemonic, "", "password")
+	if err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	if _, err := store.Import(testMnemonic, "", "password"); err != ErrSeedExists {
+		t.Errorf("duplicate import error mismatch: have %v, want %v", err, ErrSeedExists)
+	}
+	wallets := store.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("wallet count mismatch: have %d, want 1", len(wallets))
+	}
+	wallet := wallets[0]
+
+	// Pinned accounts are listed while locked, but can't sign
+	if accs := wallet.Accounts(); len(accs) != 1 || accs[0] != account {
+		t.Fatalf("accounts mismatch: have %v, want %v", accs, account)
+	}
+	hash := crypto.Keccak256([]byte("hello"))
+	if _, err := wallet.SignHash(account, hash); err != keystore.ErrLocked {
+		t.Errorf("locked signing error mismatch: have %v, want %v", err, keystore.ErrLocked)
+	}
+	if _, err := wallet.SignHashWithPassphrase(account, "password", hash); err != nil {
+		t.Errorf("failed to sign with passphrase: %v", err)
+	}
+	if err := wallet.Open("wrong"); err != keystore.ErrDecrypt {
+		t.Fatalf("wrong password error mismatch: have %v, want %v", err, keystore.ErrDecrypt)
+	}
+	if err := wallet.Open("password"); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	// Sign a transaction and pin a second account
+	tx := types.NewTransaction(0, common.HexToAddress("0xb0b"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	signed, err := wallet.SignTx(account, tx, big.NewInt(1))
+	if err != nil {
+		t.Fatalf("failed to sign transaction: %v", err)
+	}
+	if sender, err := types.Sender(types.NewEIP155Signer(big.NewInt(1)), signed); err != nil || sender != account.Address {
+		t.Errorf("transaction signer mismatch: have %x (%v), want %x", sender, err, account.Address)
+	}
+	path, _ := accounts.ParseDerivationPath("m/44'/60'/0'/0/5")
+	second, err := wallet.Derive(path, true)
+	if err != nil {
+		t.Fatalf("failed to derive account: %v", err)
+	}
+	if _, err := wallet.SignHash(second, hash); err != nil {
+		t.Errorf("failed to sign with pinned account: %v", err)
+	}
+	// Pinned accounts must survive a restart
+	reloaded := NewStore(dir, keystore.LightScryptN, keystore.LightScryptP).Wallets()
+	if len(reloaded) != 1 {
+		t.Fatalf("reloaded wallet count mismatch: have %d, want 1", len(reloaded))
+	}
+	if accs := reloaded[0].Accounts(); len(accs) != 2 || accs[1] != second {
+		t.Errorf("reloaded accounts mismatch: have %v, want %v", accs, []accounts.Account{account, second})
+	}
+}
+
+// testChain is a chain state reader with funds on a set of accounts.
+type testChain struct {
+	ethereum.ChainStateReader
+	funded map[common.Address]bool
+}
+
+func (c *testChain) BalanceAt(ctx context.Context, account common.Address, number *big.Int) (*big.Int, error) {
+	if c.funded[account] {
+		return big.NewInt(1), nil
+	}
+	return new(big.Int), nil
+}
+
+func (c *testChain) NonceAt(ctx context.Context, account common.Address, number *big.Int) (uint64, error) {
+	return 0, nil
+}
+
+// Tests that used accounts are discovered by self-derivation, along with the
+// first unused one.
+func TestSelfDerive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hdwallet-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store := NewStore(dir, keystore.LightScryptN, keystore.LightScryptP)
+	if _, err := store.Import(testMnemonic, "", ""); err != nil {
+		t.Fatalf("failed to import mnemonic: %v", err)
+	}
+	wallet := store.Wallets()[0]
+	if err := wallet.Open(""); err != nil {
+		t.Fatalf("failed to open wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	// Fund the first three accounts along the default path
+	seed, _ := NewSeed(testMnemonic, "")
+	chain := &testChain{funded: make(map[common.Address]bool)}
+
+	var expected []common.Address
+	for i := 0; i < 4; i++ {
+		path := append(accounts.DerivationPath{}, accounts.DefaultBaseDerivationPath...)
+		path[len(path)-1] += uint32(i)
+		address, _ := deriveAddress(seed, path)
+		if i < 3 {
+			chain.funded[address] = true
+		}
+		expected = append(expected, address)
+	}
+	wallet.SelfDerive(accounts.DefaultBaseDerivationPath, chain)
+
+	var accs []accounts.Account
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if accs = wallet.Accounts(); len(accs) == len(expected) {
+			break
+		}
+	}
+	if len(accs) != len(expected) {
+		t.Fatalf("account count mismatch: have %d, want %d", len(accs), len(expected))
+	}
+	for i, acc := range accs {
+		if acc.Address != expected[i] {
+			t.Errorf("account %d mismatch: have %x, want %x", i, acc.Address, expected[i])
+		}
+	}
+	// Closing drops the self-derived accounts, keeping the pinned one
+	wallet.Close()
+	if accs := wallet.Accounts(); len(accs) != 1 || accs[0].Address != expected[0] {
+		t.Errorf("accounts after close mismatch: have %v", accs)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common/math"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// errEntropyLength is returned if a mnemonic is requested for an entropy
+	// size not allowed by BIP-39.
+	errEntropyLength = errors.New("entropy must be 128-256 bits, in multiples of 32")
+
+	// errMnemonicLength is returned if a mnemonic doesn't have 12, 15, 18, 21
+	// or 24 words.
+	errMnemonicLength = errors.New("mnemonic must have 12-24 words, in multiples of 3")
+
+	// errMnemonicChecksum is returned if the checksum of a mnemonic doesn't
+	// match its words, indicating a typo.
+	errMnemonicChecksum = errors.New("mnemonic checksum mismatch")
+)
+
+// wordIndex maps the words of the wordlist to their values.
+var wordIndex = make(map[string]int, len(wordlist))
+
+func init() {
+	for i, word := range wordlist {
+		wordIndex[word] = i
+	}
+}
+
+// NewMnemonic generates a random BIP-39 mnemonic with the given bits of entropy,
+// between 128 (12 words) and 256 (24 words).
+func NewMnemonic(bits int) (string, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", errEntropyLength
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", err
+	}
+	return EntropyToMnemonic(entropy)
+}
+
+// EntropyToMnemonic encodes the entropy into a BIP-39 mnemonic, appending its
+// checksum.
+func EntropyToMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", errEntropyLength
+	}
+	// Append the leading bits of the entropy hash as checksum
+	checksum := sha256.Sum256(entropy)
+	size := uint(bits / 32)
+
+	data := new(big.Int).SetBytes(entropy)
+	data.Lsh(data, size)
+	data.Or(data, big.NewInt(int64(checksum[0]>>(8-size))))
+
+	// Split the result into 11 bit word indices
+	words := make([]string, (bits+int(size))/11)
+	mask := big.NewInt(2047)
+	for i := len(words) - 1; i >= 0; i-- {
+		words[i] = wordlist[new(big.Int).And(data, mask).Int64()]
+		data.Rsh(data, 11)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// ValidateMnemonic checks that the mnemonic consists of words of the BIP-39
+// wordlist and that its checksum is correct.
+func ValidateMnemonic(mnemonic string) error {
+	_, err := mnemonicToEntropy(mnemonic)
+	return err
+}
+
+// NewSeed validates the BIP-39 mnemonic and converts it into the binary seed
+// of a wallet, protected by the optional passphrase.
+func NewSeed(mnemonic, passphrase string) ([]byte, error) {
+	if err := ValidateMnemonic(mnemonic); err != nil {
+		return nil, err
+	}
+	password := norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+
+	return pbkdf2.Key([]byte(password), []byte(salt), 2048, 64, sha512.New), nil
+}
+
+// mnemonicToEntropy decodes the mnemonic back into its entropy, verifying the
+// checksum.
+func mnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, errMnemonicLength
+	}
+	data := new(big.Int)
+	for _, word := range words {
+		index, ok := wordIndex[word]
+		if !ok {
+			return nil, fmt.Errorf("unknown mnemonic word %q", word)
+		}
+		data.Lsh(data, 11)
+		data.Or(data, big.NewInt(int64(index)))
+	}
+	// Split off the checksum and verify it against the entropy
+	size := uint(len(words) / 3)
+	checksum := new(big.Int).And(data, big.NewInt(1<<size-1))
+	data.Rsh(data, size)
+
+	entropy := math.PaddedBigBytes(data, len(words)*4/3)
+	if hash := sha256.Sum256(entropy); int64(hash[0]>>(8-size)) != checksum.Int64() {
+		return nil, errMnemonicChecksum
+	}
+	return entropy, nil
+}
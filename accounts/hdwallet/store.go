@@ -0,0 +1,351 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package hdwallet implements hierarchical deterministic software wallets,
+// deriving accounts from a BIP-39 mnemonic along BIP-32 derivation paths.
+//
+// The seeds of the wallets are stored encrypted in the "hd" folder of the
+// keystore directory, along with the list of accounts pinned in each.
+package hdwallet
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// HDScheme is the protocol scheme prefixing account and wallet URLs.
+const HDScheme = "hd"
+
+// seedDirName is the name of the folder within the keystore holding the seeds.
+const seedDirName = "hd"
+
+// seedVersion is the version of the seed file format.
+const seedVersion = 1
+
+// refreshCycle is the time between two scans of the seed folder, to notice seeds
+// imported or deleted by other processes.
+const refreshCycle = 3 * time.Second
+
+// refreshThrottling is the minimum time between seed folder scans to avoid disk
+// trashing if wallets are requested in a loop.
+const refreshThrottling = time.Second
+
+// StoreType is the reflect type of an HD wallet store backend.
+var StoreType = reflect.TypeOf(&Store{})
+
+// ErrSeedExists is returned if a mnemonic is imported whose seed is already in
+// the store.
+var ErrSeedExists = errors.New("seed already exists")
+
+// seedFile is the on-disk format of an encrypted wallet seed.
+type seedFile struct {
+	Version  int                 `json:"version"`
+	Crypto   keystore.CryptoJSON `json:"crypto"`
+	Accounts []seedAccount       `json:"accounts"` // Accounts pinned in the wallet
+}
+
+// seedAccount is an account pinned in a wallet, listed without decrypting the
+// seed.
+type seedAccount struct {
+	Address common.Address `json:"address"`
+	Path    string         `json:"path"`
+}
+
+// Store is an accounts.Backend managing the HD wallets of the seeds in a
+// keystore directory.
+type Store struct {
+	dir     string // Folder of the seed files
+	scryptN int    // Scrypt N parameter to encrypt seeds with
+	scryptP int    // Scrypt P parameter to encrypt seeds with
+
+	refreshed   time.Time               // Time instance when the list of wallets was last refreshed
+	wallets     []*wallet               // List of wallets currently tracking, sorted by URL
+	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+	updating    bool                    // Whether the event notification loop is running
+
+	stateLock sync.RWMutex // Protects the internals of the store from racey access
+}
+
+// NewStore creates an HD wallet store for the seeds kept in the keystore
+// directory, encrypting new seeds with the given scrypt parameters.
+func NewStore(keydir string, scryptN, scryptP int) *Store {
+	store := &Store{
+		dir:     filepath.Join(keydir, seedDirName),
+		scryptN: scryptN,
+		scryptP: scryptP,
+	}
+	store.refreshWallets()
+	return store
+}
+
+// Wallets implements accounts.Backend, returning the wallets of all the seeds
+// in the store.
+func (s *Store) Wallets() []accounts.Wallet {
+	// Make sure the list of wallets is up to date
+	s.refreshWallets()
+
+	s.stateLock.RLock()
+	defer s.stateLock.RUnlock()
+
+	cpy := make([]accounts.Wallet, len(s.wallets))
+	for i, wallet := range s.wallets {
+		cpy[i] = wallet
+	}
+	return cpy
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the addition or removal of HD wallets.
+func (s *Store) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	// We need the mutex to reliably start/stop the update loop
+	s.stateLock.Lock()
+	defer s.stateLock.Unlock()
+
+	// Subscribe the caller and track the subscriber count
+	sub := s.updateScope.Track(s.updateFeed.Subscribe(sink))
+
+	// Subscribers require an active notification loop, start it
+	if !s.updating {
+		s.updating = true
+		go s.updater()
+	}
+	return sub
+}
+
+// updater is responsible for maintaining an up-to-date list of wallets stored
+// in the keystore, and for firing wallet addition/removal events.
+func (s *Store) updater() {
+	for {
+		time.Sleep(refreshCycle)
+
+		// Run the wallet refresher
+		s.refreshWallets()
+
+		// If all our subscribers left, stop the updater
+		s.stateLock.Lock()
+		if s.updateScope.Count() == 0 {
+			s.updating = false
+			s.stateLock.Unlock()
+			return
+		}
+		s.stateLock.Unlock()
+	}
+}
+
+// Import stores the seed of the BIP-39 mnemonic and optional passphrase in a new
+// wallet, encrypted with auth. The first account of the default derivation path
+// is pinned in the wallet and returned.
+func (s *Store) Import(mnemonic, passphrase, auth string) (accounts.Account, error) {
+	seed, err := NewSeed(mnemonic, passphrase)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	path := accounts.DefaultBaseDerivationPath
+	address, err := deriveAddress(seed, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	// Refuse importing a seed twice, as pinned accounts would diverge
+	s.refreshWallets()
+	s.stateLock.Lock()
+	for _, wallet := range s.wallets {
+		if wallet.first() == address {
+			s.stateLock.Unlock()
+			return accounts.Account{}, ErrSeedExists
+		}
+	}
+	wallet, err := s.create(seed, auth, address, path)
+	s.stateLock.Unlock()
+
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	// Notify anyone listening of the new wallet
+	s.updateFeed.Send(accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+	return accounts.Account{Address: address, URL: wallet.accountURL(path)}, nil
+}
+
+// create encrypts the seed into a new seed file with the first account pinned,
+// and starts tracking its wallet.
+//
+// Note, create assumes the state lock is held!
+func (s *Store) create(seed []byte, auth string, address common.Address, path accounts.DerivationPath) (*wallet, error) {
+	cryptoStruct, err := keystore.EncryptDataV3(seed, []byte(auth), s.scryptN, s.scryptP)
+	if err != nil {
+		return nil, err
+	}
+	file := &seedFile{
+		Version:  seedVersion,
+		Crypto:   cryptoStruct,
+		Accounts: []seedAccount{{Address: address, Path: path.String()}},
+	}
+	filename := filepath.Join(s.dir, seedFileName(address))
+	if err := writeSeedFile(filename, file); err != nil {
+		return nil, err
+	}
+	wallet, err := newWallet(s, filename, file)
+	if err != nil {
+		return nil, err
+	}
+	s.wallets = append(s.wallets, wallet)
+	sort.Slice(s.wallets, func(i, j int) bool { return s.wallets[i].url.Cmp(s.wallets[j].url) < 0 })
+	return wallet, nil
+}
+
+// refreshWallets scans the seed folder and updates the list of wallets based on
+// the seed files found.
+func (s *Store) refreshWallets() {
+	// Don't scan the disk like crazy if the user fetches wallets in a loop
+	s.stateLock.RLock()
+	elapsed := time.Since(s.refreshed)
+	s.stateLock.RUnlock()
+
+	if elapsed < refreshThrottling {
+		return
+	}
+	// Retrieve the current list of seed files
+	var paths []string
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil && !os.IsNotExist(err) {
+		log.Debug("Failed to scan HD wallet seeds", "dir", s.dir, "err", err)
+	}
+	for _, fi := range files {
+		// Skip editor backups, hidden and temporary files, and folders
+		if strings.HasSuffix(fi.Name(), "~") || strings.HasPrefix(fi.Name(), ".") || !fi.Mode().IsRegular() {
+			continue
+		}
+		paths = append(paths, filepath.Join(s.dir, fi.Name()))
+	}
+	// Transform the current list of wallets into the new one
+	s.stateLock.Lock()
+
+	known := make(map[string]*wallet, len(s.wallets))
+	for _, wallet := range s.wallets {
+		known[wallet.url.Path] = wallet
+	}
+	wallets := make([]*wallet, 0, len(paths))
+	events := []accounts.WalletEvent{}
+
+	for _, path := range paths {
+		// Keep the wallets already tracked
+		if wallet, ok := known[path]; ok {
+			wallets = append(wallets, wallet)
+			delete(known, path)
+			continue
+		}
+		// Load any new seed file
+		file, err := readSeedFile(path)
+		if err != nil {
+			log.Warn("Failed to load HD wallet seed", "path", path, "err", err)
+			continue
+		}
+		wallet, err := newWallet(s, path, file)
+		if err != nil {
+			log.Warn("Failed to load HD wallet seed", "path", path, "err", err)
+			continue
+		}
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletArrived})
+		wallets = append(wallets, wallet)
+	}
+	// Drop any wallets whose seed file disappeared
+	for _, wallet := range known {
+		events = append(events, accounts.WalletEvent{Wallet: wallet, Kind: accounts.WalletDropped})
+	}
+	sort.Slice(wallets, func(i, j int) bool { return wallets[i].url.Cmp(wallets[j].url) < 0 })
+
+	s.refreshed = time.Now()
+	s.wallets = wallets
+	s.stateLock.Unlock()
+
+	// Fire all wallet events and return
+	for _, event := range events {
+		s.updateFeed.Send(event)
+	}
+}
+
+// seedFileName returns the file name of a new seed, identified by its first
+// account.
+func seedFileName(address common.Address) string {
+	return fmt.Sprintf("UTC--%s--%x", time.Now().UTC().Format("2006-01-02T15-04-05.000000000Z"), address)
+}
+
+// readSeedFile loads a seed file from disk.
+func readSeedFile(path string) (*seedFile, error) {
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	file := new(seedFile)
+	if err := json.Unmarshal(blob, file); err != nil {
+		return nil, err
+	}
+	if file.Version != seedVersion {
+		return nil, fmt.Errorf("unsupported seed version %d", file.Version)
+	}
+	return file, nil
+}
+
+// writeSeedFile atomically writes a seed file to disk.
+func writeSeedFile(path string, file *seedFile) error {
+	blob, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// Create a temporary hidden file first, then move it into place. TempFile
+	// assigns mode 0600.
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(blob); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	f.Close()
+	return os.Rename(f.Name(), path)
+}
+
+// deriveAddress derives the address of the account at the derivation path.
+func deriveAddress(seed []byte, path accounts.DerivationPath) (common.Address, error) {
+	key, err := DeriveKey(seed, path)
+	if err != nil {
+		return common.Address{}, err
+	}
+	defer zeroKey(key)
+	return crypto.PubkeyToAddress(key.PublicKey), nil
+}
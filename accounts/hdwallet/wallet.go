@@ -0,0 +1,472 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hdwallet
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+// Minimum time to wait between self derivation attempts, even it the user is
+// requesting accounts like crazy.
+const selfDeriveThrottling = time.Second
+
+// wallet is the accounts.Wallet of a seed in the store. Pinned accounts are
+// listed even while locked, signing and derivation need the wallet opened with
+// the password of the seed.
+type wallet struct {
+	store *Store       // Store the seed file is tracked by
+	url   accounts.URL // Location of the seed file
+	file  *seedFile    // Contents of the seed file
+	seed  []byte       // Decrypted seed, nil if the wallet is closed
+
+	accounts []accounts.Account                         // List of pinned and self-derived accounts
+	paths    map[common.Address]accounts.DerivationPath // Known derivation paths for signing operations
+
+	deriveNextPath accounts.DerivationPath   // Next derivation path for account auto-discovery
+	deriveChain    ethereum.ChainStateReader // Blockchain state reader to discover used account with
+	deriveReq      chan chan struct{}        // Channel to request a self-derivation on
+	deriveQuit     chan chan error           // Channel to terminate the self-deriver with
+
+	stateLock sync.RWMutex // Protects read and write access to the wallet struct fields
+}
+
+// newWallet creates the wallet of a seed file, tracking its pinned accounts.
+func newWallet(store *Store, path string, file *seedFile) (*wallet, error) {
+	w := &wallet{
+		store: store,
+		url:   accounts.URL{Scheme: HDScheme, Path: path},
+		file:  file,
+	}
+	if err := w.reset(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// URL implements accounts.Wallet, returning the location of the seed file.
+func (w *wallet) URL() accounts.URL {
+	return w.url // Immutable, no need for a lock
+}
+
+// Status implements accounts.Wallet, returning whether the seed is decrypted.
+func (w *wallet) Status() (string, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.seed == nil {
+		return "Locked", nil
+	}
+	return "Unlocked", nil
+}
+
+// Open implements accounts.Wallet, decrypting the seed with the passphrase to
+// allow signing and account derivation.
+func (w *wallet) Open(passphrase string) error {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.seed != nil {
+		return accounts.ErrWalletAlreadyOpen
+	}
+	seed, err := keystore.DecryptDataV3(w.file.Crypto, passphrase)
+	if err != nil {
+		if passphrase == "" {
+			return accounts.NewAuthNeededError("password")
+		}
+		return err
+	}
+	w.seed = seed
+
+	// Wallet unlocked, start the self-deriver
+	w.deriveReq = make(chan chan struct{})
+	w.deriveQuit = make(chan chan error)
+
+	go w.selfDerive()
+
+	// Notify anyone listening for wallet events that the wallet is accessible
+	go w.store.updateFeed.Send(accounts.WalletEvent{Wallet: w, Kind: accounts.WalletOpened})
+
+	return nil
+}
+
+// Close implements accounts.Wallet, wiping the decrypted seed and dropping the
+// self-derived accounts.
+func (w *wallet) Close() error {
+	// Terminate the self-derivations
+	w.stateLock.RLock()
+	dQuit := w.deriveQuit
+	w.stateLock.RUnlock()
+
+	if dQuit != nil {
+		errc := make(chan error)
+		dQuit <- errc
+		<-errc
+	}
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriveQuit = nil
+	w.deriveReq = nil
+
+	if w.seed != nil {
+		zeroBytes(w.seed)
+		w.seed = nil
+	}
+	return w.reset()
+}
+
+// reset restores the account list to the pinned accounts.
+//
+// Note, reset assumes the state lock is held!
+func (w *wallet) reset() error {
+	w.accounts = make([]accounts.Account, 0, len(w.file.Accounts))
+	w.paths = make(map[common.Address]accounts.DerivationPath)
+
+	for _, acc := range w.file.Accounts {
+		path, err := accounts.ParseDerivationPath(acc.Path)
+		if err != nil {
+			return fmt.Errorf("invalid path of account %x: %v", acc.Address, err)
+		}
+		w.accounts = append(w.accounts, accounts.Account{Address: acc.Address, URL: w.accountURL(path)})
+		w.paths[acc.Address] = path
+	}
+	return nil
+}
+
+// Accounts implements accounts.Wallet, returning the list of accounts pinned in
+// the wallet. If self-derivation was enabled, the account list is periodically
+// expanded based on current chain state.
+func (w *wallet) Accounts() []accounts.Account {
+	// Attempt self-derivation if it's running
+	w.stateLock.RLock()
+	deriveReq := w.deriveReq
+	w.stateLock.RUnlock()
+
+	reqc := make(chan struct{}, 1)
+	select {
+	case deriveReq <- reqc:
+		// Self-derivation request accepted, wait for it
+		<-reqc
+	default:
+		// Self-derivation offline, throttled or busy, skip
+	}
+	// Return whatever account list we ended up with
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// selfDerive is an account derivation loop that upon request attempts to find
+// new non-zero accounts.
+func (w *wallet) selfDerive() {
+	log.Debug("HD wallet self-derivation started", "url", w.url)
+	defer log.Debug("HD wallet self-derivation stopped", "url", w.url)
+
+	var (
+		reqc chan struct{}
+		errc chan error
+	)
+	for errc == nil {
+		// Wait until either derivation or termination is requested
+		select {
+		case errc = <-w.deriveQuit:
+			// Termination requested
+			continue
+		case reqc = <-w.deriveReq:
+			// Account discovery requested
+		}
+		// Derivation needs a chain, skip if unavailable
+		w.stateLock.RLock()
+		seed, chain := w.seed, w.deriveChain
+		nextPath := make(accounts.DerivationPath, len(w.deriveNextPath))
+		copy(nextPath[:], w.deriveNextPath[:])
+		w.stateLock.RUnlock()
+
+		if seed == nil || chain == nil {
+			reqc <- struct{}{}
+			continue
+		}
+		// Derive accounts until the first empty one
+		var (
+			accs  []accounts.Account
+			paths []accounts.DerivationPath
+
+			ctx = context.Background()
+		)
+		for empty := false; !empty; {
+			address, err := deriveAddress(seed, nextPath)
+			if err != nil {
+				log.Warn("HD wallet account derivation failed", "path", nextPath, "err", err)
+				break
+			}
+			// Check the account's status against the current chain state
+			balance, err := chain.BalanceAt(ctx, address, nil)
+			if err != nil {
+				log.Warn("HD wallet balance retrieval failed", "err", err)
+				break
+			}
+			nonce, err := chain.NonceAt(ctx, address, nil)
+			if err != nil {
+				log.Warn("HD wallet nonce retrieval failed", "err", err)
+				break
+			}
+			// If the next account is empty, stop self-derivation, but add it nonetheless
+			if balance.Sign() == 0 && nonce == 0 {
+				empty = true
+			}
+			path := make(accounts.DerivationPath, len(nextPath))
+			copy(path[:], nextPath[:])
+			paths = append(paths, path)
+			accs = append(accs, accounts.Account{Address: address, URL: w.accountURL(path)})
+
+			// Fetch the next potential account
+			if !empty {
+				nextPath[len(nextPath)-1]++
+			}
+		}
+		// Insert any accounts successfully derived
+		w.stateLock.Lock()
+		for i := 0; i < len(accs); i++ {
+			if _, ok := w.paths[accs[i].Address]; !ok {
+				log.Info("HD wallet discovered new account", "address", accs[i].Address, "path", paths[i])
+				w.accounts = append(w.accounts, accs[i])
+				w.paths[accs[i].Address] = paths[i]
+			}
+		}
+		// Shift the self-derivation forward, unless it was reconfigured meanwhile
+		if w.deriveChain == chain && len(accs) > 0 {
+			w.deriveNextPath = paths[len(paths)-1]
+		}
+		w.stateLock.Unlock()
+
+		// Notify the user of termination and loop after a bit of time (to avoid trashing)
+		reqc <- struct{}{}
+		select {
+		case errc = <-w.deriveQuit:
+			// Termination requested, abort
+		case <-time.After(selfDeriveThrottling):
+			// Waited enough, willing to self-derive again
+		}
+	}
+	errc <- nil
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not pinned or self-derived into this wallet instance.
+func (w *wallet) Contains(account accounts.Account) bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	_, exists := w.paths[account.Address]
+	return exists
+}
+
+// Derive implements accounts.Wallet, deriving a new account at the specific
+// derivation path. If pin is set to true, the account will be added to the list
+// of tracked accounts and persisted in the seed file.
+func (w *wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	if w.seed == nil {
+		return accounts.Account{}, accounts.ErrWalletClosed
+	}
+	address, err := deriveAddress(w.seed, path)
+	if err != nil {
+		return accounts.Account{}, err
+	}
+	account := accounts.Account{Address: address, URL: w.accountURL(path)}
+	if !pin {
+		return account, nil
+	}
+	// Pinning needs to modify the seed file, keep the old accounts on failure
+	for _, acc := range w.file.Accounts {
+		if acc.Address == address {
+			return account, nil
+		}
+	}
+	file := *w.file
+	file.Accounts = append(append([]seedAccount{}, w.file.Accounts...), seedAccount{Address: address, Path: path.String()})
+	if err := writeSeedFile(w.url.Path, &file); err != nil {
+		return accounts.Account{}, err
+	}
+	w.file = &file
+
+	if _, ok := w.paths[address]; !ok {
+		w.accounts = append(w.accounts, account)
+		w.paths[address] = make(accounts.DerivationPath, len(path))
+		copy(w.paths[address], path)
+	}
+	return account, nil
+}
+
+// SelfDerive implements accounts.Wallet, trying to discover accounts that the
+// user used previously (based on the chain state), but ones that they did not
+// explicitly pin to the wallet manually. To avoid chain head monitoring, self
+// derivation only runs during account listing (and even then throttled).
+func (w *wallet) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {
+	w.stateLock.Lock()
+	defer w.stateLock.Unlock()
+
+	w.deriveNextPath = make(accounts.DerivationPath, len(base))
+	copy(w.deriveNextPath[:], base[:])
+
+	w.deriveChain = chain
+}
+
+// SignHash implements accounts.Wallet, signing the hash with the account if the
+// wallet is open.
+func (w *wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	key, err := w.key(w.seed, account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+
+	return crypto.Sign(hash, key)
+}
+
+// SignTx implements accounts.Wallet, signing the transaction with the account if
+// the wallet is open.
+func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	key, err := w.key(w.seed, account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+
+	return signTx(tx, chainID, key)
+}
+
+// SignHashWithPassphrase implements accounts.Wallet, signing the hash with the
+// account, decrypting the seed with the passphrase for this request only.
+func (w *wallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	seed, err := keystore.DecryptDataV3(w.file.Crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(seed)
+
+	key, err := w.key(seed, account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+
+	return crypto.Sign(hash, key)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet, signing the transaction with
+// the account, decrypting the seed with the passphrase for this request only.
+func (w *wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	seed, err := keystore.DecryptDataV3(w.file.Crypto, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroBytes(seed)
+
+	key, err := w.key(seed, account)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroKey(key)
+
+	return signTx(tx, chainID, key)
+}
+
+// key derives the private key of a known account from the seed.
+//
+// Note, key assumes the state lock is held!
+func (w *wallet) key(seed []byte, account accounts.Account) (*ecdsa.PrivateKey, error) {
+	path, ok := w.paths[account.Address]
+	if !ok {
+		return nil, accounts.ErrUnknownAccount
+	}
+	if seed == nil {
+		return nil, keystore.ErrLocked
+	}
+	return DeriveKey(seed, path)
+}
+
+// first returns the address of the account pinned at import, identifying the
+// seed.
+func (w *wallet) first() common.Address {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if len(w.file.Accounts) == 0 {
+		return common.Address{}
+	}
+	return w.file.Accounts[0].Address
+}
+
+// accountURL returns the URL of the account at the derivation path.
+func (w *wallet) accountURL(path accounts.DerivationPath) accounts.URL {
+	return accounts.URL{Scheme: w.url.Scheme, Path: fmt.Sprintf("%s/%s", w.url.Path, path)}
+}
+
+// signTx signs the transaction with the key, with replay protection if a chain
+// id is given.
+func signTx(tx *types.Transaction, chainID *big.Int, key *ecdsa.PrivateKey) (*types.Transaction, error) {
+	if chainID != nil {
+		return types.SignTx(tx, types.NewEIP155Signer(chainID), key)
+	}
+	return types.SignTx(tx, types.HomesteadSigner{}, key)
+}
+
+// zeroKey zeroes a private key in memory.
+func zeroKey(k *ecdsa.PrivateKey) {
+	b := k.D.Bits()
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// zeroBytes zeroes a byte slice in memory.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
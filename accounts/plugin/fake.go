@@ -0,0 +1,145 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package plugin
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// errFakeOffline is returned by the fake plugin while taken offline.
+	errFakeOffline = errors.New("fake plugin offline")
+
+	// errFakeUnknownAccount is returned by the fake plugin for requests of
+	// accounts it doesn't hold the key of.
+	errFakeUnknownAccount = errors.New("unknown account")
+)
+
+// FakePlugin is a signer plugin holding its keys in memory, serving the plugin
+// protocol in-process for tests.
+type FakePlugin struct {
+	keys    map[common.Address]*ecdsa.PrivateKey
+	offline bool
+	lock    sync.RWMutex
+}
+
+// NewFakePlugin creates an in-memory signer plugin with the given keys.
+func NewFakePlugin(keys ...*ecdsa.PrivateKey) *FakePlugin {
+	plugin := &FakePlugin{keys: make(map[common.Address]*ecdsa.PrivateKey)}
+	for _, key := range keys {
+		plugin.AddKey(key)
+	}
+	return plugin
+}
+
+// NewFakeBackend creates an account backend connected to the fake plugin.
+func NewFakeBackend(plugin *FakePlugin) *Backend {
+	server := rpc.NewServer()
+	if err := server.RegisterName("plugin", plugin); err != nil {
+		panic(err) // Can only fail if the fake plugin is malformed
+	}
+	return newBackend("fake", func() (*rpc.Client, error) { return rpc.DialInProc(server), nil })
+}
+
+// AddKey adds a key to the fake plugin.
+func (p *FakePlugin) AddKey(key *ecdsa.PrivateKey) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.keys[crypto.PubkeyToAddress(key.PublicKey)] = key
+}
+
+// SetOffline sets whether the fake plugin fails all requests, simulating it
+// being unreachable.
+func (p *FakePlugin) SetOffline(offline bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.offline = offline
+}
+
+// Accounts implements plugin_accounts, listing the addresses of the keys.
+func (p *FakePlugin) Accounts() ([]common.Address, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.offline {
+		return nil, errFakeOffline
+	}
+	addrs := make([]common.Address, 0, len(p.keys))
+	for addr := range p.keys {
+		addrs = append(addrs, addr)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Hex() < addrs[j].Hex() })
+	return addrs, nil
+}
+
+// SignHash implements plugin_signHash, signing the hash with the account.
+func (p *FakePlugin) SignHash(account common.Address, hash hexutil.Bytes) (hexutil.Bytes, error) {
+	key, err := p.key(account)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.Sign(hash, key)
+}
+
+// SignTransaction implements plugin_signTransaction, signing the RLP encoded
+// transaction with the account.
+func (p *FakePlugin) SignTransaction(account common.Address, blob hexutil.Bytes, chainID *hexutil.Big) (hexutil.Bytes, error) {
+	key, err := p.key(account)
+	if err != nil {
+		return nil, err
+	}
+	tx := new(types.Transaction)
+	if err := rlp.DecodeBytes(blob, tx); err != nil {
+		return nil, err
+	}
+	signer := types.Signer(types.HomesteadSigner{})
+	if chainID != nil {
+		signer = types.NewEIP155Signer(chainID.ToInt())
+	}
+	signed, err := types.SignTx(tx, signer, key)
+	if err != nil {
+		return nil, err
+	}
+	return rlp.EncodeToBytes(signed)
+}
+
+// key retrieves the key of the account, if the plugin is online.
+func (p *FakePlugin) key(account common.Address) (*ecdsa.PrivateKey, error) {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+
+	if p.offline {
+		return nil, errFakeOffline
+	}
+	key, ok := p.keys[account]
+	if !ok {
+		return nil, errFakeUnknownAccount
+	}
+	return key, nil
+}
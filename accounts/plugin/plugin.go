@@ -0,0 +1,231 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package plugin implements an account backend delegating key management and
+// signing to an external signer process, e.g. an HSM or KMS vault integration.
+//
+// The plugin is reached over JSON-RPC (IPC, HTTP or WebSocket) and must serve
+// the following methods:
+//
+//   plugin_accounts() []address
+//     Lists the accounts the plugin can sign with.
+//
+//   plugin_signHash(account address, hash bytes) bytes
+//     Signs the 32 byte hash with the account, returning the 65 byte signature
+//     in [R || S || V] format, where V is 0 or 1.
+//
+//   plugin_signTransaction(account address, tx bytes, chainId quantity) bytes
+//     Signs the RLP encoded transaction with the account, returning the RLP
+//     encoded signed transaction. A non-null chain id requests an EIP155
+//     signature, null a Homestead one.
+//
+// Addresses and bytes are 0x prefixed hex strings, quantities are 0x prefixed
+// hex numbers. Signatures returned by the plugin are checked against the
+// requested account before use.
+package plugin
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// PluginScheme is the protocol scheme prefixing account and wallet URLs.
+const PluginScheme = "plugin"
+
+// refreshCycle is the time between two account list refreshes of the plugin,
+// to notice it coming and going.
+const refreshCycle = 3 * time.Second
+
+// refreshThrottling is the minimum time between account list refreshes to avoid
+// flooding the plugin if wallets are requested in a loop.
+const refreshThrottling = time.Second
+
+// Timeouts of the requests to the plugin. Signing may need the approval of an
+// operator, so it's allowed to take longer.
+const (
+	accountsTimeout = 5 * time.Second
+	signTimeout     = 2 * time.Minute
+)
+
+// Backend is an accounts.Backend exposing the accounts of an external signer
+// plugin as a single wallet, present as long as the plugin is reachable.
+type Backend struct {
+	url  accounts.URL                // Location of the plugin, also the wallet URL
+	dial func() (*rpc.Client, error) // Connects to the plugin
+
+	client      *rpc.Client             // Live connection to the plugin, nil if disconnected
+	refreshed   time.Time               // Time instance when the account list was last refreshed
+	wallet      *wallet                 // Wallet of the plugin, nil if unreachable
+	updateFeed  event.Feed              // Event feed to notify wallet additions/removals
+	updateScope event.SubscriptionScope // Subscription scope tracking current live listeners
+	updating    bool                    // Whether the event notification loop is running
+
+	stateLock sync.RWMutex // Protects the internals of the backend from racey access
+	refreshMu sync.Mutex   // Serializes refreshes, keeping requests out of the state lock
+}
+
+// NewBackend creates an account backend for the signer plugin listening on the
+// given endpoint, either an IPC path or an HTTP or WebSocket URL. The plugin is
+// connected to lazily, so it may be started after the backend.
+func NewBackend(endpoint string) *Backend {
+	return newBackend(endpoint, func() (*rpc.Client, error) { return rpc.Dial(endpoint) })
+}
+
+// newBackend creates an account backend connecting to the plugin via the dialer.
+func newBackend(endpoint string, dial func() (*rpc.Client, error)) *Backend {
+	backend := &Backend{
+		url:  accounts.URL{Scheme: PluginScheme, Path: endpoint},
+		dial: dial,
+	}
+	// Connect in the background, an unreachable plugin must not stall startup
+	go backend.refreshWallets()
+	return backend
+}
+
+// Wallets implements accounts.Backend, returning the wallet of the plugin if it
+// is reachable.
+func (b *Backend) Wallets() []accounts.Wallet {
+	// Make sure the wallet is up to date
+	b.refreshWallets()
+
+	b.stateLock.RLock()
+	defer b.stateLock.RUnlock()
+
+	if b.wallet == nil {
+		return nil
+	}
+	return []accounts.Wallet{b.wallet}
+}
+
+// refreshWallets retrieves the account list of the plugin, tracking the wallet
+// arriving and being dropped as the plugin becomes reachable or unreachable.
+func (b *Backend) refreshWallets() {
+	b.refreshMu.Lock()
+	defer b.refreshMu.Unlock()
+
+	// Don't query the plugin like crazy if the user fetches wallets in a loop
+	b.stateLock.RLock()
+	elapsed, client := time.Since(b.refreshed), b.client
+	b.stateLock.RUnlock()
+
+	if elapsed < refreshThrottling {
+		return
+	}
+	// Retrieve the current accounts, (re)connecting to the plugin if needed
+	var (
+		addrs []common.Address
+		err   error
+	)
+	if client == nil {
+		client, err = b.dial()
+	}
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), accountsTimeout)
+		err = client.CallContext(ctx, &addrs, "plugin_accounts")
+		cancel()
+	}
+	if err != nil && client != nil {
+		client.Close()
+		client = nil
+	}
+	// Update the wallet and gather the events to fire
+	b.stateLock.Lock()
+
+	var events []accounts.WalletEvent
+	switch {
+	case err != nil && b.wallet != nil:
+		log.Warn("Signer plugin unreachable", "url", b.url, "err", err)
+		events = append(events, accounts.WalletEvent{Wallet: b.wallet, Kind: accounts.WalletDropped})
+		b.wallet.fail(err)
+		b.wallet = nil
+
+	case err == nil && b.wallet == nil:
+		log.Info("Signer plugin connected", "url", b.url, "accounts", len(addrs))
+		b.wallet = &wallet{backend: b, url: b.url}
+		events = append(events, accounts.WalletEvent{Wallet: b.wallet, Kind: accounts.WalletArrived})
+	}
+	if b.wallet != nil {
+		b.wallet.setAccounts(addrs)
+	}
+	b.client = client
+	b.refreshed = time.Now()
+	b.stateLock.Unlock()
+
+	// Fire all wallet events and return
+	for _, event := range events {
+		b.updateFeed.Send(event)
+	}
+}
+
+// Subscribe implements accounts.Backend, creating an async subscription to
+// receive notifications on the plugin wallet arriving or being dropped.
+func (b *Backend) Subscribe(sink chan<- accounts.WalletEvent) event.Subscription {
+	// We need the mutex to reliably start/stop the update loop
+	b.stateLock.Lock()
+	defer b.stateLock.Unlock()
+
+	// Subscribe the caller and track the subscriber count
+	sub := b.updateScope.Track(b.updateFeed.Subscribe(sink))
+
+	// Subscribers require an active notification loop, start it
+	if !b.updating {
+		b.updating = true
+		go b.updater()
+	}
+	return sub
+}
+
+// updater is responsible for periodically refreshing the wallet of the plugin,
+// and for firing wallet addition/removal events.
+func (b *Backend) updater() {
+	for {
+		time.Sleep(refreshCycle)
+
+		// Run the wallet refresher
+		b.refreshWallets()
+
+		// If all our subscribers left, stop the updater
+		b.stateLock.Lock()
+		if b.updateScope.Count() == 0 {
+			b.updating = false
+			b.stateLock.Unlock()
+			return
+		}
+		b.stateLock.Unlock()
+	}
+}
+
+// call sends a request to the plugin, failing if it's not connected.
+func (b *Backend) call(timeout time.Duration, result interface{}, method string, args ...interface{}) error {
+	b.stateLock.RLock()
+	client := b.client
+	b.stateLock.RUnlock()
+
+	if client == nil {
+		return errPluginUnreachable
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return client.CallContext(ctx, result, method, args...)
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package plugin
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// Tests that the accounts of the plugin are listed and can sign hashes and
+// transactions.
+func TestPluginSigning(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	backend := NewFakeBackend(NewFakePlugin(key))
+
+	wallets := backend.Wallets()
+	if len(wallets) != 1 {
+		t.Fatalf("wallet count mismatch: have %d, want 1", len(wallets))
+	}
+	wallet := wallets[0]
+	if status, err := wallet.Status(); err != nil {
+		t.Fatalf("wallet failed: %s (%v)", status, err)
+	}
+	accs := wallet.Accounts()
+	if len(accs) != 1 || accs[0].Address != crypto.PubkeyToAddress(key.PublicKey) {
+		t.Fatalf("accounts mismatch: have %v, want %x", accs, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	account := accs[0]
+
+	// Sign a hash and verify the signer
+	hash := crypto.Keccak256([]byte("hello"))
+	sig, err := wallet.SignHash(account, hash)
+	if err != nil {
+		t.Fatalf("failed to sign hash: %v", err)
+	}
+	if pubkey, err := crypto.SigToPub(hash, sig); err != nil || crypto.PubkeyToAddress(*pubkey) != account.Address {
+		t.Errorf("hash signer mismatch")
+	}
+	// Sign transactions with and without replay protection
+	tx := types.NewTransaction(1, common.HexToAddress("0xb0b"), big.NewInt(1), 21000, big.NewInt(1), nil)
+	for _, chainID := range []*big.Int{nil, big.NewInt(1)} {
+		signed, err := wallet.SignTx(account, tx, chainID)
+		if err != nil {
+			t.Fatalf("failed to sign transaction (chain %v): %v", chainID, err)
+		}
+		if signed.Protected() != (chainID != nil) {
+			t.Errorf("replay protection mismatch (chain %v): have %v", chainID, signed.Protected())
+		}
+		signer := types.Signer(types.HomesteadSigner{})
+		if chainID != nil {
+			signer = types.NewEIP155Signer(chainID)
+		}
+		if sender, err := types.Sender(signer, signed); err != nil || sender != account.Address {
+			t.Errorf("transaction signer mismatch (chain %v): have %x (%v)", chainID, sender, err)
+		}
+	}
+	// Requests of unknown accounts must be rejected locally
+	unknown := accounts.Account{Address: common.HexToAddress("0x01")}
+	if _, err := wallet.SignHash(unknown, hash); err != accounts.ErrUnknownAccount {
+		t.Errorf("unknown account error mismatch: have %v, want %v", err, accounts.ErrUnknownAccount)
+	}
+}
+
+// Tests that wallet events are fired as the plugin comes and goes, and that its
+// accounts are kept up to date.
+func TestPluginEvents(t *testing.T) {
+	plugin := NewFakePlugin()
+	plugin.SetOffline(true)
+	backend := NewFakeBackend(plugin)
+
+	if wallets := backend.Wallets(); len(wallets) != 0 {
+		t.Fatalf("offline plugin has wallets: %d", len(wallets))
+	}
+	events := make(chan accounts.WalletEvent, 4)
+	sub := backend.Subscribe(events)
+	defer sub.Unsubscribe()
+
+	wait := func(kind accounts.WalletEventType) accounts.Wallet {
+		select {
+		case event := <-events:
+			if event.Kind != kind {
+				t.Fatalf("event kind mismatch: have %v, want %v", event.Kind, kind)
+			}
+			return event.Wallet
+		case <-time.After(2 * refreshCycle):
+			t.Fatalf("timeout waiting for event %v", kind)
+		}
+		return nil
+	}
+	// Bring the plugin online and add a key to it
+	plugin.SetOffline(false)
+	wallet := wait(accounts.WalletArrived)
+	if accs := wallet.Accounts(); len(accs) != 0 {
+		t.Errorf("accounts of empty plugin: %v", accs)
+	}
+	key, _ := crypto.GenerateKey()
+	plugin.AddKey(key)
+
+	time.Sleep(refreshThrottling)
+	backend.refreshWallets()
+	if !wallet.Contains(accounts.Account{Address: crypto.PubkeyToAddress(key.PublicKey)}) {
+		t.Errorf("added account missing")
+	}
+	// Take the plugin offline, dropping the wallet
+	plugin.SetOffline(true)
+	if dropped := wait(accounts.WalletDropped); dropped != wallet {
+		t.Errorf("dropped wallet mismatch")
+	}
+	if _, err := wallet.Status(); err == nil {
+		t.Errorf("dropped wallet reports no failure")
+	}
+	if wallets := backend.Wallets(); len(wallets) != 0 {
+		t.Errorf("offline plugin has wallets: %d", len(wallets))
+	}
+}
+
+// Tests that creating the backend doesn't wait for the plugin to be reachable.
+func TestPluginSlowStartup(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	done := make(chan *Backend)
+	go func() {
+		done <- newBackend("slow", func() (*rpc.Client, error) {
+			<-release
+			return nil, errPluginUnreachable
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("backend creation blocked on the plugin")
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// errPluginUnreachable is returned if a request is made while the plugin
+	// can't be reached.
+	errPluginUnreachable = errors.New("signer plugin unreachable")
+
+	// errInvalidSignature is returned if the plugin responds with a signature
+	// that is malformed or not made by the requested account.
+	errInvalidSignature = errors.New("invalid signature from signer plugin")
+
+	// errInvalidTransaction is returned if the plugin responds with a signed
+	// transaction differing from the one requested.
+	errInvalidTransaction = errors.New("invalid transaction from signer plugin")
+)
+
+// wallet is the accounts.Wallet of a signer plugin, forwarding all signing
+// requests to it.
+type wallet struct {
+	backend *Backend     // Backend requests are sent through
+	url     accounts.URL // Location of the plugin
+
+	accounts []accounts.Account // Accounts of the plugin, as last retrieved
+	failure  error              // Error that dropped the wallet, if any
+
+	stateLock sync.RWMutex // Protects read and write access to the wallet struct fields
+}
+
+// URL implements accounts.Wallet, returning the location of the plugin.
+func (w *wallet) URL() accounts.URL {
+	return w.url
+}
+
+// Status implements accounts.Wallet, returning whether the plugin is reachable.
+func (w *wallet) Status() (string, error) {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	if w.failure != nil {
+		return "Offline", w.failure
+	}
+	return "Online", nil
+}
+
+// Open implements accounts.Wallet. The plugin manages access to its keys by
+// itself, so this method is a noop.
+func (w *wallet) Open(passphrase string) error { return nil }
+
+// Close implements accounts.Wallet. The connection to the plugin is owned by
+// the backend, so this method is a noop.
+func (w *wallet) Close() error { return nil }
+
+// Accounts implements accounts.Wallet, returning the accounts of the plugin.
+func (w *wallet) Accounts() []accounts.Account {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	cpy := make([]accounts.Account, len(w.accounts))
+	copy(cpy, w.accounts)
+	return cpy
+}
+
+// Contains implements accounts.Wallet, returning whether a particular account is
+// or is not managed by the plugin.
+func (w *wallet) Contains(account accounts.Account) bool {
+	w.stateLock.RLock()
+	defer w.stateLock.RUnlock()
+
+	for _, acc := range w.accounts {
+		if acc.Address == account.Address && (account.URL == (accounts.URL{}) || account.URL == w.url) {
+			return true
+		}
+	}
+	return false
+}
+
+// Derive implements accounts.Wallet, but is a noop for plugin wallets since
+// there is no notion of hierarchical account derivation.
+func (w *wallet) Derive(path accounts.DerivationPath, pin bool) (accounts.Account, error) {
+	return accounts.Account{}, accounts.ErrNotSupported
+}
+
+// SelfDerive implements accounts.Wallet, but is a noop for plugin wallets since
+// there is no notion of hierarchical account derivation.
+func (w *wallet) SelfDerive(base accounts.DerivationPath, chain ethereum.ChainStateReader) {}
+
+// SignHash implements accounts.Wallet, requesting the plugin to sign the hash
+// with the account.
+func (w *wallet) SignHash(account accounts.Account, hash []byte) ([]byte, error) {
+	if !w.Contains(account) {
+		return nil, accounts.ErrUnknownAccount
+	}
+	var sig hexutil.Bytes
+	if err := w.backend.call(signTimeout, &sig, "plugin_signHash", account.Address, hexutil.Bytes(hash)); err != nil {
+		return nil, err
+	}
+	// Make sure the plugin signed with the requested account
+	if len(sig) != 65 || sig[64] > 1 {
+		return nil, errInvalidSignature
+	}
+	pubkey, err := crypto.SigToPub(hash, sig)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != account.Address {
+		return nil, errInvalidSignature
+	}
+	return sig, nil
+}
+
+// SignTx implements accounts.Wallet, requesting the plugin to sign the
+// transaction with the account.
+func (w *wallet) SignTx(account accounts.Account, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	if !w.Contains(account) {
+		return nil, accounts.ErrUnknownAccount
+	}
+	blob, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return nil, err
+	}
+	var res hexutil.Bytes
+	if err := w.backend.call(signTimeout, &res, "plugin_signTransaction", account.Address, hexutil.Bytes(blob), (*hexutil.Big)(chainID)); err != nil {
+		return nil, err
+	}
+	signed := new(types.Transaction)
+	if err := rlp.DecodeBytes(res, signed); err != nil {
+		return nil, fmt.Errorf("%v: %v", errInvalidTransaction, err)
+	}
+	// Make sure the plugin signed the requested transaction with the account
+	signer := types.Signer(types.HomesteadSigner{})
+	if chainID != nil {
+		signer = types.NewEIP155Signer(chainID)
+	}
+	if signer.Hash(signed) != signer.Hash(tx) {
+		return nil, errInvalidTransaction
+	}
+	if sender, err := types.Sender(signer, signed); err != nil || sender != account.Address {
+		return nil, errInvalidSignature
+	}
+	return signed, nil
+}
+
+// SignHashWithPassphrase implements accounts.Wallet. Since the plugin manages
+// access to its keys by itself, the passphrase is silently ignored.
+func (w *wallet) SignHashWithPassphrase(account accounts.Account, passphrase string, hash []byte) ([]byte, error) {
+	return w.SignHash(account, hash)
+}
+
+// SignTxWithPassphrase implements accounts.Wallet. Since the plugin manages
+// access to its keys by itself, the passphrase is silently ignored.
+func (w *wallet) SignTxWithPassphrase(account accounts.Account, passphrase string, tx *types.Transaction, chainID *big.Int) (*types.Transaction, error) {
+	return w.SignTx(account, tx, chainID)
+}
+
+// setAccounts updates the accounts of the plugin.
+func (w *wallet) setAccounts(addrs []common.Address) {
+	accs := make([]accounts.Account, len(addrs))
+	for i, addr := range addrs {
+		accs[i] = accounts.Account{Address: addr, URL: w.url}
+	}
+	w.stateLock.Lock()
+	w.accounts = accs
+	w.stateLock.Unlock()
+}
+
+// fail marks the wallet as dropped due to the plugin being unreachable.
+func (w *wallet) fail(err error) {
+	w.stateLock.Lock()
+	w.failure = err
+	w.stateLock.Unlock()
+}
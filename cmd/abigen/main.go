@@ -17,6 +17,7 @@
 package main
 
 import (
+	"encoding/hex"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -26,6 +27,7 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common/compiler"
+	"github.com/ethereum/go-ethereum/crypto"
 )
 
 var (
@@ -74,6 +76,7 @@ func main() {
 		abis  []string
 		bins  []string
 		types []string
+		libs  = make(map[string]string)
 	)
 	if *solFlag != "" || *abiFlag == "-" {
 		// Generate the list of types to exclude from binding
@@ -99,15 +102,20 @@ func main() {
 		}
 		// Gather all non-excluded contract for binding
 		for name, contract := range contracts {
+			nameParts := strings.Split(name, ":")
+			typeName := nameParts[len(nameParts)-1]
+
+			// Any contract may be a library linked into others, track its placeholders
+			for _, placeholder := range libraryPlaceholders(name) {
+				libs[placeholder] = typeName
+			}
 			if exclude[strings.ToLower(name)] {
 				continue
 			}
 			abi, _ := json.Marshal(contract.Info.AbiDefinition) // Flatten the compiler parse
 			abis = append(abis, string(abi))
 			bins = append(bins, contract.Code)
-
-			nameParts := strings.Split(name, ":")
-			types = append(types, nameParts[len(nameParts)-1])
+			types = append(types, typeName)
 		}
 	} else {
 		// Otherwise load up the ABI, optional bytecode and type name from the parameters
@@ -134,7 +142,7 @@ func main() {
 		types = append(types, kind)
 	}
 	// Generate the contract binding
-	code, err := bind.Bind(types, abis, bins, *pkgFlag, lang)
+	code, err := bind.Bind(types, abis, bins, *pkgFlag, lang, libs)
 	if err != nil {
 		fmt.Printf("Failed to generate ABI binding: %v\n", err)
 		os.Exit(-1)
@@ -158,3 +166,18 @@ func contractsFromStdin() (map[string]*compiler.Contract, error) {
 
 	return compiler.ParseCombinedJSON(bytes, "", "", "", "")
 }
+
+// libraryPlaceholders returns the placeholders the Solidity compiler leaves in
+// the bytecode of contracts for linking the library with the fully qualified
+// name: the hash based one of solc 0.5 and the name based one of earlier ones.
+func libraryPlaceholders(name string) []string {
+	hash := hex.EncodeToString(crypto.Keccak256([]byte(name)))[:34]
+
+	legacy := name
+	if len(legacy) > 36 {
+		legacy = legacy[:36]
+	}
+	legacy += strings.Repeat("_", 36-len(legacy))
+
+	return []string{"__$" + hash + "$__", "__" + legacy + "__"}
+}
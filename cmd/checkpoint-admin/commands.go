@@ -0,0 +1,171 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/contracts/checkpointoracle"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandStatus = cli.Command{
+	Name:  "status",
+	Usage: "Fetches the signers and checkpoint status of the oracle contract",
+	Flags: []cli.Flag{
+		oracleFlag,
+		rpcFlag,
+	},
+	Action: utils.MigrateFlags(status),
+}
+
+var commandSign = cli.Command{
+	Name:  "sign",
+	Usage: "Sign the checkpoint with the specified key",
+	Description: `
+Retrieves the checkpoint of the given section from the local indexers of a
+light server and signs it for the oracle contract. The signature is printed
+and needs to be collected by the admin publishing the checkpoint.`,
+	Flags: []cli.Flag{
+		oracleFlag,
+		rpcFlag,
+		indexFlag,
+		keyfileFlag,
+		passphraseFlag,
+	},
+	Action: utils.MigrateFlags(sign),
+}
+
+var commandPublish = cli.Command{
+	Name:  "publish",
+	Usage: "Publish a checkpoint into the oracle",
+	Description: `
+Submits a checkpoint along with the signatures of a threshold of oracle admins
+to the oracle contract. The transaction is sent from the specified key, which
+must belong to one of the admins.`,
+	Flags: []cli.Flag{
+		oracleFlag,
+		rpcFlag,
+		indexFlag,
+		signaturesFlag,
+		keyfileFlag,
+		passphraseFlag,
+	},
+	Action: utils.MigrateFlags(publish),
+}
+
+// status fetches the admin list of specified registrar contract.
+func status(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(rpcFlag.Name))
+	addr, oracle := newContract(ctx, client)
+	fmt.Printf("Oracle => %s\n", addr.Hex())
+	fmt.Println()
+
+	// Retrieve the list of authorized signers (admins)
+	admins, err := oracle.Contract().GetAllAdmin(nil)
+	if err != nil {
+		return err
+	}
+	for i, admin := range admins {
+		fmt.Printf("Admin %d => %s\n", i+1, admin.Hex())
+	}
+	fmt.Println()
+
+	// Retrieve the latest checkpoint along with the admins who signed it
+	index, checkpoint, height, sigs, err := oracle.LatestCheckpoint(nil)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Checkpoint (published at #%d) %d => %s\n", height, index, checkpoint.Hex())
+	for _, sig := range sigs {
+		signer, err := checkpointoracle.RecoverSigner(addr, index, checkpoint, sig)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Signed by => %s\n", signer.Hex())
+	}
+	return nil
+}
+
+// sign creates the signature for the specific checkpoint with a local key.
+func sign(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(rpcFlag.Name))
+	addr, _ := newContract(ctx, client)
+	checkpoint := getCheckpoint(ctx, client)
+	key := getKey(ctx)
+
+	sig, err := checkpointoracle.SignCheckpoint(addr, checkpoint.SectionIndex, checkpoint.Hash, func(hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key.PrivateKey)
+	})
+	if err != nil {
+		utils.Fatalf("Failed to sign checkpoint: %v", err)
+	}
+	fmt.Printf("Oracle     => %s\n", addr.Hex())
+	fmt.Printf("Index      => %d\n", checkpoint.SectionIndex)
+	fmt.Printf("Checkpoint => %s\n", checkpoint.Hash.Hex())
+	fmt.Printf("Signer     => %s\n", key.Address.Hex())
+	fmt.Printf("Signature  => %s\n", hexutil.Encode(sig))
+	return nil
+}
+
+// publish registers the specified checkpoint which generated by connected node
+// with a authorised private key.
+func publish(ctx *cli.Context) error {
+	client := newRPCClient(ctx.GlobalString(rpcFlag.Name))
+	addr, oracle := newContract(ctx, client)
+	checkpoint := getCheckpoint(ctx, client)
+
+	// Decode and validate the collected signatures
+	var sigs [][]byte
+	for _, hex := range strings.Split(ctx.String(signaturesFlag.Name), ",") {
+		if hex = strings.TrimSpace(hex); hex == "" {
+			continue
+		}
+		sig, err := hexutil.Decode(hex)
+		if err != nil {
+			utils.Fatalf("Invalid signature %q: %v", hex, err)
+		}
+		signer, err := checkpointoracle.RecoverSigner(addr, checkpoint.SectionIndex, checkpoint.Hash, sig)
+		if err != nil {
+			utils.Fatalf("Invalid signature %q: %v", hex, err)
+		}
+		fmt.Printf("Signed by => %s\n", signer.Hex())
+		sigs = append(sigs, sig)
+	}
+	if len(sigs) == 0 {
+		utils.Fatalf("No signatures specified")
+	}
+	// Reference the current head for replay protection and submit the checkpoint
+	head, err := ethclient.NewClient(client).HeaderByNumber(context.Background(), nil)
+	if err != nil {
+		utils.Fatalf("Failed to retrieve head block: %v", err)
+	}
+	key := getKey(ctx)
+	tx, err := oracle.RegisterCheckpoint(bind.NewKeyedTransactor(key.PrivateKey), checkpoint.SectionIndex, checkpoint.Hash, head.Number, head.Hash(), sigs)
+	if err != nil {
+		utils.Fatalf("Failed to register checkpoint: %v", err)
+	}
+	fmt.Printf("Sent checkpoint %d => %s in transaction %s\n", checkpoint.SectionIndex, checkpoint.Hash.Hex(), tx.Hash().Hex())
+	return nil
+}
@@ -0,0 +1,177 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// checkpoint-admin is a utility that can be used to query checkpoint information
+// and register stable checkpoints into an oracle contract.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/keystore"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/console"
+	"github.com/ethereum/go-ethereum/contracts/checkpointoracle"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/les"
+	"github.com/ethereum/go-ethereum/rpc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Git SHA1 commit hash of the release (set via linker flags)
+var gitCommit = ""
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "ethereum checkpoint helper tool")
+	app.Commands = []cli.Command{
+		commandStatus,
+		commandSign,
+		commandPublish,
+	}
+	app.Flags = []cli.Flag{
+		rpcFlag,
+		oracleFlag,
+	}
+}
+
+// Commonly used command line flags.
+var (
+	rpcFlag = cli.StringFlag{
+		Name:  "rpc",
+		Value: "http://localhost:8545",
+		Usage: "The rpc endpoint of a local or remote geth node",
+	}
+	oracleFlag = cli.StringFlag{
+		Name:  "oracle",
+		Usage: "Checkpoint oracle contract address",
+	}
+	indexFlag = cli.Int64Flag{
+		Name:  "index",
+		Value: -1,
+		Usage: "Checkpoint index (query latest from remote node if not specified)",
+	}
+	keyfileFlag = cli.StringFlag{
+		Name:  "keyfile",
+		Usage: "The private key file (keyfile signature is not recommended)",
+	}
+	passphraseFlag = cli.StringFlag{
+		Name:  "passwordfile",
+		Usage: "The file that contains the passphrase for the keyfile",
+	}
+	signaturesFlag = cli.StringFlag{
+		Name:  "signatures",
+		Usage: "Comma separated checkpoint signatures to submit",
+	}
+)
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// newRPCClient creates a rpc client with specified node URL.
+func newRPCClient(url string) *rpc.Client {
+	client, err := rpc.Dial(url)
+	if err != nil {
+		utils.Fatalf("Failed to connect to Ethereum node: %v", err)
+	}
+	return client
+}
+
+// newContract creates a registrar contract instance with specified contract
+// address or the default contracts for mainnet or testnet.
+func newContract(ctx *cli.Context, client *rpc.Client) (common.Address, *checkpointoracle.CheckpointOracle) {
+	addr := ctx.GlobalString(oracleFlag.Name)
+	if !common.IsHexAddress(addr) {
+		utils.Fatalf("Invalid checkpoint oracle address %q", addr)
+	}
+	address := common.HexToAddress(addr)
+	contract, err := checkpointoracle.NewCheckpointOracle(address, ethclient.NewClient(client))
+	if err != nil {
+		utils.Fatalf("Failed to setup registrar contract %s: %v", address, err)
+	}
+	return address, contract
+}
+
+// getCheckpoint retrieves the specified checkpoint or the latest one from the
+// local indexers of the remote node.
+func getCheckpoint(ctx *cli.Context, client *rpc.Client) *les.CheckpointInfo {
+	index := ctx.Int64(indexFlag.Name)
+	if index < 0 {
+		var info struct {
+			Protocols struct {
+				Les *les.NodeInfo `json:"les"`
+			} `json:"protocols"`
+		}
+		if err := client.Call(&info, "admin_nodeInfo"); err != nil {
+			utils.Fatalf("Failed to retrieve node info: %v", err)
+		}
+		if info.Protocols.Les == nil || info.Protocols.Les.CHT.SectionHead == (common.Hash{}) {
+			utils.Fatalf("No checkpoint available on the remote node")
+		}
+		index = int64(info.Protocols.Les.CHT.SectionIndex)
+	}
+	var checkpoint les.CheckpointInfo
+	if err := client.Call(&checkpoint, "les_getCheckpoint", hexutil.Uint64(index)); err != nil {
+		utils.Fatalf("Failed to retrieve checkpoint %d: %v", index, err)
+	}
+	return &checkpoint
+}
+
+// getPassphrase obtains a passphrase given by the user. It first checks the
+// --passwordfile command line flag and ultimately prompts the user for a
+// passphrase.
+func getPassphrase(ctx *cli.Context) string {
+	passphraseFile := ctx.String(passphraseFlag.Name)
+	if passphraseFile != "" {
+		content, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			utils.Fatalf("Failed to read passphrase file '%s': %v", passphraseFile, err)
+		}
+		return strings.TrimRight(string(content), "\r\n")
+	}
+	passphrase, err := console.Stdin.PromptPassword("Passphrase: ")
+	if err != nil {
+		utils.Fatalf("Failed to read passphrase: %v", err)
+	}
+	return passphrase
+}
+
+// getKey loads and decrypts the private key specified with the --keyfile flag.
+func getKey(ctx *cli.Context) *keystore.Key {
+	keyfile := ctx.String(keyfileFlag.Name)
+	if keyfile == "" {
+		utils.Fatalf("Key file not specified")
+	}
+	keyjson, err := ioutil.ReadFile(keyfile)
+	if err != nil {
+		utils.Fatalf("Failed to read the keyfile at '%s': %v", keyfile, err)
+	}
+	key, err := keystore.DecryptKey(keyjson, getPassphrase(ctx))
+	if err != nil {
+		utils.Fatalf("Failed to decrypt key: %v", err)
+	}
+	return key
+}
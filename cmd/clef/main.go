@@ -34,6 +34,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
@@ -48,10 +49,10 @@ import (
 )
 
 // ExternalAPIVersion -- see extapi_changelog.md
-const ExternalAPIVersion = "2.0.0"
+const ExternalAPIVersion = "2.2.0"
 
 // InternalAPIVersion -- see intapi_changelog.md
-const InternalAPIVersion = "2.0.0"
+const InternalAPIVersion = "2.2.0"
 
 const legalWarning = `
 WARNING! 
@@ -166,6 +167,23 @@ The addpw command stores a password for a given address (keyfile). If you invoke
 remove any stored credential for that address (keyfile)
 `,
 	}
+
+	replayCommand = cli.Command{
+		Action:    utils.MigrateFlags(replayAuditLog),
+		Name:      "replay",
+		Usage:     "Evaluate a ruleset against the requests of an audit log",
+		ArgsUsage: "",
+		Flags: []cli.Flag{
+			logLevelFlag,
+			auditLogFlag,
+			ruleFlag,
+		},
+		Description: `
+The replay command evaluates the signing requests recorded in an audit log against a ruleset,
+to check a new policy before deploying it. For every request, the outcome recorded in the
+audit log is listed along with the verdict of the ruleset. Value budgets are simulated from
+the start of the audit log, and no credentials are needed.`,
+	}
 )
 
 func init() {
@@ -193,7 +211,7 @@ func init() {
 		testFlag,
 	}
 	app.Action = signer
-	app.Commands = []cli.Command{initCommand, attestCommand, addCredentialCommand}
+	app.Commands = []cli.Command{initCommand, attestCommand, addCredentialCommand, replayCommand}
 
 }
 func main() {
@@ -266,6 +284,39 @@ func attestFile(ctx *cli.Context) error {
 	return nil
 }
 
+func replayAuditLog(ctx *cli.Context) error {
+	// Replaying is offline and touches no keys, skip the confirmation flow
+	log.Root().SetHandler(log.LvlFilterHandler(log.Lvl(ctx.Int(logLevelFlag.Name)), log.StreamHandler(os.Stderr, log.TerminalFormat(true))))
+
+	ruleJS, err := ioutil.ReadFile(ctx.String(ruleFlag.Name))
+	if err != nil {
+		utils.Fatalf("Could not read rules: %v", err)
+	}
+	auditlog, err := os.Open(ctx.String(auditLogFlag.Name))
+	if err != nil {
+		utils.Fatalf("Could not open audit log: %v", err)
+	}
+	defer auditlog.Close()
+
+	results, err := rules.Replay(auditlog, string(ruleJS))
+	if err != nil {
+		utils.Fatalf("Replay failed: %v", err)
+	}
+	verdicts := make(map[string]int)
+	changed := 0
+	for _, res := range results {
+		marker := " "
+		if (res.Verdict == rules.VerdictApprove) != (res.Original == "signed") && res.Verdict != rules.VerdictManual {
+			marker, changed = "*", changed+1
+		}
+		fmt.Printf("%s %s %-15s %-8s %-20s %s\n", marker, res.Time.Format(time.RFC3339), res.Method, res.Verdict, res.Original, res.Request)
+		verdicts[res.Verdict]++
+	}
+	fmt.Printf("\nReplayed %d requests: %d approved, %d rejected, %d manual, %d changed (*)\n",
+		len(results), verdicts[rules.VerdictApprove], verdicts[rules.VerdictReject], verdicts[rules.VerdictManual], changed)
+	return nil
+}
+
 func addCredential(ctx *cli.Context) error {
 	if len(ctx.Args()) < 1 {
 		utils.Fatalf("This command requires at leaste one argument.")
@@ -415,7 +466,7 @@ func signer(c *cli.Context) error {
 
 		// start http server
 		httpEndpoint := fmt.Sprintf("%s:%d", c.String(utils.RPCListenAddrFlag.Name), c.Int(rpcPortFlag.Name))
-		listener, _, err := rpc.StartHTTPEndpoint(httpEndpoint, rpcAPI, []string{"account"}, cors, vhosts, rpc.DefaultHTTPTimeouts)
+		listener, _, err := rpc.StartHTTPEndpoint(httpEndpoint, rpcAPI, []string{"account"}, cors, vhosts, rpc.DefaultHTTPTimeouts, nil)
 		if err != nil {
 			utils.Fatalf("Could not start RPC api: %v", err)
 		}
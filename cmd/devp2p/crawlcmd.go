@@ -0,0 +1,158 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandCrawl = cli.Command{
+	Name:      "crawl",
+	Usage:     "Crawl the network for node records using ENR discovery",
+	ArgsUsage: "<nodes.json>",
+	Description: `
+Runs random lookups through the ENR based discovery protocol and stores the
+signed records of all nodes found in the given file. Records already contained
+in the file are kept unless a newer version is found.`,
+	Flags: []cli.Flag{
+		bootnodesFlag,
+		listenAddrFlag,
+		timeoutFlag,
+	},
+	Action: crawl,
+}
+
+const (
+	minLookupDelay = time.Second      // Minimum time between the starts of two lookups
+	maxLookupDelay = 30 * time.Second // Maximum time between lookups while none find nodes
+)
+
+var (
+	bootnodesFlag = cli.StringFlag{
+		Name:  "bootnodes",
+		Usage: "Comma separated nodes running ENR discovery used for bootstrapping",
+	}
+	listenAddrFlag = cli.StringFlag{
+		Name:  "addr",
+		Value: ":0",
+		Usage: "UDP listening address of the crawler",
+	}
+	timeoutFlag = cli.DurationFlag{
+		Name:  "timeout",
+		Value: 30 * time.Minute,
+		Usage: "Time after which the crawl stops",
+	}
+)
+
+// crawl runs random lookups until the timeout expires, collecting node records.
+func crawl(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return fmt.Errorf("need nodes file as argument")
+	}
+	file := ctx.Args().First()
+
+	nodes := make(nodeSet)
+	if _, err := os.Stat(file); err == nil {
+		nodes = loadNodesJSON(file)
+	}
+	disc := startDiscovery(ctx)
+	defer disc.Close()
+
+	var (
+		deadline = time.Now().Add(ctx.Duration(timeoutFlag.Name))
+		save     = time.NewTicker(time.Minute)
+		delay    = minLookupDelay
+	)
+	defer save.Stop()
+
+	for time.Now().Before(deadline) {
+		var target discover.NodeID
+		rand.Read(target[:])
+
+		start := time.Now()
+		found := disc.Lookup(target)
+		nodes.add(found...)
+
+		select {
+		case <-save.C:
+			writeNodesJSON(file, nodes)
+			fmt.Printf("Crawled %d nodes\n", len(nodes))
+		default:
+		}
+		// Lookups return immediately if the table is empty, e.g. while none of
+		// the bootnodes respond. Pace them and back off until nodes are found.
+		if len(found) == 0 {
+			if delay *= 2; delay > maxLookupDelay {
+				delay = maxLookupDelay
+			}
+		} else {
+			delay = minLookupDelay
+		}
+		if wait := delay - time.Since(start); wait > 0 {
+			time.Sleep(wait)
+		}
+	}
+	writeNodesJSON(file, nodes)
+	fmt.Printf("Crawled %d nodes\n", len(nodes))
+	return nil
+}
+
+// startDiscovery starts the ENR based discovery protocol with a random key. The
+// bootnodes need to be given explicitly, as the default bootnodes of the public
+// networks don't run ENR discovery.
+func startDiscovery(ctx *cli.Context) *discover.UDPv5 {
+	if !ctx.IsSet(bootnodesFlag.Name) {
+		utils.Fatalf("Missing bootnodes, use --%s", bootnodesFlag.Name)
+	}
+	var cfg discover.Config
+	for _, url := range strings.Split(ctx.String(bootnodesFlag.Name), ",") {
+		n, err := discover.ParseNode(url)
+		if err != nil {
+			utils.Fatalf("Invalid bootnode %q: %v", url, err)
+		}
+		cfg.Bootnodes = append(cfg.Bootnodes, n)
+	}
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		utils.Fatalf("Failed to generate key: %v", err)
+	}
+	cfg.PrivateKey = key
+
+	addr, err := net.ResolveUDPAddr("udp", ctx.String(listenAddrFlag.Name))
+	if err != nil {
+		utils.Fatalf("Invalid listening address: %v", err)
+	}
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		utils.Fatalf("Failed to listen: %v", err)
+	}
+	disc, err := discover.ListenV5(conn, discover.NewLocalNode(key), cfg)
+	if err != nil {
+		utils.Fatalf("Failed to start discovery: %v", err)
+	}
+	return disc
+}
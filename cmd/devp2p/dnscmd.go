@@ -0,0 +1,176 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"gopkg.in/urfave/cli.v1"
+)
+
+var commandDNS = cli.Command{
+	Name:  "dns",
+	Usage: "Create, sign and verify node lists published in DNS",
+	Subcommands: []cli.Command{
+		commandDNSSign,
+		commandDNSSync,
+	},
+}
+
+var commandDNSSign = cli.Command{
+	Name:      "sign",
+	Usage:     "Sign a node list tree",
+	ArgsUsage: "<tree-directory> <key-file>",
+	Description: `
+Builds the node list tree from the nodes.json and enrtree-info.json files of the
+tree directory and signs it with the secp256k1 key in the given file. The TXT
+records to publish are written to TXT.json in the tree directory and the URL of
+the tree is printed.`,
+	Flags: []cli.Flag{
+		domainFlag,
+		seqFlag,
+	},
+	Action: dnsSign,
+}
+
+var commandDNSSync = cli.Command{
+	Name:      "sync",
+	Usage:     "Download and verify a node list tree",
+	ArgsUsage: "<url> [<tree-directory>]",
+	Description: `
+Resolves the tree at the given enrtree:// URL, verifying its signature and the
+hashes of all entries. If a tree directory is given, the tree is stored there in
+the format used by the sign command.`,
+	Flags: []cli.Flag{
+		timeoutFlag,
+	},
+	Action: dnsSync,
+}
+
+var (
+	domainFlag = cli.StringFlag{
+		Name:  "domain",
+		Usage: "Domain name of the tree (overrides the one in enrtree-info.json)",
+	}
+	seqFlag = cli.UintFlag{
+		Name:  "seq",
+		Usage: "Sequence number of the tree (overrides the one in enrtree-info.json)",
+	}
+)
+
+const (
+	nodesFile    = "nodes.json"
+	treeInfoFile = "enrtree-info.json"
+	txtFile      = "TXT.json"
+)
+
+// treeInfo is the content of the enrtree-info.json file of a tree directory.
+type treeInfo struct {
+	Domain    string   `json:"domain,omitempty"`
+	Seq       uint     `json:"seq,omitempty"`
+	Links     []string `json:"links,omitempty"`
+	Signature string   `json:"signature,omitempty"`
+}
+
+// dnsSign builds and signs the tree of a tree directory.
+func dnsSign(ctx *cli.Context) error {
+	if ctx.NArg() != 2 {
+		return fmt.Errorf("need tree directory and key file as arguments")
+	}
+	var (
+		dir     = ctx.Args().Get(0)
+		keyfile = ctx.Args().Get(1)
+		info    treeInfo
+	)
+	if err := loadJSON(filepath.Join(dir, treeInfoFile), &info); err != nil && !os.IsNotExist(err) {
+		utils.Fatalf("Failed to load tree info: %v", err)
+	}
+	if ctx.IsSet(domainFlag.Name) {
+		info.Domain = ctx.String(domainFlag.Name)
+	}
+	if ctx.IsSet(seqFlag.Name) {
+		info.Seq = ctx.Uint(seqFlag.Name)
+	}
+	if info.Domain == "" {
+		utils.Fatalf("Tree domain not specified")
+	}
+	key, err := crypto.LoadECDSA(keyfile)
+	if err != nil {
+		utils.Fatalf("Failed to load key: %v", err)
+	}
+	nodes := loadNodesJSON(filepath.Join(dir, nodesFile))
+	tree, err := dnsdisc.MakeTree(info.Seq, nodes.nodes(), info.Links)
+	if err != nil {
+		utils.Fatalf("Failed to create tree: %v", err)
+	}
+	url, err := tree.Sign(key, info.Domain)
+	if err != nil {
+		utils.Fatalf("Failed to sign tree: %v", err)
+	}
+	info.Signature = tree.Signature()
+	if err := writeJSON(filepath.Join(dir, treeInfoFile), &info); err != nil {
+		utils.Fatalf("Failed to write tree info: %v", err)
+	}
+	if err := writeJSON(filepath.Join(dir, txtFile), tree.ToTXT(info.Domain)); err != nil {
+		utils.Fatalf("Failed to write TXT records: %v", err)
+	}
+	fmt.Println(url)
+	return nil
+}
+
+// dnsSync downloads a tree and optionally stores it in a tree directory.
+func dnsSync(ctx *cli.Context) error {
+	if ctx.NArg() < 1 {
+		return fmt.Errorf("need tree URL as argument")
+	}
+	url := ctx.Args().Get(0)
+
+	client := dnsdisc.NewClient(dnsdisc.Config{Timeout: ctx.Duration(timeoutFlag.Name)})
+	start := time.Now()
+	tree, err := client.SyncTree(url)
+	if err != nil {
+		utils.Fatalf("Failed to sync tree: %v", err)
+	}
+	fmt.Printf("Synced tree %s (seq %d, %d nodes, %d links) in %v\n", url, tree.Seq(), len(tree.Nodes()), len(tree.Links()), time.Since(start))
+
+	if dir := ctx.Args().Get(1); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			utils.Fatalf("Failed to create tree directory: %v", err)
+		}
+		nodes := make(nodeSet)
+		nodes.add(tree.Nodes()...)
+		writeNodesJSON(filepath.Join(dir, nodesFile), nodes)
+
+		info := treeInfo{
+			Domain:    url[strings.LastIndex(url, "@")+1:],
+			Seq:       tree.Seq(),
+			Links:     tree.Links(),
+			Signature: tree.Signature(),
+		}
+		if err := writeJSON(filepath.Join(dir, treeInfoFile), &info); err != nil {
+			utils.Fatalf("Failed to write tree info: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+// devp2p is a utility for crawling the p2p network and for creating, signing
+// and verifying node lists published in DNS.
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+	"gopkg.in/urfave/cli.v1"
+)
+
+// Git SHA1 commit hash of the release (set via linker flags)
+var gitCommit = ""
+
+var app *cli.App
+
+func init() {
+	app = utils.NewApp(gitCommit, "go-ethereum devp2p tool")
+	app.Commands = []cli.Command{
+		commandCrawl,
+		commandDNS,
+	}
+}
+
+func main() {
+	if err := app.Run(os.Args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// nodeSet is the content of a nodes.json file, the signed records of nodes
+// keyed by node ID.
+type nodeSet map[discover.NodeID]nodeJSON
+
+type nodeJSON struct {
+	Record   string    `json:"record"`
+	LastSeen time.Time `json:"lastSeen,omitempty"`
+}
+
+// loadNodesJSON reads a node set from the given file.
+func loadNodesJSON(file string) nodeSet {
+	var nodes nodeSet
+	if err := loadJSON(file, &nodes); err != nil {
+		utils.Fatalf("Failed to load node set: %v", err)
+	}
+	return nodes
+}
+
+// writeNodesJSON writes a node set to the given file.
+func writeNodesJSON(file string, nodes nodeSet) {
+	if err := writeJSON(file, nodes); err != nil {
+		utils.Fatalf("Failed to write node set: %v", err)
+	}
+}
+
+// add inserts or updates the given nodes in the set.
+func (ns nodeSet) add(nodes ...*discover.Node) {
+	for _, n := range nodes {
+		if n.Record == nil {
+			continue
+		}
+		if old, ok := ns[n.ID]; ok {
+			if r, err := decodeRecord(old.Record); err == nil && r.Seq() > n.Record.Seq() {
+				continue
+			}
+		}
+		ns[n.ID] = nodeJSON{Record: encodeRecord(n.Record), LastSeen: time.Now().UTC()}
+	}
+}
+
+// nodes returns the nodes of the set, sorted by ID.
+func (ns nodeSet) nodes() []*discover.Node {
+	result := make([]*discover.Node, 0, len(ns))
+	for id, n := range ns {
+		r, err := decodeRecord(n.Record)
+		if err != nil {
+			utils.Fatalf("Invalid record of node %x: %v", id[:8], err)
+		}
+		node, err := discover.NodeFromRecord(r)
+		if err != nil {
+			utils.Fatalf("Invalid record of node %x: %v", id[:8], err)
+		}
+		result = append(result, node)
+	}
+	sort.Slice(result, func(i, j int) bool { return bytes.Compare(result[i].ID[:], result[j].ID[:]) < 0 })
+	return result
+}
+
+// encodeRecord returns the text form of a record, "enr:" followed by the
+// URL-safe base64 encoding of its RLP representation.
+func encodeRecord(r *enr.Record) string {
+	blob, err := rlp.EncodeToBytes(r)
+	if err != nil {
+		utils.Fatalf("Failed to encode record: %v", err)
+	}
+	return "enr:" + base64.RawURLEncoding.EncodeToString(blob)
+}
+
+// decodeRecord parses the text form of a record.
+func decodeRecord(s string) (*enr.Record, error) {
+	if !strings.HasPrefix(s, "enr:") {
+		return nil, fmt.Errorf("missing 'enr:' prefix")
+	}
+	blob, err := base64.RawURLEncoding.DecodeString(s[4:])
+	if err != nil {
+		return nil, err
+	}
+	var r enr.Record
+	if err := rlp.DecodeBytes(blob, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// loadJSON decodes the JSON content of file into v.
+func loadJSON(file string, v interface{}) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// writeJSON writes v as indented JSON to file, or to stdout if file is "-".
+func writeJSON(file string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if file == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return ioutil.WriteFile(file, data, 0644)
+}
@@ -41,6 +41,8 @@ func init() {
 		commandChangePassphrase,
 		commandSignMessage,
 		commandVerifyMessage,
+		commandMnemonic,
+		commandDerive,
 	}
 }
 
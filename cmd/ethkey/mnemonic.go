@@ -0,0 +1,152 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/hdwallet"
+	"github.com/ethereum/go-ethereum/cmd/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"gopkg.in/urfave/cli.v1"
+)
+
+type outputMnemonic struct {
+	Mnemonic string
+	Address  string
+}
+
+type outputDerive struct {
+	Path       string
+	Address    string
+	PrivateKey string
+}
+
+var commandMnemonic = cli.Command{
+	Name:  "mnemonic",
+	Usage: "generate a new BIP-39 mnemonic",
+	Description: `
+Generate a new random BIP-39 mnemonic and print it, along with the first
+account on the default derivation path.
+
+The mnemonic can be imported into geth with 'geth account importmnemonic'.
+Write it down and keep it safe, anyone knowing it controls the accounts.`,
+	Flags: []cli.Flag{
+		jsonFlag,
+		cli.IntFlag{
+			Name:  "bits",
+			Usage: "bits of entropy, between 128 (12 words) and 256 (24 words)",
+			Value: 256,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		mnemonic, err := hdwallet.NewMnemonic(ctx.Int("bits"))
+		if err != nil {
+			utils.Fatalf("Failed to generate mnemonic: %v", err)
+		}
+		seed, err := hdwallet.NewSeed(mnemonic, "")
+		if err != nil {
+			utils.Fatalf("Failed to create seed: %v", err)
+		}
+		key, err := hdwallet.DeriveKey(seed, accounts.DefaultBaseDerivationPath)
+		if err != nil {
+			utils.Fatalf("Failed to derive account: %v", err)
+		}
+		out := outputMnemonic{
+			Mnemonic: mnemonic,
+			Address:  crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		}
+		if ctx.Bool(jsonFlag.Name) {
+			mustPrintJSON(out)
+		} else {
+			fmt.Println("Mnemonic:      ", out.Mnemonic)
+			fmt.Println("Address:       ", out.Address)
+		}
+		return nil
+	},
+}
+
+var commandDerive = cli.Command{
+	Name:      "derive",
+	Usage:     "derive an account from a BIP-39 mnemonic",
+	ArgsUsage: "<mnemonicfile>",
+	Description: `
+Derive the account at a BIP-32 derivation path from the mnemonic in the file.
+
+The optional BIP-39 passphrase of the mnemonic is read from the file given by
+--passwordfile, or prompted for otherwise. Private key information can be
+printed by using the --private flag; make sure to use this feature with great
+caution!`,
+	Flags: []cli.Flag{
+		passphraseFlag,
+		jsonFlag,
+		cli.StringFlag{
+			Name:  "path",
+			Usage: "BIP-32 derivation path of the account",
+			Value: accounts.DefaultBaseDerivationPath.String(),
+		},
+		cli.BoolFlag{
+			Name:  "private",
+			Usage: "include the private key in the output",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		mnemonicfile := ctx.Args().First()
+		if mnemonicfile == "" {
+			utils.Fatalf("No mnemonic file specified.")
+		}
+		content, err := ioutil.ReadFile(mnemonicfile)
+		if err != nil {
+			utils.Fatalf("Failed to read the mnemonic at '%s': %v", mnemonicfile, err)
+		}
+		path, err := accounts.ParseDerivationPath(ctx.String("path"))
+		if err != nil {
+			utils.Fatalf("Invalid derivation path: %v", err)
+		}
+		seed, err := hdwallet.NewSeed(strings.TrimSpace(string(content)), getPassphrase(ctx))
+		if err != nil {
+			utils.Fatalf("Invalid mnemonic: %v", err)
+		}
+		key, err := hdwallet.DeriveKey(seed, path)
+		if err != nil {
+			utils.Fatalf("Failed to derive account: %v", err)
+		}
+		// Output all relevant information we can retrieve.
+		showPrivate := ctx.Bool("private")
+		out := outputDerive{
+			Path:    path.String(),
+			Address: crypto.PubkeyToAddress(key.PublicKey).Hex(),
+		}
+		if showPrivate {
+			out.PrivateKey = hex.EncodeToString(crypto.FromECDSA(key))
+		}
+		if ctx.Bool(jsonFlag.Name) {
+			mustPrintJSON(out)
+		} else {
+			fmt.Println("Path:          ", out.Path)
+			fmt.Println("Address:       ", out.Address)
+			if showPrivate {
+				fmt.Println("Private key:   ", out.PrivateKey)
+			}
+		}
+		return nil
+	},
+}
@@ -19,8 +19,10 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/accounts/hdwallet"
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/console"
@@ -186,6 +188,56 @@ Note:
 As you can directly copy your encrypted accounts to another ethereum instance,
 this import mechanism is not needed when you transfer an account between
 nodes.
+`,
+			},
+			{
+				Name:   "importmnemonic",
+				Usage:  "Import a BIP-39 mnemonic into a new HD wallet",
+				Action: utils.MigrateFlags(accountImportMnemonic),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.PasswordFileFlag,
+					utils.LightKDFFlag,
+				},
+				ArgsUsage: "<mnemonicFile>",
+				Description: `
+    geth account importmnemonic <mnemonicfile>
+
+Imports the BIP-39 mnemonic from <mnemonicfile> into a new HD wallet and prints
+the address of its first account, derived along m/44'/60'/0'/0/0.
+
+You are prompted for the optional passphrase of the mnemonic, and for a password
+to encrypt the seed with. The encrypted seed is saved under <KEYSTORE>/hd.
+
+Further accounts are discovered automatically once the wallet is opened, based
+on the chain state, or can be pinned with 'geth account derive'.
+
+For non-interactive use the password can be specified with the --password flag,
+the mnemonic is then assumed to have no passphrase.
+`,
+			},
+			{
+				Name:   "derive",
+				Usage:  "Pin the account at a derivation path into an HD wallet",
+				Action: utils.MigrateFlags(accountDerive),
+				Flags: []cli.Flag{
+					utils.DataDirFlag,
+					utils.KeyStoreDirFlag,
+					utils.PasswordFileFlag,
+				},
+				ArgsUsage: "<walletURL> <path>",
+				Description: `
+    geth account derive <walletURL> <path>
+
+Derives the account at the BIP-32 derivation path from the seed of the HD wallet
+and pins it, so it is listed and usable without self-derivation. The wallet URL
+is printed on import, and is the part of the account URLs listed by 'geth account
+list' preceding the derivation path, e.g.
+
+    geth account derive hd:///path/to/keystore/hd/UTC--... "m/44'/60'/0'/0/5"
+
+You are prompted for the password of the wallet, unless given with --password.
 `,
 			},
 		},
@@ -377,3 +429,74 @@ func accountImport(ctx *cli.Context) error {
 	fmt.Printf("Address: {%x}\n", acct.Address)
 	return nil
 }
+
+// accountImportMnemonic imports a BIP-39 mnemonic into a new HD wallet.
+func accountImportMnemonic(ctx *cli.Context) error {
+	mnemonicfile := ctx.Args().First()
+	if len(mnemonicfile) == 0 {
+		utils.Fatalf("mnemonic file must be given as argument")
+	}
+	content, err := ioutil.ReadFile(mnemonicfile)
+	if err != nil {
+		utils.Fatalf("Failed to read the mnemonic: %v", err)
+	}
+	mnemonic := strings.TrimSpace(string(content))
+	if err := hdwallet.ValidateMnemonic(mnemonic); err != nil {
+		utils.Fatalf("Invalid mnemonic: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+
+	// Prompt for the mnemonic passphrase, unless used non-interactively
+	var passphrase string
+	passwords := utils.MakePasswordList(ctx)
+	if len(passwords) == 0 {
+		fmt.Println("Enter the passphrase of the mnemonic, if it has any.")
+		if passphrase, err = console.Stdin.PromptPassword("Mnemonic passphrase: "); err != nil {
+			utils.Fatalf("Failed to read mnemonic passphrase: %v", err)
+		}
+	}
+	password := getPassPhrase("Your new wallet is locked with a password. Please give a password. Do not forget this password.", true, 0, passwords)
+
+	store := stack.AccountManager().Backends(hdwallet.StoreType)[0].(*hdwallet.Store)
+	acct, err := store.Import(mnemonic, passphrase, password)
+	if err != nil {
+		utils.Fatalf("Could not import the mnemonic: %v", err)
+	}
+	fmt.Printf("Address: {%x}\n", acct.Address)
+	for _, wallet := range store.Wallets() {
+		if wallet.Contains(acct) {
+			url := wallet.URL()
+			fmt.Printf("Wallet:  %s\n", &url)
+		}
+	}
+	return nil
+}
+
+// accountDerive pins the account at a derivation path into an HD wallet.
+func accountDerive(ctx *cli.Context) error {
+	if len(ctx.Args()) != 2 {
+		utils.Fatalf("wallet URL and derivation path must be given as arguments")
+	}
+	path, err := accounts.ParseDerivationPath(ctx.Args()[1])
+	if err != nil {
+		utils.Fatalf("Invalid derivation path: %v", err)
+	}
+	stack, _ := makeConfigNode(ctx)
+
+	wallet, err := stack.AccountManager().Wallet(ctx.Args()[0])
+	if err != nil {
+		utils.Fatalf("Could not find the wallet: %v", err)
+	}
+	password := getPassPhrase("Please give the password of the wallet.", false, 0, utils.MakePasswordList(ctx))
+	if err := wallet.Open(password); err != nil {
+		utils.Fatalf("Could not open the wallet: %v", err)
+	}
+	defer wallet.Close()
+
+	acct, err := wallet.Derive(path, true)
+	if err != nil {
+		utils.Fatalf("Could not derive the account: %v", err)
+	}
+	fmt.Printf("Address: {%x}\n", acct.Address)
+	return nil
+}
@@ -171,6 +171,9 @@ func makeFullNode(ctx *cli.Context) *node.Node {
 		if ctx.GlobalIsSet(utils.WhisperRestrictConnectionBetweenLightClientsFlag.Name) {
 			cfg.Shh.RestrictConnectionBetweenLightClients = true
 		}
+		if ctx.GlobalIsSet(utils.WhisperLightClientBandwidthFlag.Name) {
+			cfg.Shh.LightClientBandwidth = uint32(ctx.GlobalUint(utils.WhisperLightClientBandwidthFlag.Name))
+		}
 		utils.RegisterShhService(stack, &cfg.Shh)
 	}
 
@@ -59,27 +59,29 @@ var (
 
 //constants for environment variables
 const (
-	SWARM_ENV_CHEQUEBOOK_ADDR      = "SWARM_CHEQUEBOOK_ADDR"
-	SWARM_ENV_ACCOUNT              = "SWARM_ACCOUNT"
-	SWARM_ENV_LISTEN_ADDR          = "SWARM_LISTEN_ADDR"
-	SWARM_ENV_PORT                 = "SWARM_PORT"
-	SWARM_ENV_NETWORK_ID           = "SWARM_NETWORK_ID"
-	SWARM_ENV_SWAP_ENABLE          = "SWARM_SWAP_ENABLE"
-	SWARM_ENV_SWAP_API             = "SWARM_SWAP_API"
-	SWARM_ENV_SYNC_DISABLE         = "SWARM_SYNC_DISABLE"
-	SWARM_ENV_SYNC_UPDATE_DELAY    = "SWARM_ENV_SYNC_UPDATE_DELAY"
-	SWARM_ENV_LIGHT_NODE_ENABLE    = "SWARM_LIGHT_NODE_ENABLE"
-	SWARM_ENV_DELIVERY_SKIP_CHECK  = "SWARM_DELIVERY_SKIP_CHECK"
-	SWARM_ENV_ENS_API              = "SWARM_ENS_API"
-	SWARM_ENV_ENS_ADDR             = "SWARM_ENS_ADDR"
-	SWARM_ENV_CORS                 = "SWARM_CORS"
-	SWARM_ENV_BOOTNODES            = "SWARM_BOOTNODES"
-	SWARM_ENV_PSS_ENABLE           = "SWARM_PSS_ENABLE"
-	SWARM_ENV_STORE_PATH           = "SWARM_STORE_PATH"
-	SWARM_ENV_STORE_CAPACITY       = "SWARM_STORE_CAPACITY"
-	SWARM_ENV_STORE_CACHE_CAPACITY = "SWARM_STORE_CACHE_CAPACITY"
-	SWARM_ACCESS_PASSWORD          = "SWARM_ACCESS_PASSWORD"
-	GETH_ENV_DATADIR               = "GETH_DATADIR"
+	SWARM_ENV_CHEQUEBOOK_ADDR           = "SWARM_CHEQUEBOOK_ADDR"
+	SWARM_ENV_ACCOUNT                   = "SWARM_ACCOUNT"
+	SWARM_ENV_LISTEN_ADDR               = "SWARM_LISTEN_ADDR"
+	SWARM_ENV_PORT                      = "SWARM_PORT"
+	SWARM_ENV_NETWORK_ID                = "SWARM_NETWORK_ID"
+	SWARM_ENV_SWAP_ENABLE               = "SWARM_SWAP_ENABLE"
+	SWARM_ENV_SWAP_API                  = "SWARM_SWAP_API"
+	SWARM_ENV_SWAP_PAYMENT_THRESHOLD    = "SWARM_SWAP_PAYMENT_THRESHOLD"
+	SWARM_ENV_SWAP_DISCONNECT_THRESHOLD = "SWARM_SWAP_DISCONNECT_THRESHOLD"
+	SWARM_ENV_SYNC_DISABLE              = "SWARM_SYNC_DISABLE"
+	SWARM_ENV_SYNC_UPDATE_DELAY         = "SWARM_ENV_SYNC_UPDATE_DELAY"
+	SWARM_ENV_LIGHT_NODE_ENABLE         = "SWARM_LIGHT_NODE_ENABLE"
+	SWARM_ENV_DELIVERY_SKIP_CHECK       = "SWARM_DELIVERY_SKIP_CHECK"
+	SWARM_ENV_ENS_API                   = "SWARM_ENS_API"
+	SWARM_ENV_ENS_ADDR                  = "SWARM_ENS_ADDR"
+	SWARM_ENV_CORS                      = "SWARM_CORS"
+	SWARM_ENV_BOOTNODES                 = "SWARM_BOOTNODES"
+	SWARM_ENV_PSS_ENABLE                = "SWARM_PSS_ENABLE"
+	SWARM_ENV_STORE_PATH                = "SWARM_STORE_PATH"
+	SWARM_ENV_STORE_CAPACITY            = "SWARM_STORE_CAPACITY"
+	SWARM_ENV_STORE_CACHE_CAPACITY      = "SWARM_STORE_CACHE_CAPACITY"
+	SWARM_ACCESS_PASSWORD               = "SWARM_ACCESS_PASSWORD"
+	GETH_ENV_DATADIR                    = "GETH_DATADIR"
 )
 
 // These settings ensure that TOML keys use the same names as Go struct fields.
@@ -215,6 +217,14 @@ func cmdLineOverride(currentConfig *bzzapi.Config, ctx *cli.Context) *bzzapi.Con
 		currentConfig.DeliverySkipCheck = true
 	}
 
+	if threshold := ctx.GlobalInt64(SwarmSwapPaymentThresholdFlag.Name); threshold != 0 {
+		currentConfig.Swap.PaymentThreshold = threshold
+	}
+
+	if threshold := ctx.GlobalInt64(SwarmSwapDisconnectThresholdFlag.Name); threshold != 0 {
+		currentConfig.Swap.DisconnectThreshold = threshold
+	}
+
 	currentConfig.SwapAPI = ctx.GlobalString(SwarmSwapAPIFlag.Name)
 	if currentConfig.SwapEnabled && currentConfig.SwapAPI == "" {
 		utils.Fatalf(SWARM_ERR_SWAP_SET_NO_API)
@@ -314,6 +324,18 @@ func envVarsOverride(currentConfig *bzzapi.Config) (config *bzzapi.Config) {
 		currentConfig.SwapAPI = swapapi
 	}
 
+	if v := os.Getenv(SWARM_ENV_SWAP_PAYMENT_THRESHOLD); v != "" {
+		if threshold, err := strconv.ParseInt(v, 10, 64); err == nil && threshold != 0 {
+			currentConfig.Swap.PaymentThreshold = threshold
+		}
+	}
+
+	if v := os.Getenv(SWARM_ENV_SWAP_DISCONNECT_THRESHOLD); v != "" {
+		if threshold, err := strconv.ParseInt(v, 10, 64); err == nil && threshold != 0 {
+			currentConfig.Swap.DisconnectThreshold = threshold
+		}
+	}
+
 	if currentConfig.SwapEnabled && currentConfig.SwapAPI == "" {
 		utils.Fatalf(SWARM_ERR_SWAP_SET_NO_API)
 	}
@@ -359,6 +381,11 @@ func validateConfig(cfg *bzzapi.Config) (err error) {
 			}
 		}
 	}
+	if cfg.SwapEnabled && cfg.Swap != nil {
+		if err := cfg.Swap.Validate(); err != nil {
+			return fmt.Errorf("invalid SWAP thresholds: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -29,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/rpc"
 	"github.com/ethereum/go-ethereum/swarm"
 	"github.com/ethereum/go-ethereum/swarm/api"
+	"github.com/ethereum/go-ethereum/swarm/services/swap"
 
 	"github.com/docker/docker/pkg/reexec"
 )
@@ -90,6 +91,7 @@ func TestConfigCmdLineOverrides(t *testing.T) {
 		fmt.Sprintf("--%s", CorsStringFlag.Name), "*",
 		fmt.Sprintf("--%s", SwarmAccountFlag.Name), account.Address.String(),
 		fmt.Sprintf("--%s", SwarmDeliverySkipCheckFlag.Name),
+		fmt.Sprintf("--%s", SwarmSwapDisconnectThresholdFlag.Name), "2000000",
 		fmt.Sprintf("--%s", EnsAPIFlag.Name), "",
 		"--datadir", dir,
 		"--ipcpath", conf.IPCPath,
@@ -138,6 +140,10 @@ func TestConfigCmdLineOverrides(t *testing.T) {
 		t.Fatalf("Expected Cors flag to be set to %s, got %s", "*", info.Cors)
 	}
 
+	if info.Swap.DisconnectThreshold != 2000000 {
+		t.Fatalf("Expected SwapParams DisconnectThreshold to be %d, got %d", 2000000, info.Swap.DisconnectThreshold)
+	}
+
 	node.Shutdown()
 }
 
@@ -159,7 +165,7 @@ func TestConfigFileOverrides(t *testing.T) {
 	defaultConf.Port = httpPort
 	defaultConf.DbCapacity = 9000000
 	defaultConf.HiveParams.KeepAliveInterval = 6000000000
-	defaultConf.Swap.Params.Strategy.AutoCashInterval = 600 * time.Second
+	defaultConf.Swap.PaymentThreshold = 500000
 	//defaultConf.SyncParams.KeyBufferSize = 512
 	//create a TOML string
 	out, err := tomlSettings.Marshal(&defaultConf)
@@ -241,8 +247,8 @@ func TestConfigFileOverrides(t *testing.T) {
 		t.Fatalf("Expected HiveParams KeepAliveInterval to be %d, got %d", uint64(6000000000), uint64(info.HiveParams.KeepAliveInterval))
 	}
 
-	if info.Swap.Params.Strategy.AutoCashInterval != 600*time.Second {
-		t.Fatalf("Expected SwapParams AutoCashInterval to be %ds, got %d", 600, info.Swap.Params.Strategy.AutoCashInterval)
+	if info.Swap.PaymentThreshold != 500000 {
+		t.Fatalf("Expected SwapParams PaymentThreshold to be %d, got %d", 500000, info.Swap.PaymentThreshold)
 	}
 
 	//	if info.SyncParams.KeyBufferSize != 512 {
@@ -370,7 +376,7 @@ func TestConfigCmdLineOverridesFile(t *testing.T) {
 	defaultConf.Port = "8588"
 	defaultConf.DbCapacity = 9000000
 	defaultConf.HiveParams.KeepAliveInterval = 6000000000
-	defaultConf.Swap.Params.Strategy.AutoCashInterval = 600 * time.Second
+	defaultConf.Swap.PaymentThreshold = 500000
 	//defaultConf.SyncParams.KeyBufferSize = 512
 	//create a TOML file
 	out, err := tomlSettings.Marshal(&defaultConf)
@@ -455,8 +461,8 @@ func TestConfigCmdLineOverridesFile(t *testing.T) {
 		t.Fatalf("Expected HiveParams KeepAliveInterval to be %d, got %d", uint64(6000000000), uint64(info.HiveParams.KeepAliveInterval))
 	}
 
-	if info.Swap.Params.Strategy.AutoCashInterval != 600*time.Second {
-		t.Fatalf("Expected SwapParams AutoCashInterval to be %ds, got %d", 600, info.Swap.Params.Strategy.AutoCashInterval)
+	if info.Swap.PaymentThreshold != 500000 {
+		t.Fatalf("Expected SwapParams PaymentThreshold to be %d, got %d", 500000, info.Swap.PaymentThreshold)
 	}
 
 	//	if info.SyncParams.KeyBufferSize != 512 {
@@ -550,6 +556,28 @@ func TestValidateConfig(t *testing.T) {
 			}},
 			err: "invalid format [tld:][contract-addr@]url for ENS API endpoint configuration \"@/data/testnet/geth.ipc\": missing contract address",
 		},
+		{
+			cfg: &api.Config{SwapEnabled: true, Swap: &swap.Params{PaymentThreshold: 100, DisconnectThreshold: 150}},
+		},
+		{
+			cfg: &api.Config{SwapEnabled: false, Swap: &swap.Params{PaymentThreshold: 0, DisconnectThreshold: 150}},
+		},
+		{
+			cfg: &api.Config{SwapEnabled: true, Swap: &swap.Params{PaymentThreshold: 0, DisconnectThreshold: 150}},
+			err: "invalid SWAP thresholds: payment threshold must be positive",
+		},
+		{
+			cfg: &api.Config{SwapEnabled: true, Swap: &swap.Params{PaymentThreshold: -100, DisconnectThreshold: 150}},
+			err: "invalid SWAP thresholds: payment threshold must be positive",
+		},
+		{
+			cfg: &api.Config{SwapEnabled: true, Swap: &swap.Params{PaymentThreshold: 150, DisconnectThreshold: 150}},
+			err: "invalid SWAP thresholds: disconnect threshold must be above the payment threshold",
+		},
+		{
+			cfg: &api.Config{SwapEnabled: true, Swap: &swap.Params{PaymentThreshold: 200, DisconnectThreshold: 150}},
+			err: "invalid SWAP thresholds: disconnect threshold must be above the payment threshold",
+		},
 	} {
 		err := validateConfig(c.cfg)
 		if c.err != "" && err.Error() != c.err {
@@ -106,6 +106,16 @@ var (
 		Usage:  "URL of the Ethereum API provider to use to settle SWAP payments",
 		EnvVar: SWARM_ENV_SWAP_API,
 	}
+	SwarmSwapPaymentThresholdFlag = cli.Int64Flag{
+		Name:   "swap-payment-threshold",
+		Usage:  "SWAP debt to a peer above which it is paid with a cheque",
+		EnvVar: SWARM_ENV_SWAP_PAYMENT_THRESHOLD,
+	}
+	SwarmSwapDisconnectThresholdFlag = cli.Int64Flag{
+		Name:   "swap-disconnect-threshold",
+		Usage:  "SWAP balance with a peer above which it is disconnected",
+		EnvVar: SWARM_ENV_SWAP_DISCONNECT_THRESHOLD,
+	}
 	SwarmSyncDisabledFlag = cli.BoolTFlag{
 		Name:   "nosync",
 		Usage:  "Disable swarm syncing",
@@ -540,6 +550,8 @@ pv(1) tool to get a progress bar:
 		SwarmTomlConfigPathFlag,
 		SwarmSwapEnabledFlag,
 		SwarmSwapAPIFlag,
+		SwarmSwapPaymentThresholdFlag,
+		SwarmSwapDisconnectThresholdFlag,
 		SwarmSyncDisabledFlag,
 		SwarmSyncUpdateDelay,
 		SwarmLightNodeEnabled,
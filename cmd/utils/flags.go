@@ -32,7 +32,6 @@ import (
 	"github.com/ethereum/go-ethereum/accounts/keystore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/fdlimit"
-	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
 	"github.com/ethereum/go-ethereum/core"
@@ -56,6 +55,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 	"gopkg.in/urfave/cli.v1"
 )
@@ -127,6 +127,10 @@ var (
 		Name:  "nousb",
 		Usage: "Disables monitoring for and managing USB hardware wallets",
 	}
+	SignerPluginFlag = cli.StringFlag{
+		Name:  "signer-plugin",
+		Usage: "IPC path or URL of an external signer plugin managing accounts",
+	}
 	NetworkIdFlag = cli.Uint64Flag{
 		Name:  "networkid",
 		Usage: "Network identifier (integer, 1=Frontier, 2=Morden (disused), 3=Ropsten, 4=Rinkeby)",
@@ -168,6 +172,14 @@ var (
 		Usage: `Blockchain garbage collection mode ("full", "archive")`,
 		Value: "full",
 	}
+	CliqueCheckpointFlag = cli.StringFlag{
+		Name:  "clique.checkpoint",
+		Usage: "JSON file containing an attested clique signer set checkpoint to trust",
+	}
+	CliqueSignerFlag = cli.StringFlag{
+		Name:  "clique.signer",
+		Usage: "External signer (clef) IPC path or HTTP endpoint to seal clique blocks with",
+	}
 	LightServFlag = cli.IntFlag{
 		Name:  "lightserv",
 		Usage: "Maximum percentage of time allowed for serving LES requests (0-90)",
@@ -182,6 +194,15 @@ var (
 		Name:  "lightkdf",
 		Usage: "Reduce key-derivation RAM & CPU usage at some expense of KDF strength",
 	}
+	ULCTrustedServersFlag = cli.StringFlag{
+		Name:  "ulc.servers",
+		Usage: "Comma separated enode URLs of trusted LES servers (enables ultra-light client mode)",
+	}
+	ULCMinTrustedFractionFlag = cli.IntFlag{
+		Name:  "ulc.fraction",
+		Usage: "Minimum percentage of trusted servers announcing a head before ultra-light clients accept it",
+		Value: eth.DefaultULCMinTrustedFraction,
+	}
 	// Dashboard settings
 	DashboardEnabledFlag = cli.BoolFlag{
 		Name:  metrics.DashboardEnabledFlag,
@@ -437,6 +458,10 @@ var (
 		Usage: "API's offered over the HTTP-RPC interface",
 		Value: "",
 	}
+	RPCAccessFlag = cli.StringFlag{
+		Name:  "rpcaccess",
+		Usage: "JSON file with the method access, authentication and rate limit policy of the HTTP-RPC interface",
+	}
 	IPCDisabledFlag = cli.BoolFlag{
 		Name:  "ipcdisable",
 		Usage: "Disable the IPC-RPC server",
@@ -469,6 +494,10 @@ var (
 		Usage: "Origins from which to accept websockets requests",
 		Value: "",
 	}
+	WSAccessFlag = cli.StringFlag{
+		Name:  "wsaccess",
+		Usage: "JSON file with the method access, authentication and rate limit policy of the WS-RPC interface",
+	}
 	ExecFlag = cli.StringFlag{
 		Name:  "exec",
 		Usage: "Execute JavaScript statement",
@@ -530,6 +559,15 @@ var (
 		Name:  "v5disc",
 		Usage: "Enables the experimental RLPx V5 (Topic Discovery) mechanism",
 	}
+	DiscoveryENRFlag = cli.BoolFlag{
+		Name:  "enrdisc",
+		Usage: "Enables the ENR based discovery protocol alongside V4 discovery",
+	}
+	DNSNodeListsFlag = cli.StringFlag{
+		Name:  "dnsdisc",
+		Usage: "Comma separated enrtree:// URLs of DNS node lists used as dial candidates (also with --nodiscover)",
+		Value: "",
+	}
 	NetrestrictFlag = cli.StringFlag{
 		Name:  "netrestrict",
 		Usage: "Restricts network communication to the given IP networks (CIDR masks)",
@@ -553,6 +591,11 @@ var (
 		Usage: "Suggested gas price is the given percentile of a set of recent transaction gas prices",
 		Value: eth.DefaultConfig.GPO.Percentile,
 	}
+	GpoPendingBlocksFlag = cli.IntFlag{
+		Name:  "gpopending",
+		Usage: "Number of blocks worth of pending transactions at which the suggested gas price reaches the highest sampled one (0 = ignore pool)",
+		Value: eth.DefaultConfig.GPO.PendingBlocks,
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable Whisper",
@@ -571,6 +614,11 @@ var (
 		Name:  "shh.restrict-light",
 		Usage: "Restrict connection between two whisper light clients",
 	}
+	WhisperLightClientBandwidthFlag = cli.UintFlag{
+		Name:  "shh.lightbandwidth",
+		Usage: "Bytes per second relayed to each whisper light client (0 = unlimited)",
+		Value: uint(whisper.DefaultLightClientBandwidth),
+	}
 
 	// Metrics flags
 	MetricsEnabledFlag = cli.BoolFlag{
@@ -781,6 +829,13 @@ func setHTTP(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(RPCVirtualHostsFlag.Name) {
 		cfg.HTTPVirtualHosts = splitAndTrim(ctx.GlobalString(RPCVirtualHostsFlag.Name))
 	}
+	if file := ctx.GlobalString(RPCAccessFlag.Name); file != "" {
+		policy, err := rpc.LoadAccessPolicy(file)
+		if err != nil {
+			Fatalf("Failed to load HTTP-RPC access policy: %v", err)
+		}
+		cfg.HTTPAccess = policy
+	}
 }
 
 // setWS creates the WebSocket RPC listener interface string from the set
@@ -802,6 +857,13 @@ func setWS(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(WSApiFlag.Name) {
 		cfg.WSModules = splitAndTrim(ctx.GlobalString(WSApiFlag.Name))
 	}
+	if file := ctx.GlobalString(WSAccessFlag.Name); file != "" {
+		policy, err := rpc.LoadAccessPolicy(file)
+		if err != nil {
+			Fatalf("Failed to load WS-RPC access policy: %v", err)
+		}
+		cfg.WSAccess = policy
+	}
 }
 
 // setIPC creates an IPC path configuration from the set command line flags,
@@ -947,6 +1009,14 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 	} else if forceV5Discovery {
 		cfg.DiscoveryV5 = true
 	}
+	if ctx.GlobalIsSet(DiscoveryENRFlag.Name) {
+		cfg.DiscoveryENR = ctx.GlobalBool(DiscoveryENRFlag.Name)
+	}
+	// DNS node lists don't depend on discovery, keep them with --nodiscover and
+	// for light clients, which have discovery disabled above
+	if urls := ctx.GlobalString(DNSNodeListsFlag.Name); urls != "" {
+		cfg.DNSNodeLists = strings.Split(urls, ",")
+	}
 
 	if netrestrict := ctx.GlobalString(NetrestrictFlag.Name); netrestrict != "" {
 		list, err := netutil.ParseNetlist(netrestrict)
@@ -962,6 +1032,8 @@ func SetP2PConfig(ctx *cli.Context, cfg *p2p.Config) {
 		cfg.ListenAddr = ":0"
 		cfg.NoDiscovery = true
 		cfg.DiscoveryV5 = false
+		cfg.DiscoveryENR = false
+		cfg.DNSNodeLists = nil
 	}
 }
 
@@ -993,6 +1065,9 @@ func SetNodeConfig(ctx *cli.Context, cfg *node.Config) {
 	if ctx.GlobalIsSet(NoUSBFlag.Name) {
 		cfg.NoUSB = ctx.GlobalBool(NoUSBFlag.Name)
 	}
+	if ctx.GlobalIsSet(SignerPluginFlag.Name) {
+		cfg.SignerPlugin = ctx.GlobalString(SignerPluginFlag.Name)
+	}
 }
 
 func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
@@ -1002,6 +1077,9 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoPercentileFlag.Name) {
 		cfg.Percentile = ctx.GlobalInt(GpoPercentileFlag.Name)
 	}
+	if ctx.GlobalIsSet(GpoPendingBlocksFlag.Name) {
+		cfg.PendingBlocks = ctx.GlobalInt(GpoPendingBlocksFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -1068,6 +1146,18 @@ func setEthash(ctx *cli.Context, cfg *eth.Config) {
 	}
 }
 
+// setCliqueCheckpoint loads the clique checkpoint to start syncing from, if one
+// was specified.
+func setCliqueCheckpoint(ctx *cli.Context, cfg *eth.Config) {
+	if file := ctx.GlobalString(CliqueCheckpointFlag.Name); file != "" {
+		checkpoint, err := clique.LoadCheckpoint(file)
+		if err != nil {
+			Fatalf("Failed to load clique checkpoint: %v", err)
+		}
+		cfg.CliqueCheckpoint = checkpoint
+	}
+}
+
 // checkExclusive verifies that only a single instance of the provided flags was
 // set by the user. Each flag might optionally be followed by a string type to
 // specialize it further.
@@ -1106,6 +1196,32 @@ func checkExclusive(ctx *cli.Context, args ...interface{}) {
 	}
 }
 
+// setULC configures the ultra-light client mode from the command line flags.
+// Ultra-light clients always sync in light mode.
+func setULC(ctx *cli.Context, cfg *eth.Config) {
+	if ctx.GlobalIsSet(ULCTrustedServersFlag.Name) {
+		if cfg.ULC == nil {
+			cfg.ULC = new(eth.ULCConfig)
+		}
+		cfg.ULC.TrustedServers = nil
+		for _, url := range strings.Split(ctx.GlobalString(ULCTrustedServersFlag.Name), ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				cfg.ULC.TrustedServers = append(cfg.ULC.TrustedServers, url)
+			}
+		}
+	}
+	if cfg.ULC == nil {
+		return
+	}
+	if ctx.GlobalIsSet(ULCMinTrustedFractionFlag.Name) || cfg.ULC.MinTrustedFraction == 0 {
+		cfg.ULC.MinTrustedFraction = ctx.GlobalInt(ULCMinTrustedFractionFlag.Name)
+	}
+	if cfg.SyncMode != downloader.LightSync {
+		log.Info("Switching to light sync for ultra-light client mode")
+		cfg.SyncMode = downloader.LightSync
+	}
+}
+
 // SetShhConfig applies shh-related command line flags to the config.
 func SetShhConfig(ctx *cli.Context, stack *node.Node, cfg *whisper.Config) {
 	if ctx.GlobalIsSet(WhisperMaxMessageSizeFlag.Name) {
@@ -1117,6 +1233,9 @@ func SetShhConfig(ctx *cli.Context, stack *node.Node, cfg *whisper.Config) {
 	if ctx.GlobalIsSet(WhisperRestrictConnectionBetweenLightClientsFlag.Name) {
 		cfg.RestrictConnectionBetweenLightClients = true
 	}
+	if ctx.GlobalIsSet(WhisperLightClientBandwidthFlag.Name) {
+		cfg.LightClientBandwidth = uint32(ctx.GlobalUint(WhisperLightClientBandwidthFlag.Name))
+	}
 }
 
 // SetEthConfig applies eth-related command line flags to the config.
@@ -1124,6 +1243,7 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	// Avoid conflicting network flags
 	checkExclusive(ctx, DeveloperFlag, TestnetFlag, RinkebyFlag)
 	checkExclusive(ctx, LightServFlag, SyncModeFlag, "light")
+	checkExclusive(ctx, LightServFlag, ULCTrustedServersFlag)
 
 	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
 	setEtherbase(ctx, ks, cfg)
@@ -1140,9 +1260,14 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *eth.Config) {
 	if ctx.GlobalIsSet(LightPeersFlag.Name) {
 		cfg.LightPeers = ctx.GlobalInt(LightPeersFlag.Name)
 	}
+	setULC(ctx, cfg)
 	if ctx.GlobalIsSet(NetworkIdFlag.Name) {
 		cfg.NetworkId = ctx.GlobalUint64(NetworkIdFlag.Name)
 	}
+	setCliqueCheckpoint(ctx, cfg)
+	if ctx.GlobalIsSet(CliqueSignerFlag.Name) {
+		cfg.CliqueSigner = ctx.GlobalString(CliqueSignerFlag.Name)
+	}
 
 	if ctx.GlobalIsSet(CacheFlag.Name) || ctx.GlobalIsSet(CacheDatabaseFlag.Name) {
 		cfg.DatabaseCache = ctx.GlobalInt(CacheFlag.Name) * ctx.GlobalInt(CacheDatabaseFlag.Name) / 100
@@ -1370,22 +1495,17 @@ func MakeChain(ctx *cli.Context, stack *node.Node) (chain *core.BlockChain, chai
 	if err != nil {
 		Fatalf("%v", err)
 	}
-	var engine consensus.Engine
-	if config.Clique != nil {
-		engine = clique.New(config.Clique, chainDb)
-	} else {
-		engine = ethash.NewFaker()
-		if !ctx.GlobalBool(FakePoWFlag.Name) {
-			engine = ethash.New(ethash.Config{
-				CacheDir:           stack.ResolvePath(eth.DefaultConfig.Ethash.CacheDir),
-				CachesInMem:        eth.DefaultConfig.Ethash.CachesInMem,
-				CachesOnDisk:       eth.DefaultConfig.Ethash.CachesOnDisk,
-				DatasetDir:         stack.ResolvePath(eth.DefaultConfig.Ethash.DatasetDir),
-				DatasetsInMem:      eth.DefaultConfig.Ethash.DatasetsInMem,
-				DatasetsOnDisk:     eth.DefaultConfig.Ethash.DatasetsOnDisk,
-				ProgpowBlockNumber: config.ProgpowBlock,
-			}, nil, false)
-		}
+	ethConfig := &eth.Config{Ethash: eth.DefaultConfig.Ethash}
+	ethConfig.Ethash.CacheDir = stack.ResolvePath(ethConfig.Ethash.CacheDir)
+	ethConfig.Ethash.DatasetDir = stack.ResolvePath(ethConfig.Ethash.DatasetDir)
+	if ctx.GlobalBool(FakePoWFlag.Name) {
+		ethConfig.Ethash.PowMode = ethash.ModeFake
+	}
+	setCliqueCheckpoint(ctx, ethConfig)
+
+	engine, err := eth.CreateConsensusEngine(nil, eth.EngineChainConfig(config, ethConfig), &ethConfig.Ethash, nil, false, chainDb)
+	if err != nil {
+		Fatalf("Failed to create consensus engine: %v", err)
 	}
 	if gcmode := ctx.GlobalString(GCModeFlag.Name); gcmode != "full" && gcmode != "archive" {
 		Fatalf("--%s must be either 'full' or 'archive'", GCModeFlag.Name)
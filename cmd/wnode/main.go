@@ -24,7 +24,6 @@ import (
 	"crypto/ecdsa"
 	crand "crypto/rand"
 	"crypto/sha512"
-	"encoding/binary"
 	"encoding/hex"
 	"flag"
 	"fmt"
@@ -43,6 +42,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/nat"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/ethereum/go-ethereum/whisper/mailserver"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 	"golang.org/x/crypto/pbkdf2"
@@ -51,6 +51,13 @@ import (
 const quitCommand = "~Q"
 const entropySize = 32
 
+// Retries of the requests rejected over the rate limit of the mail server, with
+// the delay before each retry doubling.
+const (
+	minRetryDelay = time.Second
+	maxRetries    = 5
+)
+
 // singletons
 var (
 	server     *p2p.Server
@@ -96,6 +103,8 @@ var (
 	argMaxSize   = flag.Uint("maxsize", uint(whisper.DefaultMaxMessageSize), "max size of message")
 	argPoW       = flag.Float64("pow", whisper.DefaultMinimumPoW, "PoW for normal messages in float format (e.g. 2.7)")
 	argServerPoW = flag.Float64("mspow", whisper.DefaultMinimumPoW, "PoW requirement for Mail Server request")
+	argRetention = flag.Duration("msretention", 0, "time the Mail Server keeps messages for (e.g. 720h), 0 for unlimited")
+	argMailLimit = flag.Uint("mslimit", uint(mailserver.DefaultConfig.MaxLimit), "max number of messages delivered per Mail Server request")
 
 	argIP      = flag.String("ip", "", "IP address and port of this node (e.g. 127.0.0.1:30303)")
 	argPub     = flag.String("pub", "", "public key for asymmetric encryption")
@@ -271,7 +280,10 @@ func initialize() {
 
 	if *mailServerMode {
 		shh.RegisterServer(&mailServer)
-		if err := mailServer.Init(shh, *argDBPath, msPassword, *argServerPoW); err != nil {
+		config := mailserver.DefaultConfig
+		config.MaxLimit = uint32(*argMailLimit)
+		config.Retention = *argRetention
+		if err := mailServer.Init(shh, *argDBPath, msPassword, *argServerPoW, &config); err != nil {
 			utils.Fatalf("Failed to init MailServer: %s", err)
 		}
 	}
@@ -716,33 +728,75 @@ func requestExpiredMessagesLoop() {
 			timeUpp = 0xFFFFFFFF
 		}
 
-		data := make([]byte, 8, 8+whisper.BloomFilterSize)
-		binary.BigEndian.PutUint32(data, timeLow)
-		binary.BigEndian.PutUint32(data[4:], timeUpp)
-		data = append(data, bloom...)
+		// Request the messages page by page, until the server delivered all of them
+		req := mailserver.MessagesRequest{Lower: timeLow, Upper: timeUpp, Bloom: bloom}
+		for retries := 0; ; {
+			response := requestExpiredMessages(peerID, key, &req)
+			if response == nil {
+				fmt.Println("Error: the mail server did not complete the request in time")
+				break
+			}
+			if response.Error == mailserver.ErrRateLimitExceeded.Error() && retries < maxRetries {
+				// Back off and request the same page again
+				time.Sleep(minRetryDelay << uint(retries))
+				retries++
+				continue
+			}
+			if response.Error != "" {
+				fmt.Printf("Error: the mail server rejected the request: %s \n", response.Error)
+				break
+			}
+			if len(response.Cursor) == 0 {
+				break
+			}
+			req.Cursor, retries = response.Cursor, 0
+		}
+	}
+}
 
-		var params whisper.MessageParams
-		params.PoW = *argServerPoW
-		params.Payload = data
-		params.KeySym = key
-		params.Src = asymKey
-		params.WorkTime = 5
+// requestExpiredMessages sends a request for historic messages to the mail
+// server and waits for its completion.
+func requestExpiredMessages(peerID []byte, key []byte, req *mailserver.MessagesRequest) *whisper.MailServerResponse {
+	payload, err := rlp.EncodeToBytes(req)
+	if err != nil {
+		utils.Fatalf("Failed to encode request: %s", err)
+	}
 
-		msg, err := whisper.NewSentMessage(&params)
-		if err != nil {
-			utils.Fatalf("failed to create new message: %s", err)
-		}
-		env, err := msg.Wrap(&params)
-		if err != nil {
-			utils.Fatalf("Wrap failed: %s", err)
-		}
+	var params whisper.MessageParams
+	params.PoW = *argServerPoW
+	params.Payload = payload
+	params.KeySym = key
+	params.Src = nodeid // the mail server authenticates the request by the node key
+	params.WorkTime = 5
 
-		err = shh.RequestHistoricMessages(peerID, env)
-		if err != nil {
-			utils.Fatalf("Failed to send P2P message: %s", err)
-		}
+	msg, err := whisper.NewSentMessage(&params)
+	if err != nil {
+		utils.Fatalf("failed to create new message: %s", err)
+	}
+	env, err := msg.Wrap(&params)
+	if err != nil {
+		utils.Fatalf("Wrap failed: %s", err)
+	}
 
-		time.Sleep(time.Second * 5)
+	responses := make(chan *whisper.MailServerResponse)
+	sub := shh.SubscribeMailServerResponses(responses)
+	defer sub.Unsubscribe()
+
+	err = shh.RequestHistoricMessages(peerID, env)
+	if err != nil {
+		utils.Fatalf("Failed to send P2P message: %s", err)
+	}
+
+	timeout := time.After(time.Minute)
+	for {
+		select {
+		case response := <-responses:
+			if response.RequestID == env.Hash() {
+				return response
+			}
+		case <-timeout:
+			return nil
+		}
 	}
 }
 
@@ -17,12 +17,27 @@
 package clique
 
 import (
+	"errors"
+	"fmt"
+	"math/big"
+
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
+const (
+	// statusDefaultBlocks is the number of blocks the signer status is computed
+	// over if no explicit range is requested.
+	statusDefaultBlocks = 64
+
+	// statusMaxBlocks is the maximum number of blocks the signer status may be
+	// computed over in a single request, to avoid hogging the node.
+	statusMaxBlocks = 16384
+)
+
 // API is a user facing RPC API to allow controlling the signer and voting
 // mechanisms of the proof-of-authority scheme.
 type API struct {
@@ -117,3 +132,194 @@ func (api *API) Discard(address common.Address) {
 
 	delete(api.clique.proposals, address)
 }
+
+// ExportCheckpoint creates a signer set checkpoint at the given epoch transition
+// block. If the local signer is authorized at that point, the checkpoint will
+// also be attested by it.
+func (api *API) ExportCheckpoint(number rpc.BlockNumber) (*params.CliqueCheckpoint, error) {
+	var header *types.Header
+	if number == rpc.LatestBlockNumber {
+		header = api.chain.CurrentHeader()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
+	}
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if header.Number.Uint64()%api.clique.config.Epoch != 0 {
+		return nil, errInvalidCheckpointNumber
+	}
+	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := newCheckpoint(snap)
+
+	api.clique.lock.RLock()
+	signer, signFn := api.clique.signer, api.clique.signFn
+	api.clique.lock.RUnlock()
+
+	if _, ok := snap.Signers[signer]; ok && signFn != nil {
+		if err := signCheckpoint(checkpoint, signer, signFn); err != nil {
+			return nil, err
+		}
+	}
+	return checkpoint, nil
+}
+
+// SignCheckpoint attests a signer set checkpoint exported by another signer
+// with the local signing key, after verifying it against the local chain.
+func (api *API) SignCheckpoint(checkpoint params.CliqueCheckpoint) (*params.CliqueCheckpoint, error) {
+	header := api.chain.GetHeaderByNumber(checkpoint.Number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	if header.Hash() != checkpoint.Hash {
+		return nil, errMismatchingTrustedCheckpoint
+	}
+	snap, err := api.clique.snapshot(api.chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	signers := snap.signers()
+	if len(signers) != len(checkpoint.Signers) {
+		return nil, errMismatchingCheckpointSigners
+	}
+	for i, signer := range signers {
+		if checkpoint.Signers[i] != signer {
+			return nil, errMismatchingCheckpointSigners
+		}
+	}
+	api.clique.lock.RLock()
+	signer, signFn := api.clique.signer, api.clique.signFn
+	api.clique.lock.RUnlock()
+
+	if _, ok := snap.Signers[signer]; !ok || signFn == nil {
+		return nil, errors.New("local signer not authorized at checkpoint")
+	}
+	if err := signCheckpoint(&checkpoint, signer, signFn); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// SignerStatus contains the sealing statistics of a single signer over a range
+// of blocks.
+type SignerStatus struct {
+	InTurn          uint64  `json:"inturn"`          // Number of blocks sealed in-turn
+	OutOfTurn       uint64  `json:"outofturn"`       // Number of blocks sealed out-of-turn
+	Missed          uint64  `json:"missed"`          // Number of in-turn slots sealed by someone else
+	LastSigned      uint64  `json:"lastSigned"`      // Number of the last block sealed by the signer (0 if unknown)
+	DifficultyShare float64 `json:"difficultyShare"` // Share of the total difficulty contributed by the signer
+}
+
+// Status contains the health statistics of the signers over a range of blocks.
+type Status struct {
+	From          uint64                           `json:"from"`          // First block included in the statistics
+	To            uint64                           `json:"to"`            // Last block included in the statistics
+	InTurnPercent float64                          `json:"inturnPercent"` // Percentage of blocks sealed in-turn
+	Signers       map[common.Address]*SignerStatus `json:"signers"`       // Per signer sealing statistics
+}
+
+// Status retrieves the sealing statistics of the signers for the given range
+// of blocks. If no end is requested, the current head is used; if no start is
+// requested, the last 64 blocks up to the end are used.
+func (api *API) Status(from *rpc.BlockNumber, to *rpc.BlockNumber) (*Status, error) {
+	// Resolve the requested range of blocks into absolute numbers
+	head := api.chain.CurrentHeader().Number.Uint64()
+
+	last := head
+	if to != nil && *to != rpc.LatestBlockNumber {
+		last = uint64(to.Int64())
+	}
+	if last > head {
+		return nil, errUnknownBlock
+	}
+	first := uint64(1)
+	if last > statusDefaultBlocks {
+		first = last - statusDefaultBlocks + 1
+	}
+	if from != nil {
+		if *from == rpc.LatestBlockNumber {
+			first = head
+		} else {
+			first = uint64(from.Int64())
+		}
+	}
+	if first == 0 {
+		first = 1 // Genesis is not sealed by anyone
+	}
+	if first > last {
+		return nil, fmt.Errorf("invalid block range: %d > %d", first, last)
+	}
+	if last-first+1 > statusMaxBlocks {
+		return nil, fmt.Errorf("block range too large: %d > %d", last-first+1, statusMaxBlocks)
+	}
+	// Iterate over the blocks and attribute each seal to the signers
+	status := &Status{
+		From:    first,
+		To:      last,
+		Signers: make(map[common.Address]*SignerStatus),
+	}
+	signer := func(address common.Address) *SignerStatus {
+		if status.Signers[address] == nil {
+			status.Signers[address] = new(SignerStatus)
+		}
+		return status.Signers[address]
+	}
+	var (
+		inturns      uint64
+		total        = new(big.Int)
+		difficulties = make(map[common.Address]*big.Int)
+	)
+	for number := first; number <= last; number++ {
+		header := api.chain.GetHeaderByNumber(number)
+		if header == nil {
+			return nil, errUnknownBlock
+		}
+		snap, err := api.clique.snapshot(api.chain, number-1, header.ParentHash, nil)
+		if err != nil {
+			return nil, err
+		}
+		author, err := api.clique.Author(header)
+		if err != nil {
+			return nil, err
+		}
+		sealer := signer(author)
+		sealer.LastSigned = number
+
+		if expected := snap.inturnSigner(number); expected == author {
+			sealer.InTurn++
+			inturns++
+		} else {
+			sealer.OutOfTurn++
+			signer(expected).Missed++
+		}
+		if difficulties[author] == nil {
+			difficulties[author] = new(big.Int)
+		}
+		difficulties[author].Add(difficulties[author], header.Difficulty)
+		total.Add(total, header.Difficulty)
+	}
+	// Make sure all current signers are reported, even if they were silent
+	final := api.chain.GetHeaderByNumber(last)
+	if snap, err := api.clique.snapshot(api.chain, last, final.Hash(), nil); err == nil {
+		for address := range snap.Signers {
+			signer(address)
+		}
+		for number, address := range snap.Recents {
+			if sealer := signer(address); sealer.LastSigned < number {
+				sealer.LastSigned = number
+			}
+		}
+	}
+	// Convert the raw counters into the relative ones
+	status.InTurnPercent = float64(inturns) * 100 / float64(last-first+1)
+	if total.Sign() > 0 {
+		for address, difficulty := range difficulties {
+			share, _ := new(big.Rat).SetFrac(difficulty, total).Float64()
+			status.Signers[address].DifficultyShare = share
+		}
+	}
+	return status, nil
+}
@@ -0,0 +1,139 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// newTesterChain creates a clique chain with the given signers, sealing each
+// block by the signer at the same position in the sealers list. If no engine
+// config is specified, a default one is used.
+func newTesterChain(t *testing.T, accounts *testerAccountPool, engineConfig *params.CliqueConfig, signers []string, sealers []string) (*core.BlockChain, *Clique) {
+	// Create the genesis block with the initial set of signers
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength*len(signers)+extraSeal),
+	}
+	accounts.checkpoint(&types.Header{Extra: genesis.ExtraData}, signers)
+
+	db := ethdb.NewMemDatabase()
+	genesis.Commit(db)
+
+	// Assemble and seal a chain of headers by the requested sealers
+	if engineConfig == nil {
+		engineConfig = &params.CliqueConfig{Period: 1, Epoch: 30000}
+	}
+	config := *params.TestChainConfig
+	config.Clique = engineConfig
+
+	engine := New(config.Clique, db)
+	engine.fakeDiff = true
+
+	blocks, _ := core.GenerateChain(&config, genesis.ToBlock(db), engine, db, len(sealers), nil)
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, extraVanity+extraSeal)
+		header.Difficulty = diffInTurn
+
+		accounts.sign(header, sealers[i])
+		blocks[i] = block.WithSeal(header)
+	}
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create test chain: %v", err)
+	}
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", n, err)
+	}
+	return chain, engine
+}
+
+// Tests that the signer status correctly attributes in-turn, out-of-turn and
+// missed slots to the individual signers.
+func TestStatus(t *testing.T) {
+	accounts := newTesterAccountPool()
+
+	// Sort the signers so that their turns are known in advance
+	labels := []string{"A", "B", "C"}
+	for i := 0; i < len(labels); i++ {
+		for j := i + 1; j < len(labels); j++ {
+			if bytes.Compare(accounts.address(labels[i]).Bytes(), accounts.address(labels[j]).Bytes()) > 0 {
+				labels[i], labels[j] = labels[j], labels[i]
+			}
+		}
+	}
+	s0, s1, s2 := labels[0], labels[1], labels[2]
+
+	// Seal the first three blocks in-turn, the next three out-of-turn
+	chain, engine := newTesterChain(t, accounts, nil, labels, []string{s1, s2, s0, s2, s0, s1})
+	api := &API{chain: chain, clique: engine}
+
+	status, err := api.Status(nil, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve status: %v", err)
+	}
+	if status.From != 1 || status.To != 6 {
+		t.Errorf("range mismatch: have %d-%d, want 1-6", status.From, status.To)
+	}
+	if status.InTurnPercent != 50 {
+		t.Errorf("in-turn percent mismatch: have %v, want 50", status.InTurnPercent)
+	}
+	want := map[string]SignerStatus{
+		s0: {InTurn: 1, OutOfTurn: 1, Missed: 1, LastSigned: 5, DifficultyShare: 1.0 / 3},
+		s1: {InTurn: 1, OutOfTurn: 1, Missed: 1, LastSigned: 6, DifficultyShare: 1.0 / 3},
+		s2: {InTurn: 1, OutOfTurn: 1, Missed: 1, LastSigned: 4, DifficultyShare: 1.0 / 3},
+	}
+	if len(status.Signers) != len(want) {
+		t.Fatalf("signer count mismatch: have %d, want %d", len(status.Signers), len(want))
+	}
+	for label, stat := range want {
+		if have := status.Signers[accounts.address(label)]; have == nil || *have != stat {
+			t.Errorf("signer %s: status mismatch: have %+v, want %+v", label, have, stat)
+		}
+	}
+	// Request a partial range and ensure only that is accounted
+	from, to := rpc.BlockNumber(4), rpc.BlockNumber(5)
+	if status, err = api.Status(&from, &to); err != nil {
+		t.Fatalf("failed to retrieve partial status: %v", err)
+	}
+	if status.InTurnPercent != 0 {
+		t.Errorf("partial in-turn percent mismatch: have %v, want 0", status.InTurnPercent)
+	}
+	if have := status.Signers[accounts.address(s1)]; have == nil || have.Missed != 1 || have.InTurn != 0 {
+		t.Errorf("partial status mismatch for %s: have %+v", s1, have)
+	}
+	// Invalid ranges should be rejected
+	if _, err := api.Status(&to, &from); err == nil {
+		t.Errorf("inverted range accepted")
+	}
+	future := rpc.BlockNumber(7)
+	if _, err := api.Status(nil, &future); err != errUnknownBlock {
+		t.Errorf("future block error mismatch: have %v, want %v", err, errUnknownBlock)
+	}
+}
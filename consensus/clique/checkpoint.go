@@ -0,0 +1,189 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/sha3"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	// errInvalidCheckpointSignerSet is returned if a trusted checkpoint contains
+	// an empty, unsorted or duplicated list of signers.
+	errInvalidCheckpointSignerSet = errors.New("invalid checkpoint signer set")
+
+	// errInsufficientCheckpointSignatures is returned if a trusted checkpoint is
+	// not attested by a majority of its own signers.
+	errInsufficientCheckpointSignatures = errors.New("insufficient checkpoint signatures")
+
+	// errInvalidCheckpointNumber is returned if a trusted checkpoint is not at an
+	// epoch transition block.
+	errInvalidCheckpointNumber = errors.New("checkpoint not at epoch transition")
+
+	// errMismatchingTrustedCheckpoint is returned if a header at the height of the
+	// trusted checkpoint doesn't match its hash.
+	errMismatchingTrustedCheckpoint = errors.New("mismatching trusted checkpoint")
+
+	// errMismatchingCheckpointSignerSet is returned if the signer set of a trusted
+	// checkpoint differs from the one listed in the epoch header it is pinned to.
+	errMismatchingCheckpointSignerSet = errors.New("mismatching trusted checkpoint signer set")
+)
+
+// checkpointHash returns the hash which is used as input for attesting a signer
+// set checkpoint. The signatures themselves are not part of it.
+func checkpointHash(checkpoint *params.CliqueCheckpoint) (hash common.Hash) {
+	hasher := sha3.NewKeccak256()
+
+	rlp.Encode(hasher, []interface{}{
+		"clique-checkpoint",
+		checkpoint.Number,
+		checkpoint.Hash,
+		checkpoint.Signers,
+	})
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+// newCheckpoint creates an unsigned signer set checkpoint from a snapshot.
+func newCheckpoint(snap *Snapshot) *params.CliqueCheckpoint {
+	return &params.CliqueCheckpoint{
+		Number:  snap.Number,
+		Hash:    snap.Hash,
+		Signers: snap.signers(),
+	}
+}
+
+// signCheckpoint attests a signer set checkpoint with the given signer and
+// appends the signature to it. Signing an already attested checkpoint again is
+// a noop.
+func signCheckpoint(checkpoint *params.CliqueCheckpoint, signer common.Address, signFn SignerFn) error {
+	hash := checkpointHash(checkpoint)
+	for _, sig := range checkpoint.Signatures {
+		if address, err := recoverCheckpointSigner(hash, sig); err == nil && address == signer {
+			return nil
+		}
+	}
+	sig, err := signFn(accounts.Account{Address: signer}, hash.Bytes())
+	if err != nil {
+		return err
+	}
+	checkpoint.Signatures = append(checkpoint.Signatures, sig)
+	return nil
+}
+
+// recoverCheckpointSigner extracts the address of the signer that attested a
+// checkpoint hash.
+func recoverCheckpointSigner(hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != extraSeal {
+		return common.Address{}, errMissingSignature
+	}
+	pubkey, err := crypto.Ecrecover(hash.Bytes(), sig)
+	if err != nil {
+		return common.Address{}, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+	return signer, nil
+}
+
+// VerifyCheckpoint checks whether a signer set checkpoint is well formed and is
+// attested by more than half of the signers contained within.
+func VerifyCheckpoint(checkpoint *params.CliqueCheckpoint) error {
+	// Ensure the signer set is non-empty, sorted and unique
+	if len(checkpoint.Signers) == 0 {
+		return errInvalidCheckpointSignerSet
+	}
+	signers := make(map[common.Address]bool)
+	for i, signer := range checkpoint.Signers {
+		if i > 0 && bytes.Compare(checkpoint.Signers[i-1][:], signer[:]) >= 0 {
+			return errInvalidCheckpointSignerSet
+		}
+		signers[signer] = false
+	}
+	// Count the distinct authorized signers that attested the checkpoint
+	hash, attests := checkpointHash(checkpoint), 0
+	for _, sig := range checkpoint.Signatures {
+		signer, err := recoverCheckpointSigner(hash, sig)
+		if err != nil {
+			return err
+		}
+		if seen, ok := signers[signer]; ok && !seen {
+			signers[signer] = true
+			attests++
+		}
+	}
+	if attests <= len(checkpoint.Signers)/2 {
+		return errInsufficientCheckpointSignatures
+	}
+	return nil
+}
+
+// verifyCheckpointHeader checks whether a signer set checkpoint matches the epoch
+// header it is pinned to, if the header is available locally. A checkpoint which
+// contradicts the chain itself must not be anchored, however well attested.
+func verifyCheckpointHeader(checkpoint *params.CliqueCheckpoint, header *types.Header) error {
+	if header.Number.Uint64() != checkpoint.Number || header.Hash() != checkpoint.Hash {
+		return errMismatchingTrustedCheckpoint
+	}
+	if len(header.Extra) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
+	for i := 0; i < len(signers); i++ {
+		copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	}
+	sort.Sort(signersAscending(signers))
+
+	if len(signers) != len(checkpoint.Signers) {
+		return errMismatchingCheckpointSignerSet
+	}
+	for i, signer := range signers {
+		if signer != checkpoint.Signers[i] {
+			return errMismatchingCheckpointSignerSet
+		}
+	}
+	return nil
+}
+
+// LoadCheckpoint reads a JSON encoded signer set checkpoint from the given file
+// and verifies its attestations.
+func LoadCheckpoint(file string) (*params.CliqueCheckpoint, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	checkpoint := new(params.CliqueCheckpoint)
+	if err := json.Unmarshal(blob, checkpoint); err != nil {
+		return nil, fmt.Errorf("invalid checkpoint file: %v", err)
+	}
+	if err := VerifyCheckpoint(checkpoint); err != nil {
+		return nil, err
+	}
+	return checkpoint, nil
+}
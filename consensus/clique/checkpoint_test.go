@@ -0,0 +1,225 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"bytes"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// signFn returns a clique signer callback backed by the tester account.
+func (ap *testerAccountPool) signFn(account string) SignerFn {
+	return func(_ accounts.Account, hash []byte) ([]byte, error) {
+		ap.address(account) // Ensure the key exists
+		return crypto.Sign(hash, ap.accounts[account])
+	}
+}
+
+// newTesterCheckpoint creates a checkpoint for the given signers, attested by
+// the given subset of them.
+func newTesterCheckpoint(ap *testerAccountPool, number uint64, hash common.Hash, signers []string, attesters []string) *params.CliqueCheckpoint {
+	checkpoint := &params.CliqueCheckpoint{Number: number, Hash: hash}
+	for _, signer := range signers {
+		checkpoint.Signers = append(checkpoint.Signers, ap.address(signer))
+	}
+	sort.Sort(signersAscending(checkpoint.Signers))
+
+	for _, attester := range attesters {
+		signCheckpoint(checkpoint, ap.address(attester), ap.signFn(attester))
+	}
+	return checkpoint
+}
+
+// Tests that checkpoints are only accepted if they are well formed and are
+// attested by a majority of their own signers.
+func TestCheckpointVerification(t *testing.T) {
+	accounts := newTesterAccountPool()
+
+	tests := []struct {
+		signers   []string
+		attesters []string
+		failure   error
+	}{
+		{signers: []string{"A"}, attesters: []string{"A"}},
+		{signers: []string{"A"}, attesters: nil, failure: errInsufficientCheckpointSignatures},
+		{signers: []string{"A"}, attesters: []string{"B"}, failure: errInsufficientCheckpointSignatures},
+		{signers: []string{"A", "B"}, attesters: []string{"A"}, failure: errInsufficientCheckpointSignatures},
+		{signers: []string{"A", "B"}, attesters: []string{"A", "B"}},
+		{signers: []string{"A", "B", "C"}, attesters: []string{"C", "A"}},
+		{signers: []string{"A", "B", "C"}, attesters: []string{"C", "D", "E"}, failure: errInsufficientCheckpointSignatures},
+		{signers: nil, attesters: []string{"A"}, failure: errInvalidCheckpointSignerSet},
+	}
+	for i, tt := range tests {
+		checkpoint := newTesterCheckpoint(accounts, 0, common.Hash{}, tt.signers, tt.attesters)
+		if err := VerifyCheckpoint(checkpoint); err != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+	}
+	// Duplicate attestations must not count towards the majority
+	checkpoint := newTesterCheckpoint(accounts, 0, common.Hash{}, []string{"A", "B", "C"}, []string{"A"})
+	checkpoint.Signatures = append(checkpoint.Signatures, checkpoint.Signatures[0])
+	if err := VerifyCheckpoint(checkpoint); err != errInsufficientCheckpointSignatures {
+		t.Errorf("duplicate attestation: failure mismatch: have %v, want %v", err, errInsufficientCheckpointSignatures)
+	}
+	// Tampering with the signer set must invalidate the attestations
+	checkpoint = newTesterCheckpoint(accounts, 0, common.Hash{}, []string{"A", "B"}, []string{"A", "B"})
+	checkpoint.Signers = checkpoint.Signers[:1]
+	if err := VerifyCheckpoint(checkpoint); err != errInsufficientCheckpointSignatures {
+		t.Errorf("tampered signers: failure mismatch: have %v, want %v", err, errInsufficientCheckpointSignatures)
+	}
+	// Unsorted signer sets must be rejected
+	checkpoint = newTesterCheckpoint(accounts, 0, common.Hash{}, []string{"A", "B"}, []string{"A", "B"})
+	checkpoint.Signers[0], checkpoint.Signers[1] = checkpoint.Signers[1], checkpoint.Signers[0]
+	if err := VerifyCheckpoint(checkpoint); err != errInvalidCheckpointSignerSet {
+		t.Errorf("unsorted signers: failure mismatch: have %v, want %v", err, errInvalidCheckpointSignerSet)
+	}
+}
+
+// Tests that a trusted checkpoint anchors the snapshot only if its signer set
+// matches the epoch header it is pinned to, and that invalid ones are ignored.
+func TestCheckpointAnchor(t *testing.T) {
+	accounts := newTesterAccountPool()
+
+	// Calculate the genesis hash the checkpoint needs to anchor at
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, extraVanity+common.AddressLength+extraSeal),
+	}
+	copy(genesis.ExtraData[extraVanity:], accounts.address("A").Bytes())
+	hash := genesis.ToBlock(ethdb.NewMemDatabase()).Hash()
+
+	// Anchoring a signer set not listed in the genesis must be rejected, even if
+	// the checkpoint is properly attested by the signers it contains
+	checkpoint := newTesterCheckpoint(accounts, 0, hash, []string{"B"}, []string{"B"})
+	config := &params.CliqueConfig{Period: 1, Epoch: 30000, Checkpoint: checkpoint}
+
+	chain, engine := newTesterChain(t, accounts, config, []string{"A"}, nil)
+	if _, err := engine.snapshot(chain, 0, hash, nil); err != errMismatchingCheckpointSignerSet {
+		t.Errorf("mismatching signer set: failure mismatch: have %v, want %v", err, errMismatchingCheckpointSignerSet)
+	}
+	// Anchor the genesis signer set and seal with a member of it
+	checkpoint = newTesterCheckpoint(accounts, 0, hash, []string{"A"}, []string{"A"})
+	config = &params.CliqueConfig{Period: 1, Epoch: 30000, Checkpoint: checkpoint}
+
+	chain, engine = newTesterChain(t, accounts, config, []string{"A"}, []string{"A"})
+	snap, err := engine.snapshot(chain, 1, chain.CurrentHeader().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if signers := snap.signers(); len(signers) != 1 || signers[0] != accounts.address("A") {
+		t.Errorf("signer set mismatch: have %x, want [%x]", signers, accounts.address("A"))
+	}
+	// Export the checkpoint from the live chain and ensure it matches
+	api := &API{chain: chain, clique: engine}
+	engine.Authorize(accounts.address("A"), accounts.signFn("A"))
+
+	exported, err := api.ExportCheckpoint(0)
+	if err != nil {
+		t.Fatalf("failed to export checkpoint: %v", err)
+	}
+	if err := VerifyCheckpoint(exported); err != nil {
+		t.Fatalf("exported checkpoint invalid: %v", err)
+	}
+	if exported.Hash != hash || len(exported.Signatures) != 1 || !bytes.Equal(exported.Signatures[0], checkpoint.Signatures[0]) {
+		t.Errorf("exported checkpoint mismatch: have %+v, want %+v", exported, checkpoint)
+	}
+	if _, err := api.ExportCheckpoint(1); err != errInvalidCheckpointNumber {
+		t.Errorf("non-epoch export: failure mismatch: have %v, want %v", err, errInvalidCheckpointNumber)
+	}
+	// Unattested checkpoints must be ignored by the engine
+	config = &params.CliqueConfig{Period: 1, Epoch: 30000, Checkpoint: newTesterCheckpoint(accounts, 0, hash, []string{"A"}, nil)}
+	if engine := New(config, ethdb.NewMemDatabase()); engine.checkpoint != nil {
+		t.Errorf("unattested checkpoint accepted")
+	}
+	// Checkpoints not on epoch transitions must be ignored by the engine
+	config = &params.CliqueConfig{Period: 1, Epoch: 30000, Checkpoint: newTesterCheckpoint(accounts, 1, hash, []string{"A"}, []string{"A"})}
+	if engine := New(config, ethdb.NewMemDatabase()); engine.checkpoint != nil {
+		t.Errorf("non-epoch checkpoint accepted")
+	}
+}
+
+// headerlessChain is a chain reader without any local headers, as seen by a node
+// bootstrapping from a trusted checkpoint.
+type headerlessChain struct{}
+
+func (headerlessChain) Config() *params.ChainConfig                 { return params.TestChainConfig }
+func (headerlessChain) CurrentHeader() *types.Header                { return nil }
+func (headerlessChain) GetHeader(common.Hash, uint64) *types.Header { return nil }
+func (headerlessChain) GetHeaderByNumber(uint64) *types.Header      { return nil }
+func (headerlessChain) GetHeaderByHash(common.Hash) *types.Header   { return nil }
+func (headerlessChain) GetBlock(common.Hash, uint64) *types.Block   { return nil }
+
+// Tests that a node can bootstrap from a trusted checkpoint without having the
+// epoch header it is pinned to, nor any history before it.
+func TestCheckpointBootstrap(t *testing.T) {
+	accounts := newTesterAccountPool()
+
+	// Assemble a chain sealed by A, with an epoch transition at block 2
+	headers := make([]*types.Header, 5)
+	for i := range headers {
+		headers[i] = &types.Header{
+			Number:     big.NewInt(int64(i)),
+			Difficulty: diffInTurn,
+		}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+		if i%2 == 0 {
+			headers[i].Extra = make([]byte, extraVanity+common.AddressLength+extraSeal)
+			accounts.checkpoint(headers[i], []string{"A"})
+		} else {
+			headers[i].Extra = make([]byte, extraVanity+extraSeal)
+		}
+		accounts.sign(headers[i], "A")
+	}
+	checkpoint := newTesterCheckpoint(accounts, 2, headers[2].Hash(), []string{"A"}, []string{"A"})
+	config := &params.CliqueConfig{Period: 1, Epoch: 2, Checkpoint: checkpoint}
+
+	// Verify the headers after the checkpoint without knowing it, nor its ancestors
+	engine := New(config, ethdb.NewMemDatabase())
+	if err := engine.verifySeal(headerlessChain{}, headers[4], headers[3:4]); err != nil {
+		t.Fatalf("failed to verify header after checkpoint: %v", err)
+	}
+	snap, err := engine.snapshot(headerlessChain{}, 3, headers[3].Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if signers := snap.signers(); len(signers) != 1 || signers[0] != accounts.address("A") {
+		t.Errorf("signer set mismatch: have %x, want [%x]", signers, accounts.address("A"))
+	}
+	// Headers sealed by signers outside the checkpoint set must be rejected
+	forged := types.CopyHeader(headers[3])
+	accounts.sign(forged, "B")
+	if err := New(config, ethdb.NewMemDatabase()).verifySeal(headerlessChain{}, forged, nil); err != errUnauthorizedSigner {
+		t.Errorf("unauthorized signer: failure mismatch: have %v, want %v", err, errUnauthorizedSigner)
+	}
+	// Without a checkpoint, the missing history must be reported
+	engine = New(&params.CliqueConfig{Period: 1, Epoch: 2}, ethdb.NewMemDatabase())
+	if err := engine.verifySeal(headerlessChain{}, headers[4], headers[3:4]); err != consensus.ErrUnknownAncestor {
+		t.Errorf("missing history: failure mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
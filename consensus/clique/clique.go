@@ -140,6 +140,11 @@ var (
 // backing account.
 type SignerFn func(accounts.Account, []byte) ([]byte, error)
 
+// HeaderSignerFn is a signer callback function to request a header to be sealed
+// by a backing account. Unlike SignerFn, the signer derives the hash to sign by
+// itself, so it may inspect what it is signing.
+type HeaderSignerFn func(accounts.Account, *types.Header) ([]byte, error)
+
 // sigHash returns the hash which is used as input for the proof-of-authority
 // signing. It is the hash of the entire header apart from the 65 byte signature
 // contained at the end of the extra data.
@@ -199,17 +204,22 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 // Clique is the proof-of-authority consensus engine proposed to support the
 // Ethereum testnet following the Ropsten attacks.
 type Clique struct {
-	config *params.CliqueConfig // Consensus engine configuration parameters
-	db     ethdb.Database       // Database to store and retrieve snapshot checkpoints
+	config     *params.CliqueConfig     // Consensus engine configuration parameters
+	checkpoint *params.CliqueCheckpoint // Verified signer set checkpoint to trust (nil = none)
+	db         ethdb.Database           // Database to store and retrieve snapshot checkpoints
 
 	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
 
 	proposals map[common.Address]bool // Current list of proposals we are pushing
 
-	signer common.Address // Ethereum address of the signing key
-	signFn SignerFn       // Signer function to authorize hashes with
-	lock   sync.RWMutex   // Protects the signer fields
+	signer       common.Address // Ethereum address of the signing key
+	signFn       SignerFn       // Signer function to authorize hashes with (nil if only headers)
+	signHeaderFn HeaderSignerFn // Signer function to authorize headers with
+	lock         sync.RWMutex   // Protects the signer fields
+
+	sealStatsHead uint64     // Highest block number accounted in the seal metrics
+	sealStatsLock sync.Mutex // Protects the seal metrics head
 
 	// The fields below are for testing only
 	fakeDiff bool // Skip difficulty verifications
@@ -223,12 +233,28 @@ func New(config *params.CliqueConfig, db ethdb.Database) *Clique {
 	if conf.Epoch == 0 {
 		conf.Epoch = epochLength
 	}
+	// Only trust the signer set checkpoint if it's properly attested. Anchoring
+	// is only allowed at epoch transitions, where pending votes are discarded
+	// anyway, otherwise the tallies could diverge from fully synced nodes.
+	var checkpoint *params.CliqueCheckpoint
+	if conf.Checkpoint != nil {
+		err := VerifyCheckpoint(conf.Checkpoint)
+		if err == nil && conf.Checkpoint.Number%conf.Epoch != 0 {
+			err = errInvalidCheckpointNumber
+		}
+		if err != nil {
+			log.Error("Ignoring invalid clique checkpoint", "number", conf.Checkpoint.Number, "hash", conf.Checkpoint.Hash, "err", err)
+		} else {
+			checkpoint = conf.Checkpoint
+		}
+	}
 	// Allocate the snapshot caches and create the engine
 	recents, _ := lru.NewARC(inmemorySnapshots)
 	signatures, _ := lru.NewARC(inmemorySignatures)
 
 	return &Clique{
 		config:     &conf,
+		checkpoint: checkpoint,
 		db:         db,
 		recents:    recents,
 		signatures: signatures,
@@ -282,6 +308,10 @@ func (c *Clique) verifyHeader(chain consensus.ChainReader, header *types.Header,
 	if header.Time.Cmp(big.NewInt(time.Now().Unix())) > 0 {
 		return consensus.ErrFutureBlock
 	}
+	// Headers at the trusted checkpoint height must match it exactly
+	if c.checkpoint != nil && number == c.checkpoint.Number && header.Hash() != c.checkpoint.Hash {
+		return errMismatchingTrustedCheckpoint
+	}
 	// Checkpoint blocks need to enforce zero beneficiary
 	checkpoint := (number % c.config.Epoch) == 0
 	if checkpoint && header.Coinbase != (common.Address{}) {
@@ -387,6 +417,26 @@ func (c *Clique) snapshot(chain consensus.ChainReader, number uint64, hash commo
 			snap = s.(*Snapshot)
 			break
 		}
+		// If the trusted checkpoint was reached, anchor the snapshot there. Its
+		// attestations were verified on creation and the hash was reached via
+		// the descendant headers, so the epoch header itself is not needed. If
+		// it's available nonetheless, cross-check the signer set against it.
+		if c.checkpoint != nil && number == c.checkpoint.Number && hash == c.checkpoint.Hash {
+			var header *types.Header
+			if len(parents) > 0 {
+				header = parents[len(parents)-1]
+			} else {
+				header = chain.GetHeader(hash, number)
+			}
+			if header != nil {
+				if err := verifyCheckpointHeader(c.checkpoint, header); err != nil {
+					return nil, err
+				}
+			}
+			snap = newSnapshot(c.config, c.signatures, number, hash, c.checkpoint.Signers)
+			log.Trace("Anchored voting snapshot at trusted checkpoint", "number", number, "hash", hash)
+			break
+		}
 		// If an on-disk checkpoint snapshot can be found, use that
 		if number%checkpointInterval == 0 {
 			if s, err := loadSnapshot(c.config, c.signatures, c.db, hash); err == nil {
@@ -509,6 +559,14 @@ func (c *Clique) verifySeal(chain consensus.ChainReader, header *types.Header, p
 			return errWrongDifficulty
 		}
 	}
+	// Seal valid, account it in the signer statistics (only once per height)
+	c.sealStatsLock.Lock()
+	if number > c.sealStatsHead {
+		c.sealStatsHead = number
+		markSealed(number, signer, snap.inturnSigner(number))
+	}
+	c.sealStatsLock.Unlock()
+
 	return nil
 }
 
@@ -596,6 +654,22 @@ func (c *Clique) Authorize(signer common.Address, signFn SignerFn) {
 
 	c.signer = signer
 	c.signFn = signFn
+	c.signHeaderFn = func(account accounts.Account, header *types.Header) ([]byte, error) {
+		return signFn(account, sigHash(header).Bytes())
+	}
+}
+
+// AuthorizeHeaders injects a header signer into the consensus engine to mint
+// new blocks with, leaving the sealing hash calculation to the signer. Since
+// such a signer can't sign arbitrary hashes, signer set checkpoints can't be
+// attested with it.
+func (c *Clique) AuthorizeHeaders(signer common.Address, signFn HeaderSignerFn) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.signer = signer
+	c.signFn = nil
+	c.signHeaderFn = signFn
 }
 
 // Seal implements consensus.Engine, attempting to create a sealed block using
@@ -615,7 +689,7 @@ func (c *Clique) Seal(chain consensus.ChainReader, block *types.Block, results c
 	}
 	// Don't hold the signer fields for the entire sealing procedure
 	c.lock.RLock()
-	signer, signFn := c.signer, c.signFn
+	signer, signFn := c.signer, c.signHeaderFn
 	c.lock.RUnlock()
 
 	// Bail out if we're unauthorized to sign a block
@@ -646,7 +720,7 @@ func (c *Clique) Seal(chain consensus.ChainReader, block *types.Block, results c
 		log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle))
 	}
 	// Sign all the things!
-	sighash, err := signFn(accounts.Account{Address: signer}, sigHash(header).Bytes())
+	sighash, err := signFn(accounts.Account{Address: signer}, header)
 	if err != nil {
 		return err
 	}
@@ -696,6 +770,12 @@ func (c *Clique) SealHash(header *types.Header) common.Hash {
 	return sigHash(header)
 }
 
+// SealHash returns the hash of a block prior to it being sealed, which is the
+// hash signed by the block's signer.
+func SealHash(header *types.Header) common.Hash {
+	return sigHash(header)
+}
+
 // Close implements consensus.Engine. It's a noop for clique as there is are no background threads.
 func (c *Clique) Close() error {
 	return nil
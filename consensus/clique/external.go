@@ -0,0 +1,83 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// HeaderContentType is the content type under which clique headers are sent to
+// an external signer for sealing.
+const HeaderContentType = "application/x-clique-header"
+
+// ExternalSigner is a signer backend delegating the sealing of blocks to an
+// external signer (clef) through its account_signData endpoint, so that the
+// sealing keys don't need to live in the node.
+type ExternalSigner struct {
+	client *rpc.Client
+}
+
+// NewExternalSigner connects to the external signer at the given IPC path or
+// HTTP endpoint.
+func NewExternalSigner(endpoint string) (*ExternalSigner, error) {
+	client, err := rpc.Dial(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalSigner{client: client}, nil
+}
+
+// SignHeader requests the external signer to seal the header with the account,
+// verifying that the returned signature was produced by the requested account.
+// It implements HeaderSignerFn.
+func (s *ExternalSigner) SignHeader(account accounts.Account, header *types.Header) ([]byte, error) {
+	blob, err := rlp.EncodeToBytes(header)
+	if err != nil {
+		return nil, err
+	}
+	var sig hexutil.Bytes
+	if err := s.client.Call(&sig, "account_signData", HeaderContentType, account.Address, hexutil.Bytes(blob)); err != nil {
+		return nil, err
+	}
+	if len(sig) != extraSeal {
+		return nil, fmt.Errorf("invalid signature length: have %d, want %d", len(sig), extraSeal)
+	}
+	pubkey, err := crypto.Ecrecover(SealHash(header).Bytes(), sig)
+	if err != nil {
+		return nil, err
+	}
+	var signer common.Address
+	copy(signer[:], crypto.Keccak256(pubkey[1:])[12:])
+
+	if signer != account.Address {
+		return nil, fmt.Errorf("signature by %x, want %x", signer, account.Address)
+	}
+	return sig, nil
+}
+
+// Close terminates the connection to the external signer.
+func (s *ExternalSigner) Close() {
+	s.client.Close()
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package clique
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+// MockExternalSigner mocks the data signing endpoint of an external signer,
+// sealing clique headers with a single key.
+type MockExternalSigner struct {
+	key *ecdsa.PrivateKey
+}
+
+func (s *MockExternalSigner) SignData(contentType string, addr common.Address, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if contentType != HeaderContentType {
+		return nil, fmt.Errorf("unexpected content type %q", contentType)
+	}
+	header := new(types.Header)
+	if err := rlp.DecodeBytes(data, header); err != nil {
+		return nil, err
+	}
+	return crypto.Sign(SealHash(header).Bytes(), s.key)
+}
+
+// Tests that headers are sealed through the external signer, and that seals
+// from a different key than requested are rejected.
+func TestExternalSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("account", &MockExternalSigner{key: key}); err != nil {
+		t.Fatalf("failed to register signer service: %v", err)
+	}
+	defer server.Stop()
+
+	external := &ExternalSigner{client: rpc.DialInProc(server)}
+	defer external.Close()
+
+	header := &types.Header{
+		Number:     big.NewInt(1),
+		Difficulty: diffInTurn,
+		Time:       big.NewInt(1),
+		Extra:      make([]byte, extraVanity+extraSeal),
+	}
+	sig, err := external.SignHeader(accounts.Account{Address: signer}, header)
+	if err != nil {
+		t.Fatalf("failed to sign header: %v", err)
+	}
+	copy(header.Extra[extraVanity:], sig)
+
+	cache, _ := lru.NewARC(inmemorySignatures)
+	if author, err := ecrecover(header, cache); err != nil || author != signer {
+		t.Errorf("seal signer mismatch: have %x (%v), want %x", author, err, signer)
+	}
+	// Requesting a seal by another account must fail
+	if _, err := external.SignHeader(accounts.Account{Address: common.HexToAddress("0x01")}, header); err == nil {
+		t.Errorf("seal by wrong account accepted")
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the metrics collected by the clique engine.
+
+package clique
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/metrics"
+)
+
+var (
+	sealInTurnMeter = metrics.NewRegisteredMeter("clique/seals/inturn", nil)
+	sealNoTurnMeter = metrics.NewRegisteredMeter("clique/seals/noturn", nil)
+	sealMissedMeter = metrics.NewRegisteredMeter("clique/seals/missed", nil)
+)
+
+// signerMetricName assembles the name of a per-signer metric, keyed by the
+// lowercase hex address of the signer (e.g. clique/signers/0x1234.../missed).
+func signerMetricName(signer common.Address, name string) string {
+	return "clique/signers/" + strings.ToLower(signer.Hex()) + "/" + name
+}
+
+// markSealed updates the seal statistics of a signer that sealed the given
+// block. If the block was sealed out-of-turn, the in-turn signer that failed
+// to produce it is also marked as having missed its slot.
+func markSealed(number uint64, signer common.Address, inturn common.Address) {
+	if !metrics.Enabled {
+		return
+	}
+	metrics.GetOrRegisterGauge(signerMetricName(signer, "last"), nil).Update(int64(number))
+	if signer == inturn {
+		sealInTurnMeter.Mark(1)
+		metrics.GetOrRegisterCounter(signerMetricName(signer, "inturn"), nil).Inc(1)
+		return
+	}
+	sealNoTurnMeter.Mark(1)
+	sealMissedMeter.Mark(1)
+	metrics.GetOrRegisterCounter(signerMetricName(signer, "noturn"), nil).Inc(1)
+	metrics.GetOrRegisterCounter(signerMetricName(inturn, "missed"), nil).Inc(1)
+}
@@ -0,0 +1,271 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package hybrid implements a consensus engine multiplexer, delegating to a
+// different consensus engine for consecutive ranges of blocks.
+package hybrid
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+var (
+	// errNoEngines is returned if a hybrid engine is requested without any
+	// consensus engines to delegate to.
+	errNoEngines = errors.New("no consensus engines")
+
+	// errInvalidTransitions is returned if the engine transitions are not in
+	// strictly ascending block order, or the first one doesn't start at genesis.
+	errInvalidTransitions = errors.New("invalid engine transitions")
+)
+
+// Transition is a consensus engine taking over the chain from a given block
+// number onwards.
+type Transition struct {
+	Block  uint64           // First block sealed by the engine
+	Engine consensus.Engine // Consensus engine to delegate to
+}
+
+// Hybrid is a consensus engine delegating all operations to one of multiple
+// consensus engines, depending on the number of the block being operated on.
+type Hybrid struct {
+	transitions []Transition // Engine transitions in ascending block order
+}
+
+// New creates a hybrid consensus engine from a list of engine transitions. The
+// first transition needs to start at the genesis block, the others need to be
+// in strictly ascending block order.
+func New(transitions ...Transition) (*Hybrid, error) {
+	if len(transitions) == 0 {
+		return nil, errNoEngines
+	}
+	if transitions[0].Block != 0 {
+		return nil, errInvalidTransitions
+	}
+	for i := 1; i < len(transitions); i++ {
+		if transitions[i].Block <= transitions[i-1].Block {
+			return nil, errInvalidTransitions
+		}
+	}
+	return &Hybrid{transitions: transitions}, nil
+}
+
+// Engine returns the consensus engine responsible for the given block number.
+func (h *Hybrid) Engine(number uint64) consensus.Engine {
+	for i := len(h.transitions) - 1; i > 0; i-- {
+		if number >= h.transitions[i].Block {
+			return h.transitions[i].Engine
+		}
+	}
+	return h.transitions[0].Engine
+}
+
+// engine returns the consensus engine responsible for the given header.
+func (h *Hybrid) engine(header *types.Header) consensus.Engine {
+	return h.Engine(header.Number.Uint64())
+}
+
+// Author implements consensus.Engine, delegating to the engine of the header.
+func (h *Hybrid) Author(header *types.Header) (common.Address, error) {
+	return h.engine(header).Author(header)
+}
+
+// VerifyHeader implements consensus.Engine, delegating to the engine of the
+// header.
+func (h *Hybrid) VerifyHeader(chain consensus.ChainReader, header *types.Header, seal bool) error {
+	return h.engine(header).VerifyHeader(chain, header, seal)
+}
+
+// VerifyHeaders implements consensus.Engine, splitting the batch of headers
+// into runs belonging to the same engine and verifying them one after the
+// other. The results are delivered in the order of the input slice.
+func (h *Hybrid) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort := make(chan struct{})
+	results := make(chan error, len(headers))
+
+	go func() {
+		for start := 0; start < len(headers); {
+			// Gather all the consecutive headers verified by the same engine
+			engine, end := h.engine(headers[start]), start+1
+			for end < len(headers) && h.engine(headers[end]) == engine {
+				end++
+			}
+			// Verify the run, exposing the previous headers of the batch as if
+			// they were already part of the chain
+			reader := &batchChainReader{ChainReader: chain, headers: headers[:start]}
+			cancel, errs := engine.VerifyHeaders(reader, headers[start:end], seals[start:end])
+
+			for i := start; i < end; i++ {
+				select {
+				case <-abort:
+					close(cancel)
+					return
+				case err := <-errs:
+					select {
+					case <-abort:
+						close(cancel)
+						return
+					case results <- err:
+					}
+				}
+			}
+			close(cancel)
+			start = end
+		}
+	}()
+	return abort, results
+}
+
+// VerifyUncles implements consensus.Engine, delegating to the engine of the
+// block.
+func (h *Hybrid) VerifyUncles(chain consensus.ChainReader, block *types.Block) error {
+	return h.engine(block.Header()).VerifyUncles(chain, block)
+}
+
+// VerifySeal implements consensus.Engine, delegating to the engine of the
+// header.
+func (h *Hybrid) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
+	return h.engine(header).VerifySeal(chain, header)
+}
+
+// Prepare implements consensus.Engine, delegating to the engine of the header.
+func (h *Hybrid) Prepare(chain consensus.ChainReader, header *types.Header) error {
+	return h.engine(header).Prepare(chain, header)
+}
+
+// Finalize implements consensus.Engine, delegating to the engine of the header.
+func (h *Hybrid) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	return h.engine(header).Finalize(chain, header, state, txs, uncles, receipts)
+}
+
+// Seal implements consensus.Engine, delegating to the engine of the block.
+func (h *Hybrid) Seal(chain consensus.ChainReader, block *types.Block, results chan<- *types.Block, stop <-chan struct{}) error {
+	return h.engine(block.Header()).Seal(chain, block, results, stop)
+}
+
+// SealHash implements consensus.Engine, delegating to the engine of the header.
+func (h *Hybrid) SealHash(header *types.Header) common.Hash {
+	return h.engine(header).SealHash(header)
+}
+
+// CalcDifficulty implements consensus.Engine, delegating to the engine of the
+// block following the parent.
+func (h *Hybrid) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
+	return h.Engine(parent.Number.Uint64()+1).CalcDifficulty(chain, time, parent)
+}
+
+// APIs implements consensus.Engine, returning the user facing RPC APIs of all
+// the engines.
+func (h *Hybrid) APIs(chain consensus.ChainReader) []rpc.API {
+	var apis []rpc.API
+	for _, transition := range h.transitions {
+		apis = append(apis, transition.Engine.APIs(chain)...)
+	}
+	return apis
+}
+
+// Close implements consensus.Engine, terminating all the engines.
+func (h *Hybrid) Close() error {
+	var err error
+	for _, transition := range h.transitions {
+		if cerr := transition.Engine.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Hashrate implements consensus.PoW, returning the total mining hashrate of all
+// the proof-of-work engines.
+func (h *Hybrid) Hashrate() float64 {
+	var hashrate float64
+	for _, transition := range h.transitions {
+		if pow, ok := transition.Engine.(consensus.PoW); ok {
+			hashrate += pow.Hashrate()
+		}
+	}
+	return hashrate
+}
+
+// SetThreads updates the number of mining threads of all the engines that
+// support local mining.
+func (h *Hybrid) SetThreads(threads int) {
+	type threaded interface {
+		SetThreads(threads int)
+	}
+	for _, transition := range h.transitions {
+		if th, ok := transition.Engine.(threaded); ok {
+			th.SetThreads(threads)
+		}
+	}
+}
+
+// Authorize injects a private key into all the proof-of-authority engines to
+// mint new blocks with.
+func (h *Hybrid) Authorize(signer common.Address, signFn clique.SignerFn) {
+	for _, transition := range h.transitions {
+		if engine, ok := transition.Engine.(*clique.Clique); ok {
+			engine.Authorize(signer, signFn)
+		}
+	}
+}
+
+// AuthorizeHeaders injects a header signer into all the proof-of-authority
+// engines to mint new blocks with.
+func (h *Hybrid) AuthorizeHeaders(signer common.Address, signFn clique.HeaderSignerFn) {
+	for _, transition := range h.transitions {
+		if engine, ok := transition.Engine.(*clique.Clique); ok {
+			engine.AuthorizeHeaders(signer, signFn)
+		}
+	}
+}
+
+// batchChainReader is a consensus.ChainReader exposing a batch of headers not
+// yet imported into the chain as if they were already present.
+type batchChainReader struct {
+	consensus.ChainReader
+	headers []*types.Header
+}
+
+// GetHeader retrieves a block header from the batch or the database by hash
+// and number.
+func (r *batchChainReader) GetHeader(hash common.Hash, number uint64) *types.Header {
+	for i := len(r.headers) - 1; i >= 0; i-- {
+		if header := r.headers[i]; header.Number.Uint64() == number && header.Hash() == hash {
+			return header
+		}
+	}
+	return r.ChainReader.GetHeader(hash, number)
+}
+
+// GetHeaderByHash retrieves a block header from the batch or the database by
+// its hash.
+func (r *batchChainReader) GetHeaderByHash(hash common.Hash) *types.Header {
+	for i := len(r.headers) - 1; i >= 0; i-- {
+		if header := r.headers[i]; header.Hash() == hash {
+			return header
+		}
+	}
+	return r.ChainReader.GetHeaderByHash(hash)
+}
@@ -0,0 +1,191 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package hybrid
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/consensus"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// testerEngine is a mock consensus engine which fails the verification of
+// headers with a preconfigured error and records the chain it was given.
+type testerEngine struct {
+	consensus.Engine
+	failure error
+	parents []bool // Whether the parent of each verified header was resolvable
+}
+
+func (e *testerEngine) VerifyHeaders(chain consensus.ChainReader, headers []*types.Header, seals []bool) (chan<- struct{}, <-chan error) {
+	abort, results := make(chan struct{}), make(chan error, len(headers))
+	for _, header := range headers {
+		e.parents = append(e.parents, chain.GetHeader(header.ParentHash, header.Number.Uint64()-1) != nil)
+		results <- e.failure
+	}
+	return abort, results
+}
+
+// testerChain is a mock chain reader which doesn't know about any headers.
+type testerChain struct {
+	consensus.ChainReader
+}
+
+func (c *testerChain) GetHeader(hash common.Hash, number uint64) *types.Header { return nil }
+
+// Tests that engine transitions are validated and resolved correctly.
+func TestTransitions(t *testing.T) {
+	a, b, c := new(testerEngine), new(testerEngine), new(testerEngine)
+
+	if _, err := New(); err != errNoEngines {
+		t.Errorf("empty transitions: error mismatch: have %v, want %v", err, errNoEngines)
+	}
+	if _, err := New(Transition{Block: 1, Engine: a}); err != errInvalidTransitions {
+		t.Errorf("non-genesis start: error mismatch: have %v, want %v", err, errInvalidTransitions)
+	}
+	if _, err := New(Transition{Block: 0, Engine: a}, Transition{Block: 10, Engine: b}, Transition{Block: 10, Engine: c}); err != errInvalidTransitions {
+		t.Errorf("duplicate transition: error mismatch: have %v, want %v", err, errInvalidTransitions)
+	}
+	engine, err := New(Transition{Block: 0, Engine: a}, Transition{Block: 10, Engine: b}, Transition{Block: 20, Engine: c})
+	if err != nil {
+		t.Fatalf("failed to create hybrid engine: %v", err)
+	}
+	tests := []struct {
+		number uint64
+		engine consensus.Engine
+	}{
+		{0, a}, {9, a}, {10, b}, {19, b}, {20, c}, {1000000, c},
+	}
+	for _, tt := range tests {
+		if have := engine.Engine(tt.number); have != tt.engine {
+			t.Errorf("block %d: engine mismatch", tt.number)
+		}
+	}
+}
+
+// Tests that batch header verification is split up between the engines, the
+// results are delivered in order and each engine sees the previous headers.
+func TestVerifyHeadersSplit(t *testing.T) {
+	a := &testerEngine{failure: nil}
+	b := &testerEngine{failure: errors.New("b")}
+
+	engine, _ := New(Transition{Block: 0, Engine: a}, Transition{Block: 3, Engine: b})
+
+	headers := make([]*types.Header, 4)
+	for i := range headers {
+		headers[i] = &types.Header{Number: big.NewInt(int64(i + 1))}
+		if i > 0 {
+			headers[i].ParentHash = headers[i-1].Hash()
+		}
+	}
+	_, results := engine.VerifyHeaders(&testerChain{}, headers, make([]bool, len(headers)))
+	for i, want := range []error{nil, nil, b.failure, b.failure} {
+		if err := <-results; err != want {
+			t.Errorf("header %d: result mismatch: have %v, want %v", i, err, want)
+		}
+	}
+	if len(a.parents) != 2 || len(b.parents) != 2 {
+		t.Fatalf("verification split mismatch: have %d/%d, want 2/2", len(a.parents), len(b.parents))
+	}
+	// The first header's parent is unknown, but the parent of the first header
+	// of the second run is only visible if the previous run is exposed
+	if a.parents[0] || !b.parents[0] {
+		t.Errorf("parent visibility mismatch: a %v, b %v", a.parents, b.parents)
+	}
+}
+
+// Tests that a chain can be started with clique and transitioned over to ethash
+// at the configured block, importing both ranges in a single batch.
+func TestCliqueToEthash(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	signer := crypto.PubkeyToAddress(key.PublicKey)
+
+	// Create a clique genesis with a single signer and schedule the switch
+	genesis := &core.Genesis{
+		ExtraData: make([]byte, 32+common.AddressLength+65),
+	}
+	copy(genesis.ExtraData[32:], signer[:])
+
+	db := ethdb.NewMemDatabase()
+	genesis.Commit(db)
+
+	config := *params.TestChainConfig
+	config.Clique = &params.CliqueConfig{Period: 1, Epoch: 30000}
+	config.EthashBlock = big.NewInt(3)
+
+	poa := clique.New(config.Clique, db)
+	engine, err := New(Transition{Block: 0, Engine: poa}, Transition{Block: 3, Engine: ethash.NewFaker()})
+	if err != nil {
+		t.Fatalf("failed to create hybrid engine: %v", err)
+	}
+	// Generate and sign the clique blocks, then generate the ethash ones on top
+	blocks, _ := core.GenerateChain(&config, genesis.ToBlock(db), engine, db, 2, nil)
+	for i, block := range blocks {
+		header := block.Header()
+		if i > 0 {
+			header.ParentHash = blocks[i-1].Hash()
+		}
+		header.Extra = make([]byte, 32+65)
+		header.Difficulty = big.NewInt(2)
+
+		sig, _ := crypto.Sign(poa.SealHash(header).Bytes(), key)
+		copy(header.Extra[32:], sig)
+		blocks[i] = block.WithSeal(header)
+	}
+	pow, _ := core.GenerateChain(&config, blocks[len(blocks)-1], engine, db, 3, nil)
+	blocks = append(blocks, pow...)
+
+	chain, err := core.NewBlockChain(db, nil, &config, engine, vm.Config{}, nil)
+	if err != nil {
+		t.Fatalf("failed to create chain: %v", err)
+	}
+	defer chain.Stop()
+
+	if n, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to import block %d: %v", n, err)
+	}
+	for i, block := range blocks {
+		author, err := engine.Author(block.Header())
+		if err != nil {
+			t.Fatalf("block %d: failed to retrieve author: %v", i+1, err)
+		}
+		want := signer
+		if block.NumberU64() >= 3 {
+			want = block.Coinbase()
+		}
+		if author != want {
+			t.Errorf("block %d: author mismatch: have %x, want %x", i+1, author, want)
+		}
+	}
+	// Ensure a clique block past the switch block is rejected by ethash
+	fake := types.CopyHeader(blocks[1].Header())
+	fake.Number = big.NewInt(3)
+	fake.ParentHash = blocks[1].Hash()
+	if err := engine.VerifyHeader(chain, fake, true); err == nil {
+		t.Errorf("clique header accepted after the switch block")
+	}
+}
@@ -0,0 +1,737 @@
+;; CheckpointOracle assembled by hand for `evm compile`, implementing the same
+;; ABI, rules and events as oracle.sol. The bytecode of the committed binding is
+;; assembled from this file; regenerating the binding from oracle.sol with solc
+;; replaces it with the compiler output.
+;;
+;; Storage layout:
+;;   0   admins          mapping(address => bool)
+;;   1   adminList       address[]
+;;   2   sectionIndex    uint64
+;;   3   height          uint
+;;   4   hash            bytes32
+;;   5   sigV            uint8[]
+;;   6   sigR            bytes32[]
+;;   7   sigS            bytes32[]
+;;   8   sectionSize     uint
+;;   9   processConfirms uint
+;;   10  threshold       uint
+;;
+;; Memory layout of SetCheckpoint:
+;;   0x000  scratch for hashing mapping keys and array slots
+;;   0x080  ecrecover input (hash, v, r, s), output at 0x100
+;;   0x120  EIP 191 message to sign (62 bytes)
+;;   0x160  NewCheckpointVote data (hash, v, r, s)
+;;   0x200  _sectionIndex
+;;   0x220  _hash
+;;   0x240  calldata position of v, r and s (three words)
+;;   0x2a0  number of signatures
+;;   0x2c0  index of the current signature
+;;   0x2e0  signed hash
+;;   0x300  last voter
+;;   0x320  current signer
+;;   0x340  storage slot of the signature array being copied
+;;
+;; Return values are assembled from 0x400 onwards.
+
+    ;; The contract has no code while it's being created, run the constructor
+    address
+    extcodesize
+    iszero
+    jumpi @constructor
+
+    ;; None of the functions are payable
+    callvalue
+    jumpi @fail
+
+    ;; Dispatch the call on the function selector
+    push 4
+    calldatasize
+    lt
+    jumpi @fail
+    push 0x100000000000000000000000000000000000000000000000000000000
+    push 0
+    calldataload
+    div
+    dup1
+    ;; GetAllAdmin()
+    push 0x45848dfc
+    eq
+    jumpi @get_all_admin
+    dup1
+    ;; GetLatestCheckpoint()
+    push 0x4d6a304c
+    eq
+    jumpi @get_latest_checkpoint
+    dup1
+    ;; GetLatestSignatures()
+    push 0xdf2467ec
+    eq
+    jumpi @get_latest_signatures
+    dup1
+    ;; SetCheckpoint(uint256,bytes32,bytes32,uint64,uint8[],bytes32[],bytes32[])
+    push 0xd459fc46
+    eq
+    jumpi @set_checkpoint
+
+fail:
+    push 0
+    dup1
+    revert
+
+ret_false:
+    push 0
+    push 0
+    mstore
+    push 0x20
+    push 0
+    return
+
+;; GetLatestCheckpoint() returns (uint64, bytes32, uint)
+get_latest_checkpoint:
+    push 2
+    sload
+    push 0x400
+    mstore
+    push 4
+    sload
+    push 0x420
+    mstore
+    push 3
+    sload
+    push 0x440
+    mstore
+    push 0x60
+    push 0x400
+    return
+
+;; GetAllAdmin() returns (address[])
+get_all_admin:
+    push 0x20
+    push 0x400
+    mstore
+    push 1
+    sload
+    dup1
+    push 0x420
+    mstore
+    push 1
+    push 0
+    mstore
+    push 0x20
+    push 0
+    sha3
+    push 0
+    ;; stack: length, base, i
+get_all_admin_loop:
+    dup3
+    dup2
+    lt
+    iszero
+    jumpi @get_all_admin_done
+    dup2
+    dup2
+    add
+    sload
+    dup2
+    push 0x20
+    mul
+    push 0x440
+    add
+    mstore
+    push 1
+    add
+    jump @get_all_admin_loop
+get_all_admin_done:
+    pop
+    pop
+    push 0x20
+    mul
+    push 0x40
+    add
+    push 0x400
+    return
+
+;; GetLatestSignatures() returns (uint8[], bytes32[], bytes32[])
+get_latest_signatures:
+    push 0x60
+    push 5
+    ;; stack: offset of the next array in the output, storage slot of the array
+get_latest_signatures_loop:
+    dup1
+    push 8
+    eq
+    jumpi @get_latest_signatures_done
+    dup2
+    push 5
+    dup3
+    sub
+    push 0x20
+    mul
+    push 0x400
+    add
+    mstore
+    dup1
+    sload
+    dup1
+    dup4
+    push 0x400
+    add
+    mstore
+    dup2
+    push 0
+    mstore
+    push 0x20
+    push 0
+    sha3
+    push 0
+    ;; stack: offset, slot, length, base, i
+get_latest_signatures_elem:
+    dup3
+    dup2
+    lt
+    iszero
+    jumpi @get_latest_signatures_next
+    dup2
+    dup2
+    add
+    sload
+    dup2
+    push 1
+    add
+    push 0x20
+    mul
+    dup7
+    add
+    push 0x400
+    add
+    mstore
+    push 1
+    add
+    jump @get_latest_signatures_elem
+get_latest_signatures_next:
+    pop
+    pop
+    push 1
+    add
+    push 0x20
+    mul
+    dup3
+    add
+    swap2
+    pop
+    push 1
+    add
+    jump @get_latest_signatures_loop
+get_latest_signatures_done:
+    pop
+    push 0x400
+    return
+
+;; SetCheckpoint(uint _recentNumber, bytes32 _recentHash, bytes32 _hash,
+;;     uint64 _sectionIndex, uint8[] v, bytes32[] r, bytes32[] s) returns (bool)
+set_checkpoint:
+    ;; require(admins[msg.sender])
+    caller
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    sha3
+    sload
+    iszero
+    jumpi @fail
+
+    ;; require(blockhash(_recentNumber) == _recentHash)
+    push 0x04
+    calldataload
+    blockhash
+    push 0x24
+    calldataload
+    eq
+    iszero
+    jumpi @fail
+
+    ;; Load the arguments
+    push 0x44
+    calldataload
+    push 0x220
+    mstore
+    push 0x64
+    calldataload
+    push 0xffffffffffffffff
+    and
+    push 0x200
+    mstore
+    push 0x84
+    calldataload
+    push 4
+    add
+    push 0x240
+    mstore
+    push 0xa4
+    calldataload
+    push 4
+    add
+    push 0x260
+    mstore
+    push 0xc4
+    calldataload
+    push 4
+    add
+    push 0x280
+    mstore
+
+    ;; require(v.length == r.length && v.length == s.length)
+    push 0x240
+    mload
+    calldataload
+    dup1
+    push 0x2a0
+    mstore
+    dup1
+    push 0x260
+    mload
+    calldataload
+    eq
+    iszero
+    jumpi @fail
+    push 0x280
+    mload
+    calldataload
+    eq
+    iszero
+    jumpi @fail
+
+    ;; Filter out "future" checkpoints:
+    ;; block.number < (_sectionIndex+1)*sectionSize+processConfirms
+    push 9
+    sload
+    push 8
+    sload
+    push 0x200
+    mload
+    push 1
+    add
+    push 0xffffffffffffffff
+    and
+    mul
+    add
+    number
+    lt
+    jumpi @ret_false
+
+    ;; Filter out "old" announcements: _sectionIndex < sectionIndex
+    push 2
+    sload
+    push 0x200
+    mload
+    lt
+    jumpi @ret_false
+
+    ;; Filter out "stale" announcements:
+    ;; _sectionIndex == sectionIndex && (_sectionIndex != 0 || height != 0)
+    push 2
+    sload
+    push 0x200
+    mload
+    eq
+    iszero
+    jumpi @set_checkpoint_fresh
+    push 3
+    sload
+    push 0x200
+    mload
+    or
+    jumpi @ret_false
+set_checkpoint_fresh:
+
+    ;; Filter out "invalid" announcements: _hash == ""
+    push 0x220
+    mload
+    iszero
+    jumpi @ret_false
+
+    ;; keccak256(byte(0x19), byte(0), this, _sectionIndex, _hash), the words
+    ;; are stored right to left so the padding of each is overwritten by the next
+    push 0x220
+    mload
+    push 0x13e
+    mstore
+    push 0x200
+    mload
+    push 0x11e
+    mstore
+    address
+    push 0x116
+    mstore
+    push 0x19
+    push 0x120
+    mstore8
+    push 0
+    push 0x121
+    mstore8
+    push 0x3e
+    push 0x120
+    sha3
+    push 0x2e0
+    mstore
+
+    ;; Count the votes of the admins, signatures are in strict signer order
+    push 0
+    push 0x300
+    mstore
+    push 0
+    push 0x2c0
+    mstore
+set_checkpoint_vote:
+    ;; Running out of signatures before the threshold is met reverts
+    push 0x2a0
+    mload
+    push 0x2c0
+    mload
+    lt
+    iszero
+    jumpi @fail
+
+    ;; signer = ecrecover(signedHash, v[idx], r[idx], s[idx])
+    push 0x2c0
+    mload
+    push 1
+    add
+    push 0x20
+    mul
+    dup1
+    push 0x240
+    mload
+    add
+    calldataload
+    push 0xff
+    and
+    push 0xa0
+    mstore
+    dup1
+    push 0x260
+    mload
+    add
+    calldataload
+    push 0xc0
+    mstore
+    push 0x280
+    mload
+    add
+    calldataload
+    push 0xe0
+    mstore
+    push 0x2e0
+    mload
+    push 0x80
+    mstore
+    push 0
+    push 0x100
+    mstore
+    push 0x20
+    push 0x100
+    push 0x80
+    push 0x80
+    push 1
+    gas
+    staticcall
+    iszero
+    jumpi @fail
+
+    ;; require(admins[signer])
+    push 0x100
+    mload
+    dup1
+    push 0x320
+    mstore
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 0x40
+    push 0
+    sha3
+    sload
+    iszero
+    jumpi @fail
+
+    ;; require(uint256(signer) > uint256(lastVoter))
+    push 0x300
+    mload
+    push 0x320
+    mload
+    gt
+    iszero
+    jumpi @fail
+    push 0x320
+    mload
+    push 0x300
+    mstore
+
+    ;; emit NewCheckpointVote(_sectionIndex, _hash, v[idx], r[idx], s[idx])
+    push 0x220
+    mload
+    push 0x160
+    mstore
+    push 0xa0
+    mload
+    push 0x180
+    mstore
+    push 0xc0
+    mload
+    push 0x1a0
+    mstore
+    push 0xe0
+    mload
+    push 0x1c0
+    mstore
+    push 0x200
+    mload
+    push 0xce51ffa16246bcaf0899f6504f473cd0114f430f566cef71ab7e03d3dde42a41
+    push 0x80
+    push 0x160
+    log2
+
+    ;; Keep counting until idx+1 >= threshold
+    push 0x2c0
+    mload
+    push 1
+    add
+    dup1
+    push 0x2c0
+    mstore
+    push 10
+    sload
+    swap1
+    lt
+    jumpi @set_checkpoint_vote
+
+    ;; Sufficient signatures present, update the latest checkpoint
+    push 0x220
+    mload
+    push 4
+    sstore
+    number
+    push 3
+    sstore
+    push 0x200
+    mload
+    push 2
+    sstore
+
+    ;; sigV = v; sigR = r; sigS = s
+    push 5
+    push 0x340
+    mstore
+set_checkpoint_copy:
+    push 5
+    push 0x340
+    mload
+    sub
+    push 0x20
+    mul
+    push 0x240
+    add
+    mload
+    push 0x340
+    mload
+    push 0
+    mstore
+    push 0x20
+    push 0
+    sha3
+    push 0x340
+    mload
+    sload
+    push 0x2a0
+    mload
+    ;; stack: calldata position, base, old length, j
+set_checkpoint_clear:
+    dup2
+    dup2
+    lt
+    iszero
+    jumpi @set_checkpoint_cleared
+    push 0
+    dup2
+    dup5
+    add
+    sstore
+    push 1
+    add
+    jump @set_checkpoint_clear
+set_checkpoint_cleared:
+    pop
+    pop
+    push 0x2a0
+    mload
+    push 0x340
+    mload
+    sstore
+    push 0
+    ;; stack: calldata position, base, j
+set_checkpoint_write:
+    push 0x2a0
+    mload
+    dup2
+    lt
+    iszero
+    jumpi @set_checkpoint_written
+    dup1
+    push 1
+    add
+    push 0x20
+    mul
+    dup4
+    add
+    calldataload
+    push 5
+    push 0x340
+    mload
+    eq
+    iszero
+    jumpi @set_checkpoint_store
+    push 0xff
+    and
+set_checkpoint_store:
+    dup2
+    dup4
+    add
+    sstore
+    push 1
+    add
+    jump @set_checkpoint_write
+set_checkpoint_written:
+    pop
+    pop
+    pop
+    push 0x340
+    mload
+    push 1
+    add
+    dup1
+    push 0x340
+    mstore
+    push 8
+    eq
+    iszero
+    jumpi @set_checkpoint_copy
+
+    push 1
+    push 0
+    mstore
+    push 0x20
+    push 0
+    return
+
+;; constructor(address[] _adminlist, uint _sectionSize, uint _processConfirms, uint _threshold)
+;;
+;; Everything before the constructor is the runtime code. The arguments follow
+;; the end of the code, which is found by jumping there.
+constructor:
+    pc
+    jump @constructor_end
+constructor_start:
+    ;; stack: runtime code length + 1, position of the arguments
+    callvalue
+    jumpi @fail
+    dup1
+    codesize
+    sub
+    swap1
+    push 0x400
+    codecopy
+
+    ;; sectionSize = _sectionSize; processConfirms = _processConfirms; threshold = _threshold
+    push 0x420
+    mload
+    push 8
+    sstore
+    push 0x440
+    mload
+    push 9
+    sstore
+    push 0x460
+    mload
+    push 10
+    sstore
+
+    ;; admins[_adminlist[i]] = true; adminList.push(_adminlist[i])
+    push 0x400
+    mload
+    push 0x400
+    add
+    dup1
+    mload
+    dup1
+    push 1
+    sstore
+    push 1
+    push 0
+    mstore
+    push 0x20
+    push 0
+    sha3
+    push 0
+    ;; stack: list, length, base, i
+constructor_admin:
+    dup3
+    dup2
+    lt
+    iszero
+    jumpi @constructor_admin_done
+    dup1
+    push 1
+    add
+    push 0x20
+    mul
+    dup5
+    add
+    mload
+    push 0xffffffffffffffffffffffffffffffffffffffff
+    and
+    dup1
+    dup4
+    dup4
+    add
+    sstore
+    push 0
+    mstore
+    push 0
+    push 0x20
+    mstore
+    push 1
+    push 0x40
+    push 0
+    sha3
+    sstore
+    push 1
+    add
+    jump @constructor_admin
+constructor_admin_done:
+    pop
+    pop
+    pop
+    pop
+
+    ;; Deploy the runtime code
+    push 1
+    swap1
+    sub
+    dup1
+    push 0
+    push 0
+    codecopy
+    push 0
+    return
+
+constructor_end:
+    pc
+    push 10
+    add
+    jump @constructor_start
@@ -0,0 +1,194 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package checkpointoracle is a wrapper of checkpoint oracle contract with
+// additional rules defined. This package can be used both in LES client or
+// server side for offering oracle related APIs.
+package checkpointoracle
+
+//go:generate abigen --sol contract/oracle.sol --pkg contract --out contract/oracle.go
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/checkpointoracle/contract"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errInvalidSignature is returned if a checkpoint signature is malformed.
+	errInvalidSignature = errors.New("invalid checkpoint signature")
+
+	// errNotEnoughSignatures is returned if a checkpoint isn't signed by enough
+	// distinct trusted signers.
+	errNotEnoughSignatures = errors.New("not enough checkpoint signatures")
+)
+
+// CheckpointOracle is a Go wrapper around an on-chain checkpoint oracle contract.
+type CheckpointOracle struct {
+	address  common.Address
+	contract *contract.CheckpointOracle
+}
+
+// NewCheckpointOracle binds checkpoint contract and returns a registrar instance.
+func NewCheckpointOracle(contractAddr common.Address, backend bind.ContractBackend) (*CheckpointOracle, error) {
+	c, err := contract.NewCheckpointOracle(contractAddr, backend)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointOracle{address: contractAddr, contract: c}, nil
+}
+
+// NewCheckpointOracleReader binds a read-only registrar instance, usable with
+// backends only able to execute calls against the chain state.
+func NewCheckpointOracleReader(contractAddr common.Address, caller bind.ContractCaller) (*CheckpointOracle, error) {
+	c, err := contract.NewCheckpointOracleCaller(contractAddr, caller)
+	if err != nil {
+		return nil, err
+	}
+	return &CheckpointOracle{address: contractAddr, contract: &contract.CheckpointOracle{CheckpointOracleCaller: *c}}, nil
+}
+
+// ContractAddr returns the address of contract.
+func (oracle *CheckpointOracle) ContractAddr() common.Address {
+	return oracle.address
+}
+
+// Contract returns the underlying contract instance.
+func (oracle *CheckpointOracle) Contract() *contract.CheckpointOracle {
+	return oracle.contract
+}
+
+// LatestCheckpoint returns the index and hash of the latest registered
+// checkpoint, the block height it was registered at and the admin signatures
+// it was registered with, each in the 65 byte [R || S || V] format.
+func (oracle *CheckpointOracle) LatestCheckpoint(opts *bind.CallOpts) (uint64, common.Hash, uint64, [][]byte, error) {
+	index, hash, height, err := oracle.contract.GetLatestCheckpoint(opts)
+	if err != nil {
+		return 0, common.Hash{}, 0, nil, err
+	}
+	v, r, s, err := oracle.contract.GetLatestSignatures(opts)
+	if err != nil {
+		return 0, common.Hash{}, 0, nil, err
+	}
+	if len(v) != len(r) || len(v) != len(s) {
+		return 0, common.Hash{}, 0, nil, errInvalidSignature
+	}
+	sigs := make([][]byte, len(v))
+	for i := range v {
+		sig := make([]byte, 65)
+		copy(sig, r[i][:])
+		copy(sig[32:], s[i][:])
+		sig[64] = v[i] - 27
+		sigs[i] = sig
+	}
+	return index, hash, height.Uint64(), sigs, nil
+}
+
+// RegisterCheckpoint registers the checkpoint with the provided message and
+// signatures. The signatures are sorted by signer address as required by the
+// contract. The recent block number and hash protect the transaction from being
+// replayed on a different fork.
+func (oracle *CheckpointOracle) RegisterCheckpoint(opts *bind.TransactOpts, index uint64, hash common.Hash, rnum *big.Int, rhash common.Hash, sigs [][]byte) (*types.Transaction, error) {
+	type signature struct {
+		signer common.Address
+		sig    []byte
+	}
+	signed := make([]signature, 0, len(sigs))
+	for _, sig := range sigs {
+		signer, err := RecoverSigner(oracle.address, index, hash, sig)
+		if err != nil {
+			return nil, err
+		}
+		signed = append(signed, signature{signer, sig})
+	}
+	sort.Slice(signed, func(i, j int) bool { return bytes.Compare(signed[i].signer[:], signed[j].signer[:]) < 0 })
+
+	var (
+		r [][32]byte
+		s [][32]byte
+		v []uint8
+	)
+	for _, signature := range signed {
+		r = append(r, common.BytesToHash(signature.sig[:32]))
+		s = append(s, common.BytesToHash(signature.sig[32:64]))
+		v = append(v, signature.sig[64]+27)
+	}
+	return oracle.contract.SetCheckpoint(opts, rnum, rhash, hash, index, v, r, s)
+}
+
+// SignatureHash returns the EIP-191 style hash the oracle admins sign when
+// approving a checkpoint: keccak256(0x19 || 0x00 || oracle || index || hash).
+func SignatureHash(oracle common.Address, index uint64, hash common.Hash) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return crypto.Keccak256([]byte{0x19, 0x00}, oracle.Bytes(), buf, hash.Bytes())
+}
+
+// SignCheckpoint signs a checkpoint hash for the given oracle contract,
+// returning the signature in the 65 byte [R || S || V] format.
+func SignCheckpoint(oracle common.Address, index uint64, hash common.Hash, sign func(hash []byte) ([]byte, error)) ([]byte, error) {
+	return sign(SignatureHash(oracle, index, hash))
+}
+
+// RecoverSigner returns the address that produced a checkpoint signature.
+func RecoverSigner(oracle common.Address, index uint64, hash common.Hash, sig []byte) (common.Address, error) {
+	if len(sig) != 65 {
+		return common.Address{}, errInvalidSignature
+	}
+	pubkey, err := crypto.SigToPub(SignatureHash(oracle, index, hash), sig)
+	if err != nil {
+		return common.Address{}, fmt.Errorf("%v: %v", errInvalidSignature, err)
+	}
+	return crypto.PubkeyToAddress(*pubkey), nil
+}
+
+// VerifyCheckpoint checks that a checkpoint was signed by at least the required
+// number of distinct trusted signers of the configured oracle. Malformed
+// signatures and signatures from unknown signers are ignored, since the contract
+// may store more signatures than the threshold requires.
+func VerifyCheckpoint(config *params.CheckpointOracleConfig, checkpoint *params.TrustedCheckpoint, sigs [][]byte) error {
+	var (
+		trusted = make(map[common.Address]bool)
+		signed  = make(map[common.Address]bool)
+		hash    = checkpoint.Hash()
+	)
+	for _, signer := range config.Signers {
+		trusted[signer] = true
+	}
+	for _, sig := range sigs {
+		signer, err := RecoverSigner(config.Address, checkpoint.SectionIndex, hash, sig)
+		if err != nil {
+			continue
+		}
+		if trusted[signer] {
+			signed[signer] = true
+		}
+	}
+	if config.Threshold == 0 || uint64(len(signed)) < config.Threshold {
+		return fmt.Errorf("%v: have %d, want %d", errNotEnoughSignatures, len(signed), config.Threshold)
+	}
+	return nil
+}
@@ -0,0 +1,302 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package checkpointoracle
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"sort"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/checkpointoracle/contract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that checkpoints are only accepted if signed by enough distinct trusted
+// signers of the configured oracle.
+func TestVerifyCheckpoint(t *testing.T) {
+	var (
+		keys    = make([]*ecdsa.PrivateKey, 4)
+		signers []common.Address
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		signers = append(signers, crypto.PubkeyToAddress(keys[i].PublicKey))
+	}
+	config := &params.CheckpointOracleConfig{
+		Address:   common.HexToAddress("0x0102030405060708090a0b0c0d0e0f1011121314"),
+		Signers:   signers[:3],
+		Threshold: 2,
+	}
+	checkpoint := &params.TrustedCheckpoint{
+		SectionIndex: 5,
+		SectionHead:  common.HexToHash("0x01"),
+		CHTRoot:      common.HexToHash("0x02"),
+		BloomRoot:    common.HexToHash("0x03"),
+	}
+	sign := func(key *ecdsa.PrivateKey, oracle common.Address, index uint64) []byte {
+		sig, err := SignCheckpoint(oracle, index, checkpoint.Hash(), func(hash []byte) ([]byte, error) {
+			return crypto.Sign(hash, key)
+		})
+		if err != nil {
+			t.Fatalf("failed to sign checkpoint: %v", err)
+		}
+		return sig
+	}
+	tests := []struct {
+		sigs  [][]byte
+		valid bool
+	}{
+		// Enough distinct trusted signers
+		{[][]byte{sign(keys[0], config.Address, 5), sign(keys[1], config.Address, 5)}, true},
+		{[][]byte{sign(keys[2], config.Address, 5), sign(keys[0], config.Address, 5), sign(keys[1], config.Address, 5)}, true},
+		// A single signer counted twice
+		{[][]byte{sign(keys[0], config.Address, 5), sign(keys[0], config.Address, 5)}, false},
+		// An untrusted signer
+		{[][]byte{sign(keys[0], config.Address, 5), sign(keys[3], config.Address, 5)}, false},
+		// Signatures for a different oracle or section
+		{[][]byte{sign(keys[0], common.Address{}, 5), sign(keys[1], common.Address{}, 5)}, false},
+		{[][]byte{sign(keys[0], config.Address, 6), sign(keys[1], config.Address, 6)}, false},
+		// Malformed signatures
+		{[][]byte{sign(keys[0], config.Address, 5), {0x01}}, false},
+		{[][]byte{sign(keys[0], config.Address, 5), {0x01}, sign(keys[1], config.Address, 5)}, true},
+		{[][]byte{sign(keys[0], config.Address, 5), make([]byte, 65), sign(keys[1], config.Address, 5)}, true},
+		{nil, false},
+	}
+	for i, tt := range tests {
+		err := VerifyCheckpoint(config, checkpoint, tt.sigs)
+		if tt.valid && err != nil {
+			t.Errorf("test %d: valid checkpoint rejected: %v", i, err)
+		}
+		if !tt.valid && err == nil {
+			t.Errorf("test %d: invalid checkpoint accepted", i)
+		}
+	}
+}
+
+// Tests that the signers of a checkpoint are recovered from their signatures.
+func TestRecoverSigner(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	oracle, hash := common.Address{0x01}, common.Hash{0x02}
+
+	sig, _ := crypto.Sign(SignatureHash(oracle, 1, hash), key)
+	signer, err := RecoverSigner(oracle, 1, hash, sig)
+	if err != nil {
+		t.Fatalf("failed to recover signer: %v", err)
+	}
+	if want := crypto.PubkeyToAddress(key.PublicKey); signer != want {
+		t.Errorf("signer mismatch: have %x, want %x", signer, want)
+	}
+}
+
+// Tests that the oracle contract only registers checkpoints signed by a
+// threshold of distinct admins in signer order, protected against replays on
+// other forks and announced in section order.
+func TestCheckpointRegistration(t *testing.T) {
+	const (
+		sectionSize     = 16
+		processConfirms = 1
+	)
+	// Create the admins in signer order and an outsider
+	var (
+		keys   = make([]*ecdsa.PrivateKey, 4)
+		admins = make([]common.Address, 3)
+		alloc  = make(core.GenesisAlloc)
+	)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		alloc[crypto.PubkeyToAddress(keys[i].PublicKey)] = core.GenesisAccount{Balance: big.NewInt(1000000000000000000)}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return bytes.Compare(crypto.PubkeyToAddress(keys[i].PublicKey).Bytes(), crypto.PubkeyToAddress(keys[j].PublicKey).Bytes()) < 0
+	})
+	outsider := keys[1]
+	keys = append(keys[:1], keys[2:]...)
+	for i, key := range keys {
+		admins[i] = crypto.PubkeyToAddress(key.PublicKey)
+	}
+	backend := backends.NewSimulatedBackend(alloc, 10000000)
+
+	// Deploy the oracle with a threshold of two admins
+	addr, _, _, err := contract.DeployCheckpointOracle(bind.NewKeyedTransactor(keys[0]), backend, admins, big.NewInt(sectionSize), big.NewInt(processConfirms), big.NewInt(2))
+	if err != nil {
+		t.Fatalf("failed to deploy oracle: %v", err)
+	}
+	backend.Commit()
+
+	oracle, err := NewCheckpointOracle(addr, backend)
+	if err != nil {
+		t.Fatalf("failed to bind oracle: %v", err)
+	}
+	listed, err := oracle.Contract().GetAllAdmin(nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve admins: %v", err)
+	}
+	if len(listed) != len(admins) {
+		t.Fatalf("admin count mismatch: have %d, want %d", len(listed), len(admins))
+	}
+	for i := range admins {
+		if listed[i] != admins[i] {
+			t.Errorf("admin %d mismatch: have %x, want %x", i, listed[i], admins[i])
+		}
+	}
+	// Create the helpers to sign and register checkpoints
+	sign := func(key *ecdsa.PrivateKey, index uint64, hash common.Hash) []byte {
+		sig, err := SignCheckpoint(addr, index, hash, func(hash []byte) ([]byte, error) {
+			return crypto.Sign(hash, key)
+		})
+		if err != nil {
+			t.Fatalf("failed to sign checkpoint: %v", err)
+		}
+		return sig
+	}
+	recent := func() (*big.Int, common.Hash) {
+		head, err := backend.HeaderByNumber(context.Background(), nil)
+		if err != nil {
+			t.Fatalf("failed to retrieve head: %v", err)
+		}
+		return head.Number, head.Hash()
+	}
+	advance := func(number uint64) {
+		for rnum, _ := recent(); rnum.Uint64() < number; rnum, _ = recent() {
+			backend.Commit()
+		}
+	}
+	register := func(key *ecdsa.PrivateKey, index uint64, hash common.Hash, sigs ...[]byte) error {
+		rnum, rhash := recent()
+		_, err := oracle.RegisterCheckpoint(bind.NewKeyedTransactor(key), index, hash, rnum, rhash, sigs)
+		backend.Commit()
+		return err
+	}
+	check := func(name string, index uint64, hash common.Hash, height uint64, sigs int) {
+		have, haveHash, haveHeight, haveSigs, err := oracle.LatestCheckpoint(nil)
+		if err != nil {
+			t.Fatalf("%s: failed to retrieve checkpoint: %v", name, err)
+		}
+		if have != index || haveHash != hash || haveHeight != height || len(haveSigs) != sigs {
+			t.Errorf("%s: checkpoint mismatch: have #%d %x at %d with %d signatures, want #%d %x at %d with %d signatures",
+				name, have, haveHash, haveHeight, len(haveSigs), index, hash, height, sigs)
+		}
+		for i, sig := range haveSigs {
+			if signer, err := RecoverSigner(addr, index, hash, sig); err != nil || signer != admins[i] {
+				t.Errorf("%s: signature %d mismatch: have %x (%v), want %x", name, i, signer, err, admins[i])
+			}
+		}
+	}
+	hash0 := common.HexToHash("0x01")
+	advance(sectionSize + processConfirms)
+
+	// Registrations violating the rules of the oracle must revert
+	if err := register(keys[0], 0, hash0, sign(keys[0], 0, hash0)); err == nil {
+		t.Errorf("checkpoint below threshold accepted")
+	}
+	if err := register(keys[0], 0, hash0, sign(keys[0], 0, hash0), sign(keys[0], 0, hash0)); err == nil {
+		t.Errorf("checkpoint with duplicate signer accepted")
+	}
+	if err := register(keys[0], 0, hash0, sign(keys[0], 0, hash0), sign(outsider, 0, hash0)); err == nil {
+		t.Errorf("checkpoint with non-admin signer accepted")
+	}
+	if err := register(outsider, 0, hash0, sign(keys[0], 0, hash0), sign(keys[1], 0, hash0)); err == nil {
+		t.Errorf("checkpoint sent by non-admin accepted")
+	}
+	if other := common.HexToHash("0xff"); register(keys[0], 0, hash0, sign(keys[0], 0, other), sign(keys[1], 0, other)) == nil {
+		t.Errorf("checkpoint with signatures of another hash accepted")
+	}
+	rnum, _ := recent()
+	if _, err := oracle.RegisterCheckpoint(bind.NewKeyedTransactor(keys[0]), 0, hash0, rnum, common.HexToHash("0xdead"), [][]byte{sign(keys[0], 0, hash0), sign(keys[1], 0, hash0)}); err == nil {
+		t.Errorf("checkpoint with stale recent hash accepted")
+	}
+	rnum, rhash := recent()
+	v, r, s := []uint8{27, 27}, make([][32]byte, 2), make([][32]byte, 2)
+	for i, key := range []*ecdsa.PrivateKey{keys[1], keys[0]} {
+		sig := sign(key, 0, hash0)
+		copy(r[i][:], sig[:32])
+		copy(s[i][:], sig[32:64])
+		v[i] += sig[64]
+	}
+	if _, err := oracle.Contract().SetCheckpoint(bind.NewKeyedTransactor(keys[0]), rnum, rhash, hash0, 0, v, r, s); err == nil {
+		t.Errorf("checkpoint with unordered signers accepted")
+	}
+	backend.Commit()
+	check("rejected", 0, common.Hash{}, 0, 0)
+
+	// Register a valid checkpoint and ensure the votes are announced
+	if err := register(keys[1], 0, hash0, sign(keys[1], 0, hash0), sign(keys[0], 0, hash0)); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	head, _ := recent()
+	check("registered", 0, hash0, head.Uint64(), 2)
+
+	votes, err := oracle.Contract().FilterNewCheckpointVote(&bind.FilterOpts{}, []uint64{0})
+	if err != nil {
+		t.Fatalf("failed to filter votes: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if !votes.Next() {
+			t.Fatalf("vote %d missing: %v", i, votes.Error())
+		}
+		if votes.Event.CheckpointHash != hash0 || votes.Event.Index != 0 {
+			t.Errorf("vote %d mismatch: have #%d %x, want #0 %x", i, votes.Event.Index, votes.Event.CheckpointHash, hash0)
+		}
+	}
+	if votes.Next() {
+		t.Errorf("unexpected vote: %+v", votes.Event)
+	}
+	votes.Close()
+
+	// Stale, future and out of order announcements must be ignored
+	if err := register(keys[0], 0, hash0, sign(keys[0], 0, hash0), sign(keys[2], 0, hash0)); err != nil {
+		t.Fatalf("failed to send stale checkpoint: %v", err)
+	}
+	check("stale", 0, hash0, head.Uint64(), 2)
+
+	hash2 := common.HexToHash("0x02")
+	if err := register(keys[0], 2, hash2, sign(keys[0], 2, hash2), sign(keys[1], 2, hash2)); err != nil {
+		t.Fatalf("failed to send future checkpoint: %v", err)
+	}
+	check("future", 0, hash0, head.Uint64(), 2)
+
+	// Signatures beyond the threshold are stored along with the checkpoint
+	advance(3*sectionSize + processConfirms)
+	if err := register(keys[2], 2, hash2, sign(keys[0], 2, hash2), sign(keys[1], 2, hash2), sign(keys[2], 2, hash2)); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	head, _ = recent()
+	check("extra signatures", 2, hash2, head.Uint64(), 3)
+
+	hash1 := common.HexToHash("0x03")
+	if err := register(keys[0], 1, hash1, sign(keys[0], 1, hash1), sign(keys[1], 1, hash1)); err != nil {
+		t.Fatalf("failed to send old checkpoint: %v", err)
+	}
+	check("out of order", 2, hash2, head.Uint64(), 3)
+
+	// A later checkpoint with fewer signatures replaces all the stored ones
+	hash3 := common.HexToHash("0x04")
+	advance(4*sectionSize + processConfirms)
+	if err := register(keys[0], 3, hash3, sign(keys[0], 3, hash3), sign(keys[1], 3, hash3)); err != nil {
+		t.Fatalf("failed to register checkpoint: %v", err)
+	}
+	head, _ = recent()
+	check("replaced", 3, hash3, head.Uint64(), 2)
+}
@@ -43,7 +43,6 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
-	"github.com/ethereum/go-ethereum/swarm/services/swap/swap"
 )
 
 // TODO(zelig): watch peer solvency and notify of bouncing cheques
@@ -409,7 +408,7 @@ func NewOutbox(chbook *Chequebook, beneficiary common.Address) *Outbox {
 }
 
 // Issue creates cheque.
-func (self *Outbox) Issue(amount *big.Int) (swap.Promise, error) {
+func (self *Outbox) Issue(amount *big.Int) (*Cheque, error) {
 	return self.chequeBook.Issue(self.beneficiary, amount)
 }
 
@@ -418,7 +417,7 @@ func (self *Outbox) AutoDeposit(interval time.Duration, threshold, buffer *big.I
 	self.chequeBook.AutoDeposit(interval, threshold, buffer)
 }
 
-// Stop helps satisfy the swap.OutPayment interface.
+// Stop stops the outbox.
 func (self *Outbox) Stop() {}
 
 // String implements fmt.Stringer.
@@ -544,10 +543,7 @@ func (self *Inbox) autoCash(cashInterval time.Duration) {
 }
 
 // Receive is called to deposit the latest cheque to the incoming Inbox.
-// The given promise must be a *Cheque.
-func (self *Inbox) Receive(promise swap.Promise) (*big.Int, error) {
-	ch := promise.(*Cheque)
-
+func (self *Inbox) Receive(ch *Cheque) (*big.Int, error) {
 	defer self.lock.Unlock()
 	self.lock.Lock()
 
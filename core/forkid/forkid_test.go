@@ -0,0 +1,178 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package forkid
+
+import (
+	"bytes"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// progpowConfig is the mainnet configuration switching to ProgPoW at block
+// 5000000.
+var progpowConfig = func() *params.ChainConfig {
+	config := *params.MainnetChainConfig
+	config.ProgpowBlock = big.NewInt(5000000)
+	return &config
+}()
+
+// TestCreation tests that different genesis and fork rule combinations result
+// in the correct fork ID.
+func TestCreation(t *testing.T) {
+	type testcase struct {
+		head uint64
+		want ID
+	}
+	tests := []struct {
+		config  *params.ChainConfig
+		genesis [32]byte
+		cases   []testcase
+	}{
+		// Mainnet test cases
+		{
+			params.MainnetChainConfig,
+			params.MainnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0xfc64ec04), Next: 1150000}},       // Unsynced
+				{1149999, ID{Hash: checksumToBytes(0xfc64ec04), Next: 1150000}}, // Last Frontier block
+				{1150000, ID{Hash: checksumToBytes(0x97c2c34c), Next: 1920000}}, // First Homestead block
+				{1919999, ID{Hash: checksumToBytes(0x97c2c34c), Next: 1920000}}, // Last Homestead block
+				{1920000, ID{Hash: checksumToBytes(0x91d1f948), Next: 2463000}}, // First DAO block
+				{2462999, ID{Hash: checksumToBytes(0x91d1f948), Next: 2463000}}, // Last DAO block
+				{2463000, ID{Hash: checksumToBytes(0x7a64da13), Next: 2675000}}, // First Tangerine block
+				{2674999, ID{Hash: checksumToBytes(0x7a64da13), Next: 2675000}}, // Last Tangerine block
+				{2675000, ID{Hash: checksumToBytes(0x3edd5b10), Next: 4370000}}, // First Spurious block
+				{4369999, ID{Hash: checksumToBytes(0x3edd5b10), Next: 4370000}}, // Last Spurious block
+				{4370000, ID{Hash: checksumToBytes(0xa00bc324), Next: 0}},       // First Byzantium block
+				{7987396, ID{Hash: checksumToBytes(0xa00bc324), Next: 0}},       // Future Byzantium block
+			},
+		},
+		// ProgPoW test cases
+		{
+			progpowConfig,
+			params.MainnetGenesisHash,
+			[]testcase{
+				{0, ID{Hash: checksumToBytes(0xfc64ec04), Next: 1150000}},                          // Unsynced
+				{4370000, ID{Hash: checksumToBytes(0xa00bc324), Next: 5000000}},                    // First Byzantium block
+				{4999999, ID{Hash: checksumToBytes(0xa00bc324), Next: 5000000}},                    // Last Byzantium block
+				{5000000, ID{Hash: checksumToBytes(checksumUpdate(0xa00bc324, 5000000)), Next: 0}}, // First ProgPoW block
+			},
+		},
+	}
+	for i, tt := range tests {
+		for j, ttt := range tt.cases {
+			if have := newID(tt.config, tt.genesis, ttt.head); have != ttt.want {
+				t.Errorf("test %d, case %d: fork ID mismatch: have %x, want %x", i, j, have, ttt.want)
+			}
+		}
+	}
+}
+
+// TestValidation tests that a local peer correctly validates and accepts a
+// remote fork ID.
+func TestValidation(t *testing.T) {
+	progpow := checksumToBytes(checksumUpdate(0xa00bc324, 5000000))
+
+	tests := []struct {
+		config *params.ChainConfig
+		head   uint64
+		id     ID
+		err    error
+	}{
+		// Local is mainnet Byzantium, remote announces the same. No future fork is announced.
+		{params.MainnetChainConfig, 7987396, ID{Hash: checksumToBytes(0xa00bc324), Next: 0}, nil},
+
+		// Local is mainnet Byzantium, remote announces the same. Remote also announces a next fork
+		// at block 0xffffffff, but that is uncertain.
+		{params.MainnetChainConfig, 7987396, ID{Hash: checksumToBytes(0xa00bc324), Next: math.MaxUint32}, nil},
+
+		// Local is mainnet currently in Spurious only (so it's aware of Byzantium), remote announces
+		// also Spurious, but it's not yet aware of Byzantium (e.g. non updated node before the fork).
+		// In this case we don't know if Byzantium passed yet or not.
+		{params.MainnetChainConfig, 4369999, ID{Hash: checksumToBytes(0x3edd5b10), Next: 0}, nil},
+
+		// Local is mainnet Spurious, remote announces Byzantium. Local is out of sync, accept.
+		{params.MainnetChainConfig, 2675000, ID{Hash: checksumToBytes(0xa00bc324), Next: 0}, nil},
+
+		// Local is mainnet Byzantium, remote is Spurious and correctly announces Byzantium. Remote
+		// is simply out of sync, accept.
+		{params.MainnetChainConfig, 7987396, ID{Hash: checksumToBytes(0x3edd5b10), Next: 4370000}, nil},
+
+		// Local is mainnet Byzantium, remote is Spurious without knowledge of Byzantium. Remote is
+		// definitely out of date, reject.
+		{params.MainnetChainConfig, 7987396, ID{Hash: checksumToBytes(0x3edd5b10), Next: 0}, ErrRemoteStale},
+
+		// Local is mainnet Spurious, remote is Byzantium, but it's announcing the next fork at a
+		// block we've already passed. Local is incompatible, reject.
+		{params.MainnetChainConfig, 4369999, ID{Hash: checksumToBytes(0x3edd5b10), Next: 4000000}, ErrLocalIncompatibleOrStale},
+
+		// Local is mainnet Byzantium, remote is Rinkeby Byzantium. Incompatible, reject.
+		{params.MainnetChainConfig, 7987396, ID{Hash: checksumToBytes(0x8e29f2f3), Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Local is past the ProgPoW switch, remote is a Byzantium node unaware of ProgPoW
+		// (still sealing with hashimoto). Remote is stale, reject.
+		{progpowConfig, 5000001, ID{Hash: checksumToBytes(0xa00bc324), Next: 0}, ErrRemoteStale},
+
+		// Local is past the ProgPoW switch, remote is a Byzantium node announcing ProgPoW,
+		// it is still syncing. Accept.
+		{progpowConfig, 5000001, ID{Hash: checksumToBytes(0xa00bc324), Next: 5000000}, nil},
+
+		// Local is past the ProgPoW switch, remote too. Accept.
+		{progpowConfig, 5000001, ID{Hash: progpow, Next: 0}, nil},
+
+		// Local is plain mainnet Byzantium unaware of ProgPoW, remote passed the ProgPoW switch.
+		// Incompatible, reject.
+		{params.MainnetChainConfig, 5000001, ID{Hash: progpow, Next: 0}, ErrLocalIncompatibleOrStale},
+
+		// Local is plain mainnet Byzantium unaware of ProgPoW, remote announces ProgPoW at a
+		// block already passed locally. Reject.
+		{params.MainnetChainConfig, 5000001, ID{Hash: checksumToBytes(0xa00bc324), Next: 5000000}, ErrLocalIncompatibleOrStale},
+	}
+	for i, tt := range tests {
+		filter := newFilter(tt.config, params.MainnetGenesisHash, func() uint64 { return tt.head })
+		if err := filter(tt.id); err != tt.err {
+			t.Errorf("test %d: validation error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+// Tests that IDs are properly RLP encoded (specifically important because we
+// use uint32 to store the hash, but we need to encode it as [4]byte).
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		id   ID
+		want []byte
+	}{
+		{ID{Hash: checksumToBytes(0), Next: 0}, []byte{0xc6, 0x84, 0x00, 0x00, 0x00, 0x00, 0x80}},
+		{ID{Hash: checksumToBytes(0xdeadbeef), Next: 0xBADDCAFE}, []byte{0xca, 0x84, 0xde, 0xad, 0xbe, 0xef, 0x84, 0xba, 0xdd, 0xca, 0xfe}},
+		{ID{Hash: checksumToBytes(math.MaxUint32), Next: math.MaxUint64}, []byte{0xce, 0x84, 0xff, 0xff, 0xff, 0xff, 0x88, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+	}
+	for i, tt := range tests {
+		have, err := rlp.EncodeToBytes(tt.id)
+		if err != nil {
+			t.Errorf("test %d: failed to encode forkid: %v", i, err)
+			continue
+		}
+		if !bytes.Equal(have, tt.want) {
+			t.Errorf("test %d: RLP mismatch: have %x, want %x", i, have, tt.want)
+		}
+	}
+}
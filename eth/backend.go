@@ -31,6 +31,7 @@ import (
 	"github.com/ethereum/go-ethereum/consensus"
 	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/hybrid"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/bloombits"
 	"github.com/ethereum/go-ethereum/core/rawdb"
@@ -54,6 +55,7 @@ import (
 type LesServer interface {
 	Start(srvr *p2p.Server)
 	Stop()
+	APIs() []rpc.API
 	Protocols() []p2p.Protocol
 	SetBloomBitsIndexer(bbIndexer *core.ChainIndexer)
 }
@@ -84,9 +86,10 @@ type Ethereum struct {
 
 	APIBackend *EthAPIBackend
 
-	miner     *miner.Miner
-	gasPrice  *big.Int
-	etherbase common.Address
+	miner        *miner.Miner
+	gasPrice     *big.Int
+	etherbase    common.Address
+	cliqueSigner *clique.ExternalSigner // External signer to seal clique blocks with (nil = local keystore)
 
 	networkID     uint64
 	netRPCService *ethapi.PublicNetAPI
@@ -124,13 +127,18 @@ func New(ctx *node.ServiceContext, config *Config) (*Ethereum, error) {
 	}
 	log.Info("Initialised chain configuration", "config", chainConfig)
 
+	engine, err := CreateConsensusEngine(ctx, EngineChainConfig(chainConfig, config), &config.Ethash, config.MinerNotify, config.MinerNoverify, chainDb)
+	if err != nil {
+		return nil, err
+	}
+
 	eth := &Ethereum{
 		config:         config,
 		chainDb:        chainDb,
 		chainConfig:    chainConfig,
 		eventMux:       ctx.EventMux,
 		accountManager: ctx.AccountManager,
-		engine:         CreateConsensusEngine(ctx, chainConfig, &config.Ethash, config.MinerNotify, config.MinerNoverify, chainDb),
+		engine:         engine,
 		shutdownChan:   make(chan bool),
 		networkID:      config.NetworkId,
 		gasPrice:       config.MinerGasPrice,
@@ -219,13 +227,52 @@ func CreateDB(ctx *node.ServiceContext, config *Config, name string) (ethdb.Data
 	return db, nil
 }
 
+// EngineChainConfig returns the chain config to create the consensus engine with,
+// overriding the trusted clique checkpoint with the locally configured one. The
+// original chain config (persisted in the database) is left untouched.
+func EngineChainConfig(chainConfig *params.ChainConfig, config *Config) *params.ChainConfig {
+	if config.CliqueCheckpoint == nil || chainConfig.Clique == nil {
+		return chainConfig
+	}
+	engineConfig, cliqueConfig := *chainConfig, *chainConfig.Clique
+	cliqueConfig.Checkpoint = config.CliqueCheckpoint
+	engineConfig.Clique = &cliqueConfig
+
+	return &engineConfig
+}
+
 // CreateConsensusEngine creates the required type of consensus engine instance for an Ethereum service
-func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) consensus.Engine {
+func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool, db ethdb.Database) (consensus.Engine, error) {
 	// If proof-of-authority is requested, set it up
 	if chainConfig.Clique != nil {
-		return clique.New(chainConfig.Clique, db)
+		// If no switch to proof-of-work is scheduled, run clique alone
+		if chainConfig.EthashBlock == nil {
+			return clique.New(chainConfig.Clique, db), nil
+		}
+		if !chainConfig.EthashBlock.IsUint64() {
+			return nil, fmt.Errorf("invalid ethash switch block %v", chainConfig.EthashBlock)
+		}
+		if chainConfig.EthashBlock.Sign() == 0 {
+			return createEthashEngine(ctx, chainConfig, config, notify, noverify), nil
+		}
+		// Otherwise hand the chain over from clique to ethash at the switch block
+		engine, err := hybrid.New(
+			hybrid.Transition{Block: 0, Engine: clique.New(chainConfig.Clique, db)},
+			hybrid.Transition{Block: chainConfig.EthashBlock.Uint64(), Engine: createEthashEngine(ctx, chainConfig, config, notify, noverify)},
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create clique to ethash engine: %v", err)
+		}
+		return engine, nil
 	}
 	// Otherwise assume proof-of-work
+	return createEthashEngine(ctx, chainConfig, config, notify, noverify), nil
+}
+
+// createEthashEngine creates the proof-of-work consensus engine instance in the
+// requested mode. Without a service context the cache directory of the config
+// is used as is.
+func createEthashEngine(ctx *node.ServiceContext, chainConfig *params.ChainConfig, config *ethash.Config, notify []string, noverify bool) consensus.Engine {
 	switch config.PowMode {
 	case ethash.ModeFake:
 		log.Warn("Ethash used in fake mode")
@@ -237,8 +284,12 @@ func CreateConsensusEngine(ctx *node.ServiceContext, chainConfig *params.ChainCo
 		log.Warn("Ethash used in shared mode")
 		return ethash.NewShared(chainConfig.ProgpowBlock)
 	default:
+		cacheDir := config.CacheDir
+		if ctx != nil {
+			cacheDir = ctx.ResolvePath(cacheDir)
+		}
 		engine := ethash.New(ethash.Config{
-			CacheDir:       ctx.ResolvePath(config.CacheDir),
+			CacheDir:       cacheDir,
 			CachesInMem:    config.CachesInMem,
 			CachesOnDisk:   config.CachesOnDisk,
 			DatasetDir:     config.DatasetDir,
@@ -259,6 +310,11 @@ func (s *Ethereum) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	// Append any APIs exposed by the light server
+	if s.lesServer != nil {
+		apis = append(apis, s.lesServer.APIs()...)
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -383,7 +439,11 @@ func (s *Ethereum) shouldPreserve(block *types.Block) bool {
 	// is A, F and G sign the block of round5 and reject the block of opponents
 	// and in the round6, the last available signer B is offline, the whole
 	// network is stuck.
-	if _, ok := s.engine.(*clique.Clique); ok {
+	engine := s.engine
+	if hybrid, ok := engine.(*hybrid.Hybrid); ok {
+		engine = hybrid.Engine(block.NumberU64())
+	}
+	if _, ok := engine.(*clique.Clique); ok {
 		return false
 	}
 	return s.isLocalBlock(block)
@@ -427,13 +487,37 @@ func (s *Ethereum) StartMining(threads int) error {
 			log.Error("Cannot start mining without etherbase", "err", err)
 			return fmt.Errorf("etherbase missing: %v", err)
 		}
-		if clique, ok := s.engine.(*clique.Clique); ok {
-			wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
-			if wallet == nil || err != nil {
-				log.Error("Etherbase account unavailable locally", "err", err)
-				return fmt.Errorf("signer missing: %v", err)
+		if s.config.CliqueSigner != "" {
+			// Sealing keys are held by an external signer, delegate to it
+			signer, err := s.externalSigner()
+			if err != nil {
+				log.Error("External clique signer unavailable", "err", err)
+				return fmt.Errorf("signer unavailable: %v", err)
+			}
+			switch engine := s.engine.(type) {
+			case *clique.Clique:
+				engine.AuthorizeHeaders(eb, signer.SignHeader)
+			case *hybrid.Hybrid:
+				engine.AuthorizeHeaders(eb, signer.SignHeader)
+			}
+		} else {
+			if clique, ok := s.engine.(*clique.Clique); ok {
+				wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+				if wallet == nil || err != nil {
+					log.Error("Etherbase account unavailable locally", "err", err)
+					return fmt.Errorf("signer missing: %v", err)
+				}
+				clique.Authorize(eb, wallet.SignHash)
+			}
+			if hybrid, ok := s.engine.(*hybrid.Hybrid); ok {
+				// Signing is only needed during the proof-of-authority range, so don't
+				// refuse mining with a remote etherbase
+				if wallet, err := s.accountManager.Find(accounts.Account{Address: eb}); wallet != nil && err == nil {
+					hybrid.Authorize(eb, wallet.SignHash)
+				} else {
+					log.Warn("Etherbase account unavailable locally, clique sealing disabled", "err", err)
+				}
 			}
-			clique.Authorize(eb, wallet.SignHash)
 		}
 		// If mining is started, we can disable the transaction rejection mechanism
 		// introduced to speed sync times.
@@ -444,6 +528,22 @@ func (s *Ethereum) StartMining(threads int) error {
 	return nil
 }
 
+// externalSigner returns the external clique signer, connecting to it on first
+// use.
+func (s *Ethereum) externalSigner() (*clique.ExternalSigner, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.cliqueSigner == nil {
+		signer, err := clique.NewExternalSigner(s.config.CliqueSigner)
+		if err != nil {
+			return nil, err
+		}
+		s.cliqueSigner = signer
+	}
+	return s.cliqueSigner, nil
+}
+
 // StopMining terminates the miner, both at the consensus engine level as well as
 // at the block creation level.
 func (s *Ethereum) StopMining() {
@@ -490,6 +590,11 @@ func (s *Ethereum) Start(srvr *p2p.Server) error {
 	// Start the RPC service
 	s.netRPCService = ethapi.NewPublicNetAPI(srvr, s.NetVersion())
 
+	// Keep the fork ID advertised in the local node record up to date
+	if ln := srvr.LocalNode(); ln != nil {
+		s.startEthEntryUpdate(ln)
+	}
+
 	// Figure out a max peers count based on the server limits
 	maxPeers := srvr.MaxPeers
 	if s.config.LightServ > 0 {
@@ -518,6 +623,9 @@ func (s *Ethereum) Stop() error {
 	}
 	s.txPool.Stop()
 	s.miner.Stop()
+	if s.cliqueSigner != nil {
+		s.cliqueSigner.Close()
+	}
 	s.eventMux.Stop()
 
 	s.chainDb.Close()
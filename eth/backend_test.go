@@ -0,0 +1,73 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/consensus/ethash"
+	"github.com/ethereum/go-ethereum/consensus/hybrid"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// Tests that the consensus engine matching the clique to ethash switch of the
+// chain config is created, and that invalid switch blocks are rejected.
+func TestCreateConsensusEngine(t *testing.T) {
+	config := &ethash.Config{PowMode: ethash.ModeFake}
+
+	tests := []struct {
+		switchBlock *big.Int
+		engine      string
+		fail        bool
+	}{
+		{switchBlock: nil, engine: "*clique.Clique"},
+		{switchBlock: big.NewInt(0), engine: "*ethash.Ethash"},
+		{switchBlock: big.NewInt(5), engine: "*hybrid.Hybrid"},
+		{switchBlock: big.NewInt(-1), fail: true},
+	}
+	for i, tt := range tests {
+		chainConfig := *params.AllCliqueProtocolChanges
+		chainConfig.EthashBlock = tt.switchBlock
+
+		engine, err := CreateConsensusEngine(nil, &chainConfig, config, nil, false, ethdb.NewMemDatabase())
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: invalid switch block %v accepted", i, tt.switchBlock)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to create engine: %v", i, err)
+			continue
+		}
+		var kind string
+		switch engine.(type) {
+		case *clique.Clique:
+			kind = "*clique.Clique"
+		case *ethash.Ethash:
+			kind = "*ethash.Ethash"
+		case *hybrid.Hybrid:
+			kind = "*hybrid.Hybrid"
+		}
+		if kind != tt.engine {
+			t.Errorf("test %d: engine mismatch: have %T, want %s", i, engine, tt.engine)
+		}
+	}
+}
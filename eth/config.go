@@ -55,8 +55,9 @@ var DefaultConfig = Config{
 
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
-		Blocks:     20,
-		Percentile: 60,
+		Blocks:        20,
+		Percentile:    60,
+		PendingBlocks: 4,
 	},
 }
 
@@ -90,6 +91,12 @@ type Config struct {
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
 
+	// Checkpoint oracle publishing trusted CHT/BloomTrie roots to light clients
+	CheckpointOracle *params.CheckpointOracleConfig `toml:",omitempty"`
+
+	// Ultra-light client options
+	ULC *ULCConfig `toml:",omitempty"`
+
 	// Database options
 	SkipBcVersionCheck bool `toml:"-"`
 	DatabaseHandles    int  `toml:"-"`
@@ -110,6 +117,10 @@ type Config struct {
 	// Ethash options
 	Ethash ethash.Config
 
+	// Clique options
+	CliqueCheckpoint *params.CliqueCheckpoint `toml:",omitempty"` // Trusted signer set checkpoint overriding the genesis one
+	CliqueSigner     string                   `toml:",omitempty"` // External signer (clef) endpoint to seal blocks with
+
 	// Transaction pool options
 	TxPool core.TxPoolConfig
 
@@ -128,6 +139,18 @@ type Config struct {
 	EVMInterpreter string
 }
 
+// DefaultULCMinTrustedFraction is the default minimum percentage of trusted
+// servers that need to announce a head before an ultra-light client accepts it.
+const DefaultULCMinTrustedFraction = 75
+
+// ULCConfig is the configuration of the ultra-light client mode, in which heads
+// signed by a quorum of trusted LES servers are accepted without verifying the
+// headers themselves.
+type ULCConfig struct {
+	TrustedServers     []string `toml:",omitempty"` // Enode URLs of the trusted LES servers
+	MinTrustedFraction int      `toml:",omitempty"` // Minimum percentage of trusted servers announcing a head
+}
+
 type configMarshaling struct {
 	MinerExtraData hexutil.Bytes
 }
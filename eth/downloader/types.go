@@ -22,8 +22,9 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 )
 
-// peerDropFn is a callback type for dropping a peer detected as malicious.
-type peerDropFn func(id string)
+// peerDropFn is a callback type for dropping a peer detected as malicious or
+// unresponsive, along with the reason the peer is dropped for.
+type peerDropFn func(id string, reason error)
 
 // dataPack is a data message returned by a peer for some query.
 type dataPack interface {
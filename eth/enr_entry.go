@@ -0,0 +1,80 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package eth
+
+import (
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/forkid"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ethEntry is the "eth" ENR entry which advertises the eth protocol and the
+// fork the node is on in the discovery network.
+type ethEntry struct {
+	ForkID forkid.ID // Fork identifier of the chain
+
+	// Ignore additional fields (for forward compatibility).
+	Rest []rlp.RawValue `rlp:"tail"`
+}
+
+// ENRKey implements enr.Entry.
+func (e ethEntry) ENRKey() string {
+	return "eth"
+}
+
+// currentEthEntry constructs the eth entry of the chain at its current head.
+func (pm *ProtocolManager) currentEthEntry() *ethEntry {
+	return &ethEntry{ForkID: forkid.NewID(pm.blockchain)}
+}
+
+// nodeFilter reports whether a discovered node should be dialed. Nodes without
+// a record, found through v4 discovery, are accepted since nothing is known
+// about them. Nodes with a record are only accepted if they advertise the eth
+// protocol on a compatible fork.
+func (pm *ProtocolManager) nodeFilter(n *discover.Node) bool {
+	if n.Record == nil {
+		return true
+	}
+	var entry ethEntry
+	if err := n.Load(&entry); err != nil {
+		return false
+	}
+	return pm.forkFilter(entry.ForkID) == nil
+}
+
+// startEthEntryUpdate keeps the eth entry of the local node record in sync with
+// the fork ID, which changes when the chain head passes a fork block.
+func (eth *Ethereum) startEthEntryUpdate(ln *discover.LocalNode) {
+	var (
+		newHead = make(chan core.ChainHeadEvent, 10)
+		sub     = eth.blockchain.SubscribeChainHeadEvent(newHead)
+	)
+	go func() {
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-newHead:
+				ln.Set(eth.protocolManager.currentEthEntry())
+			case <-sub.Err():
+				return
+			case <-eth.shutdownChan:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,402 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/log"
+)
+
+const (
+	txArriveTimeout = 500 * time.Millisecond // Time allowance before an announced transaction is explicitly requested
+	txGatherSlack   = 100 * time.Millisecond // Interval used to collate almost-expired announces with fetches
+	txFetchTimeout  = 5 * time.Second        // Maximum allotted time to return an explicitly requested transaction
+	maxTxAnnounces  = 4096                   // Maximum number of unique transactions a peer may have announced
+	maxTxRetrievals = 256                    // Maximum number of transactions to request from a peer in one go
+)
+
+// txHasFn is a callback type for checking whether a transaction is already known.
+type txHasFn func(common.Hash) bool
+
+// txAddFn is a callback type for adding a batch of transactions to the pool.
+type txAddFn func([]*types.Transaction) []error
+
+// txRequesterFn is a callback type for sending a transaction retrieval request.
+type txRequesterFn func(peer string, hashes []common.Hash) error
+
+// txAnnounce is the hash notification of the availability of a batch of new
+// transactions at a peer.
+type txAnnounce struct {
+	origin string        // Identifier of the peer originating the notification
+	hashes []common.Hash // Hashes of the transactions being announced
+}
+
+// txDelivery is a batch of transactions arriving from a peer, either as a
+// reply to a request or as a broadcast.
+type txDelivery struct {
+	origin string        // Identifier of the peer delivering the transactions
+	hashes []common.Hash // Hashes of the delivered transactions
+	direct bool          // Whether this is a reply to a retrieval request
+}
+
+// txRequest is an in-flight transaction retrieval request.
+type txRequest struct {
+	hashes []common.Hash // Transactions requested from the peer
+	time   time.Time     // Timestamp of the request
+}
+
+// TxFetcher is responsible for retrieving new transactions based on hash
+// announcements. Announcements of the same transaction by multiple peers are
+// deduplicated, and each transaction is requested from a single peer at a time,
+// moving on to another announcer if the request times out.
+type TxFetcher struct {
+	// Various event channels
+	notify  chan *txAnnounce
+	deliver chan *txDelivery
+	drop    chan string
+	quit    chan struct{}
+
+	// Announce states
+	waitlist  map[common.Hash]time.Time           // Announced transactions waiting to be requested, with the time of the first announce
+	announced map[common.Hash]map[string]struct{} // Peers that announced each transaction not yet delivered
+	announces map[string]map[common.Hash]struct{} // Per peer announces to prevent memory exhaustion
+	fetching  map[common.Hash]string              // Transactions being retrieved, mapped to the peer requested from
+	requests  map[string]*txRequest               // In-flight retrieval requests, one per peer at most
+
+	// Callbacks
+	hasTx    txHasFn       // Checks whether a transaction is already known
+	addTxs   txAddFn       // Injects a batch of transactions into the pool
+	fetchTxs txRequesterFn // Retrieves a batch of transactions from a peer
+}
+
+// NewTxFetcher creates a transaction fetcher to retrieve transactions based on
+// hash announcements.
+func NewTxFetcher(hasTx txHasFn, addTxs txAddFn, fetchTxs txRequesterFn) *TxFetcher {
+	return &TxFetcher{
+		notify:    make(chan *txAnnounce),
+		deliver:   make(chan *txDelivery),
+		drop:      make(chan string),
+		quit:      make(chan struct{}),
+		waitlist:  make(map[common.Hash]time.Time),
+		announced: make(map[common.Hash]map[string]struct{}),
+		announces: make(map[string]map[common.Hash]struct{}),
+		fetching:  make(map[common.Hash]string),
+		requests:  make(map[string]*txRequest),
+		hasTx:     hasTx,
+		addTxs:    addTxs,
+		fetchTxs:  fetchTxs,
+	}
+}
+
+// Start boots up the announcement based transaction retrieval, processing
+// notifications and deliveries until termination requested.
+func (f *TxFetcher) Start() {
+	go f.loop()
+}
+
+// Stop terminates the announcement based transaction retrieval, canceling all
+// pending operations.
+func (f *TxFetcher) Stop() {
+	close(f.quit)
+}
+
+// Notify announces the fetcher of the potential availability of a batch of new
+// transactions at a peer.
+func (f *TxFetcher) Notify(peer string, hashes []common.Hash) error {
+	// Skip any transactions already known, no need to bother the fetcher loop
+	unknown := make([]common.Hash, 0, len(hashes))
+	for _, hash := range hashes {
+		if !f.hasTx(hash) {
+			unknown = append(unknown, hash)
+		}
+	}
+	txAnnounceInMeter.Mark(int64(len(hashes)))
+	txAnnounceKnownMeter.Mark(int64(len(hashes) - len(unknown)))
+	if len(unknown) == 0 {
+		return nil
+	}
+	select {
+	case f.notify <- &txAnnounce{origin: peer, hashes: unknown}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Enqueue injects a batch of transactions received from a peer into the pool,
+// marking them as retrieved. Direct deliveries are the replies to retrieval
+// requests, any requested transaction missing from them is fetched from one of
+// the other announcers.
+func (f *TxFetcher) Enqueue(peer string, txs []*types.Transaction, direct bool) error {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	if direct {
+		txReplyInMeter.Mark(int64(len(txs)))
+	} else {
+		txBroadcastInMeter.Mark(int64(len(txs)))
+	}
+	f.addTxs(txs)
+
+	select {
+	case f.deliver <- &txDelivery{origin: peer, hashes: hashes, direct: direct}:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// Drop removes all the announcements and the pending request of a peer,
+// rescheduling its transactions for retrieval from other peers.
+func (f *TxFetcher) Drop(peer string) error {
+	select {
+	case f.drop <- peer:
+		return nil
+	case <-f.quit:
+		return errTerminated
+	}
+}
+
+// loop is the main transaction fetcher loop, checking and processing various
+// notification events.
+func (f *TxFetcher) loop() {
+	fetchTimer := time.NewTimer(0)
+
+	for {
+		// Clean up any expired transaction retrievals
+		expired := false
+		for peer, req := range f.requests {
+			if time.Since(req.time) > txFetchTimeout {
+				log.Trace("Transaction retrieval timed out", "peer", peer, "count", len(req.hashes))
+				txRequestTimeoutMeter.Mark(int64(len(req.hashes)))
+				f.forgetRequest(peer)
+				expired = true
+			}
+		}
+		if expired {
+			f.rescheduleFetch(fetchTimer)
+		}
+		// Wait for an outside event to occur
+		select {
+		case <-f.quit:
+			// Fetcher terminating, abort all operations
+			return
+
+		case notification := <-f.notify:
+			// A batch of transactions was announced, make sure the peer isn't DOSing us
+			announces := f.announces[notification.origin]
+			if announces == nil {
+				announces = make(map[common.Hash]struct{})
+				f.announces[notification.origin] = announces
+			}
+			for _, hash := range notification.hashes {
+				if _, ok := announces[hash]; ok {
+					continue
+				}
+				if len(announces) >= maxTxAnnounces {
+					log.Debug("Peer exceeded outstanding transaction announces", "peer", notification.origin, "limit", maxTxAnnounces)
+					txAnnounceDOSMeter.Mark(1)
+					break
+				}
+				announces[hash] = struct{}{}
+
+				// Schedule the transaction for retrieval unless it's already scheduled
+				if f.announced[hash] == nil {
+					f.announced[hash] = make(map[string]struct{})
+					if _, ok := f.fetching[hash]; !ok {
+						f.waitlist[hash] = time.Now()
+					}
+				}
+				f.announced[hash][notification.origin] = struct{}{}
+			}
+			if len(f.waitlist) > 0 {
+				f.rescheduleFetch(fetchTimer)
+			}
+
+		case delivery := <-f.deliver:
+			// A batch of transactions arrived, stop tracking them
+			for _, hash := range delivery.hashes {
+				f.forgetHash(hash)
+			}
+			// If the peer replied to a request, anything missing isn't available there
+			if delivery.direct {
+				if _, ok := f.requests[delivery.origin]; ok {
+					f.forgetRequest(delivery.origin)
+				}
+			}
+			f.rescheduleFetch(fetchTimer)
+
+		case peer := <-f.drop:
+			// A peer disconnected, retrieve its transactions from the other announcers
+			if _, ok := f.requests[peer]; ok {
+				f.forgetRequest(peer)
+			}
+			for hash := range f.announces[peer] {
+				f.forgetAnnounce(peer, hash)
+			}
+			delete(f.announces, peer)
+			f.rescheduleFetch(fetchTimer)
+
+		case <-fetchTimer.C:
+			// At least one transaction's timer ran out, check for needing retrieval
+			request := make(map[string][]common.Hash)
+
+			for hash, announced := range f.waitlist {
+				if time.Since(announced) < txArriveTimeout-txGatherSlack {
+					continue
+				}
+				// Pick an idle peer to retrieve from, preferring ones already picked
+				var origin string
+				for peer := range f.announced[hash] {
+					if hashes, ok := request[peer]; ok && len(hashes) < maxTxRetrievals {
+						origin = peer
+						break
+					}
+					if _, busy := f.requests[peer]; !busy && request[peer] == nil && origin == "" {
+						origin = peer
+					}
+				}
+				if origin == "" {
+					continue // All announcers are busy, try again later
+				}
+				request[origin] = append(request[origin], hash)
+				f.fetching[hash] = origin
+				delete(f.waitlist, hash)
+			}
+			// Send out all transaction requests
+			for peer, hashes := range request {
+				log.Trace("Fetching scheduled transactions", "peer", peer, "count", len(hashes))
+				f.requests[peer] = &txRequest{hashes: hashes, time: time.Now()}
+
+				// Create a closure of the fetch and schedule in on a new thread
+				peer, hashes := peer, hashes
+				go func() {
+					txRequestOutMeter.Mark(int64(len(hashes)))
+					if err := f.fetchTxs(peer, hashes); err != nil {
+						log.Debug("Failed to request transactions", "peer", peer, "err", err)
+					}
+				}()
+			}
+			// Schedule the next fetch if transactions are still pending
+			f.rescheduleFetch(fetchTimer)
+		}
+	}
+}
+
+// rescheduleFetch resets the specified fetch timer to the next announce or
+// retrieval timeout.
+func (f *TxFetcher) rescheduleFetch(fetch *time.Timer) {
+	// Short circuit if no transactions are tracked
+	if len(f.waitlist) == 0 && len(f.requests) == 0 {
+		return
+	}
+	// Otherwise find the earliest expiring announcement or request
+	var (
+		now      = time.Now()
+		earliest = now.Add(txFetchTimeout)
+	)
+	for hash, announced := range f.waitlist {
+		deadline := announced.Add(txArriveTimeout)
+		if !deadline.After(now) && !f.hasIdleAnnouncer(hash) {
+			continue // Overdue, but wait for an announcer to finish its request
+		}
+		if deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+	for _, req := range f.requests {
+		if deadline := req.time.Add(txFetchTimeout); deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+	// Drain the timer before resetting it, it might have fired meanwhile
+	if !fetch.Stop() {
+		select {
+		case <-fetch.C:
+		default:
+		}
+	}
+	fetch.Reset(earliest.Sub(now))
+}
+
+// hasIdleAnnouncer reports whether any of the peers that announced a transaction
+// has no request in flight.
+func (f *TxFetcher) hasIdleAnnouncer(hash common.Hash) bool {
+	for peer := range f.announced[hash] {
+		if _, busy := f.requests[peer]; !busy {
+			return true
+		}
+	}
+	return false
+}
+
+// forgetRequest removes the pending request of a peer. Any transaction in it
+// which didn't arrive yet is considered unavailable at the peer and scheduled
+// for retrieval from the other announcers.
+func (f *TxFetcher) forgetRequest(peer string) {
+	for _, hash := range f.requests[peer].hashes {
+		if f.fetching[hash] != peer {
+			continue // Already delivered
+		}
+		delete(f.fetching, hash)
+		f.forgetAnnounce(peer, hash)
+
+		if f.announced[hash] != nil {
+			// Make it eligible for retrieval right away
+			f.waitlist[hash] = time.Now().Add(-txArriveTimeout)
+		}
+	}
+	delete(f.requests, peer)
+}
+
+// forgetAnnounce removes a single transaction announcement of a peer, dropping
+// the transaction altogether if no other peer announced it.
+func (f *TxFetcher) forgetAnnounce(peer string, hash common.Hash) {
+	if announces := f.announces[peer]; announces != nil {
+		delete(announces, hash)
+		if len(announces) == 0 {
+			delete(f.announces, peer)
+		}
+	}
+	if announced := f.announced[hash]; announced != nil {
+		delete(announced, peer)
+		if len(announced) == 0 {
+			delete(f.announced, hash)
+			delete(f.waitlist, hash)
+		}
+	}
+}
+
+// forgetHash removes all traces of a transaction from the fetcher's internal
+// state.
+func (f *TxFetcher) forgetHash(hash common.Hash) {
+	for peer := range f.announced[hash] {
+		if announces := f.announces[peer]; announces != nil {
+			delete(announces, hash)
+			if len(announces) == 0 {
+				delete(f.announces, peer)
+			}
+		}
+	}
+	delete(f.announced, hash)
+	delete(f.waitlist, hash)
+	delete(f.fetching, hash)
+}
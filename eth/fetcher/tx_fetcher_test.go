@@ -0,0 +1,240 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package fetcher
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// txRetrieval is a transaction retrieval request issued by the fetcher.
+type txRetrieval struct {
+	peer   string
+	hashes []common.Hash
+}
+
+// txFetcherTester is a test simulator for mocking out a transaction pool.
+type txFetcherTester struct {
+	fetcher  *TxFetcher
+	requests chan txRetrieval
+
+	lock sync.RWMutex
+	pool map[common.Hash]*types.Transaction
+}
+
+// newTxTester creates a new transaction fetcher test mocker.
+func newTxTester() *txFetcherTester {
+	tester := &txFetcherTester{
+		requests: make(chan txRetrieval, 16),
+		pool:     make(map[common.Hash]*types.Transaction),
+	}
+	tester.fetcher = NewTxFetcher(tester.hasTx, tester.addTxs, tester.fetchTxs)
+	return tester
+}
+
+// hasTx checks whether a transaction is contained in the simulated pool.
+func (f *txFetcherTester) hasTx(hash common.Hash) bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.pool[hash] != nil
+}
+
+// addTxs injects a batch of transactions into the simulated pool.
+func (f *txFetcherTester) addTxs(txs []*types.Transaction) []error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, tx := range txs {
+		f.pool[tx.Hash()] = tx
+	}
+	return make([]error, len(txs))
+}
+
+// fetchTxs records a transaction retrieval request.
+func (f *txFetcherTester) fetchTxs(peer string, hashes []common.Hash) error {
+	f.requests <- txRetrieval{peer: peer, hashes: hashes}
+	return nil
+}
+
+// expectRequest waits for a retrieval request of the given transactions from
+// the given peer.
+func (f *txFetcherTester) expectRequest(t *testing.T, peer string, txs ...*types.Transaction) {
+	select {
+	case req := <-f.requests:
+		if req.peer != peer {
+			t.Fatalf("request peer mismatch: have %s, want %s", req.peer, peer)
+		}
+		want := make(map[common.Hash]bool)
+		for _, tx := range txs {
+			want[tx.Hash()] = true
+		}
+		if len(req.hashes) != len(want) {
+			t.Fatalf("request size mismatch: have %d, want %d", len(req.hashes), len(want))
+		}
+		for _, hash := range req.hashes {
+			if !want[hash] {
+				t.Fatalf("unexpected transaction requested: %x", hash)
+			}
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("transactions not requested from %s", peer)
+	}
+}
+
+// expectNoRequest checks that no retrieval request is issued.
+func (f *txFetcherTester) expectNoRequest(t *testing.T) {
+	select {
+	case req := <-f.requests:
+		t.Fatalf("unexpected request to %s: %x", req.peer, req.hashes)
+	case <-time.After(txArriveTimeout + 100*time.Millisecond):
+	}
+}
+
+// makeTxs creates a batch of distinct transactions.
+func makeTxs(n int) []*types.Transaction {
+	txs := make([]*types.Transaction, n)
+	for i := range txs {
+		txs[i] = types.NewTransaction(uint64(i), common.Address{}, big.NewInt(0), 0, big.NewInt(0), nil)
+	}
+	return txs
+}
+
+func hashes(txs []*types.Transaction) []common.Hash {
+	hashes := make([]common.Hash, len(txs))
+	for i, tx := range txs {
+		hashes[i] = tx.Hash()
+	}
+	return hashes
+}
+
+// Tests that announced transactions are retrieved, and that announcements of
+// the same transactions by multiple peers are deduplicated.
+func TestTxFetcherDeduplication(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(3)
+	tester.fetcher.Notify("A", hashes(txs))
+	tester.fetcher.Notify("B", hashes(txs))
+
+	// Wait for the transactions to be requested from one of the peers
+	var req txRetrieval
+	select {
+	case req = <-tester.requests:
+		if len(req.hashes) != len(txs) {
+			t.Fatalf("request size mismatch: have %d, want %d", len(req.hashes), len(txs))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("transactions not requested")
+	}
+	tester.fetcher.Enqueue(req.peer, txs, true)
+	tester.expectNoRequest(t)
+
+	for _, tx := range txs {
+		if !tester.hasTx(tx.Hash()) {
+			t.Errorf("transaction %x not added to the pool", tx.Hash())
+		}
+	}
+}
+
+// Tests that already known transactions and transactions arriving through a
+// broadcast in the meantime are not retrieved.
+func TestTxFetcherSkipKnown(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(3)
+	tester.addTxs(txs[:1])
+
+	tester.fetcher.Notify("A", hashes(txs))
+	tester.fetcher.Enqueue("B", txs[1:2], false)
+	tester.expectRequest(t, "A", txs[2])
+}
+
+// Tests that transactions missing from a reply are retrieved from another peer
+// announcing them.
+func TestTxFetcherMissingReply(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(2)
+	tester.fetcher.Notify("A", hashes(txs))
+	tester.expectRequest(t, "A", txs...)
+
+	// Once the first peer is busy, another announcer can't be picked
+	tester.fetcher.Notify("B", hashes(txs))
+	tester.fetcher.Enqueue("A", txs[:1], true)
+	tester.expectRequest(t, "B", txs[1])
+
+	// Nobody else announced the transaction, an empty reply drops it
+	tester.fetcher.Enqueue("B", nil, true)
+	tester.expectNoRequest(t)
+}
+
+// Tests that the transactions being retrieved from a dropped peer are retrieved
+// from another peer announcing them.
+func TestTxFetcherDrop(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(2)
+	tester.fetcher.Notify("A", hashes(txs))
+	tester.expectRequest(t, "A", txs...)
+
+	tester.fetcher.Notify("B", hashes(txs[1:]))
+	tester.fetcher.Drop("A")
+	tester.expectRequest(t, "B", txs[1])
+}
+
+// Tests that a peer can't make the fetcher track an unbounded number of
+// transactions.
+func TestTxFetcherDOSProtection(t *testing.T) {
+	tester := newTxTester()
+	tester.fetcher.Start()
+	defer tester.fetcher.Stop()
+
+	txs := makeTxs(maxTxAnnounces + 10)
+	tester.fetcher.Notify("A", hashes(txs))
+
+	// Reply empty to all requests, dropping the requested transactions
+	requested := 0
+	for done := false; !done; {
+		select {
+		case req := <-tester.requests:
+			if len(req.hashes) > maxTxRetrievals {
+				t.Fatalf("request too large: have %d, limit %d", len(req.hashes), maxTxRetrievals)
+			}
+			requested += len(req.hashes)
+			tester.fetcher.Enqueue("A", nil, true)
+		case <-time.After(txArriveTimeout + 100*time.Millisecond):
+			done = true
+		}
+	}
+	if requested != maxTxAnnounces {
+		t.Errorf("requested transactions mismatch: have %d, want %d", requested, maxTxAnnounces)
+	}
+}
@@ -163,9 +163,30 @@ func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
 	return logs, err
 }
 
+// matchRetrievalThreads is the maximum number of blocks matched by the bloom
+// filter whose logs are retrieved concurrently. Light clients need at least one
+// network round trip per matching block, so checking them one after the other
+// would make filtering long ranges very slow.
+const matchRetrievalThreads = 16
+
+// matchResult is the outcome of checking a single block matched by the bloom
+// filter for truly matching logs.
+type matchResult struct {
+	number uint64
+	logs   []*types.Log
+	err    error
+}
+
 // indexedLogs returns the logs matching the filter criteria based on the bloom
 // bits indexed available locally or via the network.
+//
+// The logs of the blocks matched by the bloom filter are retrieved concurrently
+// but are accumulated in order, so if the retrieval fails, the filter can be
+// resumed from the first block not yet processed.
 func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
 	// Create a matcher session and request servicing from the backend
 	matches := make(chan uint64, 64)
 
@@ -177,37 +198,63 @@ func (f *Filter) indexedLogs(ctx context.Context, end uint64) ([]*types.Log, err
 
 	f.backend.ServiceFilter(ctx, session)
 
-	// Iterate over the matches until exhausted or context closed
-	var logs []*types.Log
-
-	for {
-		select {
-		case number, ok := <-matches:
-			// Abort if all matches have been fulfilled
-			if !ok {
-				err := session.Error()
-				if err == nil {
-					f.begin = int64(end) + 1
+	// Start retrieving the logs of the matching blocks, queueing up the pending
+	// results in order of the matches
+	results := make(chan chan matchResult, matchRetrievalThreads)
+	go func() {
+		defer close(results)
+		for {
+			select {
+			case number, ok := <-matches:
+				if !ok {
+					return
 				}
-				return logs, err
-			}
-			f.begin = int64(number) + 1
+				result := make(chan matchResult, 1)
+				select {
+				case results <- result:
+				case <-ctx.Done():
+					return
+				}
+				go func() { result <- f.matchLogs(ctx, number) }()
 
-			// Retrieve the suggested block and pull any truly matching logs
-			header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
-			if header == nil || err != nil {
-				return logs, err
-			}
-			found, err := f.checkMatches(ctx, header)
-			if err != nil {
-				return logs, err
+			case <-ctx.Done():
+				return
 			}
-			logs = append(logs, found...)
+		}
+	}()
+	// Iterate over the matches until exhausted or context closed
+	var logs []*types.Log
+
+	for result := range results {
+		res := <-result
+		if res.err != nil {
+			return logs, res.err
+		}
+		f.begin = int64(res.number) + 1
+		logs = append(logs, res.logs...)
+	}
+	if err := ctx.Err(); err != nil {
+		return logs, err
+	}
+	if err := session.Error(); err != nil {
+		return logs, err
+	}
+	f.begin = int64(end) + 1
+	return logs, nil
+}
 
-		case <-ctx.Done():
-			return logs, ctx.Err()
+// matchLogs retrieves a block suggested by the bloom filter and pulls any truly
+// matching logs.
+func (f *Filter) matchLogs(ctx context.Context, number uint64) matchResult {
+	header, err := f.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if header == nil || err != nil {
+		if err == nil {
+			err = errors.New("unknown block")
 		}
+		return matchResult{number: number, err: err}
 	}
+	found, err := f.checkMatches(ctx, header)
+	return matchResult{number: number, logs: found, err: err}
 }
 
 // indexedLogs returns the logs matching the filter criteria based on raw block
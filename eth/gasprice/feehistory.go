@@ -0,0 +1,237 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	// maxFeeHistory is the maximum number of blocks a single fee history
+	// request can cover.
+	maxFeeHistory = 1024
+
+	// maxFeeHistoryWorkers is the maximum number of blocks a single fee history
+	// request retrieves concurrently.
+	maxFeeHistoryWorkers = 4
+
+	// feeCacheSize is the number of processed blocks to keep the gas usage and
+	// price distribution of, so repeated history queries don't reload bodies.
+	feeCacheSize = 2048
+)
+
+var (
+	// errInvalidPercentile is returned if the requested reward percentiles are
+	// out of range or not in ascending order.
+	errInvalidPercentile = errors.New("invalid reward percentile")
+
+	// errRequestBeyondHead is returned if the fee history is requested for a
+	// block past the current head.
+	errRequestBeyondHead = errors.New("request beyond head block")
+)
+
+// txGasAndPrice is the gas used by a transaction along with the price paid.
+type txGasAndPrice struct {
+	gasUsed uint64
+	price   *big.Int
+}
+
+// blockFees is the processed gas usage and price distribution of a block.
+type blockFees struct {
+	gasUsed  uint64
+	gasLimit uint64
+	txs      []txGasAndPrice // Transactions in ascending gas price order
+}
+
+// ratio returns the fraction of the block gas limit consumed by transactions.
+func (fees *blockFees) ratio() float64 {
+	if fees.gasLimit == 0 {
+		return 0
+	}
+	return float64(fees.gasUsed) / float64(fees.gasLimit)
+}
+
+// rewards returns the gas prices paid at the given percentiles of the block's
+// gas usage, weighting each transaction by the gas it consumed.
+func (fees *blockFees) rewards(percentiles []float64) []*big.Int {
+	rewards := make([]*big.Int, len(percentiles))
+	if len(fees.txs) == 0 {
+		for i := range rewards {
+			rewards[i] = new(big.Int)
+		}
+		return rewards
+	}
+	var (
+		index  int
+		sumGas = fees.txs[0].gasUsed
+	)
+	for i, p := range percentiles {
+		threshold := uint64(float64(fees.gasUsed) * p / 100)
+		for sumGas < threshold && index < len(fees.txs)-1 {
+			index++
+			sumGas += fees.txs[index].gasUsed
+		}
+		rewards[i] = new(big.Int).Set(fees.txs[index].price)
+	}
+	return rewards
+}
+
+// FeeHistory returns the gas used ratio and the gas prices paid at the given
+// percentiles of the gas usage for a range of blocks ending at lastBlock. The
+// range is truncated at the genesis block and to at most maxFeeHistory blocks.
+// The number of the oldest returned block is returned along with the data.
+func (gpo *Oracle) FeeHistory(ctx context.Context, blocks int, lastBlock rpc.BlockNumber, percentiles []float64) (*big.Int, [][]*big.Int, []float64, error) {
+	for i, p := range percentiles {
+		if p < 0 || p > 100 || (i > 0 && p < percentiles[i-1]) {
+			return nil, nil, nil, fmt.Errorf("%v: %f", errInvalidPercentile, p)
+		}
+	}
+	if blocks < 1 {
+		return new(big.Int), nil, nil, nil
+	}
+	if blocks > maxFeeHistory {
+		blocks = maxFeeHistory
+	}
+	// Resolve the last block of the range, rejecting anything past the head
+	head, err := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if head == nil {
+		return nil, nil, nil, err
+	}
+	last := head.Number.Uint64()
+	if lastBlock >= 0 {
+		if uint64(lastBlock) > last {
+			return nil, nil, nil, errRequestBeyondHead
+		}
+		last = uint64(lastBlock)
+	}
+	if uint64(blocks) > last+1 {
+		blocks = int(last + 1)
+	}
+	oldest := last + 1 - uint64(blocks)
+
+	// Retrieve the fees of the blocks with a bounded set of workers and assemble
+	// the results
+	type result struct {
+		index int
+		fees  *blockFees
+		err   error
+	}
+	var (
+		indexes = make(chan int, blocks)
+		results = make(chan result, blocks)
+	)
+	for i := 0; i < blocks; i++ {
+		indexes <- i
+	}
+	close(indexes)
+
+	workers := maxFeeHistoryWorkers
+	if workers > blocks {
+		workers = blocks
+	}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for index := range indexes {
+				fees, err := gpo.blockFees(ctx, oldest+uint64(index))
+				results <- result{index, fees, err}
+			}
+		}()
+	}
+	var (
+		ratios  = make([]float64, blocks)
+		rewards [][]*big.Int
+	)
+	if len(percentiles) > 0 {
+		rewards = make([][]*big.Int, blocks)
+	}
+	for i := 0; i < blocks; i++ {
+		res := <-results
+		if res.err != nil {
+			err = res.err
+			continue
+		}
+		ratios[res.index] = res.fees.ratio()
+		if rewards != nil {
+			rewards[res.index] = res.fees.rewards(percentiles)
+		}
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return new(big.Int).SetUint64(oldest), rewards, ratios, nil
+}
+
+// blockFees retrieves the processed gas usage and price distribution of a block,
+// loading it from the cache if it was already processed.
+func (gpo *Oracle) blockFees(ctx context.Context, number uint64) (*blockFees, error) {
+	header, err := gpo.backend.HeaderByNumber(ctx, rpc.BlockNumber(number))
+	if header == nil {
+		if err == nil {
+			err = fmt.Errorf("block #%d not found", number)
+		}
+		return nil, err
+	}
+	hash := header.Hash()
+	if fees, ok := gpo.feeCache.Get(hash); ok {
+		return fees.(*blockFees), nil
+	}
+	fees := &blockFees{
+		gasUsed:  header.GasUsed,
+		gasLimit: header.GasLimit,
+	}
+	if header.TxHash != types.EmptyRootHash {
+		if fees.txs, err = gpo.blockTransactionFees(ctx, hash); err != nil {
+			return nil, err
+		}
+	}
+	gpo.feeCache.Add(hash, fees)
+	return fees, nil
+}
+
+// blockTransactionFees loads the body and receipts of a block and returns the
+// gas used and price paid by its transactions in ascending price order.
+func (gpo *Oracle) blockTransactionFees(ctx context.Context, hash common.Hash) ([]txGasAndPrice, error) {
+	block, err := gpo.backend.GetBlock(ctx, hash)
+	if block == nil {
+		if err == nil {
+			err = fmt.Errorf("block %x not found", hash)
+		}
+		return nil, err
+	}
+	receipts, err := gpo.backend.GetReceipts(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	txs := block.Transactions()
+	if len(receipts) != len(txs) {
+		return nil, fmt.Errorf("receipt count mismatch: have %d, want %d", len(receipts), len(txs))
+	}
+	fees := make([]txGasAndPrice, len(txs))
+	for i, tx := range txs {
+		fees[i] = txGasAndPrice{gasUsed: receipts[i].GasUsed, price: tx.GasPrice()}
+	}
+	sort.Slice(fees, func(i, j int) bool { return fees[i].price.Cmp(fees[j].price) < 0 })
+	return fees, nil
+}
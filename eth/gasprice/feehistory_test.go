@@ -0,0 +1,212 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"math/big"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// testBackend is a mock oracle backend serving a fixed chain of blocks, each
+// containing transactions consuming 21000 gas at the given prices.
+type testBackend struct {
+	ethapi.Backend
+	blocks  []*types.Block
+	bodies  int32 // Number of block bodies loaded
+	loading int32 // Number of block bodies being loaded concurrently
+	peak    int32 // Maximum number of block bodies loaded concurrently
+	pending int   // Number of transactions pending in the pool
+}
+
+func newTestBackend(prices [][]int64) *testBackend {
+	var (
+		key, _  = crypto.GenerateKey()
+		signer  = types.NewEIP155Signer(params.TestChainConfig.ChainID)
+		backend = new(testBackend)
+	)
+	for i, txPrices := range prices {
+		var txs []*types.Transaction
+		for j, price := range txPrices {
+			tx, _ := types.SignTx(types.NewTransaction(uint64(j), common.Address{}, nil, 21000, big.NewInt(price), nil), signer, key)
+			txs = append(txs, tx)
+		}
+		header := &types.Header{
+			Number:   big.NewInt(int64(i)),
+			GasLimit: 21000 * 10,
+			GasUsed:  uint64(21000 * len(txs)),
+		}
+		backend.blocks = append(backend.blocks, types.NewBlock(header, txs, nil, nil))
+	}
+	return backend
+}
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	if number == rpc.LatestBlockNumber {
+		number = rpc.BlockNumber(len(b.blocks) - 1)
+	}
+	return b.blocks[number].Header(), nil
+}
+
+func (b *testBackend) GetBlock(ctx context.Context, hash common.Hash) (*types.Block, error) {
+	atomic.AddInt32(&b.bodies, 1)
+
+	loading := atomic.AddInt32(&b.loading, 1)
+	defer atomic.AddInt32(&b.loading, -1)
+	for peak := atomic.LoadInt32(&b.peak); loading > peak; peak = atomic.LoadInt32(&b.peak) {
+		if atomic.CompareAndSwapInt32(&b.peak, peak, loading) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond) // Give concurrent loads a chance to overlap
+	for _, block := range b.blocks {
+		if block.Hash() == hash {
+			return block, nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *testBackend) GetReceipts(ctx context.Context, hash common.Hash) (types.Receipts, error) {
+	for _, block := range b.blocks {
+		if block.Hash() == hash {
+			receipts := make(types.Receipts, len(block.Transactions()))
+			for i := range receipts {
+				receipts[i] = &types.Receipt{GasUsed: 21000}
+			}
+			return receipts, nil
+		}
+	}
+	return nil, nil
+}
+
+func (b *testBackend) Stats() (int, int) { return b.pending, 0 }
+
+func (b *testBackend) BlockByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Block, error) {
+	return b.blocks[number], nil
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+
+// Tests that the fee history reports the gas usage ratios and reward percentiles
+// of the requested range, and that processed blocks are served from the cache.
+func TestFeeHistory(t *testing.T) {
+	backend := newTestBackend([][]int64{
+		{},
+		{10, 20, 30, 40},
+		{5},
+		{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+	})
+	oracle := NewOracle(backend, Config{Blocks: 1, Percentile: 50, Default: big.NewInt(1)})
+
+	oldest, rewards, ratios, err := oracle.FeeHistory(context.Background(), 3, rpc.LatestBlockNumber, []float64{0, 50, 100})
+	if err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if oldest.Uint64() != 1 {
+		t.Errorf("oldest block mismatch: have %v, want 1", oldest)
+	}
+	wantRatios := []float64{0.4, 0.1, 1}
+	wantRewards := [][]int64{{10, 20, 40}, {5, 5, 5}, {1, 5, 10}}
+	for i := range wantRatios {
+		if ratios[i] != wantRatios[i] {
+			t.Errorf("block %d: gas used ratio mismatch: have %v, want %v", i+1, ratios[i], wantRatios[i])
+		}
+		for j, want := range wantRewards[i] {
+			if rewards[i][j].Int64() != want {
+				t.Errorf("block %d, percentile %d: reward mismatch: have %v, want %v", i+1, j, rewards[i][j], want)
+			}
+		}
+	}
+	// Repeated queries should not reload any block bodies
+	loaded := atomic.LoadInt32(&backend.bodies)
+	if _, _, _, err := oracle.FeeHistory(context.Background(), 4, 3, nil); err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	if bodies := atomic.LoadInt32(&backend.bodies); bodies != loaded {
+		t.Errorf("cached blocks reloaded: have %d bodies, want %d", bodies, loaded)
+	}
+	// Invalid requests should be rejected
+	if _, _, _, err := oracle.FeeHistory(context.Background(), 1, 4, nil); err != errRequestBeyondHead {
+		t.Errorf("future block error mismatch: have %v, want %v", err, errRequestBeyondHead)
+	}
+	if _, _, _, err := oracle.FeeHistory(context.Background(), 1, 3, []float64{50, 10}); err == nil {
+		t.Errorf("unordered percentiles accepted")
+	}
+}
+
+// Tests that the blocks of a fee history request are retrieved by a bounded
+// number of workers.
+func TestFeeHistoryConcurrency(t *testing.T) {
+	prices := make([][]int64, 64)
+	for i := range prices {
+		prices[i] = []int64{int64(i + 1)}
+	}
+	backend := newTestBackend(prices)
+	oracle := NewOracle(backend, Config{Blocks: 1, Percentile: 50, Default: big.NewInt(1)})
+
+	_, rewards, _, err := oracle.FeeHistory(context.Background(), len(prices), rpc.LatestBlockNumber, []float64{50})
+	if err != nil {
+		t.Fatalf("failed to retrieve fee history: %v", err)
+	}
+	for i, reward := range rewards {
+		if reward[0].Int64() != prices[i][0] {
+			t.Errorf("block %d: reward mismatch: have %v, want %v", i, reward[0], prices[i][0])
+		}
+	}
+	if peak := atomic.LoadInt32(&backend.peak); peak > maxFeeHistoryWorkers {
+		t.Errorf("concurrent block retrievals mismatch: have %d, want at most %d", peak, maxFeeHistoryWorkers)
+	}
+}
+
+// Tests that the suggested price is raised towards the highest sampled price if
+// the transaction pool holds a backlog of pending transactions.
+func TestSuggestPricePoolPressure(t *testing.T) {
+	backend := newTestBackend([][]int64{{}, {10, 10}, {20, 20}, {30, 30}, {40, 40}, {50, 50}})
+	oracle := NewOracle(backend, Config{Blocks: 5, Percentile: 0, PendingBlocks: 4, Default: big.NewInt(1)})
+
+	tests := []struct {
+		pending int
+		price   int64
+	}{
+		{0, 10},   // no backlog
+		{2, 10},   // a single block worth
+		{4, 20},   // two blocks worth, quarter way up
+		{6, 30},   // three blocks worth, half way up
+		{10, 50},  // five blocks worth, all the way up
+		{100, 50}, // capped at the highest price
+	}
+	for _, tt := range tests {
+		backend.pending = tt.pending
+		price, err := oracle.SuggestPrice(context.Background())
+		if err != nil {
+			t.Fatalf("pending %d: failed to suggest price: %v", tt.pending, err)
+		}
+		if price.Int64() != tt.price {
+			t.Errorf("pending %d: price mismatch: have %v, want %v", tt.pending, price, tt.price)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package gasprice
 
 import (
 	"context"
+	"math"
 	"math/big"
 	"sort"
 	"sync"
@@ -27,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rpc"
+	lru "github.com/hashicorp/golang-lru"
 )
 
 var maxPrice = big.NewInt(500 * params.GWei)
@@ -35,19 +37,28 @@ type Config struct {
 	Blocks     int
 	Percentile int
 	Default    *big.Int `toml:",omitempty"`
+
+	// PendingBlocks is the number of blocks worth of pending transactions at
+	// which the suggested price reaches the highest sampled price. Zero disables
+	// weighting the suggestion by the transaction pool pressure.
+	PendingBlocks int `toml:",omitempty"`
 }
 
 // Oracle recommends gas prices based on the content of recent
 // blocks. Suitable for both light and full clients.
 type Oracle struct {
-	backend   ethapi.Backend
-	lastHead  common.Hash
-	lastPrice *big.Int
-	cacheLock sync.RWMutex
-	fetchLock sync.Mutex
+	backend    ethapi.Backend
+	lastHead   common.Hash
+	lastPrice  *big.Int
+	lastPrices []*big.Int // Sorted block minimum prices sampled at the last head
+	lastTxRate float64    // Average number of transactions per sampled block
+	cacheLock  sync.RWMutex
+	fetchLock  sync.Mutex
+	feeCache   *lru.Cache // Processed block fees for fee history queries
 
 	checkBlocks, maxEmpty, maxBlocks int
 	percentile                       int
+	pendingBlocks                    int
 }
 
 // NewOracle returns a new oracle.
@@ -63,27 +74,37 @@ func NewOracle(backend ethapi.Backend, params Config) *Oracle {
 	if percent > 100 {
 		percent = 100
 	}
+	pending := params.PendingBlocks
+	if pending < 0 {
+		pending = 0
+	}
+	feeCache, _ := lru.New(feeCacheSize)
 	return &Oracle{
-		backend:     backend,
-		lastPrice:   params.Default,
-		checkBlocks: blocks,
-		maxEmpty:    blocks / 2,
-		maxBlocks:   blocks * 5,
-		percentile:  percent,
+		backend:       backend,
+		lastPrice:     params.Default,
+		feeCache:      feeCache,
+		checkBlocks:   blocks,
+		maxEmpty:      blocks / 2,
+		maxBlocks:     blocks * 5,
+		percentile:    percent,
+		pendingBlocks: pending,
 	}
 }
 
-// SuggestPrice returns the recommended gas price.
+// SuggestPrice returns the recommended gas price. The price is picked from the
+// configured percentile of recent block minimum prices, raised towards the
+// highest one if the transaction pool holds a backlog of pending transactions.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	gpo.cacheLock.RLock()
 	lastHead := gpo.lastHead
 	lastPrice := gpo.lastPrice
+	lastPrices, lastTxRate := gpo.lastPrices, gpo.lastTxRate
 	gpo.cacheLock.RUnlock()
 
 	head, _ := gpo.backend.HeaderByNumber(ctx, rpc.LatestBlockNumber)
 	headHash := head.Hash()
 	if headHash == lastHead {
-		return lastPrice, nil
+		return gpo.weightPrice(lastPrices, lastTxRate, lastPrice), nil
 	}
 
 	gpo.fetchLock.Lock()
@@ -93,15 +114,17 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	gpo.cacheLock.RLock()
 	lastHead = gpo.lastHead
 	lastPrice = gpo.lastPrice
+	lastPrices, lastTxRate = gpo.lastPrices, gpo.lastTxRate
 	gpo.cacheLock.RUnlock()
 	if headHash == lastHead {
-		return lastPrice, nil
+		return gpo.weightPrice(lastPrices, lastTxRate, lastPrice), nil
 	}
 
 	blockNum := head.Number.Uint64()
 	ch := make(chan getBlockPricesResult, gpo.checkBlocks)
 	sent := 0
 	exp := 0
+	txs := 0
 	var blockPrices []*big.Int
 	for sent < gpo.checkBlocks && blockNum > 0 {
 		go gpo.getBlockPrices(ctx, types.MakeSigner(gpo.backend.ChainConfig(), big.NewInt(int64(blockNum))), blockNum, ch)
@@ -116,6 +139,7 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 			return lastPrice, res.err
 		}
 		exp--
+		txs += res.txs
 		if res.price != nil {
 			blockPrices = append(blockPrices, res.price)
 			continue
@@ -131,24 +155,46 @@ func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 			blockNum--
 		}
 	}
-	price := lastPrice
-	if len(blockPrices) > 0 {
-		sort.Sort(bigIntArray(blockPrices))
-		price = blockPrices[(len(blockPrices)-1)*gpo.percentile/100]
-	}
-	if price.Cmp(maxPrice) > 0 {
-		price = new(big.Int).Set(maxPrice)
+	sort.Sort(bigIntArray(blockPrices))
+	var txRate float64
+	if sent > 0 {
+		txRate = float64(txs) / float64(sent)
 	}
+	price := gpo.weightPrice(blockPrices, txRate, lastPrice)
 
 	gpo.cacheLock.Lock()
 	gpo.lastHead = headHash
 	gpo.lastPrice = price
+	gpo.lastPrices, gpo.lastTxRate = blockPrices, txRate
 	gpo.cacheLock.Unlock()
 	return price, nil
 }
 
+// weightPrice picks the suggested price from a sorted set of block minimum
+// prices. The configured percentile is raised proportionally to the number of
+// blocks worth of transactions pending in the pool beyond the next one.
+func (gpo *Oracle) weightPrice(prices []*big.Int, txRate float64, fallback *big.Int) *big.Int {
+	price := fallback
+	if len(prices) > 0 {
+		percentile := gpo.percentile
+		if gpo.pendingBlocks > 0 && txRate > 0 {
+			pending, _ := gpo.backend.Stats()
+			if backlog := float64(pending) / txRate; backlog > 1 {
+				weight := math.Min((backlog-1)/float64(gpo.pendingBlocks), 1)
+				percentile += int(float64(100-percentile) * weight)
+			}
+		}
+		price = prices[(len(prices)-1)*percentile/100]
+	}
+	if price.Cmp(maxPrice) > 0 {
+		price = new(big.Int).Set(maxPrice)
+	}
+	return price
+}
+
 type getBlockPricesResult struct {
 	price *big.Int
+	txs   int
 	err   error
 }
 
@@ -159,11 +205,12 @@ func (t transactionsByGasPrice) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
 func (t transactionsByGasPrice) Less(i, j int) bool { return t[i].GasPrice().Cmp(t[j].GasPrice()) < 0 }
 
 // getBlockPrices calculates the lowest transaction gas price in a given block
-// and sends it to the result channel. If the block is empty, price is nil.
+// and sends it to the result channel along with the number of transactions in
+// the block. If the block is empty, price is nil.
 func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, blockNum uint64, ch chan getBlockPricesResult) {
 	block, err := gpo.backend.BlockByNumber(ctx, rpc.BlockNumber(blockNum))
 	if block == nil {
-		ch <- getBlockPricesResult{nil, err}
+		ch <- getBlockPricesResult{nil, 0, err}
 		return
 	}
 
@@ -175,11 +222,11 @@ func (gpo *Oracle) getBlockPrices(ctx context.Context, signer types.Signer, bloc
 	for _, tx := range txs {
 		sender, err := types.Sender(signer, tx)
 		if err == nil && sender != block.Coinbase() {
-			ch <- getBlockPricesResult{tx.GasPrice(), nil}
+			ch <- getBlockPricesResult{tx.GasPrice(), len(txs), nil}
 			return
 		}
 	}
-	ch <- getBlockPricesResult{nil, nil}
+	ch <- getBlockPricesResult{nil, len(txs), nil}
 }
 
 type bigIntArray []*big.Int
@@ -88,7 +88,18 @@ func (pm *ProtocolManager) txsyncLoop() {
 		// Send the pack in the background.
 		s.p.Log().Trace("Sending batch of transactions", "count", len(pack.txs), "bytes", size)
 		sending = true
-		go func() { done <- pack.p.SendTransactions(pack.txs) }()
+		go func() {
+			// Peers supporting eth/65 retrieve the transactions they miss
+			if pack.p.version >= eth65 {
+				hashes := make([]common.Hash, len(pack.txs))
+				for i, tx := range pack.txs {
+					hashes[i] = tx.Hash()
+				}
+				done <- pack.p.SendPooledTransactionHashes(hashes)
+				return
+			}
+			done <- pack.p.SendTransactions(pack.txs)
+		}()
 	}
 
 	// pick chooses the next pending sync.
@@ -135,6 +146,8 @@ func (pm *ProtocolManager) syncer() {
 	// Start and ensure cleanup of sync mechanisms
 	pm.fetcher.Start()
 	defer pm.fetcher.Stop()
+	pm.txFetcher.Start()
+	defer pm.txFetcher.Stop()
 	defer pm.downloader.Terminate()
 
 	// Wait for different events to fire synchronisation operations
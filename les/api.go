@@ -0,0 +1,167 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+var (
+	// errNoCheckpointOracle is returned if the registered checkpoint is queried
+	// without a checkpoint oracle configured.
+	errNoCheckpointOracle = errors.New("checkpoint oracle not configured")
+
+	// errCheckpointNotAvailable is returned if a checkpoint is requested for a
+	// section the local indexers didn't process yet.
+	errCheckpointNotAvailable = errors.New("checkpoint not available")
+)
+
+// PrivateLightServerAPI provides an API to manage the capacity assigned to the
+// clients of a light server.
+type PrivateLightServerAPI struct {
+	server *LesServer
+}
+
+// NewPrivateLightServerAPI creates a new LES server API.
+func NewPrivateLightServerAPI(server *LesServer) *PrivateLightServerAPI {
+	return &PrivateLightServerAPI{server: server}
+}
+
+// PriorityClientInfo is the capacity and connection status of a priority client.
+type PriorityClientInfo struct {
+	Capacity  hexutil.Uint64 `json:"capacity"`
+	Connected bool           `json:"connected"`
+}
+
+// TotalCapacity returns the total capacity available for serving clients.
+func (api *PrivateLightServerAPI) TotalCapacity() (hexutil.Uint64, error) {
+	pool := api.server.priorityClientPool
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	return hexutil.Uint64(pool.totalCap), nil
+}
+
+// SetTotalCapacity updates the total capacity available for serving clients.
+// The capacity not reserved by connected priority clients is shared between the
+// free clients.
+func (api *PrivateLightServerAPI) SetTotalCapacity(capacity hexutil.Uint64) error {
+	pool := api.server.priorityClientPool
+	return pool.setTotalCapacity(uint64(capacity))
+}
+
+// FreeClientCapacity returns the capacity assigned to each free client.
+func (api *PrivateLightServerAPI) FreeClientCapacity() hexutil.Uint64 {
+	return hexutil.Uint64(api.server.defParams.MinRecharge)
+}
+
+// SetClientCapacity registers a priority client with a guaranteed capacity, or
+// unregisters it if the capacity is zero. Connected lpv3 clients are notified of
+// their new capacity, older ones are dropped to make them reconnect with it.
+func (api *PrivateLightServerAPI) SetClientCapacity(id discover.NodeID, capacity hexutil.Uint64) error {
+	pool := api.server.priorityClientPool
+	return pool.setClientCapacity(id, uint64(capacity))
+}
+
+// GetClientCapacity returns the capacity assigned to a priority client, or the
+// free client capacity if it isn't one.
+func (api *PrivateLightServerAPI) GetClientCapacity(id discover.NodeID) (hexutil.Uint64, error) {
+	pool := api.server.priorityClientPool
+	if capacity := pool.clientCapacity(id); capacity != 0 {
+		return hexutil.Uint64(capacity), nil
+	}
+	return api.FreeClientCapacity(), nil
+}
+
+// PriorityClients returns the capacity and connection status of all registered
+// priority clients.
+func (api *PrivateLightServerAPI) PriorityClients() (map[discover.NodeID]*PriorityClientInfo, error) {
+	pool := api.server.priorityClientPool
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	clients := make(map[discover.NodeID]*PriorityClientInfo, len(pool.clients))
+	for id, client := range pool.clients {
+		clients[id] = &PriorityClientInfo{
+			Capacity:  hexutil.Uint64(client.capacity),
+			Connected: client.connected,
+		}
+	}
+	return clients, nil
+}
+
+// PublicLightAPI provides access to the CHT/BloomTrie checkpoints of both light
+// clients and servers, and the checkpoint registered in the checkpoint oracle.
+type PublicLightAPI struct {
+	commons *lesCommons
+}
+
+// NewPublicLightAPI creates a new LES checkpoint API.
+func NewPublicLightAPI(commons *lesCommons) *PublicLightAPI {
+	return &PublicLightAPI{commons: commons}
+}
+
+// CheckpointInfo is a checkpoint along with the hash the oracle admins sign.
+type CheckpointInfo struct {
+	params.TrustedCheckpoint
+	Hash common.Hash `json:"hash"`
+}
+
+// OracleCheckpoint is the latest checkpoint registered in the checkpoint oracle.
+type OracleCheckpoint struct {
+	SectionIndex hexutil.Uint64  `json:"sectionIndex"`
+	Hash         common.Hash     `json:"hash"`
+	Height       hexutil.Uint64  `json:"height"`
+	Signatures   []hexutil.Bytes `json:"signatures"`
+}
+
+// GetCheckpoint returns the checkpoint of the given section generated by the
+// local indexers, which the oracle admins sign to register it.
+func (api *PublicLightAPI) GetCheckpoint(index hexutil.Uint64) (*CheckpointInfo, error) {
+	checkpoint := api.commons.localCheckpoint(uint64(index))
+	if checkpoint.SectionHead == (common.Hash{}) || checkpoint.CHTRoot == (common.Hash{}) || checkpoint.BloomRoot == (common.Hash{}) {
+		return nil, errCheckpointNotAvailable
+	}
+	return &CheckpointInfo{TrustedCheckpoint: checkpoint, Hash: checkpoint.Hash()}, nil
+}
+
+// LatestCheckpoint returns the latest checkpoint registered in the checkpoint
+// oracle. Light clients retrieve the contract state through ODR.
+func (api *PublicLightAPI) LatestCheckpoint(ctx context.Context) (*OracleCheckpoint, error) {
+	if api.commons.oracle == nil {
+		return nil, errNoCheckpointOracle
+	}
+	index, hash, height, sigs, err := api.commons.oracle.latestCheckpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := &OracleCheckpoint{
+		SectionIndex: hexutil.Uint64(index),
+		Hash:         hash,
+		Height:       hexutil.Uint64(height),
+	}
+	for _, sig := range sigs {
+		result.Signatures = append(result.Signatures, sig)
+	}
+	return result, nil
+}
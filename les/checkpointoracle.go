@@ -0,0 +1,101 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/contracts/checkpointoracle"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/params"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+// checkpointOracle reads the latest checkpoint registered in the on-chain
+// checkpoint oracle contract and verifies checkpoints announced by servers
+// against the trusted admin set of the oracle.
+type checkpointOracle struct {
+	config   *params.CheckpointOracleConfig
+	contract *checkpointoracle.CheckpointOracle
+}
+
+// newCheckpointOracle creates a checkpoint oracle reading the contract through
+// the given backend. Servers read their local state, while light clients
+// retrieve the contract state on demand through ODR.
+func newCheckpointOracle(config *params.CheckpointOracleConfig, backend ethapi.Backend) *checkpointOracle {
+	caller := &stateCaller{api: ethapi.NewPublicBlockChainAPI(backend)}
+	contract, err := checkpointoracle.NewCheckpointOracleReader(config.Address, caller)
+	if err != nil {
+		log.Error("Failed to bind checkpoint oracle", "address", config.Address, "err", err)
+		return nil
+	}
+	log.Info("Configured checkpoint oracle", "address", config.Address, "signers", len(config.Signers), "threshold", config.Threshold)
+	return &checkpointOracle{config: config, contract: contract}
+}
+
+// latestCheckpoint returns the index and hash of the latest checkpoint
+// registered in the oracle, along with the block height it was registered at
+// and the admin signatures approving it.
+func (oracle *checkpointOracle) latestCheckpoint(ctx context.Context) (uint64, common.Hash, uint64, [][]byte, error) {
+	return oracle.contract.LatestCheckpoint(&bind.CallOpts{Context: ctx})
+}
+
+// verifyCheckpoint checks whether a checkpoint announced by a server was signed
+// by enough trusted admins of the oracle.
+func (oracle *checkpointOracle) verifyCheckpoint(checkpoint *params.TrustedCheckpoint, sigs [][]byte) bool {
+	if err := checkpointoracle.VerifyCheckpoint(oracle.config, checkpoint, sigs); err != nil {
+		log.Debug("Rejected announced checkpoint", "section", checkpoint.SectionIndex, "hash", checkpoint.Hash(), "err", err)
+		return false
+	}
+	return true
+}
+
+// stateCaller executes read-only contract calls against the latest state of
+// the local chain through the public blockchain API.
+type stateCaller struct {
+	api *ethapi.PublicBlockChainAPI
+}
+
+// callBlockNumber converts an optional block number into the API representation.
+func callBlockNumber(number *big.Int) rpc.BlockNumber {
+	if number == nil {
+		return rpc.LatestBlockNumber
+	}
+	return rpc.BlockNumber(number.Int64())
+}
+
+// CodeAt implements bind.ContractCaller, returning the code of a contract.
+func (c *stateCaller) CodeAt(ctx context.Context, contract common.Address, number *big.Int) ([]byte, error) {
+	return c.api.GetCode(ctx, contract, callBlockNumber(number))
+}
+
+// CallContract implements bind.ContractCaller, executing a contract call.
+func (c *stateCaller) CallContract(ctx context.Context, call ethereum.CallMsg, number *big.Int) ([]byte, error) {
+	args := ethapi.CallArgs{
+		From: call.From,
+		To:   call.To,
+		Gas:  hexutil.Uint64(call.Gas),
+		Data: call.Data,
+	}
+	return c.api.Call(ctx, args, callBlockNumber(number))
+}
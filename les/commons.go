@@ -37,6 +37,7 @@ type lesCommons struct {
 	chainDb                      ethdb.Database
 	protocolManager              *ProtocolManager
 	chtIndexer, bloomTrieIndexer *core.ChainIndexer
+	oracle                       *checkpointOracle // nil if no checkpoint oracle is configured
 }
 
 // NodeInfo represents a short summary of the Ethereum sub-protocol metadata
@@ -89,21 +90,7 @@ func (c *lesCommons) nodeInfo() interface{} {
 		sections = sections2
 	}
 	if sections > 0 {
-		sectionIndex := sections - 1
-		sectionHead := c.bloomTrieIndexer.SectionHead(sectionIndex)
-		var chtRoot common.Hash
-		if c.protocolManager.lightSync {
-			chtRoot = light.GetChtRoot(c.chainDb, sectionIndex, sectionHead)
-		} else {
-			idxV2 := (sectionIndex+1)*c.iConfig.PairChtSize/c.iConfig.ChtSize - 1
-			chtRoot = light.GetChtRoot(c.chainDb, idxV2, sectionHead)
-		}
-		cht = params.TrustedCheckpoint{
-			SectionIndex: sectionIndex,
-			SectionHead:  sectionHead,
-			CHTRoot:      chtRoot,
-			BloomRoot:    light.GetBloomTrieRoot(c.chainDb, sectionIndex, sectionHead),
-		}
+		cht = c.localCheckpoint(sections - 1)
 	}
 
 	chain := c.protocolManager.blockchain
@@ -118,3 +105,23 @@ func (c *lesCommons) nodeInfo() interface{} {
 		CHT:        cht,
 	}
 }
+
+// localCheckpoint returns the checkpoint of the given section generated by the
+// local CHT and BloomTrie indexers. The section index is in client (LES/2)
+// section units even if running in server mode.
+func (c *lesCommons) localCheckpoint(sectionIndex uint64) params.TrustedCheckpoint {
+	sectionHead := c.bloomTrieIndexer.SectionHead(sectionIndex)
+	var chtRoot common.Hash
+	if c.protocolManager.lightSync {
+		chtRoot = light.GetChtRoot(c.chainDb, sectionIndex, sectionHead)
+	} else {
+		idxV2 := (sectionIndex+1)*c.iConfig.PairChtSize/c.iConfig.ChtSize - 1
+		chtRoot = light.GetChtRoot(c.chainDb, idxV2, sectionHead)
+	}
+	return params.TrustedCheckpoint{
+		SectionIndex: sectionIndex,
+		SectionHead:  sectionHead,
+		CHTRoot:      chtRoot,
+		BloomRoot:    light.GetBloomTrieRoot(c.chainDb, sectionIndex, sectionHead),
+	}
+}
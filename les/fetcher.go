@@ -408,7 +408,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 
 	for p, fp := range f.peers {
 		for hash, n := range fp.nodeByHash {
-			if !f.checkKnownNode(p, n) && !n.requested && (bestTd == nil || n.td.Cmp(bestTd) >= 0) {
+			if !f.checkKnownNode(p, n) && !n.requested && (bestTd == nil || n.td.Cmp(bestTd) >= 0) && f.trustedQuorum(hash) {
 				amount := f.requestAmount(p, n)
 				if bestTd == nil || n.td.Cmp(bestTd) > 0 || amount < bestAmount {
 					bestHash = hash
@@ -438,7 +438,7 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 				defer f.lock.Unlock()
 
 				fp := f.peers[p]
-				return fp != nil && fp.nodeByHash[bestHash] != nil
+				return fp != nil && fp.nodeByHash[bestHash] != nil && (f.pm.ulc == nil || p.isTrusted)
 			},
 			request: func(dp distPeer) func() {
 				go func() {
@@ -496,6 +496,21 @@ func (f *lightFetcher) nextRequest() (*distReq, uint64) {
 	return rq, reqID
 }
 
+// trustedQuorum returns whether enough trusted servers announced the given head
+// in ultra-light client mode. It always returns true if the mode is disabled.
+func (f *lightFetcher) trustedQuorum(hash common.Hash) bool {
+	if f.pm.ulc == nil {
+		return true
+	}
+	var count int
+	for p, fp := range f.peers {
+		if p.isTrusted && fp.nodeByHash[hash] != nil {
+			count++
+		}
+	}
+	return f.pm.ulc.quorum(count)
+}
+
 // deliverHeaders delivers header download request responses for processing
 func (f *lightFetcher) deliverHeaders(peer *peer, reqID uint64, headers []*types.Header) {
 	f.deliverChn <- fetchResponse{reqID: reqID, headers: headers, peer: peer}
@@ -511,7 +526,12 @@ func (f *lightFetcher) processResponse(req fetchRequest, resp fetchResponse) boo
 	for i, header := range resp.headers {
 		headers[int(req.amount)-1-i] = header
 	}
-	if _, err := f.chain.InsertHeaderChain(headers, 1); err != nil {
+	// Headers of heads announced by the trusted server quorum are not verified
+	checkFreq := 1
+	if f.pm.ulc != nil {
+		checkFreq = 0
+	}
+	if _, err := f.chain.InsertHeaderChain(headers, checkFreq); err != nil {
 		if err == consensus.ErrFutureBlock {
 			return true
 		}
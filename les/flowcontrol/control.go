@@ -75,15 +75,44 @@ func (peer *ClientNode) AcceptRequest() (uint64, bool) {
 	return peer.bufValue, peer.cm.accept(peer.cmNode, time)
 }
 
+// UpdateParams changes the flow control parameters assigned to the client, e.g.
+// after its capacity was changed. The buffer value is kept within the new limit.
+func (peer *ClientNode) UpdateParams(params *ServerParams) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	peer.recalcBV(mclock.Now())
+	peer.params = params
+	if peer.bufValue > params.BufLimit {
+		peer.bufValue = params.BufLimit
+	}
+}
+
 func (peer *ClientNode) RequestProcessed(cost uint64) (bv, realCost uint64) {
+	return peer.requestProcessed(cost, false)
+}
+
+// RequestProcessedMeasured charges the measured cost of serving a request instead
+// of its estimated one, capped at the given maximum cost. The charged cost is the
+// smaller one of the maximum and the returned measured cost.
+func (peer *ClientNode) RequestProcessedMeasured(maxCost uint64) (bv, realCost uint64) {
+	return peer.requestProcessed(maxCost, true)
+}
+
+// requestProcessed deducts the cost of a served request from the buffer, either
+// the given one or the measured one if it is lower.
+func (peer *ClientNode) requestProcessed(cost uint64, measured bool) (bv, realCost uint64) {
 	peer.lock.Lock()
 	defer peer.lock.Unlock()
 
 	time := mclock.Now()
+	rcValue, rcost := peer.cm.processed(peer.cmNode, time)
+	if measured && rcost < cost {
+		cost = rcost
+	}
 	peer.recalcBV(time)
 	peer.bufValue -= cost
 	peer.recalcBV(time)
-	rcValue, rcost := peer.cm.processed(peer.cmNode, time)
 	if rcValue < peer.params.BufLimit {
 		bv := peer.params.BufLimit - rcValue
 		if bv > peer.bufValue {
@@ -123,6 +152,19 @@ func (peer *ServerNode) recalcBLE(time mclock.AbsTime) {
 	peer.lastTime = time
 }
 
+// UpdateParams changes the flow control parameters announced by the server, e.g.
+// after the capacity assigned to us was changed.
+func (peer *ServerNode) UpdateParams(params *ServerParams) {
+	peer.lock.Lock()
+	defer peer.lock.Unlock()
+
+	peer.recalcBLE(mclock.Now())
+	peer.params = params
+	if peer.bufEstimate > params.BufLimit {
+		peer.bufEstimate = params.BufLimit
+	}
+}
+
 // safetyMargin is added to the flow control waiting time when estimated buffer value is low
 const safetyMargin = time.Millisecond
 
@@ -18,6 +18,7 @@
 package les
 
 import (
+	"bytes"
 	"encoding/binary"
 	"encoding/json"
 	"fmt"
@@ -33,9 +34,11 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth"
 	"github.com/ethereum/go-ethereum/eth/downloader"
 	"github.com/ethereum/go-ethereum/ethdb"
 	"github.com/ethereum/go-ethereum/event"
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
 	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -59,6 +62,7 @@ const (
 	MaxHelperTrieProofsFetch = 64  // Amount of merkle proofs to be fetched per retrieval request
 	MaxTxSend                = 64  // Amount of transactions to be send per request
 	MaxTxStatus              = 256 // Amount of transactions to queried per request
+	MaxMultiRequests         = 16  // Amount of requests to be bundled into a multi-request
 
 	disableClientRemovePeer = false
 )
@@ -104,6 +108,8 @@ type ProtocolManager struct {
 	lesTopic    discv5.Topic
 	reqDist     *requestDistributor
 	retriever   *retrieveManager
+	oracle      *checkpointOracle // Verifies checkpoints announced by servers (client only)
+	ulc         *ulc              // Ultra-light client configuration, nil if disabled
 
 	downloader *downloader.Downloader
 	fetcher    *lightFetcher
@@ -124,7 +130,7 @@ type ProtocolManager struct {
 
 // NewProtocolManager returns a new ethereum sub protocol manager. The Ethereum sub protocol manages peers capable
 // with the ethereum network.
-func NewProtocolManager(chainConfig *params.ChainConfig, indexerConfig *light.IndexerConfig, lightSync bool, networkId uint64, mux *event.TypeMux, engine consensus.Engine, peers *peerSet, blockchain BlockChain, txpool txPool, chainDb ethdb.Database, odr *LesOdr, txrelay *LesTxRelay, serverPool *serverPool, quitSync chan struct{}, wg *sync.WaitGroup) (*ProtocolManager, error) {
+func NewProtocolManager(chainConfig *params.ChainConfig, indexerConfig *light.IndexerConfig, ulcConfig *eth.ULCConfig, lightSync bool, networkId uint64, mux *event.TypeMux, engine consensus.Engine, peers *peerSet, blockchain BlockChain, txpool txPool, chainDb ethdb.Database, odr *LesOdr, txrelay *LesTxRelay, serverPool *serverPool, quitSync chan struct{}, wg *sync.WaitGroup) (*ProtocolManager, error) {
 	// Create the protocol manager with the base fields
 	manager := &ProtocolManager{
 		lightSync:   lightSync,
@@ -149,13 +155,17 @@ func NewProtocolManager(chainConfig *params.ChainConfig, indexerConfig *light.In
 		manager.reqDist = odr.retriever.dist
 	}
 
-	removePeer := manager.removePeer
+	removePeer := func(id string, reason error) { manager.removePeer(id) }
 	if disableClientRemovePeer {
-		removePeer = func(id string) {}
+		removePeer = func(id string, reason error) {}
 	}
 
 	if lightSync {
-		manager.downloader = downloader.New(downloader.LightSync, chainDb, manager.eventMux, nil, blockchain, removePeer)
+		var chain downloader.LightChain = blockchain
+		if manager.ulc = newULC(ulcConfig); manager.ulc != nil {
+			chain = ulcChain{blockchain}
+		}
+		manager.downloader = downloader.New(downloader.LightSync, chainDb, manager.eventMux, nil, chain, removePeer)
 		manager.peers.notify((*downloaderPeerNotify)(manager))
 		manager.fetcher = newLightFetcher(manager)
 	}
@@ -174,7 +184,9 @@ func (pm *ProtocolManager) Start(maxPeers int) {
 	if pm.lightSync {
 		go pm.syncer()
 	} else {
-		pm.clientPool = newFreeClientPool(pm.chainDb, maxPeers, 10000, mclock.System{})
+		if pm.clientPool == nil {
+			pm.clientPool = newFreeClientPool(pm.chainDb, maxPeers, 10000, mclock.System{})
+		}
 		go func() {
 			for range pm.newPeerCh {
 			}
@@ -212,6 +224,7 @@ func (pm *ProtocolManager) Stop() {
 func (pm *ProtocolManager) runPeer(version uint, p *p2p.Peer, rw p2p.MsgReadWriter) error {
 	var entry *poolEntry
 	peer := pm.newPeer(int(version), pm.networkId, p, rw)
+	peer.isTrusted = pm.ulc != nil && pm.ulc.isTrusted(p.ID())
 	if pm.serverPool != nil {
 		addr := p.RemoteAddr().(*net.TCPAddr)
 		entry = pm.serverPool.connect(peer, addr.IP, uint16(addr.Port))
@@ -257,12 +270,19 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		number  = head.Number.Uint64()
 		td      = pm.blockchain.GetTd(hash, number)
 	)
+	// Reserve guaranteed capacity if the peer is a registered priority client
+	var priority bool
+	if pm.server != nil && pm.server.priorityClientPool != nil {
+		if p.fcParams, priority = pm.server.priorityClientPool.connect(p.ID(), p.id); priority {
+			defer pm.server.priorityClientPool.disconnect(p.ID())
+		}
+	}
 	if err := p.Handshake(td, hash, number, genesis.Hash(), pm.server); err != nil {
 		p.Log().Debug("Light Ethereum handshake failed", "err", err)
 		return err
 	}
 
-	if !pm.lightSync && !p.Peer.Info().Network.Trusted {
+	if !pm.lightSync && !priority && !p.Peer.Info().Network.Trusted {
 		addr, ok := p.RemoteAddr().(*net.TCPAddr)
 		// test peer address is not a tcp address, don't use client pool if can not typecast
 		if ok {
@@ -293,7 +313,9 @@ func (pm *ProtocolManager) handle(p *peer) error {
 		p.lock.Lock()
 		head := p.headInfo
 		p.lock.Unlock()
-		if pm.fetcher != nil {
+		// The handshake head of trusted servers is not signed, in ultra-light
+		// mode wait for their first signed announcement instead
+		if pm.fetcher != nil && !p.isTrusted {
 			pm.fetcher.announce(p, head)
 		}
 
@@ -325,6 +347,42 @@ func (pm *ProtocolManager) handle(p *peer) error {
 	}
 }
 
+// requestProcessed updates the flow control buffer of a client after serving a
+// request, feeds the measured cost into the cost statistics and charges the
+// announced cost to priority clients. The new buffer value is returned.
+func (pm *ProtocolManager) requestProcessed(p *peer, msgCode, reqCnt uint64) uint64 {
+	costs := p.fcCosts[msgCode]
+	cost := costs.baseCost + reqCnt*costs.reqCost
+
+	var bv, rcost uint64
+	if p.version >= lpv3 {
+		// Newer clients are charged the measured cost, capped at the announced one
+		bv, rcost = p.fcClient.RequestProcessedMeasured(cost)
+		if rcost < cost {
+			cost = rcost
+		}
+	} else {
+		bv, rcost = p.fcClient.RequestProcessed(cost)
+	}
+	pm.server.fcCostStats.update(msgCode, reqCnt, rcost)
+	if pm.server.priorityClientPool != nil {
+		pm.server.priorityClientPool.charge(p.ID(), cost)
+	}
+	p.chargeCollected(bv, cost)
+	return bv
+}
+
+// updateCapacity changes the capacity assigned to a connected client without
+// disconnecting it, if it's able to process capacity announcements.
+func (pm *ProtocolManager) updateCapacity(id string, params *flowcontrol.ServerParams) bool {
+	p := pm.peers.Peer(id)
+	if p == nil || p.version < lpv3 || p.fcClient == nil {
+		return false
+	}
+	p.updateCapacity(params)
+	return true
+}
+
 var reqList = []uint64{GetBlockHeadersMsg, GetBlockBodiesMsg, GetCodeMsg, GetReceiptsMsg, GetProofsV1Msg, SendTxMsg, SendTxV2Msg, GetTxStatusMsg, GetHeaderProofsMsg, GetProofsV2Msg, GetHelperTrieProofsMsg}
 
 // handleMsg is invoked whenever an inbound message is received from a remote
@@ -337,29 +395,73 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 	}
 	p.Log().Trace("Light Ethereum message arrived", "code", msg.Code, "bytes", msg.Size)
 
+	if msg.Size > ProtocolMaxMsgSize {
+		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
+	}
+	defer msg.Discard()
+
+	return pm.handleMessage(p, msg, func(resp *Msg) error {
+		return pm.deliverResponse(p, resp)
+	})
+}
+
+// deliverResponse passes a reply to the retriever waiting for it, tolerating a
+// limited number of invalid or unexpected replies from the peer.
+func (pm *ProtocolManager) deliverResponse(p *peer, resp *Msg) error {
+	if err := pm.retriever.deliver(p, resp); err != nil {
+		p.responseErrors++
+		if p.responseErrors > maxResponseErrors {
+			return err
+		}
+	}
+	return nil
+}
+
+// isMultiRequest returns whether a request message can be bundled into a multi-
+// request. Only on-demand retrieval requests are allowed.
+func isMultiRequest(code uint64) bool {
+	switch code {
+	case GetBlockBodiesMsg, GetCodeMsg, GetReceiptsMsg, GetProofsV2Msg, GetHelperTrieProofsMsg:
+		return true
+	}
+	return false
+}
+
+// isMultiReply returns whether a reply message can be bundled into a multi-reply.
+func isMultiReply(code uint64) bool {
+	switch code {
+	case BlockBodiesMsg, CodeMsg, ReceiptsMsg, ProofsV2Msg, HelperTrieProofsMsg:
+		return true
+	}
+	return false
+}
+
+// handleMessage processes a single message of a remote peer, either a standalone
+// one or one bundled into a multi-request or reply. Replies to our requests are
+// passed to the given deliver function.
+func (pm *ProtocolManager) handleMessage(p *peer, msg p2p.Msg, deliver func(*Msg) error) error {
 	costs := p.fcCosts[msg.Code]
 	reject := func(reqCnt, maxCnt uint64) bool {
 		if p.fcClient == nil || reqCnt > maxCnt {
 			return true
 		}
+		p.lock.RLock()
+		params := p.fcParams
+		p.lock.RUnlock()
+
 		bufValue, _ := p.fcClient.AcceptRequest()
 		cost := costs.baseCost + reqCnt*costs.reqCost
-		if cost > pm.server.defParams.BufLimit {
-			cost = pm.server.defParams.BufLimit
+		if cost > params.BufLimit {
+			cost = params.BufLimit
 		}
 		if cost > bufValue {
-			recharge := time.Duration((cost - bufValue) * 1000000 / pm.server.defParams.MinRecharge)
+			recharge := time.Duration((cost - bufValue) * 1000000 / params.MinRecharge)
 			p.Log().Error("Request came too early", "recharge", common.PrettyDuration(recharge))
 			return true
 		}
 		return false
 	}
 
-	if msg.Size > ProtocolMaxMsgSize {
-		return errResp(ErrMsgTooLarge, "%v > %v", msg.Size, ProtocolMaxMsgSize)
-	}
-	defer msg.Discard()
-
 	var deliverMsg *Msg
 
 	// Handle the message depending on its contents
@@ -380,6 +482,15 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if err := msg.Decode(&req); err != nil {
 			return errResp(ErrDecode, "%v: %v", msg, err)
 		}
+		if p.version >= lpv3 {
+			if err := p.updateFlowControl(req.Update.decode()); err != nil {
+				return errResp(ErrDecode, "%v: %v", msg, err)
+			}
+			if req.Hash == (common.Hash{}) {
+				// Capacity announcement without a new head
+				break
+			}
+		}
 
 		if p.requestAnnounceType == announceTypeSigned {
 			if err := req.checkSignature(p.pubKey); err != nil {
@@ -490,8 +601,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + query.Amount*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, query.Amount, rcost)
+		bv := pm.requestProcessed(p, msg.Code, query.Amount)
 		return p.SendBlockHeaders(req.ReqID, bv, headers)
 
 	case BlockHeadersMsg:
@@ -549,8 +659,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				}
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendBlockBodiesRLP(req.ReqID, bv, bodies)
 
 	case BlockBodiesMsg:
@@ -614,8 +723,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				}
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendCode(req.ReqID, bv, data)
 
 	case CodeMsg:
@@ -680,8 +788,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				bytes += len(encoded)
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendReceiptsRLP(req.ReqID, bv, receipts)
 
 	case ReceiptsMsg:
@@ -754,8 +861,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				}
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendProofs(req.ReqID, bv, proofs)
 
 	case GetProofsV2Msg:
@@ -816,8 +922,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				break
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendProofsV2(req.ReqID, bv, nodes.NodeList())
 
 	case ProofsV1Msg:
@@ -903,8 +1008,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				}
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendHeaderProofs(req.ReqID, bv, proofs)
 
 	case GetHelperTrieProofsMsg:
@@ -964,8 +1068,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 				break
 			}
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 		return p.SendHelperTrieProofs(req.ReqID, bv, HelperTrieResps{Proofs: nodes.NodeList(), AuxData: auxData})
 
 	case HeaderProofsMsg:
@@ -1024,8 +1127,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		}
 		pm.txpool.AddRemotes(txs)
 
-		_, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 
 	case SendTxV2Msg:
 		if pm.txpool == nil {
@@ -1059,8 +1161,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 			}
 		}
 
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 
 		return p.SendTxStatus(req.ReqID, bv, stats)
 
@@ -1080,8 +1181,7 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 		if reject(uint64(reqCnt), MaxTxStatus) {
 			return errResp(ErrRequestRejected, "")
 		}
-		bv, rcost := p.fcClient.RequestProcessed(costs.baseCost + uint64(reqCnt)*costs.reqCost)
-		pm.server.fcCostStats.update(msg.Code, uint64(reqCnt), rcost)
+		bv := pm.requestProcessed(p, msg.Code, uint64(reqCnt))
 
 		return p.SendTxStatus(req.ReqID, bv, pm.txStatus(req.Hashes))
 
@@ -1101,19 +1201,96 @@ func (pm *ProtocolManager) handleMsg(p *peer) error {
 
 		p.fcServer.GotReply(resp.ReqID, resp.BV)
 
+	case GetMultiMsg:
+		if p.version < lpv3 {
+			return errResp(ErrInvalidMsgCode, "%v", msg.Code)
+		}
+		p.Log().Trace("Received multi-request")
+		// Decode the bundled requests
+		var req struct {
+			ReqID uint64
+			Reqs  []multiRequest
+		}
+		if err := msg.Decode(&req); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		if p.fcClient == nil || len(req.Reqs) == 0 || len(req.Reqs) > MaxMultiRequests {
+			return errResp(ErrRequestRejected, "")
+		}
+		// Serve the requests one by one, collecting the replies and their costs
+		var (
+			replies = make([]multiReply, 0, len(req.Reqs))
+			bv      uint64
+		)
+		for _, r := range req.Reqs {
+			if !isMultiRequest(r.Code) {
+				return errResp(ErrInvalidMsgCode, "%v in multi-request", r.Code)
+			}
+			var header struct {
+				ReqID uint64
+				Data  rlp.RawValue
+			}
+			if err := rlp.DecodeBytes(r.Data, &header); err != nil {
+				return errResp(ErrDecode, "%v in multi-request: %v", r.Code, err)
+			}
+			sub := p2p.Msg{Code: r.Code, Size: uint32(len(r.Data)), Payload: bytes.NewReader(r.Data)}
+			collected, err := p.collect([]uint64{header.ReqID}, func() error {
+				return pm.handleMessage(p, sub, deliver)
+			})
+			if err != nil {
+				return err
+			}
+			for _, reply := range collected.msgs {
+				replies = append(replies, multiReply{Code: reply.Code, Cost: collected.cost, Data: reply.Data})
+			}
+			bv = collected.bv
+		}
+		return p.SendMulti(req.ReqID, bv, replies)
+
+	case MultiMsg:
+		if pm.odr == nil || p.version < lpv3 {
+			return errResp(ErrUnexpectedResponse, "")
+		}
+		p.Log().Trace("Received multi-reply")
+		// A batch of replies arrived to one of our previous multi-requests
+		var resp struct {
+			ReqID, BV uint64
+			Replies   []multiReply
+		}
+		if err := msg.Decode(&resp); err != nil {
+			return errResp(ErrDecode, "msg %v: %v", msg, err)
+		}
+		p.fcServer.GotReply(resp.ReqID, resp.BV)
+
+		// Process the bundled replies, gathering them for the multi-request
+		msgs := make([]*Msg, 0, len(resp.Replies))
+		for _, r := range resp.Replies {
+			if !isMultiReply(r.Code) {
+				return errResp(ErrInvalidMsgCode, "%v in multi-reply", r.Code)
+			}
+			p.Log().Trace("Multi-reply entry", "code", r.Code, "cost", r.Cost)
+			sub := p2p.Msg{Code: r.Code, Size: uint32(len(r.Data)), Payload: bytes.NewReader(r.Data)}
+			err := pm.handleMessage(p, sub, func(resp *Msg) error {
+				msgs = append(msgs, resp)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		deliverMsg = &Msg{
+			MsgType: MsgMulti,
+			ReqID:   resp.ReqID,
+			Obj:     msgs,
+		}
+
 	default:
 		p.Log().Trace("Received unknown message", "code", msg.Code)
 		return errResp(ErrInvalidMsgCode, "%v", msg.Code)
 	}
 
 	if deliverMsg != nil {
-		err := pm.retriever.deliver(p, deliverMsg)
-		if err != nil {
-			p.responseErrors++
-			if p.responseErrors > maxResponseErrors {
-				return err
-			}
-		}
+		return deliver(deliverMsg)
 	}
 	return nil
 }
@@ -17,6 +17,7 @@
 package les
 
 import (
+	"bytes"
 	"encoding/binary"
 	"math/big"
 	"math/rand"
@@ -252,6 +253,7 @@ func testGetBlockBodies(t *testing.T, protocol int) {
 // Tests that the contract codes can be retrieved based on account addresses.
 func TestGetCodeLes1(t *testing.T) { testGetCode(t, 1) }
 func TestGetCodeLes2(t *testing.T) { testGetCode(t, 2) }
+func TestGetCodeLes3(t *testing.T) { testGetCode(t, 3) }
 
 func testGetCode(t *testing.T, protocol int) {
 	// Assemble the test environment
@@ -284,6 +286,7 @@ func testGetCode(t *testing.T, protocol int) {
 // Tests that the transaction receipts can be retrieved based on hashes.
 func TestGetReceiptLes1(t *testing.T) { testGetReceipt(t, 1) }
 func TestGetReceiptLes2(t *testing.T) { testGetReceipt(t, 2) }
+func TestGetReceiptLes3(t *testing.T) { testGetReceipt(t, 3) }
 
 func testGetReceipt(t *testing.T, protocol int) {
 	// Assemble the test environment
@@ -307,6 +310,83 @@ func testGetReceipt(t *testing.T, protocol int) {
 	}
 }
 
+// Tests that heterogeneous requests bundled into a multi-request are answered in
+// a single multi-reply.
+func TestGetMultiLes3(t *testing.T) {
+	// Assemble the test environment
+	server, tearDown := newServerEnv(t, 4, 3, nil)
+	defer tearDown()
+	bc := server.pm.blockchain.(*core.BlockChain)
+
+	head := bc.CurrentBlock()
+	receipts := rawdb.ReadReceipts(server.db, head.Hash(), head.NumberU64())
+	codereq := &CodeReq{BHash: head.Hash(), AccKey: crypto.Keccak256(testContractAddr[:])}
+
+	// Bundle a receipt and a code request and send them over
+	type entry struct {
+		code, reqID uint64
+		data        interface{}
+	}
+	var reqs []multiRequest
+	for _, req := range []entry{
+		{GetReceiptsMsg, 1, []common.Hash{head.Hash()}},
+		{GetCodeMsg, 2, []*CodeReq{codereq}},
+	} {
+		enc, _ := rlp.EncodeToBytes([]interface{}{req.reqID, req.data})
+		reqs = append(reqs, multiRequest{Code: req.code, Data: enc})
+	}
+	cost := server.tPeer.GetRequestCost(GetReceiptsMsg, 1) + server.tPeer.GetRequestCost(GetCodeMsg, 1)
+	sendRequest(server.tPeer.app, GetMultiMsg, 42, cost, reqs)
+
+	// Verify that the replies are bundled in request order
+	msg, err := server.tPeer.app.ReadMsg()
+	if err != nil {
+		t.Fatalf("failed to read reply: %v", err)
+	}
+	if msg.Code != MultiMsg {
+		t.Fatalf("message code mismatch: have %d, want %d", msg.Code, MultiMsg)
+	}
+	var resp struct {
+		ReqID, BV uint64
+		Replies   []multiReply
+	}
+	if err := msg.Decode(&resp); err != nil {
+		t.Fatalf("failed to decode reply: %v", err)
+	}
+	if resp.ReqID != 42 {
+		t.Errorf("request id mismatch: have %d, want %d", resp.ReqID, 42)
+	}
+	expected := []entry{
+		{ReceiptsMsg, 1, []types.Receipts{receipts}},
+		{CodeMsg, 2, [][]byte{testContractCodeDeployed}},
+	}
+	if len(resp.Replies) != len(expected) {
+		t.Fatalf("reply count mismatch: have %d, want %d", len(resp.Replies), len(expected))
+	}
+	for i, want := range expected {
+		reply := resp.Replies[i]
+		if reply.Code != want.code {
+			t.Errorf("reply %d: code mismatch: have %d, want %d", i, reply.Code, want.code)
+		}
+		var content struct {
+			ReqID, BV uint64
+			Data      rlp.RawValue
+		}
+		if err := rlp.DecodeBytes(reply.Data, &content); err != nil {
+			t.Fatalf("reply %d: failed to decode: %v", i, err)
+		}
+		if content.ReqID != want.reqID {
+			t.Errorf("reply %d: request id mismatch: have %d, want %d", i, content.ReqID, want.reqID)
+		}
+		if enc, _ := rlp.EncodeToBytes(want.data); !bytes.Equal(content.Data, enc) {
+			t.Errorf("reply %d: content mismatch: have %x, want %x", i, content.Data, enc)
+		}
+		if reply.Cost > cost {
+			t.Errorf("reply %d: charged cost %d above maximum %d", i, reply.Cost, cost)
+		}
+	}
+}
+
 // Tests that trie merkle proofs can be retrieved
 func TestGetProofsLes1(t *testing.T) { testGetProofs(t, 1) }
 func TestGetProofsLes2(t *testing.T) { testGetProofs(t, 2) }
@@ -18,6 +18,8 @@ package les
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/ethdb"
@@ -80,6 +82,10 @@ func (odr *LesOdr) IndexerConfig() *light.IndexerConfig {
 	return odr.indexerConfig
 }
 
+// errMultiReplyMismatch is returned if a multi-reply doesn't answer exactly the
+// bundled requests of a multi-request.
+var errMultiReplyMismatch = errors.New("multi-reply mismatch")
+
 const (
 	MsgBlockBodies = iota
 	MsgCode
@@ -88,6 +94,7 @@ const (
 	MsgProofsV2
 	MsgHeaderProofs
 	MsgHelperTrieProofs
+	MsgMulti
 )
 
 // Msg encodes a LES message that delivers reply data for a request
@@ -127,3 +134,275 @@ func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err erro
 	}
 	return
 }
+
+// RetrieveMulti tries to fetch several objects from the LES network in a single
+// round trip, bundling the requests into one multi-request message answered by
+// a server speaking lpv3. If no such server is available, the objects are
+// retrieved one by one. Successfully retrieved objects are stored in local db.
+func (odr *LesOdr) RetrieveMulti(ctx context.Context, reqs ...light.OdrRequest) error {
+	if len(reqs) == 0 || len(reqs) > MaxMultiRequests {
+		return errInvalidEntryCount
+	}
+	err := odr.retrieveMulti(ctx, reqs)
+	if err != light.ErrNoPeers {
+		return err
+	}
+	for _, req := range reqs {
+		if err := odr.Retrieve(ctx, req); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retrieveMulti fetches several objects from a single server speaking lpv3.
+func (odr *LesOdr) retrieveMulti(ctx context.Context, reqs []light.OdrRequest) error {
+	var (
+		lreqs  = make([]LesOdrRequest, len(reqs))
+		subIDs = make([]uint64, len(reqs))
+	)
+	for i, req := range reqs {
+		lreqs[i], subIDs[i] = LesRequest(req), genReqID()
+	}
+	getCost := func(p *peer) uint64 {
+		var cost uint64
+		for _, lreq := range lreqs {
+			cost += lreq.GetCost(p)
+		}
+		return cost
+	}
+	reqID := genReqID()
+	rq := &distReq{
+		getCost: func(dp distPeer) uint64 {
+			return getCost(dp.(*peer))
+		},
+		canSend: func(dp distPeer) bool {
+			p := dp.(*peer)
+			if p.version < lpv3 {
+				return false
+			}
+			for _, lreq := range lreqs {
+				if !lreq.CanSend(p) {
+					return false
+				}
+			}
+			return true
+		},
+		request: func(dp distPeer) func() {
+			p := dp.(*peer)
+			cost := getCost(p)
+			p.fcServer.QueueRequest(reqID, cost)
+			return func() {
+				collected, err := p.collect(subIDs, func() error {
+					for i, lreq := range lreqs {
+						if err := lreq.Request(subIDs[i], p); err != nil {
+							return err
+						}
+					}
+					return nil
+				})
+				if err != nil {
+					p.Log().Debug("Failed to assemble multi-request", "err", err)
+					return
+				}
+				p.RequestMulti(reqID, cost, collected.msgs)
+			}
+		},
+	}
+	validate := func(p distPeer, msg *Msg) error {
+		if msg.MsgType != MsgMulti {
+			return errInvalidMessageType
+		}
+		msgs := msg.Obj.([]*Msg)
+		if len(msgs) != len(lreqs) {
+			return errMultiReplyMismatch
+		}
+		for i, lreq := range lreqs {
+			if msgs[i].ReqID != subIDs[i] {
+				return errMultiReplyMismatch
+			}
+			if err := lreq.Validate(odr.db, msgs[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := odr.retriever.retrieve(ctx, reqID, rq, validate, odr.stop); err != nil {
+		log.Debug("Failed to retrieve data from network", "err", err)
+		return err
+	}
+	// retrieved from network, store in db
+	for _, req := range reqs {
+		req.StoreResult(odr.db)
+	}
+	return nil
+}
+
+const (
+	// odrRetryAttempts is the number of times a retrieval is attempted by the
+	// retrying ODR backend before giving up.
+	odrRetryAttempts = 5
+
+	// odrRetryDelay is the initial delay before a failed retrieval is retried,
+	// doubled after every further failure.
+	odrRetryDelay = time.Second
+)
+
+// retryOdr wraps an ODR backend, retrying retrievals that failed because none of
+// the suitable servers delivered a valid answer in time. Every attempt is sent as
+// a new request, so servers that timed out previously, as well as servers newly
+// connected by the server pool in the meantime, are asked again.
+type retryOdr struct {
+	light.OdrBackend
+	attempts int
+	delay    time.Duration
+}
+
+// newRetryOdr creates an ODR backend retrying failed retrievals with the default
+// retry policy.
+func newRetryOdr(odr light.OdrBackend) *retryOdr {
+	return &retryOdr{OdrBackend: odr, attempts: odrRetryAttempts, delay: odrRetryDelay}
+}
+
+// Retrieve tries to fetch an object from the LES network, retrying with an
+// exponential backoff if no server was able to serve it.
+func (odr *retryOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	delay := odr.delay
+	for attempt := 1; ; attempt++ {
+		err := odr.OdrBackend.Retrieve(ctx, req)
+		if err != light.ErrNoPeers || attempt >= odr.attempts {
+			return err
+		}
+		log.Debug("Retrying failed retrieval", "attempt", attempt, "delay", delay)
+		select {
+		case <-time.After(delay):
+			delay *= 2
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// multiRetrievalWait is the maximum time to wait for concurrent retrievals to
+// accumulate into a multi-request.
+const multiRetrievalWait = time.Millisecond
+
+// batchOdr wraps the LES ODR backend, bundling the receipt and bloom bit
+// retrievals issued concurrently, e.g. by log filters checking many matching
+// blocks at once, into multi-requests answered in a single round trip.
+type batchOdr struct {
+	*LesOdr
+	queue chan *batchRetrieval
+}
+
+// batchRetrieval is a retrieval waiting to be bundled into a multi-request.
+type batchRetrieval struct {
+	ctx  context.Context
+	req  light.OdrRequest
+	errc chan error
+}
+
+// newBatchOdr creates an ODR backend bundling concurrent retrievals, and starts
+// collecting them until the wrapped backend is stopped.
+func newBatchOdr(odr *LesOdr) *batchOdr {
+	b := &batchOdr{
+		LesOdr: odr,
+		queue:  make(chan *batchRetrieval),
+	}
+	go b.loop()
+	return b
+}
+
+// Retrieve tries to fetch an object from the LES network, bundling it with the
+// other retrievals issued in the meantime if it's a receipt or bloom bit one.
+func (odr *batchOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	switch req.(type) {
+	case *light.ReceiptsRequest, *light.BloomRequest:
+	default:
+		return odr.LesOdr.Retrieve(ctx, req)
+	}
+	r := &batchRetrieval{ctx: ctx, req: req, errc: make(chan error, 1)}
+	select {
+	case odr.queue <- r:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-odr.stop:
+		return light.ErrNoPeers
+	}
+	select {
+	case err := <-r.errc:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// loop collects the retrievals into batches of up to MaxMultiRequests, waiting
+// at most multiRetrievalWait for a batch to fill up.
+func (odr *batchOdr) loop() {
+	for {
+		var batch []*batchRetrieval
+		select {
+		case r := <-odr.queue:
+			batch = append(batch, r)
+		case <-odr.stop:
+			return
+		}
+		timeout := time.NewTimer(multiRetrievalWait)
+	collect:
+		for len(batch) < MaxMultiRequests {
+			select {
+			case r := <-odr.queue:
+				batch = append(batch, r)
+			case <-timeout.C:
+				break collect
+			case <-odr.stop:
+				timeout.Stop()
+				return
+			}
+		}
+		timeout.Stop()
+		go odr.retrieveBatch(batch)
+	}
+}
+
+// retrieveBatch fetches a batch of objects in a single multi-request. If that's
+// not possible or it fails, they are retrieved one by one instead, so that one
+// failing retrieval doesn't fail the others.
+func (odr *batchOdr) retrieveBatch(batch []*batchRetrieval) {
+	if len(batch) == 1 {
+		batch[0].errc <- odr.LesOdr.Retrieve(batch[0].ctx, batch[0].req)
+		return
+	}
+	// Retrieve the batch until all of the requesters gave up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for _, r := range batch {
+			select {
+			case <-r.ctx.Done():
+			case <-done:
+				return
+			}
+		}
+		cancel()
+	}()
+	reqs := make([]light.OdrRequest, len(batch))
+	for i, r := range batch {
+		reqs[i] = r.req
+	}
+	if err := odr.retrieveMulti(ctx, reqs); err == nil {
+		for _, r := range batch {
+			r.errc <- nil
+		}
+		return
+	}
+	for _, r := range batch {
+		go func(r *batchRetrieval) {
+			r.errc <- odr.LesOdr.Retrieve(r.ctx, r.req)
+		}(r)
+	}
+}
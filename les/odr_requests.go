@@ -41,6 +41,7 @@ var (
 	errTxHashMismatch      = errors.New("transaction hash mismatch")
 	errUncleHashMismatch   = errors.New("uncle hash mismatch")
 	errReceiptHashMismatch = errors.New("receipt hash mismatch")
+	errBloomMismatch       = errors.New("receipt bloom mismatch")
 	errDataHashMismatch    = errors.New("data hash mismatch")
 	errCHTHashMismatch     = errors.New("cht hash mismatch")
 	errCHTNumberMismatch   = errors.New("cht number mismatch")
@@ -173,6 +174,16 @@ func (r *ReceiptsRequest) Validate(db ethdb.Database, msg *Msg) error {
 	if header.ReceiptHash != types.DeriveSha(receipt) {
 		return errReceiptHashMismatch
 	}
+	// The receipt blooms are committed to by the receipt hash, but ensure they
+	// actually match the logs, otherwise log filtering could miss events
+	for _, r := range receipt {
+		if r.Bloom != types.BytesToBloom(types.LogsBloom(r.Logs).Bytes()) {
+			return errBloomMismatch
+		}
+	}
+	if header.Bloom != types.CreateBloom(receipt) {
+		return errBloomMismatch
+	}
 	// Validations passed, store and return
 	r.Receipts = receipt
 	return nil
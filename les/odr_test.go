@@ -31,7 +31,10 @@ import (
 	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
 	"github.com/ethereum/go-ethereum/light"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
@@ -60,6 +63,8 @@ func TestOdrGetReceiptsLes1(t *testing.T) { testOdr(t, 1, 1, odrGetReceipts) }
 
 func TestOdrGetReceiptsLes2(t *testing.T) { testOdr(t, 2, 1, odrGetReceipts) }
 
+func TestOdrGetReceiptsLes3(t *testing.T) { testOdr(t, 3, 1, odrGetReceipts) }
+
 func odrGetReceipts(ctx context.Context, db ethdb.Database, config *params.ChainConfig, bc *core.BlockChain, lc *light.LightChain, bhash common.Hash) []byte {
 	var receipts types.Receipts
 	if bc != nil {
@@ -202,3 +207,220 @@ func testOdr(t *testing.T, protocol int, expFail uint64, fn odrTestFn) {
 	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
 	test(5)
 }
+
+// Tests that several objects can be retrieved in a single round trip from servers
+// speaking lpv3 by bundling the requests.
+func TestOdrMultiLes3(t *testing.T) {
+	// Assemble the test environment
+	server, client, tearDown := newClientServerEnv(t, 4, 3, nil, true)
+	defer tearDown()
+	client.pm.synchronise(client.rPeer)
+
+	client.peers.lock.Lock()
+	client.rPeer.hasBlock = func(common.Hash, uint64) bool { return true }
+	client.peers.lock.Unlock()
+
+	var (
+		receipts []*light.ReceiptsRequest
+		blocks   []*light.BlockRequest
+		reqs     []light.OdrRequest
+	)
+	for i := uint64(1); i <= server.pm.blockchain.CurrentHeader().Number.Uint64(); i++ {
+		hash := rawdb.ReadCanonicalHash(server.db, i)
+		receipts = append(receipts, &light.ReceiptsRequest{Hash: hash, Number: i})
+		blocks = append(blocks, &light.BlockRequest{Hash: hash, Number: i})
+		reqs = append(reqs, receipts[len(receipts)-1], blocks[len(blocks)-1])
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := client.pm.odr.retrieveMulti(ctx, reqs); err != nil {
+		t.Fatalf("failed to retrieve objects: %v", err)
+	}
+	for i, req := range receipts {
+		want, _ := rlp.EncodeToBytes(rawdb.ReadReceipts(server.db, req.Hash, req.Number))
+		have, _ := rlp.EncodeToBytes(req.Receipts)
+		if !bytes.Equal(have, want) {
+			t.Errorf("receipts %d: mismatch: have %x, want %x", i, have, want)
+		}
+		if stored := rawdb.ReadReceipts(client.db, req.Hash, req.Number); stored == nil {
+			t.Errorf("receipts %d: not stored", i)
+		}
+	}
+	for i, req := range blocks {
+		if want := rawdb.ReadBodyRLP(server.db, req.Hash, req.Number); !bytes.Equal(req.Rlp, want) {
+			t.Errorf("block %d: body mismatch: have %x, want %x", i, req.Rlp, want)
+		}
+	}
+}
+
+func TestOdrBatchLes2(t *testing.T) { testOdrBatch(t, 2) }
+
+func TestOdrBatchLes3(t *testing.T) { testOdrBatch(t, 3) }
+
+// testOdrBatch tests that concurrent receipt retrievals through the bundling ODR
+// backend are all served, in multi-requests by lpv3 servers and one by one by
+// older ones.
+func testOdrBatch(t *testing.T, protocol int) {
+	// Assemble the test environment
+	server, client, tearDown := newClientServerEnv(t, 4, protocol, nil, true)
+	defer tearDown()
+	client.pm.synchronise(client.rPeer)
+
+	client.peers.lock.Lock()
+	client.rPeer.hasBlock = func(common.Hash, uint64) bool { return true }
+	client.peers.lock.Unlock()
+
+	odr := newBatchOdr(client.pm.odr)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	var (
+		head = server.pm.blockchain.CurrentHeader().Number.Uint64()
+		reqs = make([]*light.ReceiptsRequest, head)
+		errc = make(chan error, head)
+	)
+	for i := range reqs {
+		number := uint64(i) + 1
+		reqs[i] = &light.ReceiptsRequest{Hash: rawdb.ReadCanonicalHash(server.db, number), Number: number}
+		go func(req *light.ReceiptsRequest) { errc <- odr.Retrieve(ctx, req) }(reqs[i])
+	}
+	for range reqs {
+		if err := <-errc; err != nil {
+			t.Fatalf("failed to retrieve receipts: %v", err)
+		}
+	}
+	for i, req := range reqs {
+		want, _ := rlp.EncodeToBytes(rawdb.ReadReceipts(server.db, req.Hash, req.Number))
+		have, _ := rlp.EncodeToBytes(req.Receipts)
+		if !bytes.Equal(have, want) {
+			t.Errorf("receipts %d: mismatch: have %x, want %x", i, have, want)
+		}
+	}
+}
+
+// Tests that only the messages of the bundled requests are collected into a
+// multi-request, any other ones being sent to the network meanwhile.
+func TestMultiCollectorIsolation(t *testing.T) {
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	p := newPeer(lpv3, NetworkId, p2p.NewPeer(discover.NodeID{}, "test", nil), net)
+	received := make(chan p2p.Msg, 1)
+	go func() {
+		if msg, err := app.ReadMsg(); err == nil {
+			received <- msg
+			msg.Discard()
+		}
+	}()
+	collected, err := p.collect([]uint64{1}, func() error {
+		if err := p.RequestReceipts(1, 0, []common.Hash{{0x01}}); err != nil {
+			return err
+		}
+		return p.RequestReceipts(2, 0, []common.Hash{{0x02}})
+	})
+	if err != nil {
+		t.Fatalf("failed to collect requests: %v", err)
+	}
+	if len(collected.msgs) != 1 || collected.msgs[0].Code != GetReceiptsMsg {
+		t.Fatalf("collected requests mismatch: have %v, want one receipts request", collected.msgs)
+	}
+	select {
+	case msg := <-received:
+		if msg.Code != GetReceiptsMsg {
+			t.Errorf("sent message code mismatch: have %d, want %d", msg.Code, GetReceiptsMsg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("unbundled request not sent")
+	}
+	// Once collected, requests must go to the network again
+	go func() {
+		if msg, err := app.ReadMsg(); err == nil {
+			received <- msg
+			msg.Discard()
+		}
+	}()
+	if err := p.RequestReceipts(1, 0, []common.Hash{{0x01}}); err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	<-received
+}
+
+// Tests that the capacity assigned to an lpv3 client can be changed without
+// disconnecting it.
+func TestCapacityUpdateLes3(t *testing.T) {
+	// Assemble the test environment
+	server, client, tearDown := newClientServerEnv(t, 0, 3, nil, true)
+	defer tearDown()
+
+	params := &flowcontrol.ServerParams{BufLimit: testBufLimit * 2, MinRecharge: 2}
+	if !server.pm.updateCapacity(server.rPeer.id, params) {
+		t.Fatalf("failed to update client capacity")
+	}
+	for i := 0; ; i++ {
+		client.rPeer.lock.RLock()
+		updated := *client.rPeer.fcServerParams == *params
+		client.rPeer.lock.RUnlock()
+		if updated {
+			break
+		}
+		if i == 100 {
+			t.Fatalf("capacity update not received")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if client.pm.peers.Peer(client.rPeer.id) == nil {
+		t.Errorf("server disconnected after capacity update")
+	}
+}
+
+// failingOdr is an ODR backend failing a given number of retrievals because no
+// servers were available.
+type failingOdr struct {
+	light.OdrBackend
+	failures int
+	attempts int
+}
+
+func (odr *failingOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	odr.attempts++
+	if odr.attempts <= odr.failures {
+		return light.ErrNoPeers
+	}
+	return nil
+}
+
+// Tests that retrievals failing due to unavailable servers are retried, but only
+// up to the configured number of attempts.
+func TestRetryOdr(t *testing.T) {
+	tests := []struct {
+		failures int
+		attempts int
+		err      error
+	}{
+		{0, 1, nil},
+		{2, 3, nil},
+		{3, 3, light.ErrNoPeers},
+		{5, 3, light.ErrNoPeers},
+	}
+	for i, tt := range tests {
+		backend := &failingOdr{failures: tt.failures}
+		odr := &retryOdr{OdrBackend: backend, attempts: 3, delay: time.Millisecond}
+
+		if err := odr.Retrieve(context.Background(), &light.ReceiptsRequest{}); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if backend.attempts != tt.attempts {
+			t.Errorf("test %d: attempt count mismatch: have %d, want %d", i, backend.attempts, tt.attempts)
+		}
+	}
+	// Cancelling the context should abort the retries
+	backend := &failingOdr{failures: 5}
+	odr := &retryOdr{OdrBackend: backend, attempts: 5, delay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := odr.Retrieve(ctx, &light.ReceiptsRequest{}); err != context.DeadlineExceeded {
+		t.Errorf("error mismatch: have %v, want %v", err, context.DeadlineExceeded)
+	}
+}
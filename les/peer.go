@@ -21,6 +21,7 @@ import (
 	"crypto/ecdsa"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"math/big"
 	"sync"
 	"time"
@@ -31,6 +32,7 @@ import (
 	"github.com/ethereum/go-ethereum/les/flowcontrol"
 	"github.com/ethereum/go-ethereum/light"
 	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
 )
 
@@ -72,10 +74,19 @@ type peer struct {
 	hasBlock       func(common.Hash, uint64) bool
 	responseErrors int
 
-	fcClient       *flowcontrol.ClientNode // nil if the peer is server only
-	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
+	fcClient       *flowcontrol.ClientNode   // nil if the peer is server only
+	fcParams       *flowcontrol.ServerParams // flow control parameters assigned to the client (server side)
+	fcServer       *flowcontrol.ServerNode   // nil if the peer is client only
 	fcServerParams *flowcontrol.ServerParams
 	fcCosts        requestCostTable
+
+	multi       *multiCollector // Collector of the messages bundled into a multi-request or reply, if any
+	multiLock   sync.Mutex      // Protects the multi-request collector
+	collectLock sync.Mutex      // Serializes the assembly of multi-requests and replies
+
+	isTrusted      bool                      // Trusted server in ultra-light client mode
+	checkpoint     *params.TrustedCheckpoint // Oracle checkpoint announced by the server
+	checkpointSigs [][]byte                  // Oracle admin signatures of the announced checkpoint
 }
 
 func newPeer(version int, network uint64, p *p2p.Peer, rw p2p.MsgReadWriter) *peer {
@@ -147,6 +158,77 @@ func (p *peer) waitBefore(maxCost uint64) (time.Duration, float64) {
 	return p.fcServer.CanSend(maxCost)
 }
 
+// multiCollector gathers the messages written by the request and reply methods of
+// a peer while a multi-request is being assembled or served, along with the last
+// buffer value and the sum of the costs charged for serving the requests. Only
+// the messages of the bundled request IDs are gathered, any other ones sent in
+// the meantime go to the network as usual.
+type multiCollector struct {
+	ids  map[uint64]bool
+	msgs []multiRequest
+	bv   uint64
+	cost uint64
+}
+
+// WriteMsg implements p2p.MsgWriter, collecting the message instead of sending it.
+func (c *multiCollector) WriteMsg(msg p2p.Msg) error {
+	data, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	c.msgs = append(c.msgs, multiRequest{Code: msg.Code, Data: data})
+	return nil
+}
+
+// msgWriter returns the writer used by the request and reply methods for the
+// given request ID, which is the multi-request collector if one is being
+// assembled or served with the request bundled into it.
+func (p *peer) msgWriter(reqID uint64) p2p.MsgWriter {
+	p.multiLock.Lock()
+	defer p.multiLock.Unlock()
+
+	if p.multi != nil && p.multi.ids[reqID] {
+		return p.multi
+	}
+	return p.rw
+}
+
+// collect runs the given function, gathering the requests or replies with the
+// given IDs it sends instead of writing them to the network.
+func (p *peer) collect(ids []uint64, fn func() error) (*multiCollector, error) {
+	p.collectLock.Lock()
+	defer p.collectLock.Unlock()
+
+	c := &multiCollector{ids: make(map[uint64]bool, len(ids))}
+	for _, id := range ids {
+		c.ids[id] = true
+	}
+	p.setCollector(c)
+	defer p.setCollector(nil)
+
+	err := fn()
+	return c, err
+}
+
+// setCollector sets the multi-request collector being assembled or served.
+func (p *peer) setCollector(c *multiCollector) {
+	p.multiLock.Lock()
+	defer p.multiLock.Unlock()
+	p.multi = c
+}
+
+// chargeCollected accounts the buffer value and the cost of a request served as
+// part of a multi-request, if one is being served.
+func (p *peer) chargeCollected(bv, cost uint64) {
+	p.multiLock.Lock()
+	defer p.multiLock.Unlock()
+
+	if p.multi != nil {
+		p.multi.bv = bv
+		p.multi.cost += cost
+	}
+}
+
 func sendRequest(w p2p.MsgWriter, msgcode, reqID, cost uint64, data interface{}) error {
 	type req struct {
 		ReqID uint64
@@ -190,84 +272,90 @@ func (p *peer) SendAnnounce(request announceData) error {
 
 // SendBlockHeaders sends a batch of block headers to the remote peer.
 func (p *peer) SendBlockHeaders(reqID, bv uint64, headers []*types.Header) error {
-	return sendResponse(p.rw, BlockHeadersMsg, reqID, bv, headers)
+	return sendResponse(p.msgWriter(reqID), BlockHeadersMsg, reqID, bv, headers)
 }
 
 // SendBlockBodiesRLP sends a batch of block contents to the remote peer from
 // an already RLP encoded format.
 func (p *peer) SendBlockBodiesRLP(reqID, bv uint64, bodies []rlp.RawValue) error {
-	return sendResponse(p.rw, BlockBodiesMsg, reqID, bv, bodies)
+	return sendResponse(p.msgWriter(reqID), BlockBodiesMsg, reqID, bv, bodies)
 }
 
 // SendCodeRLP sends a batch of arbitrary internal data, corresponding to the
 // hashes requested.
 func (p *peer) SendCode(reqID, bv uint64, data [][]byte) error {
-	return sendResponse(p.rw, CodeMsg, reqID, bv, data)
+	return sendResponse(p.msgWriter(reqID), CodeMsg, reqID, bv, data)
 }
 
 // SendReceiptsRLP sends a batch of transaction receipts, corresponding to the
 // ones requested from an already RLP encoded format.
 func (p *peer) SendReceiptsRLP(reqID, bv uint64, receipts []rlp.RawValue) error {
-	return sendResponse(p.rw, ReceiptsMsg, reqID, bv, receipts)
+	return sendResponse(p.msgWriter(reqID), ReceiptsMsg, reqID, bv, receipts)
 }
 
 // SendProofs sends a batch of legacy LES/1 merkle proofs, corresponding to the ones requested.
 func (p *peer) SendProofs(reqID, bv uint64, proofs proofsData) error {
-	return sendResponse(p.rw, ProofsV1Msg, reqID, bv, proofs)
+	return sendResponse(p.msgWriter(reqID), ProofsV1Msg, reqID, bv, proofs)
 }
 
 // SendProofsV2 sends a batch of merkle proofs, corresponding to the ones requested.
 func (p *peer) SendProofsV2(reqID, bv uint64, proofs light.NodeList) error {
-	return sendResponse(p.rw, ProofsV2Msg, reqID, bv, proofs)
+	return sendResponse(p.msgWriter(reqID), ProofsV2Msg, reqID, bv, proofs)
 }
 
 // SendHeaderProofs sends a batch of legacy LES/1 header proofs, corresponding to the ones requested.
 func (p *peer) SendHeaderProofs(reqID, bv uint64, proofs []ChtResp) error {
-	return sendResponse(p.rw, HeaderProofsMsg, reqID, bv, proofs)
+	return sendResponse(p.msgWriter(reqID), HeaderProofsMsg, reqID, bv, proofs)
 }
 
 // SendHelperTrieProofs sends a batch of HelperTrie proofs, corresponding to the ones requested.
 func (p *peer) SendHelperTrieProofs(reqID, bv uint64, resp HelperTrieResps) error {
-	return sendResponse(p.rw, HelperTrieProofsMsg, reqID, bv, resp)
+	return sendResponse(p.msgWriter(reqID), HelperTrieProofsMsg, reqID, bv, resp)
 }
 
 // SendTxStatus sends a batch of transaction status records, corresponding to the ones requested.
 func (p *peer) SendTxStatus(reqID, bv uint64, stats []txStatus) error {
-	return sendResponse(p.rw, TxStatusMsg, reqID, bv, stats)
+	return sendResponse(p.msgWriter(reqID), TxStatusMsg, reqID, bv, stats)
+}
+
+// SendMulti sends a batch of replies to the bundled requests of a multi-request,
+// corresponding to the ones requested from an already established connection.
+func (p *peer) SendMulti(reqID, bv uint64, replies []multiReply) error {
+	return sendResponse(p.rw, MultiMsg, reqID, bv, replies)
 }
 
 // RequestHeadersByHash fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the hash of an origin block.
 func (p *peer) RequestHeadersByHash(reqID, cost uint64, origin common.Hash, amount int, skip int, reverse bool) error {
 	p.Log().Debug("Fetching batch of headers", "count", amount, "fromhash", origin, "skip", skip, "reverse", reverse)
-	return sendRequest(p.rw, GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return sendRequest(p.msgWriter(reqID), GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{Origin: hashOrNumber{Hash: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
 // RequestHeadersByNumber fetches a batch of blocks' headers corresponding to the
 // specified header query, based on the number of an origin block.
 func (p *peer) RequestHeadersByNumber(reqID, cost, origin uint64, amount int, skip int, reverse bool) error {
 	p.Log().Debug("Fetching batch of headers", "count", amount, "fromnum", origin, "skip", skip, "reverse", reverse)
-	return sendRequest(p.rw, GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
+	return sendRequest(p.msgWriter(reqID), GetBlockHeadersMsg, reqID, cost, &getBlockHeadersData{Origin: hashOrNumber{Number: origin}, Amount: uint64(amount), Skip: uint64(skip), Reverse: reverse})
 }
 
 // RequestBodies fetches a batch of blocks' bodies corresponding to the hashes
 // specified.
 func (p *peer) RequestBodies(reqID, cost uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of block bodies", "count", len(hashes))
-	return sendRequest(p.rw, GetBlockBodiesMsg, reqID, cost, hashes)
+	return sendRequest(p.msgWriter(reqID), GetBlockBodiesMsg, reqID, cost, hashes)
 }
 
 // RequestCode fetches a batch of arbitrary data from a node's known state
 // data, corresponding to the specified hashes.
 func (p *peer) RequestCode(reqID, cost uint64, reqs []CodeReq) error {
 	p.Log().Debug("Fetching batch of codes", "count", len(reqs))
-	return sendRequest(p.rw, GetCodeMsg, reqID, cost, reqs)
+	return sendRequest(p.msgWriter(reqID), GetCodeMsg, reqID, cost, reqs)
 }
 
 // RequestReceipts fetches a batch of transaction receipts from a remote node.
 func (p *peer) RequestReceipts(reqID, cost uint64, hashes []common.Hash) error {
 	p.Log().Debug("Fetching batch of receipts", "count", len(hashes))
-	return sendRequest(p.rw, GetReceiptsMsg, reqID, cost, hashes)
+	return sendRequest(p.msgWriter(reqID), GetReceiptsMsg, reqID, cost, hashes)
 }
 
 // RequestProofs fetches a batch of merkle proofs from a remote node.
@@ -275,9 +363,9 @@ func (p *peer) RequestProofs(reqID, cost uint64, reqs []ProofReq) error {
 	p.Log().Debug("Fetching batch of proofs", "count", len(reqs))
 	switch p.version {
 	case lpv1:
-		return sendRequest(p.rw, GetProofsV1Msg, reqID, cost, reqs)
-	case lpv2:
-		return sendRequest(p.rw, GetProofsV2Msg, reqID, cost, reqs)
+		return sendRequest(p.msgWriter(reqID), GetProofsV1Msg, reqID, cost, reqs)
+	case lpv2, lpv3:
+		return sendRequest(p.msgWriter(reqID), GetProofsV2Msg, reqID, cost, reqs)
 	default:
 		panic(nil)
 	}
@@ -292,14 +380,14 @@ func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, data interface{}) err
 			return errInvalidHelpTrieReq
 		}
 		p.Log().Debug("Fetching batch of header proofs", "count", len(reqs))
-		return sendRequest(p.rw, GetHeaderProofsMsg, reqID, cost, reqs)
-	case lpv2:
+		return sendRequest(p.msgWriter(reqID), GetHeaderProofsMsg, reqID, cost, reqs)
+	case lpv2, lpv3:
 		reqs, ok := data.([]HelperTrieReq)
 		if !ok {
 			return errInvalidHelpTrieReq
 		}
 		p.Log().Debug("Fetching batch of HelperTrie proofs", "count", len(reqs))
-		return sendRequest(p.rw, GetHelperTrieProofsMsg, reqID, cost, reqs)
+		return sendRequest(p.msgWriter(reqID), GetHelperTrieProofsMsg, reqID, cost, reqs)
 	default:
 		panic(nil)
 	}
@@ -308,7 +396,7 @@ func (p *peer) RequestHelperTrieProofs(reqID, cost uint64, data interface{}) err
 // RequestTxStatus fetches a batch of transaction status records from a remote node.
 func (p *peer) RequestTxStatus(reqID, cost uint64, txHashes []common.Hash) error {
 	p.Log().Debug("Requesting transaction status", "count", len(txHashes))
-	return sendRequest(p.rw, GetTxStatusMsg, reqID, cost, txHashes)
+	return sendRequest(p.msgWriter(reqID), GetTxStatusMsg, reqID, cost, txHashes)
 }
 
 // SendTxStatus sends a batch of transactions to be added to the remote transaction pool.
@@ -317,13 +405,58 @@ func (p *peer) SendTxs(reqID, cost uint64, txs types.Transactions) error {
 	switch p.version {
 	case lpv1:
 		return p2p.Send(p.rw, SendTxMsg, txs) // old message format does not include reqID
-	case lpv2:
-		return sendRequest(p.rw, SendTxV2Msg, reqID, cost, txs)
+	case lpv2, lpv3:
+		return sendRequest(p.msgWriter(reqID), SendTxV2Msg, reqID, cost, txs)
 	default:
 		panic(nil)
 	}
 }
 
+// RequestMulti sends several heterogeneous requests bundled into one message,
+// to be answered in a single reply.
+func (p *peer) RequestMulti(reqID, cost uint64, reqs []multiRequest) error {
+	p.Log().Debug("Sending batch of requests", "count", len(reqs))
+	return sendRequest(p.rw, GetMultiMsg, reqID, cost, reqs)
+}
+
+// updateCapacity assigns new flow control parameters to a client and announces
+// them, changing the capacity of a client without disconnecting it. Only lpv3
+// clients are able to process such announcements.
+func (p *peer) updateCapacity(params *flowcontrol.ServerParams) {
+	p.lock.Lock()
+	p.fcParams = params
+	p.lock.Unlock()
+
+	p.fcClient.UpdateParams(params)
+
+	var update keyValueList
+	update = update.add("flowControl/BL", params.BufLimit)
+	update = update.add("flowControl/MRR", params.MinRecharge)
+	p.queueSend(func() { p.SendAnnounce(announceData{Update: update}) })
+}
+
+// updateFlowControl applies the flow control parameters announced by a server
+// after changing the capacity assigned to us, if the announcement contains any.
+func (p *peer) updateFlowControl(update keyValueMap) error {
+	if _, ok := update["flowControl/BL"]; !ok {
+		return nil
+	}
+	params := &flowcontrol.ServerParams{}
+	if err := update.get("flowControl/BL", &params.BufLimit); err != nil {
+		return err
+	}
+	if err := update.get("flowControl/MRR", &params.MinRecharge); err != nil {
+		return err
+	}
+	p.lock.Lock()
+	p.fcServerParams = params
+	p.lock.Unlock()
+
+	p.fcServer.UpdateParams(params)
+	p.Log().Debug("Server capacity updated", "bufLimit", params.BufLimit, "minRecharge", params.MinRecharge)
+	return nil
+}
+
 type keyValueEntry struct {
 	Key   string
 	Value rlp.RawValue
@@ -409,13 +542,24 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		send = send.add("serveChainSince", uint64(0))
 		send = send.add("serveStateSince", uint64(0))
 		send = send.add("txRelay", nil)
-		send = send.add("flowControl/BL", server.defParams.BufLimit)
-		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
+		if p.fcParams == nil {
+			p.fcParams = server.defParams
+		}
+		send = send.add("flowControl/BL", p.fcParams.BufLimit)
+		send = send.add("flowControl/MRR", p.fcParams.MinRecharge)
 		list := server.fcCostStats.getCurrentList()
 		send = send.add("flowControl/MRC", list)
 		p.fcCosts = list.decode()
+		if checkpoint, sigs := server.oracleCheckpoint(); checkpoint != nil {
+			send = send.add("checkpoint/value", checkpoint)
+			send = send.add("checkpoint/sigs", sigs)
+		}
 	} else {
-		p.requestAnnounceType = announceTypeSimple // set to default until "very light" client mode is implemented
+		p.requestAnnounceType = announceTypeSimple
+		if p.isTrusted {
+			// Ultra-light clients only accept heads signed by trusted servers
+			p.requestAnnounceType = announceTypeSigned
+		}
 		send = send.add("announceType", p.requestAnnounceType)
 	}
 	recvList, err := p.sendReceiveHandshake(send)
@@ -464,7 +608,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if recv.get("announceType", &p.announceType) != nil {
 			p.announceType = announceTypeSimple
 		}
-		p.fcClient = flowcontrol.NewClientNode(server.fcManager, server.defParams)
+		p.fcClient = flowcontrol.NewClientNode(server.fcManager, p.fcParams)
 	} else {
 		if recv.get("serveChainSince", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot serve chain")
@@ -490,6 +634,17 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		p.fcServer = flowcontrol.NewServerNode(params)
 		p.fcCosts = MRC.decode()
 	}
+	if server == nil {
+		// Servers with a checkpoint oracle announce the latest registered checkpoint
+		var checkpoint params.TrustedCheckpoint
+		if recv.get("checkpoint/value", &checkpoint) == nil {
+			var sigs [][]byte
+			if err := recv.get("checkpoint/sigs", &sigs); err != nil {
+				return err
+			}
+			p.checkpoint, p.checkpointSigs = &checkpoint, sigs
+		}
+	}
 
 	p.headInfo = &announceData{Td: rTd, Hash: rHash, Number: rNum}
 	return nil
@@ -0,0 +1,258 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/les/flowcontrol"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// bufLimitRatio is the ratio between the flow control buffer limit and the
+// minimum recharge rate (capacity) assigned to a client.
+const bufLimitRatio = 6000
+
+var (
+	// errTotalCapacityExceeded is returned if a priority client capacity change
+	// would overbook the total capacity of the server.
+	errTotalCapacityExceeded = errors.New("total capacity exceeded")
+
+	// errCapacityTooLow is returned if a priority client is assigned less
+	// capacity than free clients get.
+	errCapacityTooLow = errors.New("capacity below free client capacity")
+)
+
+// PaymentHandler is a pluggable accounting backend charging priority clients
+// for the requests served to them, based on the announced request cost table.
+type PaymentHandler interface {
+	// Charge debits the cost of a served request from the balance of a client.
+	// Returning an error signals that the client can't pay anymore, upon which
+	// it loses its priority connection.
+	Charge(id discover.NodeID, cost uint64) error
+}
+
+// priorityClientInfo is the capacity assigned to a priority client, along with
+// its connection status.
+type priorityClientInfo struct {
+	capacity  uint64
+	connected bool
+	peerID    string // LES peer id if connected
+}
+
+// priorityClientPool reserves guaranteed capacity for registered priority
+// clients, rebalancing the remaining capacity between the free clients admitted
+// by the free client pool. Each free client receives the same fixed capacity,
+// so the number of simultaneously connected free clients shrinks as priority
+// clients connect and grows again as they disconnect.
+type priorityClientPool struct {
+	lock       sync.Mutex
+	child      *freeClientPool
+	removePeer func(id string)
+	updatePeer func(id string, params *flowcontrol.ServerParams) bool // Changes the capacity of a connected client, if supported
+	payment    PaymentHandler
+
+	clients       map[discover.NodeID]*priorityClientInfo
+	totalCap      uint64 // Total capacity available for serving clients
+	freeClientCap uint64 // Capacity assigned to each free client
+	maxPeers      int    // Maximum number of connected clients
+
+	connectedCap   uint64 // Sum of the capacities of the connected priority clients
+	connectedCount int    // Number of connected priority clients
+}
+
+// newPriorityClientPool creates a priority client pool on top of a free client
+// pool, distributing the total capacity between the two client classes.
+func newPriorityClientPool(freeClientCap uint64, maxPeers int, child *freeClientPool, removePeer func(id string)) *priorityClientPool {
+	pool := &priorityClientPool{
+		child:         child,
+		removePeer:    removePeer,
+		clients:       make(map[discover.NodeID]*priorityClientInfo),
+		totalCap:      freeClientCap * uint64(maxPeers),
+		freeClientCap: freeClientCap,
+		maxPeers:      maxPeers,
+	}
+	pool.updateFreeLimit()
+	return pool
+}
+
+// serverParams returns the flow control parameters of a client with the given
+// capacity.
+func serverParams(capacity uint64) *flowcontrol.ServerParams {
+	return &flowcontrol.ServerParams{
+		BufLimit:    capacity * bufLimitRatio,
+		MinRecharge: capacity,
+	}
+}
+
+// connect admits a client as a priority one if it was registered and there is
+// enough unused capacity for it, returning the flow control parameters it was
+// granted. Clients not admitted are given the free client parameters and need
+// to be connected through the free client pool.
+func (pool *priorityClientPool) connect(id discover.NodeID, peerID string) (*flowcontrol.ServerParams, bool) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	client := pool.clients[id]
+	if client == nil || client.connected || pool.connectedCap+client.capacity > pool.totalCap || pool.connectedCount >= pool.maxPeers {
+		return serverParams(pool.freeClientCap), false
+	}
+	client.connected, client.peerID = true, peerID
+	pool.connectedCap += client.capacity
+	pool.connectedCount++
+	pool.updateFreeLimit()
+
+	log.Debug("Priority client connected", "id", id, "capacity", client.capacity)
+	return serverParams(client.capacity), true
+}
+
+// disconnect releases the capacity reserved for a connected priority client.
+func (pool *priorityClientPool) disconnect(id discover.NodeID) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	client := pool.clients[id]
+	if client == nil || !client.connected {
+		return
+	}
+	pool.release(id, client)
+}
+
+// release marks a priority client as disconnected and returns its capacity to
+// the free clients. The caller must hold the pool lock.
+func (pool *priorityClientPool) release(id discover.NodeID, client *priorityClientInfo) {
+	client.connected, client.peerID = false, ""
+	pool.connectedCap -= client.capacity
+	pool.connectedCount--
+	if client.capacity == 0 {
+		delete(pool.clients, id)
+	}
+	pool.updateFreeLimit()
+
+	log.Debug("Priority client disconnected", "id", id)
+}
+
+// charge debits the cost of a served request from a connected priority client
+// through the payment handler, dropping the client if it can't pay.
+func (pool *priorityClientPool) charge(id discover.NodeID, cost uint64) {
+	pool.lock.Lock()
+	client, payment := pool.clients[id], pool.payment
+	if client == nil || !client.connected || payment == nil {
+		pool.lock.Unlock()
+		return
+	}
+	peerID := client.peerID
+	pool.lock.Unlock()
+
+	if err := payment.Charge(id, cost); err != nil {
+		log.Debug("Priority client payment failed", "id", id, "cost", cost, "err", err)
+		go pool.removePeer(peerID)
+	}
+}
+
+// setPaymentHandler sets the accounting backend charging priority clients.
+func (pool *priorityClientPool) setPaymentHandler(payment PaymentHandler) {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	pool.payment = payment
+}
+
+// setClientCapacity registers a priority client with the given guaranteed
+// capacity, or unregisters it if the capacity is zero. If the client is already
+// connected, its new capacity is announced to it, or if it isn't able to process
+// such announcements, it is dropped so it reconnects with the updated parameters.
+func (pool *priorityClientPool) setClientCapacity(id discover.NodeID, capacity uint64) error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if capacity != 0 && capacity < pool.freeClientCap {
+		return errCapacityTooLow
+	}
+	client := pool.clients[id]
+	if client == nil {
+		if capacity == 0 {
+			return nil
+		}
+		client = new(priorityClientInfo)
+		pool.clients[id] = client
+	}
+	if client.connected {
+		if pool.connectedCap-client.capacity+capacity > pool.totalCap {
+			return errTotalCapacityExceeded
+		}
+		pool.connectedCap = pool.connectedCap - client.capacity + capacity
+		client.capacity = capacity
+		pool.updateFreeLimit()
+
+		peerID, update := client.peerID, pool.updatePeer
+		go func() {
+			if update == nil || !update(peerID, serverParams(capacity)) {
+				pool.removePeer(peerID)
+			}
+		}()
+		return nil
+	}
+	if capacity == 0 {
+		delete(pool.clients, id)
+		return nil
+	}
+	client.capacity = capacity
+	return nil
+}
+
+// clientCapacity returns the capacity assigned to a priority client, or zero if
+// it isn't one.
+func (pool *priorityClientPool) clientCapacity(id discover.NodeID) uint64 {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if client := pool.clients[id]; client != nil {
+		return client.capacity
+	}
+	return 0
+}
+
+// setTotalCapacity updates the total capacity available for serving clients.
+// Reducing it below the capacity of the connected priority clients fails.
+func (pool *priorityClientPool) setTotalCapacity(capacity uint64) error {
+	pool.lock.Lock()
+	defer pool.lock.Unlock()
+
+	if capacity < pool.connectedCap {
+		return errTotalCapacityExceeded
+	}
+	pool.totalCap = capacity
+	pool.updateFreeLimit()
+	return nil
+}
+
+// updateFreeLimit recalculates the number of free clients that fit into the
+// capacity left over by the connected priority clients, and pushes the limit
+// down to the free client pool. The caller must hold the pool lock.
+func (pool *priorityClientPool) updateFreeLimit() {
+	if pool.child == nil {
+		return
+	}
+	limit := int((pool.totalCap - pool.connectedCap) / pool.freeClientCap)
+	if max := pool.maxPeers - pool.connectedCount; limit > max {
+		limit = max
+	}
+	pool.child.setConnectedLimit(limit)
+}
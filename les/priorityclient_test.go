@@ -0,0 +1,148 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/mclock"
+	"github.com/ethereum/go-ethereum/ethdb"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// testPayment is a mock payment handler with a fixed balance per client.
+type testPayment struct {
+	lock     sync.Mutex
+	balances map[discover.NodeID]uint64
+}
+
+func (p *testPayment) Charge(id discover.NodeID, cost uint64) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.balances[id] < cost {
+		return errors.New("insufficient balance")
+	}
+	p.balances[id] -= cost
+	return nil
+}
+
+// Tests that priority clients get their guaranteed capacity and free clients
+// are rebalanced into the remaining capacity.
+func TestPriorityClientPoolRebalance(t *testing.T) {
+	var (
+		clock   mclock.Simulated
+		free    = newFreeClientPool(ethdb.NewMemDatabase(), 10, 10000, &clock)
+		removed = make(chan string, 10)
+		kicked  = make(chan int, 10)
+		pool    = newPriorityClientPool(100, 10, free, func(id string) { removed <- id })
+	)
+	// Fill up the server with free clients
+	for i := 0; i < 10; i++ {
+		i := i
+		if !free.connect(fmt.Sprintf("free #%d", i), func() { kicked <- i }) {
+			t.Fatalf("free client #%d rejected", i)
+		}
+		clock.Run(time.Second)
+	}
+	// Registering a priority client should not affect anyone until it connects
+	alice, bob := discover.NodeID{1}, discover.NodeID{2}
+	if err := pool.setClientCapacity(alice, 50); err != errCapacityTooLow {
+		t.Fatalf("low capacity error mismatch: have %v, want %v", err, errCapacityTooLow)
+	}
+	if err := pool.setClientCapacity(alice, 300); err != nil {
+		t.Fatalf("failed to set client capacity: %v", err)
+	}
+	if len(kicked) != 0 {
+		t.Fatalf("free clients kicked before priority client connected")
+	}
+	// Connecting it should reserve its capacity, kicking out three free clients
+	params, priority := pool.connect(alice, "alice")
+	if !priority {
+		t.Fatalf("priority client not admitted")
+	}
+	if params.MinRecharge != 300 || params.BufLimit != 300*bufLimitRatio {
+		t.Errorf("priority client params mismatch: have %+v", params)
+	}
+	if len(kicked) != 3 {
+		t.Fatalf("kicked free client count mismatch: have %d, want 3", len(kicked))
+	}
+	// A second priority client exceeding the capacity should be treated as free
+	pool.setClientCapacity(bob, 800)
+	if params, priority := pool.connect(bob, "bob"); priority || params.MinRecharge != 100 {
+		t.Errorf("overbooked priority client admitted: %v, %+v", priority, params)
+	}
+	// Disconnecting the priority client should make room for free clients again
+	pool.disconnect(alice)
+	for i := 0; i < 3; i++ {
+		if !free.connect(fmt.Sprintf("new free #%d", i), func() {}) {
+			t.Fatalf("free client rejected after priority client left")
+		}
+	}
+	// Dropping the priority status of a connected client should disconnect it
+	pool.connect(alice, "alice")
+	if err := pool.setClientCapacity(alice, 0); err != nil {
+		t.Fatalf("failed to remove client capacity: %v", err)
+	}
+	select {
+	case id := <-removed:
+		if id != "alice" {
+			t.Errorf("removed peer mismatch: have %s, want alice", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("priority client not dropped")
+	}
+	pool.disconnect(alice)
+	if pool.clientCapacity(alice) != 0 || pool.connectedCap != 0 {
+		t.Errorf("priority client not unregistered: capacity %d, connected %d", pool.clientCapacity(alice), pool.connectedCap)
+	}
+}
+
+// Tests that priority clients are charged for their requests, and dropped if
+// they can't pay.
+func TestPriorityClientPoolPayment(t *testing.T) {
+	var (
+		removed = make(chan string, 1)
+		payment = &testPayment{balances: make(map[discover.NodeID]uint64)}
+		pool    = newPriorityClientPool(100, 10, nil, func(id string) { removed <- id })
+		alice   = discover.NodeID{1}
+	)
+	pool.setPaymentHandler(payment)
+	pool.setClientCapacity(alice, 200)
+	pool.connect(alice, "alice")
+
+	payment.balances[alice] = 100
+	pool.charge(alice, 60)
+	if payment.balances[alice] != 40 {
+		t.Fatalf("balance mismatch: have %d, want 40", payment.balances[alice])
+	}
+	pool.charge(alice, 60)
+	select {
+	case id := <-removed:
+		if id != "alice" {
+			t.Errorf("removed peer mismatch: have %s, want alice", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("insolvent priority client not dropped")
+	}
+	// Free clients should never be charged
+	pool.charge(discover.NodeID{2}, 1)
+}
@@ -38,17 +38,18 @@ import (
 const (
 	lpv1 = 1
 	lpv2 = 2
+	lpv3 = 3
 )
 
 // Supported versions of the les protocol (first is primary)
 var (
-	ClientProtocolVersions    = []uint{lpv2, lpv1}
-	ServerProtocolVersions    = []uint{lpv2, lpv1}
-	AdvertiseProtocolVersions = []uint{lpv2} // clients are searching for the first advertised protocol in the list
+	ClientProtocolVersions    = []uint{lpv3, lpv2, lpv1}
+	ServerProtocolVersions    = []uint{lpv3, lpv2, lpv1}
+	AdvertiseProtocolVersions = []uint{lpv3, lpv2} // clients are searching for the first advertised protocol in the list
 )
 
 // Number of implemented message corresponding to different protocol versions.
-var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22}
+var ProtocolLengths = map[uint]uint64{lpv1: 15, lpv2: 22, lpv3: 24}
 
 const (
 	NetworkId          = 1
@@ -81,6 +82,9 @@ const (
 	SendTxV2Msg            = 0x13
 	GetTxStatusMsg         = 0x14
 	TxStatusMsg            = 0x15
+	// Protocol messages belonging to LPV3
+	GetMultiMsg = 0x16
+	MultiMsg    = 0x17
 )
 
 type errCode int
@@ -125,6 +129,21 @@ var errorToString = map[int]string{
 	ErrMissingKey:              "Key missing from list",
 }
 
+// multiRequest is a single request bundled into a multi-request message, encoded
+// exactly as the standalone request message would be.
+type multiRequest struct {
+	Code uint64
+	Data rlp.RawValue
+}
+
+// multiReply is a single reply bundled into a multi-reply message, along with the
+// cost the server actually charged for serving the request.
+type multiReply struct {
+	Code uint64
+	Cost uint64
+	Data rlp.RawValue
+}
+
 type announceBlock struct {
 	Hash   common.Hash // Hash of one particular block being announced
 	Number uint64      // Number of one particular block being announced
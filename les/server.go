@@ -18,12 +18,15 @@
 package les
 
 import (
+	"context"
 	"crypto/ecdsa"
 	"encoding/binary"
 	"math"
 	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/mclock"
 	"github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -36,6 +39,7 @@ import (
 	"github.com/ethereum/go-ethereum/p2p/discv5"
 	"github.com/ethereum/go-ethereum/params"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type LesServer struct {
@@ -47,11 +51,13 @@ type LesServer struct {
 	lesTopics   []discv5.Topic
 	privateKey  *ecdsa.PrivateKey
 	quitSync    chan struct{}
+
+	priorityClientPool *priorityClientPool
 }
 
 func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 	quitSync := make(chan struct{})
-	pm, err := NewProtocolManager(eth.BlockChain().Config(), light.DefaultServerIndexerConfig, false, config.NetworkId, eth.EventMux(), eth.Engine(), newPeerSet(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil, nil, quitSync, new(sync.WaitGroup))
+	pm, err := NewProtocolManager(eth.BlockChain().Config(), light.DefaultServerIndexerConfig, nil, false, config.NetworkId, eth.EventMux(), eth.Engine(), newPeerSet(), eth.BlockChain(), eth.TxPool(), eth.ChainDb(), nil, nil, nil, quitSync, new(sync.WaitGroup))
 	if err != nil {
 		return nil, err
 	}
@@ -98,12 +104,21 @@ func NewLesServer(eth *eth.Ethereum, config *eth.Config) (*LesServer, error) {
 	srv.chtIndexer.Start(eth.BlockChain())
 	pm.server = srv
 
+	if config.CheckpointOracle != nil {
+		srv.oracle = newCheckpointOracle(config.CheckpointOracle, eth.APIBackend)
+	}
+
 	srv.defParams = &flowcontrol.ServerParams{
 		BufLimit:    300000000,
 		MinRecharge: 50000,
 	}
 	srv.fcManager = flowcontrol.NewClientManager(uint64(config.LightServ), 10, 1000000000)
 	srv.fcCostStats = newCostStats(eth.ChainDb())
+
+	// Create the client pools before the protocol manager starts accepting peers
+	pm.clientPool = newFreeClientPool(eth.ChainDb(), config.LightPeers, 10000, mclock.System{})
+	srv.priorityClientPool = newPriorityClientPool(srv.defParams.MinRecharge, config.LightPeers, pm.clientPool, pm.removePeer)
+	srv.priorityClientPool.updatePeer = pm.updateCapacity
 	return srv, nil
 }
 
@@ -111,6 +126,55 @@ func (s *LesServer) Protocols() []p2p.Protocol {
 	return s.makeProtocols(ServerProtocolVersions)
 }
 
+// APIs returns the administrative RPC APIs of the LES server.
+func (s *LesServer) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPrivateLightServerAPI(s),
+			Public:    false,
+		}, {
+			Namespace: "les",
+			Version:   "1.0",
+			Service:   NewPublicLightAPI(&s.lesCommons),
+			Public:    true,
+		},
+	}
+}
+
+// oracleCheckpoint returns the latest checkpoint registered in the checkpoint
+// oracle along with its admin signatures, if the local indexers generated the
+// same checkpoint. It is announced to light clients during the handshake.
+func (s *LesServer) oracleCheckpoint() (*params.TrustedCheckpoint, [][]byte) {
+	if s.oracle == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	index, hash, _, sigs, err := s.oracle.latestCheckpoint(ctx)
+	if err != nil {
+		log.Debug("Failed to retrieve oracle checkpoint", "err", err)
+		return nil, nil
+	}
+	if len(sigs) == 0 {
+		return nil, nil
+	}
+	checkpoint := s.localCheckpoint(index)
+	if checkpoint.Hash() != hash {
+		log.Debug("Oracle checkpoint not available locally", "section", index, "hash", hash)
+		return nil, nil
+	}
+	return &checkpoint, sigs
+}
+
+// SetPaymentHandler sets the accounting backend charging priority clients for
+// the requests served to them.
+func (s *LesServer) SetPaymentHandler(payment PaymentHandler) {
+	s.priorityClientPool.setPaymentHandler(payment)
+}
+
 // Start starts the LES server
 func (s *LesServer) Start(srvr *p2p.Server) {
 	s.protocolManager.Start(s.config.LightPeers)
@@ -72,8 +72,14 @@ func (pm *ProtocolManager) synchronise(peer *peer) {
 		return
 	}
 
+	// Start syncing from the oracle checkpoint announced by the peer if it is
+	// signed by enough trusted admins and newer than the current one
+	chain := pm.blockchain.(*light.LightChain)
+	if checkpoint := peer.checkpoint; checkpoint != nil && pm.oracle != nil && pm.oracle.verifyCheckpoint(checkpoint, peer.checkpointSigs) {
+		chain.AddTrustedCheckpoint(checkpoint)
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
-	pm.blockchain.(*light.LightChain).SyncCht(ctx)
+	chain.SyncCht(ctx)
 	pm.downloader.Synchronise(peer.id, peer.Head(), peer.Td(), downloader.LightSync)
 }
@@ -0,0 +1,90 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// ulc holds the configuration of the ultra-light client mode. In this mode new
+// heads are accepted once a sufficient fraction of the trusted servers announced
+// them with a valid signature, and headers are inserted without verifying their
+// seals.
+type ulc struct {
+	trustedServers     []*discover.Node
+	trustedKeys        map[discover.NodeID]bool
+	minTrustedFraction int
+}
+
+// newULC parses the ultra-light client configuration, returning nil if it's not
+// enabled or doesn't contain any valid trusted server.
+func newULC(config *eth.ULCConfig) *ulc {
+	if config == nil {
+		return nil
+	}
+	u := &ulc{
+		trustedKeys:        make(map[discover.NodeID]bool),
+		minTrustedFraction: config.MinTrustedFraction,
+	}
+	for _, url := range config.TrustedServers {
+		node, err := discover.ParseNode(url)
+		if err != nil {
+			log.Error("Invalid trusted server URL", "url", url, "err", err)
+			continue
+		}
+		if !u.trustedKeys[node.ID] {
+			u.trustedKeys[node.ID] = true
+			u.trustedServers = append(u.trustedServers, node)
+		}
+	}
+	if len(u.trustedKeys) == 0 {
+		log.Error("No valid trusted servers, ultra-light client mode disabled")
+		return nil
+	}
+	if u.minTrustedFraction <= 0 || u.minTrustedFraction > 100 {
+		log.Warn("Invalid minimum trusted fraction, using default", "fraction", u.minTrustedFraction, "default", eth.DefaultULCMinTrustedFraction)
+		u.minTrustedFraction = eth.DefaultULCMinTrustedFraction
+	}
+	log.Info("Ultra-light client mode enabled", "servers", len(u.trustedKeys), "fraction", u.minTrustedFraction)
+	return u
+}
+
+// isTrusted returns whether the given node is one of the trusted servers.
+func (u *ulc) isTrusted(id discover.NodeID) bool {
+	return u.trustedKeys[id]
+}
+
+// quorum returns whether the given number of trusted servers makes up at least
+// the minimum fraction of all configured trusted servers.
+func (u *ulc) quorum(count int) bool {
+	return count*100 >= u.minTrustedFraction*len(u.trustedKeys)
+}
+
+// ulcChain wraps the light chain used by the downloader in ultra-light client
+// mode, inserting headers without verifying their seals since the synced heads
+// are vouched for by the trusted servers.
+type ulcChain struct {
+	BlockChain
+}
+
+// InsertHeaderChain inserts a batch of headers, skipping seal verification.
+func (c ulcChain) InsertHeaderChain(chain []*types.Header, checkFreq int) (int, error) {
+	return c.BlockChain.InsertHeaderChain(chain, 0)
+}
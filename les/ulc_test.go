@@ -0,0 +1,105 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/eth"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// newTestULC creates an ultra-light client configuration with the given number
+// of random trusted servers, returning their node ids.
+func newTestULC(servers int, fraction int) (*ulc, []discover.NodeID) {
+	var (
+		config = &eth.ULCConfig{MinTrustedFraction: fraction}
+		ids    []discover.NodeID
+	)
+	for i := 0; i < servers; i++ {
+		key, _ := crypto.GenerateKey()
+		id := discover.PubkeyID(&key.PublicKey)
+		config.TrustedServers = append(config.TrustedServers, fmt.Sprintf("enode://%x@127.0.0.1:%d", id[:], 30303+i))
+		ids = append(ids, id)
+	}
+	return newULC(config), ids
+}
+
+// Tests that the ultra-light client configuration is parsed and validated.
+func TestULCConfig(t *testing.T) {
+	if newULC(nil) != nil {
+		t.Errorf("ultra-light mode enabled without configuration")
+	}
+	if newULC(&eth.ULCConfig{TrustedServers: []string{"invalid"}}) != nil {
+		t.Errorf("ultra-light mode enabled without valid trusted servers")
+	}
+	u, ids := newTestULC(3, 0)
+	if u.minTrustedFraction != eth.DefaultULCMinTrustedFraction {
+		t.Errorf("trusted fraction mismatch: have %d, want %d", u.minTrustedFraction, eth.DefaultULCMinTrustedFraction)
+	}
+	for _, id := range ids {
+		if !u.isTrusted(id) {
+			t.Errorf("server %x not trusted", id[:8])
+		}
+	}
+	if u.isTrusted(discover.NodeID{}) {
+		t.Errorf("unknown server trusted")
+	}
+}
+
+// Tests that heads are only requested in ultra-light mode once a sufficient
+// fraction of the trusted servers announced them.
+func TestULCTrustedQuorum(t *testing.T) {
+	u, ids := newTestULC(4, 50)
+	f := &lightFetcher{
+		pm:    &ProtocolManager{ulc: u},
+		peers: make(map[*peer]*fetcherPeerInfo),
+	}
+	var (
+		head  = common.Hash{0x01}
+		other = common.Hash{0x02}
+	)
+	announce := func(trusted bool, id discover.NodeID, hash common.Hash) {
+		p := &peer{id: fmt.Sprintf("%x", id[:8]), isTrusted: trusted}
+		f.peers[p] = &fetcherPeerInfo{nodeByHash: map[common.Hash]*fetcherTreeNode{hash: {hash: hash}}}
+	}
+	// Untrusted announcements should not count towards the quorum
+	for i := 0; i < 4; i++ {
+		announce(false, discover.NodeID{byte(i)}, head)
+	}
+	announce(true, ids[0], head)
+	if f.trustedQuorum(head) {
+		t.Fatalf("head accepted with a single trusted announcement")
+	}
+	// Reaching the required fraction of trusted servers should accept the head
+	announce(true, ids[1], other)
+	if f.trustedQuorum(head) {
+		t.Fatalf("head accepted with a trusted server announcing a different head")
+	}
+	announce(true, ids[2], head)
+	if !f.trustedQuorum(head) {
+		t.Fatalf("head rejected with half of the trusted servers announcing it")
+	}
+	// Without ultra-light mode, all heads should be accepted
+	f.pm.ulc = nil
+	if !f.trustedQuorum(other) {
+		t.Fatalf("head rejected in normal light client mode")
+	}
+}
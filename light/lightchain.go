@@ -71,6 +71,8 @@ type LightChain struct {
 	wg            sync.WaitGroup
 
 	engine consensus.Engine
+
+	checkpoint *params.TrustedCheckpoint // Latest trusted checkpoint added to the chain
 }
 
 // NewLightChain returns a fully initialised light chain using information
@@ -117,8 +119,23 @@ func NewLightChain(odr OdrBackend, config *params.ChainConfig, engine consensus.
 	return bc, nil
 }
 
+// AddTrustedCheckpoint adds a checkpoint verified by the caller (e.g. signed by
+// the admins of a checkpoint oracle) if it is newer than the current one. It
+// returns whether the checkpoint was added.
+func (self *LightChain) AddTrustedCheckpoint(cp *params.TrustedCheckpoint) bool {
+	self.mu.Lock()
+	defer self.mu.Unlock()
+
+	if self.checkpoint != nil && self.checkpoint.SectionIndex >= cp.SectionIndex {
+		return false
+	}
+	self.addTrustedCheckpoint(cp)
+	return true
+}
+
 // addTrustedCheckpoint adds a trusted checkpoint to the blockchain
 func (self *LightChain) addTrustedCheckpoint(cp *params.TrustedCheckpoint) {
+	self.checkpoint = cp
 	if self.odr.ChtIndexer() != nil {
 		StoreChtRoot(self.chainDb, cp.SectionIndex, cp.SectionHead, cp.CHTRoot)
 		self.odr.ChtIndexer().AddCheckpoint(cp.SectionIndex, cp.SectionHead)
@@ -281,6 +281,10 @@ func (odr *dummyOdr) IndexerConfig() *IndexerConfig {
 	return odr.indexerConfig
 }
 
+func (odr *dummyOdr) ChtIndexer() *core.ChainIndexer       { return nil }
+func (odr *dummyOdr) BloomTrieIndexer() *core.ChainIndexer { return nil }
+func (odr *dummyOdr) BloomIndexer() *core.ChainIndexer     { return nil }
+
 // Tests that reorganizing a long difficult chain after a short easy one
 // overwrites the canonical numbers and links in the database.
 func TestReorgLongHeaders(t *testing.T) {
@@ -352,3 +356,26 @@ func TestReorgBadHeaderHashes(t *testing.T) {
 		t.Errorf("last header hash mismatch: have: %x, want %x", ncm.CurrentHeader().Hash(), headers[2].Hash())
 	}
 }
+
+// Tests that trusted checkpoints are only added if newer than the current one.
+func TestAddTrustedCheckpoint(t *testing.T) {
+	_, chain, err := newCanonical(0)
+	if err != nil {
+		t.Fatalf("failed to create light chain: %v", err)
+	}
+	tests := []struct {
+		section uint64
+		added   bool
+	}{
+		{5, true},  // first checkpoint
+		{5, false}, // same section again
+		{3, false}, // older section
+		{6, true},  // newer section
+	}
+	for i, tt := range tests {
+		cp := &params.TrustedCheckpoint{SectionIndex: tt.section, SectionHead: common.Hash{byte(tt.section)}}
+		if added := chain.AddTrustedCheckpoint(cp); added != tt.added {
+			t.Errorf("test %d: checkpoint %d added mismatch: have %v, want %v", i, tt.section, added, tt.added)
+		}
+	}
+}
@@ -281,6 +281,17 @@ func (w *worker) isRunning() bool {
 	return atomic.LoadInt32(&w.running) == 1
 }
 
+// isInstantSealing returns whether the next block is sealed by clique with a zero
+// period, sealing blocks on demand as transactions arrive. Hybrid chains seal
+// with ethash past the switch block, regardless of the clique config.
+func (w *worker) isInstantSealing() bool {
+	if w.config.Clique == nil || w.config.Clique.Period > 0 {
+		return false
+	}
+	next := new(big.Int).Add(w.chain.CurrentBlock().Number(), common.Big1)
+	return !w.config.IsEthash(next)
+}
+
 // close terminates all background threads maintained by the worker.
 // Note the worker does not support being closed multiple times.
 func (w *worker) close() {
@@ -355,7 +366,7 @@ func (w *worker) newWorkLoop(recommit time.Duration) {
 		case <-timer.C:
 			// If mining is running resubmit a new work cycle periodically to pull in
 			// higher priced transactions. Disable this overhead for pending blocks.
-			if w.isRunning() && (w.config.Clique == nil || w.config.Clique.Period > 0) {
+			if w.isRunning() && !w.isInstantSealing() {
 				// Short circuit if no new transaction arrives.
 				if atomic.LoadInt32(&w.newTxs) == 0 {
 					timer.Reset(recommit)
@@ -470,7 +481,7 @@ func (w *worker) mainLoop() {
 				w.updateSnapshot()
 			} else {
 				// If we're mining, but nothing is being processed, wake on new transactions
-				if w.config.Clique != nil && w.config.Clique.Period == 0 {
+				if w.isInstantSealing() {
 					w.commitNewWork(nil, false, time.Now().Unix())
 				}
 			}
@@ -452,3 +452,28 @@ func testAdjustInterval(t *testing.T, chainConfig *params.ChainConfig, engine co
 		t.Error("interval reset timeout")
 	}
 }
+
+// Tests that zero period clique sealing is only used until the ethash switch
+// block of a hybrid chain.
+func TestInstantSealingHybrid(t *testing.T) {
+	config := *params.TestChainConfig
+	config.Clique = &params.CliqueConfig{Period: 0, Epoch: 30000}
+
+	for _, tt := range []struct {
+		switchBlock int64
+		instant     bool
+	}{
+		{switchBlock: 3, instant: true},
+		{switchBlock: 2, instant: false},
+	} {
+		config.EthashBlock = big.NewInt(tt.switchBlock)
+
+		engine := ethash.NewFaker()
+		w, _ := newTestWorker(t, &config, engine, 1)
+		if instant := w.isInstantSealing(); instant != tt.instant {
+			t.Errorf("switch block %d: instant sealing mismatch: have %v, want %v", tt.switchBlock, instant, tt.instant)
+		}
+		w.close()
+		engine.Close()
+	}
+}
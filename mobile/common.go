@@ -228,3 +228,8 @@ func (a *Addresses) Set(index int, address *Address) error {
 func (a *Addresses) Append(address *Address) {
 	a.addresses = append(a.addresses, address.address)
 }
+
+// DecodeFromHex decodes a hex string, with or without 0x prefix, into bytes.
+func DecodeFromHex(input string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(input, "0x"), "0X"))
+}
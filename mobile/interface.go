@@ -21,6 +21,7 @@ package geth
 import (
 	"errors"
 	"math/big"
+	"reflect"
 
 	"github.com/ethereum/go-ethereum/common"
 )
@@ -62,6 +63,15 @@ func (i *Interface) SetUint32(bigint *BigInt)      { n := uint32(bigint.bigint.U
 func (i *Interface) SetUint64(bigint *BigInt)      { n := bigint.bigint.Uint64(); i.object = &n }
 func (i *Interface) SetBigInt(bigint *BigInt)      { i.object = &bigint.bigint }
 func (i *Interface) SetBigInts(bigints *BigInts)   { i.object = &bigints.bigints }
+func (i *Interface) SetTuple(tuple *Tuple)         { i.object = tuple.value().Addr().Interface() }
+func (i *Interface) SetTuples(tuples *Tuples) error {
+	value, err := tuples.value()
+	if err != nil {
+		return err
+	}
+	i.object = value.Addr().Interface()
+	return nil
+}
 
 func (i *Interface) SetDefaultBool()      { i.object = new(bool) }
 func (i *Interface) SetDefaultBools()     { i.object = new([]bool) }
@@ -83,6 +93,8 @@ func (i *Interface) SetDefaultUint32()    { i.object = new(uint32) }
 func (i *Interface) SetDefaultUint64()    { i.object = new(uint64) }
 func (i *Interface) SetDefaultBigInt()    { i.object = new(*big.Int) }
 func (i *Interface) SetDefaultBigInts()   { i.object = new([]*big.Int) }
+func (i *Interface) SetDefaultTuple()     { i.object = new(interface{}) }
+func (i *Interface) SetDefaultTuples()    { i.object = new(interface{}) }
 
 func (i *Interface) GetBool() bool            { return *i.object.(*bool) }
 func (i *Interface) GetBools() []bool         { return *i.object.(*[]bool) }
@@ -112,6 +124,18 @@ func (i *Interface) GetUint64() *BigInt {
 }
 func (i *Interface) GetBigInt() *BigInt   { return &BigInt{*i.object.(**big.Int)} }
 func (i *Interface) GetBigInts() *BigInts { return &BigInts{*i.object.(*[]*big.Int)} }
+func (i *Interface) GetTuple() *Tuple     { return newTuple(unwrap(i.object)) }
+func (i *Interface) GetTuples() *Tuples   { return newTuples(unwrap(i.object)) }
+
+// unwrap dereferences a pointer to a tuple or tuple array, looking through the
+// empty interface the ABI decoder fills in for default values.
+func unwrap(object interface{}) reflect.Value {
+	value := reflect.ValueOf(object).Elem()
+	if value.Kind() == reflect.Interface {
+		value = value.Elem()
+	}
+	return value
+}
 
 // Interfaces is a slices of wrapped generic objects.
 type Interfaces struct {
@@ -146,3 +170,129 @@ func (i *Interfaces) Set(index int, object *Interface) error {
 	i.objects[index] = object.object
 	return nil
 }
+
+// Tuple is a wrapped Solidity tuple, made up of named fields. The names are the
+// capitalised ones of the Solidity fields, which the ABI encoder matches the
+// fields up by.
+type Tuple struct {
+	names  []string
+	fields []interface{}
+}
+
+// NewTuple creates a tuple without any fields.
+func NewTuple() *Tuple {
+	return new(Tuple)
+}
+
+// newTuple wraps a copy of the fields of a struct.
+func newTuple(value reflect.Value) *Tuple {
+	copied := reflect.New(value.Type()).Elem()
+	copied.Set(value)
+
+	tuple := new(Tuple)
+	for i := 0; i < copied.NumField(); i++ {
+		tuple.names = append(tuple.names, copied.Type().Field(i).Name)
+		tuple.fields = append(tuple.fields, copied.Field(i).Addr().Interface())
+	}
+	return tuple
+}
+
+// Size returns the number of fields in the tuple.
+func (t *Tuple) Size() int {
+	return len(t.fields)
+}
+
+// Get returns the field at the given index from the tuple.
+func (t *Tuple) Get(index int) (field *Interface, _ error) {
+	if index < 0 || index >= len(t.fields) {
+		return nil, errors.New("index out of bounds")
+	}
+	return &Interface{t.fields[index]}, nil
+}
+
+// Add appends a named field to the tuple.
+func (t *Tuple) Add(name string, field *Interface) {
+	t.names = append(t.names, name)
+	t.fields = append(t.fields, field.object)
+}
+
+// value assembles the fields into an addressable struct.
+func (t *Tuple) value() reflect.Value {
+	fields := make([]reflect.StructField, len(t.fields))
+	for i, field := range t.fields {
+		fields[i] = reflect.StructField{Name: t.names[i], Type: reflect.TypeOf(field).Elem()}
+	}
+	value := reflect.New(reflect.StructOf(fields)).Elem()
+	for i, field := range t.fields {
+		value.Field(i).Set(reflect.ValueOf(field).Elem())
+	}
+	return value
+}
+
+// Tuples is a slice of wrapped Solidity tuples.
+type Tuples struct {
+	tuples []*Tuple
+}
+
+// NewTuples creates a slice of uninitialized tuples.
+func NewTuples(size int) *Tuples {
+	return &Tuples{
+		tuples: make([]*Tuple, size),
+	}
+}
+
+// newTuples wraps a copy of the elements of a slice or array of structs.
+func newTuples(value reflect.Value) *Tuples {
+	tuples := NewTuples(value.Len())
+	for i := range tuples.tuples {
+		tuples.tuples[i] = newTuple(value.Index(i))
+	}
+	return tuples
+}
+
+// Size returns the number of tuples in the slice.
+func (t *Tuples) Size() int {
+	return len(t.tuples)
+}
+
+// Get returns the tuple at the given index from the slice.
+func (t *Tuples) Get(index int) (tuple *Tuple, _ error) {
+	if index < 0 || index >= len(t.tuples) {
+		return nil, errors.New("index out of bounds")
+	}
+	return t.tuples[index], nil
+}
+
+// Set sets the tuple at the given index in the slice.
+func (t *Tuples) Set(index int, tuple *Tuple) error {
+	if index < 0 || index >= len(t.tuples) {
+		return errors.New("index out of bounds")
+	}
+	t.tuples[index] = tuple
+	return nil
+}
+
+// value assembles the tuples into an addressable slice of structs, which must
+// all be of the same type.
+func (t *Tuples) value() (reflect.Value, error) {
+	values := make([]reflect.Value, len(t.tuples))
+	for i, tuple := range t.tuples {
+		if tuple == nil {
+			return reflect.Value{}, errors.New("uninitialized tuple")
+		}
+		values[i] = tuple.value()
+	}
+	// The type of an empty slice doesn't matter, it's encoded by its length only
+	elem := reflect.StructOf(nil)
+	if len(values) > 0 {
+		elem = values[0].Type()
+	}
+	slice := reflect.New(reflect.SliceOf(elem)).Elem()
+	for _, value := range values {
+		if value.Type() != elem {
+			return reflect.Value{}, errors.New("mismatching tuple types")
+		}
+		slice.Set(reflect.Append(slice, value))
+	}
+	return slice, nil
+}
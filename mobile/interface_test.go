@@ -0,0 +1,144 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package geth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+)
+
+const tupleABI = `[
+	{"type":"function","name":"echo","constant":true,
+	 "inputs":[
+		{"name":"p","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"string"}]},
+		{"name":"ps","type":"tuple[]","components":[{"name":"a","type":"uint256"},{"name":"b","type":"string"}]}
+	 ],
+	 "outputs":[
+		{"name":"p","type":"tuple","components":[{"name":"a","type":"uint256"},{"name":"b","type":"string"}]},
+		{"name":"ps","type":"tuple[]","components":[{"name":"a","type":"uint256"},{"name":"b","type":"string"}]}
+	 ]}
+]`
+
+// newTestTuple creates a tuple with the fields of the test ABI.
+func newTestTuple(a int64, b string) *Tuple {
+	tuple := NewTuple()
+
+	field := NewInterface()
+	field.SetBigInt(NewBigInt(a))
+	tuple.Add("A", field)
+
+	field = NewInterface()
+	field.SetString(b)
+	tuple.Add("B", field)
+
+	return tuple
+}
+
+// checkTestTuple ensures a tuple holds the given fields of the test ABI.
+func checkTestTuple(t *testing.T, name string, tuple *Tuple, a int64, b string) {
+	if tuple.Size() != 2 {
+		t.Fatalf("%s: field count mismatch: have %d, want 2", name, tuple.Size())
+	}
+	field, err := tuple.Get(0)
+	if err != nil {
+		t.Fatalf("%s: failed to get field 0: %v", name, err)
+	}
+	if have := field.GetBigInt().GetInt64(); have != a {
+		t.Errorf("%s: field 0 mismatch: have %d, want %d", name, have, a)
+	}
+	if field, err = tuple.Get(1); err != nil {
+		t.Fatalf("%s: failed to get field 1: %v", name, err)
+	}
+	if have := field.GetString(); have != b {
+		t.Errorf("%s: field 1 mismatch: have %q, want %q", name, have, b)
+	}
+}
+
+// Tests that tuples and tuple slices wrapped into interfaces survive an ABI pack
+// and unpack round trip, the way bound contracts pass them.
+func TestInterfaceTupleRoundTrip(t *testing.T) {
+	parsed, err := abi.JSON(strings.NewReader(tupleABI))
+	if err != nil {
+		t.Fatalf("failed to parse ABI: %v", err)
+	}
+	// Wrap the input arguments and pack them
+	tuples := NewTuples(2)
+	if err := tuples.Set(0, newTestTuple(1, "one")); err != nil {
+		t.Fatalf("failed to set tuple: %v", err)
+	}
+	if err := tuples.Set(1, newTestTuple(2, "two")); err != nil {
+		t.Fatalf("failed to set tuple: %v", err)
+	}
+	args := NewInterfaces(2)
+
+	arg := NewInterface()
+	arg.SetTuple(newTestTuple(42, "answer"))
+	args.Set(0, arg)
+
+	arg = NewInterface()
+	if err := arg.SetTuples(tuples); err != nil {
+		t.Fatalf("failed to set tuples: %v", err)
+	}
+	args.Set(1, arg)
+
+	packed, err := parsed.Pack("echo", args.objects...)
+	if err != nil {
+		t.Fatalf("failed to pack tuples: %v", err)
+	}
+	// Unpack the output into default tuples and unwrap them
+	out := NewInterfaces(2)
+
+	ret := NewInterface()
+	ret.SetDefaultTuple()
+	out.Set(0, ret)
+
+	ret = NewInterface()
+	ret.SetDefaultTuples()
+	out.Set(1, ret)
+
+	results := make([]interface{}, len(out.objects))
+	copy(results, out.objects)
+	if err := parsed.Unpack(&results, "echo", packed[4:]); err != nil {
+		t.Fatalf("failed to unpack tuples: %v", err)
+	}
+	copy(out.objects, results)
+
+	ret, _ = out.Get(0)
+	checkTestTuple(t, "tuple", ret.GetTuple(), 42, "answer")
+
+	ret, _ = out.Get(1)
+	unpacked := ret.GetTuples()
+	if unpacked.Size() != 2 {
+		t.Fatalf("tuple count mismatch: have %d, want 2", unpacked.Size())
+	}
+	for i, want := range []string{"one", "two"} {
+		tuple, err := unpacked.Get(i)
+		if err != nil {
+			t.Fatalf("failed to get tuple %d: %v", i, err)
+		}
+		checkTestTuple(t, "tuples["+want+"]", tuple, int64(i+1), want)
+	}
+	// Mismatching tuples must be rejected when wrapping them
+	mixed := NewTuples(2)
+	mixed.Set(0, newTestTuple(1, "one"))
+	mixed.Set(1, NewTuple())
+	if err := NewInterface().SetTuples(mixed); err == nil {
+		t.Errorf("mismatching tuple types accepted")
+	}
+}
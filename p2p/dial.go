@@ -38,6 +38,9 @@ const (
 	// once every few seconds.
 	lookupInterval = 4 * time.Second
 
+	// Number of node list entries added to the results of a lookup.
+	nodeListLookupSize = 16
+
 	// If no peers are found for this amount of time, the initial bootnodes are
 	// attempted to be connected.
 	fallbackInterval = 20 * time.Second
@@ -72,6 +75,7 @@ type dialstate struct {
 	maxDynDials int
 	ntab        discoverTable
 	netrestrict *netutil.Netlist
+	scores      *peerScores // reputation of dynamic dial candidates, if set
 
 	lookupRunning bool
 	dialing       map[discover.NodeID]connFlag
@@ -92,6 +96,89 @@ type discoverTable interface {
 	ReadRandomNodes([]*discover.Node) int
 }
 
+// filterTable is a discovery table only yielding the nodes accepted by filter.
+type filterTable struct {
+	discoverTable
+	filter func(*discover.Node) bool
+}
+
+func (t filterTable) Lookup(target discover.NodeID) []*discover.Node {
+	var nodes []*discover.Node
+	for _, n := range t.discoverTable.Lookup(target) {
+		if t.filter(n) {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+func (t filterTable) ReadRandomNodes(buf []*discover.Node) int {
+	n := 0
+	for _, node := range buf[:t.discoverTable.ReadRandomNodes(buf)] {
+		if t.filter(node) {
+			buf[n] = node
+			n++
+		}
+	}
+	return n
+}
+
+// nodeSource is a source of dial candidates other than discovery, such as the
+// node lists published in DNS.
+type nodeSource interface {
+	ReadRandomNodes([]*discover.Node) int
+}
+
+// nodeListTable mixes the nodes of a node source into the results of a
+// discovery table. The table is nil if discovery is disabled, in which case
+// all dial candidates come from the node source.
+type nodeListTable struct {
+	discoverTable
+	self  *discover.Node
+	nodes nodeSource
+}
+
+func (t nodeListTable) Self() *discover.Node {
+	if t.discoverTable == nil {
+		return t.self
+	}
+	return t.discoverTable.Self()
+}
+
+func (t nodeListTable) Close() {
+	if t.discoverTable != nil {
+		t.discoverTable.Close()
+	}
+}
+
+func (t nodeListTable) Resolve(target discover.NodeID) *discover.Node {
+	if t.discoverTable == nil {
+		return nil
+	}
+	return t.discoverTable.Resolve(target)
+}
+
+// Lookup adds random nodes of the node source to the lookup results, keeping
+// the dialer supplied with candidates while discovery is still bootstrapping.
+func (t nodeListTable) Lookup(target discover.NodeID) []*discover.Node {
+	var nodes []*discover.Node
+	if t.discoverTable != nil {
+		nodes = t.discoverTable.Lookup(target)
+	}
+	buf := make([]*discover.Node, nodeListLookupSize)
+	return append(nodes, buf[:t.nodes.ReadRandomNodes(buf)]...)
+}
+
+// ReadRandomNodes fills half of buf with nodes of the node source and the rest
+// with nodes of the table.
+func (t nodeListTable) ReadRandomNodes(buf []*discover.Node) int {
+	if t.discoverTable == nil {
+		return t.nodes.ReadRandomNodes(buf)
+	}
+	n := t.nodes.ReadRandomNodes(buf[:len(buf)/2])
+	return n + t.discoverTable.ReadRandomNodes(buf[n:])
+}
+
 // the dial history remembers recent dials.
 type dialHistory []pastDial
 
@@ -166,7 +253,11 @@ func (s *dialstate) newTasks(nRunning int, peers map[discover.NodeID]*Peer, now
 
 	var newtasks []task
 	addDial := func(flag connFlag, n *discover.Node) bool {
-		if err := s.checkDial(n, peers); err != nil {
+		err := s.checkDial(n, peers)
+		if err == nil && s.scores != nil && s.scores.score(n.ID) < minDialScore {
+			err = errLowScore
+		}
+		if err != nil {
 			log.Trace("Skipping dial candidate", "id", n.ID, "addr", &net.TCPAddr{IP: n.IP, Port: int(n.TCP)}, "err", err)
 			return false
 		}
@@ -258,6 +349,7 @@ var (
 	errAlreadyConnected = errors.New("already connected")
 	errRecentlyDialed   = errors.New("recently dialed")
 	errNotWhitelisted   = errors.New("not contained in netrestrict whitelist")
+	errLowScore         = errors.New("reputation score too low")
 )
 
 func (s *dialstate) checkDial(n *discover.Node, peers map[discover.NodeID]*Peer) error {
@@ -369,7 +461,7 @@ func (t *discoverTask) Do(srv *Server) {
 	srv.lastLookup = time.Now()
 	var target discover.NodeID
 	rand.Read(target[:])
-	t.results = srv.ntab.Lookup(target)
+	t.results = srv.dialtab.Lookup(target)
 }
 
 func (t *discoverTask) String() string {
@@ -432,6 +432,112 @@ func TestDialStateNetRestrict(t *testing.T) {
 	})
 }
 
+// This test checks that candidates rejected by the node filter are not dialed.
+func TestDialStateNodeFilter(t *testing.T) {
+	// This table always returns the same random nodes
+	// in the order given below.
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+		{ID: uintID(5), IP: net.ParseIP("127.0.0.5")},
+		{ID: uintID(6), IP: net.ParseIP("127.0.0.6")},
+	}
+	filter := func(n *discover.Node) bool { return n.IP[len(n.IP)-1]%2 == 0 }
+
+	runDialTest(t, dialtest{
+		init: newDialState(nil, nil, filterTable{table, filter}, 10, nil),
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[1]},
+					&dialTask{flags: dynDialedConn, dest: table[3]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that dynamic dial candidates with a bad reputation are skipped.
+func TestDialStateLowScore(t *testing.T) {
+	table := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+	}
+	scores := newPeerScores(nil)
+	scores.add(uintID(2), ScoreInvalidBlock)
+	scores.add(uintID(3), ScoreTimeout)
+
+	dialer := newDialState(nil, nil, table, 10, nil)
+	dialer.scores = scores
+	runDialTest(t, dialtest{
+		init: dialer,
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+					&dialTask{flags: dynDialedConn, dest: table[2]},
+					&dialTask{flags: dynDialedConn, dest: table[3]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+}
+
+// This test checks that nodes of DNS node lists are dialed when discovery is
+// disabled, and mixed into the random nodes of the table otherwise.
+func TestDialStateNodeList(t *testing.T) {
+	lists := fakeTable{
+		{ID: uintID(1), IP: net.ParseIP("127.0.0.1")},
+		{ID: uintID(2), IP: net.ParseIP("127.0.0.2")},
+	}
+	table := fakeTable{
+		{ID: uintID(3), IP: net.ParseIP("127.0.0.3")},
+		{ID: uintID(4), IP: net.ParseIP("127.0.0.4")},
+		{ID: uintID(5), IP: net.ParseIP("127.0.0.5")},
+	}
+	self := &discover.Node{ID: uintID(100)}
+
+	runDialTest(t, dialtest{
+		init: newDialState(nil, nil, nodeListTable{nil, self, lists}, 10, nil),
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: lists[0]},
+					&dialTask{flags: dynDialedConn, dest: lists[1]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+	runDialTest(t, dialtest{
+		init: newDialState(nil, nil, nodeListTable{table, self, lists}, 10, nil),
+		rounds: []round{
+			{
+				new: []task{
+					&dialTask{flags: dynDialedConn, dest: lists[0]},
+					&dialTask{flags: dynDialedConn, dest: lists[1]},
+					&dialTask{flags: dynDialedConn, dest: table[0]},
+					&dialTask{flags: dynDialedConn, dest: table[1]},
+					&dialTask{flags: dynDialedConn, dest: table[2]},
+					&discoverTask{},
+				},
+			},
+		},
+	})
+	if n := (nodeListTable{nil, self, lists}).Self(); n != self {
+		t.Errorf("wrong self node without table: %v", n)
+	}
+	if n := len((nodeListTable{nil, self, lists}).Lookup(uintID(1))); n != len(lists) {
+		t.Errorf("wrong number of lookup results: have %d, want %d", n, len(lists))
+	}
+}
+
 // This test checks that static dials are launched.
 func TestDialStateStaticDial(t *testing.T) {
 	wantStatic := []*discover.Node{
@@ -62,6 +62,10 @@ var (
 	nodeDBDiscoverPing      = nodeDBDiscoverRoot + ":lastping"
 	nodeDBDiscoverPong      = nodeDBDiscoverRoot + ":lastpong"
 	nodeDBDiscoverFindFails = nodeDBDiscoverRoot + ":findfail"
+
+	nodeDBPeerRoot      = ":peer"
+	nodeDBPeerScore     = nodeDBPeerRoot + ":score"
+	nodeDBPeerScoreTime = nodeDBPeerRoot + ":scoretime"
 )
 
 // newNodeDB creates a new node database for storing and retrieving infos about
@@ -303,6 +307,21 @@ func (db *nodeDB) updateFindFails(id NodeID, fails int) error {
 	return db.storeInt64(makeKey(id, nodeDBDiscoverFindFails), int64(fails))
 }
 
+// peerScore retrieves the reputation score of a peer and the time it was last
+// updated.
+func (db *nodeDB) peerScore(id NodeID) (int, time.Time) {
+	score := db.fetchInt64(makeKey(id, nodeDBPeerScore))
+	return int(score), time.Unix(db.fetchInt64(makeKey(id, nodeDBPeerScoreTime)), 0)
+}
+
+// updatePeerScore updates the reputation score of a peer.
+func (db *nodeDB) updatePeerScore(id NodeID, score int, instance time.Time) error {
+	if err := db.storeInt64(makeKey(id, nodeDBPeerScore), int64(score)); err != nil {
+		return err
+	}
+	return db.storeInt64(makeKey(id, nodeDBPeerScoreTime), instance.Unix())
+}
+
 // querySeeds retrieves random nodes to be used as potential seed nodes
 // for bootstrapping.
 func (db *nodeDB) querySeeds(n int, maxAge time.Duration) []*Node {
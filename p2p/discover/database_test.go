@@ -144,6 +144,16 @@ func TestNodeDBFetchStore(t *testing.T) {
 	if stored := db.findFails(node.ID); stored != num {
 		t.Errorf("find-node fails: value mismatch: have %v, want %v", stored, num)
 	}
+	// Check fetch/store operations on a peer score object
+	if score, updated := db.peerScore(node.ID); score != 0 || updated.Unix() != 0 {
+		t.Errorf("peer score: non-existing object: %v %v", score, updated)
+	}
+	if err := db.updatePeerScore(node.ID, -num, inst); err != nil {
+		t.Errorf("peer score: failed to update: %v", err)
+	}
+	if score, updated := db.peerScore(node.ID); score != -num || updated.Unix() != inst.Unix() {
+		t.Errorf("peer score: value mismatch: have %v %v, want %v %v", score, updated, -num, inst)
+	}
 	// Check fetch/store operations on an actual node object
 	if stored := db.node(node.ID); stored != nil {
 		t.Errorf("node: non-existing object: %v", stored)
@@ -0,0 +1,237 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	// endpointStatements is the number of distinct peers that need to agree on
+	// our external UDP endpoint before the local record is updated with it.
+	endpointStatements = 3
+
+	// endpointStatementExpiry is the time after which endpoint statements made
+	// by remote peers are discarded.
+	endpointStatementExpiry = 10 * time.Minute
+)
+
+// endpointStatement is an observation of our external endpoint made by a peer.
+type endpointStatement struct {
+	endpoint string
+	time     time.Time
+}
+
+// LocalNode produces the signed node record of the local node. The record is
+// re-signed with an incremented sequence number whenever one of its entries
+// changes, either explicitly through Set or because the external endpoint of
+// the node changed.
+type LocalNode struct {
+	key *ecdsa.PrivateKey
+
+	mu         sync.Mutex
+	seq        uint64
+	entries    map[string]enr.Entry
+	staticIP   net.IP                       // IP address explicitly configured for the node
+	statements map[string]endpointStatement // endpoint predictions made by remote peers
+	record     *enr.Record                  // last signed record, nil if entries changed
+	node       *Node                        // node corresponding to the last signed record
+}
+
+// NewLocalNode creates a local node record producer for the given key. The
+// sequence number starts out as the current time in milliseconds, ensuring that
+// records created after a restart supersede the ones created before.
+func NewLocalNode(key *ecdsa.PrivateKey) *LocalNode {
+	return &LocalNode{
+		key:        key,
+		seq:        uint64(time.Now().UnixNano() / int64(time.Millisecond)),
+		entries:    make(map[string]enr.Entry),
+		statements: make(map[string]endpointStatement),
+	}
+}
+
+// ID returns the node ID of the local node.
+func (ln *LocalNode) ID() NodeID {
+	return PubkeyID(&ln.key.PublicKey)
+}
+
+// Seq returns the sequence number of the current local record.
+func (ln *LocalNode) Seq() uint64 {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.sign()
+	return ln.seq
+}
+
+// Record returns the current signed local record.
+func (ln *LocalNode) Record() *enr.Record {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.sign()
+	return ln.record
+}
+
+// Node returns the local node, carrying the current signed local record.
+func (ln *LocalNode) Node() *Node {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.sign()
+	return ln.node
+}
+
+// Set adds or updates the given entry in the local record. Entries carrying the
+// endpoint of the node (ip, udp, tcp) may be set too, although the IP address is
+// usually managed through SetStaticIP and the endpoint statements of peers.
+func (ln *LocalNode) Set(e enr.Entry) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.set(e)
+}
+
+// Delete removes the entry with the given key from the local record.
+func (ln *LocalNode) Delete(key string) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	if _, ok := ln.entries[key]; ok {
+		delete(ln.entries, key)
+		ln.invalidate()
+	}
+}
+
+// SetStaticIP sets the IP address of the local record, overriding any address
+// predicted from the endpoint statements of remote peers.
+func (ln *LocalNode) SetStaticIP(ip net.IP) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	ln.staticIP = ip
+	ln.set(enr.IP(ip))
+}
+
+// setEndpoint sets the initial endpoint of the local record from the address
+// the discovery protocol listens on. Unspecified addresses are left for the
+// endpoint statements of peers to fill in.
+func (ln *LocalNode) setEndpoint(addr *net.UDPAddr) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	if ln.staticIP == nil && addr.IP != nil && !addr.IP.IsUnspecified() {
+		ln.set(enr.IP(addr.IP))
+	}
+	ln.set(enr.UDP(addr.Port))
+	if _, ok := ln.entries[enr.TCP(0).ENRKey()]; !ok {
+		ln.set(enr.TCP(addr.Port))
+	}
+}
+
+// UDPEndpointStatement records the external UDP endpoint of the local node as
+// reported by the remote peer at the given address. Once enough peers agree on
+// a new endpoint, the ip and udp entries of the local record are updated.
+func (ln *LocalNode) UDPEndpointStatement(from, endpoint *net.UDPAddr) {
+	ln.mu.Lock()
+	defer ln.mu.Unlock()
+
+	now := time.Now()
+	ln.statements[from.String()] = endpointStatement{endpoint: endpoint.String(), time: now}
+
+	// Count the non-expired statements per endpoint and pick the most popular
+	counts := make(map[string]int)
+	best, max := "", 0
+	for reporter, s := range ln.statements {
+		if now.Sub(s.time) > endpointStatementExpiry {
+			delete(ln.statements, reporter)
+			continue
+		}
+		counts[s.endpoint]++
+		if counts[s.endpoint] > max {
+			best, max = s.endpoint, counts[s.endpoint]
+		}
+	}
+	if max < endpointStatements {
+		return
+	}
+	addr, err := net.ResolveUDPAddr("udp", best)
+	if err != nil {
+		return
+	}
+	if ln.staticIP == nil {
+		ln.set(enr.IP(addr.IP))
+	}
+	ln.set(enr.UDP(addr.Port))
+}
+
+// set updates an entry if its value changed. The caller must hold ln.mu.
+func (ln *LocalNode) set(e enr.Entry) {
+	if old, ok := ln.entries[e.ENRKey()]; ok && entryEqual(old, e) {
+		return
+	}
+	ln.entries[e.ENRKey()] = e
+	ln.invalidate()
+}
+
+// invalidate drops the signed record, causing it to be re-signed with a new
+// sequence number the next time it is requested. The caller must hold ln.mu.
+func (ln *LocalNode) invalidate() {
+	if ln.record != nil {
+		ln.seq++
+	}
+	ln.record, ln.node = nil, nil
+}
+
+// sign creates and signs the local record if it was invalidated. The caller
+// must hold ln.mu.
+func (ln *LocalNode) sign() {
+	if ln.record != nil {
+		return
+	}
+	r := new(enr.Record)
+	for _, e := range ln.entries {
+		r.Set(e)
+	}
+	r.SetSeq(ln.seq)
+	if err := enr.SignV4(r, ln.key); err != nil {
+		log.Error("Failed to sign local node record", "err", err)
+		return
+	}
+	n, err := NodeFromRecord(r)
+	if err != nil {
+		n = NewNode(ln.ID(), nil, 0, 0)
+		n.Record = r
+	}
+	ln.record, ln.node = r, n
+	log.Debug("Updated local node record", "seq", ln.seq, "id", n.ID, "ip", n.IP, "udp", n.UDP, "tcp", n.TCP)
+}
+
+// entryEqual reports whether two entries have the same encoded value.
+func entryEqual(a, b enr.Entry) bool {
+	ba, erra := rlp.EncodeToBytes(a)
+	bb, errb := rlp.EncodeToBytes(b)
+	return erra == nil && errb == nil && bytes.Equal(ba, bb)
+}
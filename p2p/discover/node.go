@@ -34,10 +34,15 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 )
 
 const NodeIDBits = 512
 
+// errMissingRecord is returned when loading a record entry of a node whose
+// record is unknown.
+var errMissingRecord = errors.New("node record unknown")
+
 // Node represents a host on the network.
 // The fields of Node may not be modified.
 type Node struct {
@@ -45,6 +50,10 @@ type Node struct {
 	UDP, TCP uint16 // port numbers
 	ID       NodeID // the node's public key
 
+	// Record is the signed node record of the node. It is only known for
+	// nodes found through the ENR based discovery protocol.
+	Record *enr.Record `rlp:"-"`
+
 	// This is a cached copy of sha3(ID) which is used for node
 	// distance calculations. This is part of Node in order to make it
 	// possible to write tests that need a node at a certain distance.
@@ -71,6 +80,41 @@ func NewNode(id NodeID, ip net.IP, udpPort, tcpPort uint16) *Node {
 	}
 }
 
+// NodeFromRecord creates a node from the endpoint and public key contained in
+// the given signed record.
+func NodeFromRecord(r *enr.Record) (*Node, error) {
+	var (
+		pubkey enr.Secp256k1
+		ip     enr.IP
+		udp    enr.UDP
+		tcp    enr.TCP
+	)
+	if err := r.Load(&pubkey); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&ip); err != nil {
+		return nil, err
+	}
+	if err := r.Load(&udp); err != nil && !enr.IsNotFound(err) {
+		return nil, err
+	}
+	if err := r.Load(&tcp); err != nil && !enr.IsNotFound(err) {
+		return nil, err
+	}
+	n := NewNode(PubkeyID((*ecdsa.PublicKey)(&pubkey)), net.IP(ip), uint16(udp), uint16(tcp))
+	n.Record = r
+	return n, nil
+}
+
+// Load retrieves an entry of the node record. It returns an error if the record
+// of the node is unknown or doesn't contain the entry.
+func (n *Node) Load(e enr.Entry) error {
+	if n.Record == nil {
+		return errMissingRecord
+	}
+	return n.Record.Load(e)
+}
+
 func (n *Node) addr() *net.UDPAddr {
 	return &net.UDPAddr{IP: n.IP, Port: int(n.UDP)}
 }
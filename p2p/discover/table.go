@@ -229,6 +229,18 @@ func (tab *Table) isInitDone() bool {
 	}
 }
 
+// PeerScore returns the reputation score stored for the given node and the
+// time it was last updated.
+func (tab *Table) PeerScore(id NodeID) (int, time.Time) {
+	return tab.db.peerScore(id)
+}
+
+// SetPeerScore stores the reputation score of the given node in the node
+// database, keeping it across restarts.
+func (tab *Table) SetPeerScore(id NodeID, score int, updated time.Time) error {
+	return tab.db.updatePeerScore(id, score, updated)
+}
+
 // Resolve searches for a specific node with the given ID.
 // It returns nil if the node could not be found.
 func (tab *Table) Resolve(targetID NodeID) *Node {
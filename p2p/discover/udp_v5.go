@@ -0,0 +1,605 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/p2p/netutil"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+var (
+	errBadPrefix      = errors.New("bad prefix")
+	errRecordMismatch = errors.New("record of different node")
+)
+
+// v5Prefix starts every packet of the ENR based discovery protocol. It keeps
+// the packets apart from v4 packets, which start with the hash of the remaining
+// packet data, and from topic discovery packets when sharing a UDP port.
+var v5Prefix = []byte("enr discovery v5")
+
+// v5HeadSize is the size of the v5 packet header preceding the packet type.
+var v5HeadSize = len(v5Prefix) + sigSize
+
+// maxNodesV5Size is the maximum size of the records carried by a single nodes
+// packet, leaving room for the packet header and the remaining fields.
+var maxNodesV5Size = 1280 - v5HeadSize - 1 - 20
+
+// RPC packet types of the ENR based discovery protocol
+const (
+	pingV5Packet = iota + 1 // zero is 'reserved'
+	pongV5Packet
+	findnodeV5Packet
+	nodesV5Packet
+	enrRequestPacket
+	enrResponsePacket
+)
+
+// RPC request structures of the ENR based discovery protocol
+type (
+	// pingV5 checks the liveness of a node, advertising the sequence number of
+	// the sender's record.
+	pingV5 struct {
+		To         rpcEndpoint
+		Seq        uint64
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// pongV5 is the reply to pingV5.
+	pongV5 struct {
+		// This field should mirror the UDP envelope address of the ping
+		// packet, which is used to predict the external endpoint.
+		To rpcEndpoint
+
+		ReplyTok   []byte // This contains the hash of the ping packet.
+		Seq        uint64 // Sequence number of the sender's record.
+		Expiration uint64 // Absolute timestamp at which the packet becomes invalid.
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// findnodeV5 is a query for the records of nodes close to the given target.
+	findnodeV5 struct {
+		Target     NodeID // doesn't need to be an actual public key
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// nodesV5 is the reply to findnodeV5. The records are split across Total
+	// packets to stay below the packet size limit.
+	nodesV5 struct {
+		Total      uint
+		Records    []*enr.Record
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrRequestV5 queries the current record of a node.
+	enrRequestV5 struct {
+		Expiration uint64
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+
+	// enrResponseV5 is the reply to enrRequestV5.
+	enrResponseV5 struct {
+		ReplyTok []byte // This contains the hash of the request packet.
+		Record   *enr.Record
+		// Ignore additional fields (for forward compatibility).
+		Rest []rlp.RawValue `rlp:"tail"`
+	}
+)
+
+type packetV5 interface {
+	handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error
+	name() string
+}
+
+// UDPv5 implements the ENR based discovery protocol. Compared to v4, nodes
+// exchange their signed records, making protocol specific entries such as the
+// fork of a node available before dialing it. It maintains a node table of its
+// own and can share its UDP port with the v4 protocol.
+type UDPv5 struct {
+	*udp
+	localNode *LocalNode
+}
+
+// ListenV5 starts the ENR based discovery protocol on the given connection,
+// advertising the record produced by the local node. Packets which can't be
+// handled are sent on the unhandled channel of the configuration, allowing the
+// protocol to be chained behind the v4 listener.
+func ListenV5(c conn, ln *LocalNode, cfg Config) (*UDPv5, error) {
+	t, err := newUDPv5(c, ln, cfg)
+	if err != nil {
+		return nil, err
+	}
+	log.Info("ENR discovery listener up", "self", t.Self(), "seq", ln.Seq())
+	return t, nil
+}
+
+func newUDPv5(c conn, ln *LocalNode, cfg Config) (*UDPv5, error) {
+	t := &UDPv5{
+		udp: &udp{
+			conn:        c,
+			priv:        cfg.PrivateKey,
+			netrestrict: cfg.NetRestrict,
+			closing:     make(chan struct{}),
+			gotreply:    make(chan reply),
+			addpending:  make(chan *pending),
+		},
+		localNode: ln,
+	}
+	realaddr := c.LocalAddr().(*net.UDPAddr)
+	if cfg.AnnounceAddr != nil {
+		realaddr = cfg.AnnounceAddr
+	}
+	t.ourEndpoint = makeEndpoint(realaddr, uint16(realaddr.Port))
+	ln.setEndpoint(realaddr)
+
+	tab, err := newTable(t, ln.ID(), realaddr, cfg.NodeDBPath, cfg.Bootnodes)
+	if err != nil {
+		return nil, err
+	}
+	t.Table = tab
+
+	go t.loop()
+	go t.readLoop(cfg.Unhandled)
+	return t, nil
+}
+
+// Self returns the local node, carrying the current local record.
+func (t *UDPv5) Self() *Node {
+	return t.localNode.Node()
+}
+
+// LocalNode returns the producer of the local record.
+func (t *UDPv5) LocalNode() *LocalNode {
+	return t.localNode
+}
+
+// RequestENR queries the current record of the given node, returning the node
+// as described by the record.
+func (t *UDPv5) RequestENR(n *Node) (*Node, error) {
+	// The remote node only answers after an endpoint proof, solicit a ping first.
+	if time.Since(t.db.lastPingReceived(n.ID)) > nodeDBNodeExpiration {
+		t.ping(n.ID, n.addr())
+		t.waitping(n.ID)
+	}
+	return t.requestENR(n.ID, n.addr())
+}
+
+// requestENR sends an ENR request to the given node and waits for the reply.
+func (t *UDPv5) requestENR(toid NodeID, toaddr *net.UDPAddr) (*Node, error) {
+	req := &enrRequestV5{Expiration: uint64(time.Now().Add(expiration).Unix())}
+	packet, hash, err := encodePacketV5(t.priv, enrRequestPacket, req)
+	if err != nil {
+		return nil, err
+	}
+	var record *enr.Record
+	errc := t.pending(toid, enrResponsePacket, func(r interface{}) bool {
+		resp := r.(*enrResponseV5)
+		if !bytes.Equal(resp.ReplyTok, hash) {
+			return false
+		}
+		record = resp.Record
+		return true
+	})
+	t.write(toaddr, req.name(), packet)
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	n, err := t.nodeFromRecord(toaddr, record)
+	if err != nil {
+		return nil, err
+	}
+	if n.ID != toid {
+		return nil, errRecordMismatch
+	}
+	return n, nil
+}
+
+// ping sends a ping message to the given node and waits for a reply.
+func (t *UDPv5) ping(toid NodeID, toaddr *net.UDPAddr) error {
+	return <-t.sendPing(toid, toaddr, nil)
+}
+
+// sendPing sends a ping message to the given node and invokes the callback
+// with the record sequence number of the node when the reply arrives.
+func (t *UDPv5) sendPing(toid NodeID, toaddr *net.UDPAddr, callback func(seq uint64)) <-chan error {
+	req := &pingV5{
+		To:         makeEndpoint(toaddr, 0),
+		Seq:        t.localNode.Seq(),
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	}
+	packet, hash, err := encodePacketV5(t.priv, pingV5Packet, req)
+	if err != nil {
+		errc := make(chan error, 1)
+		errc <- err
+		return errc
+	}
+	errc := t.pending(toid, pongV5Packet, func(p interface{}) bool {
+		pong := p.(*pongV5)
+		ok := bytes.Equal(pong.ReplyTok, hash)
+		if ok && callback != nil {
+			callback(pong.Seq)
+		}
+		return ok
+	})
+	t.write(toaddr, req.name(), packet)
+	return errc
+}
+
+func (t *UDPv5) waitping(from NodeID) error {
+	return <-t.pending(from, pingV5Packet, func(interface{}) bool { return true })
+}
+
+// findnode sends a findnode request to the given node and waits until all the
+// nodes packets of the reply have arrived.
+func (t *UDPv5) findnode(toid NodeID, toaddr *net.UDPAddr, target NodeID) ([]*Node, error) {
+	// If we haven't seen a ping from the destination node for a while, it won't remember
+	// our endpoint proof and reject findnode. Solicit a ping first.
+	if time.Since(t.db.lastPingReceived(toid)) > nodeDBNodeExpiration {
+		t.ping(toid, toaddr)
+		t.waitping(toid)
+	}
+
+	nodes := make([]*Node, 0, bucketSize)
+	npackets := uint(0)
+	errc := t.pending(toid, nodesV5Packet, func(r interface{}) bool {
+		reply := r.(*nodesV5)
+		for _, record := range reply.Records {
+			n, err := t.nodeFromRecord(toaddr, record)
+			if err != nil {
+				log.Trace("Invalid node record received", "addr", toaddr, "err", err)
+				continue
+			}
+			nodes = append(nodes, n)
+		}
+		npackets++
+		return npackets >= reply.Total || len(nodes) >= bucketSize
+	})
+	t.send(toaddr, findnodeV5Packet, &findnodeV5{
+		Target:     target,
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	})
+	return nodes, <-errc
+}
+
+// nodeFromRecord creates a node from a record received from the given sender,
+// checking that its endpoint is valid and relayable.
+func (t *UDPv5) nodeFromRecord(sender *net.UDPAddr, record *enr.Record) (*Node, error) {
+	if record == nil {
+		return nil, errors.New("missing record")
+	}
+	n, err := NodeFromRecord(record)
+	if err != nil {
+		return nil, err
+	}
+	if n.UDP <= 1024 {
+		return nil, errors.New("low port")
+	}
+	if err := netutil.CheckRelayIP(sender.IP, n.IP); err != nil {
+		return nil, err
+	}
+	if t.netrestrict != nil && !t.netrestrict.Contains(n.IP) {
+		return nil, errors.New("not contained in netrestrict whitelist")
+	}
+	return n, n.validateComplete()
+}
+
+// addThroughPing adds the node that pinged us to the table once its record is
+// known, requesting the record if the one in the table is older than seq.
+func (t *UDPv5) addThroughPing(id NodeID, addr *net.UDPAddr, seq uint64) {
+	if !t.isInitDone() {
+		return
+	}
+	n := t.tableNode(id)
+	if n == nil || n.Record == nil || n.Record.Seq() < seq {
+		var err error
+		if n, err = t.requestENR(id, addr); err != nil {
+			log.Trace("Failed to request node record", "id", id, "addr", addr, "err", err)
+			return
+		}
+	}
+	t.add(n)
+}
+
+// updateRecord requests the record of a node in the table if the one known is
+// older than seq, replacing the table entry with the updated node.
+func (t *UDPv5) updateRecord(id NodeID, addr *net.UDPAddr, seq uint64) {
+	n := t.tableNode(id)
+	if n == nil || (n.Record != nil && n.Record.Seq() >= seq) {
+		return
+	}
+	updated, err := t.requestENR(id, addr)
+	if err != nil {
+		log.Trace("Failed to update node record", "id", id, "addr", addr, "err", err)
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	b := t.bucket(updated.sha)
+	for i, e := range b.entries {
+		// Only swap in the updated node if the IP stays the same, keeping the
+		// IP limits of the table intact. Other changes are picked up when the
+		// node is revalidated.
+		if e.ID == updated.ID && e.IP.Equal(updated.IP) {
+			updated.addedAt = e.addedAt
+			b.entries[i] = updated
+		}
+	}
+}
+
+// tableNode returns the table entry of the given node, if any.
+func (t *UDPv5) tableNode(id NodeID) *Node {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, e := range t.bucket(crypto.Keccak256Hash(id[:])).entries {
+		if e.ID == id {
+			return e
+		}
+	}
+	return nil
+}
+
+func (t *UDPv5) send(toaddr *net.UDPAddr, ptype byte, req packetV5) ([]byte, error) {
+	packet, hash, err := encodePacketV5(t.priv, ptype, req)
+	if err != nil {
+		return hash, err
+	}
+	return hash, t.write(toaddr, req.name(), packet)
+}
+
+// encodePacketV5 encodes and signs a packet, returning the packet along with its
+// hash. The signature covers the prefix, type and data of the packet.
+func encodePacketV5(priv *ecdsa.PrivateKey, ptype byte, req interface{}) (packet, hash []byte, err error) {
+	b := new(bytes.Buffer)
+	b.Write(v5Prefix)
+	b.Write(headSpace[:sigSize])
+	b.WriteByte(ptype)
+	if err := rlp.Encode(b, req); err != nil {
+		log.Error("Can't encode discv5 packet", "err", err)
+		return nil, nil, err
+	}
+	packet = b.Bytes()
+	sig, err := crypto.Sign(crypto.Keccak256(v5Prefix, packet[v5HeadSize:]), priv)
+	if err != nil {
+		log.Error("Can't sign discv5 packet", "err", err)
+		return nil, nil, err
+	}
+	copy(packet[len(v5Prefix):], sig)
+	return packet, crypto.Keccak256(packet), nil
+}
+
+// readLoop runs in its own goroutine. it handles incoming UDP packets.
+func (t *UDPv5) readLoop(unhandled chan<- ReadPacket) {
+	defer t.conn.Close()
+	if unhandled != nil {
+		defer close(unhandled)
+	}
+	buf := make([]byte, 1280)
+	for {
+		nbytes, from, err := t.conn.ReadFromUDP(buf)
+		if netutil.IsTemporaryError(err) {
+			// Ignore temporary read errors.
+			log.Debug("Temporary UDP read error", "err", err)
+			continue
+		} else if err != nil {
+			// Shut down the loop for permament errors.
+			log.Debug("UDP read error", "err", err)
+			return
+		}
+		if t.handlePacket(from, buf[:nbytes]) != nil && unhandled != nil {
+			// Copy the packet, buf is reused for the next read.
+			data := make([]byte, nbytes)
+			copy(data, buf)
+			select {
+			case unhandled <- ReadPacket{data, from}:
+			default:
+			}
+		}
+	}
+}
+
+func (t *UDPv5) handlePacket(from *net.UDPAddr, buf []byte) error {
+	packet, fromID, hash, err := decodePacketV5(buf)
+	if err != nil {
+		log.Debug("Bad discv5 packet", "addr", from, "err", err)
+		return err
+	}
+	err = packet.handle(t, from, fromID, hash)
+	log.Trace("<< "+packet.name(), "addr", from, "err", err)
+	return err
+}
+
+func decodePacketV5(buf []byte) (packetV5, NodeID, []byte, error) {
+	if len(buf) < v5HeadSize+1 {
+		return nil, NodeID{}, nil, errPacketTooSmall
+	}
+	if !bytes.HasPrefix(buf, v5Prefix) {
+		return nil, NodeID{}, nil, errBadPrefix
+	}
+	sig, sigdata := buf[len(v5Prefix):v5HeadSize], buf[v5HeadSize:]
+	hash := crypto.Keccak256(buf)
+	fromID, err := recoverNodeID(crypto.Keccak256(v5Prefix, sigdata), sig)
+	if err != nil {
+		return nil, NodeID{}, hash, err
+	}
+	var req packetV5
+	switch ptype := sigdata[0]; ptype {
+	case pingV5Packet:
+		req = new(pingV5)
+	case pongV5Packet:
+		req = new(pongV5)
+	case findnodeV5Packet:
+		req = new(findnodeV5)
+	case nodesV5Packet:
+		req = new(nodesV5)
+	case enrRequestPacket:
+		req = new(enrRequestV5)
+	case enrResponsePacket:
+		req = new(enrResponseV5)
+	default:
+		return nil, fromID, hash, fmt.Errorf("unknown type: %d", ptype)
+	}
+	s := rlp.NewStream(bytes.NewReader(sigdata[1:]), 0)
+	err = s.Decode(req)
+	return req, fromID, hash, err
+}
+
+func (req *pingV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	t.send(from, pongV5Packet, &pongV5{
+		To:         makeEndpoint(from, 0),
+		ReplyTok:   mac,
+		Seq:        t.localNode.Seq(),
+		Expiration: uint64(time.Now().Add(expiration).Unix()),
+	})
+	t.handleReply(fromID, pingV5Packet, req)
+
+	// Add the node to the table. Before doing so, ensure that we have a recent enough pong
+	// recorded in the database so their findnode and ENR requests will be accepted later.
+	if time.Since(t.db.lastPongReceived(fromID)) > nodeDBNodeExpiration {
+		t.sendPing(fromID, from, func(uint64) { go t.addThroughPing(fromID, from, req.Seq) })
+	} else {
+		go t.addThroughPing(fromID, from, req.Seq)
+	}
+	t.db.updateLastPingReceived(fromID, time.Now())
+	return nil
+}
+
+func (req *pingV5) name() string { return "PING/v5" }
+
+func (req *pongV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.handleReply(fromID, pongV5Packet, req) {
+		return errUnsolicitedReply
+	}
+	t.localNode.UDPEndpointStatement(from, &net.UDPAddr{IP: req.To.IP, Port: int(req.To.UDP)})
+	t.db.updateLastPongReceived(fromID, time.Now())
+	go t.updateRecord(fromID, from, req.Seq)
+	return nil
+}
+
+func (req *pongV5) name() string { return "PONG/v5" }
+
+func (req *findnodeV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.db.hasBond(fromID) {
+		// No endpoint proof pong exists, we don't process the packet. This prevents
+		// the protocol from being used to amplify traffic, see the v4 findnode handler.
+		return errUnknownNode
+	}
+	target := crypto.Keccak256Hash(req.Target[:])
+	t.mutex.Lock()
+	closest := t.closest(target, bucketSize).entries
+	t.mutex.Unlock()
+
+	// Split the records of the closest nodes into packets staying below the
+	// 1280 byte limit. Nodes with unknown records can't be relayed.
+	var (
+		packets [][]*enr.Record
+		records []*enr.Record
+		size    int
+	)
+	for _, n := range closest {
+		if n.Record == nil || netutil.CheckRelayIP(from.IP, n.IP) != nil {
+			continue
+		}
+		blob, err := rlp.EncodeToBytes(n.Record)
+		if err != nil {
+			continue
+		}
+		if size+len(blob) > maxNodesV5Size {
+			packets = append(packets, records)
+			records, size = nil, 0
+		}
+		records = append(records, n.Record)
+		size += len(blob)
+	}
+	if len(records) > 0 || len(packets) == 0 {
+		packets = append(packets, records)
+	}
+	for _, records := range packets {
+		t.send(from, nodesV5Packet, &nodesV5{
+			Total:      uint(len(packets)),
+			Records:    records,
+			Expiration: uint64(time.Now().Add(expiration).Unix()),
+		})
+	}
+	return nil
+}
+
+func (req *findnodeV5) name() string { return "FINDNODE/v5" }
+
+func (req *nodesV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.handleReply(fromID, nodesV5Packet, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *nodesV5) name() string { return "NODES/v5" }
+
+func (req *enrRequestV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if expired(req.Expiration) {
+		return errExpired
+	}
+	if !t.db.hasBond(fromID) {
+		return errUnknownNode
+	}
+	t.send(from, enrResponsePacket, &enrResponseV5{
+		ReplyTok: mac,
+		Record:   t.localNode.Record(),
+	})
+	return nil
+}
+
+func (req *enrRequestV5) name() string { return "ENRREQUEST/v5" }
+
+func (req *enrResponseV5) handle(t *UDPv5, from *net.UDPAddr, fromID NodeID, mac []byte) error {
+	if !t.handleReply(fromID, enrResponsePacket, req) {
+		return errUnsolicitedReply
+	}
+	return nil
+}
+
+func (req *enrResponseV5) name() string { return "ENRRESPONSE/v5" }
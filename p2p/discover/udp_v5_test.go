@@ -0,0 +1,250 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package discover
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// memNetwork is an in-memory UDP network delivering datagrams between the
+// connections attached to it.
+type memNetwork struct {
+	mu    sync.Mutex
+	conns map[string]*memConn
+}
+
+func newMemNetwork() *memNetwork {
+	return &memNetwork{conns: make(map[string]*memConn)}
+}
+
+// listen attaches a connection with the given address to the network.
+func (n *memNetwork) listen(addr *net.UDPAddr) *memConn {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	c := &memConn{network: n, addr: addr, queue: make(chan ReadPacket, 100), closing: make(chan struct{})}
+	n.conns[addr.String()] = c
+	return c
+}
+
+// memConn is a fake UDP socket attached to a memNetwork.
+type memConn struct {
+	network *memNetwork
+	addr    *net.UDPAddr
+	queue   chan ReadPacket
+	closing chan struct{}
+	once    sync.Once
+}
+
+// WriteToUDP delivers a datagram to the connection with the given address,
+// dropping it if there is none.
+func (c *memConn) WriteToUDP(b []byte, to *net.UDPAddr) (n int, err error) {
+	c.network.mu.Lock()
+	dst := c.network.conns[to.String()]
+	c.network.mu.Unlock()
+
+	if dst != nil {
+		select {
+		case dst.queue <- ReadPacket{Data: append([]byte{}, b...), Addr: c.addr}:
+		default:
+		}
+	}
+	return len(b), nil
+}
+
+// ReadFromUDP waits for a datagram or until the connection is closed.
+func (c *memConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err error) {
+	select {
+	case p := <-c.queue:
+		return copy(b, p.Data), p.Addr, nil
+	case <-c.closing:
+		return 0, nil, io.EOF
+	}
+}
+
+func (c *memConn) Close() error {
+	c.once.Do(func() {
+		c.network.mu.Lock()
+		delete(c.network.conns, c.addr.String())
+		c.network.mu.Unlock()
+		close(c.closing)
+	})
+	return nil
+}
+
+func (c *memConn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// sharedConn reads the packets left unhandled by the listener of another
+// protocol on the same connection.
+type sharedConn struct {
+	conn
+	unhandled chan ReadPacket
+}
+
+func (s *sharedConn) ReadFromUDP(b []byte) (n int, addr *net.UDPAddr, err error) {
+	p, ok := <-s.unhandled
+	if !ok {
+		return 0, nil, errors.New("connection closed")
+	}
+	return copy(b, p.Data), p.Addr, nil
+}
+
+func (s *sharedConn) Close() error {
+	return nil
+}
+
+// startV5Node starts the v4 and ENR based discovery protocols sharing the given
+// port of the in-memory network.
+func startV5Node(t *testing.T, network *memNetwork, port int, bootnodes ...*Node) (*Table, *UDPv5) {
+	key, _ := crypto.GenerateKey()
+	var (
+		c         = network.listen(&net.UDPAddr{IP: net.IP{127, 0, 0, 1}, Port: port})
+		unhandled = make(chan ReadPacket, 100)
+	)
+	tab, _, err := newUDP(c, Config{PrivateKey: key, Bootnodes: bootnodes, Unhandled: unhandled})
+	if err != nil {
+		t.Fatalf("failed to start v4 discovery: %v", err)
+	}
+	udp, err := newUDPv5(&sharedConn{c, unhandled}, NewLocalNode(key), Config{PrivateKey: key, Bootnodes: bootnodes})
+	if err != nil {
+		t.Fatalf("failed to start ENR discovery: %v", err)
+	}
+	return tab, udp
+}
+
+// waitFor polls the condition until it holds or the timeout expires.
+func waitFor(timeout time.Duration, cond func() bool) bool {
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if cond() {
+			return true
+		}
+	}
+	return cond()
+}
+
+// Tests that nodes running the ENR based protocol next to v4 on the same port
+// find each other, exchanging their records.
+func TestUDPv5_lookupRecords(t *testing.T) {
+	network := newMemNetwork()
+	boottab, boot := startV5Node(t, network, 30300)
+	defer boottab.Close()
+	defer boot.Close()
+
+	bootnode := NewNode(boot.Self().ID, net.IP{127, 0, 0, 1}, 30300, 30300)
+	var nodes []*UDPv5
+	for i := 1; i <= 3; i++ {
+		tab, udp := startV5Node(t, network, 30300+i, bootnode)
+		defer tab.Close()
+		defer udp.Close()
+
+		udp.LocalNode().Set(enr.WithEntry("les", uint(i)))
+		nodes = append(nodes, udp)
+	}
+	// Wait for the bootnode to learn the records of all nodes
+	if !waitFor(5*time.Second, func() bool {
+		for _, n := range nodes {
+			if e := boot.tableNode(n.Self().ID); e == nil || e.Record == nil {
+				return false
+			}
+		}
+		return true
+	}) {
+		t.Fatalf("bootnode didn't learn all node records")
+	}
+	// Look up a node and check the record entries of the results
+	target := nodes[1].Self()
+	var found *Node
+	for _, n := range nodes[0].Lookup(target.ID) {
+		if n.ID == target.ID {
+			found = n
+		}
+	}
+	if found == nil {
+		t.Fatalf("lookup didn't find target node")
+	}
+	var capacity uint
+	if err := found.Load(enr.WithEntry("les", &capacity)); err != nil {
+		t.Fatalf("failed to load record entry: %v", err)
+	}
+	if capacity != 2 {
+		t.Errorf("record entry mismatch: have %d, want %d", capacity, 2)
+	}
+	if found.UDP != 30302 || found.TCP != 30302 || !found.IP.Equal(net.IP{127, 0, 0, 1}) {
+		t.Errorf("endpoint mismatch: have %v:%d/%d", found.IP, found.UDP, found.TCP)
+	}
+	// Update the record and check that queries return the new version
+	nodes[1].LocalNode().Set(enr.WithEntry("les", uint(20)))
+	updated, err := nodes[0].RequestENR(found)
+	if err != nil {
+		t.Fatalf("failed to request record: %v", err)
+	}
+	if updated.Record.Seq() <= found.Record.Seq() {
+		t.Errorf("record not updated: have seq %d, old seq %d", updated.Record.Seq(), found.Record.Seq())
+	}
+	if err := updated.Load(enr.WithEntry("les", &capacity)); err != nil || capacity != 20 {
+		t.Errorf("updated record entry mismatch: have %d (%v), want %d", capacity, err, 20)
+	}
+}
+
+// Tests that the local record is updated once enough peers agree on a new
+// external endpoint, unless the IP address was configured statically.
+func TestLocalNodeEndpoint(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	ln := NewLocalNode(key)
+	ln.setEndpoint(&net.UDPAddr{IP: net.IP{10, 0, 0, 1}, Port: 30303})
+
+	seq := ln.Seq()
+	if n := ln.Node(); !n.IP.Equal(net.IP{10, 0, 0, 1}) || n.UDP != 30303 || n.TCP != 30303 {
+		t.Fatalf("initial endpoint mismatch: have %v:%d/%d", n.IP, n.UDP, n.TCP)
+	}
+	external := &net.UDPAddr{IP: net.IP{1, 2, 3, 4}, Port: 40404}
+	for i := 0; i < endpointStatements; i++ {
+		if n := ln.Node(); n.UDP != 30303 {
+			t.Fatalf("endpoint updated after %d statements", i)
+		}
+		ln.UDPEndpointStatement(&net.UDPAddr{IP: net.IP{5, 5, 5, byte(i)}, Port: 30303}, external)
+	}
+	n := ln.Node()
+	if !n.IP.Equal(external.IP) || n.UDP != uint16(external.Port) {
+		t.Fatalf("endpoint not updated: have %v:%d", n.IP, n.UDP)
+	}
+	if ln.Seq() <= seq {
+		t.Errorf("sequence number not increased: have %d, old %d", ln.Seq(), seq)
+	}
+	// Repeated statements of the same endpoint shouldn't change the record
+	seq = ln.Seq()
+	ln.UDPEndpointStatement(&net.UDPAddr{IP: net.IP{5, 5, 5, 0}, Port: 30303}, external)
+	if ln.Seq() != seq {
+		t.Errorf("sequence number changed without record update")
+	}
+	// Static IP addresses override the predicted ones
+	ln.SetStaticIP(net.IP{8, 8, 8, 8})
+	ln.UDPEndpointStatement(&net.UDPAddr{IP: net.IP{5, 5, 5, 9}, Port: 30303}, external)
+	if n := ln.Node(); !n.IP.Equal(net.IP{8, 8, 8, 8}) {
+		t.Errorf("static IP overridden: have %v", n.IP)
+	}
+}
@@ -0,0 +1,373 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+const (
+	defaultTimeout         = 5 * time.Second
+	defaultRecheckInterval = 30 * time.Minute
+	defaultCacheLimit      = 1000
+
+	// maxLinkDepth is the maximum number of links followed from the configured
+	// trees, protecting against link cycles and unbounded crawls.
+	maxLinkDepth = 4
+)
+
+// Resolver is a DNS resolver that can query TXT records. It is satisfied by
+// net.Resolver and can be replaced to resolve from other sources in tests.
+type Resolver interface {
+	LookupTXT(ctx context.Context, domain string) ([]string, error)
+}
+
+// Config holds the settings of the DNS discovery client.
+type Config struct {
+	Timeout         time.Duration // timeout used for DNS lookups (default 5s)
+	RecheckInterval time.Duration // time between tree root update checks (default 30min)
+	CacheLimit      int           // maximum number of cached entries (default 1000)
+	Resolver        Resolver      // the DNS resolver to use (defaults to system DNS)
+}
+
+// withDefaults returns a copy of the configuration with unset fields defaulted.
+func (cfg Config) withDefaults() Config {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = defaultRecheckInterval
+	}
+	if cfg.CacheLimit == 0 {
+		cfg.CacheLimit = defaultCacheLimit
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = new(net.Resolver)
+	}
+	return cfg
+}
+
+// Client resolves and verifies node lists published in DNS.
+type Client struct {
+	cfg Config
+
+	lock    sync.Mutex
+	entries map[string]entry // cache of verified entries by subdomain
+}
+
+// NewClient creates a DNS discovery client.
+func NewClient(cfg Config) *Client {
+	return &Client{cfg: cfg.withDefaults(), entries: make(map[string]entry)}
+}
+
+// SyncTree downloads the complete node list tree at the given URL, verifying
+// the root signature and the hashes of all entries.
+func (c *Client) SyncTree(url string) (*Tree, error) {
+	le, err := parseLink(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enrtree URL: %v", err)
+	}
+	return c.syncTree(le)
+}
+
+func (c *Client) syncTree(le *linkEntry) (*Tree, error) {
+	root, err := c.resolveRoot(le)
+	if err != nil {
+		return nil, err
+	}
+	t := &Tree{root: root, entries: make(map[string]entry)}
+	if err := c.syncSubtree(le.domain, root.eroot, false, t.entries); err != nil {
+		return nil, err
+	}
+	if err := c.syncSubtree(le.domain, root.lroot, true, t.entries); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// syncSubtree resolves all entries below the given hash into entries.
+func (c *Client) syncSubtree(domain, hash string, lists bool, entries map[string]entry) error {
+	e, err := c.resolveEntry(domain, hash, lists)
+	if err != nil {
+		return err
+	}
+	entries[hash] = e
+	if b, ok := e.(*branchEntry); ok {
+		for _, child := range b.children {
+			if err := c.syncSubtree(domain, child, lists, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolveRoot retrieves the root entry of a tree and verifies its signature.
+func (c *Client) resolveRoot(le *linkEntry) (*rootEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, le.domain)
+	if err != nil {
+		return nil, err
+	}
+	for _, txt := range txts {
+		if !strings.HasPrefix(txt, rootPrefix) {
+			continue
+		}
+		root, err := parseRoot(txt)
+		if err != nil {
+			return nil, err
+		}
+		if !root.verifySignature(le.pubkey) {
+			return nil, errInvalidSig
+		}
+		return root, nil
+	}
+	return nil, fmt.Errorf("no root entry found at %s", le.domain)
+}
+
+// resolveEntry retrieves an entry from the cache or from DNS, checking that it
+// matches its hash.
+func (c *Client) resolveEntry(domain, hash string, lists bool) (entry, error) {
+	c.lock.Lock()
+	e, ok := c.entries[hash]
+	c.lock.Unlock()
+	if ok {
+		return e, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.cfg.Timeout)
+	defer cancel()
+
+	txts, err := c.cfg.Resolver.LookupTXT(ctx, hash+"."+domain)
+	if err != nil {
+		return nil, err
+	}
+	want, err := b32format.DecodeString(hash)
+	if err != nil {
+		return nil, errInvalidChild
+	}
+	// Long TXT records may be split into multiple strings, try the concatenation too.
+	if len(txts) > 1 {
+		txts = append(txts, strings.Join(txts, ""))
+	}
+	for _, txt := range txts {
+		if !bytes.HasPrefix(crypto.Keccak256([]byte(txt)), want) {
+			continue
+		}
+		e, err := parseEntry(txt, lists)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry at %s.%s: %v", hash, domain, err)
+		}
+		c.cache(hash, e)
+		return e, nil
+	}
+	return nil, fmt.Errorf("%v at %s.%s", errHashMismatch, hash, domain)
+}
+
+// cache stores a verified entry, evicting a random one if the cache is full.
+func (c *Client) cache(hash string, e entry) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if len(c.entries) >= c.cfg.CacheLimit {
+		for h := range c.entries {
+			delete(c.entries, h)
+			break
+		}
+	}
+	c.entries[hash] = e
+}
+
+// NodeSource provides random nodes from a set of node lists, including the
+// lists linked from them. The lists are synced in the background, picking up
+// new versions of their trees.
+type NodeSource struct {
+	client *Client
+	urls   []*linkEntry
+
+	lock  sync.RWMutex
+	roots map[string]*rootEntry // last synced root per list URL
+	trees map[string]*Tree      // last synced tree per list URL
+	nodes []*discover.Node      // union of the nodes of all trees
+	rand  *rand.Rand
+
+	closing chan struct{}
+	synced  chan struct{} // closed once the first sync finished
+}
+
+// NewNodeSource creates a node source for the given enrtree URLs and starts
+// syncing them.
+func (c *Client) NewNodeSource(urls ...string) (*NodeSource, error) {
+	s := &NodeSource{
+		client:  c,
+		roots:   make(map[string]*rootEntry),
+		trees:   make(map[string]*Tree),
+		rand:    rand.New(rand.NewSource(time.Now().UnixNano())),
+		closing: make(chan struct{}),
+		synced:  make(chan struct{}),
+	}
+	for _, url := range urls {
+		le, err := parseLink(url)
+		if err != nil {
+			return nil, fmt.Errorf("invalid enrtree URL %q: %v", url, err)
+		}
+		s.urls = append(s.urls, le)
+	}
+	go s.loop()
+	return s, nil
+}
+
+// Close stops syncing the node lists.
+func (s *NodeSource) Close() {
+	close(s.closing)
+}
+
+// Synced returns a channel that is closed once the lists were synced for the
+// first time.
+func (s *NodeSource) Synced() <-chan struct{} {
+	return s.synced
+}
+
+// ReadRandomNodes fills buf with random nodes of the lists, returning the
+// number of nodes written.
+func (s *NodeSource) ReadRandomNodes(buf []*discover.Node) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if len(buf) >= len(s.nodes) {
+		return copy(buf, s.nodes)
+	}
+	for i, j := range s.rand.Perm(len(s.nodes))[:len(buf)] {
+		buf[i] = s.nodes[j]
+	}
+	return len(buf)
+}
+
+// loop syncs the lists periodically until the source is closed.
+func (s *NodeSource) loop() {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	first := true
+	for {
+		select {
+		case <-timer.C:
+			s.sync()
+			if first {
+				close(s.synced)
+				first = false
+			}
+			timer.Reset(s.client.cfg.RecheckInterval)
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+// sync resolves the roots of all lists and their links, re-syncing the trees
+// whose root changed.
+func (s *NodeSource) sync() {
+	var (
+		visited = make(map[string]bool)
+		queue   = s.urls
+	)
+	for depth := 0; depth <= maxLinkDepth && len(queue) > 0; depth++ {
+		var next []*linkEntry
+		for _, le := range queue {
+			url := le.String()
+			if visited[url] {
+				continue
+			}
+			visited[url] = true
+
+			tree, err := s.syncList(le)
+			if err != nil {
+				log.Debug("Failed to sync DNS node list", "url", url, "err", err)
+				continue
+			}
+			for _, link := range tree.Links() {
+				if le, err := parseLink(link); err == nil {
+					next = append(next, le)
+				}
+			}
+		}
+		queue = next
+	}
+	// Assemble the union of the nodes of all reachable lists
+	seen := make(map[discover.NodeID]bool)
+	var nodes []*discover.Node
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for url, tree := range s.trees {
+		if !visited[url] {
+			delete(s.trees, url)
+			delete(s.roots, url)
+			continue
+		}
+		for _, n := range tree.Nodes() {
+			if !seen[n.ID] {
+				seen[n.ID] = true
+				nodes = append(nodes, n)
+			}
+		}
+	}
+	s.nodes = nodes
+	log.Debug("Synced DNS node lists", "lists", len(s.trees), "nodes", len(nodes))
+}
+
+// syncList syncs a single list, reusing the last synced tree if its root is
+// unchanged.
+func (s *NodeSource) syncList(le *linkEntry) (*Tree, error) {
+	url := le.String()
+	root, err := s.client.resolveRoot(le)
+	if err != nil {
+		return nil, err
+	}
+	s.lock.RLock()
+	last, tree := s.roots[url], s.trees[url]
+	s.lock.RUnlock()
+
+	if last != nil && tree != nil {
+		if root.seq < last.seq {
+			return tree, nil // stale root, keep the newer tree
+		}
+		if root.eroot == last.eroot && root.lroot == last.lroot {
+			return tree, nil
+		}
+	}
+	if tree, err = s.client.syncTree(le); err != nil {
+		return nil, err
+	}
+	s.lock.Lock()
+	s.roots[url], s.trees[url] = tree.root, tree
+	s.lock.Unlock()
+	return tree, nil
+}
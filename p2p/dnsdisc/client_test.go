@@ -0,0 +1,200 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// mapResolver is a fake DNS resolver serving TXT records from a map.
+type mapResolver struct {
+	mu      sync.Mutex
+	records map[string]string
+	queries int
+}
+
+func newMapResolver() *mapResolver {
+	return &mapResolver{records: make(map[string]string)}
+}
+
+// publish adds the records of the tree, signed with key, under domain.
+func (mr *mapResolver) publish(t *testing.T, key *ecdsa.PrivateKey, domain string, tree *Tree) string {
+	url, err := tree.Sign(key, domain)
+	if err != nil {
+		t.Fatalf("failed to sign tree: %v", err)
+	}
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	for name, txt := range tree.ToTXT(domain) {
+		mr.records[name] = txt
+	}
+	return url
+}
+
+func (mr *mapResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	mr.mu.Lock()
+	defer mr.mu.Unlock()
+
+	mr.queries++
+	if txt, ok := mr.records[name]; ok {
+		return []string{txt}, nil
+	}
+	return nil, errors.New("not found")
+}
+
+// Tests that a published tree is synced completely and that the entries are
+// cached afterwards.
+func TestClientSyncTree(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		resolver = newMapResolver()
+		nodes    = testNodes(maxChildren + 2)
+	)
+	tree, _ := MakeTree(1, nodes, []string{testLink(key, "other.example.org")})
+	url := resolver.publish(t, key, "nodes.example.org", tree)
+
+	c := NewClient(Config{Resolver: resolver})
+	synced, err := c.SyncTree(url)
+	if err != nil {
+		t.Fatalf("sync failed: %v", err)
+	}
+	if have, want := nodeIDs(synced.Nodes()), nodeIDs(tree.Nodes()); !reflect.DeepEqual(have, want) {
+		t.Errorf("synced node mismatch: have %d nodes, want %d", len(have), len(want))
+	}
+	if !reflect.DeepEqual(synced.Links(), tree.Links()) {
+		t.Errorf("synced link mismatch: have %v, want %v", synced.Links(), tree.Links())
+	}
+	if synced.Signature() != tree.Signature() {
+		t.Errorf("signature mismatch")
+	}
+	// A second sync should only query the root
+	queries := resolver.queries
+	if _, err := c.SyncTree(url); err != nil {
+		t.Fatalf("second sync failed: %v", err)
+	}
+	if resolver.queries != queries+1 {
+		t.Errorf("second sync made %d queries, want 1", resolver.queries-queries)
+	}
+}
+
+// Tests that trees with invalid signatures or tampered entries are rejected.
+func TestClientSyncTreeInvalid(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		other, _ = crypto.GenerateKey()
+		resolver = newMapResolver()
+	)
+	tree, _ := MakeTree(1, testNodes(3), nil)
+	url := resolver.publish(t, key, "nodes.example.org", tree)
+
+	// Signature made by a different key
+	if _, err := NewClient(Config{Resolver: resolver}).SyncTree(testLink(other, "nodes.example.org")); err != errInvalidSig {
+		t.Errorf("wrong error for foreign key: %v", err)
+	}
+	// Entry replaced by another one
+	for name, txt := range resolver.records {
+		if strings.HasPrefix(txt, enrPrefix) {
+			resolver.records[name] = (&enrEntry{node: testNodes(1)[0]}).String()
+			break
+		}
+	}
+	_, err := NewClient(Config{Resolver: resolver}).SyncTree(url)
+	if err == nil || !strings.Contains(err.Error(), errHashMismatch.Error()) {
+		t.Errorf("wrong error for tampered entry: %v", err)
+	}
+}
+
+// Tests that the node source provides the nodes of the configured lists and of
+// the lists linked from them, and that it picks up updates of the trees.
+func TestNodeSource(t *testing.T) {
+	var (
+		key, _   = crypto.GenerateKey()
+		resolver = newMapResolver()
+		nodesA   = testNodes(3)
+		nodesB   = testNodes(2)
+	)
+	treeB, _ := MakeTree(1, nodesB, nil)
+	urlB := resolver.publish(t, key, "b.example.org", treeB)
+	treeA, _ := MakeTree(1, nodesA, []string{urlB})
+	urlA := resolver.publish(t, key, "a.example.org", treeA)
+
+	c := NewClient(Config{Resolver: resolver, RecheckInterval: 50 * time.Millisecond})
+	src, err := c.NewNodeSource(urlA)
+	if err != nil {
+		t.Fatalf("failed to create node source: %v", err)
+	}
+	defer src.Close()
+	<-src.Synced()
+
+	want := append(nodeIDs(nodesA), nodeIDs(nodesB)...)
+	if have := readAllNodes(src); !sameIDs(have, want) {
+		t.Errorf("node mismatch: have %v, want %v", have, want)
+	}
+	// Publish a new version of the linked tree and wait for it to be picked up
+	nodesB = testNodes(4)
+	treeB, _ = MakeTree(2, nodesB, nil)
+	resolver.publish(t, key, "b.example.org", treeB)
+
+	want = append(nodeIDs(nodesA), nodeIDs(nodesB)...)
+	deadline := time.Now().Add(5 * time.Second)
+	for !sameIDs(readAllNodes(src), want) {
+		if time.Now().After(deadline) {
+			t.Fatalf("tree update not picked up")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	// Reading fewer nodes than available returns distinct ones
+	buf := make([]*discover.Node, 3)
+	if n := src.ReadRandomNodes(buf); n != len(buf) {
+		t.Fatalf("wrong number of random nodes: have %d, want %d", n, len(buf))
+	}
+	if buf[0] == buf[1] || buf[1] == buf[2] || buf[0] == buf[2] {
+		t.Errorf("duplicate random nodes returned")
+	}
+}
+
+func readAllNodes(src *NodeSource) []discover.NodeID {
+	buf := make([]*discover.Node, 100)
+	return nodeIDs(buf[:src.ReadRandomNodes(buf)])
+}
+
+func sameIDs(a, b []discover.NodeID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	sorted := func(ids []discover.NodeID) []string {
+		s := make([]string, len(ids))
+		for i, id := range ids {
+			s[i] = id.String()
+		}
+		sort.Strings(s)
+		return s
+	}
+	return reflect.DeepEqual(sorted(a), sorted(b))
+}
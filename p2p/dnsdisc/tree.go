@@ -0,0 +1,398 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package dnsdisc implements node discovery via DNS (EIP-1459). Node lists are
+// published as a signed merkle tree of node records in DNS TXT records, which
+// clients resolve and verify against the public key contained in the list URL.
+package dnsdisc
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+const (
+	rootPrefix   = "enrtree-root:v1"
+	linkPrefix   = "enrtree://"
+	branchPrefix = "enrtree-branch:"
+	enrPrefix    = "enr:"
+)
+
+// maxChildren is the maximum number of children of a branch entry, keeping the
+// entry below the size of a single TXT record string.
+var maxChildren = 370 / (b32format.EncodedLen(hashAbbrevSize) + 1)
+
+const (
+	hashAbbrevSize = 16 // number of hash bytes used as the subdomain of an entry
+	sigLength      = 65 // length of the [R || S || V] root signature
+)
+
+var (
+	b32format = base32.StdEncoding.WithPadding(base32.NoPadding)
+	b64format = base64.RawURLEncoding
+)
+
+var (
+	// errUnknownEntry is returned when parsing a TXT record of unknown type.
+	errUnknownEntry = errors.New("unknown entry type")
+
+	// errNoPubkey is returned for link URLs without public key.
+	errNoPubkey = errors.New("missing public key")
+
+	// errBadPubkey is returned for link URLs with an invalid public key.
+	errBadPubkey = errors.New("invalid public key")
+
+	// errInvalidENR is returned for invalid node record entries.
+	errInvalidENR = errors.New("invalid node record")
+
+	// errInvalidChild is returned for branch entries with invalid child hashes.
+	errInvalidChild = errors.New("invalid child hash")
+
+	// errInvalidSig is returned for root entries with an invalid signature.
+	errInvalidSig = errors.New("invalid root signature")
+
+	// errSyntax is returned for malformed entries.
+	errSyntax = errors.New("invalid syntax")
+
+	// errHashMismatch is returned if an entry doesn't match the hash it was
+	// requested by.
+	errHashMismatch = errors.New("hash mismatch")
+
+	// errEntryInWrongTree is returned for link entries found in the node subtree,
+	// or record entries found in the link subtree.
+	errEntryInWrongTree = errors.New("entry in wrong subtree")
+)
+
+// Tree is a merkle tree of node records, along with links to other trees.
+type Tree struct {
+	root    *rootEntry
+	entries map[string]entry
+}
+
+// MakeTree creates a tree containing the given nodes and links. The nodes must
+// carry a signed record. The tree is unsigned, call Sign before publishing it.
+func MakeTree(seq uint, nodes []*discover.Node, links []string) (*Tree, error) {
+	// Sort the records by node ID, making the tree deterministic.
+	records := make([]*discover.Node, len(nodes))
+	copy(records, nodes)
+	sort.Slice(records, func(i, j int) bool { return bytes.Compare(records[i].ID[:], records[j].ID[:]) < 0 })
+
+	enrEntries := make([]entry, len(records))
+	for i, n := range records {
+		if n.Record == nil || !n.Record.Signed() {
+			return nil, fmt.Errorf("node %x has no signed record", n.ID[:8])
+		}
+		enrEntries[i] = &enrEntry{node: n}
+	}
+	linkEntries := make([]entry, len(links))
+	for i, l := range links {
+		le, err := parseLink(l)
+		if err != nil {
+			return nil, err
+		}
+		linkEntries[i] = le
+	}
+	t := &Tree{entries: make(map[string]entry)}
+	eroot := t.build(enrEntries)
+	lroot := t.build(linkEntries)
+	t.root = &rootEntry{seq: seq, eroot: subdomain(eroot), lroot: subdomain(lroot)}
+	return t, nil
+}
+
+// build adds the given entries to the tree, grouping them under branch entries
+// if necessary, and returns the root entry of the resulting subtree.
+func (t *Tree) build(entries []entry) entry {
+	if len(entries) == 1 {
+		t.entries[subdomain(entries[0])] = entries[0]
+		return entries[0]
+	}
+	if len(entries) <= maxChildren {
+		b := &branchEntry{children: make([]string, len(entries))}
+		for i, e := range entries {
+			b.children[i] = subdomain(e)
+			t.entries[b.children[i]] = e
+		}
+		t.entries[subdomain(b)] = b
+		return b
+	}
+	var subtrees []entry
+	for len(entries) > 0 {
+		n := maxChildren
+		if len(entries) < n {
+			n = len(entries)
+		}
+		subtrees = append(subtrees, t.build(entries[:n]))
+		entries = entries[n:]
+	}
+	return t.build(subtrees)
+}
+
+// Sign signs the tree root with the given key, returning the URL of the tree
+// when published under domain.
+func (t *Tree) Sign(key *ecdsa.PrivateKey, domain string) (string, error) {
+	root := *t.root
+	sig, err := crypto.Sign(root.sigHash(), key)
+	if err != nil {
+		return "", err
+	}
+	root.sig = sig
+	t.root = &root
+	link := &linkEntry{domain: domain, pubkey: &key.PublicKey}
+	return link.String(), nil
+}
+
+// SetSignature verifies and sets the root signature of the tree. The signature
+// must be base64 encoded and made by the given public key.
+func (t *Tree) SetSignature(pubkey *ecdsa.PublicKey, signature string) error {
+	sig, err := b64format.DecodeString(signature)
+	if err != nil || len(sig) != sigLength {
+		return errInvalidSig
+	}
+	root := *t.root
+	root.sig = sig
+	if !root.verifySignature(pubkey) {
+		return errInvalidSig
+	}
+	t.root = &root
+	return nil
+}
+
+// Seq returns the sequence number of the tree.
+func (t *Tree) Seq() uint {
+	return t.root.seq
+}
+
+// Signature returns the base64 encoded root signature.
+func (t *Tree) Signature() string {
+	return b64format.EncodeToString(t.root.sig)
+}
+
+// ToTXT returns the TXT records of the tree when published under domain. The
+// root entry is stored at the domain itself, all other entries at their hash
+// subdomain.
+func (t *Tree) ToTXT(domain string) map[string]string {
+	records := map[string]string{domain: t.root.String()}
+	for _, e := range t.entries {
+		sd := subdomain(e)
+		if domain != "" {
+			sd = sd + "." + domain
+		}
+		records[sd] = e.String()
+	}
+	return records
+}
+
+// Links returns the URLs of all trees linked from the tree.
+func (t *Tree) Links() []string {
+	var links []string
+	for _, e := range t.entries {
+		if le, ok := e.(*linkEntry); ok {
+			links = append(links, le.String())
+		}
+	}
+	sort.Strings(links)
+	return links
+}
+
+// Nodes returns all nodes contained in the tree.
+func (t *Tree) Nodes() []*discover.Node {
+	var nodes []*discover.Node
+	for _, e := range t.entries {
+		if ee, ok := e.(*enrEntry); ok {
+			nodes = append(nodes, ee.node)
+		}
+	}
+	sort.Slice(nodes, func(i, j int) bool { return bytes.Compare(nodes[i].ID[:], nodes[j].ID[:]) < 0 })
+	return nodes
+}
+
+// Entry types.
+
+type entry interface {
+	fmt.Stringer
+}
+
+type (
+	rootEntry struct {
+		eroot string
+		lroot string
+		seq   uint
+		sig   []byte
+	}
+	branchEntry struct {
+		children []string
+	}
+	enrEntry struct {
+		node *discover.Node
+	}
+	linkEntry struct {
+		domain string
+		pubkey *ecdsa.PublicKey
+	}
+)
+
+// subdomain returns the subdomain an entry is published at, the abbreviated
+// base32 encoded hash of its text representation.
+func subdomain(e entry) string {
+	h := crypto.Keccak256([]byte(e.String()))
+	return b32format.EncodeToString(h[:hashAbbrevSize])
+}
+
+func (e *rootEntry) String() string {
+	return fmt.Sprintf(rootPrefix+" e=%s l=%s seq=%d sig=%s", e.eroot, e.lroot, e.seq, b64format.EncodeToString(e.sig))
+}
+
+// sigHash returns the hash signed by the tree key, covering the root entry
+// without its signature.
+func (e *rootEntry) sigHash() []byte {
+	return crypto.Keccak256([]byte(fmt.Sprintf(rootPrefix+" e=%s l=%s seq=%d", e.eroot, e.lroot, e.seq)))
+}
+
+func (e *rootEntry) verifySignature(pubkey *ecdsa.PublicKey) bool {
+	if len(e.sig) != sigLength {
+		return false
+	}
+	return crypto.VerifySignature(crypto.CompressPubkey(pubkey), e.sigHash(), e.sig[:sigLength-1])
+}
+
+func (e *branchEntry) String() string {
+	return branchPrefix + strings.Join(e.children, ",")
+}
+
+func (e *enrEntry) String() string {
+	blob, err := rlp.EncodeToBytes(e.node.Record)
+	if err != nil {
+		panic(fmt.Errorf("dnsdisc: can't encode record: %v", err))
+	}
+	return enrPrefix + b64format.EncodeToString(blob)
+}
+
+func (e *linkEntry) String() string {
+	return linkPrefix + b32format.EncodeToString(crypto.CompressPubkey(e.pubkey)) + "@" + e.domain
+}
+
+// Entry parsing.
+
+// parseEntry parses a TXT record of the node subtree (lists is false) or the
+// link subtree (lists is true).
+func parseEntry(e string, lists bool) (entry, error) {
+	switch {
+	case strings.HasPrefix(e, linkPrefix):
+		if !lists {
+			return nil, errEntryInWrongTree
+		}
+		return parseLink(e)
+	case strings.HasPrefix(e, branchPrefix):
+		return parseBranch(e[len(branchPrefix):])
+	case strings.HasPrefix(e, enrPrefix):
+		if lists {
+			return nil, errEntryInWrongTree
+		}
+		return parseENR(e[len(enrPrefix):])
+	default:
+		return nil, errUnknownEntry
+	}
+}
+
+func parseRoot(e string) (*rootEntry, error) {
+	var (
+		eroot, lroot, sig string
+		seq               uint
+	)
+	if _, err := fmt.Sscanf(e, rootPrefix+" e=%s l=%s seq=%d sig=%s", &eroot, &lroot, &seq, &sig); err != nil {
+		return nil, errSyntax
+	}
+	if !isValidHash(eroot) || !isValidHash(lroot) {
+		return nil, errInvalidChild
+	}
+	sigb, err := b64format.DecodeString(sig)
+	if err != nil || len(sigb) != sigLength {
+		return nil, errInvalidSig
+	}
+	return &rootEntry{eroot: eroot, lroot: lroot, seq: seq, sig: sigb}, nil
+}
+
+func parseLink(e string) (*linkEntry, error) {
+	if !strings.HasPrefix(e, linkPrefix) {
+		return nil, fmt.Errorf("wrong/missing scheme 'enrtree' in URL")
+	}
+	e = e[len(linkPrefix):]
+	pos := strings.IndexByte(e, '@')
+	if pos == -1 {
+		return nil, errNoPubkey
+	}
+	keystring, domain := e[:pos], e[pos+1:]
+	keybytes, err := b32format.DecodeString(keystring)
+	if err != nil {
+		return nil, errBadPubkey
+	}
+	key, err := crypto.DecompressPubkey(keybytes)
+	if err != nil {
+		return nil, errBadPubkey
+	}
+	return &linkEntry{domain: domain, pubkey: key}, nil
+}
+
+func parseBranch(e string) (entry, error) {
+	e = strings.TrimSpace(e)
+	if e == "" {
+		return &branchEntry{}, nil
+	}
+	hashes := strings.Split(e, ",")
+	for _, h := range hashes {
+		if !isValidHash(h) {
+			return nil, errInvalidChild
+		}
+	}
+	return &branchEntry{children: hashes}, nil
+}
+
+func parseENR(e string) (entry, error) {
+	blob, err := b64format.DecodeString(e)
+	if err != nil {
+		return nil, errInvalidENR
+	}
+	var record enr.Record
+	if err := rlp.Decode(bytes.NewReader(blob), &record); err != nil && err != io.EOF {
+		return nil, errInvalidENR
+	}
+	n, err := discover.NodeFromRecord(&record)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", errInvalidENR, err)
+	}
+	return &enrEntry{node: n}, nil
+}
+
+func isValidHash(s string) bool {
+	dlen := b32format.DecodedLen(len(s))
+	if dlen < 12 || dlen > 32 {
+		return false
+	}
+	_, err := b32format.DecodeString(s)
+	return err == nil
+}
@@ -0,0 +1,157 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package dnsdisc
+
+import (
+	"crypto/ecdsa"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enr"
+)
+
+// testNodes creates n nodes carrying signed records.
+func testNodes(n int) []*discover.Node {
+	nodes := make([]*discover.Node, n)
+	for i := range nodes {
+		key, _ := crypto.GenerateKey()
+		ln := discover.NewLocalNode(key)
+		ln.SetStaticIP(net.IP{127, 0, 0, byte(i + 1)})
+		ln.Set(enr.UDP(30303))
+		ln.Set(enr.TCP(30303))
+		nodes[i] = ln.Node()
+	}
+	return nodes
+}
+
+// testLink returns the URL of a tree signed by key at domain.
+func testLink(key *ecdsa.PrivateKey, domain string) string {
+	return (&linkEntry{domain: domain, pubkey: &key.PublicKey}).String()
+}
+
+func nodeIDs(nodes []*discover.Node) []discover.NodeID {
+	ids := make([]discover.NodeID, len(nodes))
+	for i, n := range nodes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+// Tests that trees too large for a single branch are split into subtrees and
+// that all nodes and links can be retrieved again.
+func TestMakeTree(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	nodes := testNodes(maxChildren + 5)
+	links := []string{testLink(key, "a.example.org"), testLink(key, "b.example.org")}
+
+	tree, err := MakeTree(3, nodes, links)
+	if err != nil {
+		t.Fatalf("failed to make tree: %v", err)
+	}
+	if tree.Seq() != 3 {
+		t.Errorf("seq mismatch: have %d, want %d", tree.Seq(), 3)
+	}
+	if have, want := nodeIDs(tree.Nodes()), nodeIDs(sortedNodes(nodes)); !reflect.DeepEqual(have, want) {
+		t.Errorf("node mismatch: have %d nodes, want %d", len(have), len(want))
+	}
+	if !reflect.DeepEqual(tree.Links(), links) {
+		t.Errorf("link mismatch: have %v, want %v", tree.Links(), links)
+	}
+	// Every branch must fit into a single TXT record
+	for _, e := range tree.entries {
+		if b, ok := e.(*branchEntry); ok && len(b.children) > maxChildren {
+			t.Errorf("branch has %d children, max %d", len(b.children), maxChildren)
+		}
+	}
+	// Nodes without signed records can't be added
+	if _, err := MakeTree(1, []*discover.Node{discover.NewNode(discover.NodeID{1}, net.IP{127, 0, 0, 1}, 1, 1)}, nil); err == nil {
+		t.Errorf("expected error for node without record")
+	}
+}
+
+// Tests the signing of the tree root and its verification.
+func TestTreeSignature(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tree, _ := MakeTree(1, testNodes(2), nil)
+
+	url, err := tree.Sign(key, "nodes.example.org")
+	if err != nil {
+		t.Fatalf("failed to sign tree: %v", err)
+	}
+	if url != testLink(key, "nodes.example.org") {
+		t.Errorf("URL mismatch: have %s", url)
+	}
+	root := tree.ToTXT("nodes.example.org")["nodes.example.org"]
+	if !strings.HasPrefix(root, rootPrefix) {
+		t.Fatalf("invalid root record: %s", root)
+	}
+	parsed, err := parseRoot(root)
+	if err != nil {
+		t.Fatalf("failed to parse root: %v", err)
+	}
+	if !parsed.verifySignature(&key.PublicKey) {
+		t.Errorf("signature doesn't verify")
+	}
+	// Copying the signature onto another tree must only work for the same content
+	sig := tree.Signature()
+	same, _ := MakeTree(1, tree.Nodes(), nil)
+	if err := same.SetSignature(&key.PublicKey, sig); err != nil {
+		t.Errorf("signature rejected for identical tree: %v", err)
+	}
+	other, _ := MakeTree(2, tree.Nodes(), nil)
+	if err := other.SetSignature(&key.PublicKey, sig); err != errInvalidSig {
+		t.Errorf("wrong error for signature of different tree: %v", err)
+	}
+}
+
+func TestParseEntry(t *testing.T) {
+	key, _ := crypto.GenerateKey()
+	tests := []struct {
+		input string
+		lists bool
+		err   error
+	}{
+		{input: branchPrefix, lists: false},
+		{input: branchPrefix + "AAAAAAAAAAAAAAAAAAAA,BBBBBBBBBBBBBBBBBBBB", lists: true},
+		{input: branchPrefix + "AAAAAAAAAAAAAAAAAAAA,!!", err: errInvalidChild},
+		{input: testLink(key, "example.org"), lists: true},
+		{input: testLink(key, "example.org"), lists: false, err: errEntryInWrongTree},
+		{input: linkPrefix + "example.org", lists: true, err: errNoPubkey},
+		{input: linkPrefix + "AAAA@example.org", lists: true, err: errBadPubkey},
+		{input: enrPrefix + "!!", err: errInvalidENR},
+		{input: "foo", err: errUnknownEntry},
+	}
+	for _, test := range tests {
+		_, err := parseEntry(test.input, test.lists)
+		if err != test.err {
+			t.Errorf("parseEntry(%q, %v): have error %v, want %v", test.input, test.lists, err, test.err)
+		}
+	}
+}
+
+// sortedNodes returns the nodes sorted the way Tree.Nodes sorts them.
+func sortedNodes(nodes []*discover.Node) []*discover.Node {
+	tree := &Tree{entries: make(map[string]entry)}
+	for _, n := range nodes {
+		tree.entries[n.ID.String()] = &enrEntry{node: n}
+	}
+	return tree.Nodes()
+}
@@ -112,6 +112,9 @@ type Peer struct {
 
 	// events receives message send / receive events if set
 	events *event.Feed
+
+	// scores records the reputation of the peer if set
+	scores *peerScores
 }
 
 // NewPeer returns a peer for testing purposes.
@@ -168,6 +171,17 @@ func (p *Peer) Inbound() bool {
 	return p.rw.is(inboundConn)
 }
 
+// Score records a protocol level event affecting the reputation of the peer.
+// Peers with a bad reputation are not dialed and are the first ones evicted
+// when inbound slots are needed.
+func (p *Peer) Score(ev ScoreEvent) {
+	if p.scores == nil {
+		return
+	}
+	p.log.Trace("Adjusting peer score", "event", ev)
+	p.scores.add(p.ID(), ev)
+}
+
 func newPeer(conn *conn, protocols []Protocol) *Peer {
 	protomap := matchProtocols(protocols, conn.caps, conn)
 	p := &Peer{
@@ -427,6 +441,7 @@ type PeerInfo struct {
 		Trusted       bool   `json:"trusted"`
 		Static        bool   `json:"static"`
 	} `json:"network"`
+	Score     int                    `json:"score"`     // Reputation score of the remote node
 	Protocols map[string]interface{} `json:"protocols"` // Sub-protocol specific metadata fields
 }
 
@@ -449,6 +464,9 @@ func (p *Peer) Info() *PeerInfo {
 	info.Network.Inbound = p.rw.is(inboundConn)
 	info.Network.Trusted = p.rw.is(trustedConn)
 	info.Network.Static = p.rw.is(staticDialedConn)
+	if p.scores != nil {
+		info.Score = p.scores.score(p.ID())
+	}
 
 	// Gather all the running protocol infos
 	for _, proto := range p.running {
@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 )
 
 // Protocol represents a P2P subprotocol implementation.
@@ -52,6 +53,15 @@ type Protocol struct {
 	// about a certain peer in the network. If an info retrieval function is set,
 	// but returns nil, it is assumed that the protocol handshake is still running.
 	PeerInfo func(id discover.NodeID) interface{}
+
+	// Attributes contains protocol specific entries of the local node record,
+	// advertised through the ENR based discovery protocol.
+	Attributes []enr.Entry
+
+	// NodeFilter is an optional helper method reporting whether a discovered
+	// node is worth dialing for the protocol, usually by inspecting the protocol
+	// specific entries of its record.
+	NodeFilter func(n *discover.Node) bool
 }
 
 func (p Protocol) cap() Cap {
@@ -0,0 +1,138 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import "github.com/ethereum/go-ethereum/metrics"
+
+var (
+	// all metrics are cumulative
+	mBalanceCredit = metrics.NewRegisteredCounter("account.balance.credit", nil) // total amount of units credited
+	mBalanceDebit  = metrics.NewRegisteredCounter("account.balance.debit", nil)  // total amount of units debited
+	mBytesCredit   = metrics.NewRegisteredCounter("account.bytes.credit", nil)   // total amount of bytes credited
+	mBytesDebit    = metrics.NewRegisteredCounter("account.bytes.debit", nil)    // total amount of bytes debited
+	mMsgCredit     = metrics.NewRegisteredCounter("account.msg.credit", nil)     // total amount of messages credited
+	mMsgDebit      = metrics.NewRegisteredCounter("account.msg.debit", nil)      // total amount of messages debited
+	mPeerDrops     = metrics.NewRegisteredCounter("account.peerdrops", nil)      // number of peers dropped due to the balance
+)
+
+// Hook is called on every message sent and received over a peer connection of
+// a protocol with the hook set in its Spec. A returned error drops the peer.
+type Hook interface {
+	// Send is called before a message is sent to the peer
+	Send(peer *Peer, size uint32, msg interface{}) error
+	// Receive is called after a message received from the peer is decoded
+	Receive(peer *Peer, size uint32, msg interface{}) error
+}
+
+// Payer designates which side of a message exchange pays for the message.
+type Payer bool
+
+const (
+	Sender   = Payer(true)  // the sender of the message pays
+	Receiver = Payer(false) // the receiver of the message pays
+)
+
+// Price represents the cost of a message.
+type Price struct {
+	Value   uint64 // units per message, or per byte if PerByte is set
+	PerByte bool
+	Payer   Payer
+}
+
+// For returns the amount of units the local node is credited with for a message
+// of the given size, where payer is the role of the local node in the exchange.
+// The amount is negative if the local node is the one paying.
+func (p *Price) For(payer Payer, size uint32) int64 {
+	price := p.Value
+	if p.PerByte {
+		price *= uint64(size)
+	}
+	if p.Payer == payer {
+		return 0 - int64(price)
+	}
+	return int64(price)
+}
+
+// Balance keeps track of the amounts owed between the local node and its peers.
+type Balance interface {
+	// Add credits the peer's account with the amount, which the peer then owes
+	// to the local node; a negative amount is owed to the peer instead.
+	// Returning an error drops the peer.
+	Add(amount int64, peer *Peer) error
+}
+
+// Prices defines the prices of the messages of a protocol.
+type Prices interface {
+	// Price returns the price of a message, or nil if the message is free
+	Price(msg interface{}) *Price
+}
+
+// Accounting is a Hook accounting the prices of the messages exchanged with
+// the peers in a Balance.
+type Accounting struct {
+	Balance
+	Prices
+}
+
+// NewAccounting creates an accounting hook from the balance and the prices.
+func NewAccounting(balance Balance, prices Prices) *Accounting {
+	return &Accounting{
+		Balance: balance,
+		Prices:  prices,
+	}
+}
+
+// Send accounts the price of a message sent to the peer.
+func (a *Accounting) Send(peer *Peer, size uint32, msg interface{}) error {
+	price := a.Price(msg)
+	if price == nil {
+		return nil
+	}
+	amount := price.For(Sender, size)
+	err := a.Add(amount, peer)
+	a.doMetrics(amount, size, err)
+	return err
+}
+
+// Receive accounts the price of a message received from the peer.
+func (a *Accounting) Receive(peer *Peer, size uint32, msg interface{}) error {
+	price := a.Price(msg)
+	if price == nil {
+		return nil
+	}
+	amount := price.For(Receiver, size)
+	err := a.Add(amount, peer)
+	a.doMetrics(amount, size, err)
+	return err
+}
+
+// doMetrics records the accounted amount, the message size and the peer drops.
+func (a *Accounting) doMetrics(amount int64, size uint32, err error) {
+	if err != nil {
+		mPeerDrops.Inc(1)
+		return
+	}
+	if amount < 0 {
+		mBalanceDebit.Inc(-amount)
+		mBytesDebit.Inc(int64(size))
+		mMsgDebit.Inc(1)
+	} else {
+		mBalanceCredit.Inc(amount)
+		mBytesCredit.Inc(int64(size))
+		mMsgCredit.Inc(1)
+	}
+}
@@ -0,0 +1,146 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package protocols
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// dummyBalance keeps a single balance, refusing to go beyond a limit.
+type dummyBalance struct {
+	amount int64
+	limit  int64
+}
+
+func (b *dummyBalance) Add(amount int64, peer *Peer) error {
+	if b.amount+amount > b.limit || b.amount+amount < -b.limit {
+		return errors.New("balance limit exceeded")
+	}
+	b.amount += amount
+	return nil
+}
+
+type perByteMsg struct{ Data []byte }
+type senderPaysMsg struct{ Data []byte }
+type freeMsg struct{ Data []byte }
+
+// dummyPrices charges the receiver per byte for perByteMsg, and the sender a
+// fixed price for senderPaysMsg.
+type dummyPrices struct{}
+
+func (dummyPrices) Price(msg interface{}) *Price {
+	switch msg.(type) {
+	case *perByteMsg:
+		return &Price{Value: 2, PerByte: true, Payer: Receiver}
+	case *senderPaysMsg:
+		return &Price{Value: 100, Payer: Sender}
+	}
+	return nil
+}
+
+func TestPriceFor(t *testing.T) {
+	tests := []struct {
+		price  Price
+		payer  Payer
+		size   uint32
+		amount int64
+	}{
+		{Price{Value: 10, Payer: Sender}, Sender, 50, -10},
+		{Price{Value: 10, Payer: Sender}, Receiver, 50, 10},
+		{Price{Value: 10, PerByte: true, Payer: Receiver}, Receiver, 50, -500},
+		{Price{Value: 10, PerByte: true, Payer: Receiver}, Sender, 50, 500},
+	}
+	for i, tt := range tests {
+		if amount := tt.price.For(tt.payer, tt.size); amount != tt.amount {
+			t.Errorf("test %d: amount mismatch: have %d, want %d", i, amount, tt.amount)
+		}
+	}
+}
+
+func TestAccountingHook(t *testing.T) {
+	balance := &dummyBalance{limit: 1000}
+	spec := &Spec{
+		Name:       "test",
+		Version:    1,
+		MaxMsgSize: 1024,
+		Messages:   []interface{}{perByteMsg{}, senderPaysMsg{}, freeMsg{}},
+		Hook:       NewAccounting(balance, dummyPrices{}),
+	}
+	local, remote := p2p.MsgPipe()
+	defer remote.Close()
+
+	peer := NewPeer(p2p.NewPeer(discover.NodeID{}, "test", nil), local, spec)
+	go func() {
+		for {
+			msg, err := remote.ReadMsg()
+			if err != nil {
+				return
+			}
+			msg.Discard()
+		}
+	}()
+	// Sending a message paid by the receiver credits the local node
+	msg := &perByteMsg{Data: make([]byte, 10)}
+	size, _ := rlp.EncodeToBytes(msg)
+	if err := peer.Send(context.Background(), msg); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if want := 2 * int64(len(size)); balance.amount != want {
+		t.Fatalf("balance mismatch after send: have %d, want %d", balance.amount, want)
+	}
+	// Free messages are not accounted
+	if err := peer.Send(context.Background(), &freeMsg{}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	// Sending a message paid by the sender debits the local node
+	balance.amount = 0
+	if err := peer.Send(context.Background(), &senderPaysMsg{}); err != nil {
+		t.Fatalf("failed to send: %v", err)
+	}
+	if balance.amount != -100 {
+		t.Fatalf("balance mismatch after send: have %d, want -100", balance.amount)
+	}
+	// Receiving a message paid by the sender credits the local node
+	receive := func(msg interface{}) error {
+		errc := make(chan error, 1)
+		go func() {
+			errc <- peer.handleIncoming(func(ctx context.Context, msg interface{}) error { return nil })
+		}()
+		payload, _ := rlp.EncodeToBytes(msg)
+		code, _ := spec.GetCode(msg)
+		if err := p2p.Send(remote, code, WrappedMsg{Size: uint32(len(payload)), Payload: payload}); err != nil {
+			t.Fatalf("failed to send: %v", err)
+		}
+		return <-errc
+	}
+	if err := receive(&senderPaysMsg{}); err != nil {
+		t.Fatalf("failed to receive: %v", err)
+	}
+	if balance.amount != 0 {
+		t.Fatalf("balance mismatch after receive: have %d, want 0", balance.amount)
+	}
+	// Exceeding the balance limit fails the message handling
+	if err := receive(&perByteMsg{Data: make([]byte, 600)}); err == nil {
+		t.Fatalf("message over the balance limit accepted")
+	}
+}
@@ -141,6 +141,10 @@ type Spec struct {
 	// each message must have a single unique data type
 	Messages []interface{}
 
+	// Hook, if set, is called on every message sent and received, for example
+	// to account for the messages exchanged with a peer
+	Hook Hook
+
 	initOnce sync.Once
 	codes    map[reflect.Type]uint64
 	types    map[uint64]reflect.Type
@@ -278,6 +282,12 @@ func (p *Peer) Send(ctx context.Context, msg interface{}) error {
 	if !found {
 		return errorf(ErrInvalidMsgType, "%v", code)
 	}
+	if p.spec.Hook != nil {
+		if err := p.spec.Hook.Send(p, wmsg.Size, msg); err != nil {
+			p.Drop(err)
+			return err
+		}
+	}
 	return p2p.Send(p.rw, code, wmsg)
 }
 
@@ -336,6 +346,12 @@ func (p *Peer) handleIncoming(handle func(ctx context.Context, msg interface{})
 		return errorf(ErrDecode, "<= %v: %v", msg, err)
 	}
 
+	if p.spec.Hook != nil {
+		if err := p.spec.Hook.Receive(p, wmsg.Size, val); err != nil {
+			return err
+		}
+	}
+
 	// call the registered handler callbacks
 	// a registered callback take the decoded message as argument as an interface
 	// which the handler is supposed to cast to the appropriate type
@@ -0,0 +1,154 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+const (
+	// Reputation scores are kept within these bounds so that neither a long
+	// history of good behaviour nor a burst of bad behaviour dominates forever.
+	maxPeerScore = 100
+	minPeerScore = -100
+
+	// Scores decay towards zero, halving once every scoreHalfLife.
+	scoreHalfLife = 6 * time.Hour
+
+	// Dynamic dial candidates scoring below minDialScore are not dialed.
+	minDialScore = -30
+)
+
+// ScoreEvent is a protocol level event affecting the reputation of a peer.
+type ScoreEvent int
+
+const (
+	ScoreGoodResponse ScoreEvent = iota // Peer delivered useful data
+	ScoreUselessData                    // Peer sent data that was not requested or could not be used
+	ScoreTimeout                        // Peer failed to answer a request in time
+	ScoreInvalidBlock                   // Peer propagated an invalid block
+)
+
+// scoreEventDeltas are the score adjustments of the individual events.
+var scoreEventDeltas = map[ScoreEvent]int{
+	ScoreGoodResponse: 1,
+	ScoreUselessData:  -5,
+	ScoreTimeout:      -10,
+	ScoreInvalidBlock: -50,
+}
+
+func (ev ScoreEvent) String() string {
+	switch ev {
+	case ScoreGoodResponse:
+		return "good response"
+	case ScoreUselessData:
+		return "useless data"
+	case ScoreTimeout:
+		return "timeout"
+	case ScoreInvalidBlock:
+		return "invalid block"
+	default:
+		return "unknown score event"
+	}
+}
+
+// scoreStore persists peer scores. It is implemented by the discovery table,
+// which keeps them in the node database.
+type scoreStore interface {
+	PeerScore(id discover.NodeID) (int, time.Time)
+	SetPeerScore(id discover.NodeID, score int, updated time.Time) error
+}
+
+// peerScore is a score along with the time it was last changed.
+type peerScore struct {
+	value   int
+	updated time.Time
+}
+
+// decayed returns the score value at the given time.
+func (s peerScore) decayed(now time.Time) int {
+	elapsed := now.Sub(s.updated)
+	if s.value == 0 || elapsed <= 0 {
+		return s.value
+	}
+	return int(float64(s.value) * math.Pow(0.5, float64(elapsed)/float64(scoreHalfLife)))
+}
+
+// peerScores tracks the reputation scores of remote nodes. Scores are cached
+// in memory and written through to the store, if one is set.
+type peerScores struct {
+	store scoreStore
+	now   func() time.Time
+
+	mu     sync.Mutex
+	scores map[discover.NodeID]peerScore
+}
+
+func newPeerScores(store scoreStore) *peerScores {
+	return &peerScores{
+		store:  store,
+		now:    time.Now,
+		scores: make(map[discover.NodeID]peerScore),
+	}
+}
+
+// score returns the current score of the given node.
+func (ps *peerScores) score(id discover.NodeID) int {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return ps.get(id).decayed(ps.now())
+}
+
+// add adjusts the score of the given node according to the event.
+func (ps *peerScores) add(id discover.NodeID, ev ScoreEvent) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	now := ps.now()
+	value := ps.get(id).decayed(now) + scoreEventDeltas[ev]
+	if value > maxPeerScore {
+		value = maxPeerScore
+	}
+	if value < minPeerScore {
+		value = minPeerScore
+	}
+	ps.scores[id] = peerScore{value: value, updated: now}
+	if ps.store != nil {
+		if err := ps.store.SetPeerScore(id, value, now); err != nil {
+			log.Warn("Failed to store peer score", "id", id, "err", err)
+		}
+	}
+}
+
+// get returns the cached score of a node, falling back to the store for nodes
+// which haven't been scored in this session. The lock must be held.
+func (ps *peerScores) get(id discover.NodeID) peerScore {
+	if s, ok := ps.scores[id]; ok {
+		return s
+	}
+	var s peerScore
+	if ps.store != nil {
+		s.value, s.updated = ps.store.PeerScore(id)
+	}
+	return s
+}
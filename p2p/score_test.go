@@ -0,0 +1,73 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package p2p
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/discover"
+)
+
+// mapScoreStore is a scoreStore backed by a map.
+type mapScoreStore map[discover.NodeID]peerScore
+
+func (s mapScoreStore) PeerScore(id discover.NodeID) (int, time.Time) {
+	return s[id].value, s[id].updated
+}
+
+func (s mapScoreStore) SetPeerScore(id discover.NodeID, score int, updated time.Time) error {
+	s[id] = peerScore{value: score, updated: updated}
+	return nil
+}
+
+func TestPeerScores(t *testing.T) {
+	var (
+		now    = time.Unix(1000000, 0)
+		store  = make(mapScoreStore)
+		scores = newPeerScores(store)
+		id     = uintID(1)
+	)
+	scores.now = func() time.Time { return now }
+
+	// Events adjust the score within its bounds.
+	scores.add(id, ScoreGoodResponse)
+	scores.add(id, ScoreTimeout)
+	if s := scores.score(id); s != -9 {
+		t.Errorf("wrong score: got %d, want %d", s, -9)
+	}
+	for i := 0; i < 5; i++ {
+		scores.add(id, ScoreInvalidBlock)
+	}
+	if s := scores.score(id); s != minPeerScore {
+		t.Errorf("score not bounded: got %d, want %d", s, minPeerScore)
+	}
+	// The score decays over time.
+	now = now.Add(scoreHalfLife)
+	if s := scores.score(id); s != minPeerScore/2 {
+		t.Errorf("wrong decayed score: got %d, want %d", s, minPeerScore/2)
+	}
+	// Scores are persisted in the store.
+	if s, _ := store.PeerScore(id); s != minPeerScore {
+		t.Errorf("wrong stored score: got %d, want %d", s, minPeerScore)
+	}
+	restored := newPeerScores(store)
+	restored.now = scores.now
+	if s := restored.score(id); s != minPeerScore/2 {
+		t.Errorf("wrong restored score: got %d, want %d", s, minPeerScore/2)
+	}
+}
@@ -32,6 +32,8 @@ import (
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/discover"
 	"github.com/ethereum/go-ethereum/p2p/discv5"
+	"github.com/ethereum/go-ethereum/p2p/dnsdisc"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 	"github.com/ethereum/go-ethereum/p2p/nat"
 	"github.com/ethereum/go-ethereum/p2p/netutil"
 )
@@ -81,6 +83,17 @@ type Config struct {
 	// protocol should be started or not.
 	DiscoveryV5 bool `toml:",omitempty"`
 
+	// DiscoveryENR specifies whether the ENR based discovery protocol should be
+	// started alongside v4 discovery, sharing its UDP port. When enabled, nodes
+	// to dial are found through it and filtered by the NodeFilter of protocols.
+	DiscoveryENR bool `toml:",omitempty"`
+
+	// DNSNodeLists contains the enrtree:// URLs of node lists published in DNS.
+	// The nodes of the lists and of the lists linked from them are used as dial
+	// candidates unless dialing is disabled. The lists don't depend on discovery
+	// and are also used if NoDiscovery is set.
+	DNSNodeLists []string `toml:",omitempty"`
+
 	// Name sets the node name of this server.
 	// Use common.MakeName to create a name that follows existing conventions.
 	Name string `toml:"-"`
@@ -162,6 +175,11 @@ type Server struct {
 	ourHandshake *protoHandshake
 	lastLookup   time.Time
 	DiscV5       *discv5.Network
+	ntabENR      *discover.UDPv5
+	dialtab      discoverTable // table dial candidates are found through
+	nodelists    *dnsdisc.NodeSource
+	scores       *peerScores
+	localnode    *discover.LocalNode
 
 	// These are for Peers, PeerCount (and nothing else).
 	peerOp     chan peerOpFunc
@@ -390,6 +408,39 @@ func (srv *Server) Stop() {
 	srv.loopWG.Wait()
 }
 
+// LocalNode returns the producer of the local node record advertised through
+// the ENR based discovery protocol, or nil if the protocol isn't running.
+func (srv *Server) LocalNode() *discover.LocalNode {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	return srv.localnode
+}
+
+// nodeFilter returns the filter selecting discovered nodes to dial, accepting
+// a node if any of the protocols accepts it. It returns nil if there is no
+// protocol restricting the nodes it wants to be dialed.
+func (srv *Server) nodeFilter() func(*discover.Node) bool {
+	var filters []func(*discover.Node) bool
+	for _, p := range srv.Protocols {
+		if p.NodeFilter == nil {
+			return nil
+		}
+		filters = append(filters, p.NodeFilter)
+	}
+	if len(filters) == 0 {
+		return nil
+	}
+	return func(n *discover.Node) bool {
+		for _, filter := range filters {
+			if filter(n) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // sharedUDPConn implements a shared connection. Write sends messages to the underlying connection while read returns
 // messages that were found unprocessable and sent to the unhandled channel by the primary listener.
 type sharedUDPConn struct {
@@ -459,6 +510,14 @@ func (srv *Server) Start() (err error) {
 		unhandled chan discover.ReadPacket
 	)
 
+	if !srv.NoDiscovery && srv.DiscoveryENR {
+		srv.localnode = discover.NewLocalNode(srv.PrivateKey)
+		for _, p := range srv.Protocols {
+			for _, e := range p.Attributes {
+				srv.localnode.Set(e)
+			}
+		}
+	}
 	if !srv.NoDiscovery || srv.DiscoveryV5 {
 		addr, err := net.ResolveUDPAddr("udp", srv.ListenAddr)
 		if err != nil {
@@ -476,11 +535,14 @@ func (srv *Server) Start() (err error) {
 			// TODO: react to external IP changes over time.
 			if ext, err := srv.NAT.ExternalIP(); err == nil {
 				realaddr = &net.UDPAddr{IP: ext, Port: realaddr.Port}
+				if srv.localnode != nil {
+					srv.localnode.SetStaticIP(ext)
+				}
 			}
 		}
 	}
 
-	if !srv.NoDiscovery && srv.DiscoveryV5 {
+	if !srv.NoDiscovery && (srv.DiscoveryV5 || srv.DiscoveryENR) {
 		unhandled = make(chan discover.ReadPacket, 100)
 		sconn = &sharedUDPConn{conn, unhandled}
 	}
@@ -502,6 +564,31 @@ func (srv *Server) Start() (err error) {
 		srv.ntab = ntab
 	}
 
+	if !srv.NoDiscovery && srv.DiscoveryENR {
+		// The ENR based protocol reads the packets not handled by v4, passing
+		// on the ones it can't handle to topic discovery.
+		var (
+			enrconn      = sconn
+			enrunhandled chan discover.ReadPacket
+		)
+		if srv.DiscoveryV5 {
+			enrunhandled = make(chan discover.ReadPacket, 100)
+			sconn = &sharedUDPConn{conn, enrunhandled}
+		}
+		cfg := discover.Config{
+			PrivateKey:   srv.PrivateKey,
+			AnnounceAddr: realaddr,
+			NetRestrict:  srv.NetRestrict,
+			Bootnodes:    srv.BootstrapNodes,
+			Unhandled:    enrunhandled,
+		}
+		ntab, err := discover.ListenV5(enrconn, srv.localnode, cfg)
+		if err != nil {
+			return err
+		}
+		srv.ntabENR = ntab
+	}
+
 	if srv.DiscoveryV5 {
 		var (
 			ntab *discv5.Network
@@ -521,8 +608,27 @@ func (srv *Server) Start() (err error) {
 		srv.DiscV5 = ntab
 	}
 
+	// DNS node lists
+	if len(srv.DNSNodeLists) > 0 && !srv.NoDial {
+		client := dnsdisc.NewClient(dnsdisc.Config{})
+		nodelists, err := client.NewNodeSource(srv.DNSNodeLists...)
+		if err != nil {
+			return err
+		}
+		srv.nodelists = nodelists
+	}
+
+	// peer reputation, persisted in the node database if discovery is enabled
+	if tab, ok := srv.ntab.(*discover.Table); ok {
+		srv.scores = newPeerScores(tab)
+	} else {
+		srv.scores = newPeerScores(nil)
+	}
+
 	dynPeers := srv.maxDialedConns()
-	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.ntab, dynPeers, srv.NetRestrict)
+	srv.dialtab = srv.dialTable()
+	dialer := newDialState(srv.StaticNodes, srv.BootstrapNodes, srv.dialtab, dynPeers, srv.NetRestrict)
+	dialer.scores = srv.scores
 
 	// handshake
 	srv.ourHandshake = &protoHandshake{Version: baseProtocolVersion, Name: srv.Name, ID: discover.PubkeyID(&srv.PrivateKey.PublicKey)}
@@ -545,6 +651,27 @@ func (srv *Server) Start() (err error) {
 	return nil
 }
 
+// dialTable returns the discovery table the dialer finds nodes through,
+// extended with the nodes of the DNS node lists and filtered by the node
+// filters of the protocols.
+func (srv *Server) dialTable() discoverTable {
+	ntab := srv.ntab
+	if srv.ntabENR != nil {
+		ntab = srv.ntabENR
+	}
+	if srv.nodelists != nil {
+		self := discover.NewNode(discover.PubkeyID(&srv.PrivateKey.PublicKey), nil, 0, 0)
+		ntab = nodeListTable{ntab, self, srv.nodelists}
+	}
+	if ntab == nil {
+		return nil
+	}
+	if filter := srv.nodeFilter(); filter != nil {
+		return filterTable{ntab, filter}
+	}
+	return ntab
+}
+
 func (srv *Server) startListening() error {
 	// Launch the TCP listener.
 	listener, err := net.Listen("tcp", srv.ListenAddr)
@@ -554,6 +681,9 @@ func (srv *Server) startListening() error {
 	laddr := listener.Addr().(*net.TCPAddr)
 	srv.ListenAddr = laddr.String()
 	srv.listener = listener
+	if srv.localnode != nil {
+		srv.localnode.Set(enr.TCP(laddr.Port))
+	}
 	srv.loopWG.Add(1)
 	go srv.listenLoop()
 	// Map the TCP listening port if NAT is configured.
@@ -579,6 +709,7 @@ func (srv *Server) run(dialstate dialer) {
 	var (
 		peers        = make(map[discover.NodeID]*Peer)
 		inboundCount = 0
+		evicted      = make(map[discover.NodeID]bool) // inbound peers disconnected to free a slot
 		trusted      = make(map[discover.NodeID]bool, len(srv.TrustedNodes))
 		taskdone     = make(chan task, maxActiveDialTasks)
 		runningTasks []task
@@ -682,18 +813,23 @@ running:
 				c.flags |= trustedConn
 			}
 			// TODO: track in-progress inbound node IDs (pre-Peer) to avoid dialing them.
+			err := srv.encHandshakeChecks(peers, evicted, inboundCount, c)
+			if err == DiscTooManyPeers && srv.evictInbound(peers, evicted, c) {
+				err = srv.encHandshakeChecks(peers, evicted, inboundCount, c)
+			}
 			select {
-			case c.cont <- srv.encHandshakeChecks(peers, inboundCount, c):
+			case c.cont <- err:
 			case <-srv.quit:
 				break running
 			}
 		case c := <-srv.addpeer:
 			// At this point the connection is past the protocol handshake.
 			// Its capabilities are known and the remote identity is verified.
-			err := srv.protoHandshakeChecks(peers, inboundCount, c)
+			err := srv.protoHandshakeChecks(peers, evicted, inboundCount, c)
 			if err == nil {
 				// The handshakes are done and it passed all checks.
 				p := newPeer(c, srv.Protocols)
+				p.scores = srv.scores
 				// If message events are enabled, pass the peerFeed
 				// to the peer
 				if srv.EnableMsgEvents {
@@ -720,6 +856,7 @@ running:
 			d := common.PrettyDuration(mclock.Now() - pd.created)
 			pd.log.Debug("Removing p2p peer", "duration", d, "peers", len(peers)-1, "req", pd.requested, "err", pd.err)
 			delete(peers, pd.ID())
+			delete(evicted, pd.ID())
 			if pd.Inbound() {
 				inboundCount--
 			}
@@ -732,6 +869,12 @@ running:
 	if srv.ntab != nil {
 		srv.ntab.Close()
 	}
+	if srv.ntabENR != nil {
+		srv.ntabENR.Close()
+	}
+	if srv.nodelists != nil {
+		srv.nodelists.Close()
+	}
 	if srv.DiscV5 != nil {
 		srv.DiscV5.Close()
 	}
@@ -749,21 +892,23 @@ running:
 	}
 }
 
-func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, c *conn) error {
+func (srv *Server) protoHandshakeChecks(peers map[discover.NodeID]*Peer, evicted map[discover.NodeID]bool, inboundCount int, c *conn) error {
 	// Drop connections with no matching protocols.
 	if len(srv.Protocols) > 0 && countMatchingProtocols(srv.Protocols, c.caps) == 0 {
 		return DiscUselessPeer
 	}
 	// Repeat the encryption handshake checks because the
 	// peer set might have changed between the handshakes.
-	return srv.encHandshakeChecks(peers, inboundCount, c)
+	return srv.encHandshakeChecks(peers, evicted, inboundCount, c)
 }
 
-func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCount int, c *conn) error {
+// encHandshakeChecks checks whether the connection may be added to the peer
+// set. Evicted peers are still in the set but no longer occupy a slot.
+func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, evicted map[discover.NodeID]bool, inboundCount int, c *conn) error {
 	switch {
-	case !c.is(trustedConn|staticDialedConn) && len(peers) >= srv.MaxPeers:
+	case !c.is(trustedConn|staticDialedConn) && len(peers)-len(evicted) >= srv.MaxPeers:
 		return DiscTooManyPeers
-	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount >= srv.maxInboundConns():
+	case !c.is(trustedConn) && c.is(inboundConn) && inboundCount-len(evicted) >= srv.maxInboundConns():
 		return DiscTooManyPeers
 	case peers[c.id] != nil:
 		return DiscAlreadyConnected
@@ -774,12 +919,42 @@ func (srv *Server) encHandshakeChecks(peers map[discover.NodeID]*Peer, inboundCo
 	}
 }
 
+// evictInbound makes room for an untrusted inbound connection by disconnecting
+// the inbound peer with the lowest reputation. Only peers with a negative score
+// lower than the score of the new connection are evicted. It reports whether a
+// peer was evicted.
+func (srv *Server) evictInbound(peers map[discover.NodeID]*Peer, evicted map[discover.NodeID]bool, c *conn) bool {
+	if srv.scores == nil || c.is(trustedConn) || !c.is(inboundConn) {
+		return false
+	}
+	var (
+		candidate  = srv.scores.score(c.id)
+		worst      *Peer
+		worstScore = 0
+	)
+	for id, p := range peers {
+		if evicted[id] || !p.Inbound() || p.rw.is(trustedConn) {
+			continue
+		}
+		if score := srv.scores.score(id); score < worstScore && score < candidate {
+			worst, worstScore = p, score
+		}
+	}
+	if worst == nil {
+		return false
+	}
+	worst.log.Debug("Evicting inbound peer with low score", "score", worstScore, "new", c.id, "newscore", candidate)
+	evicted[worst.ID()] = true
+	worst.Disconnect(DiscTooManyPeers)
+	return true
+}
+
 func (srv *Server) maxInboundConns() int {
 	return srv.MaxPeers - srv.maxDialedConns()
 }
 
 func (srv *Server) maxDialedConns() int {
-	if srv.NoDiscovery || srv.NoDial {
+	if srv.NoDial || (srv.NoDiscovery && len(srv.DNSNodeLists) == 0) {
 		return 0
 	}
 	r := srv.DialRatio
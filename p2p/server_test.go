@@ -29,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/crypto/sha3"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/enr"
 )
 
 func init() {
@@ -122,6 +123,40 @@ func TestServerListen(t *testing.T) {
 	}
 }
 
+// Tests that the local node record advertises the listening port and the
+// protocol attributes when the ENR based discovery protocol is enabled.
+func TestServerLocalNode(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			Name:         "test",
+			MaxPeers:     10,
+			ListenAddr:   "127.0.0.1:0",
+			PrivateKey:   newkey(),
+			DiscoveryENR: true,
+			Protocols:    []Protocol{{Name: "les", Attributes: []enr.Entry{enr.WithEntry("les", uint(10))}}},
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	var (
+		record   = srv.LocalNode().Record()
+		tcp      enr.TCP
+		capacity uint
+	)
+	if err := record.Load(&tcp); err != nil || int(tcp) != srv.listener.Addr().(*net.TCPAddr).Port {
+		t.Errorf("tcp port mismatch: have %d (%v), want %v", tcp, err, srv.listener.Addr())
+	}
+	if err := record.Load(enr.WithEntry("les", &capacity)); err != nil || capacity != 10 {
+		t.Errorf("protocol attribute mismatch: have %d (%v), want %d", capacity, err, 10)
+	}
+	if id := discover.PubkeyID(&srv.PrivateKey.PublicKey); srv.LocalNode().Node().ID != id {
+		t.Errorf("local node id mismatch: have %x, want %x", srv.LocalNode().Node().ID[:8], id[:8])
+	}
+}
+
 func TestServerDial(t *testing.T) {
 	// run a one-shot TCP server to handle the connection.
 	listener, err := net.Listen("tcp", "127.0.0.1:0")
@@ -407,6 +442,65 @@ func TestServerAtCap(t *testing.T) {
 	}
 }
 
+// This test checks that inbound peers with a bad reputation are evicted to make
+// room for new inbound connections.
+func TestServerEvictLowScore(t *testing.T) {
+	srv := &Server{
+		Config: Config{
+			PrivateKey: newkey(),
+			MaxPeers:   10,
+			NoDial:     true,
+		},
+	}
+	if err := srv.Start(); err != nil {
+		t.Fatalf("could not start: %v", err)
+	}
+	defer srv.Stop()
+
+	newconn := func(id discover.NodeID) *conn {
+		fd, _ := net.Pipe()
+		tx := newTestTransport(id, fd)
+		return &conn{fd: fd, transport: tx, flags: inboundConn, id: id, cont: make(chan error)}
+	}
+
+	// Fill up the peer set, one of the peers misbehaving.
+	var badID discover.NodeID
+	for i := 0; i < 10; i++ {
+		id := randomID()
+		if err := srv.checkpoint(newconn(id), srv.addpeer); err != nil {
+			t.Fatalf("could not add conn %d: %v", i, err)
+		}
+		if i == 0 {
+			badID = id
+			srv.scores.add(id, ScoreInvalidBlock)
+		}
+	}
+	// A new connection should evict the misbehaving peer.
+	c := newconn(randomID())
+	if err := srv.checkpoint(c, srv.posthandshake); err != nil {
+		t.Fatal("unexpected error for insert:", err)
+	}
+	if err := srv.checkpoint(c, srv.addpeer); err != nil {
+		t.Fatal("unexpected error for add:", err)
+	}
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var found bool
+		for _, p := range srv.Peers() {
+			found = found || p.ID() == badID
+		}
+		if !found {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("misbehaving peer was not evicted")
+		}
+	}
+	// No peer left to evict, the next connection is rejected.
+	if err := srv.checkpoint(newconn(randomID()), srv.posthandshake); err != DiscTooManyPeers {
+		t.Error("wrong error for insert:", err)
+	}
+}
+
 func TestServerPeerLimits(t *testing.T) {
 	srvkey := newkey()
 
@@ -17,10 +17,13 @@
 package params
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto/sha3"
 )
 
 // Genesis hashes to enforce below configs on.
@@ -111,16 +114,16 @@ var (
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
+	AllEthashProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, new(EthashConfig), nil}
 
 	// AllCliqueProtocolChanges contains every protocol change (EIPs) introduced
 	// and accepted by the Ethereum core developers into the Clique consensus.
 	//
 	// This configuration is intentionally not using keyed fields to force anyone
 	// adding flags to the config to also have to set these fields.
-	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
+	AllCliqueProtocolChanges = &ChainConfig{big.NewInt(1337), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, nil, &CliqueConfig{Period: 0, Epoch: 30000}}
 
-	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, new(EthashConfig), nil}
+	TestChainConfig = &ChainConfig{big.NewInt(1), big.NewInt(0), nil, false, big.NewInt(0), common.Hash{}, big.NewInt(0), big.NewInt(0), big.NewInt(0), nil, nil, nil, nil, new(EthashConfig), nil}
 	TestRules       = TestChainConfig.Rules(new(big.Int))
 )
 
@@ -129,13 +132,40 @@ var (
 // used to start light syncing from this checkpoint and avoid downloading the
 // entire header chain while still being able to securely access old headers/logs.
 type TrustedCheckpoint struct {
-	Name         string      `json:"-"`
+	Name         string      `json:"-" rlp:"-"`
 	SectionIndex uint64      `json:"sectionIndex"`
 	SectionHead  common.Hash `json:"sectionHead"`
 	CHTRoot      common.Hash `json:"chtRoot"`
 	BloomRoot    common.Hash `json:"bloomRoot"`
 }
 
+// Hash returns the hash of the checkpoint as registered in a checkpoint oracle
+// contract: keccak256(sectionIndex, sectionHead, chtRoot, bloomRoot).
+func (c *TrustedCheckpoint) Hash() common.Hash {
+	var (
+		index = make([]byte, 8)
+		hash  common.Hash
+	)
+	binary.BigEndian.PutUint64(index, c.SectionIndex)
+
+	hasher := sha3.NewKeccak256()
+	hasher.Write(index)
+	hasher.Write(c.SectionHead.Bytes())
+	hasher.Write(c.CHTRoot.Bytes())
+	hasher.Write(c.BloomRoot.Bytes())
+	hasher.Sum(hash[:0])
+	return hash
+}
+
+// CheckpointOracleConfig is the address of a checkpoint oracle contract along
+// with the admins allowed to sign checkpoints and the number of signatures
+// needed for a light client to accept one.
+type CheckpointOracleConfig struct {
+	Address   common.Address   `json:"address"`
+	Signers   []common.Address `json:"signers"`
+	Threshold uint64           `json:"threshold"`
+}
+
 // ChainConfig is the core config which determines the blockchain settings.
 //
 // ChainConfig is stored in the database on a per block basis. This means
@@ -160,6 +190,7 @@ type ChainConfig struct {
 	ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
 	EWASMBlock          *big.Int `json:"ewasmBlock,omitempty"`          // EWASM switch block (nil = no fork, 0 = already activated)
 	ProgpowBlock        *big.Int `json:"progpowBlock,omitempty"`        // Progpow switch block (nil = not active, 0 = already activated)
+	EthashBlock         *big.Int `json:"ethashBlock,omitempty"`         // Clique to ethash sealing switch block (nil = no switch, clique only)
 
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
@@ -178,6 +209,19 @@ func (c *EthashConfig) String() string {
 type CliqueConfig struct {
 	Period uint64 `json:"period"` // Number of seconds between blocks to enforce
 	Epoch  uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
+
+	Checkpoint *CliqueCheckpoint `json:"checkpoint,omitempty"` // Trusted signer-set checkpoint to anchor snapshots at
+}
+
+// CliqueCheckpoint is a signer-set checkpoint of a proof-of-authority chain,
+// attested by a majority of the signers authorized at the checkpoint block. It
+// is used as a trusted anchor to avoid reconstructing the voting snapshots from
+// the genesis block or an untrusted epoch transition.
+type CliqueCheckpoint struct {
+	Number     uint64           `json:"number"`     // Block number of the checkpoint
+	Hash       common.Hash      `json:"hash"`       // Block hash of the checkpoint
+	Signers    []common.Address `json:"signers"`    // Authorized signers after the checkpoint block (ascending order)
+	Signatures []hexutil.Bytes  `json:"signatures"` // Signatures of the signers attesting the checkpoint
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -189,6 +233,8 @@ func (c *CliqueConfig) String() string {
 func (c *ChainConfig) String() string {
 	var engine interface{}
 	switch {
+	case c.Clique != nil && c.EthashBlock != nil:
+		engine = fmt.Sprintf("%v->ethash", c.Clique)
 	case c.Ethash != nil:
 		engine = c.Ethash
 	case c.Clique != nil:
@@ -196,7 +242,7 @@ func (c *ChainConfig) String() string {
 	default:
 		engine = "unknown"
 	}
-	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Progpow: %v Engine: %v}",
+	return fmt.Sprintf("{ChainID: %v Homestead: %v DAO: %v DAOSupport: %v EIP150: %v EIP155: %v EIP158: %v Byzantium: %v Constantinople: %v Progpow: %v Ethash: %v Engine: %v}",
 		c.ChainID,
 		c.HomesteadBlock,
 		c.DAOForkBlock,
@@ -207,6 +253,7 @@ func (c *ChainConfig) String() string {
 		c.ByzantiumBlock,
 		c.ConstantinopleBlock,
 		c.ProgpowBlock,
+		c.EthashBlock,
 		engine,
 	)
 }
@@ -251,6 +298,12 @@ func (c *ChainConfig) IsEWASM(num *big.Int) bool {
 	return isForked(c.EWASMBlock, num)
 }
 
+// IsEthash returns whether num is either equal to the clique to ethash switch
+// block or greater. Chains without a switch block never transition to ethash.
+func (c *ChainConfig) IsEthash(num *big.Int) bool {
+	return isForked(c.EthashBlock, num)
+}
+
 // GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
@@ -319,6 +372,9 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	if isForkIncompatible(c.EWASMBlock, newcfg.EWASMBlock, head) {
 		return newCompatError("ewasm fork block", c.EWASMBlock, newcfg.EWASMBlock)
 	}
+	if isForkIncompatible(c.EthashBlock, newcfg.EthashBlock, head) {
+		return newCompatError("ethash switch block", c.EthashBlock, newcfg.EthashBlock)
+	}
 	return nil
 }
 
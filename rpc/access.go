@@ -0,0 +1,291 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	lru "github.com/hashicorp/golang-lru"
+)
+
+const (
+	// maxRateLimiters is the number of per-client rate limiters to track, the
+	// least recently used ones being dropped beyond it.
+	maxRateLimiters = 4096
+
+	// jwtIssuedAtWindow is how long a JWT without an expiry is accepted for after
+	// the time it was issued at.
+	jwtIssuedAtWindow = time.Minute
+)
+
+var (
+	// errUnauthorized is returned if a client doesn't present a valid bearer
+	// token to an RPC server requiring authentication.
+	errUnauthorized = errors.New("unauthorized")
+
+	// errRateLimited is returned if a client exceeds its request rate allowance.
+	errRateLimited = errors.New("request rate limit exceeded")
+)
+
+// AccessPolicy restricts the methods callable on an RPC server, authenticates
+// the clients calling them and limits the rate and size of their requests.
+//
+// Methods are matched either by their full name (e.g. "debug_traceBlock"), by
+// a namespace wildcard (e.g. "debug_*") or by the catch-all "*".
+type AccessPolicy struct {
+	Allow []string `json:"allow,omitempty"` // Methods callable by clients (empty = all methods)
+	Deny  []string `json:"deny,omitempty"`  // Methods not callable by clients, overriding the allow list
+
+	BatchLimit int     `json:"batchLimit,omitempty"` // Maximum number of requests in a batch (0 = unlimited)
+	RateLimit  float64 `json:"rateLimit,omitempty"`  // Maximum number of requests per second per client (0 = unlimited)
+	RateBurst  int     `json:"rateBurst,omitempty"`  // Number of requests a client may burst above the rate limit
+
+	Clients   map[string]*ClientPolicy `json:"clients,omitempty"`   // Authenticated clients by name (empty = no authentication)
+	JWTSecret string                   `json:"jwtSecret,omitempty"` // HMAC secret of JWT bearer tokens, whose subject names the client, with an "exp" or recent "iat" claim
+}
+
+// ClientPolicy contains the credentials of an authenticated client, along with
+// any restrictions overriding the ones of the access policy.
+type ClientPolicy struct {
+	Token string   `json:"token,omitempty"` // Static bearer token of the client (empty = JWT only)
+	Allow []string `json:"allow,omitempty"` // Methods callable by the client (empty = inherit)
+	Deny  []string `json:"deny,omitempty"`  // Methods not callable by the client, in addition to the inherited ones
+
+	RateLimit float64 `json:"rateLimit,omitempty"` // Maximum number of requests per second (0 = inherit)
+	RateBurst int     `json:"rateBurst,omitempty"` // Number of requests the client may burst above the rate limit
+}
+
+// LoadAccessPolicy reads a JSON encoded access policy from the given file.
+func LoadAccessPolicy(file string) (*AccessPolicy, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	policy := new(AccessPolicy)
+	if err := json.Unmarshal(blob, policy); err != nil {
+		return nil, err
+	}
+	if _, err := newAccessControl(policy); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// clientKey is the context key under which the authenticated client is stored.
+type clientKey struct{}
+
+// rpcClient is the identity of a remote client, along with the restrictions
+// applying to it.
+type rpcClient struct {
+	id     string        // Name of an authenticated client, or the remote IP of an anonymous one
+	policy *ClientPolicy // Policy of an authenticated client (nil = anonymous)
+}
+
+// accessControl enforces an access policy on the requests of the clients.
+type accessControl struct {
+	policy   *AccessPolicy
+	limiters *lru.Cache // Rate limiters of the recently seen clients
+	lock     sync.Mutex
+}
+
+// newAccessControl creates an enforcer of the given access policy.
+func newAccessControl(policy *AccessPolicy) (*accessControl, error) {
+	for name, client := range policy.Clients {
+		if client == nil || (client.Token == "" && policy.JWTSecret == "") {
+			return nil, fmt.Errorf("client %q has no credentials", name)
+		}
+	}
+	limiters, _ := lru.New(maxRateLimiters)
+	return &accessControl{
+		policy:   policy,
+		limiters: limiters,
+	}, nil
+}
+
+// authenticate resolves the client issuing an HTTP request, based on the bearer
+// token in its Authorization header.
+func (ac *accessControl) authenticate(r *http.Request) (*rpcClient, error) {
+	// Anonymous access is allowed if no clients were configured
+	if len(ac.policy.Clients) == 0 {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return &rpcClient{id: host}, nil
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return nil, errUnauthorized
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+
+	// Try the static tokens first, falling back to JWT if enabled
+	for name, client := range ac.policy.Clients {
+		if client.Token != "" && subtle.ConstantTimeCompare([]byte(client.Token), []byte(token)) == 1 {
+			return &rpcClient{id: name, policy: client}, nil
+		}
+	}
+	if ac.policy.JWTSecret == "" {
+		return nil, errUnauthorized
+	}
+	claims := new(jwt.StandardClaims)
+	parsed, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(ac.policy.JWTSecret), nil
+	})
+	if err != nil || !parsed.Valid {
+		return nil, errUnauthorized
+	}
+	// Tokens must either expire or be fresh, so that a leaked one isn't valid forever
+	if claims.ExpiresAt == 0 {
+		if claims.IssuedAt == 0 || time.Since(time.Unix(claims.IssuedAt, 0)) > jwtIssuedAtWindow {
+			return nil, errUnauthorized
+		}
+	}
+	client, ok := ac.policy.Clients[claims.Subject]
+	if !ok {
+		return nil, errUnauthorized
+	}
+	return &rpcClient{id: claims.Subject, policy: client}, nil
+}
+
+// allowed returns whether the client is permitted to call the given method.
+func (ac *accessControl) allowed(client *rpcClient, method string) bool {
+	allow, deny := ac.policy.Allow, ac.policy.Deny
+	if client != nil && client.policy != nil {
+		if len(client.policy.Allow) > 0 {
+			allow = client.policy.Allow
+		}
+		if matchMethod(client.policy.Deny, method) {
+			return false
+		}
+	}
+	if matchMethod(deny, method) {
+		return false
+	}
+	return len(allow) == 0 || matchMethod(allow, method)
+}
+
+// limit consumes the given number of requests from the rate allowance of the
+// client, returning an error if it was exceeded. Batches larger than the burst
+// allowance of the client are rejected outright, since they could never pass.
+func (ac *accessControl) limit(client *rpcClient, requests int) error {
+	rate, burst := ac.policy.RateLimit, ac.policy.RateBurst
+	if client != nil && client.policy != nil && client.policy.RateLimit > 0 {
+		rate, burst = client.policy.RateLimit, client.policy.RateBurst
+	}
+	if rate <= 0 {
+		return nil
+	}
+	id := ""
+	if client != nil {
+		id = client.id
+	}
+	ac.lock.Lock()
+	defer ac.lock.Unlock()
+
+	now := time.Now()
+
+	var limiter *rateLimiter
+	if cached, ok := ac.limiters.Get(id); ok {
+		limiter = cached.(*rateLimiter)
+	} else {
+		limiter = newRateLimiter(rate, burst, now)
+		ac.limiters.Add(id, limiter)
+	}
+	if float64(requests) > limiter.capacity {
+		return fmt.Errorf("batch of %d requests exceeds rate limit burst of %d", requests, int(limiter.capacity))
+	}
+	if !limiter.take(float64(requests), now) {
+		return errRateLimited
+	}
+	return nil
+}
+
+// matchMethod returns whether a method name matches any of the given patterns.
+func matchMethod(patterns []string, method string) bool {
+	for _, pattern := range patterns {
+		switch {
+		case pattern == "*" || pattern == method:
+			return true
+		case strings.HasSuffix(pattern, "*") && strings.HasPrefix(method, pattern[:len(pattern)-1]):
+			return true
+		}
+	}
+	return false
+}
+
+// clientFromContext retrieves the remote client associated with a request.
+func clientFromContext(ctx context.Context) *rpcClient {
+	client, _ := ctx.Value(clientKey{}).(*rpcClient)
+	return client
+}
+
+// rateLimiter is a token bucket refilling at a constant rate, allowing bursts
+// of requests up to its capacity.
+type rateLimiter struct {
+	rate     float64   // Number of tokens refilled per second
+	capacity float64   // Maximum number of tokens in the bucket
+	tokens   float64   // Number of tokens currently in the bucket
+	updated  time.Time // Time of the last refill
+}
+
+// newRateLimiter creates a full token bucket with the given refill rate and
+// burst allowance. The bucket holds at least one token, so that clients limited
+// to less than a request per second can still make some.
+func newRateLimiter(rate float64, burst int, now time.Time) *rateLimiter {
+	capacity := math.Max(1, rate+float64(burst))
+	return &rateLimiter{
+		rate:     rate,
+		capacity: capacity,
+		tokens:   capacity,
+		updated:  now,
+	}
+}
+
+// refill tops up the bucket with the tokens accumulated since the last refill.
+func (l *rateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.updated).Seconds() * l.rate
+	if l.tokens > l.capacity {
+		l.tokens = l.capacity
+	}
+	l.updated = now
+}
+
+// take consumes the requested number of tokens from the bucket if available.
+func (l *rateLimiter) take(tokens float64, now time.Time) bool {
+	l.refill(now)
+	if l.tokens < tokens {
+		return false
+	}
+	l.tokens -= tokens
+	return true
+}
@@ -0,0 +1,264 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package rpc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"golang.org/x/net/websocket"
+)
+
+// accessTestResponse is a decoded JSON-RPC response of an access policy test.
+type accessTestResponse struct {
+	Error *jsonError `json:"error"`
+}
+
+// newAccessTestServer creates an HTTP test server around an RPC server enforcing
+// the given access policy.
+func newAccessTestServer(t *testing.T, policy *AccessPolicy) *httptest.Server {
+	server := newTestServer("service", new(Service))
+	if err := server.SetAccessPolicy(policy); err != nil {
+		t.Fatalf("failed to set access policy: %v", err)
+	}
+	return httptest.NewServer(server)
+}
+
+// postAccessTest sends a raw JSON-RPC message to an HTTP test server with an
+// optional bearer token, returning the status code and the decoded error codes
+// of the responses.
+func postAccessTest(t *testing.T, server *httptest.Server, token string, body string) (int, []int) {
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader(body))
+	req.Header.Set("content-type", contentType)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return res.StatusCode, nil
+	}
+	var responses []accessTestResponse
+	if strings.HasPrefix(strings.TrimSpace(body), "[") {
+		if err := json.NewDecoder(res.Body).Decode(&responses); err != nil {
+			t.Fatalf("failed to decode batch response: %v", err)
+		}
+	} else {
+		responses = make([]accessTestResponse, 1)
+		if err := json.NewDecoder(res.Body).Decode(&responses[0]); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	codes := make([]int, len(responses))
+	for i, response := range responses {
+		if response.Error != nil {
+			codes[i] = response.Error.Code
+		}
+	}
+	return res.StatusCode, codes
+}
+
+// Tests that the method allow and deny lists are enforced.
+func TestAccessPolicyMethods(t *testing.T) {
+	server := newAccessTestServer(t, &AccessPolicy{
+		Allow: []string{"service_*"},
+		Deny:  []string{"service_rets"},
+	})
+	defer server.Close()
+
+	tests := []struct {
+		method string
+		code   int
+	}{
+		{"service_noArgsRets", 0},
+		{"service_rets", -32004},
+		{"rpc_modules", -32004},
+		{"service_missing", -32601},
+	}
+	for _, tt := range tests {
+		_, codes := postAccessTest(t, server, "", `{"jsonrpc":"2.0","id":1,"method":"`+tt.method+`"}`)
+		if len(codes) != 1 || codes[0] != tt.code {
+			t.Errorf("%s: error code mismatch: have %v, want %d", tt.method, codes, tt.code)
+		}
+	}
+}
+
+// Tests that clients are authenticated via static bearer tokens and JWTs, and
+// that their own restrictions are applied.
+func TestAccessPolicyAuthentication(t *testing.T) {
+	server := newAccessTestServer(t, &AccessPolicy{
+		Clients: map[string]*ClientPolicy{
+			"alice": {Token: "alice-token"},
+			"bob":   {Deny: []string{"service_noArgsRets"}},
+		},
+		JWTSecret: "secret",
+	})
+	defer server.Close()
+
+	signClaims := func(claims jwt.StandardClaims, secret string) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return token
+	}
+	sign := func(subject string, secret string) string {
+		return signClaims(jwt.StandardClaims{Subject: subject, ExpiresAt: time.Now().Add(time.Hour).Unix()}, secret)
+	}
+	now := time.Now()
+	request := `{"jsonrpc":"2.0","id":1,"method":"service_noArgsRets"}`
+
+	tests := []struct {
+		token  string
+		status int
+		code   int
+	}{
+		{"", http.StatusUnauthorized, 0},
+		{"bad-token", http.StatusUnauthorized, 0},
+		{"alice-token", http.StatusOK, 0},
+		{sign("alice", "secret"), http.StatusOK, 0},
+		{sign("alice", "wrong"), http.StatusUnauthorized, 0},
+		{sign("mallory", "secret"), http.StatusUnauthorized, 0},
+		{sign("bob", "secret"), http.StatusOK, -32004},
+		// Tokens must either expire or have been issued recently
+		{signClaims(jwt.StandardClaims{Subject: "alice"}, "secret"), http.StatusUnauthorized, 0},
+		{signClaims(jwt.StandardClaims{Subject: "alice", ExpiresAt: now.Add(-time.Minute).Unix()}, "secret"), http.StatusUnauthorized, 0},
+		{signClaims(jwt.StandardClaims{Subject: "alice", IssuedAt: now.Unix()}, "secret"), http.StatusOK, 0},
+		{signClaims(jwt.StandardClaims{Subject: "alice", IssuedAt: now.Add(-2 * jwtIssuedAtWindow).Unix()}, "secret"), http.StatusUnauthorized, 0},
+	}
+	for i, tt := range tests {
+		status, codes := postAccessTest(t, server, tt.token, request)
+		if status != tt.status {
+			t.Errorf("test %d: status mismatch: have %d, want %d", i, status, tt.status)
+			continue
+		}
+		if status == http.StatusOK && (len(codes) != 1 || codes[0] != tt.code) {
+			t.Errorf("test %d: error code mismatch: have %v, want %d", i, codes, tt.code)
+		}
+	}
+}
+
+// Tests that the batch size and request rate limits are enforced.
+func TestAccessPolicyLimits(t *testing.T) {
+	server := newAccessTestServer(t, &AccessPolicy{
+		BatchLimit: 2,
+		RateLimit:  0.001,
+		RateBurst:  2,
+	})
+	defer server.Close()
+
+	call := `{"jsonrpc":"2.0","id":1,"method":"service_noArgsRets"}`
+
+	// Oversized batches should be rejected without consuming the allowance
+	if _, codes := postAccessTest(t, server, "", "["+call+","+call+","+call+"]"); len(codes) != 3 || codes[0] != -32005 || codes[2] != -32005 {
+		t.Errorf("oversized batch: error codes mismatch: have %v", codes)
+	}
+	// Requests within the burst allowance should pass, the rest be rejected
+	if _, codes := postAccessTest(t, server, "", "["+call+","+call+"]"); len(codes) != 2 || codes[0] != 0 || codes[1] != 0 {
+		t.Errorf("allowed batch: error codes mismatch: have %v", codes)
+	}
+	if _, codes := postAccessTest(t, server, "", call); len(codes) != 1 || codes[0] != -32005 {
+		t.Errorf("limited request: error codes mismatch: have %v", codes)
+	}
+}
+
+// Tests that clients limited to less than a request per second can still make
+// some, and that batches which could never pass are rejected explicitly.
+func TestAccessPolicySlowRateLimit(t *testing.T) {
+	ac, err := newAccessControl(&AccessPolicy{RateLimit: 0.5})
+	if err != nil {
+		t.Fatalf("failed to create access control: %v", err)
+	}
+	client := &rpcClient{id: "127.0.0.1"}
+
+	if err := ac.limit(client, 2); err == nil || err == errRateLimited {
+		t.Errorf("oversized batch: expected burst error, got %v", err)
+	}
+	if err := ac.limit(client, 1); err != nil {
+		t.Errorf("first request: expected no error, got %v", err)
+	}
+	if err := ac.limit(client, 1); err != errRateLimited {
+		t.Errorf("second request: expected error %v, got %v", errRateLimited, err)
+	}
+}
+
+// Tests that the number of tracked rate limiters is bounded, dropping the least
+// recently used ones.
+func TestAccessPolicyLimiterEviction(t *testing.T) {
+	ac, err := newAccessControl(&AccessPolicy{RateLimit: 1})
+	if err != nil {
+		t.Fatalf("failed to create access control: %v", err)
+	}
+	// Exhaust the allowance of a client, then flood with many others
+	victim := &rpcClient{id: "victim"}
+	if err := ac.limit(victim, 1); err != nil {
+		t.Fatalf("first request: expected no error, got %v", err)
+	}
+	for i := 0; i < 2*maxRateLimiters; i++ {
+		if err := ac.limit(&rpcClient{id: fmt.Sprintf("client-%d", i)}, 1); err != nil {
+			t.Fatalf("client %d: expected no error, got %v", i, err)
+		}
+	}
+	if n := ac.limiters.Len(); n != maxRateLimiters {
+		t.Errorf("tracked limiters mismatch: have %d, want %d", n, maxRateLimiters)
+	}
+	if ac.limiters.Contains(victim.id) {
+		t.Errorf("least recently used limiter not dropped")
+	}
+}
+
+// Tests that websocket clients are authenticated during the handshake.
+func TestAccessPolicyWebsocket(t *testing.T) {
+	server := newTestServer("service", new(Service))
+	if err := server.SetAccessPolicy(&AccessPolicy{Clients: map[string]*ClientPolicy{"alice": {Token: "alice-token"}}}); err != nil {
+		t.Fatalf("failed to set access policy: %v", err)
+	}
+	httpsrv := httptest.NewServer(server.WebsocketHandler([]string{"*"}))
+	defer httpsrv.Close()
+
+	endpoint := "ws:" + strings.TrimPrefix(httpsrv.URL, "http:")
+	for _, token := range []string{"", "bad-token", "alice-token"} {
+		config, err := wsGetConfig(endpoint, "http://localhost")
+		if err != nil {
+			t.Fatalf("failed to create websocket config: %v", err)
+		}
+		if token != "" {
+			config.Header.Set("Authorization", "Bearer "+token)
+		}
+		conn, err := websocket.DialConfig(config)
+		if token == "alice-token" {
+			if err != nil {
+				t.Errorf("authorized client rejected: %v", err)
+				continue
+			}
+			conn.Close()
+		} else if err == nil {
+			conn.Close()
+			t.Errorf("unauthorized client %q accepted", token)
+		}
+	}
+}
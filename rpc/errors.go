@@ -51,6 +51,25 @@ func (e *invalidParamsError) ErrorCode() int { return -32602 }
 
 func (e *invalidParamsError) Error() string { return e.message }
 
+// method isn't permitted by the access policy of the server
+type accessDeniedError struct {
+	service string
+	method  string
+}
+
+func (e *accessDeniedError) ErrorCode() int { return -32004 }
+
+func (e *accessDeniedError) Error() string {
+	return fmt.Sprintf("The method %s%s%s is not permitted", e.service, serviceMethodSeparator, e.method)
+}
+
+// request exceeds the rate or batch limits of the access policy of the server
+type limitExceededError struct{ message string }
+
+func (e *limitExceededError) ErrorCode() int { return -32005 }
+
+func (e *limitExceededError) Error() string { return e.message }
+
 // logic error, callback returned an error
 type callbackError struct{ message string }
 
@@ -157,7 +157,7 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 
 	// test if the server is ordered to stop
 	for atomic.LoadInt32(&s.run) == 1 {
-		reqs, batch, err := s.readRequest(codec)
+		reqs, batch, err := s.readRequest(ctx, codec)
 		if err != nil {
 			// If a parsing error occurred, send an error
 			if err.Error() != "EOF" {
@@ -212,8 +212,30 @@ func (s *Server) serveRequest(ctx context.Context, codec ServerCodec, singleShot
 // response back using the given codec. It will block until the codec is closed or the server is
 // stopped. In either case the codec is closed.
 func (s *Server) ServeCodec(codec ServerCodec, options CodecOption) {
+	s.serveCodec(context.Background(), codec, options)
+}
+
+// serveCodec is the context aware variant of ServeCodec, used by transports that
+// need to associate remote client information with the requests.
+func (s *Server) serveCodec(ctx context.Context, codec ServerCodec, options CodecOption) {
 	defer codec.Close()
-	s.serveRequest(context.Background(), codec, false, options)
+	s.serveRequest(ctx, codec, false, options)
+}
+
+// SetAccessPolicy restricts the methods callable by remote clients, requires
+// them to authenticate and limits the rate and size of their requests. It must
+// be called before the server starts serving HTTP or websocket connections.
+func (s *Server) SetAccessPolicy(policy *AccessPolicy) error {
+	if policy == nil {
+		s.access = nil
+		return nil
+	}
+	access, err := newAccessControl(policy)
+	if err != nil {
+		return err
+	}
+	s.access = access
+	return nil
 }
 
 // ServeSingleRequest reads and processes a single RPC request from the given codec. It will not
@@ -371,7 +393,7 @@ func (s *Server) execBatch(ctx context.Context, codec ServerCodec, requests []*s
 // readRequest requests the next (batch) request from the codec. It will return the collection
 // of requests, an indication if the request was a batch, the invalid request identifier and an
 // error when the request could not be read/parsed.
-func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error) {
+func (s *Server) readRequest(ctx context.Context, codec ServerCodec) ([]*serverRequest, bool, Error) {
 	reqs, batch, err := codec.ReadRequestHeaders()
 	if err != nil {
 		return nil, batch, err
@@ -379,6 +401,27 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 
 	requests := make([]*serverRequest, len(reqs))
 
+	// enforce the batch and rate limits of the access policy, if any
+	if s.access != nil {
+		client := clientFromContext(ctx)
+
+		var limitErr Error
+		switch {
+		case batch && s.access.policy.BatchLimit > 0 && len(reqs) > s.access.policy.BatchLimit:
+			limitErr = &limitExceededError{fmt.Sprintf("batch of %d requests exceeds limit of %d", len(reqs), s.access.policy.BatchLimit)}
+		default:
+			if err := s.access.limit(client, len(reqs)); err != nil {
+				limitErr = &limitExceededError{err.Error()}
+			}
+		}
+		if limitErr != nil {
+			for i, r := range reqs {
+				requests[i] = &serverRequest{id: r.id, err: limitErr}
+			}
+			return requests, batch, nil
+		}
+	}
+
 	// verify requests
 	for i, r := range reqs {
 		var ok bool
@@ -400,6 +443,17 @@ func (s *Server) readRequest(codec ServerCodec) ([]*serverRequest, bool, Error)
 			continue
 		}
 
+		if s.access != nil { // rpc method isn't permitted for the client
+			method := r.service + serviceMethodSeparator + r.method
+			if r.isPubSub {
+				method = r.service + subscribeMethodSuffix
+			}
+			if !s.access.allowed(clientFromContext(ctx), method) {
+				requests[i] = &serverRequest{id: r.id, err: &accessDeniedError{r.service, r.method}}
+				continue
+			}
+		}
+
 		if svc, ok = s.services[r.service]; !ok { // rpc method isn't available
 			requests[i] = &serverRequest{id: r.id, err: &methodNotFoundError{r.service, r.method}}
 			continue
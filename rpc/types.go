@@ -74,6 +74,8 @@ type Server struct {
 	run      int32
 	codecsMu sync.Mutex
 	codecs   mapset.Set
+
+	access *accessControl // Access policy enforcer of remote clients (nil = unrestricted)
 }
 
 // rpcRequest represents a raw incoming RPC request
@@ -58,8 +58,19 @@ var websocketJSONCodec = websocket.Codec{
 // To allow connections with any origin, pass "*".
 func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 	return websocket.Server{
-		Handshake: wsHandshakeValidator(allowedOrigins),
+		Handshake: srv.wsHandshakeValidator(allowedOrigins),
 		Handler: func(conn *websocket.Conn) {
+			// Resolve the client if an access policy is enforced, the handshake
+			// already rejected unauthenticated ones
+			ctx := context.Background()
+			if srv.access != nil {
+				client, err := srv.access.authenticate(conn.Request())
+				if err != nil {
+					conn.Close()
+					return
+				}
+				ctx = context.WithValue(ctx, clientKey{}, client)
+			}
 			// Create a custom encode/decode pair to enforce payload size and number encoding
 			conn.MaxPayloadBytes = maxRequestContentLength
 
@@ -69,7 +80,7 @@ func (srv *Server) WebsocketHandler(allowedOrigins []string) http.Handler {
 			decoder := func(v interface{}) error {
 				return websocketJSONCodec.Receive(conn, v)
 			}
-			srv.ServeCodec(NewCodec(conn, encoder, decoder), OptionMethodInvocation|OptionSubscriptions)
+			srv.serveCodec(ctx, NewCodec(conn, encoder, decoder), OptionMethodInvocation|OptionSubscriptions)
 		},
 	}
 }
@@ -81,10 +92,10 @@ func NewWSServer(allowedOrigins []string, srv *Server) *http.Server {
 	return &http.Server{Handler: srv.WebsocketHandler(allowedOrigins)}
 }
 
-// wsHandshakeValidator returns a handler that verifies the origin during the
-// websocket upgrade process. When a '*' is specified as an allowed origins all
-// connections are accepted.
-func wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http.Request) error {
+// wsHandshakeValidator returns a handler that verifies the origin and the client
+// credentials during the websocket upgrade process. When a '*' is specified as an
+// allowed origins all connections are accepted.
+func (srv *Server) wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http.Request) error {
 	origins := mapset.NewSet()
 	allowAllOrigins := false
 
@@ -109,11 +120,17 @@ func wsHandshakeValidator(allowedOrigins []string) func(*websocket.Config, *http
 
 	f := func(cfg *websocket.Config, req *http.Request) error {
 		origin := strings.ToLower(req.Header.Get("Origin"))
-		if allowAllOrigins || origins.Contains(origin) {
-			return nil
+		if !allowAllOrigins && !origins.Contains(origin) {
+			log.Warn(fmt.Sprintf("origin '%s' not allowed on WS-RPC interface\n", origin))
+			return fmt.Errorf("origin %s not allowed", origin)
+		}
+		if srv.access != nil {
+			if _, err := srv.access.authenticate(req); err != nil {
+				log.Warn("Unauthorized client on WS-RPC interface", "remote", req.RemoteAddr)
+				return err
+			}
 		}
-		log.Warn(fmt.Sprintf("origin '%s' not allowed on WS-RPC interface\n", origin))
-		return fmt.Errorf("origin %s not allowed", origin)
+		return nil
 	}
 
 	return f
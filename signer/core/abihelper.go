@@ -123,6 +123,21 @@ func parseCallData(calldata []byte, abidata string) (*decodedCallData, error) {
 	return &decoded, nil
 }
 
+// DecodeCallData checks that the calldata is a well-formed call of the method with
+// the given selector, e.g. "transfer(address,uint256)", and returns a human
+// readable representation of the call.
+func DecodeCallData(calldata []byte, selector string) (string, error) {
+	abidata, err := MethodSelectorToAbi(selector)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := parseCallData(calldata, string(abidata))
+	if err != nil {
+		return "", err
+	}
+	return decoded.String(), nil
+}
+
 // MethodSelectorToAbi converts a method selector into an ABI struct. The returned data is a valid json string
 // which can be consumed by the standard abi package.
 func MethodSelectorToAbi(selector string) ([]byte, error) {
@@ -34,6 +34,7 @@ import (
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
 )
 
 // ExternalAPI defines the external API through which signing requests are made.
@@ -46,6 +47,10 @@ type ExternalAPI interface {
 	SignTransaction(ctx context.Context, args SendTxArgs, methodSelector *string) (*ethapi.SignTransactionResult, error)
 	// Sign - request to sign the given data (plus prefix)
 	Sign(ctx context.Context, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error)
+	// SignData - request to sign the given data of the given content type
+	SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error)
+	// SignTypedData - request to sign the given typed structured data (EIP-712)
+	SignTypedData(ctx context.Context, addr common.MixedcaseAddress, data typeddata.TypedData) (hexutil.Bytes, error)
 	// EcRecover - request to perform ecrecover
 	EcRecover(ctx context.Context, data, sig hexutil.Bytes) (common.Address, error)
 	// Export - request to export an account
@@ -155,11 +160,14 @@ type (
 		NewPassword string `json:"new_password"`
 	}
 	SignDataRequest struct {
-		Address common.MixedcaseAddress `json:"address"`
-		Rawdata hexutil.Bytes           `json:"raw_data"`
-		Message string                  `json:"message"`
-		Hash    hexutil.Bytes           `json:"hash"`
-		Meta    Metadata                `json:"meta"`
+		ContentType string                     `json:"content_type,omitempty"`
+		Address     common.MixedcaseAddress    `json:"address"`
+		Rawdata     hexutil.Bytes              `json:"raw_data"`
+		Message     string                     `json:"message"`
+		Messages    []*typeddata.NameValueType `json:"messages,omitempty"`
+		TypedData   *typeddata.TypedData       `json:"typed_data,omitempty"`
+		Hash        hexutil.Bytes              `json:"hash"`
+		Meta        Metadata                   `json:"meta"`
 	}
 	SignDataResponse struct {
 		Approved bool `json:"approved"`
@@ -380,6 +388,32 @@ func (api *SignerAPI) Sign(ctx context.Context, addr common.MixedcaseAddress, da
 	// We make the request prior to looking up if we actually have the account, to prevent
 	// account-enumeration via the API
 	req := &SignDataRequest{Address: addr, Rawdata: data, Message: msg, Hash: sighash, Meta: MetadataFromContext(ctx)}
+	return api.signData(addr, req)
+}
+
+// SignTypedData calculates an ECDSA signature over the typed structured data,
+// as specified by EIP-712:
+//
+//   keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+//
+// The decoded fields of the data are shown to the user for approval. As with
+// Sign, the V value of the signature will be 27 or 28.
+func (api *SignerAPI) SignTypedData(ctx context.Context, addr common.MixedcaseAddress, data typeddata.TypedData) (hexutil.Bytes, error) {
+	sighash, err := data.SigningHash()
+	if err != nil {
+		return nil, err
+	}
+	messages, err := data.Format()
+	if err != nil {
+		return nil, err
+	}
+	req := &SignDataRequest{Address: addr, Messages: messages, TypedData: &data, Hash: sighash[:], Meta: MetadataFromContext(ctx)}
+	return api.signData(addr, req)
+}
+
+// signData asks the user to approve the data signing request, and signs the
+// hash of the request with the account.
+func (api *SignerAPI) signData(addr common.MixedcaseAddress, req *SignDataRequest) (hexutil.Bytes, error) {
 	res, err := api.UI.ApproveSignData(req)
 
 	if err != nil {
@@ -395,7 +429,7 @@ func (api *SignerAPI) Sign(ctx context.Context, addr common.MixedcaseAddress, da
 		return nil, err
 	}
 	// Assemble sign the data with the wallet
-	signature, err := wallet.SignHashWithPassphrase(account, res.Password, sighash)
+	signature, err := wallet.SignHashWithPassphrase(account, res.Password, req.Hash)
 	if err != nil {
 		api.UI.ShowError(err.Error())
 		return nil, err
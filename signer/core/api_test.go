@@ -31,9 +31,12 @@ import (
 	"github.com/ethereum/go-ethereum/cmd/utils"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
 )
 
 //Used for testing
@@ -254,6 +257,130 @@ func TestSignData(t *testing.T) {
 		t.Errorf("Expected 65 byte signature (got %d bytes)", len(h))
 	}
 }
+func TestSignTypedData(t *testing.T) {
+
+	api, control := setup(t)
+	//Create two accounts
+	createAccount(control, api, t)
+	createAccount(control, api, t)
+	control <- "1"
+	list, err := api.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := common.NewMixedcaseAddress(list[0].Address)
+
+	data := typeddata.TypedData{
+		Types: typeddata.Types{
+			"EIP712Domain": {{Name: "name", Type: "string"}},
+			"Greeting":     {{Name: "text", Type: "string"}, {Name: "count", Type: "uint8"}},
+		},
+		PrimaryType: "Greeting",
+		Domain:      typeddata.Domain{Name: "Test"},
+		Message:     map[string]interface{}{"text": "EHLO world", "count": "3"},
+	}
+	control <- "No way"
+	h, err := api.SignTypedData(context.Background(), a, data)
+	if h != nil {
+		t.Errorf("Expected nil-data, got %x", h)
+	}
+	if err != ErrRequestDenied {
+		t.Errorf("Expected ErrRequestDenied! %v", err)
+	}
+
+	control <- "Y"
+	control <- "apassword"
+	h, err = api.SignTypedData(context.Background(), a, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(h) != 65 || (h[64] != 27 && h[64] != 28) {
+		t.Fatalf("Expected 65 byte signature with V 27 or 28, got %x", h)
+	}
+	sighash, _ := data.SigningHash()
+	h[64] -= 27
+	pub, err := crypto.SigToPub(sighash[:], h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if addr := crypto.PubkeyToAddress(*pub); addr != a.Address() {
+		t.Errorf("Signer mismatch: have %x, want %x", addr, a.Address())
+	}
+
+	// Invalid typed data must be rejected without asking the user
+	data.Message["count"] = "256"
+	if _, err := api.SignTypedData(context.Background(), a, data); err == nil {
+		t.Errorf("Expected error for out of range value")
+	}
+}
+
+func TestSignDataContentTypes(t *testing.T) {
+
+	api, control := setup(t)
+	//Create two accounts
+	createAccount(control, api, t)
+	createAccount(control, api, t)
+	control <- "1"
+	list, err := api.List(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := common.NewMixedcaseAddress(list[0].Address)
+
+	validator := common.HexToAddress("0x1337")
+	header := &types.Header{
+		ParentHash: common.HexToHash("0x01"),
+		Number:     big.NewInt(100),
+		Difficulty: big.NewInt(2),
+		Time:       big.NewInt(1000),
+		Extra:      make([]byte, 32+65),
+	}
+	headerRLP, _ := rlp.EncodeToBytes(header)
+	sealHash := clique.SealHash(header)
+
+	tests := []struct {
+		contentType string
+		data        []byte
+		hash        []byte
+		v           byte // V offset of the signature
+	}{
+		{TextPlain, []byte("EHLO world"), func() []byte { h, _ := SignHash([]byte("EHLO world")); return h }(), 27},
+		{DataValidator, append(validator.Bytes(), 0xca, 0xfe), crypto.Keccak256([]byte{0x19, 0x00}, validator.Bytes(), []byte{0xca, 0xfe}), 27},
+		{ApplicationClique, headerRLP, sealHash[:], 0},
+	}
+	for _, tt := range tests {
+		control <- "Y"
+		control <- "apassword"
+		sig, err := api.SignData(context.Background(), tt.contentType, a, tt.data)
+		if err != nil {
+			t.Fatalf("%s: signing failed: %v", tt.contentType, err)
+		}
+		if len(sig) != 65 || (sig[64] != tt.v && sig[64] != tt.v+1) {
+			t.Fatalf("%s: invalid signature %x", tt.contentType, sig)
+		}
+		sig[64] -= tt.v
+		pub, err := crypto.SigToPub(tt.hash, sig)
+		if err != nil {
+			t.Fatalf("%s: recovery failed: %v", tt.contentType, err)
+		}
+		if addr := crypto.PubkeyToAddress(*pub); addr != a.Address() {
+			t.Errorf("%s: signer mismatch: have %x, want %x", tt.contentType, addr, a.Address())
+		}
+	}
+	// Invalid requests must be rejected without asking the user
+	if _, err := api.SignData(context.Background(), "image/png", a, []byte{1}); err == nil {
+		t.Errorf("Expected error for unknown content type")
+	}
+	header.Extra = nil
+	headerRLP, _ = rlp.EncodeToBytes(header)
+	if _, err := api.SignData(context.Background(), ApplicationClique, a, headerRLP); err != errCliqueExtraTooShort {
+		t.Errorf("Expected errCliqueExtraTooShort, got %v", err)
+	}
+	if _, err := api.SignData(context.Background(), DataValidator, a, []byte{1}); err != errValidatorTooShort {
+		t.Errorf("Expected errValidatorTooShort, got %v", err)
+	}
+}
+
 func mkTestTx(from common.MixedcaseAddress) SendTxArgs {
 	to := common.NewMixedcaseAddress(common.HexToAddress("0x1337"))
 	gas := hexutil.Uint64(21000)
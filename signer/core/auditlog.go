@@ -18,6 +18,7 @@ package core
 
 import (
 	"context"
+	"sync/atomic"
 
 	"encoding/json"
 
@@ -26,18 +27,27 @@ import (
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
 )
 
 type AuditLogger struct {
-	log log.Logger
-	api ExternalAPI
+	log   log.Logger
+	api   ExternalAPI
+	reqID uint64 // Id of the last request, to match responses with their requests
+}
+
+// nextID returns the id of a new request. Requests may complete out of order, the
+// id is logged with both the request and the response.
+func (l *AuditLogger) nextID() uint64 {
+	return atomic.AddUint64(&l.reqID, 1)
 }
 
 func (l *AuditLogger) List(ctx context.Context) (Accounts, error) {
-	l.log.Info("List", "type", "request", "metadata", MetadataFromContext(ctx).String())
+	id := l.nextID()
+	l.log.Info("List", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String())
 	res, e := l.api.List(ctx)
 
-	l.log.Info("List", "type", "response", "data", res.String())
+	l.log.Info("List", "type", "response", "id", id, "data", res.String())
 
 	return res, e
 }
@@ -47,54 +57,77 @@ func (l *AuditLogger) New(ctx context.Context) (accounts.Account, error) {
 }
 
 func (l *AuditLogger) SignTransaction(ctx context.Context, args SendTxArgs, methodSelector *string) (*ethapi.SignTransactionResult, error) {
+	id := l.nextID()
 	sel := "<nil>"
 	if methodSelector != nil {
 		sel = *methodSelector
 	}
-	l.log.Info("SignTransaction", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+	l.log.Info("SignTransaction", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
 		"tx", args.String(),
 		"methodSelector", sel)
 
 	res, e := l.api.SignTransaction(ctx, args, methodSelector)
 	if res != nil {
-		l.log.Info("SignTransaction", "type", "response", "data", common.Bytes2Hex(res.Raw), "error", e)
+		l.log.Info("SignTransaction", "type", "response", "id", id, "data", common.Bytes2Hex(res.Raw), "error", e)
 	} else {
-		l.log.Info("SignTransaction", "type", "response", "data", res, "error", e)
+		l.log.Info("SignTransaction", "type", "response", "id", id, "data", res, "error", e)
 	}
 	return res, e
 }
 
 func (l *AuditLogger) Sign(ctx context.Context, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
-	l.log.Info("Sign", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+	id := l.nextID()
+	l.log.Info("Sign", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
 		"addr", addr.String(), "data", common.Bytes2Hex(data))
 	b, e := l.api.Sign(ctx, addr, data)
-	l.log.Info("Sign", "type", "response", "data", common.Bytes2Hex(b), "error", e)
+	l.log.Info("Sign", "type", "response", "id", id, "data", common.Bytes2Hex(b), "error", e)
+	return b, e
+}
+
+func (l *AuditLogger) SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	id := l.nextID()
+	l.log.Info("SignData", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
+		"addr", addr.String(), "contentType", contentType, "data", common.Bytes2Hex(data))
+	b, e := l.api.SignData(ctx, contentType, addr, data)
+	l.log.Info("SignData", "type", "response", "id", id, "data", common.Bytes2Hex(b), "error", e)
+	return b, e
+}
+
+func (l *AuditLogger) SignTypedData(ctx context.Context, addr common.MixedcaseAddress, data typeddata.TypedData) (hexutil.Bytes, error) {
+	id := l.nextID()
+	l.log.Info("SignTypedData", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
+		"addr", addr.String(), "primaryType", data.PrimaryType, "domain", data.Domain.Name)
+	b, e := l.api.SignTypedData(ctx, addr, data)
+	l.log.Info("SignTypedData", "type", "response", "id", id, "data", common.Bytes2Hex(b), "error", e)
 	return b, e
 }
 
 func (l *AuditLogger) EcRecover(ctx context.Context, data, sig hexutil.Bytes) (common.Address, error) {
-	l.log.Info("EcRecover", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+	id := l.nextID()
+	l.log.Info("EcRecover", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
 		"data", common.Bytes2Hex(data))
 	a, e := l.api.EcRecover(ctx, data, sig)
-	l.log.Info("EcRecover", "type", "response", "addr", a.String(), "error", e)
+	l.log.Info("EcRecover", "type", "response", "id", id, "addr", a.String(), "error", e)
 	return a, e
 }
 
 func (l *AuditLogger) Export(ctx context.Context, addr common.Address) (json.RawMessage, error) {
-	l.log.Info("Export", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+	id := l.nextID()
+	l.log.Info("Export", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
 		"addr", addr.Hex())
 	j, e := l.api.Export(ctx, addr)
 	// In this case, we don't actually log the json-response, which may be extra sensitive
-	l.log.Info("Export", "type", "response", "json response size", len(j), "error", e)
+	l.log.Info("Export", "type", "response", "id", id, "json response size", len(j), "error", e)
 	return j, e
 }
 
 func (l *AuditLogger) Import(ctx context.Context, keyJSON json.RawMessage) (Account, error) {
+	id := l.nextID()
 	// Don't actually log the json contents
-	l.log.Info("Import", "type", "request", "metadata", MetadataFromContext(ctx).String(),
+	l.log.Info("Import", "type", "request", "id", id, "metadata", MetadataFromContext(ctx).String(),
 		"keyJSON size", len(keyJSON))
 	a, e := l.api.Import(ctx, keyJSON)
-	l.log.Info("Import", "type", "response", "addr", a.String(), "error", e)
+	l.log.Info("Import", "type", "response", "id", id, "addr", a.String(), "error", e)
 	return a, e
 }
 
@@ -106,5 +139,5 @@ func NewAuditLogger(path string, api ExternalAPI) (*AuditLogger, error) {
 	}
 	l.SetHandler(handler)
 	l.Info("Configured", "audit log", path)
-	return &AuditLogger{l, api}, nil
+	return &AuditLogger{log: l, api: api}, nil
 }
@@ -28,6 +28,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
 	"golang.org/x/crypto/ssh/terminal"
 )
 
@@ -143,8 +144,15 @@ func (ui *CommandlineUI) ApproveSignData(request *SignDataRequest) (SignDataResp
 
 	fmt.Printf("-------- Sign data request--------------\n")
 	fmt.Printf("Account:  %s\n", request.Address.String())
-	fmt.Printf("message:  \n%q\n", request.Message)
-	fmt.Printf("raw data: \n%v\n", request.Rawdata)
+	if request.ContentType != "" {
+		fmt.Printf("content type: %s\n", request.ContentType)
+	}
+	if len(request.Messages) > 0 {
+		fmt.Printf("data:\n%s", typeddata.Pprint(request.Messages))
+	} else {
+		fmt.Printf("message:  \n%q\n", request.Message)
+		fmt.Printf("raw data: \n%v\n", request.Rawdata)
+	}
 	fmt.Printf("message hash:  %v\n", request.Hash)
 	fmt.Printf("-------------------------------------------\n")
 	showMetadata(request.Meta)
@@ -0,0 +1,136 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/consensus/clique"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
+)
+
+// Content types accepted by SignData.
+const (
+	TextPlain         = "text/plain"             // Text, signed with the personal message prefix
+	ApplicationClique = clique.HeaderContentType // RLP encoded clique header, sealed for block production
+	DataValidator     = "data/validator"         // Data with intended validator (EIP-191 version 0x00)
+)
+
+// cliqueSealLength is the length of the signature suffix of the clique header
+// extra-data.
+const cliqueSealLength = 65
+
+var (
+	// ErrUnknownContentType is returned if the content type of a data signing
+	// request is not supported.
+	ErrUnknownContentType = errors.New("unknown content type")
+
+	// errCliqueExtraTooShort is returned if a clique header to be signed has no
+	// room for the signature in its extra-data.
+	errCliqueExtraTooShort = errors.New("clique header extra-data too short")
+
+	// errValidatorTooShort is returned if data to be signed for a validator
+	// doesn't start with the validator address.
+	errValidatorTooShort = errors.New("validator data too short")
+)
+
+// SignData signs the data of the given content type with the account, after the
+// user approved the request:
+//
+//   - text/plain: keccak256("\x19Ethereum Signed Message:\n" + len(data) + data),
+//     same as Sign.
+//   - application/x-clique-header: the RLP encoded header is sealed as clique
+//     expects it. The V value of the signature is 0 or 1.
+//   - data/validator: the data is the 20 byte address of the intended validator
+//     followed by the message, signed as keccak256(0x19 0x00 ‖ validator ‖ message).
+//
+// Unless noted, the V value of the signature is 27 or 28 for legacy reasons.
+func (api *SignerAPI) SignData(ctx context.Context, contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	req, err := NewSignDataRequest(contentType, addr, data)
+	if err != nil {
+		return nil, err
+	}
+	req.Meta = MetadataFromContext(ctx)
+
+	signature, err := api.signData(addr, req)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == ApplicationClique {
+		signature[64] -= 27 // Transform V back from 27/28 to 0/1 for clique
+	}
+	return signature, nil
+}
+
+// NewSignDataRequest assembles the approval request for signing data of the
+// given content type, decoding the data for display.
+func NewSignDataRequest(contentType string, addr common.MixedcaseAddress, data hexutil.Bytes) (*SignDataRequest, error) {
+	req := &SignDataRequest{ContentType: contentType, Address: addr, Rawdata: data}
+
+	switch contentType {
+	case TextPlain:
+		req.Hash, req.Message = SignHash(data)
+		req.Messages = []*typeddata.NameValueType{
+			{Name: "message", Value: string(data), Typ: "text"},
+		}
+		return req, nil
+
+	case ApplicationClique:
+		header := new(types.Header)
+		if err := rlp.DecodeBytes(data, header); err != nil {
+			return nil, fmt.Errorf("invalid clique header: %v", err)
+		}
+		if len(header.Extra) < cliqueSealLength {
+			return nil, errCliqueExtraTooShort
+		}
+		sighash := clique.SealHash(header)
+		req.Hash = sighash.Bytes()
+		req.Messages = []*typeddata.NameValueType{
+			{Name: "Clique header", Typ: "clique", Value: []*typeddata.NameValueType{
+				{Name: "number", Value: header.Number.String(), Typ: "uint256"},
+				{Name: "parentHash", Value: header.ParentHash.Hex(), Typ: "bytes32"},
+				{Name: "coinbase", Value: header.Coinbase.Hex(), Typ: "address"},
+				{Name: "time", Value: header.Time.String(), Typ: "uint256"},
+				{Name: "difficulty", Value: header.Difficulty.String(), Typ: "uint256"},
+				{Name: "sealHash", Value: sighash.Hex(), Typ: "bytes32"},
+			}},
+		}
+		return req, nil
+
+	case DataValidator:
+		if len(data) < common.AddressLength {
+			return nil, errValidatorTooShort
+		}
+		validator := common.BytesToAddress(data[:common.AddressLength])
+		message := data[common.AddressLength:]
+
+		req.Hash = crypto.Keccak256([]byte{0x19, 0x00}, validator.Bytes(), message)
+		req.Messages = []*typeddata.NameValueType{
+			{Name: "validator", Value: validator.Hex(), Typ: "address"},
+			{Name: "message", Value: hexutil.Encode(message), Typ: "bytes"},
+		}
+		return req, nil
+	}
+	return nil, fmt.Errorf("%v: %q", ErrUnknownContentType, contentType)
+}
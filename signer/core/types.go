@@ -74,7 +74,8 @@ type SendTxArgs struct {
 }
 
 func (args SendTxArgs) String() string {
-	s, err := json.Marshal(args)
+	// Marshal through a pointer, as the from address only marshals addressable
+	s, err := json.Marshal(&args)
 	if err == nil {
 		return string(s)
 	}
@@ -0,0 +1,284 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/storage"
+)
+
+// maxPolicyWindow is the longest rolling window value budgets can be evaluated
+// over. Spends older than this are pruned from the storage.
+const maxPolicyWindow = 31 * 24 * time.Hour
+
+var (
+	errInvalidAddress = errors.New("invalid address")
+	errInvalidValue   = errors.New("invalid value")
+	errInvalidWindow  = errors.New("invalid window")
+	errInvalidTime    = errors.New("invalid time of day")
+)
+
+// spend is a value transfer recorded against a budget.
+type spend struct {
+	Time  int64  `json:"t"` // Unix time of the transfer
+	Value string `json:"v"` // Value transferred, in wei
+}
+
+// policy implements the policy primitives exposed to the rules as the `policy`
+// object. Value budgets are tracked in the rules storage, the allowed calls are
+// configured anew by the rules on every execution. Approved transfers awaiting
+// their signature count against the budgets as well.
+type policy struct {
+	storage storage.Storage
+	now     func() time.Time
+	pending []*reservation              // Approved transfers awaiting their signature
+	calls   map[common.Address][]string // Method selectors allowed per contract
+}
+
+func newPolicy(storage storage.Storage, now func() time.Time, pending []*reservation) *policy {
+	return &policy{
+		storage: storage,
+		now:     now,
+		pending: pending,
+		calls:   make(map[common.Address][]string),
+	}
+}
+
+// SentWithin reports whether sending value from the address keeps the total
+// sent by it within the rolling window (e.g. "24h") at or below the limit.
+func (p *policy) SentWithin(from, value, limit, window string) bool {
+	ok, err := p.within("sent", from, value, limit, window)
+	if err != nil {
+		log.Warn("Invalid sender budget check", "from", from, "err", err)
+	}
+	return ok
+}
+
+// ReceivedWithin reports whether sending value to the address keeps the total
+// received by it within the rolling window at or below the limit.
+func (p *policy) ReceivedWithin(to, value, limit, window string) bool {
+	ok, err := p.within("received", to, value, limit, window)
+	if err != nil {
+		log.Warn("Invalid recipient budget check", "to", to, "err", err)
+	}
+	return ok
+}
+
+// Sent returns the total value sent from the address within the rolling window,
+// in wei.
+func (p *policy) Sent(from, window string) string {
+	total, err := p.total("sent", from, window)
+	if err != nil {
+		log.Warn("Invalid sender budget query", "from", from, "err", err)
+		return ""
+	}
+	return total.String()
+}
+
+// Received returns the total value sent to the address within the rolling
+// window, in wei.
+func (p *policy) Received(to, window string) string {
+	total, err := p.total("received", to, window)
+	if err != nil {
+		log.Warn("Invalid recipient budget query", "to", to, "err", err)
+		return ""
+	}
+	return total.String()
+}
+
+// AllowCall permits calls to the method of the contract given by its selector,
+// e.g. "transfer(address,uint256)".
+func (p *policy) AllowCall(contract, selector string) {
+	if !common.IsHexAddress(contract) {
+		log.Warn("Invalid allowed contract", "contract", contract)
+		return
+	}
+	addr := common.HexToAddress(contract)
+	p.calls[addr] = append(p.calls[addr], selector)
+}
+
+// CallAllowed reports whether the transaction data is a well-formed call of one
+// of the methods allowed on the recipient contract.
+func (p *policy) CallAllowed(to, data string) bool {
+	if !common.IsHexAddress(to) {
+		return false
+	}
+	calldata, err := hexutil.Decode(data)
+	if err != nil || len(calldata) == 0 {
+		return false
+	}
+	for _, selector := range p.calls[common.HexToAddress(to)] {
+		if _, err := core.DecodeCallData(calldata, selector); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// TimeWithin reports whether the local time of day is within the given range,
+// e.g. "09:00" and "17:30". Ranges wrapping around midnight are supported.
+func (p *policy) TimeWithin(start, end string) bool {
+	from, err := parseTimeOfDay(start)
+	if err != nil {
+		log.Warn("Invalid time of day", "start", start, "err", err)
+		return false
+	}
+	until, err := parseTimeOfDay(end)
+	if err != nil {
+		log.Warn("Invalid time of day", "end", end, "err", err)
+		return false
+	}
+	now := p.now()
+	current := time.Duration(now.Hour())*time.Hour + time.Duration(now.Minute())*time.Minute + time.Duration(now.Second())*time.Second
+
+	if from <= until {
+		return from <= current && current < until
+	}
+	return current >= from || current < until
+}
+
+// record accounts a value transfer against the budgets of the sender and the
+// recipient. It is not exposed to the rules.
+func (p *policy) record(from common.Address, to *common.Address, value *big.Int) {
+	if value == nil || value.Sign() == 0 {
+		return
+	}
+	p.add("sent", from, value)
+	if to != nil {
+		p.add("received", *to, value)
+	}
+}
+
+// within checks whether adding value to the budget keeps it at or below limit.
+func (p *policy) within(kind, address, value, limit, window string) (bool, error) {
+	amount, ok := parseValue(value)
+	if !ok {
+		return false, errInvalidValue
+	}
+	max, ok := parseValue(limit)
+	if !ok {
+		return false, errInvalidValue
+	}
+	total, err := p.total(kind, address, window)
+	if err != nil {
+		return false, err
+	}
+	return total.Add(total, amount).Cmp(max) <= 0, nil
+}
+
+// total sums the budget spends within the window and the pending reservations.
+func (p *policy) total(kind, address, window string) (*big.Int, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errInvalidAddress
+	}
+	span, err := time.ParseDuration(window)
+	if err != nil || span <= 0 || span > maxPolicyWindow {
+		return nil, errInvalidWindow
+	}
+	var (
+		now   = p.now()
+		start = now.Add(-span).Unix()
+		addr  = common.HexToAddress(address)
+	)
+	total := new(big.Int)
+	for _, s := range p.spends(kind, addr) {
+		if s.Time > start {
+			if v, ok := new(big.Int).SetString(s.Value, 10); ok {
+				total.Add(total, v)
+			}
+		}
+	}
+	for _, res := range p.pending {
+		if !res.expires.After(now) {
+			continue
+		}
+		if (kind == "sent" && res.from == addr) || (kind == "received" && res.to != nil && *res.to == addr) {
+			total.Add(total, res.value)
+		}
+	}
+	return total, nil
+}
+
+// add records a spend against the budget, pruning expired ones.
+func (p *policy) add(kind string, address common.Address, value *big.Int) {
+	now := p.now()
+	expiry := now.Add(-maxPolicyWindow).Unix()
+
+	var spends []spend
+	for _, s := range p.spends(kind, address) {
+		if s.Time > expiry {
+			spends = append(spends, s)
+		}
+	}
+	spends = append(spends, spend{Time: now.Unix(), Value: value.String()})
+
+	blob, err := json.Marshal(spends)
+	if err != nil {
+		log.Warn("Failed to encode budget", "err", err)
+		return
+	}
+	p.storage.Put(budgetKey(kind, address), string(blob))
+}
+
+// spends retrieves the spends recorded against the budget.
+func (p *policy) spends(kind string, address common.Address) []spend {
+	blob := p.storage.Get(budgetKey(kind, address))
+	if blob == "" {
+		return nil
+	}
+	var spends []spend
+	if err := json.Unmarshal([]byte(blob), &spends); err != nil {
+		log.Warn("Corrupt budget in storage", "address", address, "err", err)
+		return nil
+	}
+	return spends
+}
+
+// budgetKey returns the storage key of a budget.
+func budgetKey(kind string, address common.Address) string {
+	return fmt.Sprintf("policy/%s/%s", kind, strings.ToLower(address.Hex()))
+}
+
+// parseValue parses a non-negative decimal or hex wei value.
+func parseValue(value string) (*big.Int, bool) {
+	v, ok := math.ParseBig256(value)
+	if !ok || v.Sign() < 0 {
+		return nil, false
+	}
+	return v, true
+}
+
+// parseTimeOfDay parses a "15:04" formatted time of day into the offset from
+// midnight.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, errInvalidTime
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
@@ -0,0 +1,246 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/storage"
+)
+
+// Tests that value budgets are tracked per sender and recipient over rolling
+// windows.
+func TestPolicyBudgets(t *testing.T) {
+	var (
+		now   = time.Unix(1000000, 0)
+		p     = newPolicy(storage.NewEphemeralStorage(), func() time.Time { return now }, nil)
+		alice = common.HexToAddress("0xa11ce")
+		bob   = common.HexToAddress("0xb0b")
+		carol = common.HexToAddress("0xca401")
+		ether = "1000000000000000000"
+	)
+	p.record(alice, &bob, big.NewInt(6e17))
+	now = now.Add(12 * time.Hour)
+	p.record(alice, &carol, big.NewInt(3e17))
+
+	if sent := p.Sent(alice.Hex(), "24h"); sent != "900000000000000000" {
+		t.Errorf("sent mismatch: have %s, want 9e17", sent)
+	}
+	if received := p.Received(bob.Hex(), "24h"); received != "600000000000000000" {
+		t.Errorf("received mismatch: have %s, want 6e17", received)
+	}
+	if !p.SentWithin(alice.Hex(), "0x16345785d8a0000", ether, "24h") { // 1e17
+		t.Errorf("transfer up to the limit rejected")
+	}
+	if p.SentWithin(alice.Hex(), "200000000000000000", ether, "24h") {
+		t.Errorf("transfer over the limit accepted")
+	}
+	if !p.ReceivedWithin(carol.Hex(), "700000000000000000", ether, "24h") {
+		t.Errorf("recipient transfer up to the limit rejected")
+	}
+	// Once the first transfer leaves the window, the budget frees up
+	now = now.Add(12*time.Hour + time.Second)
+	if !p.SentWithin(alice.Hex(), "700000000000000000", ether, "24h") {
+		t.Errorf("transfer within the rolled window rejected")
+	}
+	if p.SentWithin(alice.Hex(), "700000000000000000", ether, "48h") {
+		t.Errorf("transfer over the limit of the longer window accepted")
+	}
+	// Invalid parameters must never approve
+	for _, args := range [][4]string{
+		{"0xnope", "1", ether, "24h"},
+		{alice.Hex(), "-1", ether, "24h"},
+		{alice.Hex(), "1", "lots", "24h"},
+		{alice.Hex(), "1", ether, "day"},
+		{alice.Hex(), "1", ether, "1000h"},
+	} {
+		if p.SentWithin(args[0], args[1], args[2], args[3]) {
+			t.Errorf("invalid budget check %v accepted", args)
+		}
+	}
+	// Spends beyond the longest window are pruned
+	now = now.Add(maxPolicyWindow)
+	p.record(alice, nil, big.NewInt(1))
+	if spends := p.spends("sent", alice); len(spends) != 1 {
+		t.Errorf("expired spends not pruned: %d left", len(spends))
+	}
+}
+
+// Tests that only well-formed calls of the allowed methods are accepted.
+func TestPolicyCalls(t *testing.T) {
+	p := newPolicy(storage.NewEphemeralStorage(), time.Now, nil)
+
+	token := "0x000000000000000000000000000000000000dead"
+	p.AllowCall(token, "transfer(address,uint256)")
+
+	transfer := "0xa9059cbb" + // transfer(address,uint256)
+		"000000000000000000000000000000000000000000000000000000000000b0b0" +
+		"0000000000000000000000000000000000000000000000000000000000000001"
+	approve := "0x095ea7b3" + // approve(address,uint256)
+		"000000000000000000000000000000000000000000000000000000000000b0b0" +
+		"0000000000000000000000000000000000000000000000000000000000000001"
+
+	tests := []struct {
+		to, data string
+		allowed  bool
+	}{
+		{token, transfer, true},
+		{token, approve, false},
+		{token, transfer + "00", false},
+		{token, transfer[:74], false},
+		{token, "0x", false},
+		{"0x000000000000000000000000000000000000beef", transfer, false},
+	}
+	for i, tt := range tests {
+		if allowed := p.CallAllowed(tt.to, tt.data); allowed != tt.allowed {
+			t.Errorf("test %d: allowed mismatch: have %v, want %v", i, allowed, tt.allowed)
+		}
+	}
+}
+
+// Tests time of day restrictions, including ranges wrapping around midnight.
+func TestPolicyTimeOfDay(t *testing.T) {
+	tests := []struct {
+		now        string
+		start, end string
+		within     bool
+	}{
+		{"12:00", "09:00", "17:00", true},
+		{"09:00", "09:00", "17:00", true},
+		{"17:00", "09:00", "17:00", false},
+		{"08:59", "09:00", "17:00", false},
+		{"23:30", "22:00", "06:00", true},
+		{"05:59", "22:00", "06:00", true},
+		{"12:00", "22:00", "06:00", false},
+		{"12:00", "9am", "17:00", false},
+	}
+	for i, tt := range tests {
+		now, _ := time.ParseInLocation("15:04", tt.now, time.Local)
+		p := newPolicy(storage.NewEphemeralStorage(), func() time.Time { return now }, nil)
+		if within := p.TimeWithin(tt.start, tt.end); within != tt.within {
+			t.Errorf("test %d: %s within %s-%s: have %v, want %v", i, tt.now, tt.start, tt.end, within, tt.within)
+		}
+	}
+}
+
+// Tests that the rules can use the policy primitives, and that signed
+// transactions are accounted against the budgets.
+func TestPolicyRules(t *testing.T) {
+	js := `
+	policy.AllowCall("0x000000000000000000000000000000000000dead", "transfer(address,uint256)")
+
+	function ApproveTx(r){
+		var tx = r.transaction
+		if(!policy.SentWithin(tx.from, tx.value, "1000000000000000000", "24h")){
+			return "Reject"
+		}
+		if(tx.data && tx.data != "0x" && !policy.CallAllowed(tx.to, tx.data)){
+			return "Reject"
+		}
+		return "Approve"
+	}`
+	ruleset, err := initRuleEngine(js)
+	if err != nil {
+		t.Fatalf("failed to create ruleset: %v", err)
+	}
+	key, _ := crypto.GenerateKey()
+	from := common.NewMixedcaseAddress(crypto.PubkeyToAddress(key.PublicKey))
+	to := common.NewMixedcaseAddress(common.HexToAddress("0xb0b"))
+
+	request := func(value int64) *core.SignTxRequest {
+		return &core.SignTxRequest{Transaction: core.SendTxArgs{From: from, To: &to, Value: hexutil.Big(*big.NewInt(value))}}
+	}
+	if resp, _ := ruleset.ApproveTx(request(6e17)); !resp.Approved {
+		t.Fatalf("transfer within budget rejected")
+	}
+	// Sign the transfer and notify the ruleset about it
+	tx, _ := types.SignTx(types.NewTransaction(0, to.Address(), big.NewInt(6e17), 21000, big.NewInt(1), nil), types.NewEIP155Signer(big.NewInt(1)), key)
+	ruleset.OnApprovedTx(ethapi.SignTransactionResult{Tx: tx})
+
+	if resp, _ := ruleset.ApproveTx(request(6e17)); resp.Approved {
+		t.Errorf("transfer exceeding budget approved")
+	}
+	if resp, _ := ruleset.ApproveTx(request(4e17)); !resp.Approved {
+		t.Errorf("transfer within remaining budget rejected")
+	}
+}
+
+// Tests that concurrently approved transfers can't overdraw a budget, and that
+// the reservations of transfers which are never signed expire.
+func TestPolicyConcurrentApprovals(t *testing.T) {
+	js := `
+	function ApproveTx(r){
+		var tx = r.transaction
+		if(!policy.SentWithin(tx.from, tx.value, "1000000000000000000", "24h")){
+			return "Reject"
+		}
+		return "Approve"
+	}`
+	ruleset, err := initRuleEngine(js)
+	if err != nil {
+		t.Fatalf("failed to create ruleset: %v", err)
+	}
+	now := time.Unix(1000000, 0)
+	ruleset.now = func() time.Time { return now }
+
+	from := common.NewMixedcaseAddress(common.HexToAddress("0xa11ce"))
+	to := common.NewMixedcaseAddress(common.HexToAddress("0xb0b"))
+	request := &core.SignTxRequest{Transaction: core.SendTxArgs{From: from, To: &to, Value: hexutil.Big(*big.NewInt(6e17))}}
+
+	var (
+		wg       sync.WaitGroup
+		approved = make(chan bool, 2)
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _ := ruleset.ApproveTx(request)
+			approved <- resp.Approved
+		}()
+	}
+	wg.Wait()
+	close(approved)
+
+	count := 0
+	for ok := range approved {
+		if ok {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Fatalf("approved transfer count mismatch: have %d, want 1", count)
+	}
+	// The approved transfer was never signed, its reservation must expire
+	now = now.Add(reservationTimeout - time.Second)
+	if resp, _ := ruleset.ApproveTx(request); resp.Approved {
+		t.Errorf("transfer over the reserved budget approved")
+	}
+	now = now.Add(time.Second)
+	if resp, _ := ruleset.ApproveTx(request); !resp.Approved {
+		t.Errorf("transfer within the released budget rejected")
+	}
+}
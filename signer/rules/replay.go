@@ -0,0 +1,339 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core"
+	"github.com/ethereum/go-ethereum/signer/storage"
+)
+
+// auditTimeFormat is the format of the timestamps in the audit log.
+const auditTimeFormat = "2006-01-02T15:04:05-0700"
+
+// Verdicts of a ruleset on a replayed request.
+const (
+	VerdictApprove = "Approve"
+	VerdictReject  = "Reject"
+	VerdictManual  = "Manual"
+)
+
+var (
+	// errUnterminatedQuote is returned if a quoted audit log value is not closed.
+	errUnterminatedQuote = errors.New("unterminated quoted value")
+
+	// errInterleavedRequests is returned if an audit log without request ids has
+	// multiple requests of the same method pending, which can't be told apart.
+	errInterleavedRequests = errors.New("interleaved requests without ids")
+)
+
+// ReplayResult is the outcome of evaluating a signing request from the audit
+// log against a ruleset.
+type ReplayResult struct {
+	Time     time.Time // Time of the request
+	Method   string    // Audited API method
+	Request  string    // Summary of the request
+	Original string    // Outcome recorded in the audit log: "signed" or the error
+	Verdict  string    // Outcome under the ruleset: Approve, Reject or Manual
+}
+
+// replayUI is the manual processing fallback of a replayed ruleset, recording
+// that the ruleset didn't decide.
+type replayUI struct {
+	core.SignerUI
+	manual bool
+}
+
+func (ui *replayUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
+	ui.manual = true
+	return core.SignTxResponse{Transaction: request.Transaction}, nil
+}
+
+func (ui *replayUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
+	ui.manual = true
+	return core.SignDataResponse{}, nil
+}
+
+func (ui *replayUI) ShowError(message string) {}
+func (ui *replayUI) ShowInfo(message string)  {}
+
+// auditEntry is a request found in the audit log.
+type auditEntry struct {
+	id     string // Request id, empty in audit logs of older versions
+	time   time.Time
+	fields map[string]string
+}
+
+// Replay evaluates the signing requests recorded in an audit log against the
+// ruleset, at the time they were made.
+//
+// The value budgets of the policy are simulated from scratch: a transaction is
+// accounted as spent if the ruleset approves it, or if it goes to manual
+// processing and was originally signed. Requests which can't be reconstructed
+// from the audit log, such as typed data, are skipped.
+//
+// Responses are matched with their requests by the request id. Audit logs of
+// older versions lack the ids, they can only be replayed as long as requests of
+// the same method don't overlap.
+func Replay(auditlog io.Reader, jsRules string) ([]*ReplayResult, error) {
+	ui := new(replayUI)
+	ruleset, err := NewRuleEvaluator(ui, storage.NewEphemeralStorage(), storage.NewEphemeralStorage())
+	if err != nil {
+		return nil, err
+	}
+	if err := ruleset.Init(jsRules); err != nil {
+		return nil, err
+	}
+	var now time.Time
+	ruleset.now = func() time.Time { return now }
+
+	var (
+		results []*ReplayResult
+		pending = make(map[string][]*auditEntry) // Requests awaiting their response, by method
+	)
+	scanner := bufio.NewScanner(auditlog)
+	scanner.Buffer(nil, 16*1024*1024)
+
+	for line := 1; scanner.Scan(); line++ {
+		fields, err := parseLogfmt(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		method := fields["msg"]
+
+		switch fields["type"] {
+		case "":
+			// Request ids restart with the signer, drop the requests of the previous run
+			if method == "Configured" {
+				pending = make(map[string][]*auditEntry)
+			}
+
+		case "request":
+			t, err := time.Parse(auditTimeFormat, fields["t"])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid time: %v", line, err)
+			}
+			pending[method] = append(pending[method], &auditEntry{id: fields["id"], time: t, fields: fields})
+
+		case "response":
+			queue, id := pending[method], fields["id"]
+			if id == "" && len(queue) > 1 {
+				return nil, fmt.Errorf("line %d: %v", line, errInterleavedRequests)
+			}
+			index := -1
+			for i, entry := range queue {
+				if entry.id == id {
+					index = i
+					break
+				}
+			}
+			if index < 0 {
+				continue
+			}
+			entry := queue[index]
+			pending[method] = append(queue[:index], queue[index+1:]...)
+
+			original := "signed"
+			if e := fields["error"]; e != "nil" {
+				original = e
+			}
+			now = entry.time
+			result, err := replayRequest(ruleset, ui, method, entry.fields, original)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", line, err)
+			}
+			if result != nil {
+				result.Time = entry.time
+				results = append(results, result)
+			}
+		}
+	}
+	return results, scanner.Err()
+}
+
+// replayRequest evaluates a single audited request against the ruleset. Nil is
+// returned for methods which aren't replayed.
+func replayRequest(ruleset *rulesetUI, ui *replayUI, method string, fields map[string]string, original string) (*ReplayResult, error) {
+	var meta core.Metadata
+	if err := json.Unmarshal([]byte(fields["metadata"]), &meta); err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	result := &ReplayResult{Method: method, Original: original}
+	ui.manual = false
+
+	switch method {
+	case "SignTransaction":
+		var args core.SendTxArgs
+		if err := json.Unmarshal([]byte(fields["tx"]), &args); err != nil {
+			return nil, fmt.Errorf("invalid transaction: %v", err)
+		}
+		to := "<contract creation>"
+		if args.To != nil {
+			to = args.To.Address().Hex()
+		}
+		result.Request = fmt.Sprintf("from %s to %s value %v", args.From.Address().Hex(), to, args.Value.ToInt())
+
+		res, err := ruleset.ApproveTx(&core.SignTxRequest{Transaction: args, Meta: meta})
+		if err != nil {
+			return nil, err
+		}
+		result.Verdict = verdict(res.Approved, ui.manual)
+
+		// Account the transfer if it would have been signed
+		if result.Verdict == VerdictApprove || (result.Verdict == VerdictManual && original == "signed") {
+			var recipient *common.Address
+			if args.To != nil {
+				addr := args.To.Address()
+				recipient = &addr
+			}
+			ruleset.lock.Lock()
+			ruleset.settle(args.From.Address(), recipient, args.Value.ToInt())
+			ruleset.lock.Unlock()
+		}
+		return result, nil
+
+	case "Sign", "SignData":
+		addr, err := parseAuditAddress(fields["addr"])
+		if err != nil {
+			return nil, err
+		}
+		data, err := hexutil.Decode("0x" + fields["data"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid data: %v", err)
+		}
+		var req *core.SignDataRequest
+		if method == "Sign" {
+			hash, msg := core.SignHash(data)
+			req = &core.SignDataRequest{Address: addr, Rawdata: data, Message: msg, Hash: hash}
+			result.Request = fmt.Sprintf("%s: %q", addr.Address().Hex(), data)
+		} else {
+			contentType := fields["contentType"]
+			if req, err = core.NewSignDataRequest(contentType, addr, data); err != nil {
+				return nil, err
+			}
+			result.Request = fmt.Sprintf("%s: %s %x", addr.Address().Hex(), contentType, data)
+		}
+		req.Meta = meta
+
+		res, err := ruleset.ApproveSignData(req)
+		if err != nil {
+			return nil, err
+		}
+		result.Verdict = verdict(res.Approved, ui.manual)
+		return result, nil
+	}
+	return nil, nil
+}
+
+// verdict converts the response of the ruleset into a verdict.
+func verdict(approved, manual bool) string {
+	switch {
+	case manual:
+		return VerdictManual
+	case approved:
+		return VerdictApprove
+	default:
+		return VerdictReject
+	}
+}
+
+// parseAuditAddress parses an address as rendered in the audit log, followed by
+// its checksum status.
+func parseAuditAddress(s string) (common.MixedcaseAddress, error) {
+	if i := strings.IndexByte(s, ' '); i >= 0 {
+		s = s[:i]
+	}
+	addr, err := common.NewMixedcaseAddressFromString(s)
+	if err != nil {
+		return common.MixedcaseAddress{}, fmt.Errorf("invalid address %q: %v", s, err)
+	}
+	return *addr, nil
+}
+
+// parseLogfmt splits an audit log line into its key-value pairs, reverting the
+// quoting and escaping of the log package.
+func parseLogfmt(line string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for {
+		line = strings.TrimLeft(line, " ")
+		if line == "" {
+			return fields, nil
+		}
+		eq := strings.IndexByte(line, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("missing value for %q", line)
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var raw string
+		if strings.HasPrefix(line, `"`) {
+			end := 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, errUnterminatedQuote
+			}
+			raw, line = line[1:end], line[end+1:]
+		} else {
+			end := strings.IndexByte(line, ' ')
+			if end < 0 {
+				end = len(line)
+			}
+			raw, line = line[:end], line[end:]
+		}
+		fields[key] = unescapeLogfmt(raw)
+	}
+}
+
+// unescapeLogfmt reverts the escaping of a logfmt value.
+func unescapeLogfmt(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
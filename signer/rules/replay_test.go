@@ -0,0 +1,224 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of go-ethereum.
+//
+// go-ethereum is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// go-ethereum is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with go-ethereum. If not, see <http://www.gnu.org/licenses/>.
+
+package rules
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/internal/ethapi"
+	"github.com/ethereum/go-ethereum/signer/core"
+)
+
+// auditedAPI is a signer backend signing everything but what it's told to deny.
+type auditedAPI struct {
+	core.ExternalAPI
+	deny bool
+}
+
+func (api *auditedAPI) SignTransaction(ctx context.Context, args core.SendTxArgs, methodSelector *string) (*ethapi.SignTransactionResult, error) {
+	if api.deny {
+		return nil, core.ErrRequestDenied
+	}
+	return &ethapi.SignTransactionResult{Raw: hexutil.Bytes{0x01}}, nil
+}
+
+func (api *auditedAPI) Sign(ctx context.Context, addr common.MixedcaseAddress, data hexutil.Bytes) (hexutil.Bytes, error) {
+	if api.deny {
+		return nil, core.ErrRequestDenied
+	}
+	return make(hexutil.Bytes, 65), nil
+}
+
+// Tests that the requests of an audit log are replayed against a ruleset, with
+// the value budgets simulated along the way.
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clef-replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	backend := new(auditedAPI)
+	audit, err := core.NewAuditLogger(path, backend)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	var (
+		ctx  = context.Background()
+		from = common.NewMixedcaseAddress(common.HexToAddress("0xa11ce"))
+		to   = common.NewMixedcaseAddress(common.HexToAddress("0xb0b"))
+	)
+	transfer := func(value int64, deny bool) {
+		backend.deny = deny
+		audit.SignTransaction(ctx, core.SendTxArgs{From: from, To: &to, Value: hexutil.Big(*big.NewInt(value))}, nil)
+	}
+	transfer(6e17, false) // approved, accounted
+	transfer(6e17, false) // rejected, over budget
+	transfer(3e17, true)  // approved, though originally denied
+	backend.deny = false
+	audit.Sign(ctx, from, []byte("hello"))
+
+	js := `
+	function ApproveTx(r){
+		var tx = r.transaction
+		if(policy.SentWithin(tx.from, tx.value, "1000000000000000000", "24h")){
+			return "Approve"
+		}
+		return "Reject"
+	}`
+	log, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+
+	results, err := Replay(log, js)
+	if err != nil {
+		t.Fatalf("failed to replay audit log: %v", err)
+	}
+	want := []struct {
+		method, original, verdict string
+	}{
+		{"SignTransaction", "signed", VerdictApprove},
+		{"SignTransaction", "signed", VerdictReject},
+		{"SignTransaction", core.ErrRequestDenied.Error(), VerdictApprove},
+		{"Sign", "signed", VerdictManual},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(want))
+	}
+	for i, res := range results {
+		if res.Method != want[i].method || res.Original != want[i].original || res.Verdict != want[i].verdict {
+			t.Errorf("result %d mismatch: have %s/%q/%s, want %s/%q/%s", i,
+				res.Method, res.Original, res.Verdict, want[i].method, want[i].original, want[i].verdict)
+		}
+	}
+}
+
+// Tests that responses are matched with their requests by id when requests of
+// the same method complete out of order, and that such logs are refused if they
+// lack the ids.
+func TestReplayInterleaved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "clef-replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	backend := new(auditedAPI)
+	audit, err := core.NewAuditLogger(path, backend)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	var (
+		ctx  = context.Background()
+		from = common.NewMixedcaseAddress(common.HexToAddress("0xa11ce"))
+		to   = common.NewMixedcaseAddress(common.HexToAddress("0xb0b"))
+	)
+	backend.deny = true
+	audit.SignTransaction(ctx, core.SendTxArgs{From: from, To: &to, Value: hexutil.Big(*big.NewInt(1))}, nil)
+	backend.deny = false
+	audit.SignTransaction(ctx, core.SendTxArgs{From: from, To: &to, Value: hexutil.Big(*big.NewInt(2))}, nil)
+
+	// Reorder the log as if the second request completed before the first
+	blob, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(blob)), "\n")
+	if len(lines) != 5 {
+		t.Fatalf("audit log line count mismatch: have %d, want 5", len(lines))
+	}
+	lines[2], lines[3], lines[4] = lines[3], lines[4], lines[2]
+	interleaved := strings.Join(lines, "\n")
+
+	results, err := Replay(strings.NewReader(interleaved), `function ApproveTx(r){ return "Approve" }`)
+	if err != nil {
+		t.Fatalf("failed to replay audit log: %v", err)
+	}
+	want := []struct {
+		value    int64
+		original string
+	}{
+		{2, "signed"},
+		{1, core.ErrRequestDenied.Error()},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("result count mismatch: have %d, want %d", len(results), len(want))
+	}
+	for i, res := range results {
+		if !strings.HasSuffix(res.Request, fmt.Sprintf("value %d", want[i].value)) || res.Original != want[i].original {
+			t.Errorf("result %d mismatch: have %q/%q, want value %d/%q", i, res.Request, res.Original, want[i].value, want[i].original)
+		}
+	}
+	// Without the request ids, the responses can't be told apart
+	legacy := regexp.MustCompile(` id=\d+`).ReplaceAllString(interleaved, "")
+	if _, err := Replay(strings.NewReader(legacy), `function ApproveTx(r){ return "Approve" }`); err == nil || !strings.Contains(err.Error(), errInterleavedRequests.Error()) {
+		t.Fatalf("legacy interleaved log: expected error %v, got %v", errInterleavedRequests, err)
+	}
+}
+
+func TestParseLogfmt(t *testing.T) {
+	tests := []struct {
+		line   string
+		fields map[string]string
+		err    error
+	}{
+		{
+			line:   `t=2018-10-01T12:00:00+0000 lvl=info msg=Sign api=signer type=request`,
+			fields: map[string]string{"t": "2018-10-01T12:00:00+0000", "lvl": "info", "msg": "Sign", "api": "signer", "type": "request"},
+		},
+		{
+			line:   `msg=SignTransaction tx="{\"from\":\"0x01\",\"data\":\"a\\\\b\"}" error=nil`,
+			fields: map[string]string{"msg": "SignTransaction", "tx": `{"from":"0x01","data":"a\\b"}`, "error": "nil"},
+		},
+		{
+			line:   `addr="0xB0B [chksum ok]"  data=`,
+			fields: map[string]string{"addr": "0xB0B [chksum ok]", "data": ""},
+		},
+		{
+			line: `msg="unterminated`,
+			err:  errUnterminatedQuote,
+		},
+	}
+	for i, tt := range tests {
+		fields, err := parseLogfmt(tt.line)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(fields, tt.fields) {
+			t.Errorf("test %d: fields mismatch: have %v, want %v", i, fields, tt.fields)
+		}
+	}
+	if _, err := parseLogfmt("novalue"); err == nil {
+		t.Errorf("missing value accepted")
+	}
+}
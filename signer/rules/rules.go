@@ -19,10 +19,14 @@ package rules
 import (
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"os"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/signer/core"
@@ -35,6 +39,31 @@ var (
 	BigNumber_JS = deps.MustAsset("bignumber.js")
 )
 
+// reservationTimeout is how long the value of an approved transaction is held
+// against the budgets while awaiting its signature. Reservations of requests
+// which fail to sign are released once it passes.
+const reservationTimeout = time.Minute
+
+// reservation is the value of an approved transaction, held against the value
+// budgets until the transaction is signed.
+type reservation struct {
+	from    common.Address
+	to      *common.Address
+	value   *big.Int
+	expires time.Time
+}
+
+// matches reports whether the reservation is for the given transfer.
+func (res *reservation) matches(from common.Address, to *common.Address, value *big.Int) bool {
+	if res.from != from || res.value.Cmp(value) != 0 {
+		return false
+	}
+	if res.to == nil || to == nil {
+		return res.to == nil && to == nil
+	}
+	return *res.to == *to
+}
+
 // consoleOutput is an override for the console.log and console.error methods to
 // stream the output into the configured output stream instead of stdout.
 func consoleOutput(call otto.FunctionCall) otto.Value {
@@ -52,7 +81,11 @@ type rulesetUI struct {
 	next        core.SignerUI // The next handler, for manual processing
 	storage     storage.Storage
 	credentials storage.Storage
-	jsRules     string // The rules to use
+	jsRules     string           // The rules to use
+	now         func() time.Time // Clock of the policy primitives, overridden in replays
+
+	lock    sync.Mutex     // Serializes rule executions with the budget reservations
+	pending []*reservation // Approved transfers awaiting their signature
 }
 
 func NewRuleEvaluator(next core.SignerUI, jsbackend, credentialsBackend storage.Storage) (*rulesetUI, error) {
@@ -61,6 +94,7 @@ func NewRuleEvaluator(next core.SignerUI, jsbackend, credentialsBackend storage.
 		storage:     jsbackend,
 		credentials: credentialsBackend,
 		jsRules:     "",
+		now:         time.Now,
 	}
 
 	return c, nil
@@ -70,6 +104,8 @@ func (r *rulesetUI) Init(javascriptRules string) error {
 	r.jsRules = javascriptRules
 	return nil
 }
+
+// execute runs a method of the rules. The lock must be held.
 func (r *rulesetUI) execute(jsfunc string, jsarg interface{}) (otto.Value, error) {
 
 	// Instantiate a fresh vm engine every time
@@ -79,6 +115,7 @@ func (r *rulesetUI) execute(jsfunc string, jsarg interface{}) (otto.Value, error
 	consoleObj.Object().Set("log", consoleOutput)
 	consoleObj.Object().Set("error", consoleOutput)
 	vm.Set("storage", r.storage)
+	vm.Set("policy", newPolicy(r.storage, r.now, r.pending))
 
 	// Load bootstrap libraries
 	script, err := vm.Compile("bignumber.js", BigNumber_JS)
@@ -141,7 +178,16 @@ func (r *rulesetUI) checkApproval(jsfunc string, jsarg []byte, err error) (bool,
 
 func (r *rulesetUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse, error) {
 	jsonreq, err := json.Marshal(request)
+
+	// Reserve the value of approved transfers before releasing the lock, so that
+	// concurrent requests can't pass the same budget checks
+	r.lock.Lock()
 	approved, err := r.checkApproval("ApproveTx", jsonreq, err)
+	if err == nil && approved {
+		r.reserve(request.Transaction)
+	}
+	r.lock.Unlock()
+
 	if err != nil {
 		log.Info("Rule-based approval error, going to manual", "error", err)
 		return r.next.ApproveTx(request)
@@ -158,13 +204,52 @@ func (r *rulesetUI) ApproveTx(request *core.SignTxRequest) (core.SignTxResponse,
 	return core.SignTxResponse{Approved: false}, err
 }
 
+// reserve holds the value of an approved transaction against the budgets until
+// it's signed or the reservation expires. The lock must be held.
+func (r *rulesetUI) reserve(args core.SendTxArgs) {
+	now := r.now()
+
+	pending := r.pending[:0]
+	for _, res := range r.pending {
+		if res.expires.After(now) {
+			pending = append(pending, res)
+		}
+	}
+	r.pending = pending
+
+	value := args.Value.ToInt()
+	if value.Sign() == 0 {
+		return
+	}
+	res := &reservation{from: args.From.Address(), value: new(big.Int).Set(value), expires: now.Add(reservationTimeout)}
+	if args.To != nil {
+		to := args.To.Address()
+		res.to = &to
+	}
+	r.pending = append(r.pending, res)
+}
+
+// settle accounts a signed transfer against the budgets, replacing its pending
+// reservation. The lock must be held.
+func (r *rulesetUI) settle(from common.Address, to *common.Address, value *big.Int) {
+	for i, res := range r.pending {
+		if res.matches(from, to, value) {
+			r.pending = append(r.pending[:i], r.pending[i+1:]...)
+			break
+		}
+	}
+	newPolicy(r.storage, r.now, r.pending).record(from, to, value)
+}
+
 func (r *rulesetUI) lookupPassword(address common.Address) string {
 	return r.credentials.Get(strings.ToLower(address.String()))
 }
 
 func (r *rulesetUI) ApproveSignData(request *core.SignDataRequest) (core.SignDataResponse, error) {
 	jsonreq, err := json.Marshal(request)
+	r.lock.Lock()
 	approved, err := r.checkApproval("ApproveSignData", jsonreq, err)
+	r.lock.Unlock()
 	if err != nil {
 		log.Info("Rule-based approval error, going to manual", "error", err)
 		return r.next.ApproveSignData(request)
@@ -177,7 +262,9 @@ func (r *rulesetUI) ApproveSignData(request *core.SignDataRequest) (core.SignDat
 
 func (r *rulesetUI) ApproveExport(request *core.ExportRequest) (core.ExportResponse, error) {
 	jsonreq, err := json.Marshal(request)
+	r.lock.Lock()
 	approved, err := r.checkApproval("ApproveExport", jsonreq, err)
+	r.lock.Unlock()
 	if err != nil {
 		log.Info("Rule-based approval error, going to manual", "error", err)
 		return r.next.ApproveExport(request)
@@ -196,7 +283,9 @@ func (r *rulesetUI) ApproveImport(request *core.ImportRequest) (core.ImportRespo
 
 func (r *rulesetUI) ApproveListing(request *core.ListRequest) (core.ListResponse, error) {
 	jsonreq, err := json.Marshal(request)
+	r.lock.Lock()
 	approved, err := r.checkApproval("ApproveListing", jsonreq, err)
+	r.lock.Unlock()
 	if err != nil {
 		log.Info("Rule-based approval error, going to manual", "error", err)
 		return r.next.ApproveListing(request)
@@ -229,6 +318,10 @@ func (r *rulesetUI) OnSignerStartup(info core.StartupInfo) {
 		return
 	}
 	r.next.OnSignerStartup(info)
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
 	_, err = r.execute("OnSignerStartup", string(jsonInfo))
 	if err != nil {
 		log.Info("error occurred during execution", "error", err)
@@ -236,6 +329,21 @@ func (r *rulesetUI) OnSignerStartup(info core.StartupInfo) {
 }
 
 func (r *rulesetUI) OnApprovedTx(tx ethapi.SignTransactionResult) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	// Account the transfer against the value budgets of the policy
+	if tx.Tx != nil {
+		signer := types.Signer(types.HomesteadSigner{})
+		if tx.Tx.Protected() {
+			signer = types.NewEIP155Signer(tx.Tx.ChainId())
+		}
+		if from, err := types.Sender(signer, tx.Tx); err == nil {
+			r.settle(from, tx.Tx.To(), tx.Tx.Value())
+		} else {
+			log.Warn("Failed to derive transaction sender", "err", err)
+		}
+	}
 	jsonTx, err := json.Marshal(tx)
 	if err != nil {
 		log.Warn("failed marshalling transaction", "tx", tx)
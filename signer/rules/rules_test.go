@@ -29,6 +29,7 @@ import (
 	"github.com/ethereum/go-ethereum/internal/ethapi"
 	"github.com/ethereum/go-ethereum/signer/core"
 	"github.com/ethereum/go-ethereum/signer/storage"
+	"github.com/ethereum/go-ethereum/signer/typeddata"
 )
 
 const JS = `
@@ -629,3 +630,50 @@ function ApproveSignData(r){
 		t.Fatalf("Expected approved")
 	}
 }
+
+func TestSignTypedData(t *testing.T) {
+
+	js := `function ApproveListing(){
+    return "Approve"
+}
+function ApproveSignData(r){
+    if(r.typed_data && r.typed_data.domain.name == "Ether Mail" && r.typed_data.message.to.name == "Bob"){
+        return "Approve"
+    }
+    return "Reject"
+}`
+	r, err := initRuleEngine(js)
+	if err != nil {
+		t.Errorf("Couldn't create evaluator %v", err)
+		return
+	}
+	addr, _ := mixAddr("0x694267f14675d7e1b9494fd8d72fefe1755710fa")
+	for _, to := range []string{"Bob", "Mallory"} {
+		data := typeddata.TypedData{
+			Types: typeddata.Types{
+				"EIP712Domain": {{Name: "name", Type: "string"}},
+				"Person":       {{Name: "name", Type: "string"}},
+				"Mail":         {{Name: "to", Type: "Person"}},
+			},
+			PrimaryType: "Mail",
+			Domain:      typeddata.Domain{Name: "Ether Mail"},
+			Message:     map[string]interface{}{"to": map[string]interface{}{"name": to}},
+		}
+		hash, err := data.SigningHash()
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		resp, err := r.ApproveSignData(&core.SignDataRequest{
+			Address:   *addr,
+			TypedData: &data,
+			Hash:      hash[:],
+			Meta:      core.Metadata{Remote: "remoteip", Local: "localip", Scheme: "inproc"},
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if resp.Approved != (to == "Bob") {
+			t.Errorf("Recipient %s: approval mismatch: have %v", to, resp.Approved)
+		}
+	}
+}
@@ -17,10 +17,6 @@
 
 package storage
 
-import (
-	"fmt"
-)
-
 type Storage interface {
 	// Put stores a value by key. 0-length keys results in no-op
 	Put(key, value string)
@@ -39,7 +35,6 @@ func (s *EphemeralStorage) Put(key, value string) {
 	if len(key) == 0 {
 		return
 	}
-	fmt.Printf("storage: put %v -> %v\n", key, value)
 	s.data[key] = value
 }
 
@@ -47,7 +42,6 @@ func (s *EphemeralStorage) Get(key string) string {
 	if len(key) == 0 {
 		return ""
 	}
-	fmt.Printf("storage: get %v\n", key)
 	if v, exist := s.data[key]; exist {
 		return v
 	}
@@ -0,0 +1,537 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package typeddata implements the hashing of typed structured data for signing,
+// as specified by EIP-712.
+package typeddata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// DomainType is the name of the type describing the signing domain.
+const DomainType = "EIP712Domain"
+
+// maxDepth is the maximum nesting depth of structs and arrays, protecting
+// against recursive type definitions.
+const maxDepth = 32
+
+var (
+	errNoDomainType    = errors.New("missing " + DomainType + " type")
+	errNoPrimaryType   = errors.New("missing primary type")
+	errTooDeep         = errors.New("data nesting too deep")
+	errUnexpectedValue = errors.New("unexpected value")
+
+	// nameRegexp matches valid type and field names.
+	nameRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*$`)
+	// arrayRegexp splits an array type into its element type and length.
+	arrayRegexp = regexp.MustCompile(`^(.+)\[([0-9]*)\]$`)
+)
+
+// Type is a single field of a struct type.
+type Type struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Types are the struct type definitions, keyed by type name.
+type Types map[string][]Type
+
+// Domain is the signing domain, distinguishing the messages of different
+// applications. Only the fields listed in the EIP712Domain type are used.
+type Domain struct {
+	Name              string                `json:"name,omitempty"`
+	Version           string                `json:"version,omitempty"`
+	ChainId           *math.HexOrDecimal256 `json:"chainId,omitempty"`
+	VerifyingContract string                `json:"verifyingContract,omitempty"`
+	Salt              string                `json:"salt,omitempty"`
+}
+
+// UnmarshalJSON decodes a domain, accepting the chain id both as a number and
+// as a decimal or hex string.
+func (d *Domain) UnmarshalJSON(input []byte) error {
+	type domain Domain
+	var dec struct {
+		domain
+		ChainId json.RawMessage `json:"chainId,omitempty"`
+	}
+	if err := json.Unmarshal(input, &dec); err != nil {
+		return err
+	}
+	*d = Domain(dec.domain)
+	if len(dec.ChainId) > 0 && string(dec.ChainId) != "null" {
+		text := bytes.Trim(dec.ChainId, `"`)
+		d.ChainId = new(math.HexOrDecimal256)
+		if err := d.ChainId.UnmarshalText(text); err != nil {
+			return fmt.Errorf("invalid chainId: %v", err)
+		}
+	}
+	return nil
+}
+
+// Map returns the set fields of the domain.
+func (d *Domain) Map() map[string]interface{} {
+	m := make(map[string]interface{})
+	if d.Name != "" {
+		m["name"] = d.Name
+	}
+	if d.Version != "" {
+		m["version"] = d.Version
+	}
+	if d.ChainId != nil {
+		m["chainId"] = (*big.Int)(d.ChainId)
+	}
+	if d.VerifyingContract != "" {
+		m["verifyingContract"] = d.VerifyingContract
+	}
+	if d.Salt != "" {
+		m["salt"] = d.Salt
+	}
+	return m
+}
+
+// TypedData is a message of typed structured data, as passed to signTypedData.
+type TypedData struct {
+	Types       Types                  `json:"types"`
+	PrimaryType string                 `json:"primaryType"`
+	Domain      Domain                 `json:"domain"`
+	Message     map[string]interface{} `json:"message"`
+}
+
+// UnmarshalJSON decodes typed data, keeping numbers of the message exact.
+func (td *TypedData) UnmarshalJSON(input []byte) error {
+	type typedData TypedData
+	var dec typedData
+
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	if err := decoder.Decode(&dec); err != nil {
+		return err
+	}
+	*td = TypedData(dec)
+	return nil
+}
+
+// Validate checks that the type definitions are well formed and that all the
+// referenced types are defined.
+func (td *TypedData) Validate() error {
+	if _, ok := td.Types[DomainType]; !ok {
+		return errNoDomainType
+	}
+	if _, ok := td.Types[td.PrimaryType]; !ok || td.PrimaryType == "" {
+		return errNoPrimaryType
+	}
+	for name, fields := range td.Types {
+		if !nameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid type name %q", name)
+		}
+		if isAtomic(name) {
+			return fmt.Errorf("type %q shadows an atomic type", name)
+		}
+		seen := make(map[string]bool)
+		for _, field := range fields {
+			if !nameRegexp.MatchString(field.Name) {
+				return fmt.Errorf("type %s: invalid field name %q", name, field.Name)
+			}
+			if seen[field.Name] {
+				return fmt.Errorf("type %s: duplicate field %q", name, field.Name)
+			}
+			seen[field.Name] = true
+
+			elem := elementType(field.Type)
+			if _, ok := td.Types[elem]; !ok && !isAtomic(elem) {
+				return fmt.Errorf("type %s: field %s has unknown type %q", name, field.Name, field.Type)
+			}
+		}
+	}
+	return nil
+}
+
+// SigningHash returns the hash to be signed for the typed data:
+//
+//	keccak256("\x19\x01" ‖ domainSeparator ‖ hashStruct(message))
+func (td *TypedData) SigningHash() (common.Hash, error) {
+	if err := td.Validate(); err != nil {
+		return common.Hash{}, err
+	}
+	domain, err := td.HashStruct(DomainType, td.Domain.Map())
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("domain: %v", err)
+	}
+	message, err := td.HashStruct(td.PrimaryType, td.Message)
+	if err != nil {
+		return common.Hash{}, fmt.Errorf("message: %v", err)
+	}
+	return crypto.Keccak256Hash([]byte("\x19\x01"), domain[:], message[:]), nil
+}
+
+// HashStruct returns the hash of a struct value of the given type.
+func (td *TypedData) HashStruct(typ string, data map[string]interface{}) (common.Hash, error) {
+	enc, err := td.encodeData(typ, data, 0)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	return crypto.Keccak256Hash(enc), nil
+}
+
+// TypeHash returns the hash of the encoded type.
+func (td *TypedData) TypeHash(typ string) common.Hash {
+	return crypto.Keccak256Hash([]byte(td.EncodeType(typ)))
+}
+
+// EncodeType returns the encoding of a struct type, followed by the encodings
+// of the struct types it references, sorted by name:
+//
+//	Mail(Person from,Person to,string contents)Person(string name,address wallet)
+func (td *TypedData) EncodeType(typ string) string {
+	deps := td.dependencies(typ, nil)
+	sort.Strings(deps[1:])
+
+	var buf bytes.Buffer
+	for _, dep := range deps {
+		fields := make([]string, len(td.Types[dep]))
+		for i, field := range td.Types[dep] {
+			fields[i] = field.Type + " " + field.Name
+		}
+		buf.WriteString(dep + "(" + strings.Join(fields, ",") + ")")
+	}
+	return buf.String()
+}
+
+// dependencies returns the struct type along with all the struct types it
+// references, directly or indirectly, each of them once.
+func (td *TypedData) dependencies(typ string, found []string) []string {
+	typ = elementType(typ)
+	if _, ok := td.Types[typ]; !ok {
+		return found
+	}
+	for _, dep := range found {
+		if dep == typ {
+			return found
+		}
+	}
+	found = append(found, typ)
+	for _, field := range td.Types[typ] {
+		found = td.dependencies(field.Type, found)
+	}
+	return found
+}
+
+// encodeData returns the encoding of a struct value: its type hash followed by
+// the encodings of the field values.
+func (td *TypedData) encodeData(typ string, data map[string]interface{}, depth int) ([]byte, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	fields, ok := td.Types[typ]
+	if !ok {
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+	if len(data) > len(fields) {
+		return nil, fmt.Errorf("%s: more values than fields", typ)
+	}
+	buf := bytes.NewBuffer(td.TypeHash(typ).Bytes())
+	for _, field := range fields {
+		value, ok := data[field.Name]
+		if !ok {
+			return nil, fmt.Errorf("%s: missing value for field %s", typ, field.Name)
+		}
+		enc, err := td.encodeValue(field.Type, value, depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, field.Name, err)
+		}
+		buf.Write(enc)
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeValue returns the 32 byte encoding of a field value.
+func (td *TypedData) encodeValue(typ string, value interface{}, depth int) ([]byte, error) {
+	// Arrays are encoded as the hash of the concatenated element encodings
+	if m := arrayRegexp.FindStringSubmatch(typ); m != nil {
+		if depth > maxDepth {
+			return nil, errTooDeep
+		}
+		items, ok := value.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v for array type %s", errUnexpectedValue, typ)
+		}
+		if m[2] != "" {
+			if n, _ := strconv.Atoi(m[2]); n != len(items) {
+				return nil, fmt.Errorf("array length mismatch: have %d, want %d", len(items), n)
+			}
+		}
+		var buf bytes.Buffer
+		for i, item := range items {
+			enc, err := td.encodeValue(m[1], item, depth+1)
+			if err != nil {
+				return nil, fmt.Errorf("item %d: %v", i, err)
+			}
+			buf.Write(enc)
+		}
+		return crypto.Keccak256(buf.Bytes()), nil
+	}
+	// Structs are encoded as their hash
+	if _, ok := td.Types[typ]; ok {
+		data, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%v for struct type %s", errUnexpectedValue, typ)
+		}
+		enc, err := td.encodeData(typ, data, depth)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(enc), nil
+	}
+	return encodeAtomic(typ, value)
+}
+
+// encodeAtomic returns the 32 byte encoding of an atomic value.
+func encodeAtomic(typ string, value interface{}) ([]byte, error) {
+	switch {
+	case typ == "string":
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%v for string", errUnexpectedValue)
+		}
+		return crypto.Keccak256([]byte(s)), nil
+
+	case typ == "bytes":
+		b, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.Keccak256(b), nil
+
+	case typ == "bool":
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("%v for bool", errUnexpectedValue)
+		}
+		if b {
+			return math.PaddedBigBytes(common.Big1, 32), nil
+		}
+		return make([]byte, 32), nil
+
+	case typ == "address":
+		s, ok := value.(string)
+		if !ok || !common.IsHexAddress(s) {
+			return nil, fmt.Errorf("invalid address %v", value)
+		}
+		return common.LeftPadBytes(common.HexToAddress(s).Bytes(), 32), nil
+
+	case strings.HasPrefix(typ, "bytes"):
+		size, err := strconv.Atoi(typ[5:])
+		if err != nil || size < 1 || size > 32 {
+			return nil, fmt.Errorf("invalid type %s", typ)
+		}
+		b, err := parseBytes(value)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) > size {
+			return nil, fmt.Errorf("%d bytes too long for %s", len(b), typ)
+		}
+		return common.RightPadBytes(b, 32), nil
+
+	case strings.HasPrefix(typ, "int") || strings.HasPrefix(typ, "uint"):
+		signed := strings.HasPrefix(typ, "int")
+		bits, err := strconv.Atoi(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"))
+		if err != nil || bits < 8 || bits > 256 || bits%8 != 0 {
+			return nil, fmt.Errorf("invalid type %s", typ)
+		}
+		x, err := parseInteger(value)
+		if err != nil {
+			return nil, err
+		}
+		// Check that the value fits the type
+		var min, max *big.Int
+		if signed {
+			max = new(big.Int).Lsh(common.Big1, uint(bits-1))
+			min = new(big.Int).Neg(max)
+		} else {
+			max = new(big.Int).Lsh(common.Big1, uint(bits))
+			min = new(big.Int)
+		}
+		if x.Cmp(min) < 0 || x.Cmp(max) >= 0 {
+			return nil, fmt.Errorf("value %v out of range for %s", x, typ)
+		}
+		return math.PaddedBigBytes(math.U256(x), 32), nil
+	}
+	return nil, fmt.Errorf("unknown type %q", typ)
+}
+
+// parseBytes decodes a hex encoded byte value.
+func parseBytes(value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case string:
+		return hexutil.Decode(v)
+	case []byte:
+		return v, nil
+	case hexutil.Bytes:
+		return v, nil
+	}
+	return nil, fmt.Errorf("%v for bytes", errUnexpectedValue)
+}
+
+// parseInteger decodes an integer value, given as a JSON number or as a
+// decimal or hex string.
+func parseInteger(value interface{}) (*big.Int, error) {
+	switch v := value.(type) {
+	case *big.Int:
+		return new(big.Int).Set(v), nil
+	case json.Number:
+		if x, ok := new(big.Int).SetString(v.String(), 10); ok {
+			return x, nil
+		}
+	case float64:
+		if v == float64(int64(v)) && v < 1<<53 && v > -(1<<53) {
+			return big.NewInt(int64(v)), nil
+		}
+	case string:
+		neg := strings.HasPrefix(v, "-")
+		if x, ok := math.ParseBig256(strings.TrimPrefix(v, "-")); ok {
+			if neg {
+				x.Neg(x)
+			}
+			return x, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid integer %v", value)
+}
+
+// isAtomic reports whether the type is one of the atomic Solidity types.
+func isAtomic(typ string) bool {
+	switch typ {
+	case "string", "bytes", "bool", "address":
+		return true
+	}
+	for _, prefix := range []string{"bytes", "uint", "int"} {
+		if strings.HasPrefix(typ, prefix) {
+			if _, err := strconv.Atoi(typ[len(prefix):]); err == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// elementType strips all array suffixes from a type.
+func elementType(typ string) string {
+	for {
+		m := arrayRegexp.FindStringSubmatch(typ)
+		if m == nil {
+			return typ
+		}
+		typ = m[1]
+	}
+}
+
+// NameValueType is a decoded field of typed data, for display to the user.
+type NameValueType struct {
+	Name  string      `json:"name"`
+	Value interface{} `json:"value"` // Atomic value, or the fields of a nested struct
+	Typ   string      `json:"type"`
+}
+
+// Format decodes the domain and the message into fields for display.
+func (td *TypedData) Format() ([]*NameValueType, error) {
+	domain, err := td.formatData(DomainType, td.Domain.Map(), 0)
+	if err != nil {
+		return nil, err
+	}
+	message, err := td.formatData(td.PrimaryType, td.Message, 0)
+	if err != nil {
+		return nil, err
+	}
+	return []*NameValueType{
+		{Name: DomainType, Value: domain, Typ: "domain"},
+		{Name: td.PrimaryType, Value: message, Typ: "primary type"},
+	}, nil
+}
+
+func (td *TypedData) formatData(typ string, data map[string]interface{}, depth int) ([]*NameValueType, error) {
+	if depth > maxDepth {
+		return nil, errTooDeep
+	}
+	var output []*NameValueType
+	for _, field := range td.Types[typ] {
+		value, err := td.formatValue(field.Type, data[field.Name], depth+1)
+		if err != nil {
+			return nil, fmt.Errorf("%s.%s: %v", typ, field.Name, err)
+		}
+		output = append(output, &NameValueType{Name: field.Name, Value: value, Typ: field.Type})
+	}
+	return output, nil
+}
+
+func (td *TypedData) formatValue(typ string, value interface{}, depth int) (interface{}, error) {
+	if m := arrayRegexp.FindStringSubmatch(typ); m != nil {
+		items, _ := value.([]interface{})
+		output := make([]interface{}, len(items))
+		for i, item := range items {
+			formatted, err := td.formatValue(m[1], item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			output[i] = formatted
+		}
+		return output, nil
+	}
+	if _, ok := td.Types[typ]; ok {
+		data, _ := value.(map[string]interface{})
+		return td.formatData(typ, data, depth)
+	}
+	if strings.HasPrefix(typ, "int") || strings.HasPrefix(typ, "uint") {
+		if x, err := parseInteger(value); err == nil {
+			return x.String(), nil
+		}
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// Pprint returns a human readable rendering of formatted typed data fields.
+func Pprint(fields []*NameValueType) string {
+	var buf bytes.Buffer
+	pprint(&buf, fields, 0)
+	return buf.String()
+}
+
+func pprint(buf *bytes.Buffer, fields []*NameValueType, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for _, field := range fields {
+		switch v := field.Value.(type) {
+		case []*NameValueType:
+			fmt.Fprintf(buf, "%s%s [%s]\n", indent, field.Name, field.Typ)
+			pprint(buf, v, depth+1)
+		default:
+			fmt.Fprintf(buf, "%s%s [%s]: %v\n", indent, field.Name, field.Typ, v)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package typeddata
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// mailJSON is the example message of EIP-712.
+const mailJSON = `{
+	"types": {
+		"EIP712Domain": [
+			{"name": "name", "type": "string"},
+			{"name": "version", "type": "string"},
+			{"name": "chainId", "type": "uint256"},
+			{"name": "verifyingContract", "type": "address"}
+		],
+		"Person": [
+			{"name": "name", "type": "string"},
+			{"name": "wallet", "type": "address"}
+		],
+		"Mail": [
+			{"name": "from", "type": "Person"},
+			{"name": "to", "type": "Person"},
+			{"name": "contents", "type": "string"}
+		]
+	},
+	"primaryType": "Mail",
+	"domain": {
+		"name": "Ether Mail",
+		"version": "1",
+		"chainId": 1,
+		"verifyingContract": "0xCcCCccccCCCCcCCCCCCcCcCccCcCCCcCcccccccC"
+	},
+	"message": {
+		"from": {"name": "Cow", "wallet": "0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826"},
+		"to": {"name": "Bob", "wallet": "0xbBbBBBBbbBBBbbbBbbBbbbbBBbBbbbbBbBbbBBbB"},
+		"contents": "Hello, Bob!"
+	}
+}`
+
+func mailData(t *testing.T) *TypedData {
+	var td TypedData
+	if err := json.Unmarshal([]byte(mailJSON), &td); err != nil {
+		t.Fatalf("failed to decode typed data: %v", err)
+	}
+	return &td
+}
+
+// Tests the encoding and hashing against the test vectors of EIP-712.
+func TestMailVectors(t *testing.T) {
+	td := mailData(t)
+
+	if enc, want := td.EncodeType("Mail"), "Mail(Person from,Person to,string contents)Person(string name,address wallet)"; enc != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", enc, want)
+	}
+	if hash, want := td.TypeHash("Mail"), common.HexToHash("0xa0cedeb2dc280ba39b857546d74f5549c3a1d7bdc2dd96bf881f76108e23dac2"); hash != want {
+		t.Errorf("type hash mismatch: have %x, want %x", hash, want)
+	}
+	message, err := td.HashStruct("Mail", td.Message)
+	if err != nil {
+		t.Fatalf("failed to hash message: %v", err)
+	}
+	if want := common.HexToHash("0xc52c0ee5d84264471806290a3f2c4cecfc5490626bf912d01f240d7a274b371e"); message != want {
+		t.Errorf("message hash mismatch: have %x, want %x", message, want)
+	}
+	domain, err := td.HashStruct(DomainType, td.Domain.Map())
+	if err != nil {
+		t.Fatalf("failed to hash domain: %v", err)
+	}
+	if want := common.HexToHash("0xf2cee375fa42b42143804025fc449deafd50cc031ca257e0b194a650a912090f"); domain != want {
+		t.Errorf("domain separator mismatch: have %x, want %x", domain, want)
+	}
+	hash, err := td.SigningHash()
+	if err != nil {
+		t.Fatalf("failed to compute signing hash: %v", err)
+	}
+	if want := common.HexToHash("0xbe609aee343fb3c4b28e1df9e632fca64fcfaede20f02e86244efddf30957bd2"); hash != want {
+		t.Errorf("signing hash mismatch: have %x, want %x", hash, want)
+	}
+	// Sign with the key of the example and check the signature (v = 28 - 27)
+	key, _ := crypto.ToECDSA(crypto.Keccak256([]byte("cow")))
+	if addr := crypto.PubkeyToAddress(key.PublicKey); addr != common.HexToAddress("0xCD2a3d9F938E13CD947Ec05AbC7FE734Df8DD826") {
+		t.Fatalf("signer address mismatch: have %x", addr)
+	}
+	sig, err := crypto.Sign(hash[:], key)
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	want := hexutil.MustDecode("0x4355c47d63924e8a72e509b65029052eb6c299d53a04e167c5775fd466751c9d07299936d304c153f6443dfa05f40ff007d72911b6f72307f996231605b9156201")
+	if !bytes.Equal(sig, want) {
+		t.Errorf("signature mismatch: have %x, want %x", sig, want)
+	}
+}
+
+// Tests that malformed typed data is rejected.
+func TestInvalidData(t *testing.T) {
+	tests := []struct {
+		modify func(td *TypedData)
+		err    string
+	}{
+		{
+			func(td *TypedData) { delete(td.Types, DomainType) },
+			"missing EIP712Domain type",
+		},
+		{
+			func(td *TypedData) { td.PrimaryType = "Letter" },
+			"missing primary type",
+		},
+		{
+			func(td *TypedData) { td.Types["Person"] = append(td.Types["Person"], Type{Name: "age", Type: "Age"}) },
+			"unknown type",
+		},
+		{
+			func(td *TypedData) { td.Types["Person"][1].Name = "name" },
+			"duplicate field",
+		},
+		{
+			func(td *TypedData) { td.Types["uint8"] = nil },
+			"shadows an atomic type",
+		},
+		{
+			func(td *TypedData) { td.Message["contents"] = 1 },
+			"unexpected value",
+		},
+		{
+			func(td *TypedData) { delete(td.Message, "to") },
+			"missing value for field to",
+		},
+		{
+			func(td *TypedData) { td.Message["extra"] = "value" },
+			"more values than fields",
+		},
+		{
+			func(td *TypedData) { td.Message["from"].(map[string]interface{})["wallet"] = "0x01" },
+			"invalid address",
+		},
+		{
+			func(td *TypedData) {
+				td.Types["Mail"] = append(td.Types["Mail"], Type{Name: "flags", Type: "uint8"})
+				td.Message["flags"] = "256"
+			},
+			"out of range",
+		},
+		{
+			func(td *TypedData) {
+				td.Types["Mail"] = append(td.Types["Mail"], Type{Name: "cc", Type: "Person[1]"})
+				td.Message["cc"] = []interface{}{}
+			},
+			"array length mismatch",
+		},
+	}
+	for i, tt := range tests {
+		td := mailData(t)
+		tt.modify(td)
+		if _, err := td.SigningHash(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("test %d: error mismatch: have %v, want %q", i, err, tt.err)
+		}
+	}
+}
+
+// Tests the encoding of arrays and recursive struct references.
+func TestArraysAndRecursion(t *testing.T) {
+	td := mailData(t)
+	td.Types["Person"] = append(td.Types["Person"], Type{Name: "friends", Type: "Person[]"})
+	td.Types["Mail"] = append(td.Types["Mail"], Type{Name: "tags", Type: "bytes32[2]"})
+
+	if enc, want := td.EncodeType("Mail"), "Mail(Person from,Person to,string contents,bytes32[2] tags)Person(string name,address wallet,Person[] friends)"; enc != want {
+		t.Errorf("type encoding mismatch: have %s, want %s", enc, want)
+	}
+	td.Message["from"].(map[string]interface{})["friends"] = []interface{}{}
+	td.Message["to"].(map[string]interface{})["friends"] = []interface{}{
+		map[string]interface{}{"name": "Alice", "wallet": "0xaAaAaAaaAaAaAaaAaAAAAAAAAaaaAaAaAaaAaaAa", "friends": []interface{}{}},
+	}
+	td.Message["tags"] = []interface{}{"0x01", "0x02"}
+	if _, err := td.SigningHash(); err != nil {
+		t.Fatalf("failed to compute signing hash: %v", err)
+	}
+}
@@ -47,10 +47,10 @@ type Config struct {
 	*storage.FileStoreParams
 	*storage.LocalStoreParams
 	*network.HiveParams
-	Swap *swap.LocalProfile
+	Swap *swap.Params
 	Pss  *pss.PssParams
 	//*network.SyncParams
-	Contract          common.Address
+	Contract          common.Address // SWAP chequebook, deployed on start if not set
 	EnsRoot           common.Address
 	EnsAPIs           []string
 	Path              string
@@ -80,7 +80,7 @@ func NewConfig() (c *Config) {
 		FileStoreParams:  storage.NewFileStoreParams(),
 		HiveParams:       network.NewHiveParams(),
 		//SyncParams:    network.NewDefaultSyncParams(),
-		Swap:              swap.NewDefaultSwapParams(),
+		Swap:              swap.NewDefaultParams(),
 		Pss:               pss.NewPssParams(),
 		ListenAddr:        DefaultHTTPListenAddr,
 		Port:              DefaultHTTPPort,
@@ -119,10 +119,6 @@ func (c *Config) Init(prvKey *ecdsa.PrivateKey) {
 	c.BzzKey = keyhex
 	c.NodeID = discover.PubkeyID(&prvKey.PublicKey).String()
 
-	if c.SwapEnabled {
-		c.Swap.Init(c.Contract, prvKey)
-	}
-
 	c.privateKey = prvKey
 	c.LocalStoreParams.Init(c.Path)
 	c.LocalStoreParams.BaseKey = common.FromHex(keyhex)
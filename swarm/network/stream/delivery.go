@@ -165,7 +165,7 @@ func (d *Delivery) handleRetrieveRequestMsg(ctx context.Context, sp *Peer, req *
 			return
 		}
 		if req.SkipCheck {
-			err = sp.Deliver(ctx, chunk, s.priority)
+			err = sp.Deliver(ctx, chunk, s.priority, false)
 			if err != nil {
 				log.Warn("ERROR in handleRetrieveRequestMsg", "err", err)
 			}
@@ -181,12 +181,23 @@ func (d *Delivery) handleRetrieveRequestMsg(ctx context.Context, sp *Peer, req *
 	return nil
 }
 
+// ChunkDeliveryMsg is the content of the chunk delivery protocol msgs. It is
+// sent as a distinct message type for retrieval and for syncing, as SWAP prices
+// them differently.
 type ChunkDeliveryMsg struct {
 	Addr  storage.Address
 	SData []byte // the stored chunk Data (incl size)
 	peer  *Peer  // set in handleChunkDeliveryMsg
 }
 
+// ChunkDeliveryMsgRetrieval is the protocol msg for chunks delivered in response
+// to retrieve requests, paid for by the requesting node
+type ChunkDeliveryMsgRetrieval ChunkDeliveryMsg
+
+// ChunkDeliveryMsgSyncing is the protocol msg for chunks pushed by syncing, paid
+// for by the syncing node
+type ChunkDeliveryMsgSyncing ChunkDeliveryMsg
+
 // TODO: Fix context SNAFU
 func (d *Delivery) handleChunkDeliveryMsg(ctx context.Context, sp *Peer, req *ChunkDeliveryMsg) error {
 	var osp opentracing.Span
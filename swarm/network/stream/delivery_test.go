@@ -206,7 +206,7 @@ func TestStreamerUpstreamRetrieveRequestMsgExchange(t *testing.T) {
 		Expects: []p2ptest.Expect{
 			{
 				Code: 6,
-				Msg: &ChunkDeliveryMsg{
+				Msg: &ChunkDeliveryMsgRetrieval{
 					Addr:  hash,
 					SData: hash,
 				},
@@ -263,7 +263,7 @@ func TestStreamerDownstreamChunkDeliveryMsgExchange(t *testing.T) {
 			Triggers: []p2ptest.Trigger{
 				{
 					Code: 6,
-					Msg: &ChunkDeliveryMsg{
+					Msg: &ChunkDeliveryMsgRetrieval{
 						Addr:  chunkKey,
 						SData: chunkData,
 					},
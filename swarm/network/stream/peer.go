@@ -122,17 +122,26 @@ func NewPeer(peer *protocols.Peer, streamer *Registry) *Peer {
 	return p
 }
 
-// Deliver sends a storeRequestMsg protocol message to the peer
-func (p *Peer) Deliver(ctx context.Context, chunk storage.Chunk, priority uint8) error {
+// Deliver sends a chunk delivery protocol message to the peer, either as a
+// response to a retrieve request or as part of syncing
+func (p *Peer) Deliver(ctx context.Context, chunk storage.Chunk, priority uint8, syncing bool) error {
 	var sp opentracing.Span
 	ctx, sp = spancontext.StartSpan(
 		ctx,
 		"send.chunk.delivery")
 	defer sp.Finish()
 
-	msg := &ChunkDeliveryMsg{
-		Addr:  chunk.Address(),
-		SData: chunk.Data(),
+	var msg interface{}
+	if syncing {
+		msg = &ChunkDeliveryMsgSyncing{
+			Addr:  chunk.Address(),
+			SData: chunk.Data(),
+		}
+	} else {
+		msg = &ChunkDeliveryMsgRetrieval{
+			Addr:  chunk.Address(),
+			SData: chunk.Data(),
+		}
 	}
 	return p.SendPriority(ctx, msg, priority)
 }
@@ -20,6 +20,7 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"reflect"
 	"sync"
 	"time"
 
@@ -60,6 +61,7 @@ type Registry struct {
 	delivery       *Delivery
 	intervalsStore state.Store
 	doRetrieve     bool
+	spec           *protocols.Spec // streamer protocol spec, with the accounting hook if any
 }
 
 // RegistryOptions holds optional values for NewRegistry constructor.
@@ -68,6 +70,7 @@ type RegistryOptions struct {
 	DoSync          bool
 	DoRetrieve      bool
 	SyncUpdateDelay time.Duration
+	Balance         protocols.Balance // SWAP balance accounting the priced messages, if set
 }
 
 // NewRegistry is Streamer constructor
@@ -87,6 +90,10 @@ func NewRegistry(addr *network.BzzAddr, delivery *Delivery, syncChunkStore stora
 		delivery:       delivery,
 		intervalsStore: intervalsStore,
 		doRetrieve:     options.DoRetrieve,
+		spec:           Spec,
+	}
+	if options.Balance != nil {
+		streamer.spec = newSpec(protocols.NewAccounting(options.Balance, prices))
 	}
 	streamer.api = NewAPI(streamer)
 	delivery.getPeer = streamer.getPeer
@@ -445,7 +452,7 @@ func (r *Registry) updateSyncing() {
 }
 
 func (r *Registry) runProtocol(p *p2p.Peer, rw p2p.MsgReadWriter) error {
-	peer := protocols.NewPeer(p, rw, Spec)
+	peer := protocols.NewPeer(p, rw, r.spec)
 	bp := network.NewBzzPeer(peer, r.addr)
 	np := network.NewPeer(bp, r.delivery.kad)
 	r.delivery.kad.On(np)
@@ -475,8 +482,11 @@ func (p *Peer) HandleMsg(ctx context.Context, msg interface{}) error {
 	case *WantedHashesMsg:
 		return p.handleWantedHashesMsg(ctx, msg)
 
-	case *ChunkDeliveryMsg:
-		return p.streamer.delivery.handleChunkDeliveryMsg(ctx, p, msg)
+	case *ChunkDeliveryMsgRetrieval:
+		return p.streamer.delivery.handleChunkDeliveryMsg(ctx, p, (*ChunkDeliveryMsg)(msg))
+
+	case *ChunkDeliveryMsgSyncing:
+		return p.streamer.delivery.handleChunkDeliveryMsg(ctx, p, (*ChunkDeliveryMsg)(msg))
 
 	case *RetrieveRequestMsg:
 		return p.streamer.delivery.handleRetrieveRequestMsg(ctx, p, msg)
@@ -637,30 +647,70 @@ func (c *clientParams) clientCreated() {
 }
 
 // Spec is the spec of the streamer protocol
-var Spec = &protocols.Spec{
-	Name:       "stream",
-	Version:    6,
-	MaxMsgSize: 10 * 1024 * 1024,
-	Messages: []interface{}{
-		UnsubscribeMsg{},
-		OfferedHashesMsg{},
-		WantedHashesMsg{},
-		TakeoverProofMsg{},
-		SubscribeMsg{},
-		RetrieveRequestMsg{},
-		ChunkDeliveryMsg{},
-		SubscribeErrorMsg{},
-		RequestSubscriptionMsg{},
-		QuitMsg{},
-	},
+var Spec = newSpec(nil)
+
+// newSpec creates the spec of the streamer protocol with the given hook.
+func newSpec(hook protocols.Hook) *protocols.Spec {
+	return &protocols.Spec{
+		Name:       "stream",
+		Version:    7,
+		MaxMsgSize: 10 * 1024 * 1024,
+		Messages: []interface{}{
+			UnsubscribeMsg{},
+			OfferedHashesMsg{},
+			WantedHashesMsg{},
+			TakeoverProofMsg{},
+			SubscribeMsg{},
+			RetrieveRequestMsg{},
+			ChunkDeliveryMsgRetrieval{},
+			SubscribeErrorMsg{},
+			RequestSubscriptionMsg{},
+			QuitMsg{},
+			ChunkDeliveryMsgSyncing{},
+		},
+		Hook: hook,
+	}
+}
+
+// Default prices of the streamer protocol messages, in SWAP accounting units
+const (
+	RetrieveRequestPrice = 10 // per retrieve request
+	ChunkDeliveryPrice   = 1  // per byte of the delivered chunk
+)
+
+// prices of the streamer protocol messages: retrieve requests and the chunks
+// delivered in response are paid for by the requesting node, while the chunks
+// pushed by syncing are paid for by the syncing node, for storing them.
+var prices = messagePrices{
+	reflect.TypeOf(RetrieveRequestMsg{}):        {Value: RetrieveRequestPrice, Payer: protocols.Sender},
+	reflect.TypeOf(ChunkDeliveryMsgRetrieval{}): {Value: ChunkDeliveryPrice, PerByte: true, Payer: protocols.Receiver},
+	reflect.TypeOf(ChunkDeliveryMsgSyncing{}):   {Value: ChunkDeliveryPrice, PerByte: true, Payer: protocols.Sender},
+}
+
+// messagePrices implements protocols.Prices, looking up prices by message type.
+type messagePrices map[reflect.Type]*protocols.Price
+
+// Price returns the price of the message, or nil if it's free.
+func (p messagePrices) Price(msg interface{}) *protocols.Price {
+	typ := reflect.TypeOf(msg)
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	return p[typ]
+}
+
+// Spec returns the spec of the streamer protocol used by the registry, which
+// includes the SWAP accounting hook if a balance is set in the options.
+func (r *Registry) Spec() *protocols.Spec {
+	return r.spec
 }
 
 func (r *Registry) Protocols() []p2p.Protocol {
 	return []p2p.Protocol{
 		{
-			Name:    Spec.Name,
-			Version: Spec.Version,
-			Length:  Spec.Length(),
+			Name:    r.spec.Name,
+			Version: r.spec.Version,
+			Length:  r.spec.Length(),
 			Run:     r.runProtocol,
 			// NodeInfo: ,
 			// PeerInfo: ,
@@ -0,0 +1,260 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	ethereum "github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/chequebook/contract"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/swarm/log"
+)
+
+const (
+	chequebookDeployRetries = 5
+	chequebookDeployDelay   = 1 * time.Second // delay between retries
+)
+
+// ownerSlot is the storage slot of the owner of a chequebook, which the contract
+// has no getter for.
+var ownerSlot = common.Hash{}
+
+var (
+	errInvalidSignature  = errors.New("invalid cheque signature")
+	errInvalidContract   = errors.New("invalid chequebook contract")
+	errInvalidIssuer     = errors.New("cheque issuer is not the chequebook owner")
+	errInsufficientFunds = errors.New("insufficient chequebook balance")
+)
+
+// Backend is the blockchain the chequebooks are deployed on.
+type Backend interface {
+	bind.ContractBackend
+	bind.DeployBackend
+	ethereum.ChainStateReader
+}
+
+// Cheque is an off-chain promise of payment. The amounts are cumulative: each
+// cheque to a beneficiary supersedes the previous ones, so only the last one
+// needs to be cashed.
+type Cheque struct {
+	Contract    common.Address // address of the contract the cheque is drawn on
+	Beneficiary common.Address // recipient of the payment
+	Amount      uint64         // cumulative amount of all the cheques to the beneficiary
+	Sig         []byte         // signature of the issuer
+}
+
+// Settlement is the payment system the cheques are issued and cashed through.
+type Settlement interface {
+	// Contract returns the address of the contract the local cheques are drawn on
+	Contract() common.Address
+
+	// Issuer returns the address the local cheques are signed by
+	Issuer() common.Address
+
+	// Issue signs a cheque of the cumulative amount payable to the beneficiary
+	Issue(beneficiary common.Address, amount uint64) (*Cheque, error)
+
+	// Verify checks that a received cheque was signed by the issuer, and that it
+	// can be cashed
+	Verify(cheque *Cheque, issuer common.Address) error
+
+	// Cash redeems a received cheque
+	Cash(ctx context.Context, cheque *Cheque) error
+}
+
+// ChequebookSettlement is a Settlement on chequebook contracts, each node
+// drawing its cheques on its own chequebook, and cashing the received ones by
+// transactions signed with its key.
+type ChequebookSettlement struct {
+	contract common.Address
+	key      *ecdsa.PrivateKey
+	backend  Backend
+
+	lock   sync.Mutex
+	owners map[common.Address]common.Address // owners of the chequebooks with valid code
+}
+
+// NewChequebookSettlement creates a settlement on the chequebook at the
+// contract address, owned by the key.
+func NewChequebookSettlement(contract common.Address, key *ecdsa.PrivateKey, backend Backend) *ChequebookSettlement {
+	return &ChequebookSettlement{
+		contract: contract,
+		key:      key,
+		backend:  backend,
+		owners:   make(map[common.Address]common.Address),
+	}
+}
+
+// Contract returns the address of the chequebook.
+func (s *ChequebookSettlement) Contract() common.Address {
+	return s.contract
+}
+
+// Issuer returns the address of the owner of the chequebook.
+func (s *ChequebookSettlement) Issuer() common.Address {
+	return crypto.PubkeyToAddress(s.key.PublicKey)
+}
+
+// Issue signs a cheque on the chequebook.
+func (s *ChequebookSettlement) Issue(beneficiary common.Address, amount uint64) (*Cheque, error) {
+	sig, err := crypto.Sign(chequeHash(s.contract, beneficiary, amount), s.key)
+	if err != nil {
+		return nil, err
+	}
+	return &Cheque{
+		Contract:    s.contract,
+		Beneficiary: beneficiary,
+		Amount:      amount,
+		Sig:         sig,
+	}, nil
+}
+
+// Verify checks the signature of the cheque, that it's drawn on a contract with
+// the chequebook code owned by the issuer, and that the chequebook can pay the
+// amount not cashed yet.
+func (s *ChequebookSettlement) Verify(cheque *Cheque, issuer common.Address) error {
+	pubkey, err := crypto.SigToPub(chequeHash(cheque.Contract, cheque.Beneficiary, cheque.Amount), cheque.Sig)
+	if err != nil || crypto.PubkeyToAddress(*pubkey) != issuer {
+		return errInvalidSignature
+	}
+	owner, err := s.owner(cheque.Contract)
+	if err != nil {
+		return err
+	}
+	if owner != issuer {
+		return errInvalidIssuer
+	}
+	return s.checkBalance(cheque)
+}
+
+// owner validates the code of the chequebook and returns its owner, which the
+// chequebook only accepts the cheques of. The owner can't change, so it's only
+// retrieved once.
+func (s *ChequebookSettlement) owner(chequebook common.Address) (common.Address, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if owner, ok := s.owners[chequebook]; ok {
+		return owner, nil
+	}
+	code, err := s.backend.CodeAt(context.Background(), chequebook, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	if !bytes.Equal(code, common.FromHex(contract.ContractDeployedCode)) {
+		return common.Address{}, errInvalidContract
+	}
+	slot, err := s.backend.StorageAt(context.Background(), chequebook, ownerSlot, nil)
+	if err != nil {
+		return common.Address{}, err
+	}
+	owner := common.BytesToAddress(slot)
+	s.owners[chequebook] = owner
+	return owner, nil
+}
+
+// checkBalance checks that the chequebook holds enough funds to pay the amount
+// of the cheque above the one already cashed by the beneficiary, as the contract
+// bounces the cheques it can't cover.
+func (s *ChequebookSettlement) checkBalance(cheque *Cheque) error {
+	chbook, err := contract.NewChequebookCaller(cheque.Contract, s.backend)
+	if err != nil {
+		return err
+	}
+	sent, err := chbook.Sent(nil, cheque.Beneficiary)
+	if err != nil {
+		return err
+	}
+	due := new(big.Int).Sub(new(big.Int).SetUint64(cheque.Amount), sent)
+	if due.Sign() <= 0 {
+		return errStaleCheque
+	}
+	balance, err := s.backend.BalanceAt(context.Background(), cheque.Contract, nil)
+	if err != nil {
+		return err
+	}
+	if balance.Cmp(due) < 0 {
+		return errInsufficientFunds
+	}
+	return nil
+}
+
+// Cash sends the transaction cashing the cheque to the chequebook it's drawn on.
+func (s *ChequebookSettlement) Cash(ctx context.Context, cheque *Cheque) error {
+	if len(cheque.Sig) != 65 {
+		return errInvalidSignature
+	}
+	chbook, err := contract.NewChequebook(cheque.Contract, s.backend)
+	if err != nil {
+		return err
+	}
+	opts := bind.NewKeyedTransactor(s.key)
+	opts.Context = ctx
+
+	var r, ss [32]byte
+	copy(r[:], cheque.Sig[:32])
+	copy(ss[:], cheque.Sig[32:64])
+	v := cheque.Sig[64] + 27
+
+	tx, err := chbook.Cash(opts, cheque.Beneficiary, new(big.Int).SetUint64(cheque.Amount), v, r, ss)
+	if err != nil {
+		return err
+	}
+	log.Debug("SWAP cheque cashed", "contract", cheque.Contract, "amount", cheque.Amount, "tx", tx.Hash())
+	return nil
+}
+
+// DeployChequebook deploys a new chequebook owned by the transactor, with the
+// value of the transaction as its deposit, and waits until it's mined.
+func DeployChequebook(opts *bind.TransactOpts, backend Backend) (addr common.Address, err error) {
+	var tx *types.Transaction
+	for try := 0; try < chequebookDeployRetries; try++ {
+		if try > 0 {
+			time.Sleep(chequebookDeployDelay)
+		}
+		if _, tx, _, err = contract.DeployChequebook(opts, backend); err != nil {
+			log.Warn(fmt.Sprintf("can't send chequebook deploy tx (try %d): %v", try, err))
+			continue
+		}
+		if addr, err = bind.WaitDeployed(opts.Context, backend, tx); err != nil {
+			log.Warn(fmt.Sprintf("chequebook deploy error (try %d): %v", try, err))
+			continue
+		}
+		return addr, nil
+	}
+	return addr, err
+}
+
+// chequeHash returns the hash signed by the cheques, as verified by the chequebook
+// contract: the hash of the contract address, the beneficiary address and the
+// cumulative amount.
+func chequeHash(chequebook, beneficiary common.Address, amount uint64) []byte {
+	input := append(chequebook.Bytes(), beneficiary.Bytes()...)
+	input = append(input, common.LeftPadBytes(new(big.Int).SetUint64(amount).Bytes(), 32)...)
+	return crypto.Keccak256(input)
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/chequebook/contract"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/swarm/state"
+)
+
+var (
+	key0, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+	key1, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+	addr0   = crypto.PubkeyToAddress(key0.PublicKey)
+	addr1   = crypto.PubkeyToAddress(key1.PublicKey)
+)
+
+func newTestBackend() *backends.SimulatedBackend {
+	return backends.NewSimulatedBackend(core.GenesisAlloc{
+		addr0: {Balance: big.NewInt(1000000000000000000)},
+		addr1: {Balance: big.NewInt(1000000000000000000)},
+	}, 10000000)
+}
+
+// deployTestChequebook deploys a chequebook owned by the key with the deposit.
+func deployTestChequebook(t *testing.T, key *ecdsa.PrivateKey, deposit int64, backend *backends.SimulatedBackend) common.Address {
+	opts := bind.NewKeyedTransactor(key)
+	opts.Value = big.NewInt(deposit)
+	addr, _, _, err := contract.DeployChequebook(opts, backend)
+	if err != nil {
+		t.Fatalf("failed to deploy chequebook: %v", err)
+	}
+	backend.Commit()
+	return addr
+}
+
+func TestChequebookSettlement(t *testing.T) {
+	backend := newTestBackend()
+	chequebook := deployTestChequebook(t, key0, 1000000, backend)
+
+	issuer := NewChequebookSettlement(chequebook, key0, backend)
+	receiver := NewChequebookSettlement(common.Address{}, key1, backend)
+
+	cheque, err := issuer.Issue(addr1, 500)
+	if err != nil {
+		t.Fatalf("failed to issue cheque: %v", err)
+	}
+	if err := receiver.Verify(cheque, addr0); err != nil {
+		t.Fatalf("failed to verify cheque: %v", err)
+	}
+	if err := receiver.Verify(cheque, addr1); err != errInvalidSignature {
+		t.Fatalf("cheque of wrong issuer: expected error %v, got %v", errInvalidSignature, err)
+	}
+	forged := *cheque
+	forged.Amount = 1000
+	if err := receiver.Verify(&forged, addr0); err != errInvalidSignature {
+		t.Fatalf("forged cheque: expected error %v, got %v", errInvalidSignature, err)
+	}
+	// Cheques on a contract without the chequebook code are refused
+	bogus, _ := NewChequebookSettlement(addr0, key0, backend).Issue(addr1, 500)
+	if err := receiver.Verify(bogus, addr0); err != errInvalidContract {
+		t.Fatalf("cheque on invalid contract: expected error %v, got %v", errInvalidContract, err)
+	}
+
+	// Cheques the chequebook can't cover are refused
+	overdrawn, _ := issuer.Issue(addr1, 1000001)
+	if err := receiver.Verify(overdrawn, addr0); err != errInsufficientFunds {
+		t.Fatalf("overdrawn cheque: expected error %v, got %v", errInsufficientFunds, err)
+	}
+
+	// Cashing the cheque pays the beneficiary from the chequebook
+	if err := receiver.Cash(context.Background(), cheque); err != nil {
+		t.Fatalf("failed to cash cheque: %v", err)
+	}
+	backend.Commit()
+
+	if err := receiver.Verify(cheque, addr0); err != errStaleCheque {
+		t.Fatalf("cashed cheque: expected error %v, got %v", errStaleCheque, err)
+	}
+
+	chbook, err := contract.NewChequebook(chequebook, backend)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sent, err := chbook.Sent(nil, addr1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Uint64() != 500 {
+		t.Fatalf("sent amount mismatch: have %v, want %d", sent, 500)
+	}
+	balance, err := backend.BalanceAt(context.Background(), chequebook, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Int64() != 1000000-500 {
+		t.Fatalf("chequebook balance mismatch: have %v, want %d", balance, 1000000-500)
+	}
+}
+
+// Tests that cheques signed by another key than the owner of the chequebook they
+// are drawn on are refused, as the chequebook wouldn't pay them.
+func TestChequebookSettlementNonOwner(t *testing.T) {
+	backend := newTestBackend()
+	chequebook := deployTestChequebook(t, key0, 1000000, backend)
+
+	forger := NewChequebookSettlement(chequebook, key1, backend)
+	receiver := NewChequebookSettlement(common.Address{}, key0, backend)
+
+	cheque, err := forger.Issue(addr0, 500)
+	if err != nil {
+		t.Fatalf("failed to issue cheque: %v", err)
+	}
+	if err := receiver.Verify(cheque, addr1); err != errInvalidIssuer {
+		t.Fatalf("cheque of non-owner: expected error %v, got %v", errInvalidIssuer, err)
+	}
+
+	// A peer advertising the chequebook with the non-owner as issuer is not credited
+	s := newTestSwap(state.NewInmemoryStore(), addr0, receiver)
+	defer s.Close()
+
+	peer := &Peer{
+		Peer:     newTestPeer(1),
+		swap:     s,
+		contract: chequebook,
+		issuer:   addr1,
+	}
+	if err := s.receive(peer, cheque); err != errInvalidIssuer {
+		t.Fatalf("expected error %v, got %v", errInvalidIssuer, err)
+	}
+	if balance := s.Balance(discover.NodeID{1}); balance != 0 {
+		t.Fatalf("balance mismatch: have %d, want 0", balance)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/protocols"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const handshakeTimeout = 3 * time.Second
+
+// Spec is the spec of the swap protocol, exchanging the cheques
+var Spec = &protocols.Spec{
+	Name:       "swap",
+	Version:    1,
+	MaxMsgSize: 10 * 1024,
+	Messages: []interface{}{
+		HandshakeMsg{},
+		EmitChequeMsg{},
+	},
+}
+
+// HandshakeMsg is the handshake of the swap protocol, advertising how a node
+// pays and gets paid. A node without a settlement advertises a zero contract,
+// and neither issues nor accepts cheques.
+type HandshakeMsg struct {
+	Contract    common.Address // contract the node's cheques are drawn on
+	Issuer      common.Address // signer of the node's cheques
+	Beneficiary common.Address // recipient of the cheques to the node
+}
+
+// EmitChequeMsg is the swap protocol msg sending a cheque to the beneficiary
+type EmitChequeMsg struct {
+	Cheque *Cheque
+}
+
+// Peer is a peer connected over the swap protocol.
+type Peer struct {
+	*protocols.Peer
+	swap        *Swap
+	contract    common.Address // contract the peer's cheques are drawn on
+	issuer      common.Address // signer of the peer's cheques
+	beneficiary common.Address // recipient of the cheques to the peer
+}
+
+// handleMsg is the message handler of the swap protocol.
+func (p *Peer) handleMsg(ctx context.Context, msg interface{}) error {
+	switch msg := msg.(type) {
+
+	case *EmitChequeMsg:
+		if msg.Cheque == nil {
+			return fmt.Errorf("empty cheque")
+		}
+		return p.swap.receive(p, msg.Cheque)
+
+	default:
+		return fmt.Errorf("unknown message type: %T", msg)
+	}
+}
+
+// run is the run function of the swap protocol.
+func (s *Swap) run(p *p2p.Peer, rw p2p.MsgReadWriter) error {
+	peer := &Peer{
+		Peer: protocols.NewPeer(p, rw, Spec),
+		swap: s,
+	}
+	hs := &HandshakeMsg{Beneficiary: s.beneficiary}
+	s.lock.Lock()
+	if s.settlement != nil {
+		hs.Contract = s.settlement.Contract()
+		hs.Issuer = s.settlement.Issuer()
+	}
+	s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+
+	rhs, err := peer.Handshake(ctx, hs, nil)
+	if err != nil {
+		return err
+	}
+	remote := rhs.(*HandshakeMsg)
+	peer.contract, peer.issuer, peer.beneficiary = remote.Contract, remote.Issuer, remote.Beneficiary
+
+	s.lock.Lock()
+	s.peers[p.ID()] = peer
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		delete(s.peers, p.ID())
+		s.lock.Unlock()
+	}()
+	return peer.Run(peer.handleMsg)
+}
+
+// Protocols implements node.Service, returning the swap protocol.
+func (s *Swap) Protocols() []p2p.Protocol {
+	return []p2p.Protocol{
+		{
+			Name:    Spec.Name,
+			Version: Spec.Version,
+			Length:  Spec.Length(),
+			Run:     s.run,
+		},
+	}
+}
+
+// APIs implements node.Service, returning the SWAP API.
+func (s *Swap) APIs() []rpc.API {
+	return []rpc.API{
+		{
+			Namespace: "swap",
+			Version:   "1.0",
+			Service:   &API{s},
+			Public:    false,
+		},
+	}
+}
+
+// Start implements node.Service.
+func (s *Swap) Start(server *p2p.Server) error {
+	return nil
+}
+
+// Stop implements node.Service, waiting for the cheques being cashed.
+func (s *Swap) Stop() error {
+	s.Close()
+	return nil
+}
+
+// API is the RPC API of SWAP.
+type API struct {
+	swap *Swap
+}
+
+// Balance returns the balance with a peer, positive if the peer owes the local
+// node, negative if the local node owes the peer.
+func (api *API) Balance(peer discover.NodeID) int64 {
+	return api.swap.Balance(peer)
+}
+
+// Balances returns the balances with the peers accounted since the node started.
+func (api *API) Balances() map[discover.NodeID]int64 {
+	return api.swap.Balances()
+}
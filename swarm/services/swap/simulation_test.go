@@ -0,0 +1,212 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/contracts/chequebook/contract"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/node"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/simulations/adapters"
+	"github.com/ethereum/go-ethereum/rpc"
+	ch "github.com/ethereum/go-ethereum/swarm/chunk"
+	"github.com/ethereum/go-ethereum/swarm/network"
+	"github.com/ethereum/go-ethereum/swarm/network/simulation"
+	"github.com/ethereum/go-ethereum/swarm/network/stream"
+	"github.com/ethereum/go-ethereum/swarm/state"
+	"github.com/ethereum/go-ethereum/swarm/storage"
+)
+
+type simBucketKey string
+
+const (
+	bucketKeySwap       = simBucketKey("swap")
+	bucketKeyStore      = simBucketKey("store")
+	bucketKeyNetStore   = simBucketKey("netstore")
+	bucketKeyChequebook = simBucketKey("chequebook")
+)
+
+// streamerService runs the stream protocol accounted by SWAP, along with the
+// swap protocol.
+type streamerService struct {
+	*stream.Registry
+	swap *Swap
+}
+
+func (s *streamerService) Protocols() []p2p.Protocol {
+	return append(s.Registry.Protocols(), s.swap.Protocols()...)
+}
+
+func (s *streamerService) APIs() []rpc.API {
+	return append(s.Registry.APIs(), s.swap.APIs()...)
+}
+
+func (s *streamerService) Stop() error {
+	s.swap.Stop()
+	return s.Registry.Stop()
+}
+
+// TestSwapSimulation retrieves a chunk between two nodes paying for the
+// retrieval with SWAP, and checks that the cheques are cashed on the
+// chequebook of the retrieving node.
+func TestSwapSimulation(t *testing.T) {
+	backend := newTestBackend()
+	keys := []*ecdsa.PrivateKey{key0, key1}
+
+	var lock sync.Mutex
+	var nodes int
+	sim := simulation.New(map[string]simulation.ServiceFunc{
+		"streamer": func(ctx *adapters.ServiceContext, bucket *sync.Map) (s node.Service, cleanup func(), err error) {
+			lock.Lock()
+			key := keys[nodes]
+			nodes++
+			chequebook := deployTestChequebook(t, key, 1000000, backend)
+			lock.Unlock()
+			bucket.Store(bucketKeyChequebook, chequebook)
+
+			addr := network.NewAddrFromNodeID(ctx.Config.ID)
+			datadir, err := ioutil.TempDir("", "swap-sim")
+			if err != nil {
+				return nil, nil, err
+			}
+			params := storage.NewDefaultLocalStoreParams()
+			params.ChunkDbPath = datadir
+			params.BaseKey = addr.Over()
+			localStore, err := storage.NewTestLocalStoreForAddr(params)
+			if err != nil {
+				os.RemoveAll(datadir)
+				return nil, nil, err
+			}
+			bucket.Store(bucketKeyStore, localStore)
+			cleanup = func() {
+				localStore.Close()
+				os.RemoveAll(datadir)
+			}
+			netStore, err := storage.NewNetStore(localStore, nil)
+			if err != nil {
+				return nil, cleanup, err
+			}
+			bucket.Store(bucketKeyNetStore, netStore)
+
+			store := state.NewInmemoryStore()
+			swapParams := &Params{
+				PaymentThreshold:    2000,
+				DisconnectThreshold: 100000,
+			}
+			settlement := NewChequebookSettlement(chequebook, key, backend)
+			swap, err := New(store, swapParams, crypto.PubkeyToAddress(key.PublicKey), settlement)
+			if err != nil {
+				return nil, cleanup, err
+			}
+			bucket.Store(bucketKeySwap, swap)
+
+			kad := network.NewKademlia(addr.Over(), network.NewKadParams())
+			delivery := stream.NewDelivery(kad, netStore)
+			netStore.NewNetFetcherFunc = network.NewFetcherFactory(delivery.RequestFromPeers, true).New
+
+			r := stream.NewRegistry(addr, delivery, netStore, store, &stream.RegistryOptions{
+				SkipCheck:  true,
+				DoRetrieve: true,
+				Balance:    swap,
+			})
+			return &streamerService{Registry: r, swap: swap}, cleanup, nil
+		},
+	})
+	defer sim.Close()
+
+	ids, err := sim.AddNodesAndConnectChain(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	result := sim.Run(ctx, func(ctx context.Context, sim *simulation.Simulation) error {
+		provider, retriever := ids[0], ids[1]
+
+		item, _ := sim.NodeItem(provider, bucketKeyStore)
+		chunk := storage.GenerateRandomChunk(ch.DefaultSize)
+		if err := item.(*storage.LocalStore).Put(ctx, chunk); err != nil {
+			return err
+		}
+
+		// wait for the swap handshake before retrieving
+		item, _ = sim.NodeItem(retriever, bucketKeySwap)
+		retrieverSwap := item.(*Swap)
+		item, _ = sim.NodeItem(provider, bucketKeySwap)
+		providerSwap := item.(*Swap)
+		for {
+			retrieverSwap.lock.Lock()
+			connected := retrieverSwap.peers[provider] != nil
+			retrieverSwap.lock.Unlock()
+			if connected {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+
+		item, _ = sim.NodeItem(retriever, bucketKeyNetStore)
+		if _, err := item.(*storage.NetStore).Get(ctx, chunk.Address()); err != nil {
+			return fmt.Errorf("chunk retrieval failed: %v", err)
+		}
+
+		// the retriever pays for the chunk once the delivery is accounted, and
+		// the provider cashes the cheque
+		item, _ = sim.NodeItem(retriever, bucketKeyChequebook)
+		chbook, err := contract.NewChequebook(item.(common.Address), backend)
+		if err != nil {
+			return err
+		}
+		beneficiary := providerSwap.beneficiary
+		for {
+			backend.Commit()
+			sent, err := chbook.Sent(nil, beneficiary)
+			if err != nil {
+				return err
+			}
+			balance := providerSwap.Balance(retriever)
+			if sent.Sign() > 0 && balance == -retrieverSwap.Balance(provider) {
+				if balance >= providerSwap.params.PaymentThreshold {
+					return fmt.Errorf("balance not settled: %d", balance)
+				}
+				return nil
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("cheque not cashed: sent %v, balances %d, %d", sent, providerSwap.Balance(retriever), retrieverSwap.Balance(provider))
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	})
+	if result.Error != nil {
+		t.Fatal(result.Error)
+	}
+}
@@ -14,288 +14,303 @@
 // You should have received a copy of the GNU Lesser General Public License
 // along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
 
+// Package swap implements the Swarm Accounting Protocol: the balance of the
+// services exchanged with each peer is accounted, and once the local node owes
+// enough to a peer, it pays its debt with an off-chain cheque. The cheques are
+// issued and cashed through a pluggable Settlement.
 package swap
 
 import (
 	"context"
-	"crypto/ecdsa"
 	"errors"
 	"fmt"
-	"math/big"
-	"os"
-	"path/filepath"
 	"sync"
-	"time"
 
-	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/contracts/chequebook"
-	"github.com/ethereum/go-ethereum/contracts/chequebook/contract"
-	"github.com/ethereum/go-ethereum/core/types"
-	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/protocols"
 	"github.com/ethereum/go-ethereum/swarm/log"
-	"github.com/ethereum/go-ethereum/swarm/services/swap/swap"
+	"github.com/ethereum/go-ethereum/swarm/state"
 )
 
-// SwAP       Swarm Accounting Protocol with
-// SWAP^2     Strategies of Withholding Automatic Payments
-// SWAP^3     Accreditation: payment via credit SWAP
-// using chequebook pkg for delayed payments
-// default parameters
+// Default thresholds, in accounting units
+const (
+	DefaultPaymentThreshold    = 1000000 // debt of the local node that triggers a payment
+	DefaultDisconnectThreshold = 1500000 // debt of a peer that triggers a disconnect
+)
 
 var (
-	autoCashInterval     = 300 * time.Second           // default interval for autocash
-	autoCashThreshold    = big.NewInt(50000000000000)  // threshold that triggers autocash (wei)
-	autoDepositInterval  = 300 * time.Second           // default interval for autocash
-	autoDepositThreshold = big.NewInt(50000000000000)  // threshold that triggers autodeposit (wei)
-	autoDepositBuffer    = big.NewInt(100000000000000) // buffer that is surplus for fork protection etc (wei)
-	buyAt                = big.NewInt(20000000000)     // maximum chunk price host is willing to pay (wei)
-	sellAt               = big.NewInt(20000000000)     // minimum chunk price host requires (wei)
-	payAt                = 100                         // threshold that triggers payment {request} (units)
-	dropAt               = 10000                       // threshold that triggers disconnect (units)
+	errBalanceExceeded = errors.New("balance exceeds disconnect threshold")
+	errNoSettlement    = errors.New("cheques not accepted")
+	errWrongContract   = errors.New("cheque drawn on different contract than advertised")
+	errWrongRecipient  = errors.New("cheque payable to different beneficiary")
+	errStaleCheque     = errors.New("cheque amount not above the previous one")
+
+	errInvalidPaymentThreshold    = errors.New("payment threshold must be positive")
+	errInvalidDisconnectThreshold = errors.New("disconnect threshold must be above the payment threshold")
 )
 
-const (
-	chequebookDeployRetries = 5
-	chequebookDeployDelay   = 1 * time.Second // delay between retries
-)
+// Params are the configurable thresholds of SWAP. The thresholds are expressed
+// in accounting units, the amounts of which are paid 1:1 by the cheques.
+type Params struct {
+	PaymentThreshold    int64 // debt of the local node that triggers a payment
+	DisconnectThreshold int64 // debt of a peer that triggers a disconnect
+}
 
-// LocalProfile combines a PayProfile with *swap.Params
-type LocalProfile struct {
-	*swap.Params
-	*PayProfile
+// NewDefaultParams returns the default SWAP parameters.
+func NewDefaultParams() *Params {
+	return &Params{
+		PaymentThreshold:    DefaultPaymentThreshold,
+		DisconnectThreshold: DefaultDisconnectThreshold,
+	}
 }
 
-// RemoteProfile combines a PayProfile with *swap.Profile
-type RemoteProfile struct {
-	*swap.Profile
-	*PayProfile
+// Validate checks that the thresholds are consistent: the local node must pay
+// its debt before the peer disconnects it for the balance.
+func (p *Params) Validate() error {
+	if p.PaymentThreshold <= 0 {
+		return errInvalidPaymentThreshold
+	}
+	if p.DisconnectThreshold <= p.PaymentThreshold {
+		return errInvalidDisconnectThreshold
+	}
+	return nil
 }
 
-// PayProfile is a container for relevant chequebook and beneficiary options
-type PayProfile struct {
-	PublicKey   string         // check against signature of promise
-	Contract    common.Address // address of chequebook contract
-	Beneficiary common.Address // recipient address for swarm sales revenue
-	privateKey  *ecdsa.PrivateKey
-	publicKey   *ecdsa.PublicKey
-	owner       common.Address
-	chbook      *chequebook.Chequebook
-	lock        sync.RWMutex
+// Swap is the SWAP accounting of the local node with all its peers. It
+// implements protocols.Balance, to be used as the accounting hook of the
+// protocols exchanging priced messages.
+type Swap struct {
+	store       state.Store    // persists the balances and the cheques
+	params      *Params        // thresholds of accounting
+	beneficiary common.Address // recipient of the cheques to the local node
+
+	lock       sync.Mutex                // protects the balances, the cheques and the settlement
+	settlement Settlement                // cheque issuing and cashing, nil if not paying
+	balances   map[discover.NodeID]int64 // positive if the peer owes the local node
+	peers      map[discover.NodeID]*Peer // swap protocol peers, to send cheques to
+	cashing    sync.WaitGroup            // cheques being cashed
+	quit       chan struct{}             // terminates cheque cashing
 }
 
-// NewDefaultSwapParams create params with default values
-func NewDefaultSwapParams() *LocalProfile {
-	return &LocalProfile{
-		PayProfile: &PayProfile{},
-		Params: &swap.Params{
-			Profile: &swap.Profile{
-				BuyAt:  buyAt,
-				SellAt: sellAt,
-				PayAt:  uint(payAt),
-				DropAt: uint(dropAt),
-			},
-			Strategy: &swap.Strategy{
-				AutoCashInterval:     autoCashInterval,
-				AutoCashThreshold:    autoCashThreshold,
-				AutoDepositInterval:  autoDepositInterval,
-				AutoDepositThreshold: autoDepositThreshold,
-				AutoDepositBuffer:    autoDepositBuffer,
-			},
-		},
+// New creates the SWAP accounting of the local node. Without a settlement the
+// balances are still accounted and the peers disconnected over the threshold,
+// but no payments are made or accepted.
+func New(store state.Store, params *Params, beneficiary common.Address, settlement Settlement) (*Swap, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
 	}
+	return &Swap{
+		store:       store,
+		params:      params,
+		settlement:  settlement,
+		beneficiary: beneficiary,
+		balances:    make(map[discover.NodeID]int64),
+		peers:       make(map[discover.NodeID]*Peer),
+		quit:        make(chan struct{}),
+	}, nil
 }
 
-// Init this can only finally be set after all config options (file, cmd line, env vars)
-// have been evaluated
-func (lp *LocalProfile) Init(contract common.Address, prvkey *ecdsa.PrivateKey) {
-	pubkey := &prvkey.PublicKey
-
-	lp.PayProfile = &PayProfile{
-		PublicKey:   common.ToHex(crypto.FromECDSAPub(pubkey)),
-		Contract:    contract,
-		Beneficiary: crypto.PubkeyToAddress(*pubkey),
-		privateKey:  prvkey,
-		publicKey:   pubkey,
-		owner:       crypto.PubkeyToAddress(*pubkey),
-	}
+// SetSettlement sets the settlement the cheques are issued and cashed through,
+// once it's available. The peers connected before only learn about it when they
+// reconnect.
+func (s *Swap) SetSettlement(settlement Settlement) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.settlement = settlement
 }
 
-// NewSwap constructor, parameters
-// * global chequebook, assume deployed service and
-// * the balance is at buffer.
-// swap.Add(n) called in netstore
-// n > 0 called when sending chunks = receiving retrieve requests
-//                 OR sending cheques.
-// n < 0  called when receiving chunks = receiving delivery responses
-//                 OR receiving cheques.
-func NewSwap(localProfile *LocalProfile, remoteProfile *RemoteProfile, backend chequebook.Backend, proto swap.Protocol) (swapInstance *swap.Swap, err error) {
-	var (
-		ctx = context.TODO()
-		ok  bool
-		in  *chequebook.Inbox
-		out *chequebook.Outbox
-	)
-
-	remotekey, err := crypto.UnmarshalPubkey(common.FromHex(remoteProfile.PublicKey))
-	if err != nil {
-		return nil, errors.New("invalid remote public key")
+// Add credits the peer's balance with the amount, which is negative if the local
+// node is the one owing. It issues a cheque to the peer once the debt of the local
+// node exceeds the payment threshold, and returns an error, dropping the peer, if
+// the balance would exceed the disconnect threshold either way.
+func (s *Swap) Add(amount int64, peer *protocols.Peer) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	id := peer.ID()
+	balance := s.loadBalance(id) + amount
+	if balance > s.params.DisconnectThreshold || balance < -s.params.DisconnectThreshold {
+		log.Warn("SWAP balance exceeded", "peer", id, "balance", balance, "threshold", s.params.DisconnectThreshold)
+		return errBalanceExceeded
 	}
+	s.setBalance(id, balance)
 
-	// check if remoteProfile chequebook is valid
-	// insolvent chequebooks suicide so will signal as invalid
-	// TODO: monitoring a chequebooks events
-	ok, err = chequebook.ValidateCode(ctx, backend, remoteProfile.Contract)
-	if !ok {
-		log.Info(fmt.Sprintf("invalid contract %v for peer %v: %v)", remoteProfile.Contract.Hex()[:8], proto, err))
-	} else {
-		// remoteProfile contract valid, create inbox
-		in, err = chequebook.NewInbox(localProfile.privateKey, remoteProfile.Contract, localProfile.Beneficiary, remotekey, backend)
-		if err != nil {
-			log.Warn(fmt.Sprintf("unable to set up inbox for chequebook contract %v for peer %v: %v)", remoteProfile.Contract.Hex()[:8], proto, err))
-		}
+	if balance <= -s.params.PaymentThreshold {
+		s.pay(id, uint64(-balance))
 	}
+	return nil
+}
+
+// Balance returns the balance with the peer, positive if the peer owes the local
+// node, negative if the local node owes the peer.
+func (s *Swap) Balance(id discover.NodeID) int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.loadBalance(id)
+}
 
-	// check if localProfile chequebook contract is valid
-	ok, err = chequebook.ValidateCode(ctx, backend, localProfile.Contract)
-	if !ok {
-		log.Warn(fmt.Sprintf("unable to set up outbox for peer %v:  chequebook contract (owner: %v): %v)", proto, localProfile.owner.Hex(), err))
-	} else {
-		out = chequebook.NewOutbox(localProfile.Chequebook(), remoteProfile.Beneficiary)
+// Balances returns the balances with the peers accounted since the node started.
+func (s *Swap) Balances() map[discover.NodeID]int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	balances := make(map[discover.NodeID]int64, len(s.balances))
+	for id, balance := range s.balances {
+		balances[id] = balance
 	}
+	return balances
+}
+
+// Close waits for the cheques being cashed.
+func (s *Swap) Close() {
+	close(s.quit)
+	s.cashing.Wait()
+}
 
-	pm := swap.Payment{
-		In:    in,
-		Out:   out,
-		Buys:  out != nil,
-		Sells: in != nil,
+// pay issues a cheque of the amount to the peer, if it's connected over the swap
+// protocol and accepts cheques. The cheque settles the balance immediately, its
+// cumulative amount makes up for cheques which were lost.
+// The caller must hold the lock.
+func (s *Swap) pay(id discover.NodeID, amount uint64) {
+	peer := s.peers[id]
+	if s.settlement == nil || peer == nil || peer.contract == (common.Address{}) {
+		log.Trace("SWAP payment not possible", "peer", id, "amount", amount)
+		return
 	}
-	swapInstance, err = swap.New(localProfile.Params, pm, proto)
-	if err != nil {
+	var sent uint64
+	key := sentKey(peer.beneficiary)
+	if err := s.store.Get(key, &sent); err != nil && err != state.ErrNotFound {
+		log.Error("SWAP failed to load sent amount", "peer", id, "err", err)
 		return
 	}
-	// remoteProfile profile given (first) in handshake
-	swapInstance.SetRemote(remoteProfile.Profile)
-	var buy, sell string
-	if swapInstance.Buys {
-		buy = "purchase from peer enabled at " + remoteProfile.SellAt.String() + " wei/chunk"
-	} else {
-		buy = "purchase from peer disabled"
+	cheque, err := s.settlement.Issue(peer.beneficiary, sent+amount)
+	if err != nil {
+		log.Error("SWAP failed to issue cheque", "peer", id, "amount", amount, "err", err)
+		return
 	}
-	if swapInstance.Sells {
-		sell = "selling to peer enabled at " + localProfile.SellAt.String() + " wei/chunk"
-	} else {
-		sell = "selling to peer disabled"
+	if err := s.store.Put(key, cheque.Amount); err != nil {
+		log.Error("SWAP failed to store sent amount", "peer", id, "err", err)
+		return
 	}
-	log.Warn(fmt.Sprintf("SWAP arrangement with <%v>: %v; %v)", proto, buy, sell))
-
-	return
-}
-
-// Chequebook get's chequebook from the localProfile
-func (lp *LocalProfile) Chequebook() *chequebook.Chequebook {
-	defer lp.lock.Unlock()
-	lp.lock.Lock()
-	return lp.chbook
-}
-
-// PrivateKey accessor
-func (lp *LocalProfile) PrivateKey() *ecdsa.PrivateKey {
-	return lp.privateKey
-}
+	s.setBalance(id, s.balances[id]+int64(amount))
 
-// func (self *LocalProfile) PublicKey() *ecdsa.PublicKey {
-// 	return self.publicKey
-// }
-
-// SetKey set's private and public key on localProfile
-func (lp *LocalProfile) SetKey(prvkey *ecdsa.PrivateKey) {
-	lp.privateKey = prvkey
-	lp.publicKey = &prvkey.PublicKey
+	log.Debug("SWAP cheque issued", "peer", id, "amount", amount, "cumulative", cheque.Amount)
+	go func() {
+		if err := peer.Send(context.Background(), &EmitChequeMsg{Cheque: cheque}); err != nil {
+			log.Warn("SWAP failed to send cheque", "peer", id, "err", err)
+		}
+	}()
 }
 
-// SetChequebook wraps the chequebook initialiser and sets up autoDeposit to cover spending.
-func (lp *LocalProfile) SetChequebook(ctx context.Context, backend chequebook.Backend, path string) error {
-	lp.lock.Lock()
-	swapContract := lp.Contract
-	lp.lock.Unlock()
-
-	valid, err := chequebook.ValidateCode(ctx, backend, swapContract)
-	if err != nil {
+// receive processes a cheque received from the peer, crediting the local node
+// with the amount paid since the previous cheque, and cashes it. The credit is
+// capped at the debt of the peer, so that a cheque, which may still bounce, can
+// never make the local node owe the peer and pay it back.
+func (s *Swap) receive(peer *Peer, cheque *Cheque) error {
+	s.lock.Lock()
+	settlement := s.settlement
+	s.lock.Unlock()
+
+	if settlement == nil {
+		return errNoSettlement
+	}
+	if cheque.Contract != peer.contract {
+		return errWrongContract
+	}
+	if cheque.Beneficiary != s.beneficiary {
+		return errWrongRecipient
+	}
+	if err := settlement.Verify(cheque, peer.issuer); err != nil {
 		return err
-	} else if valid {
-		return lp.newChequebookFromContract(path, backend)
 	}
-	return lp.deployChequebook(ctx, backend, path)
-}
 
-// deployChequebook deploys the localProfile Chequebook
-func (lp *LocalProfile) deployChequebook(ctx context.Context, backend chequebook.Backend, path string) error {
-	opts := bind.NewKeyedTransactor(lp.privateKey)
-	opts.Value = lp.AutoDepositBuffer
-	opts.Context = ctx
+	s.lock.Lock()
+	defer s.lock.Unlock()
 
-	log.Info(fmt.Sprintf("Deploying new chequebook (owner: %v)", opts.From.Hex()))
-	address, err := deployChequebookLoop(opts, backend)
-	if err != nil {
-		log.Error(fmt.Sprintf("unable to deploy new chequebook: %v", err))
+	var last Cheque
+	key := receivedKey(cheque.Contract)
+	if err := s.store.Get(key, &last); err != nil && err != state.ErrNotFound {
 		return err
 	}
-	log.Info(fmt.Sprintf("new chequebook deployed at %v (owner: %v)", address.Hex(), opts.From.Hex()))
-
-	// need to save config at this point
-	lp.lock.Lock()
-	lp.Contract = address
-	err = lp.newChequebookFromContract(path, backend)
-	lp.lock.Unlock()
-	if err != nil {
-		log.Warn(fmt.Sprintf("error initialising cheque book (owner: %v): %v", opts.From.Hex(), err))
+	if cheque.Amount <= last.Amount {
+		return errStaleCheque
+	}
+	if err := s.store.Put(key, cheque); err != nil {
+		return err
+	}
+	amount := cheque.Amount - last.Amount
+	id := peer.ID()
+	balance := s.loadBalance(id)
+
+	credit := amount
+	if balance <= 0 {
+		credit = 0
+	} else if amount > uint64(balance) {
+		credit = uint64(balance)
+	}
+	if credit < amount {
+		log.Warn("SWAP cheque exceeds debt", "peer", id, "amount", amount, "debt", balance)
 	}
-	return err
+	s.setBalance(id, balance-int64(credit))
+
+	log.Debug("SWAP cheque received", "peer", id, "amount", amount, "credit", credit, "cumulative", cheque.Amount)
+
+	s.cashing.Add(1)
+	go func() {
+		defer s.cashing.Done()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go func() {
+			select {
+			case <-s.quit:
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+		if err := settlement.Cash(ctx, cheque); err != nil {
+			log.Warn("SWAP failed to cash cheque", "contract", cheque.Contract, "amount", cheque.Amount, "err", err)
+		}
+	}()
+	return nil
 }
 
-// deployChequebookLoop repeatedly tries to deploy a chequebook.
-func deployChequebookLoop(opts *bind.TransactOpts, backend chequebook.Backend) (addr common.Address, err error) {
-	var tx *types.Transaction
-	for try := 0; try < chequebookDeployRetries; try++ {
-		if try > 0 {
-			time.Sleep(chequebookDeployDelay)
-		}
-		if _, tx, _, err = contract.DeployChequebook(opts, backend); err != nil {
-			log.Warn(fmt.Sprintf("can't send chequebook deploy tx (try %d): %v", try, err))
-			continue
-		}
-		if addr, err = bind.WaitDeployed(opts.Context, backend, tx); err != nil {
-			log.Warn(fmt.Sprintf("chequebook deploy error (try %d): %v", try, err))
-			continue
-		}
-		return addr, nil
+// loadBalance returns the balance with the peer, loading it from the store if
+// it isn't cached yet. The caller must hold the lock.
+func (s *Swap) loadBalance(id discover.NodeID) int64 {
+	if balance, ok := s.balances[id]; ok {
+		return balance
+	}
+	var balance int64
+	if err := s.store.Get(balanceKey(id), &balance); err != nil && err != state.ErrNotFound {
+		log.Error("SWAP failed to load balance", "peer", id, "err", err)
 	}
-	return addr, err
+	s.balances[id] = balance
+	return balance
 }
 
-// newChequebookFromContract - initialise the chequebook from a persisted json file or create a new one
-// caller holds the lock
-func (lp *LocalProfile) newChequebookFromContract(path string, backend chequebook.Backend) error {
-	hexkey := common.Bytes2Hex(lp.Contract.Bytes())
-	err := os.MkdirAll(filepath.Join(path, "chequebooks"), os.ModePerm)
-	if err != nil {
-		return fmt.Errorf("unable to create directory for chequebooks: %v", err)
+// setBalance updates the balance with the peer, and persists it.
+// The caller must hold the lock.
+func (s *Swap) setBalance(id discover.NodeID, balance int64) {
+	s.balances[id] = balance
+	if err := s.store.Put(balanceKey(id), balance); err != nil {
+		log.Error("SWAP failed to store balance", "peer", id, "err", err)
 	}
+}
 
-	chbookpath := filepath.Join(path, "chequebooks", hexkey+".json")
-	lp.chbook, err = chequebook.LoadChequebook(chbookpath, lp.privateKey, backend, true)
-
-	if err != nil {
-		lp.chbook, err = chequebook.NewChequebook(chbookpath, lp.Contract, lp.privateKey, backend)
-		if err != nil {
-			log.Warn(fmt.Sprintf("unable to initialise chequebook (owner: %v): %v", lp.owner.Hex(), err))
-			return fmt.Errorf("unable to initialise chequebook (owner: %v): %v", lp.owner.Hex(), err)
-		}
-	}
+// balanceKey is the store key of the balance with a peer.
+func balanceKey(id discover.NodeID) string {
+	return fmt.Sprintf("swap_balance_%x", id[:])
+}
 
-	lp.chbook.AutoDeposit(lp.AutoDepositInterval, lp.AutoDepositThreshold, lp.AutoDepositBuffer)
-	log.Info(fmt.Sprintf("auto deposit ON for %v -> %v: interval = %v, threshold = %v, buffer = %v)", crypto.PubkeyToAddress(*(lp.publicKey)).Hex()[:8], lp.Contract.Hex()[:8], lp.AutoDepositInterval, lp.AutoDepositThreshold, lp.AutoDepositBuffer))
+// sentKey is the store key of the cumulative amount of the cheques sent to a
+// beneficiary.
+func sentKey(beneficiary common.Address) string {
+	return fmt.Sprintf("swap_sent_%x", beneficiary[:])
+}
 
-	return nil
+// receivedKey is the store key of the last cheque received drawn on a contract.
+func receivedKey(contract common.Address) string {
+	return fmt.Sprintf("swap_received_%x", contract[:])
 }
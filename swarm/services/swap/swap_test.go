@@ -0,0 +1,367 @@
+// Copyright 2018 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package swap
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/p2p"
+	"github.com/ethereum/go-ethereum/p2p/discover"
+	"github.com/ethereum/go-ethereum/p2p/protocols"
+	"github.com/ethereum/go-ethereum/swarm/state"
+)
+
+var errTestSignature = errors.New("invalid test signature")
+
+// testSettlement issues cheques "signed" with the issuer address, and records
+// the cashed cheques.
+type testSettlement struct {
+	contract common.Address
+	issuer   common.Address
+	cashed   chan *Cheque
+}
+
+func newTestSettlement(contract, issuer byte) *testSettlement {
+	return &testSettlement{
+		contract: common.Address{contract},
+		issuer:   common.Address{issuer},
+		cashed:   make(chan *Cheque, 10),
+	}
+}
+
+func (s *testSettlement) Contract() common.Address { return s.contract }
+func (s *testSettlement) Issuer() common.Address   { return s.issuer }
+
+func (s *testSettlement) Issue(beneficiary common.Address, amount uint64) (*Cheque, error) {
+	return &Cheque{
+		Contract:    s.contract,
+		Beneficiary: beneficiary,
+		Amount:      amount,
+		Sig:         s.issuer.Bytes(),
+	}, nil
+}
+
+func (s *testSettlement) Verify(cheque *Cheque, issuer common.Address) error {
+	if !bytes.Equal(cheque.Sig, issuer.Bytes()) {
+		return errTestSignature
+	}
+	return nil
+}
+
+func (s *testSettlement) Cash(ctx context.Context, cheque *Cheque) error {
+	s.cashed <- cheque
+	return nil
+}
+
+func newTestParams() *Params {
+	return &Params{
+		PaymentThreshold:    100,
+		DisconnectThreshold: 150,
+	}
+}
+
+// newTestSwap creates a SWAP accounting with the test thresholds.
+func newTestSwap(store state.Store, beneficiary common.Address, settlement Settlement) *Swap {
+	s, err := New(store, newTestParams(), beneficiary, settlement)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// newTestPeer creates a protocol peer which isn't connected.
+func newTestPeer(id byte) *protocols.Peer {
+	return protocols.NewPeer(p2p.NewPeer(discover.NodeID{id}, "test", nil), nil, Spec)
+}
+
+// bufferedRW queues the messages written to a message pipe, so that both ends
+// can send before receiving, as over a network connection.
+type bufferedRW struct {
+	p2p.MsgReadWriter
+	queue chan p2p.Msg
+}
+
+func newBufferedRW(rw p2p.MsgReadWriter) *bufferedRW {
+	b := &bufferedRW{
+		MsgReadWriter: rw,
+		queue:         make(chan p2p.Msg, 10),
+	}
+	go func() {
+		for msg := range b.queue {
+			if err := rw.WriteMsg(msg); err != nil {
+				return
+			}
+		}
+	}()
+	return b
+}
+
+func (rw *bufferedRW) WriteMsg(msg p2p.Msg) error {
+	payload, err := ioutil.ReadAll(msg.Payload)
+	if err != nil {
+		return err
+	}
+	rw.queue <- p2p.Msg{Code: msg.Code, Size: uint32(len(payload)), Payload: bytes.NewReader(payload)}
+	return nil
+}
+
+// connectSwaps runs the swap protocol between the two swaps over a message pipe,
+// and returns the peers of a and b as seen by the other.
+func connectSwaps(t *testing.T, a, b *Swap) (peerA, peerB *Peer) {
+	idA, idB := discover.NodeID{1}, discover.NodeID{2}
+	rwA, rwB := p2p.MsgPipe()
+	go a.run(p2p.NewPeer(idB, "b", nil), newBufferedRW(rwA))
+	go b.run(p2p.NewPeer(idA, "a", nil), newBufferedRW(rwB))
+
+	for start := time.Now(); time.Since(start) < 3*time.Second; time.Sleep(10 * time.Millisecond) {
+		a.lock.Lock()
+		peerB = a.peers[idB]
+		a.lock.Unlock()
+		b.lock.Lock()
+		peerA = b.peers[idA]
+		b.lock.Unlock()
+		if peerA != nil && peerB != nil {
+			return peerA, peerB
+		}
+	}
+	t.Fatal("timeout waiting for the swap handshake")
+	return nil, nil
+}
+
+func waitCashed(t *testing.T, s *testSettlement, amount uint64) {
+	select {
+	case cheque := <-s.cashed:
+		if cheque.Amount != amount {
+			t.Fatalf("cashed cheque amount mismatch: have %d, want %d", cheque.Amount, amount)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatalf("timeout waiting for cheque of %d to be cashed", amount)
+	}
+}
+
+// Tests that inconsistent thresholds are rejected when creating the accounting.
+func TestSwapInvalidThresholds(t *testing.T) {
+	tests := []struct {
+		payment, disconnect int64
+		err                 error
+	}{
+		{100, 150, nil},
+		{0, 150, errInvalidPaymentThreshold},
+		{-100, 150, errInvalidPaymentThreshold},
+		{100, 100, errInvalidDisconnectThreshold},
+		{150, 100, errInvalidDisconnectThreshold},
+	}
+	for i, tt := range tests {
+		params := &Params{PaymentThreshold: tt.payment, DisconnectThreshold: tt.disconnect}
+		if _, err := New(state.NewInmemoryStore(), params, common.Address{0xa}, nil); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+}
+
+func TestSwapPayment(t *testing.T) {
+	settlementA, settlementB := newTestSettlement(1, 1), newTestSettlement(2, 2)
+	a := newTestSwap(state.NewInmemoryStore(), common.Address{0xa}, settlementA)
+	b := newTestSwap(state.NewInmemoryStore(), common.Address{0xb}, settlementB)
+	defer a.Close()
+	defer b.Close()
+
+	peerA, peerB := connectSwaps(t, a, b)
+
+	// Debt below the payment threshold is only accounted, on both sides
+	if err := a.Add(-60, peerB.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Add(60, peerA.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if balance := a.Balance(peerB.ID()); balance != -60 {
+		t.Fatalf("balance mismatch: have %d, want %d", balance, -60)
+	}
+	// Debt over the payment threshold is paid, the peer cashes the cheque
+	if err := b.Add(50, peerA.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add(-50, peerB.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if balance := a.Balance(peerB.ID()); balance != 0 {
+		t.Fatalf("balance mismatch after payment: have %d, want 0", balance)
+	}
+	waitCashed(t, settlementB, 110)
+	if balance := b.Balance(peerA.ID()); balance != 0 {
+		t.Fatalf("peer balance mismatch after payment: have %d, want 0", balance)
+	}
+	// Cheque amounts are cumulative
+	if err := b.Add(100, peerA.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Add(-100, peerB.Peer); err != nil {
+		t.Fatal(err)
+	}
+	waitCashed(t, settlementB, 210)
+	if balance := b.Balance(peerA.ID()); balance != 0 {
+		t.Fatalf("peer balance mismatch after payment: have %d, want 0", balance)
+	}
+}
+
+func TestSwapDisconnectThreshold(t *testing.T) {
+	s := newTestSwap(state.NewInmemoryStore(), common.Address{0xa}, nil)
+	defer s.Close()
+
+	peer := newTestPeer(1)
+	if err := s.Add(140, peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(20, peer); err != errBalanceExceeded {
+		t.Fatalf("expected error %v, got %v", errBalanceExceeded, err)
+	}
+	if balance := s.Balance(peer.ID()); balance != 140 {
+		t.Fatalf("balance mismatch: have %d, want %d", balance, 140)
+	}
+	// Without a settlement, the debt of the local node is not paid
+	if err := s.Add(-280, peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(-20, peer); err != errBalanceExceeded {
+		t.Fatalf("expected error %v, got %v", errBalanceExceeded, err)
+	}
+}
+
+func TestSwapReceiveInvalidCheque(t *testing.T) {
+	settlement := newTestSettlement(2, 2)
+	s := newTestSwap(state.NewInmemoryStore(), common.Address{0xb}, settlement)
+	defer s.Close()
+
+	peer := &Peer{
+		Peer:     newTestPeer(1),
+		swap:     s,
+		contract: common.Address{1},
+		issuer:   common.Address{1},
+	}
+	issuer := newTestSettlement(1, 1)
+	cheque, _ := issuer.Issue(common.Address{0xb}, 100)
+
+	if err := s.Add(100, peer.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.receive(peer, cheque); err != nil {
+		t.Fatalf("failed to receive valid cheque: %v", err)
+	}
+	waitCashed(t, settlement, 100)
+
+	tests := []struct {
+		name   string
+		cheque *Cheque
+		err    error
+	}{
+		{"stale", &Cheque{Contract: common.Address{1}, Beneficiary: common.Address{0xb}, Amount: 100, Sig: cheque.Sig}, errStaleCheque},
+		{"wrong contract", &Cheque{Contract: common.Address{3}, Beneficiary: common.Address{0xb}, Amount: 200, Sig: cheque.Sig}, errWrongContract},
+		{"wrong beneficiary", &Cheque{Contract: common.Address{1}, Beneficiary: common.Address{0xc}, Amount: 200, Sig: cheque.Sig}, errWrongRecipient},
+		{"wrong signature", &Cheque{Contract: common.Address{1}, Beneficiary: common.Address{0xb}, Amount: 200, Sig: []byte{3}}, errTestSignature},
+	}
+	for _, tt := range tests {
+		if err := s.receive(peer, tt.cheque); err != tt.err {
+			t.Errorf("%s cheque: expected error %v, got %v", tt.name, tt.err, err)
+		}
+	}
+	if balance := s.Balance(peer.ID()); balance != 0 {
+		t.Fatalf("balance mismatch: have %d, want 0", balance)
+	}
+
+	// Cheques are refused without a settlement
+	s = newTestSwap(state.NewInmemoryStore(), common.Address{0xb}, nil)
+	defer s.Close()
+	if err := s.receive(peer, cheque); err != errNoSettlement {
+		t.Fatalf("expected error %v, got %v", errNoSettlement, err)
+	}
+}
+
+// Tests that a cheque only settles the debt of the peer, and can't make the
+// local node owe the peer and pay it back.
+func TestSwapReceiveExcessCheque(t *testing.T) {
+	settlement := newTestSettlement(2, 2)
+	s := newTestSwap(state.NewInmemoryStore(), common.Address{0xb}, settlement)
+	defer s.Close()
+
+	peer := &Peer{
+		Peer:     newTestPeer(1),
+		swap:     s,
+		contract: common.Address{1},
+		issuer:   common.Address{1},
+	}
+	issuer := newTestSettlement(1, 1)
+
+	if err := s.Add(40, peer.Peer); err != nil {
+		t.Fatal(err)
+	}
+	cheque, _ := issuer.Issue(common.Address{0xb}, 1000)
+	if err := s.receive(peer, cheque); err != nil {
+		t.Fatalf("failed to receive cheque: %v", err)
+	}
+	waitCashed(t, settlement, 1000)
+	if balance := s.Balance(peer.ID()); balance != 0 {
+		t.Fatalf("balance mismatch: have %d, want 0", balance)
+	}
+	// The excess isn't credited to future debt either
+	if err := s.Add(60, peer.Peer); err != nil {
+		t.Fatal(err)
+	}
+	if balance := s.Balance(peer.ID()); balance != 60 {
+		t.Fatalf("balance mismatch: have %d, want %d", balance, 60)
+	}
+	cheque, _ = issuer.Issue(common.Address{0xb}, 1100)
+	if err := s.receive(peer, cheque); err != nil {
+		t.Fatalf("failed to receive cheque: %v", err)
+	}
+	waitCashed(t, settlement, 1100)
+	if balance := s.Balance(peer.ID()); balance != 0 {
+		t.Fatalf("balance mismatch: have %d, want 0", balance)
+	}
+	// Without debt, a cheque credits nothing
+	cheque, _ = issuer.Issue(common.Address{0xb}, 1200)
+	if err := s.receive(peer, cheque); err != nil {
+		t.Fatalf("failed to receive cheque: %v", err)
+	}
+	waitCashed(t, settlement, 1200)
+	if balance := s.Balance(peer.ID()); balance != 0 {
+		t.Fatalf("balance mismatch: have %d, want 0", balance)
+	}
+}
+
+func TestSwapBalancePersisted(t *testing.T) {
+	store := state.NewInmemoryStore()
+	peer := newTestPeer(1)
+
+	s := newTestSwap(store, common.Address{0xa}, nil)
+	if err := s.Add(42, peer); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = newTestSwap(store, common.Address{0xa}, nil)
+	defer s.Close()
+	if balance := s.Balance(peer.ID()); balance != 42 {
+		t.Fatalf("balance mismatch after restart: have %d, want %d", balance, 42)
+	}
+}
@@ -31,8 +31,8 @@ import (
 
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/contracts/chequebook"
 	"github.com/ethereum/go-ethereum/contracts/ens"
+	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/p2p"
@@ -47,6 +47,7 @@ import (
 	"github.com/ethereum/go-ethereum/swarm/network"
 	"github.com/ethereum/go-ethereum/swarm/network/stream"
 	"github.com/ethereum/go-ethereum/swarm/pss"
+	"github.com/ethereum/go-ethereum/swarm/services/swap"
 	"github.com/ethereum/go-ethereum/swarm/state"
 	"github.com/ethereum/go-ethereum/swarm/storage"
 	"github.com/ethereum/go-ethereum/swarm/storage/mock"
@@ -54,6 +55,9 @@ import (
 	"github.com/ethereum/go-ethereum/swarm/tracing"
 )
 
+// chequebookKey is the state store key of the address of the deployed chequebook
+const chequebookKey = "swap_chequebook"
+
 var (
 	startTime          time.Time
 	updateGaugesPeriod = 5 * time.Second
@@ -65,26 +69,27 @@ var (
 
 // the swarm stack
 type Swarm struct {
-	config      *api.Config        // swarm configuration
-	api         *api.API           // high level api layer (fs/manifest)
-	dns         api.Resolver       // DNS registrar
-	fileStore   *storage.FileStore // distributed preimage archive, the local API to the storage with document level storage/retrieval support
-	streamer    *stream.Registry
-	bzz         *network.Bzz       // the logistic manager
-	backend     chequebook.Backend // simple blockchain Backend
-	privateKey  *ecdsa.PrivateKey
-	corsString  string
-	swapEnabled bool
-	netStore    *storage.NetStore
-	sfs         *fuse.SwarmFS // need this to cleanup all the active mounts on node exit
-	ps          *pss.Pss
+	config     *api.Config        // swarm configuration
+	api        *api.API           // high level api layer (fs/manifest)
+	dns        api.Resolver       // DNS registrar
+	fileStore  *storage.FileStore // distributed preimage archive, the local API to the storage with document level storage/retrieval support
+	streamer   *stream.Registry
+	bzz        *network.Bzz // the logistic manager
+	backend    swap.Backend // simple blockchain Backend
+	privateKey *ecdsa.PrivateKey
+	corsString string
+	swap       *swap.Swap // SWAP accounting, nil if disabled
+	netStore   *storage.NetStore
+	stateStore *state.DBStore
+	sfs        *fuse.SwarmFS // need this to cleanup all the active mounts on node exit
+	ps         *pss.Pss
 
 	tracerClose io.Closer
 }
 
 type SwarmAPI struct {
 	Api     *api.API
-	Backend chequebook.Backend
+	Backend swap.Backend
 }
 
 func (self *Swarm) API() *SwarmAPI {
@@ -107,7 +112,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		return nil, fmt.Errorf("empty bzz key")
 	}
 
-	var backend chequebook.Backend
+	var backend swap.Backend
 	if config.SwapAPI != "" && config.SwapEnabled {
 		log.Info("connecting to SWAP API", "url", config.SwapAPI)
 		backend, err = ethclient.Dial(config.SwapAPI)
@@ -147,6 +152,16 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 		return
 	}
 
+	self.stateStore = stateStore
+
+	// set up SWAP accounting, paying with cheques once the chequebook is set
+	if config.SwapEnabled {
+		beneficiary := crypto.PubkeyToAddress(self.privateKey.PublicKey)
+		if self.swap, err = swap.New(stateStore, config.Swap, beneficiary, nil); err != nil {
+			return nil, err
+		}
+	}
+
 	// set up high level api
 	var resolver *api.MultiResolver
 	if len(config.EnsAPIs) > 0 {
@@ -181,12 +196,16 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 	delivery := stream.NewDelivery(to, self.netStore)
 	self.netStore.NewNetFetcherFunc = network.NewFetcherFactory(delivery.RequestFromPeers, config.DeliverySkipCheck).New
 
-	self.streamer = stream.NewRegistry(addr, delivery, self.netStore, stateStore, &stream.RegistryOptions{
+	registryOptions := &stream.RegistryOptions{
 		SkipCheck:       config.SyncingSkipCheck,
 		DoSync:          config.SyncEnabled,
 		DoRetrieve:      true,
 		SyncUpdateDelay: config.SyncUpdateDelay,
-	})
+	}
+	if self.swap != nil {
+		registryOptions.Balance = self.swap
+	}
+	self.streamer = stream.NewRegistry(addr, delivery, self.netStore, stateStore, registryOptions)
 
 	// Swarm Hash Merklised Chunking for Arbitrary-length Document/File storage
 	self.fileStore = storage.NewFileStore(self.netStore, self.config.FileStoreParams)
@@ -204,7 +223,7 @@ func NewSwarm(config *api.Config, mockStore *mock.NodeStore) (self *Swarm, err e
 
 	log.Debug("Setup local storage")
 
-	self.bzz = network.NewBzz(bzzconfig, to, stateStore, stream.Spec, self.streamer.Run)
+	self.bzz = network.NewBzz(bzzconfig, to, stateStore, self.streamer.Spec(), self.streamer.Run)
 
 	// Pss = postal service over swarm (devp2p over bzz)
 	self.ps, err = pss.NewPss(to, config.Pss)
@@ -341,13 +360,14 @@ func (self *Swarm) Start(srv *p2p.Server) error {
 	newaddr := self.bzz.UpdateLocalAddr([]byte(srv.Self().String()))
 	log.Info("Updated bzz local addr", "oaddr", fmt.Sprintf("%x", newaddr.OAddr), "uaddr", fmt.Sprintf("%s", newaddr.UAddr))
 	// set chequebook
-	if self.config.SwapEnabled {
+	if self.swap != nil && self.backend != nil {
 		ctx := context.Background() // The initial setup has no deadline.
-		err := self.SetChequebook(ctx)
+		err := self.setChequebook(ctx)
 		if err != nil {
 			return fmt.Errorf("Unable to set chequebook for SWAP: %v", err)
 		}
-		log.Debug(fmt.Sprintf("-> cheque book for SWAP: %v", self.config.Swap.Chequebook()))
+		self.swap.SetSettlement(swap.NewChequebookSettlement(self.config.Contract, self.privateKey, self.backend))
+		log.Debug(fmt.Sprintf("-> cheque book for SWAP: %v", self.config.Contract.Hex()))
 	} else {
 		log.Debug(fmt.Sprintf("SWAP disabled: no cheque book set"))
 	}
@@ -418,9 +438,8 @@ func (self *Swarm) Stop() error {
 	if self.ps != nil {
 		self.ps.Stop()
 	}
-	if ch := self.config.Swap.Chequebook(); ch != nil {
-		ch.Stop()
-		ch.Save()
+	if self.swap != nil {
+		self.swap.Stop()
 	}
 
 	if self.netStore != nil {
@@ -439,6 +458,9 @@ func (self *Swarm) Protocols() (protos []p2p.Protocol) {
 	if self.ps != nil {
 		protos = append(protos, self.ps.Protocols()...)
 	}
+	if self.swap != nil {
+		protos = append(protos, self.swap.Protocols()...)
+	}
 	return
 }
 
@@ -459,7 +481,7 @@ func (self *Swarm) APIs() []rpc.API {
 		{
 			Namespace: "bzz",
 			Version:   "3.0",
-			Service:   &Info{self.config, chequebook.ContractParams},
+			Service:   &Info{self.config},
 			Public:    true,
 		},
 		// admin APIs
@@ -469,12 +491,6 @@ func (self *Swarm) APIs() []rpc.API {
 			Service:   api.NewControl(self.api, self.bzz.Hive),
 			Public:    false,
 		},
-		{
-			Namespace: "chequebook",
-			Version:   chequebook.Version,
-			Service:   chequebook.NewApi(self.config.Swap.Chequebook),
-			Public:    false,
-		},
 		{
 			Namespace: "swarmfs",
 			Version:   fuse.Swarmfs_Version,
@@ -488,6 +504,9 @@ func (self *Swarm) APIs() []rpc.API {
 	if self.ps != nil {
 		apis = append(apis, self.ps.APIs()...)
 	}
+	if self.swap != nil {
+		apis = append(apis, self.swap.APIs()...)
+	}
 
 	return apis
 }
@@ -496,20 +515,33 @@ func (self *Swarm) Api() *api.API {
 	return self.api
 }
 
-// SetChequebook ensures that the local checquebook is set up on chain.
-func (self *Swarm) SetChequebook(ctx context.Context) error {
-	err := self.config.Swap.SetChequebook(ctx, self.backend, self.config.Path)
+// setChequebook ensures that the local chequebook is set up on chain. Unless
+// configured, the chequebook deployed before is used, or a new one is deployed
+// and its address saved in the state store.
+func (self *Swarm) setChequebook(ctx context.Context) error {
+	if self.config.Contract != (common.Address{}) {
+		return nil
+	}
+	err := self.stateStore.Get(chequebookKey, &self.config.Contract)
+	if err == nil {
+		return nil
+	}
+	if err != state.ErrNotFound {
+		return err
+	}
+	opts := bind.NewKeyedTransactor(self.privateKey)
+	opts.Context = ctx
+	self.config.Contract, err = swap.DeployChequebook(opts, self.backend)
 	if err != nil {
 		return err
 	}
-	log.Info(fmt.Sprintf("new chequebook set (%v): saving config file, resetting all connections in the hive", self.config.Swap.Contract.Hex()))
-	return nil
+	log.Info(fmt.Sprintf("new chequebook set (%v): saving address in the state store", self.config.Contract.Hex()))
+	return self.stateStore.Put(chequebookKey, self.config.Contract)
 }
 
 // serialisable info about swarm
 type Info struct {
 	*api.Config
-	*chequebook.Params
 }
 
 func (self *Info) Info() *Info {
@@ -17,8 +17,13 @@
 package mailserver
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
+	"sync"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -29,11 +34,86 @@ import (
 	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
+// DBKeyLength is the length of the archive keys, which are also used as cursors.
+const DBKeyLength = common.HashLength + 4
+
+// housekeepingCycle is the time between two prunings of the archive and of the
+// rate limiter's request history.
+const housekeepingCycle = time.Minute
+
+var (
+	errLowPoW             = errors.New("insufficient PoW")
+	errDecryptionFailed   = errors.New("failed to decrypt request")
+	errUnauthenticated    = errors.New("request not signed by the requesting peer")
+	errLegacyRequest      = errors.New("legacy request format not accepted")
+	errUndersizedRequest  = errors.New("undersized request")
+	errUndersizedBloom    = errors.New("undersized bloom filter in request")
+	errInvalidBloom       = errors.New("invalid bloom filter size")
+	errInvalidCursor      = errors.New("invalid cursor")
+	errMissingDBPath      = errors.New("DB file is not specified")
+	errMissingPassword    = errors.New("password is not specified")
+	errServerNotAvailable = errors.New("mail server is not initialized")
+)
+
+// ErrRateLimitExceeded is the error of the responses to requests made more often
+// than the rate limit of the server allows. Clients may retry the request later.
+var ErrRateLimitExceeded = errors.New("request rate limit exceeded")
+
+// Config contains the policies of the mail server.
+type Config struct {
+	MaxLimit  uint32        // Maximum number of envelopes delivered per request, 0 for no limit
+	RateLimit time.Duration // Minimum time between two requests of a peer, 0 for no limit
+	Retention time.Duration // Time archived envelopes are kept for, 0 to keep them forever
+	Legacy    bool          // Whether requests in the legacy binary format are accepted
+}
+
+// DefaultConfig contains the default policies of the mail server.
+var DefaultConfig = Config{
+	MaxLimit:  1000,
+	RateLimit: time.Second,
+}
+
+// MessagesRequest is the payload of a request for historic messages, sent to
+// the mail server symmetrically encrypted with the key derived from its
+// password and signed with the node key of the requesting peer.
+//
+// For backwards compatibility the server can be configured to also accept the
+// legacy binary payload of the lower and upper bounds followed by an optional
+// bloom filter. Such requests must be signed by the requesting peer as well.
+type MessagesRequest struct {
+	Lower  uint32              // Start of the time range to query, inclusive
+	Upper  uint32              // End of the time range to query, inclusive
+	Bloom  []byte              // Bloom filter to match the envelopes with, empty to match all
+	Topics []whisper.TopicType // Topics to match exactly, taking precedence over the bloom
+	Limit  uint32              // Maximum number of envelopes to deliver, 0 for the server's maximum
+	Cursor []byte              // Cursor of a previous response to continue from, empty to start
+}
+
+// matches returns whether the envelope satisfies the topic criteria of the request.
+func (req *MessagesRequest) matches(env *whisper.Envelope) bool {
+	if len(req.Topics) > 0 {
+		for _, topic := range req.Topics {
+			if env.Topic == topic {
+				return true
+			}
+		}
+		return false
+	}
+	return whisper.BloomFilterMatch(req.Bloom, env.Bloom())
+}
+
 type WMailServer struct {
-	db  *leveldb.DB
-	w   *whisper.Whisper
-	pow float64
-	key []byte
+	db     *leveldb.DB
+	w      *whisper.Whisper
+	pow    float64
+	key    []byte
+	config Config
+
+	requests map[string]time.Time // Time of the last request of each peer, for rate limiting
+	lock     sync.Mutex           // Protects the request history
+
+	quit chan struct{}
+	wg   sync.WaitGroup
 }
 
 type DBKey struct {
@@ -43,24 +123,29 @@ type DBKey struct {
 }
 
 func NewDbKey(t uint32, h common.Hash) *DBKey {
-	const sz = common.HashLength + 4
 	var k DBKey
 	k.timestamp = t
 	k.hash = h
-	k.raw = make([]byte, sz)
+	k.raw = make([]byte, DBKeyLength)
 	binary.BigEndian.PutUint32(k.raw, k.timestamp)
 	copy(k.raw[4:], k.hash[:])
 	return &k
 }
 
-func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, pow float64) error {
+// Init opens the archive and derives the key of the requests from the password.
+// If config is nil, DefaultConfig is used.
+func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, pow float64, config *Config) error {
 	var err error
 	if len(path) == 0 {
-		return fmt.Errorf("DB file is not specified")
+		return errMissingDBPath
 	}
 
 	if len(password) == 0 {
-		return fmt.Errorf("password is not specified")
+		return errMissingPassword
+	}
+
+	if config == nil {
+		config = &DefaultConfig
 	}
 
 	s.db, err = leveldb.OpenFile(path, nil)
@@ -70,6 +155,8 @@ func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, p
 
 	s.w = shh
 	s.pow = pow
+	s.config = *config
+	s.requests = make(map[string]time.Time)
 
 	MailServerKeyID, err := s.w.AddSymKeyFromPassword(password)
 	if err != nil {
@@ -79,15 +166,59 @@ func (s *WMailServer) Init(shh *whisper.Whisper, path string, password string, p
 	if err != nil {
 		return fmt.Errorf("save symmetric key: %s", err)
 	}
+
+	s.quit = make(chan struct{})
+	s.wg.Add(1)
+	go s.housekeeping()
+
 	return nil
 }
 
 func (s *WMailServer) Close() {
+	if s.quit != nil {
+		close(s.quit)
+		s.wg.Wait()
+	}
 	if s.db != nil {
 		s.db.Close()
 	}
 }
 
+// housekeeping periodically prunes the archive according to the retention
+// policy and forgets the requests no longer relevant for rate limiting.
+func (s *WMailServer) housekeeping() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(housekeepingCycle)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.config.Retention > 0 {
+				threshold := time.Now().Add(-s.config.Retention).Unix()
+				if threshold > 0 {
+					if removed, err := s.Prune(uint32(threshold)); err != nil {
+						log.Error("Failed to prune mail server archive", "err", err)
+					} else if removed > 0 {
+						log.Debug("Pruned mail server archive", "removed", removed)
+					}
+				}
+			}
+			s.lock.Lock()
+			for id, last := range s.requests {
+				if time.Since(last) >= s.config.RateLimit {
+					delete(s.requests, id)
+				}
+			}
+			s.lock.Unlock()
+
+		case <-s.quit:
+			return
+		}
+	}
+}
+
 func (s *WMailServer) Archive(env *whisper.Envelope) {
 	key := NewDbKey(env.Expiry-env.TTL, env.Hash())
 	rawEnvelope, err := rlp.EncodeToBytes(env)
@@ -101,95 +232,200 @@ func (s *WMailServer) Archive(env *whisper.Envelope) {
 	}
 }
 
+// Prune deletes the archived envelopes sent before the given timestamp,
+// returning the number of envelopes removed.
+func (s *WMailServer) Prune(before uint32) (int, error) {
+	if s.db == nil {
+		return 0, errServerNotAvailable
+	}
+	it := s.db.NewIterator(&util.Range{Limit: NewDbKey(before, common.Hash{}).raw}, nil)
+	defer it.Release()
+
+	batch := new(leveldb.Batch)
+	for it.Next() {
+		batch.Delete(it.Key())
+	}
+	if err := it.Error(); err != nil {
+		return 0, err
+	}
+	return batch.Len(), s.db.Write(batch, nil)
+}
+
+// DeliverMail validates the request of the peer and sends it the matching
+// archived envelopes, followed by a response signalling the completion of the
+// request, or the reason of its rejection.
 func (s *WMailServer) DeliverMail(peer *whisper.Peer, request *whisper.Envelope) {
 	if peer == nil {
 		log.Error("Whisper peer is nil")
 		return
 	}
+	cursor, err := s.serveRequest(peer.ID(), peer, request)
+	response := &whisper.MailServerResponse{RequestID: request.Hash(), Cursor: cursor}
+	if err != nil {
+		log.Warn("Failed to process mail request", "peer", fmt.Sprintf("%x", peer.ID()), "err", err)
+		response.Error = err.Error()
+	}
+	if err := s.w.SendHistoricMessageResponse(peer, response); err != nil {
+		log.Error(fmt.Sprintf("Failed to send request complete message to peer: %s", err))
+	}
+}
+
+// serveRequest validates the request of the peer and, if the peer is within its
+// rate limit, sends it the matching archived envelopes. Invalid requests don't
+// count towards the rate limit. If more envelopes are available, the cursor to
+// resume from is returned.
+func (s *WMailServer) serveRequest(peerID []byte, peer *whisper.Peer, request *whisper.Envelope) ([]byte, error) {
+	req, err := s.validateRequest(peerID, request)
+	if err != nil {
+		return nil, err
+	}
+	if !s.allowRequest(peerID) {
+		return nil, ErrRateLimitExceeded
+	}
+	_, cursor, err := s.processRequest(peer, req)
+	return cursor, err
+}
 
-	ok, lower, upper, bloom := s.validateRequest(peer.ID(), request)
-	if ok {
-		s.processRequest(peer, lower, upper, bloom)
+// allowRequest checks whether the peer may make a request according to the rate
+// limit, recording the time of the request if so.
+func (s *WMailServer) allowRequest(peerID []byte) bool {
+	if s.config.RateLimit == 0 {
+		return true
 	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	if last, ok := s.requests[string(peerID)]; ok && now.Sub(last) < s.config.RateLimit {
+		return false
+	}
+	s.requests[string(peerID)] = now
+	return true
 }
 
-func (s *WMailServer) processRequest(peer *whisper.Peer, lower, upper uint32, bloom []byte) []*whisper.Envelope {
-	ret := make([]*whisper.Envelope, 0)
-	var err error
-	var zero common.Hash
-	kl := NewDbKey(lower, zero)
-	ku := NewDbKey(upper+1, zero) // LevelDB is exclusive, while the Whisper API is inclusive
-	i := s.db.NewIterator(&util.Range{Start: kl.raw, Limit: ku.raw}, nil)
+// processRequest sends the archived envelopes matching the request to the peer,
+// up to the request's limit. If more envelopes are available, the cursor to
+// resume from is returned. If peer is nil, the envelopes are returned instead
+// of sent (used for test purposes).
+func (s *WMailServer) processRequest(peer *whisper.Peer, req *MessagesRequest) ([]*whisper.Envelope, []byte, error) {
+	var (
+		ret  []*whisper.Envelope
+		zero common.Hash
+	)
+	limit := s.config.MaxLimit
+	if req.Limit > 0 && (limit == 0 || req.Limit < limit) {
+		limit = req.Limit
+	}
+	kl := NewDbKey(req.Lower, zero).raw
+	if len(req.Cursor) > 0 && bytes.Compare(req.Cursor, kl) >= 0 {
+		// The smallest key after the cursor is the cursor with a zero byte appended
+		kl = append(common.CopyBytes(req.Cursor), 0)
+	}
+	var ku []byte
+	if req.Upper < math.MaxUint32 {
+		ku = NewDbKey(req.Upper+1, zero).raw // LevelDB is exclusive, while the Whisper API is inclusive
+	}
+	i := s.db.NewIterator(&util.Range{Start: kl, Limit: ku}, nil)
 	defer i.Release()
 
+	var (
+		delivered uint32
+		last      []byte
+		cursor    []byte
+	)
 	for i.Next() {
 		var envelope whisper.Envelope
-		err = rlp.DecodeBytes(i.Value(), &envelope)
-		if err != nil {
+		if err := rlp.DecodeBytes(i.Value(), &envelope); err != nil {
 			log.Error(fmt.Sprintf("RLP decoding failed: %s", err))
+			continue
 		}
-
-		if whisper.BloomFilterMatch(bloom, envelope.Bloom()) {
-			if peer == nil {
-				// used for test purposes
-				ret = append(ret, &envelope)
-			} else {
-				err = s.w.SendP2PDirect(peer, &envelope)
-				if err != nil {
-					log.Error(fmt.Sprintf("Failed to send direct message to peer: %s", err))
-					return nil
-				}
-			}
+		if !req.matches(&envelope) {
+			continue
 		}
+		// Stop at the first envelope over the limit, signalling there are more
+		if limit > 0 && delivered == limit {
+			cursor = last
+			break
+		}
+		if peer == nil {
+			// used for test purposes
+			ret = append(ret, &envelope)
+		} else if err := s.w.SendP2PDirect(peer, &envelope); err != nil {
+			return nil, nil, fmt.Errorf("failed to send direct message to peer: %s", err)
+		}
+		delivered++
+		last = common.CopyBytes(i.Key())
 	}
 
-	err = i.Error()
-	if err != nil {
+	if err := i.Error(); err != nil {
 		log.Error(fmt.Sprintf("Level DB iterator error: %s", err))
+		return nil, nil, err
 	}
-
-	return ret
+	return ret, cursor, nil
 }
 
-func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope) (bool, uint32, uint32, []byte) {
+// validateRequest opens the request envelope, decodes its payload and checks
+// that it was signed by the requesting peer. Legacy requests are only accepted
+// if enabled in the config.
+func (s *WMailServer) validateRequest(peerID []byte, request *whisper.Envelope) (*MessagesRequest, error) {
 	if s.pow > 0.0 && request.PoW() < s.pow {
-		return false, 0, 0, nil
+		return nil, errLowPoW
 	}
 
 	f := whisper.Filter{KeySym: s.key}
 	decrypted := request.Open(&f)
 	if decrypted == nil {
-		log.Warn(fmt.Sprintf("Failed to decrypt p2p request"))
-		return false, 0, 0, nil
+		return nil, errDecryptionFailed
 	}
 
+	if decrypted.Src == nil {
+		return nil, errUnauthenticated
+	}
 	src := crypto.FromECDSAPub(decrypted.Src)
 	if len(src)-len(peerID) == 1 {
 		src = src[1:]
 	}
-
-	// if you want to check the signature, you can do it here. e.g.:
-	// if !bytes.Equal(peerID, src) {
-	if src == nil {
-		log.Warn(fmt.Sprintf("Wrong signature of p2p request"))
-		return false, 0, 0, nil
+	req, legacy, err := decodeRequest(decrypted.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if legacy && !s.config.Legacy {
+		return nil, errLegacyRequest
+	}
+	if !bytes.Equal(peerID, src) {
+		return nil, errUnauthenticated
 	}
+	return req, nil
+}
 
-	var bloom []byte
-	payloadSize := len(decrypted.Payload)
+// decodeRequest decodes the payload of a request, either an RLP encoded
+// MessagesRequest or the legacy binary format, reporting which one it was.
+func decodeRequest(payload []byte) (*MessagesRequest, bool, error) {
+	req := new(MessagesRequest)
+	if err := rlp.DecodeBytes(payload, req); err == nil {
+		switch {
+		case len(req.Bloom) == 0:
+			req.Bloom = whisper.MakeFullNodeBloom()
+		case len(req.Bloom) != whisper.BloomFilterSize:
+			return nil, false, errInvalidBloom
+		}
+		if len(req.Cursor) != 0 && len(req.Cursor) != DBKeyLength {
+			return nil, false, errInvalidCursor
+		}
+		return req, false, nil
+	}
+	payloadSize := len(payload)
 	if payloadSize < 8 {
-		log.Warn(fmt.Sprintf("Undersized p2p request"))
-		return false, 0, 0, nil
+		return nil, true, errUndersizedRequest
 	} else if payloadSize == 8 {
-		bloom = whisper.MakeFullNodeBloom()
+		req.Bloom = whisper.MakeFullNodeBloom()
 	} else if payloadSize < 8+whisper.BloomFilterSize {
-		log.Warn(fmt.Sprintf("Undersized bloom filter in p2p request"))
-		return false, 0, 0, nil
+		return nil, true, errUndersizedBloom
 	} else {
-		bloom = decrypted.Payload[8 : 8+whisper.BloomFilterSize]
+		req.Bloom = payload[8 : 8+whisper.BloomFilterSize]
 	}
 
-	lower := binary.BigEndian.Uint32(decrypted.Payload[:4])
-	upper := binary.BigEndian.Uint32(decrypted.Payload[4:8])
-	return true, lower, upper, bloom
+	req.Lower = binary.BigEndian.Uint32(payload[:4])
+	req.Upper = binary.BigEndian.Uint32(payload[4:8])
+	return req, true, nil
 }
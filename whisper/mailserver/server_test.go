@@ -21,12 +21,15 @@ import (
 	"crypto/ecdsa"
 	"encoding/binary"
 	"io/ioutil"
+	"math"
 	"math/rand"
+	"os"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	whisper "github.com/ethereum/go-ethereum/whisper/whisperv6"
 )
 
@@ -59,10 +62,14 @@ func TestDBKey(t *testing.T) {
 }
 
 func generateEnvelope(t *testing.T) *whisper.Envelope {
+	return generateTopicEnvelope(t, whisper.TopicType{0x1F, 0x7E, 0xA1, 0x7F})
+}
+
+func generateTopicEnvelope(t *testing.T, topic whisper.TopicType) *whisper.Envelope {
 	h := crypto.Keccak256Hash([]byte("test sample data"))
 	params := &whisper.MessageParams{
 		KeySym:   h[:],
-		Topic:    whisper.TopicType{0x1F, 0x7E, 0xA1, 0x7F},
+		Topic:    topic,
 		Payload:  []byte("test payload"),
 		PoW:      powRequirement,
 		WorkTime: 2,
@@ -92,7 +99,9 @@ func TestMailServer(t *testing.T) {
 	shh = whisper.New(&whisper.DefaultConfig)
 	shh.RegisterServer(&server)
 
-	err = server.Init(shh, dir, password, powRequirement)
+	config := DefaultConfig
+	config.Legacy = true
+	err = server.Init(shh, dir, password, powRequirement, &config)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -143,23 +152,26 @@ func deliverTest(t *testing.T, server *WMailServer, env *whisper.Envelope) {
 func singleRequest(t *testing.T, server *WMailServer, env *whisper.Envelope, p *ServerTestParams, expect bool) {
 	request := createRequest(t, p)
 	src := crypto.FromECDSAPub(&p.key.PublicKey)
-	ok, lower, upper, bloom := server.validateRequest(src, request)
-	if !ok {
-		t.Fatalf("request validation failed, seed: %d.", seed)
+	req, err := server.validateRequest(src, request)
+	if err != nil {
+		t.Fatalf("request validation failed, seed: %d: %v.", seed, err)
 	}
-	if lower != p.low {
+	if req.Lower != p.low {
 		t.Fatalf("request validation failed (lower bound), seed: %d.", seed)
 	}
-	if upper != p.upp {
+	if req.Upper != p.upp {
 		t.Fatalf("request validation failed (upper bound), seed: %d.", seed)
 	}
 	expectedBloom := whisper.TopicToBloom(p.topic)
-	if !bytes.Equal(bloom, expectedBloom) {
+	if !bytes.Equal(req.Bloom, expectedBloom) {
 		t.Fatalf("request validation failed (topic), seed: %d.", seed)
 	}
 
 	var exist bool
-	mail := server.processRequest(nil, p.low, p.upp, bloom)
+	mail, _, err := server.processRequest(nil, req)
+	if err != nil {
+		t.Fatalf("request processing failed, seed: %d: %v.", seed, err)
+	}
 	for _, msg := range mail {
 		if msg.Hash() == env.Hash() {
 			exist = true
@@ -172,10 +184,8 @@ func singleRequest(t *testing.T, server *WMailServer, env *whisper.Envelope, p *
 	}
 
 	src[0]++
-	ok, lower, upper, bloom = server.validateRequest(src, request)
-	if !ok {
-		// request should be valid regardless of signature
-		t.Fatalf("request validation false negative, seed: %d (lower: %d, upper: %d).", seed, lower, upper)
+	if _, err = server.validateRequest(src, request); err != errUnauthenticated {
+		t.Fatalf("request validation false positive, seed: %d: %v.", seed, err)
 	}
 }
 
@@ -186,6 +196,10 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 	binary.BigEndian.PutUint32(data[4:], p.upp)
 	data = append(data, bloom...)
 
+	return createRequestWithPayload(t, p.key, data)
+}
+
+func createRequestWithPayload(t *testing.T, src *ecdsa.PrivateKey, data []byte) *whisper.Envelope {
 	key, err := shh.GetSymKey(keyID)
 	if err != nil {
 		t.Fatalf("failed to retrieve sym key with seed %d: %s.", seed, err)
@@ -193,11 +207,11 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 
 	params := &whisper.MessageParams{
 		KeySym:   key,
-		Topic:    p.topic,
+		Topic:    whisper.TopicType{0x1F, 0x7E, 0xA1, 0x7F},
 		Payload:  data,
 		PoW:      powRequirement * 2,
 		WorkTime: 2,
-		Src:      p.key,
+		Src:      src,
 	}
 
 	msg, err := whisper.NewSentMessage(params)
@@ -210,3 +224,205 @@ func createRequest(t *testing.T, p *ServerTestParams) *whisper.Envelope {
 	}
 	return env
 }
+
+func newTestServer(t *testing.T, config *Config) (*WMailServer, func()) {
+	const password = "password_for_this_test"
+
+	dir, err := ioutil.TempDir("", "whisper-server-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := new(WMailServer)
+	shh = whisper.New(&whisper.DefaultConfig)
+	shh.RegisterServer(server)
+
+	if err := server.Init(shh, dir, password, powRequirement, config); err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	keyID, err = shh.AddSymKeyFromPassword(password)
+	if err != nil {
+		t.Fatalf("Failed to create symmetric key for mail request: %s", err)
+	}
+	return server, func() {
+		server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// decodeTestRequest wraps the request into an envelope signed by the peer and
+// validates it on the server.
+func decodeTestRequest(t *testing.T, server *WMailServer, peer *ecdsa.PrivateKey, req *MessagesRequest) *MessagesRequest {
+	payload, err := rlp.EncodeToBytes(req)
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	request := createRequestWithPayload(t, peer, payload)
+	decoded, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request)
+	if err != nil {
+		t.Fatalf("request validation failed: %v", err)
+	}
+	return decoded
+}
+
+func TestMailServerAuthentication(t *testing.T) {
+	server, teardown := newTestServer(t, nil)
+	defer teardown()
+
+	peer, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	payload, err := rlp.EncodeToBytes(&MessagesRequest{Upper: math.MaxUint32})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	request := createRequestWithPayload(t, other, payload)
+	if _, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request); err != errUnauthenticated {
+		t.Fatalf("request signed by other key: expected error %v, got %v", errUnauthenticated, err)
+	}
+	request = createRequestWithPayload(t, nil, payload)
+	if _, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request); err != errUnauthenticated {
+		t.Fatalf("unsigned request: expected error %v, got %v", errUnauthenticated, err)
+	}
+}
+
+// Tests that legacy requests are only accepted if enabled, and only when signed
+// by the requesting peer.
+func TestMailServerLegacyRequests(t *testing.T) {
+	peer, _ := crypto.GenerateKey()
+	other, _ := crypto.GenerateKey()
+	p := &ServerTestParams{upp: math.MaxUint32, key: peer}
+
+	server, teardown := newTestServer(t, nil)
+	request := createRequest(t, p)
+	if _, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request); err != errLegacyRequest {
+		t.Errorf("legacy request with default config: expected error %v, got %v", errLegacyRequest, err)
+	}
+	teardown()
+
+	server, teardown = newTestServer(t, &Config{Legacy: true})
+	defer teardown()
+
+	request = createRequest(t, p)
+	if _, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request); err != nil {
+		t.Errorf("legacy request signed by peer rejected: %v", err)
+	}
+	p.key = other
+	request = createRequest(t, p)
+	if _, err := server.validateRequest(crypto.FromECDSAPub(&peer.PublicKey), request); err != errUnauthenticated {
+		t.Errorf("legacy request signed by other key: expected error %v, got %v", errUnauthenticated, err)
+	}
+}
+
+func TestMailServerPaging(t *testing.T) {
+	server, teardown := newTestServer(t, &Config{MaxLimit: 3})
+	defer teardown()
+
+	peer, _ := crypto.GenerateKey()
+	topicA, topicB := whisper.TopicType{0x01, 0x02, 0x03, 0x04}, whisper.TopicType{0x05, 0x06, 0x07, 0x08}
+
+	archived := make(map[common.Hash]bool)
+	for i := 0; i < 5; i++ {
+		env := generateTopicEnvelope(t, topicA)
+		server.Archive(env)
+		archived[env.Hash()] = true
+	}
+	for i := 0; i < 2; i++ {
+		server.Archive(generateTopicEnvelope(t, topicB))
+	}
+	// Page through the envelopes of the first topic
+	req := &MessagesRequest{Upper: math.MaxUint32, Topics: []whisper.TopicType{topicA}, Limit: 2}
+	for _, size := range []int{2, 2, 1} {
+		mail, cursor, err := server.processRequest(nil, decodeTestRequest(t, server, peer, req))
+		if err != nil {
+			t.Fatalf("request processing failed: %v", err)
+		}
+		if len(mail) != size {
+			t.Fatalf("page size mismatch: have %d, want %d", len(mail), size)
+		}
+		for _, env := range mail {
+			if !archived[env.Hash()] {
+				t.Fatalf("unexpected or duplicate envelope delivered: %x", env.Hash())
+			}
+			delete(archived, env.Hash())
+		}
+		if (len(cursor) == 0) != (size == 1) {
+			t.Fatalf("cursor mismatch for page of %d: %x", size, cursor)
+		}
+		req.Cursor = cursor
+	}
+	if len(archived) != 0 {
+		t.Fatalf("%d envelopes not delivered", len(archived))
+	}
+	// Check that the server limit applies if no limit is requested
+	req = &MessagesRequest{Upper: math.MaxUint32}
+	if mail, cursor, _ := server.processRequest(nil, decodeTestRequest(t, server, peer, req)); len(mail) != 3 || len(cursor) == 0 {
+		t.Fatalf("server limit mismatch: have %d envelopes, cursor %x", len(mail), cursor)
+	}
+	req = &MessagesRequest{Upper: math.MaxUint32, Topics: []whisper.TopicType{topicB}}
+	if mail, cursor, _ := server.processRequest(nil, decodeTestRequest(t, server, peer, req)); len(mail) != 2 || len(cursor) != 0 {
+		t.Fatalf("topic filter mismatch: have %d envelopes, cursor %x", len(mail), cursor)
+	}
+}
+
+func TestMailServerPrune(t *testing.T) {
+	server, teardown := newTestServer(t, nil)
+	defer teardown()
+
+	env := generateEnvelope(t)
+	server.Archive(env)
+	birth := env.Expiry - env.TTL
+
+	if removed, err := server.Prune(birth); err != nil || removed != 0 {
+		t.Fatalf("pruned envelopes not older than the threshold: %d (%v)", removed, err)
+	}
+	if removed, err := server.Prune(birth + 1); err != nil || removed != 1 {
+		t.Fatalf("prune count mismatch: have %d (%v), want 1", removed, err)
+	}
+	mail, _, err := server.processRequest(nil, &MessagesRequest{Upper: math.MaxUint32, Bloom: whisper.MakeFullNodeBloom()})
+	if err != nil || len(mail) != 0 {
+		t.Fatalf("pruned envelopes delivered: %d (%v)", len(mail), err)
+	}
+}
+
+func TestMailServerRateLimit(t *testing.T) {
+	server, teardown := newTestServer(t, &Config{RateLimit: time.Hour})
+	defer teardown()
+
+	if !server.allowRequest([]byte("peer1")) {
+		t.Fatalf("first request rejected")
+	}
+	if server.allowRequest([]byte("peer1")) {
+		t.Fatalf("request within rate limit allowed")
+	}
+	if !server.allowRequest([]byte("peer2")) {
+		t.Fatalf("first request of other peer rejected")
+	}
+}
+
+// Tests that invalid requests don't count towards the rate limit of the peer.
+func TestMailServerRateLimitInvalidRequest(t *testing.T) {
+	server, teardown := newTestServer(t, &Config{RateLimit: time.Hour})
+	defer teardown()
+
+	peer, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	peerID := crypto.FromECDSAPub(&peer.PublicKey)
+
+	garbage := createRequestWithPayload(t, peer, []byte{0x01, 0x02})
+	if _, err := server.serveRequest(peerID, nil, garbage); err == nil || err == ErrRateLimitExceeded {
+		t.Fatalf("invalid request: expected validation error, got %v", err)
+	}
+	payload, err := rlp.EncodeToBytes(&MessagesRequest{Upper: math.MaxUint32})
+	if err != nil {
+		t.Fatalf("failed to encode request: %v", err)
+	}
+	request := createRequestWithPayload(t, peer, payload)
+	if _, err := server.serveRequest(peerID, nil, request); err != nil {
+		t.Fatalf("valid request after invalid one rejected: %v", err)
+	}
+	if _, err := server.serveRequest(peerID, nil, request); err != ErrRateLimitExceeded {
+		t.Fatalf("request within rate limit: expected error %v, got %v", ErrRateLimitExceeded, err)
+	}
+}
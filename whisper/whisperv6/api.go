@@ -100,6 +100,12 @@ func (api *PublicWhisperAPI) SetBloomFilter(ctx context.Context, bloom hexutil.B
 	return true, api.w.SetBloomFilter(bloom)
 }
 
+// SetTopicInterest sets the exact topics of interest, and notifies the peers.
+// An empty list reverts to the bloom filter.
+func (api *PublicWhisperAPI) SetTopicInterest(ctx context.Context, topics []TopicType) (bool, error) {
+	return true, api.w.SetTopicInterest(topics)
+}
+
 // MarkTrustedPeer marks a peer trusted, which will allow it to send historic (expired) messages.
 // Note: This function is not adding new nodes, the node needs to exists as a peer.
 func (api *PublicWhisperAPI) MarkTrustedPeer(ctx context.Context, enode string) (bool, error) {
@@ -21,6 +21,7 @@ type Config struct {
 	MaxMessageSize                        uint32  `toml:",omitempty"`
 	MinimumAcceptedPOW                    float64 `toml:",omitempty"`
 	RestrictConnectionBetweenLightClients bool    `toml:",omitempty"`
+	LightClientBandwidth                  uint32  `toml:",omitempty"` // Bytes per second relayed to each light client peer, 0 for unlimited
 }
 
 // DefaultConfig represents (shocker!) the default configuration.
@@ -28,4 +29,5 @@ var DefaultConfig = Config{
 	MaxMessageSize:                        DefaultMaxMessageSize,
 	MinimumAcceptedPOW:                    DefaultMinimumPoW,
 	RestrictConnectionBetweenLightClients: true,
+	LightClientBandwidth:                  DefaultLightClientBandwidth,
 }
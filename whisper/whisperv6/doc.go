@@ -34,6 +34,8 @@ package whisperv6
 
 import (
 	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // Whisper protocol parameters
@@ -43,13 +45,15 @@ const (
 	ProtocolName       = "shh"     // Nickname of the protocol in geth
 
 	// whisper protocol message codes, according to EIP-627
-	statusCode           = 0   // used by whisper protocol
-	messagesCode         = 1   // normal whisper message
-	powRequirementCode   = 2   // PoW requirement
-	bloomFilterExCode    = 3   // bloom filter exchange
-	p2pRequestCode       = 126 // peer-to-peer message, used by Dapp protocol
-	p2pMessageCode       = 127 // peer-to-peer message (to be consumed by the peer, but not forwarded any further)
-	NumberOfMessageCodes = 128
+	statusCode             = 0   // used by whisper protocol
+	messagesCode           = 1   // normal whisper message
+	powRequirementCode     = 2   // PoW requirement
+	bloomFilterExCode      = 3   // bloom filter exchange
+	topicInterestExCode    = 4   // exact topic interest exchange
+	p2pRequestCompleteCode = 125 // peer-to-peer message, signals the completion of a historic messages request
+	p2pRequestCode         = 126 // peer-to-peer message, used by Dapp protocol
+	p2pMessageCode         = 127 // peer-to-peer message (to be consumed by the peer, but not forwarded any further)
+	NumberOfMessageCodes   = 128
 
 	SizeMask      = byte(3) // mask used to extract the size of payload size field from the flags
 	signatureFlag = byte(4)
@@ -68,6 +72,9 @@ const (
 	DefaultMaxMessageSize = uint32(1024 * 1024)
 	DefaultMinimumPoW     = 0.2
 
+	MaxTopicInterest            = 1000              // maximum number of topics a peer may advertise interest in
+	DefaultLightClientBandwidth = uint32(64 * 1024) // bytes per second relayed to a light client peer
+
 	padSizeLimit      = 256 // just an arbitrary number, could be changed without breaking the protocol
 	messageQueueLimit = 1024
 
@@ -88,3 +95,11 @@ type MailServer interface {
 	Archive(env *Envelope)
 	DeliverMail(whisperPeer *Peer, request *Envelope)
 }
+
+// MailServerResponse is sent by a mail server with p2pRequestCompleteCode after
+// it processed a request, once all the delivered envelopes have been sent.
+type MailServerResponse struct {
+	RequestID common.Hash // Hash of the request envelope this is a response to
+	Cursor    []byte      // Position to request the next page from, empty if all were delivered
+	Error     string      // Reason of the request's rejection, empty if it was served
+}
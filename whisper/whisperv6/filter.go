@@ -145,6 +145,21 @@ func (fs *Filters) getWatchersByTopic(topic TopicType) []*Filter {
 	return res
 }
 
+// topics returns all the topics the installed filters are interested in, and
+// whether any of the filters is interested in every topic.
+func (fs *Filters) topics() ([]TopicType, bool) {
+	fs.mutex.RLock()
+	defer fs.mutex.RUnlock()
+
+	topics := make([]TopicType, 0, len(fs.topicMatcher))
+	for topic, watchers := range fs.topicMatcher {
+		if len(watchers) > 0 {
+			topics = append(topics, topic)
+		}
+	}
+	return topics, len(fs.allTopicsMatcher) > 0
+}
+
 // Get returns a filter from the collection with a specific ID
 func (fs *Filters) Get(id string) *Filter {
 	fs.mutex.RLock()
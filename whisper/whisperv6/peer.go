@@ -40,6 +40,11 @@ type Peer struct {
 	bloomMu        sync.Mutex
 	bloomFilter    []byte
 	fullNode       bool
+	topicInterest  map[TopicType]struct{} // Exact topics the peer is interested in, nil if not advertised
+	lightNode      bool                   // Whether the peer is a light client, subject to the bandwidth budget
+
+	allowance int64     // Bytes that may still be relayed to a light client peer
+	refilled  time.Time // Time the allowance was last topped up
 
 	known mapset.Set // Messages already known by the peer to avoid wasting bandwidth
 
@@ -86,7 +91,12 @@ func (peer *Peer) handshake() error {
 		powConverted := math.Float64bits(pow)
 		bloom := peer.host.BloomFilter()
 
-		errc <- p2p.SendItems(peer.ws, statusCode, ProtocolVersion, powConverted, bloom, isLightNode)
+		topics := peer.host.TopicInterest()
+		if topics == nil {
+			topics = []TopicType{}
+		}
+
+		errc <- p2p.SendItems(peer.ws, statusCode, ProtocolVersion, powConverted, bloom, isLightNode, topics)
 	}()
 
 	// Fetch the remote status packet and verify protocol match
@@ -134,6 +144,17 @@ func (peer *Peer) handshake() error {
 	if isRemotePeerLightNode && isLightNode && isRestrictedLightNodeConnection {
 		return fmt.Errorf("peer [%x] is useless: two light client communication restricted", peer.ID())
 	}
+	peer.lightNode = isRemotePeerLightNode
+
+	if err == nil {
+		var topics []TopicType
+		if err := s.Decode(&topics); err == nil {
+			if len(topics) > MaxTopicInterest {
+				return fmt.Errorf("peer [%x] sent bad status message: too many topics of interest %d", peer.ID(), len(topics))
+			}
+			peer.setTopicInterest(topics)
+		}
+	}
 
 	if err := <-errc; err != nil {
 		return fmt.Errorf("peer [%x] failed to send status packet: %v", peer.ID(), err)
@@ -193,15 +214,24 @@ func (peer *Peer) expire() {
 }
 
 // broadcast iterates over the collection of envelopes and transmits yet unknown
-// ones over the network.
+// ones over the network. Light client peers only receive envelopes within their
+// bandwidth budget, the rest being postponed until the budget is replenished.
 func (peer *Peer) broadcast() error {
 	envelopes := peer.host.Envelopes()
+	allowance, limited := peer.refillAllowance()
 	bundle := make([]*Envelope, 0, len(envelopes))
 	for _, envelope := range envelopes {
-		if !peer.marked(envelope) && envelope.PoW() >= peer.powRequirement && peer.bloomMatch(envelope) {
+		if limited && allowance <= 0 {
+			break
+		}
+		if !peer.marked(envelope) && envelope.PoW() >= peer.powRequirement && peer.topicMatch(envelope) {
 			bundle = append(bundle, envelope)
+			allowance -= int64(envelope.size())
 		}
 	}
+	if limited {
+		peer.allowance = allowance
+	}
 
 	if len(bundle) > 0 {
 		// transmit the batch of envelopes
@@ -219,6 +249,30 @@ func (peer *Peer) broadcast() error {
 	return nil
 }
 
+// refillAllowance tops up the bandwidth allowance of a light client peer for the
+// time elapsed since the last broadcast, capped at one second worth of traffic.
+// It returns the allowance, and whether the peer is bandwidth limited at all.
+//
+// The allowance may go negative if an envelope larger than the remainder is sent,
+// so that envelopes larger than the budget still get through eventually.
+func (peer *Peer) refillAllowance() (int64, bool) {
+	rate := int64(peer.host.LightClientBandwidth())
+	if !peer.lightNode || rate == 0 {
+		return 0, false
+	}
+	now := time.Now()
+	if peer.refilled.IsZero() {
+		peer.allowance = rate
+	} else {
+		peer.allowance += rate * int64(now.Sub(peer.refilled)) / int64(time.Second)
+	}
+	if peer.allowance > rate {
+		peer.allowance = rate
+	}
+	peer.refilled = now
+	return peer.allowance, true
+}
+
 // ID returns a peer's id
 func (peer *Peer) ID() []byte {
 	id := peer.peer.ID()
@@ -234,6 +288,27 @@ func (peer *Peer) notifyAboutBloomFilterChange(bloom []byte) error {
 	return p2p.Send(peer.ws, bloomFilterExCode, bloom)
 }
 
+func (peer *Peer) notifyAboutTopicInterestChange(topics []TopicType) error {
+	if topics == nil {
+		topics = []TopicType{}
+	}
+	return p2p.Send(peer.ws, topicInterestExCode, topics)
+}
+
+// topicMatch checks whether the envelope is of interest to the peer, according
+// to its exact topic interest if advertised, or its bloom filter otherwise.
+func (peer *Peer) topicMatch(env *Envelope) bool {
+	peer.bloomMu.Lock()
+	topics := peer.topicInterest
+	peer.bloomMu.Unlock()
+
+	if topics == nil {
+		return peer.bloomMatch(env)
+	}
+	_, ok := topics[env.Topic]
+	return ok
+}
+
 func (peer *Peer) bloomMatch(env *Envelope) bool {
 	peer.bloomMu.Lock()
 	defer peer.bloomMu.Unlock()
@@ -250,6 +325,21 @@ func (peer *Peer) setBloomFilter(bloom []byte) {
 	}
 }
 
+// setTopicInterest sets the exact topics the peer is interested in. An empty
+// list means the peer relies on its bloom filter only.
+func (peer *Peer) setTopicInterest(topics []TopicType) {
+	var interest map[TopicType]struct{}
+	if len(topics) > 0 {
+		interest = make(map[TopicType]struct{}, len(topics))
+		for _, topic := range topics {
+			interest[topic] = struct{}{}
+		}
+	}
+	peer.bloomMu.Lock()
+	defer peer.bloomMu.Unlock()
+	peer.topicInterest = interest
+}
+
 func MakeFullNodeBloom() []byte {
 	bloom := make([]byte, BloomFilterSize)
 	for i := 0; i < BloomFilterSize; i++ {
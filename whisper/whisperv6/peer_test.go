@@ -553,6 +553,210 @@ func TestTwoLightPeerHandshakeError(t *testing.T) {
 	}
 }
 
+// Tests that the responses of mail servers are only accepted from trusted peers,
+// and are delivered to the subscribers.
+func TestMailServerResponse(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.Start(nil)
+	defer w.Stop()
+
+	responses := make(chan *MailServerResponse, 1)
+	sub := w.SubscribeMailServerResponses(responses)
+	defer sub.Unsubscribe()
+
+	// Send a response from an untrusted peer first, it must never be delivered
+	// ahead of the trusted one
+	for i, trusted := range []bool{false, true} {
+		response := &MailServerResponse{RequestID: common.Hash{byte(i)}, Cursor: []byte{0x02}}
+		runMailServerResponses(t, w, trusted, response)
+	}
+	select {
+	case have := <-responses:
+		if want := (common.Hash{1}); have.RequestID != want {
+			t.Fatalf("response accepted from untrusted peer: have request %x, want %x", have.RequestID, want)
+		}
+		if !bytes.Equal(have.Cursor, []byte{0x02}) || have.Error != "" {
+			t.Fatalf("response mismatch: have %+v", have)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("response of trusted peer not delivered")
+	}
+}
+
+// Tests that subscribers not consuming the responses of mail servers don't stall
+// the message loop of the peer.
+func TestMailServerResponseSlowSubscriber(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.Start(nil)
+	defer w.Stop()
+
+	sub := w.SubscribeMailServerResponses(make(chan *MailServerResponse))
+	defer sub.Unsubscribe()
+
+	responses := make([]*MailServerResponse, 3)
+	for i := range responses {
+		responses[i] = &MailServerResponse{RequestID: common.Hash{byte(i)}}
+	}
+	done := make(chan struct{})
+	go func() {
+		runMailServerResponses(t, w, true, responses...)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("message loop stalled by slow subscriber")
+	}
+}
+
+// runMailServerResponses feeds the responses to the message loop of a peer with
+// the given trust, returning once they are all processed.
+func runMailServerResponses(t *testing.T, w *Whisper, trusted bool, responses ...*MailServerResponse) {
+	local, remote := p2p.MsgPipe()
+	p := newPeer(w, p2p.NewPeer(discover.NodeID{}, "test", []p2p.Cap{}), local)
+	p.trusted = trusted
+
+	done := make(chan struct{})
+	go func() {
+		w.runMessageLoop(p, local)
+		close(done)
+	}()
+	for _, response := range responses {
+		if err := p2p.Send(remote, p2pRequestCompleteCode, response); err != nil {
+			t.Errorf("failed to send response: %v", err)
+		}
+	}
+	remote.Close()
+	<-done
+}
+
+// addTestEnvelope caches an envelope of the given topic and payload size in the
+// whisper node, to be broadcast to the peers.
+func addTestEnvelope(t *testing.T, w *Whisper, topic TopicType, size int) *Envelope {
+	now := uint32(time.Now().Unix())
+	env := &Envelope{Expiry: now + DefaultTTL, TTL: DefaultTTL, Topic: topic, Data: make([]byte, size)}
+	if _, err := w.add(env, false); err != nil {
+		t.Fatalf("failed to add envelope: %v", err)
+	}
+	return env
+}
+
+// readEnvelopes decodes the envelope batches sent over the pipe, until it's closed.
+func readEnvelopes(remote p2p.MsgReadWriter) <-chan []*Envelope {
+	batches := make(chan []*Envelope, 16)
+	go func() {
+		for {
+			msg, err := remote.ReadMsg()
+			if err != nil {
+				return
+			}
+			var envelopes []*Envelope
+			if msg.Code == messagesCode {
+				msg.Decode(&envelopes)
+			}
+			msg.Discard()
+			batches <- envelopes
+		}
+	}()
+	return batches
+}
+
+// broadcastOnce runs a single broadcast round to the peer, returning the
+// envelopes transmitted.
+func broadcastOnce(t *testing.T, p *Peer, batches <-chan []*Envelope) []*Envelope {
+	if err := p.broadcast(); err != nil {
+		t.Fatalf("failed to broadcast: %v", err)
+	}
+	select {
+	case envelopes := <-batches:
+		return envelopes
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}
+
+func TestPeerTopicInterest(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.SetMinimumPowTest(0)
+
+	wanted, unwanted := TopicType{0x01}, TopicType{0x02}
+	addTestEnvelope(t, w, wanted, 8)
+	addTestEnvelope(t, w, unwanted, 8)
+
+	// The topic interest is advertised in the handshake
+	p := newPeer(w, p2p.NewPeer(discover.NodeID{}, "test", []p2p.Cap{}), &rwStub{[]interface{}{ProtocolVersion, uint64(123), make([]byte, BloomFilterSize), true, []TopicType{wanted}}})
+	if err := p.handshake(); err != nil {
+		t.Fatalf("failed to handshake: %v", err)
+	}
+	if _, ok := p.topicInterest[wanted]; !ok || len(p.topicInterest) != 1 {
+		t.Fatalf("topic interest mismatch: have %v, want [%x]", p.topicInterest, wanted)
+	}
+	// Only the envelopes of interest are broadcast, despite the bloom filter
+	local, remote := p2p.MsgPipe()
+	defer remote.Close()
+
+	p.ws = local
+	p.setBloomFilter(MakeFullNodeBloom())
+
+	envelopes := broadcastOnce(t, p, readEnvelopes(remote))
+	if len(envelopes) != 1 || envelopes[0].Topic != wanted {
+		t.Fatalf("broadcast mismatch: have %v, want topic %x only", envelopes, wanted)
+	}
+	// Clearing the topic interest reverts to the bloom filter
+	done := make(chan struct{})
+	go func() {
+		w.runMessageLoop(p, local)
+		close(done)
+	}()
+	if err := p2p.Send(remote, topicInterestExCode, []TopicType{}); err != nil {
+		t.Fatalf("failed to send topic interest: %v", err)
+	}
+	for i := 0; i < 100; i++ {
+		p.bloomMu.Lock()
+		cleared := p.topicInterest == nil
+		p.bloomMu.Unlock()
+		if cleared {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !p.topicMatch(&Envelope{Topic: unwanted}) {
+		t.Fatalf("topic interest not cleared")
+	}
+	remote.Close()
+	<-done
+}
+
+func TestPeerLightClientBandwidth(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.SetMinimumPowTest(0)
+	w.SetLightClientBandwidth(2500)
+
+	for i := 0; i < 5; i++ {
+		addTestEnvelope(t, w, TopicType{byte(i)}, 1000)
+	}
+	local, remote := p2p.MsgPipe()
+	defer remote.Close()
+
+	p := newPeer(w, p2p.NewPeer(discover.NodeID{}, "test", []p2p.Cap{}), local)
+	p.lightNode = true
+
+	batches := readEnvelopes(remote)
+
+	// The first round sends envelopes until the budget is exceeded
+	if envelopes := broadcastOnce(t, p, batches); len(envelopes) != 3 {
+		t.Fatalf("first round envelope count mismatch: have %d, want 3", len(envelopes))
+	}
+	if envelopes := broadcastOnce(t, p, batches); len(envelopes) != 0 {
+		t.Fatalf("over budget envelope count mismatch: have %d, want 0", len(envelopes))
+	}
+	// Once the budget is replenished, the rest is sent
+	p.refilled = p.refilled.Add(-time.Second)
+	if envelopes := broadcastOnce(t, p, batches); len(envelopes) != 2 {
+		t.Fatalf("second round envelope count mismatch: have %d, want 2", len(envelopes))
+	}
+}
+
 type rwStub struct {
 	payload []interface{}
 }
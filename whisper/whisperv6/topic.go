@@ -55,3 +55,27 @@ func (t TopicType) MarshalText() ([]byte, error) {
 func (t *TopicType) UnmarshalText(input []byte) error {
 	return hexutil.UnmarshalFixedText("Topic", input, t[:])
 }
+
+// containsTopic checks whether the topic is present in the list.
+func containsTopic(topics []TopicType, topic TopicType) bool {
+	for _, t := range topics {
+		if t == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// sameTopics checks whether the two lists contain the same set of topics,
+// regardless of their order.
+func sameTopics(a, b []TopicType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, t := range a {
+		if !containsTopic(b, t) {
+			return false
+		}
+	}
+	return true
+}
@@ -29,6 +29,7 @@ import (
 	mapset "github.com/deckarep/golang-set"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/event"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/p2p"
 	"github.com/ethereum/go-ethereum/rlp"
@@ -57,6 +58,9 @@ const (
 	bloomFilterToleranceIdx                         // Bloom filter tolerated by the whisper node for a limited time
 	lightClientModeIdx                              // Light client mode. (does not forward any messages)
 	restrictConnectionBetweenLightClientsIdx        // Restrict connection between two light clients
+	topicInterestIdx                                // Exact set of topics of interest for this node
+	topicInterestToleranceIdx                       // Topic interest tolerated by the whisper node for a limited time
+	lightClientBandwidthIdx                         // Bandwidth budget of the light client peers, in bytes per second
 )
 
 // Whisper represents a dark communication interface through the Ethereum
@@ -87,7 +91,9 @@ type Whisper struct {
 	statsMu sync.Mutex // guard stats
 	stats   Statistics // Statistics of whisper node
 
-	mailServer MailServer // MailServer interface
+	mailServer        MailServer               // MailServer interface
+	mailResponseQueue chan *MailServerResponse // Queue of the responses of mail servers, handed off to the feed
+	mailResponseFeed  event.Feed               // Feed of the responses of mail servers to our requests
 }
 
 // New creates a Whisper client ready to communicate through the Ethereum P2P network.
@@ -106,6 +112,8 @@ func New(cfg *Config) *Whisper {
 		p2pMsgQueue:   make(chan *Envelope, messageQueueLimit),
 		quit:          make(chan struct{}),
 		syncAllowance: DefaultSyncAllowance,
+
+		mailResponseQueue: make(chan *MailServerResponse, messageQueueLimit),
 	}
 
 	whisper.filters = NewFilters(whisper)
@@ -114,6 +122,7 @@ func New(cfg *Config) *Whisper {
 	whisper.settings.Store(maxMsgSizeIdx, cfg.MaxMessageSize)
 	whisper.settings.Store(overflowIdx, false)
 	whisper.settings.Store(restrictConnectionBetweenLightClientsIdx, cfg.RestrictConnectionBetweenLightClients)
+	whisper.settings.Store(lightClientBandwidthIdx, cfg.LightClientBandwidth)
 
 	// p2p whisper sub protocol handler
 	whisper.protocol = p2p.Protocol{
@@ -182,6 +191,38 @@ func (whisper *Whisper) BloomFilterTolerance() []byte {
 	return val.([]byte)
 }
 
+// TopicInterest returns the exact set of topics this node is interested in. The
+// peers are required to send only messages of these topics; other messages are
+// dropped. If nil, the interest is expressed by the bloom filter only.
+func (whisper *Whisper) TopicInterest() []TopicType {
+	val, exist := whisper.settings.Load(topicInterestIdx)
+	if !exist || val == nil {
+		return nil
+	}
+	return val.([]TopicType)
+}
+
+// TopicInterestTolerance returns the topic interest which is tolerated for a
+// limited time after a new one was advertised to the peers, similarly to
+// BloomFilterTolerance().
+func (whisper *Whisper) TopicInterestTolerance() []TopicType {
+	val, exist := whisper.settings.Load(topicInterestToleranceIdx)
+	if !exist || val == nil {
+		return nil
+	}
+	return val.([]TopicType)
+}
+
+// LightClientBandwidth returns the number of bytes per second relayed to each
+// light client peer, zero meaning unlimited.
+func (whisper *Whisper) LightClientBandwidth() uint32 {
+	val, exist := whisper.settings.Load(lightClientBandwidthIdx)
+	if !exist || val == nil {
+		return 0
+	}
+	return val.(uint32)
+}
+
 // MaxMessageSize returns the maximum accepted message size.
 func (whisper *Whisper) MaxMessageSize() uint32 {
 	val, _ := whisper.settings.Load(maxMsgSizeIdx)
@@ -252,6 +293,40 @@ func (whisper *Whisper) SetBloomFilter(bloom []byte) error {
 	return nil
 }
 
+// SetTopicInterest sets the exact set of topics this node is interested in, and
+// notifies the peers, which will only forward messages of these topics. An empty
+// set reverts to filtering by the bloom filter only.
+func (whisper *Whisper) SetTopicInterest(topics []TopicType) error {
+	if len(topics) > MaxTopicInterest {
+		return fmt.Errorf("too many topics of interest: %d", len(topics))
+	}
+	var t []TopicType
+	if len(topics) > 0 {
+		t = make([]TopicType, len(topics))
+		copy(t, topics)
+	}
+
+	whisper.settings.Store(topicInterestIdx, t)
+	whisper.notifyPeersAboutTopicInterestChange(t)
+
+	go func() {
+		// allow some time before all the peers have processed the notification
+		time.Sleep(time.Duration(whisper.syncAllowance) * time.Second)
+		if sameTopics(whisper.TopicInterest(), t) {
+			// a later change will update the tolerance itself
+			whisper.settings.Store(topicInterestToleranceIdx, t)
+		}
+	}()
+
+	return nil
+}
+
+// SetLightClientBandwidth sets the number of bytes per second relayed to each
+// light client peer, zero meaning unlimited.
+func (whisper *Whisper) SetLightClientBandwidth(bandwidth uint32) {
+	whisper.settings.Store(lightClientBandwidthIdx, bandwidth)
+}
+
 // SetMinimumPoW sets the minimal PoW required by this node
 func (whisper *Whisper) SetMinimumPoW(val float64) error {
 	if val < 0.0 {
@@ -330,6 +405,20 @@ func (whisper *Whisper) notifyPeersAboutBloomFilterChange(bloom []byte) {
 	}
 }
 
+func (whisper *Whisper) notifyPeersAboutTopicInterestChange(topics []TopicType) {
+	arr := whisper.getPeers()
+	for _, p := range arr {
+		err := p.notifyAboutTopicInterestChange(topics)
+		if err != nil {
+			// allow one retry
+			err = p.notifyAboutTopicInterestChange(topics)
+		}
+		if err != nil {
+			log.Warn("failed to notify peer about new topic interest", "peer", p.ID(), "error", err)
+		}
+	}
+}
+
 func (whisper *Whisper) getPeers() []*Peer {
 	arr := make([]*Peer, len(whisper.peers))
 	i := 0
@@ -380,6 +469,18 @@ func (whisper *Whisper) RequestHistoricMessages(peerID []byte, envelope *Envelop
 	return p2p.Send(p.ws, p2pRequestCode, envelope)
 }
 
+// SendHistoricMessageResponse sends a message with p2pRequestCompleteCode to a
+// specific peer, signalling that its request for historic messages was processed.
+func (whisper *Whisper) SendHistoricMessageResponse(peer *Peer, response *MailServerResponse) error {
+	return p2p.Send(peer.ws, p2pRequestCompleteCode, response)
+}
+
+// SubscribeMailServerResponses subscribes to the responses of mail servers to
+// the requests for historic messages sent via RequestHistoricMessages.
+func (whisper *Whisper) SubscribeMailServerResponses(ch chan<- *MailServerResponse) event.Subscription {
+	return whisper.mailResponseFeed.Subscribe(ch)
+}
+
 // SendP2PMessage sends a peer-to-peer message to a specific peer.
 func (whisper *Whisper) SendP2PMessage(peerID []byte, envelope *Envelope) error {
 	p, err := whisper.getPeer(peerID)
@@ -577,6 +678,7 @@ func (whisper *Whisper) Subscribe(f *Filter) (string, error) {
 	s, err := whisper.filters.Install(f)
 	if err == nil {
 		whisper.updateBloomFilter(f)
+		whisper.updateTopicInterest()
 	}
 	return s, err
 }
@@ -598,6 +700,23 @@ func (whisper *Whisper) updateBloomFilter(f *Filter) {
 	}
 }
 
+// updateTopicInterest advertises the topics of all the installed filters as the
+// exact topic interest of a light client, and informs the peers if necessary.
+// Full nodes relay all the messages anyway, so they don't narrow their interest.
+func (whisper *Whisper) updateTopicInterest() {
+	if !whisper.LightClientMode() {
+		return
+	}
+	topics, all := whisper.filters.topics()
+	if all || len(topics) > MaxTopicInterest {
+		// some filter matches any topic, only the bloom filter can be used
+		topics = nil
+	}
+	if !sameTopics(whisper.TopicInterest(), topics) {
+		whisper.SetTopicInterest(topics)
+	}
+}
+
 // GetFilter returns the filter by id.
 func (whisper *Whisper) GetFilter(id string) *Filter {
 	return whisper.filters.Get(id)
@@ -609,6 +728,7 @@ func (whisper *Whisper) Unsubscribe(id string) error {
 	if !ok {
 		return fmt.Errorf("Unsubscribe: Invalid ID")
 	}
+	whisper.updateTopicInterest()
 	return nil
 }
 
@@ -627,6 +747,7 @@ func (whisper *Whisper) Send(envelope *Envelope) error {
 func (whisper *Whisper) Start(*p2p.Server) error {
 	log.Info("started whisper v." + ProtocolVersionStr)
 	go whisper.update()
+	go whisper.processMailResponses()
 
 	numCPU := runtime.NumCPU()
 	for i := 0; i < numCPU; i++ {
@@ -698,6 +819,12 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 
 			trouble := false
 			for _, env := range envelopes {
+				if !whisper.isTopicOfInterest(env.Topic) {
+					// peers not supporting topic interest rely on the bloom
+					// filter only, so the envelope is not treated as spam.
+					log.Trace("envelope of no interest dropped", "peer", p.peer.ID(), "hash", env.Hash().Hex())
+					continue
+				}
 				cached, err := whisper.add(env, whisper.LightClientMode())
 				if err != nil {
 					trouble = true
@@ -736,6 +863,18 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 				return errors.New("invalid bloom filter exchange message")
 			}
 			p.setBloomFilter(bloom)
+		case topicInterestExCode:
+			var topics []TopicType
+			err := packet.Decode(&topics)
+			if err == nil && len(topics) > MaxTopicInterest {
+				err = fmt.Errorf("too many topics of interest: %d", len(topics))
+			}
+
+			if err != nil {
+				log.Warn("failed to decode topic interest exchange message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+				return errors.New("invalid topic interest exchange message")
+			}
+			p.setTopicInterest(topics)
 		case p2pMessageCode:
 			// peer-to-peer message, sent directly to peer bypassing PoW checks, etc.
 			// this message is not supposed to be forwarded to other peers, and
@@ -749,6 +888,22 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 				}
 				whisper.postEvent(&envelope, true)
 			}
+		case p2pRequestCompleteCode:
+			// response of a mail server to our request, only accepted from the
+			// trusted peer the request was sent to.
+			if p.trusted {
+				var response MailServerResponse
+				if err := packet.Decode(&response); err != nil {
+					log.Warn("failed to decode request complete message, peer will be disconnected", "peer", p.peer.ID(), "err", err)
+					return errors.New("invalid request complete message")
+				}
+				// hand the response off, slow subscribers must not stall the peer
+				select {
+				case whisper.mailResponseQueue <- &response:
+				default:
+					log.Warn("mail server response queue overflow, response dropped", "peer", p.peer.ID(), "request", response.RequestID)
+				}
+			}
 		case p2pRequestCode:
 			// Must be processed if mail server is implemented. Otherwise ignore.
 			if whisper.mailServer != nil {
@@ -768,6 +923,16 @@ func (whisper *Whisper) runMessageLoop(p *Peer, rw p2p.MsgReadWriter) error {
 	}
 }
 
+// isTopicOfInterest checks whether the topic is in the advertised topic interest
+// of this node, or in the one tolerated for a short period of peer synchronization.
+func (whisper *Whisper) isTopicOfInterest(topic TopicType) bool {
+	current, tolerated := whisper.TopicInterest(), whisper.TopicInterestTolerance()
+	if current == nil || tolerated == nil {
+		return true
+	}
+	return containsTopic(current, topic) || containsTopic(tolerated, topic)
+}
+
 // add inserts a new envelope into the message pool to be distributed within the
 // whisper network. It also inserts the envelope into the expiration pool at the
 // appropriate time-stamp. In case of error, connection should be dropped.
@@ -889,6 +1054,20 @@ func (whisper *Whisper) processQueue() {
 	}
 }
 
+// processMailResponses delivers the responses of mail servers to the subscribers
+// during the lifetime of the whisper node.
+func (whisper *Whisper) processMailResponses() {
+	for {
+		select {
+		case <-whisper.quit:
+			return
+
+		case response := <-whisper.mailResponseQueue:
+			whisper.mailResponseFeed.Send(response)
+		}
+	}
+}
+
 // update loops until the lifetime of the whisper node, updating its internal
 // state by expiring stale messages from the pool.
 func (whisper *Whisper) update() {
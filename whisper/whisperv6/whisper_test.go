@@ -890,3 +890,50 @@ func TestBloom(t *testing.T) {
 		t.Fatalf("retireved wrong bloom filter")
 	}
 }
+
+func TestTopicInterest(t *testing.T) {
+	w := New(&DefaultConfig)
+	w.syncAllowance = 0
+
+	a, b := TopicType{0x01}, TopicType{0x02}
+
+	// Full nodes don't advertise the topics of their filters
+	id, err := w.Subscribe(&Filter{Topics: [][]byte{a[:]}})
+	if err != nil {
+		t.Fatalf("failed to subscribe: %v", err)
+	}
+	if topics := w.TopicInterest(); topics != nil {
+		t.Fatalf("full node topic interest: %v", topics)
+	}
+	w.Unsubscribe(id)
+
+	// Light clients advertise the topics of all their filters
+	w.SetLightClientMode(true)
+	idA, _ := w.Subscribe(&Filter{Topics: [][]byte{a[:]}})
+	idB, _ := w.Subscribe(&Filter{Topics: [][]byte{b[:]}})
+	if topics := w.TopicInterest(); !sameTopics(topics, []TopicType{a, b}) {
+		t.Fatalf("topic interest mismatch: have %v, want [%x %x]", topics, a, b)
+	}
+	w.Unsubscribe(idB)
+	if topics := w.TopicInterest(); !sameTopics(topics, []TopicType{a}) {
+		t.Fatalf("topic interest mismatch: have %v, want [%x]", topics, a)
+	}
+	// Once the tolerance elapsed, envelopes of other topics are dropped
+	for i := 0; i < 100 && !sameTopics(w.TopicInterestTolerance(), []TopicType{a}); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !w.isTopicOfInterest(a) || w.isTopicOfInterest(b) {
+		t.Fatalf("topic of interest mismatch")
+	}
+	// A filter matching any topic can't be expressed as topic interest
+	idAll, _ := w.Subscribe(&Filter{})
+	if topics := w.TopicInterest(); topics != nil {
+		t.Fatalf("topic interest with catch-all filter: %v", topics)
+	}
+	w.Unsubscribe(idAll)
+	w.Unsubscribe(idA)
+
+	if err := w.SetTopicInterest(make([]TopicType, MaxTopicInterest+1)); err == nil {
+		t.Fatalf("oversized topic interest accepted")
+	}
+}